@@ -0,0 +1,305 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/version"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/golang/glog"
+)
+
+// recentJobs is the number of the most recent jobs in the admin overview.
+const recentJobs = 50
+
+// QueueRequest defines requests to the admin queue endpoint.
+type QueueRequest struct {
+	Bucket string `json:"bucket"`
+	// Purge cancels the jobs waiting in the bucket.
+	Purge bool `json:"purge,omitempty"`
+	// Redrive moves the jobs in the dead letter bucket of the
+	// bucket back to the bucket.
+	Redrive bool `json:"redrive,omitempty"`
+}
+
+// QueueResult is the number of the jobs purged or re-driven.
+type QueueResult struct {
+	Bucket string `json:"bucket"`
+	Jobs   int    `json:"jobs"`
+}
+
+// BucketDepth is the number of the jobs waiting in the bucket,
+// and in its dead letter bucket.
+type BucketDepth struct {
+	Bucket     string `json:"bucket"`
+	Depth      int64  `json:"depth"`
+	DeadLetter int64  `json:"dead_letter"`
+}
+
+// EtcdHealth is the status of the etcd endpoint of the queue.
+type EtcdHealth struct {
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	Version  string `json:"version,omitempty"`
+	DBSize   int64  `json:"db_size,omitempty"`
+	Leader   bool   `json:"leader"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AdminOverview is the state of the backend shown in the admin UI.
+type AdminOverview struct {
+	Version version.Info  `json:"version"`
+	Status  Status        `json:"status"`
+	Buckets []BucketDepth `json:"buckets"`
+	// Jobs are the most recent jobs, newest first.
+	Jobs    []queue.Item          `json:"jobs"`
+	Workers []workerproc.Liveness `json:"workers"`
+	Etcd    []EtcdHealth          `json:"etcd"`
+	// Errors are the errors of the parts not loaded (e.g. queue depth).
+	Errors    []string  `json:"errors,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Buckets returns the buckets known to the backend: the job routes, and
+// the buckets of the jobs and the workers, sorted by name.
+func (srv *Server) Buckets() []string {
+	seen := make(map[string]bool)
+	for route := range routeJobTypes {
+		seen[route] = true
+	}
+	for _, item := range srv.Jobs("", false) {
+		seen[item.Bucket] = true
+	}
+	for _, l := range srv.Workers() {
+		for _, b := range l.Buckets {
+			seen[b] = true
+		}
+	}
+	bs := make([]string, 0, len(seen))
+	for b := range seen {
+		if !strings.HasPrefix(b, queue.DeadLetterPrefix+"/") {
+			bs = append(bs, b)
+		}
+	}
+	sort.Strings(bs)
+	return bs
+}
+
+// BucketDepths returns the queue depths of the buckets.
+func (srv *Server) BucketDepths(ctx context.Context, qu queue.Queue) ([]BucketDepth, error) {
+	bs := srv.Buckets()
+	ds := make([]BucketDepth, 0, len(bs))
+	for _, b := range bs {
+		depth, err := qu.Depth(ctx, b)
+		if err != nil {
+			return ds, err
+		}
+		dead, err := qu.Depth(ctx, queue.DeadLetterBucket(b))
+		if err != nil {
+			return ds, err
+		}
+		ds = append(ds, BucketDepth{Bucket: b, Depth: depth, DeadLetter: dead})
+	}
+	return ds, nil
+}
+
+// PurgeBucket removes the jobs waiting in the bucket, and cancels them.
+// The jobs already claimed by workers are not affected.
+func (srv *Server) PurgeBucket(ctx context.Context, qu queue.Queue, bucket string) (int, error) {
+	n := 0
+	for {
+		item, err := qu.TryPop(ctx, bucket, queue.WithGPUFallback(0))
+		if err != nil {
+			return n, err
+		}
+		if item == nil {
+			break
+		}
+		n++
+		if _, aerr := srv.CancelJob(item.RequestID); aerr != nil && aerr.Status != http.StatusNotFound {
+			glog.Warningf("failed to cancel purged job %q (%s)", item.RequestID, aerr.Message)
+		}
+	}
+	glog.Warningf("purged %d job(s) from %q", n, bucket)
+	return n, nil
+}
+
+// Redrive moves the jobs in the dead letter bucket of the bucket back
+// to the bucket, with their attempts reset.
+func (srv *Server) Redrive(ctx context.Context, qu queue.Queue, bucket string) (int, error) {
+	dlb := queue.DeadLetterBucket(bucket)
+	n := 0
+	for {
+		dead, err := qu.TryPop(ctx, dlb, queue.WithGPUFallback(0))
+		if err != nil {
+			return n, err
+		}
+		if dead == nil {
+			break
+		}
+		item := queue.CreateItem(bucket, 100, dead.Value)
+		item.RequestID = dead.RequestID
+		item.JobType = dead.JobType
+		item.GPU = dead.GPU
+		item.User = dead.User
+		if err = qu.Add(ctx, item, queue.WithTTL(enqueueTTL)); err != nil {
+			// keep the job in the dead letter bucket
+			if aerr := qu.Add(ctx, dead); aerr != nil {
+				glog.Warningf("failed to restore %q to %q (%v)", dead.RequestID, dlb, aerr)
+			}
+			return n, err
+		}
+		srv.requestCache.Store(item.RequestID, item)
+		srv.emitJobEvent(JobEnqueued, item)
+		n++
+	}
+	glog.Infof("re-drove %d job(s) from %q to %q", n, dlb, bucket)
+	return n, nil
+}
+
+// EtcdHealth returns the status of the etcd endpoints of the queue.
+func (srv *Server) EtcdHealth(ctx context.Context, qu queue.Queue) []EtcdHealth {
+	if qu == nil || qu.Client() == nil {
+		return nil
+	}
+	eps := qu.ClientEndpoints()
+	hs := make([]EtcdHealth, 0, len(eps))
+	for _, ep := range eps {
+		h := EtcdHealth{Endpoint: ep}
+		cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		resp, err := qu.Client().Status(cctx, ep)
+		cancel()
+		if err != nil {
+			h.Error = err.Error()
+		} else {
+			h.Healthy, h.Version, h.DBSize = true, resp.Version, resp.DbSize
+			h.Leader = resp.Leader == resp.Header.MemberId
+		}
+		hs = append(hs, h)
+	}
+	return hs
+}
+
+// Overview returns the state of the backend for the admin UI.
+func (srv *Server) Overview(ctx context.Context, qu queue.Queue) AdminOverview {
+	ov := AdminOverview{
+		Version:   version.Get(),
+		Status:    srv.Status(),
+		Workers:   srv.Workers(),
+		Etcd:      srv.EtcdHealth(ctx, qu),
+		UpdatedAt: time.Now(),
+	}
+	if ov.Workers == nil {
+		ov.Workers = []workerproc.Liveness{}
+	}
+	ds, err := srv.BucketDepths(ctx, qu)
+	if err != nil {
+		ov.Errors = append(ov.Errors, fmt.Sprintf("failed to get queue depth (%v)", err))
+	}
+	ov.Buckets = ds
+
+	jobs := srv.Jobs("", false)
+	if len(jobs) > recentJobs {
+		jobs = jobs[len(jobs)-recentJobs:]
+	}
+	ov.Jobs = make([]queue.Item, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		ov.Jobs = append(ov.Jobs, jobs[i])
+	}
+	return ov
+}
+
+// adminOverviewHandler returns the admin overview.
+func adminOverviewHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Overview(ctx, qu))
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// CSRFResponse is the CSRF token of the admin requests (see 'CSRFHeader').
+type CSRFResponse struct {
+	Token string `json:"token"`
+}
+
+// adminCSRFHandler returns the CSRF token of the session.
+func adminCSRFHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(CSRFResponse{Token: srv.csrfToken(req)})
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// adminQueueHandler returns the queue depths on GET, and purges
+// or re-drives the bucket on POST.
+func adminQueueHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		ds, err := srv.BucketDepths(ctx, qu)
+		if err != nil {
+			return writeError(w, QueueError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(ds)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var qreq QueueRequest
+		if err = json.Unmarshal(rb, &qreq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if !strings.HasPrefix(qreq.Bucket, "/") || strings.HasPrefix(qreq.Bucket, queue.DeadLetterPrefix+"/") {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid bucket %q", qreq.Bucket))
+		}
+		if qreq.Purge == qreq.Redrive {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected either purge or redrive"))
+		}
+
+		ret := QueueResult{Bucket: qreq.Bucket}
+		if qreq.Purge {
+			ret.Jobs, err = srv.PurgeBucket(ctx, qu, qreq.Bucket)
+		} else {
+			ret.Jobs, err = srv.Redrive(ctx, qu, qreq.Bucket)
+		}
+		if err != nil {
+			glog.Warning(err)
+			return writeError(w, QueueError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(ret)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestAdmin(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 39379, 39380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{rootCtx: context.Background(), qu: qu}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandler, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := with(h, srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	queueHandler := withValidation(ContextHandlerFunc(adminQueueHandler), adminQueueSchemas)
+
+	ctx := context.Background()
+	for _, id := range []string{"req-1", "req-2"} {
+		item := queue.CreateItem("/cats-request", 100, id)
+		item.RequestID = id
+		if err = qu.Add(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+		srv.requestCache.Store(item.RequestID, item)
+	}
+	dead := queue.CreateItem(queue.DeadLetterBucket("/train"), 100, "<script>")
+	dead.RequestID, dead.TimedOut, dead.Attempts = "req-3", true, 2
+	if err = qu.Add(ctx, dead); err != nil {
+		t.Fatal(err)
+	}
+	done := *dead
+	done.Bucket, done.Progress, done.Error = "/train", queue.MaxProgress, "timed out"
+	srv.requestCache.Store(done.RequestID, &done)
+
+	w := serve(ContextHandlerFunc(adminOverviewHandler), http.MethodGet, "/admin/overview", "")
+	var ov AdminOverview
+	if err = json.NewDecoder(w.Body).Decode(&ov); err != nil {
+		t.Fatal(err)
+	}
+	expected := []BucketDepth{{Bucket: "/cats-request", Depth: 2}, {Bucket: "/train", DeadLetter: 1}}
+	if len(ov.Buckets) != len(expected) || ov.Buckets[0] != expected[0] || ov.Buckets[1] != expected[1] {
+		t.Fatalf("expected buckets %+v, got %+v", expected, ov.Buckets)
+	}
+	if len(ov.Jobs) != 3 || ov.Jobs[0].RequestID != "req-3" || len(ov.Etcd) != 1 || !ov.Etcd[0].Healthy || !ov.Etcd[0].Leader {
+		t.Fatalf("unexpected overview %+v", ov)
+	}
+
+	w = serve(ContextHandlerFunc(adminUIHandler), http.MethodGet, "/admin", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected HTML, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	page := w.Body.String()
+	csrf := `var csrfToken = "` + srv.csrfToken(httptest.NewRequest(http.MethodGet, "/admin", nil)) + `"`
+	for _, s := range []string{"/cats-request", "req-2", "request_id: &#34;req-1&#34;", "bucket: &#34;/train&#34;, redrive: true", csrf} {
+		if !strings.Contains(page, s) {
+			t.Fatalf("expected %q in\n%s", s, page)
+		}
+	}
+
+	for _, body := range []string{`{"bucket":"/train"}`, `{"bucket":"/train","purge":true,"redrive":true}`, `{"bucket":"/dead-letter/train","redrive":true}`, `{"purge":true}`} {
+		if w = serve(queueHandler, http.MethodPost, "/admin/queue", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	var ret QueueResult
+	w = serve(queueHandler, http.MethodPost, "/admin/queue", `{"bucket":"/cats-request","purge":true}`)
+	if err = json.NewDecoder(w.Body).Decode(&ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Jobs != 2 {
+		t.Fatalf("expected 2 purged, got %+v", ret)
+	}
+	if item, _ := srv.loadItem("req-1"); !item.Canceled {
+		t.Fatalf("expected canceled, got %+v", item)
+	}
+
+	w = serve(queueHandler, http.MethodPost, "/admin/queue", `{"bucket":"/train","redrive":true}`)
+	if err = json.NewDecoder(w.Body).Decode(&ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Jobs != 1 {
+		t.Fatalf("expected 1 re-driven, got %+v", ret)
+	}
+	item, _ := srv.loadItem("req-3")
+	if item.Bucket != "/train" || item.Progress != 0 || item.Error != "" || item.Attempts != 0 || item.Value != "<script>" {
+		t.Fatalf("unexpected re-driven job %+v", item)
+	}
+
+	w = serve(queueHandler, http.MethodGet, "/admin/queue", "")
+	var ds []BucketDepth
+	if err = json.NewDecoder(w.Body).Decode(&ds); err != nil {
+		t.Fatal(err)
+	}
+	expected = []BucketDepth{{Bucket: "/cats-request"}, {Bucket: "/train", Depth: 1}}
+	if len(ds) != len(expected) || ds[0] != expected[0] || ds[1] != expected[1] {
+		t.Fatalf("expected buckets %+v, got %+v", expected, ds)
+	}
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// adminTemplate renders the admin overview at "/admin", to operate the
+// backend when the frontend is down. The buttons call the admin API.
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return humanize.Time(t)
+	},
+	"bytes":  func(n int64) string { return humanize.Bytes(uint64(n)) },
+	"status": adminJobStatus,
+	"active": func(item queue.Item) bool { return item.Progress != queue.MaxProgress && !item.Canceled },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dplearn admin</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+.bad { color: #b00; }
+.good { color: #080; }
+</style>
+</head>
+<body>
+<h1>dplearn admin</h1>
+<p>
+{{.Version.GitSHA}} ({{.Version.GoVersion}}), updated {{ago .UpdatedAt}} &middot; <a href="/admin">refresh</a>
+{{if .Status.Maintenance}}<br><b class="bad">maintenance mode: {{.Status.Message}}</b>{{end}}
+</p>
+{{range .Errors}}<p class="bad">{{.}}</p>{{end}}
+
+<h2>etcd</h2>
+<table>
+<tr><th>endpoint</th><th>health</th><th>version</th><th>db size</th><th>leader</th></tr>
+{{range .Etcd}}<tr>
+<td>{{.Endpoint}}</td>
+<td>{{if .Healthy}}<span class="good">healthy</span>{{else}}<span class="bad">{{.Error}}</span>{{end}}</td>
+<td>{{.Version}}</td><td>{{if .Healthy}}{{bytes .DBSize}}{{end}}</td><td>{{.Leader}}</td>
+</tr>{{else}}<tr><td colspan="5">no etcd endpoint</td></tr>{{end}}
+</table>
+
+<h2>queue</h2>
+<table>
+<tr><th>bucket</th><th>waiting</th><th>dead letter</th><th></th></tr>
+{{range .Buckets}}<tr>
+<td>{{.Bucket}}</td><td>{{.Depth}}</td><td>{{.DeadLetter}}</td>
+<td>
+<button onclick="act('/admin/queue', {bucket: {{.Bucket}}, purge: true}, 'Cancel all waiting jobs in ' + {{.Bucket}} + '?')"{{if eq .Depth 0}} disabled{{end}}>purge</button>
+<button onclick="act('/admin/queue', {bucket: {{.Bucket}}, redrive: true}, 'Move the dead letter jobs back to ' + {{.Bucket}} + '?')"{{if eq .DeadLetter 0}} disabled{{end}}>re-drive</button>
+</td>
+</tr>{{else}}<tr><td colspan="4">no bucket</td></tr>{{end}}
+</table>
+
+<h2>workers</h2>
+<table>
+<tr><th>id</th><th>host</th><th>buckets</th><th>health</th><th>protocol</th><th>restarts</th><th>updated</th></tr>
+{{range .Workers}}<tr>
+<td>{{.ID}}</td><td>{{.Host}}</td><td>{{range $i, $b := .Buckets}}{{if $i}}, {{end}}{{$b}}{{end}}</td>
+<td>{{if .Healthy}}<span class="good">healthy</span>{{else}}<span class="bad">unhealthy {{.HealthError}}</span>{{end}}{{if .Draining}} (draining){{end}}</td>
+<td>{{.Protocol}}</td><td>{{.Restarts}}</td><td>{{ago .UpdatedAt}}</td>
+</tr>{{else}}<tr><td colspan="7">no worker</td></tr>{{end}}
+</table>
+
+<h2>recent jobs</h2>
+<table>
+<tr><th>request ID</th><th>bucket</th><th>status</th><th>progress</th><th>attempts</th><th>user</th><th>created</th><th>error</th><th></th></tr>
+{{range .Jobs}}<tr>
+<td>{{.RequestID}}</td><td>{{.Bucket}}</td><td>{{status .}}</td><td>{{.Progress}}%</td><td>{{.Attempts}}</td><td>{{.User}}</td>
+<td>{{ago .CreatedAt}}</td><td>{{.Error}}</td>
+<td>{{if active .}}<button onclick="act('/admin/jobs', {request_id: {{.RequestID}}, cancel: true}, 'Cancel ' + {{.RequestID}} + '?')">cancel</button>{{end}}</td>
+</tr>{{else}}<tr><td colspan="9">no job</td></tr>{{end}}
+</table>
+
+<script>
+var csrfToken = {{.CSRFToken}};
+
+function act(path, body, question) {
+	if (!confirm(question)) {
+		return;
+	}
+	fetch(path, {method: 'POST', credentials: 'same-origin', headers: {'Content-Type': 'application/json', 'X-Csrf-Token': csrfToken}, body: JSON.stringify(body)})
+		.then(function(resp) {
+			if (resp.ok) {
+				location.reload();
+				return;
+			}
+			return resp.json().then(function(e) { alert(e.message || resp.statusText); });
+		})
+		.catch(function(e) { alert(e); });
+}
+</script>
+</body>
+</html>
+`))
+
+// adminJobStatus returns the job status shown in the admin UI.
+func adminJobStatus(item queue.Item) string {
+	switch {
+	case item.Canceled:
+		return "canceled"
+	case item.Error != "":
+		return "failed"
+	case item.Progress == queue.MaxProgress:
+		return "completed"
+	case item.Progress > 0:
+		return "running"
+	}
+	return "queued"
+}
+
+// adminUIHandler renders the admin overview in HTML.
+func adminUIHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		page := struct {
+			AdminOverview
+			CSRFToken string
+		}{srv.Overview(ctx, qu), srv.csrfToken(req)}
+		var buf bytes.Buffer
+		if err := adminTemplate.Execute(&buf, page); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := buf.WriteTo(w)
+		return err
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
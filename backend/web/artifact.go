@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+)
+
+// DefaultArtifactURLTTL is the default expiration of signed artifact URLs.
+const DefaultArtifactURLTTL = 15 * time.Minute
+
+// URLSigner generates signed URLs to the artifact URIs
+// (e.g. "gs://bucket/v1/prefix/key"). 'gcp.Signer' signs Cloud Storage URIs.
+// The artifacts in the blob backend are signed by the backend (see
+// 'WithBlobBackend').
+type URLSigner interface {
+	SignedURL(uri string, ttl time.Duration) (string, error)
+}
+
+// WithArtifactSigner configures the signer of artifact URLs, which expire
+// after 'ttl'. Workers upload large outputs (e.g. generated images), and
+// record only the object URI on the item, which the frontend fetches at
+// "/cats-request/artifact?request_id=...".
+func WithArtifactSigner(s URLSigner, ttl time.Duration) ServerOpOption {
+	return func(op *ServerOp) {
+		op.artifactSigner = s
+		op.artifactURLTTL = ttl
+	}
+}
+
+// artifactHandler redirects to the signed URL of the artifact
+// recorded on the completed item.
+func artifactHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		requestID := req.URL.Query().Get("request_id")
+		if requestID == "" {
+			requestID = req.Header.Get(RequestIDHeader)
+		}
+		item, err := srv.loadItem(requestID)
+		if err != nil {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", requestID).WithRequestID(requestID))
+		}
+		if item.Progress != queue.MaxProgress || item.Error != "" || !strings.Contains(item.Value, "://") {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "no artifact for %q", requestID).WithRequestID(requestID))
+		}
+
+		u, err := srv.signArtifact(item.Value)
+		if err == errNoArtifactSigner {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err).WithRequestID(requestID))
+		}
+		if err != nil {
+			glog.Warningf("failed to sign %q (%v)", item.Value, err)
+			return writeError(w, NewError(http.StatusInternalServerError, ErrCodeInternal, "failed to sign artifact URL (%v)", err).WithRequestID(requestID))
+		}
+		http.Redirect(w, req, u, http.StatusTemporaryRedirect)
+		return nil
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
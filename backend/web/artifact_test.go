@@ -0,0 +1,49 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+type testSigner struct{}
+
+func (testSigner) SignedURL(uri string, ttl time.Duration) (string, error) {
+	return "https://storage.googleapis.com/" + uri[len("gs://"):] + "?Expires=" + ttl.String(), nil
+}
+
+func TestArtifact(t *testing.T) {
+	srv := &Server{artifactSigner: testSigner{}, artifactURLTTL: time.Minute}
+	h := with(ContextHandlerFunc(artifactHandler), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "gs://test-bucket/v1/cats-request/req-1/output.png")
+	item.RequestID = "req-1"
+	srv.requestCache.Store(item.RequestID, item)
+
+	// not completed yet
+	req := httptest.NewRequest(http.MethodGet, "/cats-request/artifact?request_id=req-1", nil)
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	item.Progress = queue.MaxProgress
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected %d, got %d", http.StatusTemporaryRedirect, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "https://storage.googleapis.com/test-bucket/v1/cats-request/req-1/output.png?Expires=1m0s" {
+		t.Fatalf("unexpected location %q", loc)
+	}
+}
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/audit"
+
+	"github.com/golang/glog"
+)
+
+// auditTimeout is the timeout to append the audit entries.
+const auditTimeout = 5 * time.Second
+
+// defaultAuditLimit is the number of the entries listed without "limit".
+const defaultAuditLimit = 100
+
+// WithAudit enables the audit log in the etcd cluster of the queue,
+// recording the logins, job submissions, cancels, and admin operations
+// (served at /admin/audit).
+func WithAudit(cfg audit.Config) ServerOpOption {
+	return func(op *ServerOp) { op.audit = &cfg }
+}
+
+// Audit appends the entry to the audit log, with "system" actor if empty
+// (e.g. config reloads). It is a no-op if the audit log is disabled.
+// Failures are logged, not returned, so that the audited actions proceed.
+func (srv *Server) Audit(e audit.Entry) {
+	if srv.audit == nil {
+		return
+	}
+	if e.Actor == "" {
+		e.Actor = "system"
+	}
+	ctx, cancel := context.WithTimeout(srv.rootCtx, auditTimeout)
+	defer cancel()
+	if _, err := srv.audit.Append(ctx, e); err != nil {
+		glog.Warningf("failed to append audit entry %+v (%v)", e, err)
+	}
+}
+
+// auditRequest records the action of the request, by the user of the
+// session ("anonymous" without login).
+func (srv *Server) auditRequest(ctx context.Context, req *http.Request, action, requestID, outcome, detail string) {
+	if srv.audit == nil {
+		return
+	}
+	actor, _ := ctx.Value(accountKey).(string)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	srv.Audit(audit.Entry{
+		Action:    action,
+		Actor:     actor,
+		IP:        clientIP(req),
+		RequestID: requestID,
+		Target:    req.Method + " " + req.URL.Path,
+		Outcome:   outcome,
+		Detail:    detail,
+	})
+}
+
+// clientIP returns the IP of the client, behind the proxies if forwarded.
+func clientIP(req *http.Request) string {
+	if ip := getRealIP(req); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// auditOutcome returns the outcome of the response status code.
+func auditOutcome(code int) string {
+	switch {
+	case code < http.StatusBadRequest:
+		return audit.OutcomeSuccess
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return audit.OutcomeDenied
+	default:
+		return audit.OutcomeFailure
+	}
+}
+
+// withAudit records the requests of the handler other than GET as the
+// action, with the outcome of the response. It must be wrapped by 'with'.
+func withAudit(h ContextHandler, action string) ContextHandler {
+	return ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		srv := ctx.Value(serverKey).(*Server)
+		if srv.audit == nil || req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+			return h.ServeHTTPContext(ctx, w, req)
+		}
+		return srv.serveAudited(ctx, h, w, req, action)
+	})
+}
+
+// withAuditMethods records the requests of the handler as the action of
+// their method (e.g. the backup downloads on GET), with the outcome of the
+// response. Other methods are not recorded. It must be wrapped by 'with'.
+func withAuditMethods(h ContextHandler, actions map[string]string) ContextHandler {
+	return ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		srv := ctx.Value(serverKey).(*Server)
+		action, ok := actions[req.Method]
+		if srv.audit == nil || !ok {
+			return h.ServeHTTPContext(ctx, w, req)
+		}
+		return srv.serveAudited(ctx, h, w, req, action)
+	})
+}
+
+// serveAudited serves the request, and records it as the action.
+func (srv *Server) serveAudited(ctx context.Context, h ContextHandler, w http.ResponseWriter, req *http.Request, action string) error {
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	err := h.ServeHTTPContext(ctx, sw, req)
+	detail := ""
+	if err != nil {
+		detail = err.Error()
+	}
+	srv.auditRequest(ctx, req, action, req.Header.Get(RequestIDHeader), auditOutcome(sw.code), detail)
+	return err
+}
+
+func auditDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "audit log is not enabled"))
+}
+
+// auditQuery parses the "since", "until" (RFC 3339), "action", "actor",
+// and "limit" queries.
+func auditQuery(req *http.Request) (audit.Query, *Error) {
+	v := req.URL.Query()
+	q := audit.Query{Action: v.Get("action"), Actor: v.Get("actor")}
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := v.Get(t.name); s != "" {
+			var err error
+			if *t.dst, err = time.Parse(time.RFC3339, s); err != nil {
+				return q, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid %q %q (expected RFC 3339)", t.name, s)
+			}
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid limit %q", s)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// auditHandler returns the most recent audit entries on GET, filtered
+// by the queries (up to 100 entries without "limit").
+func auditHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.audit == nil {
+		return auditDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+	q, aerr := auditQuery(req)
+	if aerr != nil {
+		return writeError(w, aerr)
+	}
+	if req.URL.Query().Get("limit") == "" {
+		q.Limit = defaultAuditLimit
+	}
+	es, err := srv.audit.List(ctx, q)
+	if err != nil {
+		return writeError(w, QueueError(err))
+	}
+	if es == nil {
+		es = []audit.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(es)
+}
+
+// auditExportHandler streams all audit entries matching the queries
+// as JSON lines on GET, to archive outside of the cluster.
+func auditExportHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.audit == nil {
+		return auditDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+	q, aerr := auditQuery(req)
+	if aerr != nil {
+		return writeError(w, aerr)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	if err := srv.audit.Export(ctx, w, q); err != nil {
+		glog.Warningf("failed to export audit log (%v)", err)
+		return err
+	}
+	return nil
+}
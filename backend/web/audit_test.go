@@ -0,0 +1,140 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/audit"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestAudit(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 34379, 34380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{
+		rootCtx: context.Background(),
+		qu:      qu,
+		audit:   audit.New(qu.Client(), audit.Config{}),
+	}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandler, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		w := httptest.NewRecorder()
+		if err := with(h, srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	// GET is not recorded
+	maintenance := withAudit(ContextHandlerFunc(maintenanceHandler), "admin.maintenance")
+	serve(maintenance, http.MethodGet, "/admin/maintenance", "")
+	serve(maintenance, http.MethodPost, "/admin/maintenance", `{"enabled":true,"message":"upgrade"}`)
+	serve(maintenance, http.MethodPost, "/admin/maintenance", `{`)
+	if w := serve(ContextHandlerFunc(jobsHandler), http.MethodPost, "/admin/jobs", `{"request_id":"req-1","cancel":true}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	item := queue.CreateItem("/cats-request", 100, "cat.jpg")
+	item.RequestID = "req-1"
+	srv.requestCache.Store(item.RequestID, item)
+	serve(ContextHandlerFunc(jobsHandler), http.MethodPost, "/admin/jobs", `{"request_id":"req-1","cancel":true}`)
+	srv.Audit(audit.Entry{Action: "config.reload", Outcome: audit.OutcomeSuccess})
+
+	w := serve(ContextHandlerFunc(auditHandler), http.MethodGet, "/admin/audit", "")
+	var es []audit.Entry
+	if err = json.NewDecoder(w.Body).Decode(&es); err != nil {
+		t.Fatal(err)
+	}
+	expected := []audit.Entry{
+		{Action: "admin.maintenance", Actor: "anonymous", IP: "10.0.0.1", Target: "POST /admin/maintenance", Outcome: audit.OutcomeSuccess},
+		{Action: "admin.maintenance", Actor: "anonymous", IP: "10.0.0.1", Target: "POST /admin/maintenance", Outcome: audit.OutcomeFailure},
+		{Action: "config.reload", Actor: "system", Outcome: audit.OutcomeSuccess},
+	}
+	if len(es) != 3+len(expected)-1 {
+		t.Fatalf("unexpected entries %+v", es)
+	}
+	for i, e := range []audit.Entry{es[0], es[1], es[4]} {
+		exp := expected[i]
+		if e.Action != exp.Action || e.Actor != exp.Actor || e.IP != exp.IP || e.Target != exp.Target || e.Outcome != exp.Outcome {
+			t.Fatalf("#%d: expected %+v, got %+v", i, exp, e)
+		}
+	}
+	// cancels record the request ID of the job
+	if es[2].Action != "job.cancel" || es[2].RequestID != "req-1" || es[2].Outcome != audit.OutcomeFailure {
+		t.Fatalf("unexpected cancel of unknown job %+v", es[2])
+	}
+	if es[3].Action != "job.cancel" || es[3].RequestID != "req-1" || es[3].Outcome != audit.OutcomeSuccess {
+		t.Fatalf("unexpected cancel %+v", es[3])
+	}
+
+	if w = serve(ContextHandlerFunc(auditHandler), http.MethodGet, "/admin/audit?since=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+
+	w = serve(ContextHandlerFunc(auditExportHandler), http.MethodGet, "/admin/audit/export?action=job.cancel", "")
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "audit.jsonl") {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+	sc, n := bufio.NewScanner(w.Body), 0
+	for sc.Scan() {
+		var e audit.Entry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil || e.Action != "job.cancel" {
+			t.Fatalf("unexpected export line %q (%v)", sc.Text(), err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 exported entries, got %d", n)
+	}
+
+	// backup downloads are recorded on GET, and restores on POST or PUT
+	backup := withAuditMethods(ContextHandlerFunc(backupHandler), map[string]string{
+		http.MethodGet:  "admin.backup",
+		http.MethodPost: "admin.restore",
+		http.MethodPut:  "admin.restore",
+	})
+	serve(backup, http.MethodGet, "/admin/backup", "")
+	serve(backup, http.MethodPost, "/admin/backup", `{"jobs":[]}`)
+	serve(backup, http.MethodPut, "/admin/backup", `{"jobs":[]}`)
+	serve(backup, http.MethodDelete, "/admin/backup", "")
+	for _, tt := range []struct {
+		action   string
+		outcomes []string
+	}{
+		{"admin.backup", []string{audit.OutcomeSuccess}},
+		{"admin.restore", []string{audit.OutcomeSuccess, audit.OutcomeFailure}},
+	} {
+		w = serve(ContextHandlerFunc(auditHandler), http.MethodGet, "/admin/audit?action="+tt.action, "")
+		es = nil
+		if err = json.NewDecoder(w.Body).Decode(&es); err != nil {
+			t.Fatal(err)
+		}
+		if len(es) != len(tt.outcomes) {
+			t.Fatalf("%q: unexpected entries %+v", tt.action, es)
+		}
+		for i, e := range es {
+			if !strings.HasSuffix(e.Target, " /admin/backup") || e.Outcome != tt.outcomes[i] {
+				t.Fatalf("%q #%d: unexpected entry %+v", tt.action, i, e)
+			}
+		}
+	}
+}
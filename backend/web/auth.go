@@ -0,0 +1,77 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// CSRFHeader is the field name of the CSRF token header, required on the
+// admin requests other than GET that do not send "Authorization" (e.g.
+// the admin UI with the session cookie). The token is served at
+// "/admin/csrf", and in the admin UI.
+const CSRFHeader = "X-Csrf-Token"
+
+// adminRequired returns the error unless the request is of the user
+// with the admin role (see 'WithAdmins'), or without the user accounts,
+// from the loopback and not proxied: the admin endpoints are not served
+// to the other hosts.
+func (srv *Server) adminRequired(ctx context.Context, req *http.Request) *Error {
+	if srv.users != nil {
+		name, _ := ctx.Value(accountKey).(string)
+		if name == "" {
+			return NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "login required")
+		}
+		if !srv.admins[name] {
+			return NewError(http.StatusForbidden, ErrCodeForbidden, "user %q is not an admin", name)
+		}
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil && getRealIP(req) == "" {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	return NewError(http.StatusForbidden, ErrCodeForbidden, "admin endpoints are only served to the loopback")
+}
+
+// csrfToken returns the CSRF token of the session cookie in the request,
+// or of the server without the session cookie.
+func (srv *Server) csrfToken(req *http.Request) string {
+	session := ""
+	if c, err := req.Cookie(SessionCookie); err == nil {
+		session = c.Value
+	}
+	mac := hmac.New(sha256.New, srv.csrfSecret)
+	mac.Write([]byte("csrf/" + session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// withAdmin serves the handler only to the admins (see 'adminRequired'),
+// with the CSRF token on the requests that change the state.
+func withAdmin(h ContextHandler) ContextHandler {
+	return ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		srv := ctx.Value(serverKey).(*Server)
+		if aerr := srv.adminRequired(ctx, req); aerr != nil {
+			glog.Warningf("refused %q on %q from %q (%v)", req.Method, req.URL.Path, req.RemoteAddr, aerr.Message)
+			return writeError(w, aerr)
+		}
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			// browsers attach the cookies to the cross-site requests,
+			// but never the "Authorization" header
+			token := req.Header.Get(CSRFHeader)
+			if req.Header.Get("Authorization") == "" && !hmac.Equal([]byte(token), []byte(srv.csrfToken(req))) {
+				glog.Warningf("refused %q on %q from %q (invalid CSRF token)", req.Method, req.URL.Path, req.RemoteAddr)
+				return writeError(w, NewError(http.StatusForbidden, ErrCodeForbidden, "missing or invalid CSRF token in %q", CSRFHeader))
+			}
+		}
+		return h.ServeHTTPContext(ctx, w, req)
+	})
+}
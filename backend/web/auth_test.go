@@ -0,0 +1,84 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestWithAdmin(t *testing.T) {
+	for i, tt := range []struct {
+		remoteAddr string
+		header     http.Header
+		csrf       bool
+		code       int
+	}{
+		{"127.0.0.1:1234", nil, true, http.StatusOK},
+		{"[::1]:1234", nil, true, http.StatusOK},
+		// the requests other than GET need the CSRF token
+		{"127.0.0.1:1234", nil, false, http.StatusForbidden},
+		{"127.0.0.1:1234", http.Header{CSRFHeader: {"invalid"}}, false, http.StatusForbidden},
+		{"192.0.2.1:1234", nil, true, http.StatusForbidden},
+		{"127.0.0.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}}, true, http.StatusForbidden},
+	} {
+		srv := &Server{csrfSecret: []byte("csrf")}
+		h := with(withAdmin(ContextHandlerFunc(maintenanceHandler)), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+		req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(`{"enabled": true}`))
+		req.RemoteAddr = tt.remoteAddr
+		for k, vs := range tt.header {
+			req.Header[k] = vs
+		}
+		if tt.csrf {
+			req.Header.Set(CSRFHeader, srv.csrfToken(req))
+		}
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.code {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, tt.code, w.Code, w.Body.String())
+		}
+		if enabled := srv.InMaintenance(); enabled != (tt.code == http.StatusOK) {
+			t.Fatalf("#%d: unexpected maintenance mode %v", i, enabled)
+		}
+	}
+}
+
+func TestAdminCSRF(t *testing.T) {
+	local := &Server{csrfSecret: []byte("csrf")}
+	h := with(withAdmin(ContextHandlerFunc(adminCSRFHandler)), local, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+	get := func(remoteAddr, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/csrf", nil)
+		req.RemoteAddr = remoteAddr
+		if session != "" {
+			req.Header.Set("Cookie", SessionCookie+"="+session)
+		}
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	if w := get("192.0.2.1:1234", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// the CSRF token is of the session
+	tokens := map[string]bool{}
+	for _, session := range []string{"", "a", "b"} {
+		w := get("127.0.0.1:1234", session)
+		var resp CSRFResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Token == "" || tokens[resp.Token] {
+			t.Fatalf("unexpected CSRF token %q of session %q", resp.Token, session)
+		}
+		tokens[resp.Token] = true
+	}
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/autoscale"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// WithAutoscaler configures the autoscaler, which is served at "/autoscale"
+// and fed with job claims and completions from workers.
+func WithAutoscaler(a *autoscale.Autoscaler) ServerOpOption {
+	return func(op *ServerOp) { op.autoscaler = a }
+}
+
+func (srv *Server) jobClaimed(item *queue.Item) {
+	srv.emitJobEvent(JobClaimed, item)
+	srv.claimedUsage(item)
+	if srv.autoscaler != nil {
+		srv.autoscaler.Claimed(item.RequestID)
+	}
+	if srv.canary != nil {
+		srv.canary.claimedJob(item, time.Now())
+	}
+	if srv.spec != nil {
+		// the duplicate of the completed job may be claimed later
+		if cur, err := srv.loadItem(item.RequestID); err == nil && cur.Progress != queue.MaxProgress {
+			srv.spec.claimed(item, time.Now())
+		}
+	}
+}
+
+func (srv *Server) jobCompleted(item *queue.Item) {
+	srv.metrics.jobCompleted(item, time.Now())
+	if srv.autoscaler != nil {
+		srv.autoscaler.Completed(item.RequestID)
+	}
+	if srv.canary != nil {
+		srv.canary.completedJob(item, time.Now())
+	}
+}
+
+func autoscaleHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		if srv.autoscaler == nil {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "autoscaler is not configured"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.autoscaler.Signal())
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
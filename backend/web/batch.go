@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+)
+
+// batchParams returns the query parameters of batch claims:
+// 'max_items' is the maximum number of items to claim (zero for
+// single-item claims), and 'wait' is the duration to wait for the first
+// item (e.g. "0s" to not wait, negative if not set to wait until available).
+func batchParams(req *http.Request) (int, time.Duration, *Error) {
+	q := req.URL.Query()
+	v := q.Get("max_items")
+	if v == "" {
+		return 0, -1, nil
+	}
+	max, err := strconv.Atoi(v)
+	if err != nil || max < 1 || max > queue.MaxBatchSize {
+		return 0, 0, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid max_items %q (must be 1 to %d)", v, queue.MaxBatchSize)
+	}
+	wait := time.Duration(-1)
+	if v = q.Get("wait"); v != "" {
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			return 0, 0, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid wait %q", v)
+		}
+	}
+	return max, wait, nil
+}
+
+// claimBatch claims up to 'max' items, waiting for the first item up to
+// 'wait' (forever if negative), and returns the items available without
+// waiting for the rest. Returns no item if none is available in 'wait'.
+func (srv *Server) claimBatch(ctx context.Context, qu queue.Queue, bucket string, opts []queue.OpOption, max int, wait time.Duration) ([]*queue.Item, *Error) {
+	var items []*queue.Item
+	if wait != 0 {
+		pctx := ctx
+		if wait > 0 {
+			var cancel context.CancelFunc
+			pctx, cancel = context.WithTimeout(ctx, wait)
+			defer cancel()
+		}
+		item := <-qu.Pop(pctx, bucket, opts...)
+		switch {
+		case item == nil:
+			return nil, NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "queue watch on %q closed", bucket)
+		case item.Error != "" && pctx.Err() == context.DeadlineExceeded && ctx.Err() == nil:
+			// no item in 'wait'
+			return nil, nil
+		case item.Error != "":
+			glog.Warning(item.Error)
+			return nil, QueueItemError(item.Error).WithRequestID(item.RequestID)
+		}
+		items = append(items, item)
+	}
+
+	for len(items) < max {
+		item, err := qu.TryPop(ctx, bucket, opts...)
+		if err != nil {
+			if len(items) > 0 {
+				// deliver the claimed items
+				glog.Warningf("failed to fill the batch on %q (%v)", bucket, err)
+				break
+			}
+			return nil, QueueItemError(err.Error())
+		}
+		if item == nil {
+			break
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// serveBatch writes the claimed items in JSON array, encoded
+// in the schema of the worker protocol version.
+func (srv *Server) serveBatch(ctx context.Context, w http.ResponseWriter, qu queue.Queue, bucket string, opts []queue.OpOption, version, max int, wait time.Duration) error {
+	items, aerr := srv.claimBatch(ctx, qu, bucket, opts, max, wait)
+	if aerr != nil {
+		return writeError(w, aerr)
+	}
+	resp := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		srv.jobClaimed(item)
+		resp = append(resp, item.Encode(srv.itemProtocol(version, item.RequestID)))
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
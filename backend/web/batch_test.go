@@ -0,0 +1,62 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestQueueBatch(t *testing.T) {
+	qu := &popQueue{nopQueue: nopQueue{t: t}, itemc: make(chan *queue.Item, 3)}
+	srv := &Server{qu: qu}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	for _, v := range []string{"a", "b", "c"} {
+		item := queue.CreateItem("/cats-request", 100, v)
+		item.RequestID = v
+		qu.itemc <- item
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		values []string
+	}{
+		{"max_items=2", http.StatusOK, []string{"a", "b"}},
+		{"max_items=5&wait=0s", http.StatusOK, []string{"c"}},
+		{"max_items=5&wait=0s", http.StatusOK, []string{}},
+		{"max_items=0", http.StatusBadRequest, nil},
+		{"max_items=65", http.StatusBadRequest, nil},
+		{"max_items=1&wait=soon", http.StatusBadRequest, nil},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/cats-request/queue?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.status {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, tt.status, w.Code, w.Body.String())
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var items []queue.Item
+		if err := json.NewDecoder(w.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != len(tt.values) {
+			t.Fatalf("#%d: expected %d items, got %+v", i, len(tt.values), items)
+		}
+		for j := range items {
+			if items[j].Value != tt.values[j] {
+				t.Fatalf("#%d: expected %q, got %q", i, tt.values[j], items[j].Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+
+	"github.com/golang/glog"
+)
+
+// backupKey is the key of the backup snapshot in the blob backend.
+const backupKey = "backups/jobs.json"
+
+// WithBlobBackend stores the server blobs in the backend (local file system,
+// Cloud Storage, or S3). The job artifacts in the backend are served with
+// its signed URLs at "/cats-request/artifact" (the local ones at "/blobs/"),
+// and the backup of the jobs not completed is written to "backups/jobs.json"
+// every 'backupInterval' (0 to disable).
+func WithBlobBackend(b blobstore.Backend, backupInterval time.Duration) ServerOpOption {
+	return func(op *ServerOp) {
+		op.blobBackend = b
+		op.backupInterval = backupInterval
+	}
+}
+
+// signArtifact returns the signed URL of the artifact URI, with the blob
+// backend if the URI is of the backend, or with the artifact signer.
+func (srv *Server) signArtifact(uri string) (string, error) {
+	if srv.blobBackend != nil {
+		if key, ok := blobstore.KeyOf(srv.blobBackend, uri); ok {
+			return srv.blobBackend.SignedURL(key, srv.artifactURLTTL)
+		}
+	}
+	if srv.artifactSigner != nil && strings.HasPrefix(uri, "gs://") {
+		return srv.artifactSigner.SignedURL(uri, srv.artifactURLTTL)
+	}
+	return "", errNoArtifactSigner
+}
+
+var errNoArtifactSigner = fmt.Errorf("artifact signer is not configured")
+
+// blobsHandler serves the local blobs of the signed URLs on GET.
+func blobsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return methodNotAllowed(w, req)
+	}
+	fs, ok := srv.blobBackend.(*blobstore.FS)
+	if !ok {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "blob %q not found", req.URL.Path))
+	}
+	switch err := fs.ServeBlob(w, req); err {
+	case nil:
+		return nil
+	case blobstore.ErrNotFound:
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "blob %q not found", req.URL.Path))
+	case blobstore.ErrInvalidSignature:
+		return writeError(w, NewError(http.StatusForbidden, ErrCodeForbidden, "invalid or expired signature of %q", req.URL.Path))
+	default:
+		return writeError(w, NewError(http.StatusInternalServerError, ErrCodeInternal, "failed to serve %q (%v)", req.URL.Path, err))
+	}
+}
+
+// SnapshotBackup writes the backup of the jobs not completed
+// to the blob backend, and returns its URI.
+func (srv *Server) SnapshotBackup(ctx context.Context) (string, error) {
+	if srv.blobBackend == nil {
+		return "", fmt.Errorf("blob backend is not configured")
+	}
+	b, err := json.Marshal(Backup{CreatedAt: time.Now(), Jobs: srv.Jobs("", true)})
+	if err != nil {
+		return "", err
+	}
+	return srv.blobBackend.Put(ctx, backupKey, bytes.NewReader(b), "application/json")
+}
+
+// runBackups snapshots the backup every interval, until the server stops.
+func (srv *Server) runBackups(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case <-ticker.C:
+		}
+		uri, err := srv.SnapshotBackup(srv.rootCtx)
+		if err != nil {
+			glog.Warningf("failed to snapshot backup (%v)", err)
+			continue
+		}
+		glog.Infof("snapshotted backup to %q", uri)
+	}
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestBlobBackend(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := blobstore.NewFS(dir, "http://localhost:2200/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{artifactSigner: testSigner{}, artifactURLTTL: time.Minute, blobBackend: b}
+	h := with(ContextHandlerFunc(artifactHandler), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	ctx := context.Background()
+	uri, err := b.Put(ctx, "cats-request/req-1/output.png", strings.NewReader("png"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, value := range map[string]string{
+		"req-1": uri,
+		"req-2": "gs://test-bucket/v1/cats-request/req-2/output.png",
+		"req-3": "s3://test-bucket/cats-request/req-3/output.png",
+	} {
+		item := queue.CreateItem("/cats-request", 100, value)
+		item.RequestID, item.Progress = id, queue.MaxProgress
+		srv.requestCache.Store(item.RequestID, item)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/cats-request/artifact?request_id="+id, nil)
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(ctx, w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	w := get("req-1")
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected %d, got %d", http.StatusTemporaryRedirect, w.Code)
+	}
+	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "http://localhost:2200/blobs/cats-request/req-1/output.png?") || !strings.Contains(loc, "signature=") {
+		t.Fatalf("unexpected location %q", loc)
+	}
+
+	// the local blobs are served with the JSON errors
+	blobs := with(ContextHandlerFunc(blobsHandler), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+	loc := w.Header().Get("Location")
+	for _, tt := range []struct {
+		method string
+		target string
+		code   int
+		errc   string
+	}{
+		{http.MethodGet, loc, http.StatusOK, ""},
+		{http.MethodGet, strings.Replace(loc, "output.png", "input.png", 1), http.StatusForbidden, ErrCodeForbidden},
+		{http.MethodGet, strings.Split(loc, "?")[0], http.StatusForbidden, ErrCodeForbidden},
+		{http.MethodPost, loc, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		bw := httptest.NewRecorder()
+		if err = blobs.ServeHTTPContext(ctx, bw, req); err != nil {
+			t.Fatal(err)
+		}
+		if bw.Code != tt.code {
+			t.Fatalf("%s %q: expected %d, got %d", tt.method, tt.target, tt.code, bw.Code)
+		}
+		if tt.errc == "" {
+			if bw.Body.String() != "png" {
+				t.Fatalf("unexpected blob %q", bw.Body.String())
+			}
+			continue
+		}
+		var e Error
+		if err = json.NewDecoder(bw.Body).Decode(&e); err != nil || e.Code != tt.errc || e.Status != tt.code {
+			t.Fatalf("%s %q: unexpected error %+v (%v)", tt.method, tt.target, e, err)
+		}
+	}
+
+	// the other Cloud Storage URIs are signed by the artifact signer
+	if w = get("req-2"); w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("expected %d, got %d", http.StatusTemporaryRedirect, w.Code)
+	}
+	if w = get("req-3"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if _, err = srv.SnapshotBackup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = b.Get(ctx, backupKey, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var bk Backup
+	if err = json.Unmarshal(buf.Bytes(), &bk); err != nil {
+		t.Fatal(err)
+	}
+	if bk.CreatedAt.IsZero() {
+		t.Fatalf("unexpected backup %+v", bk)
+	}
+}
@@ -0,0 +1,287 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// StableVersion is the version of the jobs not routed
+	// to the canary, in the canary metrics.
+	StableVersion = "stable"
+
+	// staleCanaryClaim is the duration after which claimed jobs
+	// are not tracked anymore (e.g. canceled by user).
+	staleCanaryClaim = time.Hour
+)
+
+// WithCanary routes the percentage (0 to 100) of new jobs to the workers
+// labeled with the version ('workerproc.VersionLabel') in the worker registry, while the
+// other workers process the rest. Jobs are routed to the canary only while
+// the canary workers are alive. The admin API at "/admin/canary" compares
+// the success rate and latency of the canary with the stable workers, and
+// updates the percentage (e.g. 100 to promote, 0 to roll back).
+func WithCanary(version string, percent int) ServerOpOption {
+	return func(op *ServerOp) { op.canaryVersion, op.canaryPercent = version, percent }
+}
+
+// VersionStats are the metrics of the jobs routed to the worker version.
+type VersionStats struct {
+	Version           string  `json:"version"`
+	Completed         int64   `json:"completed"`
+	Failed            int64   `json:"failed"`
+	SuccessRate       float64 `json:"success_rate"`
+	AvgLatencySeconds float64 `json:"avg_latency_seconds"`
+}
+
+// Canary is the canary routing status.
+type Canary struct {
+	// Version is the canary worker version, empty if disabled.
+	Version string `json:"version"`
+	// Percent is the percentage of new jobs routed to the canary.
+	Percent int `json:"percent"`
+	// Workers is the number of alive canary workers.
+	Workers int `json:"workers"`
+	// Versions are the metrics of the stable and canary versions,
+	// since the canary version was set.
+	Versions []VersionStats `json:"versions"`
+}
+
+// CanaryRequest defines requests to the admin canary endpoint.
+type CanaryRequest struct {
+	Version string `json:"version"`
+	Percent int    `json:"percent"`
+}
+
+type canaryClaim struct {
+	version string
+	start   time.Time
+}
+
+type versionStats struct {
+	completed int64
+	failed    int64
+	latency   time.Duration
+}
+
+// canary routes jobs to the canary version, and tracks the job
+// metrics of each version.
+type canary struct {
+	mu      sync.Mutex
+	version string
+	percent int
+	// routed is the number of jobs to route since the percent was set.
+	routed  uint64
+	claimed map[string]canaryClaim
+	stats   map[string]*versionStats
+}
+
+func newCanary(version string, percent int) *canary {
+	c := &canary{}
+	c.set(version, percent)
+	return c
+}
+
+// set updates the canary version and percentage. The metrics are reset
+// when the version changes.
+func (c *canary) set(version string, percent int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version || c.stats == nil {
+		c.claimed = make(map[string]canaryClaim)
+		c.stats = make(map[string]*versionStats)
+	}
+	c.version, c.percent, c.routed = version, percent, 0
+}
+
+// active returns the canary version, empty if disabled.
+func (c *canary) active() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// route returns true if the next job should be routed to the canary,
+// spreading the percentage of jobs evenly (e.g. every 10th job for 10%).
+func (c *canary) route() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == "" || c.percent <= 0 {
+		return false
+	}
+	c.routed++
+	p := uint64(c.percent)
+	return c.routed*p/100 > (c.routed-1)*p/100
+}
+
+func (c *canary) claimedJob(item *queue.Item, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == "" {
+		return
+	}
+	if _, ok := c.claimed[item.RequestID]; ok {
+		// retried or duplicated job
+		return
+	}
+	version := StableVersion
+	if item.WorkerVersion != "" {
+		version = item.WorkerVersion
+	}
+	c.claimed[item.RequestID] = canaryClaim{version: version, start: now}
+}
+
+func (c *canary) completedJob(item *queue.Item, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl, ok := c.claimed[item.RequestID]
+	if !ok {
+		return
+	}
+	delete(c.claimed, item.RequestID)
+	st, ok := c.stats[cl.version]
+	if !ok {
+		st = &versionStats{}
+		c.stats[cl.version] = st
+	}
+	st.completed++
+	if item.Error != "" {
+		st.failed++
+	}
+	st.latency += now.Sub(cl.start)
+}
+
+// status returns the canary status, with the number of alive canary workers.
+func (c *canary) status(workers int, now time.Time) Canary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cl := range c.claimed {
+		if now.Sub(cl.start) > staleCanaryClaim {
+			delete(c.claimed, id)
+		}
+	}
+	st := Canary{Version: c.version, Percent: c.percent, Workers: workers, Versions: []VersionStats{}}
+	for v, s := range c.stats {
+		vs := VersionStats{Version: v, Completed: s.completed, Failed: s.failed}
+		if s.completed > 0 {
+			vs.SuccessRate = float64(s.completed-s.failed) / float64(s.completed)
+			vs.AvgLatencySeconds = (s.latency / time.Duration(s.completed)).Seconds()
+		}
+		st.Versions = append(st.Versions, vs)
+	}
+	sort.Slice(st.Versions, func(i, j int) bool { return st.Versions[i].Version < st.Versions[j].Version })
+	return st
+}
+
+// canaryWorkers returns the number of alive canary workers of the bucket.
+func (srv *Server) canaryWorkers(version, bucket string) int {
+	if version == "" {
+		return 0
+	}
+	n := 0
+	for _, l := range srv.Workers() {
+		if l.Labels[workerproc.VersionLabel] != version || !l.Alive || l.Draining {
+			continue
+		}
+		if bucket != "" && len(l.Buckets) > 0 && !hasBucket(l.Buckets, bucket) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func hasBucket(buckets []string, bucket string) bool {
+	for _, b := range buckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// routeCanary routes the new item to the canary version,
+// if the canary workers of the bucket are alive.
+func (srv *Server) routeCanary(item *queue.Item) {
+	version := srv.canary.active()
+	if version == "" || srv.canaryWorkers(version, item.Bucket) == 0 {
+		return
+	}
+	if srv.canary.route() {
+		item.WorkerVersion = version
+	}
+}
+
+// workerVersion returns the version to pop the jobs for the worker:
+// the canary version for canary workers, or empty for the other workers.
+func (srv *Server) workerVersion(workerID string) string {
+	version := srv.canary.active()
+	if version == "" || workerID == "" {
+		return ""
+	}
+	vi, ok := srv.workers.Load(workerID)
+	if !ok {
+		return ""
+	}
+	if l := vi.(workerproc.Liveness); l.Labels[workerproc.VersionLabel] == version {
+		return version
+	}
+	return ""
+}
+
+// CanaryStatus returns the canary routing status.
+func (srv *Server) CanaryStatus() Canary {
+	version := srv.canary.active()
+	return srv.canary.status(srv.canaryWorkers(version, ""), time.Now())
+}
+
+// SetCanary updates the canary version and the percentage of new jobs
+// routed to it. Empty version disables the canary routing.
+func (srv *Server) SetCanary(version string, percent int) {
+	srv.canary.set(version, percent)
+	glog.Infof("routing %d%% of jobs to canary version %q", percent, version)
+}
+
+func canaryHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.CanaryStatus())
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var creq CanaryRequest
+		if err = json.Unmarshal(rb, &creq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		srv.SetCanary(creq.Version, creq.Percent)
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.CanaryStatus())
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
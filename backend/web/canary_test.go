@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestCanary(t *testing.T) {
+	srv := &Server{canary: newCanary("v2", 50)}
+
+	// no canary worker to route to
+	item := queue.CreateItem("/cats-request", 100, "cat")
+	srv.routeCanary(item)
+	if item.WorkerVersion != "" {
+		t.Fatalf("expected no routing without canary workers, got %q", item.WorkerVersion)
+	}
+
+	srv.workers.Store("w1", workerproc.Liveness{ID: "w1", Alive: true, Buckets: []string{"/cats-request"}, UpdatedAt: time.Now()})
+	srv.workers.Store("w2", workerproc.Liveness{ID: "w2", Alive: true, Labels: map[string]string{workerproc.VersionLabel: "v2"}, Buckets: []string{"/cats-request"}, UpdatedAt: time.Now()})
+	if v := srv.workerVersion("w1"); v != "" {
+		t.Fatalf("expected stable worker, got %q", v)
+	}
+	if v := srv.workerVersion("w2"); v != "v2" {
+		t.Fatalf("expected canary worker, got %q", v)
+	}
+
+	var versions []string
+	for i, v := range []string{"a", "b", "c", "d"} {
+		item := queue.CreateItem("/cats-request", 100, v)
+		item.RequestID = v
+		srv.routeCanary(item)
+		versions = append(versions, item.WorkerVersion)
+
+		srv.jobClaimed(item)
+		if i == 3 {
+			item.Error = "failed"
+		}
+		srv.jobCompleted(item)
+	}
+	if strings.Join(versions, ",") != ",v2,,v2" {
+		t.Fatalf("expected every other job routed to canary, got %q", versions)
+	}
+
+	h := with(withValidation(ContextHandlerFunc(canaryHandler), canarySchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+	tests := []struct {
+		method   string
+		body     string
+		status   int
+		version  string
+		workers  int
+		versions []VersionStats
+	}{
+		{http.MethodGet, "", http.StatusOK, "v2", 1, []VersionStats{
+			{Version: StableVersion, Completed: 2, SuccessRate: 1},
+			{Version: "v2", Completed: 2, Failed: 1, SuccessRate: 0.5},
+		}},
+		{http.MethodPost, `{"version": "v3", "percent": 101}`, http.StatusBadRequest, "", 0, nil},
+		// metrics are reset for the new version
+		{http.MethodPost, `{"version": "v3", "percent": 10}`, http.StatusOK, "v3", 0, []VersionStats{}},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/admin/canary", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.status {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, tt.status, w.Code, w.Body.String())
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var st Canary
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Version != tt.version || st.Workers != tt.workers || len(st.Versions) != len(tt.versions) {
+			t.Fatalf("#%d: unexpected status %+v", i, st)
+		}
+		for j, vs := range st.Versions {
+			vs.AvgLatencySeconds = 0
+			if vs != tt.versions[j] {
+				t.Fatalf("#%d: expected %+v, got %+v", i, tt.versions[j], vs)
+			}
+		}
+	}
+}
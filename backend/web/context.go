@@ -4,6 +4,9 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/gyuho/dplearn/pkg/tracing"
 )
 
 // ContextHandler handles ServeHTTP with context.
@@ -23,10 +26,40 @@ func (f ContextHandlerFunc) ServeHTTPContext(ctx context.Context, w http.Respons
 type ContextAdapter struct {
 	ctx     context.Context
 	handler ContextHandler
+
+	// route is the pattern the handler is registered with, to name
+	// spans and label metrics without the unbounded request paths.
+	route string
 }
 
 func (ca *ContextAdapter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if err := ca.handler.ServeHTTPContext(ca.ctx, w, req); err != nil {
+	ctx, span := tracing.StartServerSpan(ca.ctx, req, ca.route)
+	defer span.End()
+
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	if err := ca.handler.ServeHTTPContext(ctx, sw, req); err != nil {
+		span.SetError(err)
 		log.Printf("ServeHTTP (%v) [method: %q | path: %q]", err, req.Method, req.URL.Path)
 	}
+	span.SetAttribute("http.status_code", sw.code)
+	tracing.GetCounter("http.server.requests", "Number of HTTP requests served.", "{request}").
+		Add(1, "http.route", ca.route, "http.method", req.Method, "http.status_code", strconv.Itoa(sw.code))
+}
+
+// statusWriter records the status code written by handlers.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush implements http.Flusher, for streaming responses.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
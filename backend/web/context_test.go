@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/tracing"
+)
+
+func TestContextAdapterRoute(t *testing.T) {
+	var mu sync.Mutex
+	var metrics []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if req.URL.Path == "/v1/metrics" {
+			mu.Lock()
+			metrics = append(metrics, string(rb))
+			mu.Unlock()
+		}
+	}))
+	defer collector.Close()
+
+	p, err := tracing.NewProvider(tracing.Config{Endpoint: collector.URL, SampleRatio: 1, ExportInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracing.SetProvider(p)
+	defer tracing.SetProvider(nil)
+
+	const route = "/items/"
+	mux := http.NewServeMux()
+	mux.Handle(route, &ContextAdapter{
+		ctx:   context.Background(),
+		route: route,
+		handler: ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}),
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		resp, err := http.Get(ts.URL + route + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// shutdown flushes the metrics
+	if err = p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	body := strings.Join(metrics, "\n")
+	mu.Unlock()
+	if !strings.Contains(body, `"stringValue":"`+route+`"`) {
+		t.Fatalf("expected route %q in metrics, got %s", route, body)
+	}
+	if strings.Contains(body, "a.jpg") || strings.Contains(body, "b.jpg") {
+		t.Fatalf("expected no request paths in metrics, got %s", body)
+	}
+}
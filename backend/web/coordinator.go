@@ -0,0 +1,102 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gyuho/dplearn/pkg/coordinator"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+// WithCoordinator campaigns for the fleet coordinator leadership among
+// the servers sharing the etcd cluster. The leader rebalances the workers
+// of more than one bucket, drains workers, and pauses dispatch, while every
+// server enforces the decisions on worker requests. The admin API at
+// "/admin/coordinator" returns the decisions, and updates the intents
+// (e.g. to drain a worker before host maintenance).
+func WithCoordinator(cfg coordinator.Config) ServerOpOption {
+	return func(op *ServerOp) { op.coordinator = &cfg }
+}
+
+// CoordinatorStatus defines the response of the admin coordinator endpoint.
+type CoordinatorStatus struct {
+	Leading   bool                  `json:"leading"`
+	Decisions coordinator.Decisions `json:"decisions"`
+	Intents   coordinator.Intents   `json:"intents"`
+}
+
+// coordinatorSource provides the fleet state of the server to the coordinator.
+type coordinatorSource struct{ srv *Server }
+
+func (s coordinatorSource) Workers() []workerproc.Liveness { return s.srv.Workers() }
+func (s coordinatorSource) Depth(ctx context.Context, bucket string) (int64, error) {
+	return s.srv.qu.Depth(ctx, bucket)
+}
+func (s coordinatorSource) InMaintenance() bool { return s.srv.InMaintenance() }
+
+// dispatchError returns 503 error if the coordinator paused dispatch,
+// or did not assign the bucket to the worker. Returns nil otherwise.
+func (srv *Server) dispatchError(workerID, bucket string) *Error {
+	if srv.coord == nil {
+		return nil
+	}
+	d := srv.coord.Decisions()
+	if d.Paused {
+		return NewError(http.StatusServiceUnavailable, ErrCodeDispatchPaused, "dispatch is paused by coordinator %q", d.Leader)
+	}
+	if workerID != "" && !d.Assigned(workerID, bucket) {
+		return NewError(http.StatusServiceUnavailable, ErrCodeNotAssigned, "worker %q is assigned to %q by coordinator %q", workerID, d.Assignments[workerID], d.Leader)
+	}
+	return nil
+}
+
+// drainRequested returns true if the coordinator decided to drain the worker.
+func (srv *Server) drainRequested(workerID string) bool {
+	return srv.coord != nil && srv.coord.Decisions().Draining(workerID)
+}
+
+func coordinatorHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.coord == nil {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "coordinator is not enabled"))
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.coordinatorStatus())
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var in coordinator.Intents
+		if err = json.Unmarshal(rb, &in); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if err = srv.coord.SetIntents(ctx, in); err != nil {
+			return writeError(w, NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "failed to store intents (%v)", err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.coordinatorStatus())
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+func (srv *Server) coordinatorStatus() CoordinatorStatus {
+	return CoordinatorStatus{
+		Leading:   srv.coord.Leading(),
+		Decisions: srv.coord.Decisions(),
+		Intents:   srv.coord.Intents(),
+	}
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/coordinator"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestCoordinator(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "coordinator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 24379, 24380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{qu: qu, workerToken: "secret"}
+	srv.coord = coordinator.New(qu.Client(), coordinator.Config{Name: "s1", Interval: 50 * time.Millisecond, TTL: 5 * time.Second, Source: coordinatorSource{srv}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.coord.Run(ctx)
+
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandler, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(queue.ProtocolHeader, "1")
+		req.Header.Set(workerproc.TokenHeader, "secret")
+		w := httptest.NewRecorder()
+		if err := with(h, srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	workers := withValidation(ContextHandlerFunc(workersHandler), workersSchemas)
+	admin := withValidation(ContextHandlerFunc(coordinatorHandler), coordinatorSchemas)
+	queueGet := withValidation(ContextHandlerFunc(queueHandler), queueSchemas)
+
+	if w := serve(workers, http.MethodPost, "/workers", `{"id": "w1", "name": "cats", "alive": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := serve(admin, http.MethodPost, "/admin/coordinator", `{"paused": "yes"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve(admin, http.MethodPost, "/admin/coordinator", `{"paused": true, "drains": ["w1"]}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var st CoordinatorStatus
+		if err = json.NewDecoder(serve(admin, http.MethodGet, "/admin/coordinator", "").Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Leading && st.Decisions.Paused && st.Decisions.Draining("w1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("took too long to decide on intents (%+v)", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the registry tells the worker to drain
+	var l workerproc.Liveness
+	if err = json.NewDecoder(serve(workers, http.MethodPost, "/workers", `{"id": "w1", "name": "cats", "alive": true}`).Body).Decode(&l); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Drain {
+		t.Fatal("expected drain")
+	}
+
+	// workers do not claim jobs while paused
+	w := serve(queueGet, http.MethodGet, "/cats-request/queue?worker_id=w2", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var aerr Error
+	if err = json.NewDecoder(w.Body).Decode(&aerr); err != nil {
+		t.Fatal(err)
+	}
+	if aerr.Code != ErrCodeDispatchPaused {
+		t.Fatalf("expected %q, got %q", ErrCodeDispatchPaused, aerr.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+// WithMinDiskSpace refuses new uploads with 507 (Insufficient Storage)
+// if the partition of the directory (e.g. of the local blob store) would
+// have less than 'min' bytes available after the upload. Uploads larger
+// than the available space are refused even with zero 'min'.
+func WithMinDiskSpace(dir string, min uint64) ServerOpOption {
+	return func(op *ServerOp) {
+		op.diskDir = dir
+		op.minDiskSpace = min
+	}
+}
+
+// diskSpaceError returns the error if writing 'size' bytes would drop the
+// disk space below the minimum, or nil if the space is available, the
+// check is disabled, or the disk usage is unknown.
+func (srv *Server) diskSpaceError(size uint64) *Error {
+	if srv.diskDir == "" {
+		return nil
+	}
+	need := srv.minDiskSpace + size
+	if need < size {
+		need = math.MaxUint64
+	}
+	switch err := fileutil.EnsureSpace(srv.diskDir, need).(type) {
+	case nil:
+		return nil
+	case *fileutil.NoSpaceError:
+		return NewError(http.StatusInsufficientStorage, ErrCodeNoSpace, "%s available on disk (need %s, keeping %s free)", humanize.Bytes(err.Available), humanize.Bytes(size), humanize.Bytes(srv.minDiskSpace))
+	default:
+		glog.Warningf("failed to get disk usage of %q (%v)", srv.diskDir, err)
+		return nil
+	}
+}
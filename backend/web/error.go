@@ -0,0 +1,155 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes returned in 'Error.Code'.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeUnsupported        = "unsupported"
+	ErrCodeTooLarge           = "too_large"
+	ErrCodeNoSpace            = "no_space"
+	ErrCodeUpstream           = "upstream_error"
+	ErrCodeMaintenance        = "maintenance"
+	ErrCodeOverloaded         = "overloaded"
+	ErrCodeQuotaExceeded      = "quota_exceeded"
+	ErrCodeQueueUnavailable   = "queue_unavailable"
+	ErrCodeQueueTimeout       = "queue_timeout"
+	ErrCodeQueueExhausted     = "queue_exhausted"
+	ErrCodeWorkerUnhealthy    = "worker_unhealthy"
+	ErrCodeIncompatibleWorker = "incompatible_worker"
+	ErrCodeDispatchPaused     = "dispatch_paused"
+	ErrCodeNotAssigned        = "not_assigned"
+	ErrCodeConflict           = "conflict"
+	ErrCodeInternal           = "internal"
+)
+
+// Error is the structured error response returned by all handlers.
+type Error struct {
+	// Code is the machine-readable error code (e.g. "bad_request").
+	Code string `json:"code"`
+
+	// Message is the human-readable error message.
+	Message string `json:"message"`
+
+	// RequestID is the request ID that the error is associated with, if any.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Retryable is true if the client may retry the same request later.
+	Retryable bool `json:"retryable"`
+
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+
+	// Fields lists field-level validation errors, if any.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d %s): %s", e.Code, e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// NewError creates a new error with the HTTP status code.
+// Errors with 429, 502, 503, 504, and 507 are retryable.
+func NewError(status int, code, format string, args ...interface{}) *Error {
+	retryable := false
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		http.StatusInsufficientStorage:
+		retryable = true
+	}
+	return &Error{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		Retryable: retryable,
+		Status:    status,
+	}
+}
+
+// WithRequestID returns a copy of the error with the request ID.
+func (e *Error) WithRequestID(id string) *Error {
+	copied := *e
+	copied.RequestID = id
+	return &copied
+}
+
+// QueueError maps errors from the queue service to the API error.
+func QueueError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	switch err {
+	case context.Canceled:
+		return NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "queue request canceled (%v)", err)
+	case context.DeadlineExceeded:
+		return NewError(http.StatusGatewayTimeout, ErrCodeQueueTimeout, "queue request timed out (%v)", err)
+	}
+
+	code := codes.Unknown
+	if ev, ok := rpctypes.Error(err).(rpctypes.EtcdError); ok {
+		code = ev.Code()
+	} else if st, ok := status.FromError(err); ok {
+		code = st.Code()
+	}
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	case codes.NotFound:
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	case codes.ResourceExhausted:
+		return NewError(http.StatusTooManyRequests, ErrCodeQueueExhausted, "%v", err)
+	case codes.DeadlineExceeded:
+		return NewError(http.StatusGatewayTimeout, ErrCodeQueueTimeout, "%v", err)
+	case codes.Unavailable, codes.Canceled, codes.Aborted:
+		return NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "%v", err)
+	}
+	return NewError(http.StatusInternalServerError, ErrCodeInternal, "%v", err)
+}
+
+// QueueItemError maps the error message in the queue item to the API error.
+// Queue items carry errors as strings, so it matches well-known messages.
+func QueueItemError(msg string) *Error {
+	switch {
+	case msg == context.Canceled.Error():
+		return NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "%s", msg)
+	case msg == context.DeadlineExceeded.Error():
+		return NewError(http.StatusGatewayTimeout, ErrCodeQueueTimeout, "%s", msg)
+	case strings.Contains(msg, "wrong JSON"):
+		return NewError(http.StatusInternalServerError, ErrCodeInternal, "%s", msg)
+	}
+	return NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "%s", msg)
+}
+
+// writeError writes the error in JSON with its HTTP status code.
+func writeError(w http.ResponseWriter, err *Error) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err.Retryable {
+		w.Header().Set("Retry-After", "5")
+	}
+	w.WriteHeader(err.Status)
+	return json.NewEncoder(w).Encode(err)
+}
+
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) error {
+	return writeError(w, NewError(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "method %q is not allowed on %q", req.Method, req.URL.Path))
+}
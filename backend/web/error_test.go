@@ -0,0 +1,36 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+func TestQueueError(t *testing.T) {
+	tests := []struct {
+		err       error
+		status    int
+		code      string
+		retryable bool
+	}{
+		{context.Canceled, http.StatusServiceUnavailable, ErrCodeQueueUnavailable, true},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, ErrCodeQueueTimeout, true},
+		{rpctypes.ErrGRPCNoLeader, http.StatusServiceUnavailable, ErrCodeQueueUnavailable, true},
+		{rpctypes.ErrGRPCNoSpace, http.StatusTooManyRequests, ErrCodeQueueExhausted, true},
+		{rpctypes.ErrGRPCRequestTooLarge, http.StatusBadRequest, ErrCodeBadRequest, false},
+		{rpctypes.ErrGRPCLeaseNotFound, http.StatusNotFound, ErrCodeNotFound, false},
+		{fmt.Errorf("unknown"), http.StatusInternalServerError, ErrCodeInternal, false},
+	}
+	for i, tt := range tests {
+		aerr := QueueError(tt.err)
+		if aerr.Status != tt.status || aerr.Code != tt.code || aerr.Retryable != tt.retryable {
+			t.Fatalf("#%d: expected %d/%q/%v, got %+v", i, tt.status, tt.code, tt.retryable, aerr)
+		}
+	}
+	if QueueError(nil) != nil {
+		t.Fatal("expected nil error")
+	}
+}
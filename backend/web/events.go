@@ -0,0 +1,154 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/notify"
+
+	"github.com/golang/glog"
+)
+
+// Job event types, in the order of the job lifecycle.
+const (
+	JobEnqueued  = "job_enqueued"
+	JobClaimed   = "job_claimed"
+	JobProgress  = "job_progress"
+	JobCompleted = "job_completed"
+)
+
+const (
+	// jobEventBuffer is the number of job events buffered for the sink;
+	// events are dropped when the sink falls behind.
+	jobEventBuffer = 1024
+	// jobEventBatch is the maximum number of job events per publish.
+	jobEventBatch = 100
+	// jobEventFlushInterval is the interval to publish buffered job events.
+	jobEventFlushInterval = time.Second
+)
+
+// JobEvent is the lifecycle event of the job, mirrored to the event sink
+// so that downstream services consume job events without etcd access.
+type JobEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id"`
+	Bucket    string `json:"bucket"`
+	JobType   string `json:"job_type,omitempty"`
+	Progress  int    `json:"progress"`
+	Attempts  int    `json:"attempts,omitempty"`
+	// Value is the job result, only set on completion.
+	Value    string    `json:"value,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Canceled bool      `json:"canceled,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// JobEventSink publishes the job events (e.g. to a Pub/Sub topic).
+type JobEventSink interface {
+	PublishJobEvents(ctx context.Context, evs []JobEvent) error
+}
+
+// JobEventSinkFunc adapts a function to JobEventSink.
+type JobEventSinkFunc func(ctx context.Context, evs []JobEvent) error
+
+// PublishJobEvents calls f(ctx, evs).
+func (f JobEventSinkFunc) PublishJobEvents(ctx context.Context, evs []JobEvent) error {
+	return f(ctx, evs)
+}
+
+// WithJobEvents configures the sink to mirror job events to.
+// Events are published in batches in the background, so that
+// a slow sink never blocks job submissions or worker updates.
+func WithJobEvents(sink JobEventSink) ServerOpOption {
+	return func(op *ServerOp) { op.jobEvents = sink }
+}
+
+func newJobEvent(typ string, item *queue.Item) JobEvent {
+	ev := JobEvent{
+		Type:      typ,
+		RequestID: item.RequestID,
+		Bucket:    item.Bucket,
+		JobType:   item.JobType,
+		Progress:  item.Progress,
+		Attempts:  item.Attempts,
+		Error:     item.Error,
+		Canceled:  item.Canceled,
+		Time:      time.Now(),
+	}
+	if typ == JobCompleted {
+		ev.Value = item.Value
+	}
+	return ev
+}
+
+// emitJobEvent buffers the job event for the sink, if configured.
+func (srv *Server) emitJobEvent(typ string, item *queue.Item) {
+	if srv.jobEvents == nil {
+		return
+	}
+	select {
+	case srv.jobEventc <- newJobEvent(typ, item):
+	default:
+		glog.Warningf("dropped %q event of %q (event sink is behind)", typ, item.RequestID)
+	}
+}
+
+// itemUpdated emits the progress event of the job update from workers,
+// or the completion event. 'prev' is the progress before the update,
+// so that heartbeats without progress are not mirrored (retried jobs
+// restart from zero, and are mirrored as enqueued instead). Completed
+// or canceled jobs are recorded to the usage of the user, and advance
+// the pipeline runs of the pipeline steps. Failed jobs are notified.
+func (srv *Server) itemUpdated(item *queue.Item, prev int) {
+	if item.Progress == queue.MaxProgress || item.Canceled {
+		srv.finishedUsage(item)
+		if srv.pipelines != nil {
+			srv.pipelineJobDone(item)
+		}
+	}
+	if item.Progress == queue.MaxProgress && item.Error != "" && prev != queue.MaxProgress {
+		srv.notify(notify.Event{
+			Type:      notify.EventJobFailed,
+			Bucket:    item.Bucket,
+			RequestID: item.RequestID,
+			Message:   fmt.Sprintf("job %q failed (%s)", item.RequestID, item.Error),
+		})
+	}
+	switch {
+	case item.Progress == queue.MaxProgress:
+		srv.emitJobEvent(JobCompleted, item)
+	case item.Progress > prev:
+		srv.emitJobEvent(JobProgress, item)
+	}
+}
+
+// runJobEvents publishes the buffered job events every interval,
+// or as soon as a batch fills, until the server stops.
+func (srv *Server) runJobEvents(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var evs []JobEvent
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case ev := <-srv.jobEventc:
+			if evs = append(evs, ev); len(evs) < jobEventBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(evs) == 0 {
+				continue
+			}
+		}
+		if err := srv.jobEvents.PublishJobEvents(srv.rootCtx, evs); err != nil {
+			glog.Warningf("failed to publish %d job event(s) (%v)", len(evs), err)
+		}
+		evs = nil
+	}
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestJobEvents(t *testing.T) {
+	published := make(chan []JobEvent, 10)
+	rootCtx, rootCancel := context.WithCancel(context.Background())
+	defer rootCancel()
+	srv := &Server{
+		rootCtx:    rootCtx,
+		rootCancel: rootCancel,
+		donec:      make(chan struct{}),
+		jobEvents: JobEventSinkFunc(func(ctx context.Context, evs []JobEvent) error {
+			published <- evs
+			return nil
+		}),
+		jobEventc: make(chan JobEvent, jobEventBuffer),
+	}
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "req-1"
+	srv.requestCache.Store(item.RequestID, item)
+	srv.emitJobEvent(JobEnqueued, item)
+	srv.jobClaimed(item)
+
+	for _, progress := range []int{50, 50, queue.MaxProgress} {
+		update := *item
+		update.Progress = progress
+		if progress == queue.MaxProgress {
+			update.Value = "cat"
+		}
+		if _, ok := srv.storeItem(update); !ok {
+			t.Fatalf("update with progress %d discarded", progress)
+		}
+	}
+
+	go srv.runJobEvents(10 * time.Millisecond)
+	var evs []JobEvent
+	select {
+	case evs = <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to publish job events")
+	}
+
+	// heartbeat without progress is not mirrored
+	var types []string
+	for _, ev := range evs {
+		types = append(types, ev.Type)
+		if ev.RequestID != "req-1" || ev.Bucket != "/cats-request" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	}
+	if exp := []string{JobEnqueued, JobClaimed, JobProgress, JobCompleted}; !reflect.DeepEqual(types, exp) {
+		t.Fatalf("expected events %q, got %q", exp, types)
+	}
+	if evs[2].Progress != 50 || evs[2].Value != "" {
+		t.Fatalf("unexpected progress event %+v", evs[2])
+	}
+	if evs[3].Value != "cat" {
+		t.Fatalf("expected result in completion event, got %+v", evs[3])
+	}
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gyuho/dplearn/pkg/experiment"
+)
+
+// WithExperiments enables the experiment tracking in the etcd cluster of
+// the queue. Training jobs start the runs at "/experiments", and record
+// the per-epoch metrics and final scores at "/experiments/run", which are
+// compared at "/experiments/compare".
+func WithExperiments(cfg experiment.Config) ServerOpOption {
+	return func(op *ServerOp) { op.experiments = &cfg }
+}
+
+// RunUpdate defines requests to record the epoch metrics of the run,
+// and to finish the run with the final scores (or the error).
+type RunUpdate struct {
+	RunID    string             `json:"run_id"`
+	Epoch    *experiment.Epoch  `json:"epoch,omitempty"`
+	Finished bool               `json:"finished"`
+	Scores   map[string]float64 `json:"scores,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// ExperimentError converts the experiment tracker errors to *Error.
+func ExperimentError(err error) *Error {
+	switch err {
+	case experiment.ErrNotFound:
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	case experiment.ErrExists, experiment.ErrFinished:
+		return NewError(http.StatusConflict, ErrCodeConflict, "%v", err)
+	case experiment.ErrInvalidRun:
+		return NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	return QueueError(err)
+}
+
+func experimentsDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "experiment tracking is not enabled"))
+}
+
+// experimentsHandler lists the runs on GET (with "experiment" query),
+// and starts the run on POST.
+func experimentsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.experiments == nil {
+		return experimentsDisabled(w)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		rs, err := srv.experiments.List(ctx, req.URL.Query().Get("experiment"))
+		if err != nil {
+			return writeError(w, ExperimentError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(rs)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var r experiment.Run
+		if err = json.Unmarshal(rb, &r); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if r, err = srv.experiments.Start(ctx, r); err != nil {
+			return writeError(w, ExperimentError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&r)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// experimentRunHandler returns the run with the epochs on GET (with "id"
+// query), and records the epoch metrics, or finishes the run on POST.
+func experimentRunHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.experiments == nil {
+		return experimentsDisabled(w)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r, err := srv.experiments.Get(ctx, req.URL.Query().Get("id"))
+		if err != nil {
+			return writeError(w, ExperimentError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&r)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var u RunUpdate
+		if err = json.Unmarshal(rb, &u); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if u.Epoch == nil && !u.Finished {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "run update requires epoch or finished"))
+		}
+		if u.Epoch != nil {
+			if err = srv.experiments.LogEpoch(ctx, u.RunID, *u.Epoch); err != nil {
+				return writeError(w, ExperimentError(err))
+			}
+		}
+		if u.Finished {
+			if _, err = srv.experiments.Finish(ctx, u.RunID, u.Scores, u.Error); err != nil {
+				return writeError(w, ExperimentError(err))
+			}
+		}
+		r, err := srv.experiments.Get(ctx, u.RunID)
+		if err != nil {
+			return writeError(w, ExperimentError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&r)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// experimentCompareHandler returns the comparison of the runs
+// (with comma-separated "ids" query).
+func experimentCompareHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.experiments == nil {
+		return experimentsDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+
+	var ids []string
+	for _, id := range strings.Split(req.URL.Query().Get("ids"), ",") {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "missing ids"))
+	}
+	c, err := srv.experiments.Compare(ctx, ids)
+	if err != nil {
+		return writeError(w, ExperimentError(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&c)
+}
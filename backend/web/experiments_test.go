@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/experiment"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestExperiments(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "experiments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 28379, 28380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{qu: qu, experiments: experiment.New(qu.Client(), experiment.Config{})}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandlerFunc, schemas Schemas, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := with(withValidation(h, schemas), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if w := serve(experimentsHandler, experimentsSchemas, http.MethodPost, "/experiments", `{"id": "run-1", "params": {"learning_rate": 0.01}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	for _, body := range []string{
+		`{"id": "run-1", "experiment": "cats", "params": {"learning_rate": "0.0075", "num_iterations": "2500"}}`,
+		`{"id": "run-2", "experiment": "cats", "params": {"learning_rate": "0.01", "num_iterations": "2500"}}`,
+	} {
+		if w := serve(experimentsHandler, experimentsSchemas, http.MethodPost, "/experiments", body); w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+		}
+	}
+	if w := serve(experimentsHandler, experimentsSchemas, http.MethodPost, "/experiments", `{"id": "run-1", "experiment": "cats"}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	for _, body := range []string{
+		`{"run_id": "run-1", "epoch": {"epoch": 0, "metrics": {"cost": 0.69}}}`,
+		`{"run_id": "run-1", "epoch": {"epoch": 100, "metrics": {"cost": 0.52}}}`,
+		`{"run_id": "run-1", "finished": true, "scores": {"test_accuracy": 0.8}}`,
+		`{"run_id": "run-2", "finished": true, "error": "diverged"}`,
+	} {
+		if w := serve(experimentRunHandler, experimentRunSchemas, http.MethodPost, "/experiments/run", body); w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+		}
+	}
+	if w := serve(experimentRunHandler, experimentRunSchemas, http.MethodPost, "/experiments/run", `{"run_id": "run-1"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := serve(experimentRunHandler, experimentRunSchemas, http.MethodPost, "/experiments/run", `{"run_id": "run-1", "finished": true}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	var r experiment.Run
+	if err = json.NewDecoder(serve(experimentRunHandler, experimentRunSchemas, http.MethodGet, "/experiments/run?id=run-1", "").Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != experiment.StatusCompleted || len(r.Epochs) != 2 || r.Scores["test_accuracy"] != 0.8 {
+		t.Fatalf("unexpected run %+v", r)
+	}
+
+	var rs []experiment.Run
+	if err = json.NewDecoder(serve(experimentsHandler, experimentsSchemas, http.MethodGet, "/experiments?experiment=cats", "").Body).Decode(&rs); err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[1].Status != experiment.StatusFailed {
+		t.Fatalf("unexpected runs %+v", rs)
+	}
+
+	var c experiment.Comparison
+	if err = json.NewDecoder(serve(experimentCompareHandler, nil, http.MethodGet, "/experiments/compare?ids=run-1,run-2", "").Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Runs) != 2 || len(c.Differs) != 1 || c.Differs[0] != "learning_rate" {
+		t.Fatalf("unexpected comparison %+v", c)
+	}
+	if w := serve(experimentCompareHandler, nil, http.MethodGet, "/experiments/compare?ids=run-1,run-3", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
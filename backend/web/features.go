@@ -0,0 +1,160 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/feature"
+
+	"github.com/golang/glog"
+)
+
+// Features gated by the feature flags. Each stays as configured by the
+// server options (e.g. 'WithSpeculation') until the flag of the name is
+// defined, and is then on only for the jobs in the rollout.
+const (
+	// FeatureWorkerProtocolV2 serves the jobs in the worker protocol
+	// 'etcdqueue.ProtocolV2' to the workers that support it. Jobs out of
+	// the rollout are served in 'etcdqueue.ProtocolV1'.
+	FeatureWorkerProtocolV2 = "worker-protocol-v2"
+	// FeatureSpeculation duplicates the straggler jobs (see 'WithSpeculation').
+	FeatureSpeculation = "speculative-execution"
+)
+
+// WithFeatures enables the feature flags stored in the etcd cluster of the
+// queue, evaluated with the per-deployment percentages of the deployment in
+// the config. "/admin/features" manages the flags, and "/features" returns
+// the flags evaluated for the "key" query (e.g. the user), for the frontend
+// to switch API versions.
+func WithFeatures(cfg feature.Config) ServerOpOption {
+	return func(op *ServerOp) { op.features = &cfg }
+}
+
+// FeatureRequest defines requests to the admin features endpoint.
+type FeatureRequest struct {
+	// Flag creates or replaces the flag.
+	Flag *feature.Flag `json:"flag,omitempty"`
+	// Name is the flag to delete (with Delete).
+	Name   string `json:"name,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// FeaturesStatus defines the response of the admin features endpoint.
+type FeaturesStatus struct {
+	// Deployment is the deployment name of the server.
+	Deployment string         `json:"deployment"`
+	Flags      []feature.Flag `json:"flags"`
+}
+
+// featureEnabled returns true if the gated feature is on for the key,
+// or if the feature flag is not defined.
+func (srv *Server) featureEnabled(name, key string) bool {
+	if srv.features == nil {
+		return true
+	}
+	f, ok := srv.features.Lookup(name)
+	return !ok || f.On(srv.features.Deployment(), key)
+}
+
+// itemProtocol returns the protocol version to encode the job in,
+// for the worker of the protocol version.
+func (srv *Server) itemProtocol(version int, requestID string) int {
+	if version >= queue.ProtocolV2 && !srv.featureEnabled(FeatureWorkerProtocolV2, requestID) {
+		return queue.ProtocolV1
+	}
+	return version
+}
+
+// FeatureError converts the feature flag errors to *Error.
+func FeatureError(err error) *Error {
+	if err == feature.ErrNotFound {
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	}
+	return QueueError(err)
+}
+
+// adminFeaturesHandler returns the flags on GET (or the flag with the
+// "name" query), and creates, replaces, or deletes the flag on POST.
+func adminFeaturesHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.features == nil {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "feature flags are not enabled"))
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if name := req.URL.Query().Get("name"); name != "" {
+			f, ok := srv.features.Lookup(name)
+			if !ok {
+				return writeError(w, FeatureError(feature.ErrNotFound))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(&f)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(FeaturesStatus{Deployment: srv.features.Deployment(), Flags: srv.features.List()})
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var freq FeatureRequest
+		if err = json.Unmarshal(rb, &freq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+
+		switch {
+		case freq.Flag != nil:
+			if freq.Name != "" || freq.Delete {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected either flag, or name to delete"))
+			}
+			if err = freq.Flag.Validate(); err != nil {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err))
+			}
+			f, err := srv.features.Put(ctx, *freq.Flag, time.Now())
+			if err != nil {
+				glog.Warning(err)
+				return writeError(w, FeatureError(err))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(&f)
+		case freq.Name != "" && freq.Delete:
+			if err = srv.features.Delete(ctx, freq.Name); err != nil {
+				return writeError(w, FeatureError(err))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		default:
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected flag, or name with delete"))
+		}
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// featuresHandler returns whether each feature is on for the "key" query.
+func featuresHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.features == nil {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "feature flags are not enabled"))
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.features.Evaluate(req.URL.Query().Get("key")))
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/feature"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestFeatures(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "features")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 38379, 38380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{rootCtx: context.Background(), qu: qu}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := with(h, srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if w := serve(adminFeaturesHandler, http.MethodGet, "/admin/features", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when disabled, got %d", w.Code)
+	}
+	// gated features are on without the feature flags
+	if !srv.featureEnabled(FeatureSpeculation, "req-1") || srv.itemProtocol(queue.ProtocolV2, "req-1") != queue.ProtocolV2 {
+		t.Fatal("expected the gated features on")
+	}
+	srv.features = feature.New(qu.Client(), feature.Config{Deployment: "prod"})
+
+	if w := serve(adminFeaturesHandler, http.MethodPost, "/admin/features", `{"flag":{"name":"worker-protocol-v2","percent":101}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	w := serve(adminFeaturesHandler, http.MethodPost, "/admin/features", `{"flag":{"name":"worker-protocol-v2","percent":100,"deployments":{"prod":0}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	var f feature.Flag
+	if err = json.NewDecoder(w.Body).Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != FeatureWorkerProtocolV2 || f.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected flag %+v", f)
+	}
+	// off in the deployment
+	if srv.itemProtocol(queue.ProtocolV2, "req-1") != queue.ProtocolV1 || srv.itemProtocol(queue.ProtocolV1, "req-1") != queue.ProtocolV1 {
+		t.Fatal("expected protocol v1")
+	}
+	if !srv.featureEnabled(FeatureSpeculation, "req-1") {
+		t.Fatal("expected undefined feature on")
+	}
+
+	w = serve(adminFeaturesHandler, http.MethodGet, "/admin/features", "")
+	var st FeaturesStatus
+	if err = json.NewDecoder(w.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Deployment != "prod" || len(st.Flags) != 1 || st.Flags[0].Name != FeatureWorkerProtocolV2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	w = serve(featuresHandler, http.MethodGet, "/features?key=alice", "")
+	var ev map[string]bool
+	if err = json.NewDecoder(w.Body).Decode(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if on, ok := ev[FeatureWorkerProtocolV2]; !ok || on {
+		t.Fatalf("unexpected evaluation %v", ev)
+	}
+
+	if w = serve(adminFeaturesHandler, http.MethodPost, "/admin/features", `{"name":"worker-protocol-v2","delete":true}`); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if w = serve(adminFeaturesHandler, http.MethodGet, "/admin/features?name=worker-protocol-v2", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	if srv.itemProtocol(queue.ProtocolV2, "req-1") != queue.ProtocolV2 {
+		t.Fatal("expected protocol v2 after the flag is deleted")
+	}
+}
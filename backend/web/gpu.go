@@ -0,0 +1,43 @@
+package web
+
+import (
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// WithGPURoutes configures the request routes (e.g. "/cats-request"),
+// whose jobs are delivered to GPU workers first.
+func WithGPURoutes(routes ...string) ServerOpOption {
+	return func(op *ServerOp) {
+		if op.gpuRoutes == nil {
+			op.gpuRoutes = make(map[string]bool)
+		}
+		for _, r := range routes {
+			op.gpuRoutes[r] = true
+		}
+	}
+}
+
+// WithGPUFallback configures the duration that GPU jobs wait for GPU workers,
+// before being delivered to CPU workers.
+// Defaults to 'etcdqueue.DefaultGPUFallback'.
+func WithGPUFallback(d time.Duration) ServerOpOption {
+	return func(op *ServerOp) { op.gpuFallback = d }
+}
+
+// popOpts returns the queue options to pop jobs for the worker capabilities,
+// and the worker version while the canary routing is enabled.
+func (srv *Server) popOpts(capabilities []string, workerID string) []queue.OpOption {
+	var opts []queue.OpOption
+	if len(capabilities) > 0 {
+		opts = append(opts, queue.WithJobTypes(capabilities...))
+	}
+	if srv.canary.active() != "" {
+		opts = append(opts, queue.WithWorkerVersion(srv.workerVersion(workerID)))
+	}
+	if srv.gpuFallback > 0 {
+		opts = append(opts, queue.WithGPUFallback(srv.gpuFallback))
+	}
+	return opts
+}
@@ -0,0 +1,173 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/gyuho/dplearn/backend/workerpb"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithGRPC serves the worker gRPC service on the address (e.g. "localhost:2201").
+// Empty address disables the gRPC service. The service does not authenticate
+// the workers, so that anyone who reaches it can fetch and complete the jobs:
+// bind it to the loopback or a private network interface, never to a public one.
+func WithGRPC(hostPort string) ServerOpOption {
+	return func(op *ServerOp) { op.grpcAddr = hostPort }
+}
+
+// startGRPC starts serving the worker gRPC service.
+func (srv *Server) startGRPC(hostPort string) error {
+	ln, err := net.Listen("tcp", hostPort)
+	if err != nil {
+		return err
+	}
+	gs := grpc.NewServer()
+	workerpb.RegisterWorkerServer(gs, &workerServer{srv: srv})
+	srv.grpcServer = gs
+	srv.grpcAddr = ln.Addr().String()
+
+	go func() {
+		glog.Infof("starting gRPC server %q", ln.Addr().String())
+		if err := gs.Serve(ln); err != nil {
+			glog.Warningf("gRPC server %q stopped (%v)", ln.Addr().String(), err)
+		}
+	}()
+	return nil
+}
+
+// GRPCAddr returns the address of the worker gRPC service.
+// Returns empty string if the gRPC service is disabled.
+func (srv *Server) GRPCAddr() string {
+	return srv.grpcAddr
+}
+
+// workerServer implements workerpb.WorkerServer.
+type workerServer struct {
+	srv *Server
+}
+
+func (ws *workerServer) FetchJob(stream workerpb.Worker_FetchJobServer) error {
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Bucket == "" {
+			return status.Errorf(codes.InvalidArgument, "empty bucket")
+		}
+
+		if err = queue.CheckProtocol(int(req.ProtocolVersion)); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if ws.srv.workerUnhealthy(req.WorkerId) {
+			return status.Error(codes.Unavailable, ws.srv.workerUnhealthyError(req.WorkerId).Message)
+		}
+		if aerr := ws.srv.dispatchError(req.WorkerId, req.Bucket); aerr != nil {
+			return status.Error(codes.Unavailable, aerr.Message)
+		}
+
+		glog.Infof("worker %q fetching job from %q (capabilities %q)", req.WorkerId, req.Bucket, req.Capabilities)
+		item := <-ws.srv.qu.Pop(ctx, req.Bucket, ws.srv.popOpts(req.Capabilities, req.WorkerId)...)
+		if item == nil {
+			if ctx.Err() != nil {
+				return status.Error(codes.Canceled, ctx.Err().Error())
+			}
+			return status.Errorf(codes.Unavailable, "queue watch on %q closed", req.Bucket)
+		}
+		if item.Error != "" {
+			glog.Warning(item.Error)
+			return status.Errorf(codes.Unavailable, "%s", item.Error)
+		}
+
+		if err = stream.Send(&workerpb.Job{
+			Bucket:    item.Bucket,
+			Key:       item.Key,
+			Value:     item.Value,
+			Progress:  int32(item.Progress),
+			RequestId: item.RequestID,
+			JobType:   item.JobType,
+		}); err != nil {
+			return err
+		}
+		ws.srv.jobClaimed(item)
+		glog.Infof("worker %q fetched %q", req.WorkerId, item.RequestID)
+	}
+}
+
+func (ws *workerServer) ReportProgress(ctx context.Context, req *workerpb.ProgressRequest) (*workerpb.ProgressResponse, error) {
+	item, err := ws.srv.loadItem(req.RequestId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Progress < 0 || req.Progress >= queue.MaxProgress {
+		return nil, status.Errorf(codes.InvalidArgument, "progress %d out of range [0, %d)", req.Progress, queue.MaxProgress)
+	}
+	prev := item.StageProgress
+	item.Progress = int(req.Progress)
+	item.StageProgress = nil
+	if req.Stage != "" {
+		sp := &queue.StageProgress{Current: req.Stage, Percent: int(req.StagePercent)}
+		for _, s := range req.Stages {
+			sp.Stages = append(sp.Stages, queue.Stage{Name: s.Name, Weight: int(s.Weight)})
+		}
+		if len(sp.Stages) == 0 && prev != nil {
+			sp.Stages = prev.Stages
+		}
+		item.StageProgress = sp
+	}
+	if aerr := applyStageProgress(&item, prev); aerr != nil {
+		return nil, status.Error(codes.InvalidArgument, aerr.Message)
+	}
+	stored, _ := ws.srv.storeItem(item)
+
+	glog.Infof("queue received progress %d on %q", req.Progress, req.RequestId)
+	return &workerpb.ProgressResponse{Canceled: stored.Canceled}, nil
+}
+
+func (ws *workerServer) Complete(ctx context.Context, req *workerpb.CompleteRequest) (*workerpb.CompleteResponse, error) {
+	item, err := ws.srv.loadItem(req.RequestId)
+	if err != nil {
+		return nil, err
+	}
+	item.Progress = queue.MaxProgress
+	item.Error = req.Error
+	if req.Value != "" {
+		item.Value = req.Value
+	}
+	if _, ok := ws.srv.storeItem(item); ok {
+		ws.srv.jobCompleted(&item)
+	}
+
+	glog.Infof("queue received completion on %q", req.RequestId)
+	return &workerpb.CompleteResponse{}, nil
+}
+
+// loadItem returns the copy of the item in the request cache.
+func (srv *Server) loadItem(requestID string) (queue.Item, error) {
+	if requestID == "" {
+		return queue.Item{}, status.Errorf(codes.InvalidArgument, "empty request ID")
+	}
+	vi, ok := srv.requestCache.Load(requestID)
+	if !ok {
+		return queue.Item{}, status.Errorf(codes.NotFound, "unknown request ID %q", requestID)
+	}
+	switch v := vi.(type) {
+	case *queue.Item:
+		return *v, nil
+	case queue.Item:
+		return v, nil
+	default:
+		return queue.Item{}, status.Errorf(codes.Internal, "unexpected item type %T", vi)
+	}
+}
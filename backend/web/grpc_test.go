@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/backend/workerpb"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// popQueue serves items from the channel on Pop.
+type popQueue struct {
+	nopQueue
+	itemc chan *queue.Item
+}
+
+func (qu *popQueue) Pop(ctx context.Context, bucket string, opts ...queue.OpOption) queue.ItemWatcher {
+	return qu.itemc
+}
+
+func (qu *popQueue) TryPop(ctx context.Context, bucket string, opts ...queue.OpOption) (*queue.Item, error) {
+	select {
+	case item := <-qu.itemc:
+		return item, nil
+	default:
+		return nil, nil
+	}
+}
+
+func TestWorkerGRPC(t *testing.T) {
+	qu := &popQueue{nopQueue: nopQueue{t: t}, itemc: make(chan *queue.Item, 1)}
+	srv := &Server{qu: qu}
+	if err := srv.startGRPC("localhost:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.grpcServer.Stop()
+
+	conn, err := grpc.Dial(srv.GRPCAddr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := workerpb.NewWorkerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "test-request-id"
+	item.JobType = "cats-vs-dogs"
+	srv.requestCache.Store(item.RequestID, item)
+	qu.itemc <- item
+
+	stream, err := cli.FetchJob(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&workerpb.FetchJobRequest{Bucket: "/cats-request", WorkerId: "test", Capabilities: []string{"cats-vs-dogs"}}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Key != item.Key || job.Value != item.Value || job.RequestId != item.RequestID || job.JobType != item.JobType {
+		t.Fatalf("expected %+v, got %+v", item, job)
+	}
+	stream.CloseSend()
+
+	presp, err := cli.ReportProgress(ctx, &workerpb.ProgressRequest{Bucket: job.Bucket, Key: job.Key, RequestId: job.RequestId, Progress: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presp.Canceled {
+		t.Fatal("unexpected cancel")
+	}
+	if it, _ := srv.loadItem(job.RequestId); it.Progress != 50 {
+		t.Fatalf("expected progress 50, got %d", it.Progress)
+	}
+
+	if _, err = cli.Complete(ctx, &workerpb.CompleteRequest{Bucket: job.Bucket, Key: job.Key, RequestId: job.RequestId, Value: "it's a cat!"}); err != nil {
+		t.Fatal(err)
+	}
+	it, _ := srv.loadItem(job.RequestId)
+	if it.Progress != queue.MaxProgress || it.Value != "it's a cat!" {
+		t.Fatalf("unexpected item %+v", it)
+	}
+
+	_, err = cli.Complete(ctx, &workerpb.CompleteRequest{RequestId: "unknown"})
+	if st, _ := status.FromError(err); st.Code() != codes.NotFound {
+		t.Fatalf("expected %v, got %v", codes.NotFound, err)
+	}
+}
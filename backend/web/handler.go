@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -13,16 +14,30 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gyuho/dplearn/pkg/audit"
+	"github.com/gyuho/dplearn/pkg/autoscale"
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/coordinator"
 	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/experiment"
+	"github.com/gyuho/dplearn/pkg/feature"
 	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/inproc"
 	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/registry"
+	"github.com/gyuho/dplearn/pkg/scheduler"
 	"github.com/gyuho/dplearn/pkg/urlutil"
+	"github.com/gyuho/dplearn/pkg/usage"
+	"github.com/gyuho/dplearn/pkg/user"
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/golang/glog"
+	"google.golang.org/grpc"
 )
 
 // Server warps http.Server.
@@ -37,6 +52,110 @@ type Server struct {
 	donec chan struct{}
 
 	requestCache sync.Map
+
+	// blobs stores resumable uploads.
+	blobs blobstore.Store
+	// uploadLocks tracks uploads with PATCH in progress.
+	uploadLocks sync.Map
+
+	// maintenance is 1 when the server is in maintenance mode.
+	maintenance    int32
+	maintenanceMsg string
+
+	// grpcServer serves workers over gRPC, nil if disabled.
+	grpcServer *grpc.Server
+	grpcAddr   string
+
+	// workers is the worker registry, from worker ID to workerproc.Liveness.
+	workers sync.Map
+	// workerToken is the shared secret for worker registrations,
+	// empty to only accept registrations from the admins.
+	workerToken string
+
+	// autoscaler computes the desired number of workers, nil if disabled.
+	autoscaler *autoscale.Autoscaler
+
+	// gpuRoutes are the routes whose jobs prefer GPU workers.
+	gpuRoutes   map[string]bool
+	gpuFallback time.Duration
+
+	// notifier receives worker health events, nil if disabled.
+	notifier notify.Sink
+	// healthyBuckets tracks whether each bucket had healthy workers
+	// on the last health check, protected by 'mu'.
+	healthyBuckets map[string]bool
+
+	// artifactSigner signs artifact URLs, nil if disabled.
+	artifactSigner URLSigner
+	artifactURLTTL time.Duration
+
+	// blobBackend stores the artifacts and the backups, nil if disabled.
+	blobBackend blobstore.Backend
+
+	// spec duplicates straggler jobs, nil if disabled.
+	spec *speculator
+
+	// maxJobAttempts is the number of attempts of timed-out jobs.
+	maxJobAttempts int
+
+	// canary routes jobs to the canary worker version.
+	canary *canary
+
+	// coord owns the fleet decisions while leading, nil if disabled.
+	coord *coordinator.Coordinator
+
+	// models is the model registry, nil if disabled.
+	models *registry.Registry
+
+	// experiments records the training runs, nil if disabled.
+	experiments *experiment.Tracker
+
+	// pipelines tracks the pipeline runs, nil if disabled.
+	pipelines *pipelines
+
+	// users stores the user accounts, nil if disabled. Requests with
+	// the session tokens signed by 'userTokens' are of the users.
+	users        *user.Store
+	userTokens   user.Tokens
+	requireLogin bool
+	// admins are the users with the admin role.
+	admins map[string]bool
+	// csrfSecret signs the CSRF tokens of the admin requests.
+	csrfSecret []byte
+
+	// quotas accounts the usage of the users, nil if disabled.
+	quotas *quotas
+
+	// audit records the security-relevant actions, nil if disabled.
+	audit *audit.Log
+
+	// scheduler enqueues the jobs of the schedules while leading,
+	// nil if disabled.
+	scheduler *scheduler.Scheduler
+
+	// features are the feature flags gating the risky features,
+	// nil if disabled.
+	features *feature.Store
+
+	// jobEvents receives the job events buffered in 'jobEventc',
+	// nil if disabled.
+	jobEvents JobEventSink
+	jobEventc chan JobEvent
+
+	// metrics accumulates the job and HTTP metrics between exports
+	// to 'metricsSink', which is nil if disabled.
+	metrics     *metricsRecorder
+	metricsSink MetricsSink
+
+	// diskDir is the directory to check the disk space of before
+	// accepting uploads, keeping 'minDiskSpace' available. Empty to
+	// disable the check.
+	diskDir      string
+	minDiskSpace uint64
+
+	// shredUploads is true to shred the uploaded images once the
+	// request is deleted.
+	shredUploads bool
 }
 
 type key int
@@ -46,6 +165,8 @@ const (
 	queueKey
 	cacheKey
 	userKey
+	// accountKey is the user name of the session, empty if anonymous.
+	accountKey
 )
 
 func with(h ContextHandler, srv *Server, qu queue.Queue, cache lru.Cache) ContextHandler {
@@ -53,8 +174,17 @@ func with(h ContextHandler, srv *Server, qu queue.Queue, cache lru.Cache) Contex
 		ctx = context.WithValue(ctx, serverKey, srv)
 		ctx = context.WithValue(ctx, queueKey, qu)
 		ctx = context.WithValue(ctx, cacheKey, cache)
-		ctx = context.WithValue(ctx, userKey, generateUserID(req))
-		return h.ServeHTTPContext(ctx, w, req)
+		userID, account := generateUserID(req), srv.account(req)
+		if account != "" {
+			userID = accountUserID(account)
+		}
+		ctx = context.WithValue(ctx, userKey, userID)
+		ctx = context.WithValue(ctx, accountKey, account)
+		err := h.ServeHTTPContext(ctx, w, req)
+		if sw, ok := w.(*statusWriter); ok {
+			srv.metrics.request(sw.code, err)
+		}
+		return err
 	})
 }
 
@@ -66,38 +196,397 @@ const (
 )
 
 // StartServer starts a backend webserver with stoppable listener.
-func StartServer(scheme, hostPort string, qu queue.Queue) (*Server, error) {
+func StartServer(scheme, hostPort string, qu queue.Queue, opts ...ServerOpOption) (*Server, error) {
+	ret := ServerOp{}
+	WithConcurrencyLimit("/cats-request", DefaultMaxConcurrentSubmissions, http.MethodPost)(&ret)
+	WithConcurrencyLimit(UploadPath, DefaultMaxConcurrentSubmissions, http.MethodPost, http.MethodPatch)(&ret)
+	ret.applyOpts(opts)
+	if ret.blobs == nil {
+		var err error
+		newLocal := blobstore.NewLocal
+		if ret.shredUploads {
+			newLocal = blobstore.NewLocalShred
+		}
+		ret.blobs, err = newLocal(filepath.Join(os.TempDir(), "dplearn-uploads"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	rootCtx, rootCancel := context.WithCancel(context.Background())
 	mux := http.NewServeMux()
 	webURL := url.URL{Scheme: scheme, Host: hostPort}
 	srv := &Server{
-		rootCtx:    rootCtx,
-		rootCancel: rootCancel,
-		webURL:     webURL,
-		httpServer: &http.Server{Addr: webURL.Host, Handler: mux},
-		qu:         qu,
-		donec:      make(chan struct{}),
+		rootCtx:     rootCtx,
+		rootCancel:  rootCancel,
+		webURL:      webURL,
+		httpServer:  &http.Server{Addr: webURL.Host, Handler: mux},
+		qu:          qu,
+		blobs:       ret.blobs,
+		autoscaler:  ret.autoscaler,
+		gpuRoutes:   ret.gpuRoutes,
+		gpuFallback: ret.gpuFallback,
+		notifier:    ret.notifier,
+		donec:       make(chan struct{}),
+
+		artifactSigner: ret.artifactSigner,
+		artifactURLTTL: ret.artifactURLTTL,
+		blobBackend:    ret.blobBackend,
+		maxJobAttempts: ret.maxJobAttempts,
+		canary:         newCanary(ret.canaryVersion, ret.canaryPercent),
+		jobEvents:      ret.jobEvents,
+		metrics:        newMetricsRecorder(time.Now()),
+		metricsSink:    ret.metricsSink,
+		diskDir:        ret.diskDir,
+		minDiskSpace:   ret.minDiskSpace,
+		shredUploads:   ret.shredUploads,
+	}
+	if srv.jobEvents != nil {
+		srv.jobEventc = make(chan JobEvent, jobEventBuffer)
+	}
+	srv.workerToken = ret.workerToken
+	if srv.artifactURLTTL == 0 {
+		srv.artifactURLTTL = DefaultArtifactURLTTL
+	}
+	if srv.maxJobAttempts == 0 {
+		srv.maxJobAttempts = DefaultMaxJobAttempts
+	}
+	if ret.speculationPercentile != 0 {
+		var err error
+		if srv.spec, err = newSpeculator(ret.speculationPercentile); err != nil {
+			rootCancel()
+			return nil, err
+		}
+	}
+
+	if ret.coordinator != nil {
+		cfg := *ret.coordinator
+		cfg.Source = coordinatorSource{srv}
+		srv.coord = coordinator.New(qu.Client(), cfg)
+	}
+	if ret.modelRegistry != nil {
+		store := ret.modelStore
+		if store == nil {
+			store = srv.blobs
+		}
+		srv.models = registry.New(qu.Client(), store, *ret.modelRegistry)
+	}
+	if ret.experiments != nil {
+		srv.experiments = experiment.New(qu.Client(), *ret.experiments)
+	}
+	if ret.users != nil {
+		srv.users = user.New(qu.Client(), *ret.users)
+		srv.userTokens, srv.requireLogin = ret.userTokens, ret.loginRequired
+		srv.admins = make(map[string]bool)
+		for _, name := range ret.admins {
+			srv.admins[name] = true
+		}
+	}
+	srv.csrfSecret = srv.userTokens.Secret
+	if len(srv.csrfSecret) == 0 {
+		srv.csrfSecret = make([]byte, 32)
+		if _, err := rand.Read(srv.csrfSecret); err != nil {
+			return nil, err
+		}
+	}
+	if ret.quotas != nil {
+		srv.quotas = newQuotas(usage.New(qu.Client(), *ret.quotas))
+	}
+	if ret.audit != nil {
+		srv.audit = audit.New(qu.Client(), *ret.audit)
+	}
+	if ret.scheduler != nil {
+		cfg := *ret.scheduler
+		cfg.Enqueue = srv.enqueueScheduled
+		srv.scheduler = scheduler.New(qu.Client(), cfg)
+	}
+	if ret.features != nil {
+		srv.features = feature.New(qu.Client(), *ret.features)
+	}
+	if ret.pipelinesEnabled {
+		var err error
+		if srv.pipelines, err = newPipelines(ret.pipelines); err != nil {
+			rootCancel()
+			return nil, err
+		}
 	}
 
 	cache := lru.NewInMemory(imageCacheSize)
 	cache.CreateNamespace(imageCacheBucket)
 
 	mux.Handle("/healthz", &ContextAdapter{
-		ctx: rootCtx,
+		ctx:   rootCtx,
+		route: "/healthz",
 		handler: ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
 			w.WriteHeader(200)
 			w.Write([]byte("OK"))
 			return nil
 		}),
 	})
+	mux.Handle("/version", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/version",
+		handler: with(ContextHandlerFunc(versionHandler), srv, qu, cache),
+	})
+	mux.Handle("/status", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/status",
+		handler: with(ContextHandlerFunc(statusHandler), srv, qu, cache),
+	})
+	mux.Handle("/autoscale", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/autoscale",
+		handler: with(ContextHandlerFunc(autoscaleHandler), srv, qu, cache),
+	})
+	mux.Handle("/workers", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/workers",
+		handler: with(withValidation(ContextHandlerFunc(workersHandler), workersSchemas), srv, qu, cache),
+	})
+	mux.Handle("/admin/maintenance", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/maintenance",
+		handler: with(withAudit(withAdmin(withValidation(ContextHandlerFunc(maintenanceHandler), maintenanceSchemas)), "admin.maintenance"), srv, qu, cache),
+	})
+	mux.Handle("/admin/canary", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/canary",
+		handler: with(withAudit(withAdmin(withValidation(ContextHandlerFunc(canaryHandler), canarySchemas)), "admin.canary"), srv, qu, cache),
+	})
+	mux.Handle("/admin/coordinator", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/coordinator",
+		handler: with(withAudit(withAdmin(withValidation(ContextHandlerFunc(coordinatorHandler), coordinatorSchemas)), "admin.coordinator"), srv, qu, cache),
+	})
+	mux.Handle("/admin/jobs", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/jobs",
+		handler: with(withAdmin(withValidation(ContextHandlerFunc(jobsHandler), jobsSchemas)), srv, qu, cache),
+	})
+	mux.Handle("/admin", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin",
+		handler: with(withAdmin(ContextHandlerFunc(adminUIHandler)), srv, qu, cache),
+	})
+	mux.Handle("/admin/csrf", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/csrf",
+		handler: with(withAdmin(ContextHandlerFunc(adminCSRFHandler)), srv, qu, cache),
+	})
+	mux.Handle("/admin/overview", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/overview",
+		handler: with(withAdmin(ContextHandlerFunc(adminOverviewHandler)), srv, qu, cache),
+	})
+	mux.Handle("/admin/queue", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/queue",
+		handler: with(withAudit(withAdmin(withValidation(ContextHandlerFunc(adminQueueHandler), adminQueueSchemas)), "admin.queue"), srv, qu, cache),
+	})
+	mux.Handle("/admin/backup", &ContextAdapter{
+		ctx:   rootCtx,
+		route: "/admin/backup",
+		handler: with(withAuditMethods(withAdmin(ContextHandlerFunc(backupHandler)), map[string]string{
+			http.MethodGet:  "admin.backup",
+			http.MethodPost: "admin.restore",
+			http.MethodPut:  "admin.restore",
+		}), srv, qu, cache),
+	})
+	mux.Handle("/admin/models", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/models",
+		handler: with(withAudit(withAdmin(withValidation(ContextHandlerFunc(modelsHandler), modelsSchemas)), "admin.models"), srv, qu, cache),
+	})
+	mux.Handle("/admin/models/artifact", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/models/artifact",
+		handler: with(withAudit(withAdmin(ContextHandlerFunc(modelArtifactHandler)), "admin.models.artifact"), srv, qu, cache),
+	})
+	mux.Handle("/experiments", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/experiments",
+		handler: with(withValidation(ContextHandlerFunc(experimentsHandler), experimentsSchemas), srv, qu, cache),
+	})
+	mux.Handle("/experiments/run", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/experiments/run",
+		handler: with(withValidation(ContextHandlerFunc(experimentRunHandler), experimentRunSchemas), srv, qu, cache),
+	})
+	mux.Handle("/experiments/compare", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/experiments/compare",
+		handler: with(ContextHandlerFunc(experimentCompareHandler), srv, qu, cache),
+	})
+	mux.Handle("/pipelines", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/pipelines",
+		handler: with(withAudit(withValidation(ContextHandlerFunc(pipelinesHandler), pipelinesSchemas), "pipeline.run"), srv, qu, cache),
+	})
+	mux.Handle("/users/register", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/users/register",
+		handler: with(withAudit(withValidation(ContextHandlerFunc(registerHandler), registerSchemas), "user.register"), srv, qu, cache),
+	})
+	mux.Handle("/users/login", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/users/login",
+		handler: with(withValidation(ContextHandlerFunc(loginHandler), loginSchemas), srv, qu, cache),
+	})
+	mux.Handle("/users/me", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/users/me",
+		handler: with(withAudit(withValidation(ContextHandlerFunc(meHandler), meSchemas), "user.update"), srv, qu, cache),
+	})
+	mux.Handle("/users/jobs", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/users/jobs",
+		handler: with(ContextHandlerFunc(userJobsHandler), srv, qu, cache),
+	})
+	mux.Handle("/usage", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/usage",
+		handler: with(ContextHandlerFunc(usageHandler), srv, qu, cache),
+	})
+	mux.Handle("/admin/usage", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/usage",
+		handler: with(withAdmin(ContextHandlerFunc(adminUsageHandler)), srv, qu, cache),
+	})
+	mux.Handle("/admin/schedules", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/schedules",
+		handler: with(withAudit(withAdmin(ContextHandlerFunc(schedulesHandler)), "admin.schedules"), srv, qu, cache),
+	})
+	mux.Handle("/admin/features", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/features",
+		handler: with(withAudit(withAdmin(ContextHandlerFunc(adminFeaturesHandler)), "admin.features"), srv, qu, cache),
+	})
+	mux.Handle("/features", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/features",
+		handler: with(ContextHandlerFunc(featuresHandler), srv, qu, cache),
+	})
+	mux.Handle("/admin/audit", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/audit",
+		handler: with(withAdmin(ContextHandlerFunc(auditHandler)), srv, qu, cache),
+	})
+	mux.Handle("/admin/audit/export", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/admin/audit/export",
+		handler: with(withAdmin(ContextHandlerFunc(auditExportHandler)), srv, qu, cache),
+	})
+	mux.Handle("/models/artifact", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/models/artifact",
+		handler: with(ContextHandlerFunc(modelDownloadHandler), srv, qu, cache),
+	})
+	mux.Handle("/models/serving", &ContextAdapter{
+		ctx:     rootCtx,
+		route:   "/models/serving",
+		handler: with(ContextHandlerFunc(modelServingHandler), srv, qu, cache),
+	})
+	uploadHandler := &ContextAdapter{
+		ctx:   rootCtx,
+		route: UploadPath,
+		handler: withConcurrencyLimit(
+			with(ContextHandlerFunc(uploadHandler), srv, qu, cache),
+			UploadPath, ret.limits[UploadPath],
+		),
+	}
+	mux.Handle(strings.TrimSuffix(UploadPath, "/"), uploadHandler)
+	mux.Handle(UploadPath, uploadHandler)
 	mux.Handle("/cats-request", &ContextAdapter{
+		ctx:   rootCtx,
+		route: "/cats-request",
+		handler: withConcurrencyLimit(
+			with(withValidation(ContextHandlerFunc(clientRequestHandler), clientRequestSchemas), srv, qu, cache),
+			"/cats-request", ret.limits["/cats-request"],
+		),
+	})
+	for _, bucket := range inproc.Buckets() {
+		h, _ := inproc.Lookup(bucket)
+		mux.Handle(bucket, &ContextAdapter{
+			ctx:   rootCtx,
+			route: bucket,
+			handler: withConcurrencyLimit(
+				with(withValidation(ContextHandlerFunc(clientRequestHandler), clientRequestSchemas), srv, qu, cache),
+				bucket, ret.limits[bucket],
+			),
+		})
+		go srv.runInProcess(bucket, h)
+	}
+	mux.Handle("/cats-request/logs", &ContextAdapter{
 		ctx:     rootCtx,
-		handler: with(ContextHandlerFunc(clientRequestHandler), srv, qu, cache),
+		route:   "/cats-request/logs",
+		handler: with(withValidation(ContextHandlerFunc(logsHandler), logsSchemas), srv, qu, cache),
 	})
-	mux.Handle("/cats-request/queue", &ContextAdapter{
+	mux.Handle("/cats-request/artifact", &ContextAdapter{
 		ctx:     rootCtx,
-		handler: with(ContextHandlerFunc(queueHandler), srv, qu, cache),
+		route:   "/cats-request/artifact",
+		handler: with(ContextHandlerFunc(artifactHandler), srv, qu, cache),
 	})
+	if _, ok := ret.blobBackend.(*blobstore.FS); ok {
+		mux.Handle("/blobs/", &ContextAdapter{
+			ctx:     rootCtx,
+			route:   "/blobs/",
+			handler: with(ContextHandlerFunc(blobsHandler), srv, qu, cache),
+		})
+	}
+	mux.Handle("/cats-request/queue", &ContextAdapter{
+		ctx:   rootCtx,
+		route: "/cats-request/queue",
+		handler: withConcurrencyLimit(
+			with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, cache),
+			"/cats-request/queue", ret.limits["/cats-request/queue"],
+		),
+	})
+
+	if ret.grpcAddr != "" {
+		if err := srv.startGRPC(ret.grpcAddr); err != nil {
+			rootCancel()
+			return nil, err
+		}
+	}
+
+	if srv.autoscaler != nil {
+		go srv.autoscaler.Run(rootCtx)
+	}
+	if ret.healthInterval > 0 {
+		go srv.runHealthCheck(ret.healthInterval)
+	}
+	if srv.spec != nil {
+		go srv.runSpeculation(speculationInterval)
+	}
+	if srv.coord != nil {
+		go srv.coord.Run(rootCtx)
+	}
+	if srv.models != nil {
+		go srv.models.Run(rootCtx)
+	}
+	if srv.pipelines != nil {
+		go srv.runPipelines(pipelineInterval)
+	}
+	if srv.scheduler != nil {
+		go srv.scheduler.Run(rootCtx)
+	}
+	if srv.features != nil {
+		go srv.features.Run(rootCtx)
+	}
+	if srv.blobBackend != nil && ret.backupInterval > 0 {
+		go srv.runBackups(ret.backupInterval)
+	}
+	if srv.jobEvents != nil {
+		go srv.runJobEvents(jobEventFlushInterval)
+	}
+	if srv.metricsSink != nil {
+		interval := ret.metricsInterval
+		if interval == 0 {
+			interval = DefaultMetricsInterval
+		}
+		go srv.runMetrics(interval)
+	}
 
 	gcPeriod := 5 * time.Minute
 	go srv.gcCache(gcPeriod)
@@ -151,6 +640,7 @@ func (srv *Server) gcCache(period time.Duration) {
 
 			glog.Warningf("%q should have been requested to delete when user leaves browser (missed DELETE request?)", id)
 			if time.Since(item.CreatedAt) > period {
+				srv.finishedUsage(item)
 				srv.requestCache.Delete(k)
 				if item.Progress == queue.MaxProgress {
 					glog.Infof("deleted %q because its progress is %d (created at %s)", id, queue.MaxProgress, item.CreatedAt)
@@ -168,6 +658,10 @@ func (srv *Server) Stop() error {
 	glog.Infof("stopping server %q", srv.webURL.String())
 
 	srv.mu.Lock()
+	if srv.grpcServer != nil {
+		srv.grpcServer.Stop()
+		srv.grpcServer = nil
+	}
 	srv.qu.Stop()
 	if srv.httpServer == nil {
 		srv.mu.Unlock()
@@ -200,9 +694,44 @@ func queueHandler(ctx context.Context, w http.ResponseWriter, req *http.Request)
 
 	switch req.Method {
 	case http.MethodGet:
-		return json.NewEncoder(w).Encode(<-qu.Pop(ctx, bucket))
+		version, aerr := workerProtocol(req)
+		if aerr != nil {
+			return writeError(w, aerr)
+		}
+		id := req.URL.Query().Get("worker_id")
+		if srv.workerUnhealthy(id) {
+			return writeError(w, srv.workerUnhealthyError(id))
+		}
+		if aerr = srv.dispatchError(id, bucket); aerr != nil {
+			return writeError(w, aerr)
+		}
+		var caps []string
+		if v := req.URL.Query().Get("capabilities"); v != "" {
+			caps = strings.Split(v, ",")
+		}
+		max, wait, aerr := batchParams(req)
+		if aerr != nil {
+			return writeError(w, aerr)
+		}
+		if max > 0 {
+			return srv.serveBatch(ctx, w, qu, bucket, srv.popOpts(caps, id), version, max, wait)
+		}
+		item := <-qu.Pop(ctx, bucket, srv.popOpts(caps, id)...)
+		if item == nil {
+			return writeError(w, NewError(http.StatusServiceUnavailable, ErrCodeQueueUnavailable, "queue watch on %q closed", bucket))
+		}
+		if item.Error != "" {
+			glog.Warning(item.Error)
+			return writeError(w, QueueItemError(item.Error).WithRequestID(item.RequestID))
+		}
+		srv.jobClaimed(item)
+		return json.NewEncoder(w).Encode(item.Encode(srv.itemProtocol(version, item.RequestID)))
 
 	case http.MethodPost:
+		version, aerr := workerProtocol(req)
+		if aerr != nil {
+			return writeError(w, aerr)
+		}
 		rb, err := ioutil.ReadAll(req.Body)
 		if err != nil {
 			return err
@@ -213,26 +742,56 @@ func queueHandler(ctx context.Context, w http.ResponseWriter, req *http.Request)
 
 		var item queue.Item
 		if err = json.Unmarshal(rb, &item); err != nil {
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: bucket, Progress: 0, Error: err.Error()})
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
 		}
 
 		if item.Bucket == "" || item.Key == "" || item.Value == "" || item.RequestID == "" {
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: bucket, Progress: 0, Error: fmt.Sprintf("invalid item: %+v", item)})
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid item: %+v", item).WithRequestID(item.RequestID))
 		}
 
-		_, ok := srv.requestCache.Load(item.RequestID)
-		if !ok {
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: bucket, Progress: 0, Error: fmt.Sprintf("unknown request ID %q", item.RequestID)})
+		cached, err := srv.loadItem(item.RequestID)
+		if err != nil {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", item.RequestID).WithRequestID(item.RequestID))
+		}
+		// workers do not change the owner of the job
+		item.User = cached.User
+		version = srv.itemProtocol(version, item.RequestID)
+		if version == queue.ProtocolV1 {
+			// old workers do not know the routing fields
+			item.JobType, item.GPU, item.WorkerVersion = cached.JobType, cached.GPU, cached.WorkerVersion
+		}
+		if aerr := applyStageProgress(&item, cached.StageProgress); aerr != nil {
+			return writeError(w, aerr)
+		}
+		completed := item.Progress == queue.MaxProgress
+		if completed && (item.Requeue || item.TimedOut) && cached.Progress != queue.MaxProgress {
+			if item.Requeue {
+				item, err = srv.requeue(ctx, qu, item, cached)
+			} else {
+				item, err = srv.retryTimedOut(ctx, qu, item, cached)
+			}
+			if err != nil {
+				glog.Warning(err)
+				return writeError(w, QueueError(err).WithRequestID(item.RequestID))
+			}
+		}
+		stored, ok := srv.storeItem(item)
+		if ok && completed {
+			srv.jobCompleted(&item)
 		}
-		srv.requestCache.Store(item.RequestID, item)
 
 		glog.Infof("queue received POST on %q", item.RequestID)
-		return json.NewEncoder(w).Encode(&item)
+		return json.NewEncoder(w).Encode(stored.Encode(version))
 
 	default:
-		http.Error(w, "Method Not Allowed", 405)
+		return methodNotAllowed(w, req)
 	}
-	return nil
+}
+
+// routeJobTypes maps request routes to job types,
+// so that jobs are delivered to workers with the capability.
+var routeJobTypes = map[string]string{
+	"/cats-request": "cats-vs-dogs",
 }
 
 // Request defines requests from frontend.
@@ -252,15 +811,15 @@ func clientRequestHandler(ctx context.Context, w http.ResponseWriter, req *http.
 	case http.MethodGet: // item status fetch
 		requestID := req.Header.Get(RequestIDHeader)
 		if requestID == "" {
-			err := fmt.Errorf("expected %q from header (got %+v)", RequestIDHeader, req.Header)
+			err := NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected %q from header (got %+v)", RequestIDHeader, req.Header)
 			glog.Warning(err)
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+			return writeError(w, err)
 		}
 		vi, ok := srv.requestCache.Load(requestID)
 		if !ok {
-			err := fmt.Errorf("cannot find request ID %q", requestID)
+			err := NewError(http.StatusNotFound, ErrCodeNotFound, "cannot find request ID %q", requestID).WithRequestID(requestID)
 			glog.Warning(err)
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+			return writeError(w, err)
 		}
 		return json.NewEncoder(w).Encode(vi)
 
@@ -275,30 +834,50 @@ func clientRequestHandler(ctx context.Context, w http.ResponseWriter, req *http.
 
 		creq := Request{}
 		if err = json.Unmarshal(rb, &creq); err != nil {
-			err = fmt.Errorf("JSON parse error %q", err.Error())
-			glog.Warning(err)
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+			aerr := NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error())
+			glog.Warning(aerr)
+			return writeError(w, aerr)
 		}
 		if creq.DataFromFrontend == "" {
 			glog.Warning("TODO: skipping empty request... bug in frontend ngOnDestroy?")
 			return nil
 		}
+		if creq.CreateRequest {
+			if aerr := srv.loginRequired(ctx); aerr != nil {
+				return writeError(w, aerr)
+			}
+		}
+		if creq.CreateRequest && srv.InMaintenance() {
+			glog.Warningf("rejected new request on %q (maintenance mode)", reqPath)
+			return writeError(w, srv.maintenanceError())
+		}
 
+		dataURL := creq.DataFromFrontend
 		switch reqPath {
 		case "/cats-request":
 			var imgFilePath string
-			imgFilePath, err = cacheImage(cache, creq.DataFromFrontend)
+			if strings.HasPrefix(creq.DataFromFrontend, UploadPath) {
+				imgFilePath, err = uploadedImage(srv.blobs, creq.DataFromFrontend)
+			} else {
+				imgFilePath, err = cacheImage(ctx, cache, creq.DataFromFrontend)
+			}
 			if err != nil {
-				err = fmt.Errorf("error %q while fetching %q", err.Error(), creq.DataFromFrontend)
-				glog.Warning(err)
-				return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+				aerr, ok := err.(*Error)
+				if !ok {
+					aerr = NewError(http.StatusInternalServerError, ErrCodeInternal, "error %q while fetching %q", err.Error(), creq.DataFromFrontend)
+				}
+				glog.Warning(aerr)
+				return writeError(w, aerr)
 			}
 			creq.DataFromFrontend = imgFilePath
 
 		default:
-			err = fmt.Errorf("unknown request %q", reqPath)
-			glog.Warning(err)
-			return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+			// in-process handlers take the data as-is
+			if _, ok := inproc.Lookup(reqPath); !ok {
+				aerr := NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request %q", reqPath)
+				glog.Warning(aerr)
+				return writeError(w, aerr)
+			}
 		}
 
 		requestID := generateRequestID(reqPath, userID, creq.DataFromFrontend)
@@ -314,12 +893,23 @@ func clientRequestHandler(ctx context.Context, w http.ResponseWriter, req *http.
 
 			item := queue.CreateItem(reqPath, 100, creq.DataFromFrontend)
 			item.RequestID = requestID
+			item.JobType = routeJobTypes[reqPath]
+			item.GPU = srv.gpuRoutes[reqPath]
+			item.User, _ = ctx.Value(accountKey).(string)
+			srv.routeCanary(item)
+			if aerr := srv.startUsage(ctx, requestID); aerr != nil {
+				srv.auditRequest(ctx, req, "job.submit", requestID, audit.OutcomeDenied, aerr.Message)
+				return writeError(w, aerr.WithRequestID(requestID))
+			}
 
 			if err = qu.Add(ctx, item, queue.WithTTL(enqueueTTL)); err != nil {
 				glog.Warning(err)
-				return json.NewEncoder(w).Encode(&queue.Item{Bucket: reqPath, Progress: 0, Error: err.Error()})
+				srv.abortUsage(requestID)
+				return writeError(w, QueueError(err).WithRequestID(requestID))
 			}
 			srv.requestCache.Store(requestID, item)
+			srv.emitJobEvent(JobEnqueued, item)
+			srv.auditRequest(ctx, req, "job.submit", requestID, audit.OutcomeSuccess, "")
 
 			glog.Infof("created an item with request ID %s", requestID)
 			copied := *item
@@ -328,11 +918,18 @@ func clientRequestHandler(ctx context.Context, w http.ResponseWriter, req *http.
 
 		case false:
 			glog.Infof("deleting %q", requestID)
+			if item, err := srv.loadItem(requestID); err == nil {
+				srv.finishedUsage(&item)
+			}
 			srv.requestCache.Delete(requestID)
+			srv.auditRequest(ctx, req, "job.delete", requestID, audit.OutcomeSuccess, "")
+			if srv.shredUploads && strings.HasPrefix(dataURL, UploadPath) {
+				srv.shredUpload(strings.TrimPrefix(dataURL, UploadPath), creq.DataFromFrontend)
+			}
 		}
 
 	default:
-		http.Error(w, "Method Not Allowed", 405)
+		return methodNotAllowed(w, req)
 	}
 	return nil
 }
@@ -343,7 +940,7 @@ const (
 	imageCacheSizeLimit = 15000000 // 15 MB
 )
 
-func cacheImage(cache lru.Cache, ep string) (string, error) {
+func cacheImage(ctx context.Context, cache lru.Cache, ep string) (string, error) {
 	originURL := urlutil.TrimQuery(ep)
 
 	vi, err := cache.Get(imageCacheBucket, originURL)
@@ -357,7 +954,7 @@ func cacheImage(cache lru.Cache, ep string) (string, error) {
 		var ok bool
 		imgFilePath, ok = vi.(string)
 		if !ok {
-			return imgFilePath, fmt.Errorf("expected bytes type in 'image-cache' bucket, got %v", reflect.TypeOf(vi))
+			return imgFilePath, NewError(http.StatusInternalServerError, ErrCodeInternal, "expected bytes type in 'image-cache' bucket, got %v", reflect.TypeOf(vi))
 		}
 		glog.Infof("fetched %q from cache", originURL)
 	} else { // not exist in cache, download, and cache it!
@@ -365,26 +962,30 @@ func cacheImage(cache lru.Cache, ep string) (string, error) {
 		case ".jpg", ".jpeg":
 		case ".png":
 		default:
-			return "", fmt.Errorf("not support %q in %q (must be jpg, jpeg, png)", filepath.Ext(originURL), originURL)
+			return "", NewError(http.StatusBadRequest, ErrCodeUnsupported, "not support %q in %q (must be jpg, jpeg, png)", filepath.Ext(originURL), originURL)
 		}
 
-		size, sizet, err := urlutil.GetContentLength(originURL)
+		size, sizet, err := urlutil.GetContentLengthContext(ctx, originURL)
 		if err != nil {
-			return "", fmt.Errorf("error when fetching %q", originURL)
+			return "", NewError(http.StatusBadGateway, ErrCodeUpstream, "error when fetching %q", originURL)
 		}
 		if size > imageCacheSizeLimit {
-			return "", fmt.Errorf("%q is too big; %s > %s(limit)", originURL, sizet, humanize.Bytes(uint64(imageCacheSizeLimit)))
+			return "", NewError(http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "%q is too big; %s > %s(limit)", originURL, sizet, humanize.Bytes(uint64(imageCacheSizeLimit)))
 		}
 
 		glog.Infof("downloading %q", originURL)
 		var data []byte
-		data, err = urlutil.Get(originURL)
+		data, err = urlutil.GetContext(ctx, originURL)
 		if err != nil {
-			return "", err
+			return "", NewError(http.StatusBadGateway, ErrCodeUpstream, "error %q when downloading %q", err.Error(), originURL)
 		}
 		glog.Infof("downloaded %q (%s)", originURL, humanize.Bytes(uint64(len(data))))
 
-		imgFilePath = filepath.Join("/tmp", base64.StdEncoding.EncodeToString([]byte(originURL))+filepath.Ext(originURL))
+		// URL-safe encoding, so that the file name has no path separator
+		imgFilePath, err = fileutil.SecureJoin("/tmp", base64.URLEncoding.EncodeToString([]byte(originURL))+filepath.Ext(originURL))
+		if err != nil {
+			return "", NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid image URL %q (%v)", originURL, err)
+		}
 		glog.Infof("saving %q to %q", originURL, imgFilePath)
 		if err = fileutil.WriteToFile(imgFilePath, data); err != nil {
 			return imgFilePath, err
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
 
 	"github.com/golang/glog"
 )
@@ -60,6 +62,9 @@ func TestServer(t *testing.T) {
 	}
 	io.Copy(ioutil.Discard, resp.Body)
 	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %q (%s)", resp.Status, rb)
+	}
 	var item queue.Item
 	if err = json.Unmarshal(rb, &item); err != nil {
 		t.Fatal(err)
@@ -178,3 +183,45 @@ func TestServer(t *testing.T) {
 		t.Fatal("took too long to shut down")
 	}
 }
+
+// workers post back the claimed item, with the owner of the job
+func TestQueueReportUser(t *testing.T) {
+	srv := &Server{}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID, item.User = "req-1", "alice"
+	srv.requestCache.Store(item.RequestID, item)
+
+	for i, tt := range []struct {
+		user     string
+		progress int
+	}{
+		{"alice", 50},
+		// workers do not change the owner of the job
+		{"mallory", queue.MaxProgress},
+	} {
+		reported := *item
+		reported.User, reported.Progress = tt.user, tt.progress
+		body, err := json.Marshal(reported)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", bytes.NewReader(body))
+		req.Header.Set(queue.ProtocolHeader, "2")
+		w := httptest.NewRecorder()
+		if err = h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, http.StatusOK, w.Code, w.Body.String())
+		}
+		got, err := srv.loadItem("req-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Progress != tt.progress || got.User != "alice" {
+			t.Fatalf("#%d: unexpected item %+v", i, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/golang/glog"
+)
+
+// DefaultHealthCheckInterval is the default interval to check worker health.
+const DefaultHealthCheckInterval = 15 * time.Second
+
+// WithHealthCheck configures the interval to probe the health endpoints
+// of registered workers (or check the freshness of their liveness reports),
+// and the sink to notify when a bucket has no healthy worker (nil to keep
+// the sink of 'WithNotifications'). Zero interval disables health checks.
+func WithHealthCheck(interval time.Duration, sink notify.Sink) ServerOpOption {
+	return func(op *ServerOp) {
+		op.healthInterval = interval
+		if sink != nil {
+			op.notifier = sink
+		}
+	}
+}
+
+// runHealthCheck checks worker health every interval until the server stops.
+func (srv *Server) runHealthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case <-ticker.C:
+		}
+		srv.checkWorkers(srv.rootCtx, interval)
+	}
+}
+
+// checkWorkers updates the health of registered workers, and notifies
+// when the healthy worker count for a bucket drops to zero or recovers.
+// Draining workers are not counted.
+// Workers without liveness reports for 3 intervals are unhealthy.
+func (srv *Server) checkWorkers(ctx context.Context, interval time.Duration) {
+	healthy := make(map[string]int)
+	for _, l := range srv.Workers() {
+		err := probeWorker(ctx, l, 3*interval)
+		l.Healthy, l.HealthError = err == nil, ""
+		if err != nil {
+			l.HealthError = err.Error()
+		}
+
+		old, ok := srv.workers.Load(l.ID)
+		if !ok {
+			// deregistered while probing
+			continue
+		}
+		ol := old.(workerproc.Liveness)
+		if ol.Healthy != l.Healthy {
+			if l.Healthy {
+				glog.Infof("worker %q is healthy", l.ID)
+			} else {
+				glog.Warningf("worker %q is unhealthy (%v)", l.ID, err)
+			}
+		}
+		// keep the latest report, only updating the health
+		ol.Healthy, ol.HealthError = l.Healthy, l.HealthError
+		srv.workers.Store(l.ID, ol)
+
+		for _, b := range l.Buckets {
+			if _, ok := healthy[b]; !ok {
+				healthy[b] = 0
+			}
+			// draining workers do not claim new jobs
+			if l.Healthy && !l.Draining {
+				healthy[b]++
+			}
+		}
+	}
+
+	srv.mu.Lock()
+	if srv.healthyBuckets == nil {
+		srv.healthyBuckets = make(map[string]bool)
+	}
+	var evs []notify.Event
+	for b, n := range healthy {
+		was, seen := srv.healthyBuckets[b]
+		srv.healthyBuckets[b] = n > 0
+		switch {
+		case n == 0 && (was || !seen):
+			evs = append(evs, notify.Event{
+				Type:    notify.EventNoHealthyWorkers,
+				Bucket:  b,
+				Message: fmt.Sprintf("no healthy worker for %q", b),
+				Time:    time.Now(),
+			})
+		case n > 0 && seen && !was:
+			evs = append(evs, notify.Event{
+				Type:    notify.EventWorkersRecovered,
+				Bucket:  b,
+				Message: fmt.Sprintf("%d healthy worker(s) for %q", n, b),
+				Time:    time.Now(),
+			})
+		}
+	}
+	srv.mu.Unlock()
+
+	for _, ev := range evs {
+		srv.sendNotification(ctx, ev)
+	}
+}
+
+// probeWorker returns an error if the worker is not alive, has no liveness
+// report within 'staleAfter', or its health endpoint does not return 200.
+func probeWorker(ctx context.Context, l workerproc.Liveness, staleAfter time.Duration) error {
+	if !l.Alive {
+		return fmt.Errorf("process is not alive (last exit %q)", l.LastExit)
+	}
+	if since := time.Since(l.UpdatedAt); since > staleAfter {
+		return fmt.Errorf("no liveness report for %v", since.Round(time.Second))
+	}
+	if l.HealthURL == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, l.HealthURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%q returned %q", l.HealthURL, resp.Status)
+	}
+	return nil
+}
+
+// workerUnhealthy returns true if the worker is registered and unhealthy.
+// Unknown workers (e.g. not reporting liveness) are not routed around.
+func (srv *Server) workerUnhealthy(id string) bool {
+	if id == "" {
+		return false
+	}
+	v, ok := srv.workers.Load(id)
+	return ok && !v.(workerproc.Liveness).Healthy
+}
+
+func (srv *Server) workerUnhealthyError(id string) *Error {
+	return NewError(http.StatusServiceUnavailable, ErrCodeWorkerUnhealthy, "worker %q is unhealthy; not routing jobs to it", id)
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestCheckWorkers(t *testing.T) {
+	healthy := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	var evs []notify.Event
+	srv := &Server{notifier: notify.SinkFunc(func(ctx context.Context, ev notify.Event) error {
+		evs = append(evs, ev)
+		return nil
+	})}
+	srv.workers.Store("w1", workerproc.Liveness{ID: "w1", Alive: true, Healthy: true, Buckets: []string{"/cats-request"}, HealthURL: ts.URL, UpdatedAt: time.Now()})
+	srv.workers.Store("w2", workerproc.Liveness{ID: "w2", Alive: true, Healthy: true, Buckets: []string{"/cats-request"}, UpdatedAt: time.Now().Add(-time.Minute)})
+
+	// w2 is stale
+	srv.checkWorkers(context.Background(), time.Second)
+	if srv.workerUnhealthy("w1") || !srv.workerUnhealthy("w2") || srv.workerUnhealthy("unknown") {
+		t.Fatalf("unexpected health %+v", srv.Workers())
+	}
+	if len(evs) != 0 {
+		t.Fatalf("unexpected events %+v", evs)
+	}
+
+	healthy = false
+	srv.checkWorkers(context.Background(), time.Second)
+	if !srv.workerUnhealthy("w1") {
+		t.Fatal("expected w1 to be unhealthy")
+	}
+	if len(evs) != 1 || evs[0].Type != notify.EventNoHealthyWorkers || evs[0].Bucket != "/cats-request" {
+		t.Fatalf("unexpected events %+v", evs)
+	}
+
+	// no more jobs to the unhealthy worker
+	h := with(ContextHandlerFunc(queueHandler), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+	req := httptest.NewRequest(http.MethodGet, "/cats-request/queue?worker_id=w1", nil)
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	// notify only on transitions
+	srv.checkWorkers(context.Background(), time.Second)
+	if len(evs) != 1 {
+		t.Fatalf("unexpected events %+v", evs)
+	}
+
+	healthy = true
+	srv.checkWorkers(context.Background(), time.Second)
+	if len(evs) != 2 || evs[1].Type != notify.EventWorkersRecovered {
+		t.Fatalf("unexpected events %+v", evs)
+	}
+
+	// draining workers do not claim new jobs
+	l, _ := srv.workers.Load("w1")
+	dl := l.(workerproc.Liveness)
+	dl.Draining = true
+	srv.workers.Store("w1", dl)
+	srv.checkWorkers(context.Background(), time.Second)
+	if srv.workerUnhealthy("w1") {
+		t.Fatal("expected draining w1 to be healthy")
+	}
+	if len(evs) != 3 || evs[2].Type != notify.EventNoHealthyWorkers {
+		t.Fatalf("unexpected events %+v", evs)
+	}
+}
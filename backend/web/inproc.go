@@ -0,0 +1,62 @@
+package web
+
+import (
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/inproc"
+
+	"github.com/golang/glog"
+)
+
+// runInProcess processes the items in the bucket with the in-process handler.
+// Items still go through the queue and the request cache, so that in-process
+// jobs are recorded the same way as the jobs of external workers.
+func (srv *Server) runInProcess(bucket string, h inproc.Handler) {
+	glog.Infof("started in-process handler for %q", bucket)
+	defer glog.Infof("stopped in-process handler for %q", bucket)
+
+	for {
+		item := <-srv.qu.Pop(srv.rootCtx, bucket)
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		default:
+		}
+		if item == nil {
+			glog.Warningf("queue watch on %q closed", bucket)
+			time.Sleep(time.Second)
+			continue
+		}
+		if item.Error != "" {
+			glog.Warning(item.Error)
+			time.Sleep(time.Second)
+			continue
+		}
+		srv.processInProcess(h, item)
+	}
+}
+
+func (srv *Server) processInProcess(h inproc.Handler, item *queue.Item) {
+	glog.Infof("in-process handler claimed %q (request ID %q)", item.Key, item.RequestID)
+	srv.jobClaimed(item)
+
+	copied := *item
+	if err := inproc.Run(srv.rootCtx, h, &copied); err != nil {
+		glog.Warningf("in-process handler failed on %q (%v)", item.RequestID, err)
+		copied.Error = err.Error()
+	}
+	copied.Progress = queue.MaxProgress
+
+	// do not store the item that has been canceled in the meantime
+	if _, ok := srv.requestCache.Load(item.RequestID); ok {
+		if _, ok = srv.storeItem(copied); !ok {
+			// the duplicate of the job completed first
+			return
+		}
+	}
+	srv.jobCompleted(&copied)
+	glog.Infof("in-process handler completed %q (request ID %q)", item.Key, item.RequestID)
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/inproc"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+// chanQueue implements queue.Queue with a channel, ignoring buckets.
+type chanQueue struct {
+	nopQueue
+	itemc chan *queue.Item
+}
+
+func (qu *chanQueue) Add(ctx context.Context, it *queue.Item, opts ...queue.OpOption) error {
+	qu.itemc <- it
+	return nil
+}
+
+func (qu *chanQueue) Pop(ctx context.Context, bucket string, opts ...queue.OpOption) queue.ItemWatcher {
+	return qu.itemc
+}
+
+func TestInProcess(t *testing.T) {
+	inproc.Register("/text-request", func(ctx context.Context, item *queue.Item) error {
+		item.Value = strings.ToLower(item.Value)
+		return nil
+	})
+	defer inproc.Unregister("/text-request")
+
+	rootCtx, rootCancel := context.WithCancel(context.Background())
+	defer rootCancel()
+	qu := &chanQueue{nopQueue: nopQueue{t: t}, itemc: make(chan *queue.Item, 1)}
+	srv := &Server{rootCtx: rootCtx, rootCancel: rootCancel, qu: qu, donec: make(chan struct{})}
+	h, _ := inproc.Lookup("/text-request")
+	go srv.runInProcess("/text-request", h)
+
+	hd := with(ContextHandlerFunc(clientRequestHandler), srv, qu, lru.NewInMemory(imageCacheSize))
+	req := httptest.NewRequest(http.MethodPost, "/text-request", strings.NewReader(`{"data_from_frontend": "HELLO", "create_request": true}`))
+	w := httptest.NewRecorder()
+	if err := hd.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	var item queue.Item
+	if err := json.NewDecoder(w.Body).Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		it, err := srv.loadItem(item.RequestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Progress == queue.MaxProgress {
+			if it.Value != "hello" || it.Error != "" {
+				t.Fatalf("unexpected item %+v", it)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("took too long to process %+v", it)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
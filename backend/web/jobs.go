@@ -0,0 +1,184 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/audit"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+)
+
+// JobsRequest defines requests to the admin jobs endpoint.
+type JobsRequest struct {
+	RequestID string `json:"request_id"`
+	Cancel    bool   `json:"cancel"`
+}
+
+// Backup is the snapshot of the jobs not completed, to restore the queue
+// on another backend (e.g. after migrating the etcd cluster).
+type Backup struct {
+	CreatedAt time.Time    `json:"created_at"`
+	Jobs      []queue.Item `json:"jobs"`
+}
+
+// RestoreResult is the number of the jobs restored from the backup,
+// and skipped as already known to the backend.
+type RestoreResult struct {
+	Restored int `json:"restored"`
+	Skipped  int `json:"skipped"`
+}
+
+// Jobs returns the jobs of the requests known to the backend, sorted by
+// creation time. Empty bucket returns the jobs of all buckets.
+func (srv *Server) Jobs(bucket string, activeOnly bool) []queue.Item {
+	var items []queue.Item
+	srv.requestCache.Range(func(k, v interface{}) bool {
+		item, err := srv.loadItem(k.(string))
+		if err != nil {
+			return true
+		}
+		if bucket != "" && item.Bucket != bucket {
+			return true
+		}
+		if activeOnly && (item.Progress == queue.MaxProgress || item.Canceled) {
+			return true
+		}
+		items = append(items, item)
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return items
+}
+
+// CancelJob marks the job canceled. The worker stops the job on its
+// next progress report, and log streams of the job are closed.
+func (srv *Server) CancelJob(requestID string) (queue.Item, *Error) {
+	item, err := srv.loadItem(requestID)
+	if err != nil {
+		return queue.Item{}, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", requestID).WithRequestID(requestID)
+	}
+	if item.Progress == queue.MaxProgress {
+		return item, NewError(http.StatusConflict, ErrCodeConflict, "request %q is already completed", requestID).WithRequestID(requestID)
+	}
+	if item.Canceled {
+		return item, nil
+	}
+	item.Canceled = true
+	stored, _ := srv.storeItem(item)
+	glog.Infof("canceled %q", requestID)
+	return stored, nil
+}
+
+// Restore adds the jobs of the backup to the queue from the start,
+// skipping the jobs already known to the backend.
+func (srv *Server) Restore(ctx context.Context, qu queue.Queue, b Backup) (RestoreResult, error) {
+	var ret RestoreResult
+	for _, item := range b.Jobs {
+		if _, err := srv.loadItem(item.RequestID); err == nil {
+			ret.Skipped++
+			continue
+		}
+		item.Progress, item.StageProgress = 0, nil
+		item.Requeue, item.TimedOut = false, false
+		if err := qu.Add(ctx, &item, queue.WithTTL(enqueueTTL)); err != nil {
+			return ret, err
+		}
+		copied := item
+		srv.requestCache.Store(item.RequestID, &copied)
+		srv.emitJobEvent(JobEnqueued, &copied)
+		ret.Restored++
+	}
+	glog.Infof("restored %d job(s) from backup at %s (skipped %d)", ret.Restored, b.CreatedAt, ret.Skipped)
+	return ret, nil
+}
+
+// jobsHandler lists the jobs on GET (with "bucket" and "active" queries),
+// and cancels the job on POST.
+func jobsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		q := req.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Jobs(q.Get("bucket"), q.Get("active") == "true"))
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var jreq JobsRequest
+		if err = json.Unmarshal(rb, &jreq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		item, err := srv.loadItem(jreq.RequestID)
+		if err != nil {
+			if jreq.Cancel {
+				srv.auditRequest(ctx, req, "job.cancel", jreq.RequestID, audit.OutcomeFailure, "unknown request ID")
+			}
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", jreq.RequestID).WithRequestID(jreq.RequestID))
+		}
+		if jreq.Cancel {
+			var aerr *Error
+			if item, aerr = srv.CancelJob(jreq.RequestID); aerr != nil {
+				srv.auditRequest(ctx, req, "job.cancel", jreq.RequestID, auditOutcome(aerr.Status), aerr.Message)
+				return writeError(w, aerr)
+			}
+			srv.auditRequest(ctx, req, "job.cancel", jreq.RequestID, audit.OutcomeSuccess, "")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&item)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// backupHandler returns the backup of the jobs not completed on GET,
+// and restores the backup on POST.
+func backupHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(Backup{CreatedAt: time.Now(), Jobs: srv.Jobs("", true)})
+
+	case http.MethodPost:
+		var b Backup
+		if err := json.NewDecoder(req.Body).Decode(&b); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+		for _, item := range b.Jobs {
+			if item.Bucket == "" || item.Key == "" || item.RequestID == "" {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid job in backup: %+v", item))
+			}
+		}
+
+		ret, err := srv.Restore(ctx, qu, b)
+		if err != nil {
+			glog.Warning(err)
+			return writeError(w, QueueError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(ret)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
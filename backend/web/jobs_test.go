@@ -0,0 +1,126 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestJobs(t *testing.T) {
+	srv := &Server{}
+	qu := &nopQueue{t: t}
+	cache := lru.NewInMemory(imageCacheSize)
+	h := with(withValidation(ContextHandlerFunc(jobsHandler), jobsSchemas), srv, qu, cache)
+
+	done := queue.CreateItem("/cats-request", 100, "done")
+	done.RequestID, done.Progress = "done-id", queue.MaxProgress
+	running := queue.CreateItem("/cats-request", 100, "running")
+	running.RequestID, running.Progress = "running-id", 50
+	running.CreatedAt = done.CreatedAt.Add(time.Second)
+	srv.requestCache.Store(done.RequestID, done)
+	srv.requestCache.Store(running.RequestID, running)
+
+	list := func(query string) []queue.Item {
+		req := httptest.NewRequest(http.MethodGet, "/admin/jobs"+query, nil)
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		var items []queue.Item
+		if err := json.NewDecoder(w.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+	if items := list(""); len(items) != 2 || items[0].RequestID != "done-id" || items[1].RequestID != "running-id" {
+		t.Fatalf("unexpected jobs %+v", items)
+	}
+	if items := list("?active=true"); len(items) != 1 || items[0].RequestID != "running-id" {
+		t.Fatalf("unexpected active jobs %+v", items)
+	}
+	if items := list("?bucket=/other"); len(items) != 0 {
+		t.Fatalf("unexpected jobs %+v", items)
+	}
+
+	cancel := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/jobs", strings.NewReader(`{"request_id": "`+id+`", "cancel": true}`))
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	if w := cancel("running-id"); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if item, _ := srv.loadItem("running-id"); !item.Canceled {
+		t.Fatalf("expected canceled, got %+v", item)
+	}
+	if w := cancel("done-id"); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := cancel("unknown-id"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	srv := &Server{}
+	cache := lru.NewInMemory(imageCacheSize)
+
+	running := queue.CreateItem("/cats-request", 100, "running")
+	running.RequestID, running.Progress = "running-id", 50
+	done := queue.CreateItem("/cats-request", 100, "done")
+	done.RequestID, done.Progress = "done-id", queue.MaxProgress
+	srv.requestCache.Store(running.RequestID, running)
+	srv.requestCache.Store(done.RequestID, done)
+
+	h := with(ContextHandlerFunc(backupHandler), srv, &nopQueue{t: t}, cache)
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, httptest.NewRequest(http.MethodGet, "/admin/backup", nil)); err != nil {
+		t.Fatal(err)
+	}
+	backup := w.Body.String()
+	var b Backup
+	if err := json.Unmarshal([]byte(backup), &b); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Jobs) != 1 || b.Jobs[0].RequestID != "running-id" {
+		t.Fatalf("unexpected backup %+v", b)
+	}
+
+	// restore on the new backend
+	srv = &Server{}
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	h = with(ContextHandlerFunc(backupHandler), srv, qu, cache)
+	restore := func() RestoreResult {
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, httptest.NewRequest(http.MethodPost, "/admin/backup", strings.NewReader(backup))); err != nil {
+			t.Fatal(err)
+		}
+		var ret RestoreResult
+		if err := json.NewDecoder(w.Body).Decode(&ret); err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	if ret := restore(); ret.Restored != 1 || ret.Skipped != 0 {
+		t.Fatalf("unexpected restore %+v", ret)
+	}
+	if len(qu.added) != 1 || qu.added[0].Key != running.Key || qu.added[0].Progress != 0 {
+		t.Fatalf("unexpected added items %+v", qu.added)
+	}
+	if _, err := srv.loadItem("running-id"); err != nil {
+		t.Fatal(err)
+	}
+	if ret := restore(); ret.Restored != 0 || ret.Skipped != 1 {
+		t.Fatalf("unexpected restore %+v", ret)
+	}
+}
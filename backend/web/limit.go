@@ -0,0 +1,63 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+type concurrencyLimit struct {
+	n       int
+	methods []string
+}
+
+// WithConcurrencyLimit limits the number of concurrent in-flight requests
+// on the route. Requests beyond the limit are rejected with 503.
+// If methods are given, only the requests with those methods are limited.
+// Zero or negative 'n' disables the limit.
+func WithConcurrencyLimit(route string, n int, methods ...string) ServerOpOption {
+	return func(op *ServerOp) {
+		if op.limits == nil {
+			op.limits = make(map[string]concurrencyLimit)
+		}
+		op.limits[route] = concurrencyLimit{n: n, methods: methods}
+	}
+}
+
+// DefaultMaxConcurrentSubmissions is the default limit of concurrent
+// job submissions, to keep memory bounded while fetching images.
+const DefaultMaxConcurrentSubmissions = 8
+
+// withConcurrencyLimit wraps the handler with a semaphore,
+// returning 503 if there are already 'n' requests in flight.
+func withConcurrencyLimit(h ContextHandler, route string, lim concurrencyLimit) ContextHandler {
+	if lim.n <= 0 {
+		return h
+	}
+	sema := make(chan struct{}, lim.n)
+	return ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		if len(lim.methods) > 0 {
+			limited := false
+			for _, m := range lim.methods {
+				if req.Method == m {
+					limited = true
+					break
+				}
+			}
+			if !limited {
+				return h.ServeHTTPContext(ctx, w, req)
+			}
+		}
+
+		select {
+		case sema <- struct{}{}:
+		default:
+			glog.Warningf("rejected %s %q (%d requests in flight)", req.Method, route, lim.n)
+			return writeError(w, NewError(http.StatusServiceUnavailable, ErrCodeOverloaded, "too many concurrent requests on %q (limit %d); please retry later", route, lim.n))
+		}
+		defer func() { <-sema }()
+
+		return h.ServeHTTPContext(ctx, w, req)
+	})
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	startc, releasec := make(chan struct{}), make(chan struct{})
+	h := withConcurrencyLimit(ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		if req.Method == http.MethodPost {
+			startc <- struct{}{}
+			<-releasec
+		}
+		return nil
+	}), "/test", concurrencyLimit{n: 2, methods: []string{http.MethodPost}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTPContext(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/test", nil))
+		}()
+		<-startc
+	}
+
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, httptest.NewRequest(http.MethodPost, "/test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	// methods not in the limit are not rejected
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, httptest.NewRequest(http.MethodGet, "/test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	close(releasec)
+	wg.Wait()
+
+	// slots are released after requests finish
+	go func() { <-startc }()
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, httptest.NewRequest(http.MethodPost, "/test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+)
+
+// logsTTL expires the log lines with the request.
+const logsTTL = enqueueTTL
+
+// LogsRequest defines log lines from workers.
+type LogsRequest struct {
+	RequestID string   `json:"request_id"`
+	Lines     []string `json:"lines"`
+}
+
+// logsHandler appends log lines from workers on POST, and streams log lines
+// of the request to the frontend on GET, as server-sent events:
+//
+//	id: <revision>
+//	data: {"rev":<revision>,"line":"loading model","time":"..."}
+//
+// with the "done" event when the job is completed.
+func logsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		requestID := req.URL.Query().Get("request_id")
+		if requestID == "" {
+			requestID = req.Header.Get(RequestIDHeader)
+		}
+		item, err := srv.loadItem(requestID)
+		if err != nil {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", requestID).WithRequestID(requestID))
+		}
+		// resume with the last event ID on reconnect
+		var fromRev int64
+		if v := req.Header.Get("Last-Event-ID"); v != "" {
+			if rev, err := strconv.ParseInt(v, 10, 64); err == nil {
+				fromRev = rev + 1
+			}
+		}
+		return srv.streamLogs(ctx, w, req, qu, item, fromRev)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var lr LogsRequest
+		if err = json.Unmarshal(rb, &lr); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		item, err := srv.loadItem(lr.RequestID)
+		if err != nil {
+			return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown request ID %q", lr.RequestID).WithRequestID(lr.RequestID))
+		}
+		if err = qu.AppendLog(ctx, item.Key, lr.Lines, queue.WithTTL(logsTTL)); err != nil {
+			glog.Warning(err)
+			return writeError(w, QueueError(err).WithRequestID(lr.RequestID))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&lr)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// logsDonePollInterval is the interval to check the job completion while streaming.
+var logsDonePollInterval = time.Second
+
+func (srv *Server) streamLogs(ctx context.Context, w http.ResponseWriter, req *http.Request, qu queue.Queue, item queue.Item, fromRev int64) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return writeError(w, NewError(http.StatusInternalServerError, ErrCodeInternal, "streaming not supported"))
+	}
+
+	// stop streaming when the client disconnects
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-req.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(logsDonePollInterval)
+	defer ticker.Stop()
+
+	write := func(ll *queue.LogLine) error {
+		data, err := json.Marshal(ll)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ll.Rev, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	wch := qu.WatchLogs(ctx, item.Key, fromRev)
+	for {
+		select {
+		case ll, ok := <-wch:
+			if !ok {
+				return nil
+			}
+			if ll.Error != "" {
+				glog.Warning(ll.Error)
+				return nil
+			}
+			if err := write(ll); err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			cur, err := srv.loadItem(item.RequestID)
+			if err != nil || cur.Progress == queue.MaxProgress || cur.Canceled {
+				// flush the lines already received
+				for drained := false; !drained; {
+					select {
+					case ll, ok := <-wch:
+						if !ok || ll.Error != "" {
+							drained = true
+						} else if err = write(ll); err != nil {
+							return err
+						}
+					default:
+						drained = true
+					}
+				}
+				fmt.Fprint(w, "event: done\ndata: {}\n\n")
+				flusher.Flush()
+				return nil
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+// logQueue stores log lines in memory.
+type logQueue struct {
+	nopQueue
+
+	mu    sync.Mutex
+	lines []*queue.LogLine
+}
+
+func (qu *logQueue) AppendLog(ctx context.Context, key string, lines []string, opts ...queue.OpOption) error {
+	qu.mu.Lock()
+	defer qu.mu.Unlock()
+	for _, l := range lines {
+		qu.lines = append(qu.lines, &queue.LogLine{Rev: int64(len(qu.lines) + 1), Line: l})
+	}
+	return nil
+}
+
+func (qu *logQueue) WatchLogs(ctx context.Context, key string, fromRev int64) queue.LogWatcher {
+	qu.mu.Lock()
+	defer qu.mu.Unlock()
+	ch := make(chan *queue.LogLine, len(qu.lines))
+	for _, ll := range qu.lines {
+		if ll.Rev >= fromRev {
+			ch <- ll
+		}
+	}
+	return ch
+}
+
+func TestLogs(t *testing.T) {
+	old := logsDonePollInterval
+	logsDonePollInterval = 10 * time.Millisecond
+	defer func() { logsDonePollInterval = old }()
+
+	srv := &Server{}
+	qu := &logQueue{nopQueue: nopQueue{t: t}}
+	item := queue.CreateItem("/cats-request", 100, "https://example.com/cat.jpg")
+	item.RequestID = "test-id"
+	srv.requestCache.Store(item.RequestID, item)
+
+	ts := httptest.NewServer(&ContextAdapter{
+		ctx:     context.Background(),
+		route:   "/cats-request/logs",
+		handler: with(withValidation(ContextHandlerFunc(logsHandler), logsSchemas), srv, qu, lru.NewInMemory(imageCacheSize)),
+	})
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/cats-request/logs", "application/json", strings.NewReader(`{"request_id": "test-id", "lines": ["loading model", "loaded model"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = http.Post(ts.URL+"/cats-request/logs", "application/json", strings.NewReader(`{"request_id": "unknown", "lines": ["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// complete the job, to end the stream
+	done := *item
+	done.Progress = queue.MaxProgress
+	srv.requestCache.Store(item.RequestID, &done)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/cats-request/logs?request_id=test-id", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "loading model") {
+		t.Fatalf("expected resumed stream, got %q", string(b))
+	}
+	if !strings.Contains(string(b), "id: 2\ndata: {\"rev\":2,\"line\":\"loaded model\"") || !strings.HasSuffix(string(b), "event: done\ndata: {}\n\n") {
+		t.Fatalf("unexpected stream %q", string(b))
+	}
+}
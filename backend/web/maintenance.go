@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gyuho/dplearn/pkg/notify"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMaintenanceMessage is returned to clients while the server is in maintenance mode.
+const DefaultMaintenanceMessage = "dplearn is under maintenance; new requests are not accepted at the moment. Please try again later."
+
+// Status defines the server status returned on the status endpoint.
+type Status struct {
+	Maintenance bool   `json:"maintenance"`
+	Message     string `json:"message"`
+}
+
+// MaintenanceRequest defines requests to the admin maintenance endpoint.
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// SetMaintenance enables or disables the maintenance mode.
+// While enabled, new job submissions are rejected with 503,
+// while status fetches and worker requests continue to be served.
+// Empty message defaults to 'DefaultMaintenanceMessage'.
+func (srv *Server) SetMaintenance(enabled bool, msg string) {
+	if msg == "" {
+		msg = DefaultMaintenanceMessage
+	}
+	srv.mu.Lock()
+	srv.maintenanceMsg = msg
+	srv.mu.Unlock()
+
+	if enabled {
+		atomic.StoreInt32(&srv.maintenance, 1)
+		glog.Warningf("enabled maintenance mode (%q)", msg)
+		srv.notify(notify.Event{Type: notify.EventMaintenance, Message: fmt.Sprintf("enabled maintenance mode (%q)", msg)})
+	} else {
+		atomic.StoreInt32(&srv.maintenance, 0)
+		glog.Infof("disabled maintenance mode")
+		srv.notify(notify.Event{Type: notify.EventMaintenance, Message: "disabled maintenance mode"})
+	}
+}
+
+// InMaintenance returns true if the server is in maintenance mode.
+func (srv *Server) InMaintenance() bool {
+	return atomic.LoadInt32(&srv.maintenance) == 1
+}
+
+// Status returns the current server status.
+func (srv *Server) Status() Status {
+	st := Status{Maintenance: srv.InMaintenance()}
+	if st.Maintenance {
+		srv.mu.RLock()
+		st.Message = srv.maintenanceMsg
+		srv.mu.RUnlock()
+	}
+	return st
+}
+
+// maintenanceError returns 503 error with the maintenance message.
+func (srv *Server) maintenanceError() *Error {
+	return NewError(http.StatusServiceUnavailable, ErrCodeMaintenance, "%s", srv.Status().Message)
+}
+
+func statusHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Status())
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+func maintenanceHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Status())
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var mreq MaintenanceRequest
+		if err = json.Unmarshal(rb, &mreq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		srv.SetMaintenance(mreq.Enabled, mreq.Message)
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Status())
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// nopQueue implements queue.Queue without etcd, failing the test on Add.
+type nopQueue struct {
+	t *testing.T
+}
+
+func (qu *nopQueue) Add(ctx context.Context, it *queue.Item, opts ...queue.OpOption) error {
+	qu.t.Fatalf("unexpected Add %+v", it)
+	return nil
+}
+func (qu *nopQueue) Pop(ctx context.Context, bucket string, opts ...queue.OpOption) queue.ItemWatcher {
+	return nil
+}
+func (qu *nopQueue) TryPop(ctx context.Context, bucket string, opts ...queue.OpOption) (*queue.Item, error) {
+	return nil, nil
+}
+func (qu *nopQueue) Depth(ctx context.Context, bucket string) (int64, error) { return 0, nil }
+func (qu *nopQueue) AppendLog(ctx context.Context, key string, lines []string, opts ...queue.OpOption) error {
+	return nil
+}
+func (qu *nopQueue) WatchLogs(ctx context.Context, key string, fromRev int64) queue.LogWatcher {
+	return nil
+}
+func (qu *nopQueue) Stop()                     {}
+func (qu *nopQueue) Client() *clientv3.Client  { return nil }
+func (qu *nopQueue) ClientEndpoints() []string { return nil }
+
+func TestMaintenance(t *testing.T) {
+	srv := &Server{}
+	qu := &nopQueue{t: t}
+	cache := lru.NewInMemory(imageCacheSize)
+
+	srv.SetMaintenance(true, "")
+	if !srv.InMaintenance() {
+		t.Fatal("expected maintenance mode")
+	}
+
+	h := with(ContextHandlerFunc(clientRequestHandler), srv, qu, cache)
+	req := httptest.NewRequest(http.MethodPost, "/cats-request", strings.NewReader(`{"data_from_frontend": "https://example.com/cat.jpg", "create_request": true}`))
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var aerr Error
+	if err := json.NewDecoder(w.Body).Decode(&aerr); err != nil {
+		t.Fatal(err)
+	}
+	if aerr.Code != ErrCodeMaintenance || aerr.Message != DefaultMaintenanceMessage || !aerr.Retryable {
+		t.Fatalf("unexpected error %+v", aerr)
+	}
+
+	// status fetches continue in maintenance mode
+	srv.requestCache.Store("test-request-id", queue.CreateItem("/cats-request", 100, "test"))
+	req = httptest.NewRequest(http.MethodGet, "/cats-request", nil)
+	req.Header.Set(RequestIDHeader, "test-request-id")
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	h = with(ContextHandlerFunc(maintenanceHandler), srv, qu, cache)
+	req = httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader(`{"enabled": false}`))
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if srv.InMaintenance() {
+		t.Fatal("expected maintenance mode disabled")
+	}
+
+	h = with(ContextHandlerFunc(statusHandler), srv, qu, cache)
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	var st Status
+	if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Maintenance || st.Message != "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
@@ -0,0 +1,208 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/inproc"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMetricsInterval is the default interval to export metrics.
+// Monitoring backends (e.g. Cloud Monitoring) reject points of the
+// same time series written more often than every few seconds.
+const DefaultMetricsInterval = time.Minute
+
+// Metrics is the snapshot of the key server metrics, exported to
+// monitoring backends (e.g. Cloud Monitoring) to alert on.
+type Metrics struct {
+	Time time.Time
+	// Interval is the duration since the last snapshot,
+	// over which the rates and latencies are computed.
+	Interval time.Duration
+
+	// QueueDepth is the number of jobs waiting, per bucket.
+	QueueDepth map[string]int64
+	// Workers is the number of healthy workers serving each bucket,
+	// excluding draining workers.
+	Workers map[string]int
+
+	// JobsCompleted is the number of jobs completed in the interval,
+	// and JobLatency their mean duration from enqueue to completion,
+	// per bucket.
+	JobsCompleted map[string]int
+	JobLatency    map[string]time.Duration
+
+	// HTTPRequests is the number of HTTP requests served in the interval,
+	// and HTTPErrors the number of those failed with server errors.
+	HTTPRequests int64
+	HTTPErrors   int64
+}
+
+// HTTPErrorRate returns the ratio of the failed HTTP requests in the interval.
+func (m Metrics) HTTPErrorRate() float64 {
+	if m.HTTPRequests == 0 {
+		return 0
+	}
+	return float64(m.HTTPErrors) / float64(m.HTTPRequests)
+}
+
+// MetricsSink exports the metrics (e.g. to Cloud Monitoring).
+type MetricsSink interface {
+	ExportMetrics(ctx context.Context, m Metrics) error
+}
+
+// MetricsSinkFunc adapts a function to MetricsSink.
+type MetricsSinkFunc func(ctx context.Context, m Metrics) error
+
+// ExportMetrics calls f(ctx, m).
+func (f MetricsSinkFunc) ExportMetrics(ctx context.Context, m Metrics) error {
+	return f(ctx, m)
+}
+
+// WithMetricsExporter configures the sink to export the metrics to every
+// interval. Zero interval defaults to 'DefaultMetricsInterval'.
+func WithMetricsExporter(sink MetricsSink, interval time.Duration) ServerOpOption {
+	return func(op *ServerOp) {
+		op.metricsSink = sink
+		op.metricsInterval = interval
+	}
+}
+
+// metricsRecorder accumulates the job and HTTP metrics between snapshots.
+type metricsRecorder struct {
+	mu           sync.Mutex
+	last         time.Time
+	completed    map[string]int
+	latencies    map[string]time.Duration
+	httpRequests int64
+	httpErrors   int64
+}
+
+func newMetricsRecorder(now time.Time) *metricsRecorder {
+	return &metricsRecorder{
+		last:      now,
+		completed: make(map[string]int),
+		latencies: make(map[string]time.Duration),
+	}
+}
+
+func (r *metricsRecorder) jobCompleted(item *queue.Item, now time.Time) {
+	if r == nil || item.CreatedAt.IsZero() {
+		return
+	}
+	r.mu.Lock()
+	r.completed[item.Bucket]++
+	r.latencies[item.Bucket] += now.Sub(item.CreatedAt)
+	r.mu.Unlock()
+}
+
+func (r *metricsRecorder) request(code int, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.httpRequests++
+	if err != nil || code >= http.StatusInternalServerError {
+		r.httpErrors++
+	}
+	r.mu.Unlock()
+}
+
+// reset returns the metrics accumulated since the last reset.
+func (r *metricsRecorder) reset(now time.Time) Metrics {
+	if r == nil {
+		return Metrics{Time: now}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := Metrics{
+		Time:          now,
+		Interval:      now.Sub(r.last),
+		JobsCompleted: r.completed,
+		JobLatency:    make(map[string]time.Duration, len(r.latencies)),
+		HTTPRequests:  r.httpRequests,
+		HTTPErrors:    r.httpErrors,
+	}
+	for b, d := range r.latencies {
+		m.JobLatency[b] = d / time.Duration(r.completed[b])
+	}
+	r.last = now
+	r.completed = make(map[string]int)
+	r.latencies = make(map[string]time.Duration)
+	r.httpRequests, r.httpErrors = 0, 0
+	return m
+}
+
+// metricsBuckets returns the buckets to report: the request routes, and
+// the buckets of the registered workers.
+func (srv *Server) metricsBuckets() []string {
+	seen := make(map[string]bool)
+	for b := range routeJobTypes {
+		seen[b] = true
+	}
+	for _, b := range inproc.Buckets() {
+		seen[b] = true
+	}
+	for _, l := range srv.Workers() {
+		for _, b := range l.Buckets {
+			seen[b] = true
+		}
+	}
+	bs := make([]string, 0, len(seen))
+	for b := range seen {
+		bs = append(bs, b)
+	}
+	sort.Strings(bs)
+	return bs
+}
+
+// Metrics returns the metrics since the last call, with the current
+// queue depths and worker counts.
+func (srv *Server) Metrics(ctx context.Context) Metrics {
+	m := srv.metrics.reset(time.Now())
+	m.QueueDepth = make(map[string]int64)
+	m.Workers = make(map[string]int)
+	for _, b := range srv.metricsBuckets() {
+		n, err := srv.qu.Depth(ctx, b)
+		if err != nil {
+			glog.Warningf("failed to get queue depth of %q (%v)", b, err)
+			continue
+		}
+		m.QueueDepth[b] = n
+		m.Workers[b] = 0
+	}
+	for _, l := range srv.Workers() {
+		if !l.Healthy || l.Draining {
+			continue
+		}
+		for _, b := range l.Buckets {
+			m.Workers[b]++
+		}
+	}
+	return m
+}
+
+// runMetrics exports the metrics every interval until the server stops.
+func (srv *Server) runMetrics(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case <-ticker.C:
+		}
+		if err := srv.metricsSink.ExportMetrics(srv.rootCtx, srv.Metrics(srv.rootCtx)); err != nil {
+			glog.Warningf("failed to export metrics (%v)", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestMetrics(t *testing.T) {
+	start := time.Now()
+	srv := &Server{qu: &nopQueue{t: t}, metrics: newMetricsRecorder(start)}
+	srv.workers.Store("w1", workerproc.Liveness{ID: "w1", Healthy: true, Buckets: []string{"/cats-request"}, UpdatedAt: start})
+	srv.workers.Store("w2", workerproc.Liveness{ID: "w2", Healthy: true, Draining: true, Buckets: []string{"/cats-request"}, UpdatedAt: start})
+	srv.workers.Store("w3", workerproc.Liveness{ID: "w3", Buckets: []string{"/dogs-request"}, UpdatedAt: start})
+
+	for _, d := range []time.Duration{time.Second, 3 * time.Second} {
+		item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+		item.CreatedAt = start
+		srv.metrics.jobCompleted(item, start.Add(d))
+	}
+	srv.metrics.request(http.StatusOK, nil)
+	srv.metrics.request(http.StatusNotFound, nil)
+	srv.metrics.request(http.StatusServiceUnavailable, nil)
+	srv.metrics.request(http.StatusOK, errors.New("broken pipe"))
+
+	m := srv.Metrics(context.Background())
+	if m.JobsCompleted["/cats-request"] != 2 || m.JobLatency["/cats-request"] != 2*time.Second {
+		t.Fatalf("unexpected job metrics %v, %v", m.JobsCompleted, m.JobLatency)
+	}
+	if m.HTTPRequests != 4 || m.HTTPErrors != 2 || m.HTTPErrorRate() != 0.5 {
+		t.Fatalf("unexpected HTTP metrics %d/%d", m.HTTPErrors, m.HTTPRequests)
+	}
+	if m.Workers["/cats-request"] != 1 || m.Workers["/dogs-request"] != 0 {
+		t.Fatalf("unexpected worker counts %v", m.Workers)
+	}
+	if _, ok := m.QueueDepth["/dogs-request"]; !ok {
+		t.Fatalf("expected queue depth of worker buckets, got %v", m.QueueDepth)
+	}
+
+	// rates and latencies are reset
+	m = srv.Metrics(context.Background())
+	if len(m.JobsCompleted) != 0 || m.HTTPRequests != 0 {
+		t.Fatalf("expected reset metrics, got %+v", m)
+	}
+}
@@ -0,0 +1,227 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/registry"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultModelWait is the default duration of the long poll
+	// for the serving model version at "/models/serving".
+	DefaultModelWait = 30 * time.Second
+
+	maxModelWait = 5 * time.Minute
+)
+
+// WithModelRegistry enables the model registry, with the model metadata in
+// the etcd cluster of the queue and the artifacts in the blob store (nil to
+// use the upload blob store). The admin API at "/admin/models" registers and
+// promotes the model versions, and workers watch the serving version at
+// "/models/serving" to reload the model.
+func WithModelRegistry(store blobstore.Store, cfg registry.Config) ServerOpOption {
+	return func(op *ServerOp) {
+		op.modelStore = store
+		op.modelRegistry = &cfg
+	}
+}
+
+// ModelsRequest defines requests to the admin models endpoint. The version
+// is registered if not yet, and promoted to serving if 'Promote' is true.
+type ModelsRequest struct {
+	registry.Model
+	Promote bool `json:"promote"`
+}
+
+// ModelsStatus defines the response of the admin models endpoint.
+type ModelsStatus struct {
+	Models []registry.Model `json:"models"`
+	// Serving maps the model names to the serving versions.
+	Serving map[string]string `json:"serving"`
+}
+
+// ArtifactResponse defines the response of the artifact upload.
+type ArtifactResponse struct {
+	ArtifactURI string `json:"artifact_uri"`
+}
+
+// RegistryError converts the model registry errors to *Error.
+func RegistryError(err error) *Error {
+	switch err {
+	case registry.ErrNotFound:
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	case registry.ErrExists:
+		return NewError(http.StatusConflict, ErrCodeConflict, "%v", err)
+	case registry.ErrInvalidModel:
+		return NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	}
+	return QueueError(err)
+}
+
+func modelsDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "model registry is not enabled"))
+}
+
+// modelsHandler lists the model versions on GET (with "name" query),
+// and registers or promotes the model version on POST.
+func modelsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.models == nil {
+		return modelsDisabled(w)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		ms, err := srv.models.List(ctx, req.URL.Query().Get("name"))
+		if err != nil {
+			return writeError(w, RegistryError(err))
+		}
+		st := ModelsStatus{Models: ms, Serving: make(map[string]string)}
+		for name, m := range srv.models.Serving() {
+			st.Serving[name] = m.Version
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(st)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var mreq ModelsRequest
+		if err = json.Unmarshal(rb, &mreq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+
+		// only promotes the registered version, without the metadata
+		m := mreq.Model
+		if m.Framework != "" || m.ArtifactURI != "" {
+			if m, err = srv.models.Register(ctx, m); err != nil {
+				return writeError(w, RegistryError(err))
+			}
+		} else if !mreq.Promote {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "model %s/%s requires framework and artifact_uri to register", m.Name, m.Version))
+		}
+		if mreq.Promote {
+			if m, err = srv.models.Promote(ctx, m.Name, m.Version); err != nil {
+				return writeError(w, RegistryError(err))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&m)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// modelArtifactHandler stores the request body as the artifact of the
+// model version on PUT (with "name" and "version" queries), to register
+// with the returned URI.
+func modelArtifactHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.models == nil {
+		return modelsDisabled(w)
+	}
+	if req.Method != http.MethodPut {
+		return methodNotAllowed(w, req)
+	}
+
+	q := req.URL.Query()
+	name, version := q.Get("name"), q.Get("version")
+	defer req.Body.Close()
+	uri, err := srv.models.PutArtifact(ctx, name, version, req.Body)
+	if err != nil {
+		glog.Warningf("failed to store artifact of %s/%s (%v)", name, version, err)
+		return writeError(w, RegistryError(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(ArtifactResponse{ArtifactURI: uri})
+}
+
+// modelDownloadHandler streams the artifact of the model version in the
+// registry blob store (with "name" and "version" queries), to the workers
+// reloading the serving version.
+func modelDownloadHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.models == nil {
+		return modelsDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+
+	q := req.URL.Query()
+	name, version := q.Get("name"), q.Get("version")
+	m, err := srv.models.Get(ctx, name, version)
+	if err != nil {
+		return writeError(w, RegistryError(err))
+	}
+	if !strings.HasPrefix(m.ArtifactURI, registry.ArtifactScheme) {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "artifact %q of %s/%s is not in the registry", m.ArtifactURI, name, version))
+	}
+	rc, err := srv.models.OpenArtifact(m.ArtifactURI)
+	if err != nil {
+		return writeError(w, RegistryError(err))
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// modelServingHandler returns the serving version of the model (with "name"
+// query) once it is not the "version" query, waiting up to the "wait"
+// duration. It returns 304 if the serving version did not change.
+func modelServingHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.models == nil {
+		return modelsDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+
+	q := req.URL.Query()
+	if q.Get("name") == "" {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "missing name"))
+	}
+	wait := DefaultModelWait
+	if v := q.Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > maxModelWait {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid wait %q (must be up to %v)", v, maxModelWait))
+		}
+		wait = d
+	}
+	wctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	go func() {
+		// stop waiting when the worker disconnects
+		select {
+		case <-req.Context().Done():
+			cancel()
+		case <-wctx.Done():
+		}
+	}()
+	m, err := srv.models.Wait(wctx, q.Get("name"), q.Get("version"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&m)
+}
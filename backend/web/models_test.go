@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/registry"
+)
+
+func TestModels(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 26379, 26380, filepath.Join(dataDir, "etcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+	store, err := blobstore.NewLocal(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{qu: qu, models: registry.New(qu.Client(), store, registry.Config{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.models.Run(ctx)
+
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandlerFunc, schemas Schemas, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := with(withValidation(h, schemas), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	w := serve(modelArtifactHandler, nil, http.MethodPut, "/admin/models/artifact?name=cats&version=v1", "weights-v1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	var ar ArtifactResponse
+	if err = json.NewDecoder(w.Body).Decode(&ar); err != nil {
+		t.Fatal(err)
+	}
+
+	if w = serve(modelsHandler, modelsSchemas, http.MethodPost, "/admin/models", `{"name": "cats", "version": "v1", "metrics": "high"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w = serve(modelsHandler, modelsSchemas, http.MethodPost, "/admin/models", `{"name": "cats", "version": "v1"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	body := `{"name": "cats", "version": "v1", "framework": "onnx", "metrics": {"accuracy": 0.9}, "artifact_uri": "` + ar.ArtifactURI + `", "promote": true}`
+	if w = serve(modelsHandler, modelsSchemas, http.MethodPost, "/admin/models", body); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w = serve(modelsHandler, modelsSchemas, http.MethodPost, "/admin/models", body); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w = serve(modelsHandler, modelsSchemas, http.MethodPost, "/admin/models", `{"name": "cats", "version": "v2", "promote": true}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var st ModelsStatus
+	if err = json.NewDecoder(serve(modelsHandler, modelsSchemas, http.MethodGet, "/admin/models?name=cats", "").Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Models) != 1 || st.Models[0].Metrics["accuracy"] != 0.9 || st.Serving["cats"] != "v1" {
+		t.Fatalf("unexpected models %+v", st)
+	}
+
+	// workers get the serving version, and its artifact
+	var m registry.Model
+	if err = json.NewDecoder(serve(modelServingHandler, nil, http.MethodGet, "/models/serving?name=cats&wait=5s", "").Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "v1" {
+		t.Fatalf("serving version expected 'v1', got %+v", m)
+	}
+	if w = serve(modelServingHandler, nil, http.MethodGet, "/models/serving?name=cats&version=v1&wait=10ms", ""); w.Code != http.StatusNotModified {
+		t.Fatalf("expected %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if w = serve(modelDownloadHandler, nil, http.MethodGet, "/models/artifact?name=cats&version=v1", ""); w.Body.String() != "weights-v1" {
+		t.Fatalf("artifact expected 'weights-v1', got %q", w.Body.String())
+	}
+	if w = serve(modelArtifactHandler, nil, http.MethodPut, "/admin/models/artifact?name=cats&version=v1", "overwrite"); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	srv.models = nil
+	if w = serve(modelsHandler, modelsSchemas, http.MethodGet, "/admin/models", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
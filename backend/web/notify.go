@@ -0,0 +1,49 @@
+package web
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/notify"
+
+	"github.com/golang/glog"
+)
+
+// notifyTimeout is the timeout to send the notification to the sink.
+const notifyTimeout = 10 * time.Second
+
+// WithNotifications sets the sink of the operational events of the jobs,
+// the worker registry, and the server (e.g. 'notify.Router' to route the
+// events by type). It replaces the sink of 'WithHealthCheck'.
+func WithNotifications(sink notify.Sink) ServerOpOption {
+	return func(op *ServerOp) { op.notifier = sink }
+}
+
+// sendNotification sends the event to the sink, logging the failures.
+func (srv *Server) sendNotification(ctx context.Context, ev notify.Event) {
+	if srv.notifier == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if err := srv.notifier.Notify(ctx, ev); err != nil {
+		glog.Warningf("failed to notify %q (%v)", ev.Type, err)
+	}
+}
+
+// notify sends the event in the background, so that the slow sinks
+// do not delay the requests of the clients and workers.
+func (srv *Server) notify(ev notify.Event) {
+	if srv.notifier == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(srv.rootCtx, notifyTimeout)
+		defer cancel()
+		srv.sendNotification(ctx, ev)
+	}()
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestNotifications(t *testing.T) {
+	evc := make(chan notify.Event, 10)
+	srv := &Server{
+		rootCtx:     context.Background(),
+		workerToken: "secret",
+		notifier: notify.SinkFunc(func(ctx context.Context, ev notify.Event) error {
+			evc <- ev
+			return nil
+		}),
+	}
+	next := func(typ string) notify.Event {
+		select {
+		case ev := <-evc:
+			if ev.Type != typ || ev.Time.IsZero() {
+				t.Fatalf("expected %q, got %+v", typ, ev)
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", typ)
+		}
+		return notify.Event{}
+	}
+
+	h := with(withValidation(ContextHandlerFunc(workersHandler), workersSchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+	for _, body := range []string{
+		`{"id": "host-cats-1", "name": "cats", "alive": true, "buckets": ["/cats-request"]}`,
+		// reports of the registered worker are not notified
+		`{"id": "host-cats-1", "name": "cats", "alive": true, "buckets": ["/cats-request"]}`,
+		`{"id": "host-cats-1", "name": "cats", "alive": false, "last_exit": "exit status 1", "buckets": ["/cats-request"]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(body))
+		req.Header.Set(workerproc.TokenHeader, "secret")
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	// sent in the background, not in order
+	evs := map[string]notify.Event{}
+	for len(evs) < 2 {
+		select {
+		case ev := <-evc:
+			evs[ev.Type] = ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for worker events, got %+v", evs)
+		}
+	}
+	if ev := evs[notify.EventWorkerRegistered]; ev.Worker != "host-cats-1" || ev.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if ev := evs[notify.EventWorkerExited]; ev.Worker != "host-cats-1" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	srv.SetMaintenance(true, "upgrade")
+	if ev := next(notify.EventMaintenance); !strings.Contains(ev.Message, "upgrade") {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	item := queue.CreateItem("/cats-request", 100, "cat.jpg")
+	item.RequestID = "req-1"
+	srv.storeItem(*item)
+	failed := *item
+	failed.Progress, failed.Error = queue.MaxProgress, "out of memory"
+	srv.storeItem(failed)
+	// the repeated reports of the failure are not notified
+	srv.storeItem(failed)
+	if ev := next(notify.EventJobFailed); ev.RequestID != "req-1" || ev.Bucket != "/cats-request" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	select {
+	case ev := <-evc:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/audit"
+	"github.com/gyuho/dplearn/pkg/autoscale"
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/coordinator"
+	"github.com/gyuho/dplearn/pkg/experiment"
+	"github.com/gyuho/dplearn/pkg/feature"
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/registry"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+	"github.com/gyuho/dplearn/pkg/usage"
+	"github.com/gyuho/dplearn/pkg/user"
+)
+
+// ServerOp configures the web server.
+type ServerOp struct {
+	limits map[string]concurrencyLimit
+	blobs  blobstore.Store
+
+	grpcAddr   string
+	autoscaler *autoscale.Autoscaler
+
+	workerToken string
+	gpuRoutes   map[string]bool
+	gpuFallback time.Duration
+
+	healthInterval time.Duration
+	notifier       notify.Sink
+
+	artifactSigner URLSigner
+	artifactURLTTL time.Duration
+
+	blobBackend    blobstore.Backend
+	backupInterval time.Duration
+
+	speculationPercentile float64
+	maxJobAttempts        int
+
+	canaryVersion string
+	canaryPercent int
+
+	coordinator *coordinator.Config
+
+	modelStore    blobstore.Store
+	modelRegistry *registry.Config
+
+	experiments *experiment.Config
+
+	pipelinesEnabled bool
+	pipelines        []pipeline.Definition
+
+	users         *user.Config
+	userTokens    user.Tokens
+	loginRequired bool
+	admins        []string
+
+	quotas *usage.Config
+
+	audit *audit.Config
+
+	scheduler *scheduler.Config
+
+	features *feature.Config
+
+	jobEvents JobEventSink
+
+	metricsSink     MetricsSink
+	metricsInterval time.Duration
+
+	diskDir      string
+	minDiskSpace uint64
+
+	shredUploads bool
+}
+
+// ServerOpOption configures the web server.
+type ServerOpOption func(*ServerOp)
+
+// WithBlobStore configures the blob store for resumable uploads.
+// Defaults to local file system under the temporary directory.
+func WithBlobStore(store blobstore.Store) ServerOpOption {
+	return func(op *ServerOp) { op.blobs = store }
+}
+
+func (op *ServerOp) applyOpts(opts []ServerOpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
@@ -0,0 +1,366 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// pipelineInterval is the interval to enqueue the steps whose retry
+	// backoff has passed.
+	pipelineInterval = time.Second
+
+	// pipelineRetention is the duration to keep the finished runs.
+	pipelineRetention = 24 * time.Hour
+)
+
+// WithPipelines enables the pipelines at "/pipelines": runs of the defined
+// pipelines (or of the definitions in the requests) enqueue their steps as
+// the dependencies complete, passing the job results to the dependents.
+func WithPipelines(defs ...pipeline.Definition) ServerOpOption {
+	return func(op *ServerOp) { op.pipelinesEnabled, op.pipelines = true, defs }
+}
+
+// PipelineRequest defines requests to start the run of the pipeline by
+// name (or of the definition), and to cancel the run by ID.
+type PipelineRequest struct {
+	Pipeline   string               `json:"pipeline,omitempty"`
+	Definition *pipeline.Definition `json:"definition,omitempty"`
+	Input      string               `json:"input,omitempty"`
+
+	ID     string `json:"id,omitempty"`
+	Cancel bool   `json:"cancel,omitempty"`
+}
+
+// pipelineStep is the step of the run, enqueued as the job.
+type pipelineStep struct {
+	runID string
+	step  string
+}
+
+// pipelines tracks the pipeline runs in memory.
+type pipelines struct {
+	mu    sync.Mutex
+	defs  map[string]pipeline.Definition
+	runs  map[string]*pipeline.Run
+	steps map[string]pipelineStep
+
+	// wakec triggers enqueuing the ready steps.
+	wakec chan struct{}
+}
+
+func newPipelines(defs []pipeline.Definition) (*pipelines, error) {
+	p := &pipelines{
+		defs:  make(map[string]pipeline.Definition, len(defs)),
+		runs:  make(map[string]*pipeline.Run),
+		steps: make(map[string]pipelineStep),
+		wakec: make(chan struct{}, 1),
+	}
+	for _, d := range defs {
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := p.defs[d.Name]; ok {
+			return nil, fmt.Errorf("duplicate pipeline %q", d.Name)
+		}
+		p.defs[d.Name] = d
+	}
+	return p, nil
+}
+
+func (p *pipelines) wake() {
+	select {
+	case p.wakec <- struct{}{}:
+	default:
+	}
+}
+
+// StartPipeline starts the run of the pipeline definition with the input,
+// enqueuing the steps without dependencies. The run and its jobs are of
+// the user of the request context, if any.
+func (srv *Server) StartPipeline(ctx context.Context, d pipeline.Definition, input string) (pipeline.Run, error) {
+	r, err := pipeline.NewRun("", d, input)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	r.User, _ = ctx.Value(accountKey).(string)
+	srv.pipelines.mu.Lock()
+	srv.pipelines.runs[r.ID] = r
+	srv.pipelines.mu.Unlock()
+	glog.Infof("started pipeline %q run %q", d.Name, r.ID)
+
+	srv.advancePipelines(ctx, time.Now())
+	return srv.Pipeline(r.ID)
+}
+
+// Pipeline returns the run of the ID.
+func (srv *Server) Pipeline(id string) (pipeline.Run, error) {
+	srv.pipelines.mu.Lock()
+	defer srv.pipelines.mu.Unlock()
+	r, ok := srv.pipelines.runs[id]
+	if !ok {
+		return pipeline.Run{}, fmt.Errorf("unknown pipeline run %q", id)
+	}
+	return r.Clone(), nil
+}
+
+// Pipelines returns the runs of the pipeline, sorted by creation time.
+// Empty name returns the runs of all pipelines.
+func (srv *Server) Pipelines(name string) []pipeline.Run {
+	srv.pipelines.mu.Lock()
+	rs := make([]pipeline.Run, 0, len(srv.pipelines.runs))
+	for _, r := range srv.pipelines.runs {
+		if name == "" || r.Definition.Name == name {
+			rs = append(rs, r.Clone())
+		}
+	}
+	srv.pipelines.mu.Unlock()
+	sort.Slice(rs, func(i, j int) bool { return rs[i].CreatedAt.Before(rs[j].CreatedAt) })
+	return rs
+}
+
+// CancelPipeline cancels the run, skipping the pending steps,
+// and canceling the jobs of the running steps.
+func (srv *Server) CancelPipeline(id string) (pipeline.Run, *Error) {
+	srv.pipelines.mu.Lock()
+	r, ok := srv.pipelines.runs[id]
+	if !ok {
+		srv.pipelines.mu.Unlock()
+		return pipeline.Run{}, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown pipeline run %q", id)
+	}
+	if r.Done() {
+		c := r.Clone()
+		srv.pipelines.mu.Unlock()
+		return c, NewError(http.StatusConflict, ErrCodeConflict, "pipeline run %q is already %s", id, c.Status)
+	}
+	requestIDs := r.Cancel(time.Now())
+	for _, requestID := range requestIDs {
+		delete(srv.pipelines.steps, requestID)
+	}
+	c := r.Clone()
+	srv.pipelines.mu.Unlock()
+
+	// cancel outside the lock, since the job updates call back
+	for _, requestID := range requestIDs {
+		if _, aerr := srv.CancelJob(requestID); aerr != nil {
+			glog.Warningf("failed to cancel %q of pipeline run %q (%v)", requestID, id, aerr)
+		}
+	}
+	glog.Infof("canceled pipeline run %q", id)
+	return c, nil
+}
+
+// pipelineJobDone records the result of the completed (or canceled) job
+// of the pipeline step, and wakes up the dependents.
+func (srv *Server) pipelineJobDone(item *queue.Item) {
+	srv.pipelines.mu.Lock()
+	defer srv.pipelines.mu.Unlock()
+	ps, ok := srv.pipelines.steps[item.RequestID]
+	if !ok {
+		return
+	}
+	delete(srv.pipelines.steps, item.RequestID)
+	r, ok := srv.pipelines.runs[ps.runID]
+	if !ok {
+		return
+	}
+
+	errMsg := item.Error
+	if item.Canceled && errMsg == "" {
+		errMsg = "canceled"
+	}
+	if r.Finished(ps.step, item.Value, errMsg, time.Now()) {
+		glog.Infof("retrying step %q of pipeline run %q (%s)", ps.step, r.ID, errMsg)
+	}
+	if r.Done() {
+		glog.Infof("pipeline run %q %s", r.ID, r.Status)
+	}
+	srv.pipelines.wake()
+}
+
+// advancePipelines enqueues the ready steps of the runs, counted against
+// the quota of the user of the run. Steps that fail to enqueue (or are
+// over the quota) stay pending until the next interval, and the steps
+// are held pending in maintenance mode.
+func (srv *Server) advancePipelines(ctx context.Context, now time.Time) {
+	if srv.InMaintenance() {
+		return
+	}
+	srv.pipelines.mu.Lock()
+	defer srv.pipelines.mu.Unlock()
+
+	for _, r := range srv.pipelines.runs {
+		for _, s := range r.Ready(now) {
+			value, err := r.Value(s)
+			if err != nil {
+				r.Started(s.Name, "", now)
+				r.Finished(s.Name, "", fmt.Sprintf("invalid value (%v)", err), now)
+				continue
+			}
+			item := queue.CreateItem(s.Bucket, 100, value)
+			item.RequestID = fmt.Sprintf("pipeline-%s-%s-%d", r.ID, s.Name, r.Steps[s.Name].Attempts+1)
+			item.JobType = s.JobType
+			item.User = r.User
+			if aerr := srv.startUsageFor(ctx, r.User, item.RequestID); aerr != nil {
+				glog.Warningf("held step %q of pipeline run %q (%v)", s.Name, r.ID, aerr)
+				continue
+			}
+			if err = srv.qu.Add(ctx, item, queue.WithTTL(enqueueTTL)); err != nil {
+				srv.abortUsage(item.RequestID)
+				glog.Warningf("failed to enqueue step %q of pipeline run %q (%v)", s.Name, r.ID, err)
+				continue
+			}
+			srv.requestCache.Store(item.RequestID, item)
+			srv.emitJobEvent(JobEnqueued, item)
+			r.Started(s.Name, item.RequestID, now)
+			srv.pipelines.steps[item.RequestID] = pipelineStep{runID: r.ID, step: s.Name}
+			glog.Infof("enqueued step %q of pipeline run %q (%q)", s.Name, r.ID, item.RequestID)
+		}
+	}
+}
+
+// prunePipelines removes the runs finished before the retention.
+func (srv *Server) prunePipelines(now time.Time) {
+	srv.pipelines.mu.Lock()
+	defer srv.pipelines.mu.Unlock()
+	for id, r := range srv.pipelines.runs {
+		if r.Done() && now.Sub(r.UpdatedAt) > pipelineRetention {
+			delete(srv.pipelines.runs, id)
+		}
+	}
+}
+
+// runPipelines enqueues the ready steps as the jobs complete, and every
+// interval for the retries, until the server stops.
+func (srv *Server) runPipelines(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case <-srv.pipelines.wakec:
+		case now := <-ticker.C:
+			srv.prunePipelines(now)
+		}
+		srv.advancePipelines(srv.rootCtx, time.Now())
+	}
+}
+
+func pipelinesDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "pipelines are not enabled"))
+}
+
+// pipelinesHandler lists the runs on GET (with "pipeline" query), or
+// returns the run (with "id" query), and starts or cancels the run on POST.
+// Only the admins start the runs of the definitions in the requests, and
+// with the user accounts, the users log in to start and cancel their runs.
+func pipelinesHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.pipelines == nil {
+		return pipelinesDisabled(w)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		q := req.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		if id := q.Get("id"); id != "" {
+			r, err := srv.Pipeline(id)
+			if err != nil {
+				return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err))
+			}
+			return json.NewEncoder(w).Encode(&r)
+		}
+		return json.NewEncoder(w).Encode(srv.Pipelines(q.Get("pipeline")))
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var preq PipelineRequest
+		if err = json.Unmarshal(rb, &preq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+
+		// with the user accounts, the runs are of the users
+		account, _ := ctx.Value(accountKey).(string)
+		if srv.users != nil && account == "" {
+			return writeError(w, NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "login required"))
+		}
+
+		var r pipeline.Run
+		switch {
+		case preq.Cancel:
+			if preq.ID == "" {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected pipeline run ID to cancel"))
+			}
+			if r, err = srv.Pipeline(preq.ID); err != nil {
+				return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err))
+			}
+			if r.User != account {
+				if aerr := srv.adminRequired(ctx, req); aerr != nil {
+					return writeError(w, NewError(http.StatusForbidden, ErrCodeForbidden, "pipeline run %q is not of the user", preq.ID))
+				}
+			}
+			var aerr *Error
+			if r, aerr = srv.CancelPipeline(preq.ID); aerr != nil {
+				return writeError(w, aerr)
+			}
+
+		default:
+			if srv.InMaintenance() {
+				glog.Warningf("rejected pipeline run on %q (maintenance mode)", req.URL.Path)
+				return writeError(w, srv.maintenanceError())
+			}
+			var d pipeline.Definition
+			switch {
+			case preq.Definition != nil && preq.Pipeline != "":
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected either pipeline name or definition"))
+			case preq.Definition != nil:
+				// the inline definitions enqueue to any bucket
+				if aerr := srv.adminRequired(ctx, req); aerr != nil {
+					glog.Warningf("refused pipeline definition from %q (%v)", req.RemoteAddr, aerr.Message)
+					return writeError(w, aerr)
+				}
+				d = *preq.Definition
+			default:
+				srv.pipelines.mu.Lock()
+				def, ok := srv.pipelines.defs[preq.Pipeline]
+				srv.pipelines.mu.Unlock()
+				if !ok {
+					return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown pipeline %q", preq.Pipeline))
+				}
+				d = def
+			}
+			if r, err = srv.StartPipeline(ctx, d, preq.Input); err != nil {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&r)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,282 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/user"
+)
+
+func TestPipelines(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu}
+	h := with(withValidation(ContextHandlerFunc(pipelinesHandler), pipelinesSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/pipelines", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	if w := do(http.MethodGet, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d when disabled, got %d", http.StatusNotFound, w.Code)
+	}
+
+	var err error
+	srv.pipelines, err = newPipelines([]pipeline.Definition{{Name: "cats", Steps: []pipeline.Step{
+		{Name: "resize", Bucket: "/resize-request"},
+		{Name: "classify", Bucket: "/cats-request", JobType: "cats-vs-dogs", DependsOn: []string{"resize"}, Value: "{{.Outputs.resize}}"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := do(http.MethodPost, `{"pipeline": "dogs"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := do(http.MethodPost, `{"pipeline": "cats", "input": "cat.png"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	var r pipeline.Run
+	if err = json.NewDecoder(w.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != pipeline.StatusRunning || r.Steps["resize"].Status != pipeline.StatusRunning || len(qu.added) != 1 {
+		t.Fatalf("unexpected run %+v (enqueued %d)", r, len(qu.added))
+	}
+	resize := *qu.added[0]
+	if resize.Bucket != "/resize-request" || resize.Value != "cat.png" || resize.RequestID != r.Steps["resize"].RequestID {
+		t.Fatalf("unexpected item %+v", resize)
+	}
+
+	// completed job enqueues the dependent step with its result
+	resize.Progress, resize.Value = queue.MaxProgress, "small.png"
+	srv.storeItem(resize)
+	srv.advancePipelines(context.Background(), time.Now())
+	if len(qu.added) != 2 {
+		t.Fatalf("expected dependent step enqueued, got %d", len(qu.added))
+	}
+	classify := *qu.added[1]
+	if classify.Bucket != "/cats-request" || classify.JobType != "cats-vs-dogs" || classify.Value != "small.png" {
+		t.Fatalf("unexpected item %+v", classify)
+	}
+
+	// canceling the run cancels the running jobs
+	w = do(http.MethodPost, `{"id": "`+r.ID+`", "cancel": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if item, _ := srv.loadItem(classify.RequestID); !item.Canceled {
+		t.Fatalf("expected canceled, got %+v", item)
+	}
+	if w = do(http.MethodPost, `{"id": "`+r.ID+`", "cancel": true}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/pipelines?id="+r.ID, nil)
+	w = httptest.NewRecorder()
+	if err = h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.NewDecoder(w.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != pipeline.StatusCanceled || r.Steps["resize"].Output != "small.png" || r.Steps["classify"].Status != pipeline.StatusCanceled {
+		t.Fatalf("unexpected run %+v", r)
+	}
+}
+
+func TestPipelinesRetry(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu}
+	var err error
+	srv.pipelines, err = newPipelines(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := pipeline.Definition{Name: "flaky", Steps: []pipeline.Step{
+		{Name: "a", Bucket: "/a", Retry: pipeline.RetryPolicy{MaxAttempts: 2, Backoff: "1m"}},
+	}}
+	r, err := srv.StartPipeline(context.Background(), d, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := *qu.added[0]
+	failed.Progress, failed.Error = queue.MaxProgress, "out of memory"
+	srv.storeItem(failed)
+	now := time.Now()
+	srv.advancePipelines(context.Background(), now)
+	if len(qu.added) != 1 {
+		t.Fatalf("expected no retry before backoff, got %d", len(qu.added))
+	}
+	srv.advancePipelines(context.Background(), now.Add(time.Minute))
+	if len(qu.added) != 2 || qu.added[1].RequestID == failed.RequestID {
+		t.Fatalf("expected retry with new request ID, got %+v", qu.added)
+	}
+
+	failed = *qu.added[1]
+	failed.Progress, failed.Error = queue.MaxProgress, "out of memory"
+	srv.storeItem(failed)
+	if r, err = srv.Pipeline(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != pipeline.StatusFailed || r.Steps["a"].Attempts != 2 || r.Steps["a"].Error != "out of memory" {
+		t.Fatalf("unexpected run %+v", r)
+	}
+}
+
+func TestPipelinesDefinitionAndMaintenance(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu}
+	var err error
+	srv.pipelines, err = newPipelines([]pipeline.Definition{{Name: "cats", Steps: []pipeline.Step{{Name: "resize", Bucket: "/resize-request"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := with(withValidation(ContextHandlerFunc(pipelinesHandler), pipelinesSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	do := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	// only the admins run the definitions in the requests
+	def := `{"definition": {"name": "any", "steps": [{"name": "a", "bucket": "/cats-request"}]}}`
+	if w := do("192.0.2.1:1234", def); w.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusForbidden, w.Code, w.Body)
+	}
+	if len(qu.added) != 0 {
+		t.Fatalf("expected nothing enqueued, got %+v", qu.added)
+	}
+	if w := do("127.0.0.1:1234", `{"definition": {"name": "bad", "steps": [{"name": "a"}]}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusBadRequest, w.Code, w.Body)
+	}
+	if w := do("127.0.0.1:1234", def); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+
+	// no run starts in maintenance mode
+	w := do("192.0.2.1:1234", `{"pipeline": "cats", "input": "cat.png"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	var r pipeline.Run
+	if err = json.NewDecoder(w.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetMaintenance(true, "")
+	if w = do("192.0.2.1:1234", `{"pipeline": "cats", "input": "dog.png"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusServiceUnavailable, w.Code, w.Body)
+	}
+	if len(qu.added) != 2 {
+		t.Fatalf("expected 2 enqueued, got %d", len(qu.added))
+	}
+
+	// pending steps are held until the maintenance mode ends
+	d := pipeline.Definition{Name: "two", Steps: []pipeline.Step{
+		{Name: "a", Bucket: "/a"},
+		{Name: "b", Bucket: "/b", DependsOn: []string{"a"}},
+	}}
+	srv.SetMaintenance(false, "")
+	if r, err = srv.StartPipeline(context.Background(), d, "x"); err != nil {
+		t.Fatal(err)
+	}
+	a := *qu.added[2]
+	a.Progress = queue.MaxProgress
+	srv.SetMaintenance(true, "")
+	srv.storeItem(a)
+	srv.advancePipelines(context.Background(), time.Now())
+	if len(qu.added) != 3 {
+		t.Fatalf("expected no step enqueued in maintenance mode, got %d", len(qu.added))
+	}
+	srv.SetMaintenance(false, "")
+	srv.advancePipelines(context.Background(), time.Now())
+	if len(qu.added) != 4 || qu.added[3].Bucket != "/b" {
+		t.Fatalf("expected step %q enqueued after maintenance, got %+v", "b", qu.added)
+	}
+}
+
+func TestPipelinesUsers(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{
+		qu:         qu,
+		users:      user.New(nil, user.Config{}),
+		userTokens: user.Tokens{Secret: []byte("secret")},
+		admins:     map[string]bool{"root": true},
+	}
+	var err error
+	srv.pipelines, err = newPipelines([]pipeline.Definition{{Name: "cats", Steps: []pipeline.Step{{Name: "resize", Bucket: "/resize-request"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := with(withValidation(ContextHandlerFunc(pipelinesHandler), pipelinesSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	do := func(account, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(body))
+		if account != "" {
+			token, _, err := srv.userTokens.Issue(account, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if w := do("", `{"pipeline": "cats", "input": "cat.png"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusUnauthorized, w.Code, w.Body)
+	}
+	w := do("alice", `{"pipeline": "cats", "input": "cat.png"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	var r pipeline.Run
+	if err = json.NewDecoder(w.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.User != "alice" || len(qu.added) != 1 || qu.added[0].User != "alice" {
+		t.Fatalf("expected the run and job of %q, got %+v (%+v)", "alice", r, qu.added)
+	}
+
+	cancel := `{"id": "` + r.ID + `", "cancel": true}`
+	for account, code := range map[string]int{"": http.StatusUnauthorized, "bob": http.StatusForbidden} {
+		if w = do(account, cancel); w.Code != code {
+			t.Fatalf("%q: expected %d, got %d (%s)", account, code, w.Code, w.Body)
+		}
+	}
+	if w = do("alice", cancel); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+
+	// the admins cancel the runs of the other users
+	if w = do("alice", `{"pipeline": "cats", "input": "dog.png"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if err = json.NewDecoder(w.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if w = do("root", `{"id": "`+r.ID+`", "cancel": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+}
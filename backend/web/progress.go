@@ -0,0 +1,29 @@
+package web
+
+import (
+	"net/http"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// applyStageProgress validates the stage progress of the item against the
+// previous report, and derives the overall progress from the stages.
+// Completions report the max progress as is.
+func applyStageProgress(item *queue.Item, prev *queue.StageProgress) *Error {
+	if item.StageProgress == nil {
+		// keep reporting the stages declared earlier in the job
+		item.StageProgress = prev
+		return nil
+	}
+	p, err := item.StageProgress.Progress()
+	if err == nil {
+		err = item.StageProgress.Follows(prev)
+	}
+	if err != nil {
+		return NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid stage progress (%v)", err).WithRequestID(item.RequestID)
+	}
+	if item.Progress != queue.MaxProgress {
+		item.Progress = p
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestStageProgress(t *testing.T) {
+	srv := &Server{}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "req-1"
+	srv.requestCache.Store(item.RequestID, item)
+
+	const stages = `"stages": [{"name": "download", "weight": 1}, {"name": "inference", "weight": 3}]`
+	tests := []struct {
+		body     string
+		status   int
+		progress int
+	}{
+		{`{"current": "inference", "percent": 50, ` + stages + `}`, http.StatusOK, 62},
+		// progress is derived from stages, not the reported value
+		{`{"current": "inference", "percent": 60, ` + stages + `}`, http.StatusOK, 70},
+		{`{"current": "download", "percent": 100, ` + stages + `}`, http.StatusBadRequest, 70},
+		{`{"current": "unknown", "percent": 0, ` + stages + `}`, http.StatusBadRequest, 70},
+	}
+	for i, tt := range tests {
+		body := `{"bucket": "/cats-request", "key": "k", "value": "v", "progress": 99, "request_id": "req-1", "stage_progress": ` + tt.body + `}`
+		req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(body))
+		req.Header.Set(queue.ProtocolHeader, "2")
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.status {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, tt.status, w.Code, w.Body.String())
+		}
+		got, err := srv.loadItem("req-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Progress != tt.progress {
+			t.Fatalf("#%d: expected progress %d, got %d", i, tt.progress, got.Progress)
+		}
+	}
+}
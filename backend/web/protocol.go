@@ -0,0 +1,33 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// workerProtocol returns the worker protocol version in the request header.
+// Workers without the header predate version negotiation ('etcdqueue.ProtocolV1').
+func workerProtocol(req *http.Request) (int, *Error) {
+	v := req.Header.Get(queue.ProtocolHeader)
+	if v == "" {
+		return queue.ProtocolV1, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid %q header %q", queue.ProtocolHeader, v)
+	}
+	if aerr := protocolError(version); aerr != nil {
+		return 0, aerr
+	}
+	return version, nil
+}
+
+// protocolError returns the API error if the worker protocol version is not supported.
+func protocolError(version int) *Error {
+	if err := queue.CheckProtocol(version); err != nil {
+		return NewError(http.StatusBadRequest, ErrCodeIncompatibleWorker, "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestWorkerProtocol(t *testing.T) {
+	qu := &popQueue{nopQueue: nopQueue{t: t}, itemc: make(chan *queue.Item, 2)}
+	srv := &Server{qu: qu, workerToken: "secret"}
+	cache := lru.NewInMemory(imageCacheSize)
+
+	// newer workers are refused at registration
+	h := with(withValidation(ContextHandlerFunc(workersHandler), workersSchemas), srv, qu, cache)
+	req := httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(`{"id": "host-cats-1", "name": "cats", "alive": true, "protocol": 99}`))
+	req.Header.Set(workerproc.TokenHeader, "secret")
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	var aerr Error
+	if err := json.NewDecoder(w.Body).Decode(&aerr); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || aerr.Code != ErrCodeIncompatibleWorker {
+		t.Fatalf("unexpected response %d %+v", w.Code, aerr)
+	}
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID, item.JobType = "req-1", "cats-vs-dogs"
+	srv.requestCache.Store(item.RequestID, item)
+
+	// old and new workers are served side by side
+	h = with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, cache)
+	for _, version := range []int{0, queue.ProtocolV2} {
+		qu.itemc <- item
+		req = httptest.NewRequest(http.MethodGet, "/cats-request/queue", nil)
+		if version != 0 {
+			req.Header.Set(queue.ProtocolHeader, strconv.Itoa(version))
+		}
+		w = httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := body["job_type"]; ok != (version == queue.ProtocolV2) {
+			t.Fatalf("protocol %d: unexpected item %+v", version, body)
+		}
+	}
+
+	// old workers post items without routing fields
+	req = httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(`{"bucket": "/cats-request", "key": "k", "value": "cat", "progress": 100, "request_id": "req-1"}`))
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	got, err := srv.loadItem("req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != "cat" || got.JobType != "cats-vs-dogs" {
+		t.Fatalf("unexpected item %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/cats-request/queue", nil)
+	req.Header.Set(queue.ProtocolHeader, "3")
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
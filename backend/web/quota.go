@@ -0,0 +1,263 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/usage"
+
+	"github.com/golang/glog"
+)
+
+// usageTimeout is the timeout to record the usage of the finished jobs,
+// outside of the requests.
+const usageTimeout = 5 * time.Second
+
+// WithQuotas enables the per-user usage accounting in the etcd cluster of
+// the queue, and rejects the job submissions and uploads over the quotas
+// with 429. Anonymous requests share the usage of 'usage.Anonymous'.
+func WithQuotas(cfg usage.Config) ServerOpOption {
+	return func(op *ServerOp) { op.quotas = &cfg }
+}
+
+// UsageStatus is the usage of the user, with the active jobs and the quota.
+type UsageStatus struct {
+	usage.Usage
+	ActiveJobs int         `json:"active_jobs"`
+	Quota      usage.Quota `json:"quota"`
+}
+
+// QuotaError converts the usage errors to *Error.
+func QuotaError(err error) *Error {
+	if _, ok := err.(*usage.ExceededError); ok {
+		return NewError(http.StatusTooManyRequests, ErrCodeQuotaExceeded, "%v", err)
+	}
+	return QueueError(err)
+}
+
+// activeJob is the job counted against the quota of the user.
+type activeJob struct {
+	user    string
+	claimed time.Time
+}
+
+// quotas tracks the active jobs of the users in memory,
+// and records the usage with the accountant.
+type quotas struct {
+	acct *usage.Accountant
+
+	mu   sync.Mutex
+	jobs map[string]*activeJob
+}
+
+func newQuotas(acct *usage.Accountant) *quotas {
+	return &quotas{acct: acct, jobs: make(map[string]*activeJob)}
+}
+
+// usageUser returns the user of the request to account the usage to.
+func usageUser(ctx context.Context) string {
+	if name, _ := ctx.Value(accountKey).(string); name != "" {
+		return name
+	}
+	return usage.Anonymous
+}
+
+// activeJobs returns the number of the active jobs of the user.
+// 'srv.quotas.mu' must be held.
+func (srv *Server) activeJobs(user string) int {
+	n := 0
+	for _, j := range srv.quotas.jobs {
+		if j.user == user {
+			n++
+		}
+	}
+	return n
+}
+
+// startUsage counts the job against the quota of the user of the request,
+// or returns the error if the user has exceeded the quota. The jobs that
+// fail to enqueue still count against the daily jobs.
+func (srv *Server) startUsage(ctx context.Context, requestID string) *Error {
+	return srv.startUsageFor(ctx, usageUser(ctx), requestID)
+}
+
+// startUsageFor counts the job of the key against the quota of the user,
+// for the jobs enqueued outside of the requests (e.g. pipeline steps).
+// Empty user is accounted to 'usage.Anonymous'.
+func (srv *Server) startUsageFor(ctx context.Context, user, key string) *Error {
+	if srv.quotas == nil {
+		return nil
+	}
+	if user == "" {
+		user = usage.Anonymous
+	}
+	q := srv.quotas.acct.Quota(user)
+
+	srv.quotas.mu.Lock()
+	if active := srv.activeJobs(user); q.MaxActiveJobs > 0 && active >= q.MaxActiveJobs {
+		srv.quotas.mu.Unlock()
+		return QuotaError(&usage.ExceededError{User: user, Resource: "active jobs", Used: float64(active), Limit: float64(q.MaxActiveJobs)})
+	}
+	// reserve before recording, so that concurrent submissions
+	// do not exceed the active jobs
+	srv.quotas.jobs[key] = &activeJob{user: user}
+	srv.quotas.mu.Unlock()
+
+	if _, err := srv.quotas.acct.StartJob(ctx, user, time.Now()); err != nil {
+		srv.abortUsage(key)
+		glog.Warningf("rejected %q (%v)", key, err)
+		return QuotaError(err)
+	}
+	return nil
+}
+
+// duplicateKey returns the key to count the speculative duplicate
+// of the job with, next to the job itself.
+func duplicateKey(requestID string) string {
+	return requestID + "/duplicate"
+}
+
+// abortUsage stops counting the job of the key that failed to enqueue.
+func (srv *Server) abortUsage(key string) {
+	if srv.quotas == nil {
+		return
+	}
+	srv.quotas.mu.Lock()
+	delete(srv.quotas.jobs, key)
+	srv.quotas.mu.Unlock()
+}
+
+// claimedUsage starts the compute time of the job, on the first claim.
+// The next claim starts the compute time of the speculative duplicate.
+func (srv *Server) claimedUsage(item *queue.Item) {
+	if srv.quotas == nil {
+		return
+	}
+	srv.quotas.mu.Lock()
+	if j, ok := srv.quotas.jobs[item.RequestID]; ok && j.claimed.IsZero() {
+		j.claimed = time.Now()
+	} else if d, ok := srv.quotas.jobs[duplicateKey(item.RequestID)]; ok && d.claimed.IsZero() {
+		d.claimed = time.Now()
+	}
+	srv.quotas.mu.Unlock()
+}
+
+// finishedUsage records the compute time of the completed (or canceled)
+// job to the usage of the user, with its speculative duplicate. The jobs
+// deleted from the request cache before completion are finished as well,
+// since their results are no longer recorded.
+func (srv *Server) finishedUsage(item *queue.Item) {
+	if srv.quotas == nil {
+		return
+	}
+	keys := []string{item.RequestID, duplicateKey(item.RequestID)}
+	var jobs []*activeJob
+	srv.quotas.mu.Lock()
+	for _, key := range keys {
+		if j, ok := srv.quotas.jobs[key]; ok {
+			delete(srv.quotas.jobs, key)
+			jobs = append(jobs, j)
+		}
+	}
+	srv.quotas.mu.Unlock()
+
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(srv.rootCtx, usageTimeout)
+	defer cancel()
+	for _, j := range jobs {
+		if j.claimed.IsZero() {
+			continue
+		}
+		if _, err := srv.quotas.acct.FinishJob(ctx, j.user, now.Sub(j.claimed), now); err != nil {
+			glog.Warningf("failed to record usage of %q (%v)", item.RequestID, err)
+		}
+	}
+}
+
+// addStorageUsage adds the upload bytes to the storage of the user
+// (negative to release), or returns the error if over the quota.
+func (srv *Server) addStorageUsage(ctx context.Context, user string, bytes int64) *Error {
+	if srv.quotas == nil {
+		return nil
+	}
+	if _, err := srv.quotas.acct.AddStorage(ctx, user, bytes, time.Now()); err != nil {
+		return QuotaError(err)
+	}
+	return nil
+}
+
+// releaseUpload releases the bytes of the deleted upload
+// from the storage of its user.
+func (srv *Server) releaseUpload(info uploadInfo) {
+	if srv.quotas == nil || info.User == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(srv.rootCtx, usageTimeout)
+	defer cancel()
+	if aerr := srv.addStorageUsage(ctx, info.User, -info.Length); aerr != nil {
+		glog.Warningf("failed to release storage of upload %q (%v)", info.ID, aerr)
+	}
+}
+
+// UsageOf returns the usage of the user, with the quota.
+func (srv *Server) UsageOf(ctx context.Context, user string) (UsageStatus, error) {
+	u, err := srv.quotas.acct.Get(ctx, user, time.Now())
+	if err != nil {
+		return UsageStatus{}, err
+	}
+	srv.quotas.mu.Lock()
+	active := srv.activeJobs(user)
+	srv.quotas.mu.Unlock()
+	return UsageStatus{Usage: u, ActiveJobs: active, Quota: srv.quotas.acct.Quota(user)}, nil
+}
+
+func quotasDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "usage accounting is not enabled"))
+}
+
+// usageHandler returns the usage of the user of the request on GET.
+func usageHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.quotas == nil {
+		return quotasDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+	st, err := srv.UsageOf(ctx, usageUser(ctx))
+	if err != nil {
+		return writeError(w, QueueError(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&st)
+}
+
+// adminUsageHandler returns the usage of all users on GET,
+// or of the user (with "user" query).
+func adminUsageHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.quotas == nil {
+		return quotasDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if user := req.URL.Query().Get("user"); user != "" {
+		st, err := srv.UsageOf(ctx, user)
+		if err != nil {
+			return writeError(w, QueueError(err))
+		}
+		return json.NewEncoder(w).Encode(&st)
+	}
+	us, err := srv.quotas.acct.List(ctx, time.Now())
+	if err != nil {
+		return writeError(w, QueueError(err))
+	}
+	return json.NewEncoder(w).Encode(us)
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/usage"
+)
+
+func TestQuotas(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 32379, 32380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	store, err := blobstore.NewLocal(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		rootCtx: context.Background(),
+		qu:      qu,
+		blobs:   store,
+		quotas: newQuotas(usage.New(qu.Client(), usage.Config{
+			Default: usage.Quota{MaxActiveJobs: 1, MaxStorageBytes: 100},
+		})),
+	}
+	cache := lru.NewInMemory(imageCacheSize)
+
+	// anonymous jobs share the active jobs
+	ctx := context.WithValue(context.Background(), accountKey, "")
+	if aerr := srv.startUsage(ctx, "req-1"); aerr != nil {
+		t.Fatal(aerr)
+	}
+	item := queue.CreateItem("/cats-request", 100, "cat.jpg")
+	item.RequestID = "req-1"
+	srv.requestCache.Store(item.RequestID, item)
+	if aerr := srv.startUsage(ctx, "req-2"); aerr == nil || aerr.Status != http.StatusTooManyRequests || aerr.Code != ErrCodeQuotaExceeded {
+		t.Fatalf("expected quota exceeded, got %v", aerr)
+	}
+	if aerr := srv.startUsage(context.WithValue(context.Background(), accountKey, "alice"), "req-3"); aerr != nil {
+		t.Fatal(aerr)
+	}
+
+	// completed job records the compute time, and frees the active job
+	srv.jobClaimed(item)
+	srv.quotas.jobs["req-1"].claimed = time.Now().Add(-10 * time.Second)
+	done := *item
+	done.Progress = queue.MaxProgress
+	srv.storeItem(done)
+	if aerr := srv.startUsage(ctx, "req-4"); aerr != nil {
+		t.Fatal(aerr)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+	w := httptest.NewRecorder()
+	if err = with(ContextHandlerFunc(usageHandler), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	var st UsageStatus
+	if err = json.NewDecoder(w.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.User != usage.Anonymous || st.Jobs != 2 || st.ActiveJobs != 1 || st.ComputeSeconds < 10 || st.Quota.MaxActiveJobs != 1 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+
+	// uploads count against the storage until deleted
+	upload := func(method, target, length string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		req.Header.Set("Upload-Length", length)
+		req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("cat.jpg")))
+		w := httptest.NewRecorder()
+		if err := with(ContextHandlerFunc(uploadHandler), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	w = upload(http.MethodPost, "/upload", "80")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusCreated, w.Code, w.Body)
+	}
+	loc := w.Header().Get("Location")
+	if w = upload(http.MethodPost, "/upload", "30"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w = upload(http.MethodDelete, loc, "0"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusNoContent, w.Code, w.Body)
+	}
+	if w = upload(http.MethodPost, "/upload", "30"); w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusCreated, w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+	w = httptest.NewRecorder()
+	if err = with(ContextHandlerFunc(adminUsageHandler), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	var us []usage.Usage
+	if err = json.NewDecoder(w.Body).Decode(&us); err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[0].User != usage.Anonymous || us[0].StorageBytes != 30 || us[1].User != "alice" {
+		t.Fatalf("unexpected usage %+v", us)
+	}
+}
+
+func TestQuotasPipelinesAndSpeculation(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "quotas-pipelines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	eq, err := queue.NewEmbeddedQueue(context.Background(), 40379, 40380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eq.Stop()
+
+	spec, err := newSpeculator(90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{
+		rootCtx: context.Background(),
+		qu:      qu,
+		spec:    spec,
+		quotas: newQuotas(usage.New(eq.Client(), usage.Config{
+			Default: usage.Quota{MaxActiveJobs: 1},
+		})),
+	}
+	if srv.pipelines, err = newPipelines(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the steps count against the user of the run,
+	// and are held while the user is over the quota
+	d := pipeline.Definition{Name: "pair", Steps: []pipeline.Step{
+		{Name: "a", Bucket: "/a"},
+		{Name: "b", Bucket: "/b"},
+	}}
+	ctx := context.WithValue(context.Background(), accountKey, "alice")
+	if _, err = srv.StartPipeline(ctx, d, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if len(qu.added) != 1 || qu.added[0].User != "alice" {
+		t.Fatalf("expected one step of alice enqueued, got %+v", qu.added)
+	}
+	if st, _ := srv.UsageOf(ctx, "alice"); st.ActiveJobs != 1 || st.Jobs != 1 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+	srv.requestCache.Store(qu.added[0].RequestID, qu.added[0])
+	srv.jobClaimed(qu.added[0])
+	first := *qu.added[0]
+	first.Progress = queue.MaxProgress
+	srv.storeItem(first)
+	srv.advancePipelines(context.Background(), time.Now())
+	if len(qu.added) != 2 || qu.added[1].User != "alice" {
+		t.Fatalf("expected the held step enqueued, got %+v", qu.added)
+	}
+	if st, _ := srv.UsageOf(ctx, "alice"); st.ActiveJobs != 1 || st.Jobs != 2 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+
+	// the speculative duplicates count against the user of the job
+	item := queue.CreateItem("/cats-request", 100, "cat.jpg")
+	item.RequestID = "req-bob"
+	item.User = "bob"
+	if aerr := srv.startUsageFor(context.Background(), item.User, item.RequestID); aerr != nil {
+		t.Fatal(aerr)
+	}
+	srv.requestCache.Store(item.RequestID, item)
+	srv.jobClaimed(item)
+	spec.running[item.RequestID].start = time.Now().Add(-time.Minute)
+	for i := 0; i < speculationMinSamples; i++ {
+		spec.durations = append(spec.durations, time.Second)
+	}
+	srv.speculate(context.Background())
+	if len(qu.added) != 2 {
+		t.Fatalf("expected no duplicate over the quota, got %+v", qu.added)
+	}
+
+	srv.quotas.acct = usage.New(eq.Client(), usage.Config{
+		Default: usage.Quota{MaxActiveJobs: 2},
+	})
+	spec.running[item.RequestID].duplicated = false
+	srv.speculate(context.Background())
+	if len(qu.added) != 3 || qu.added[2].User != "bob" {
+		t.Fatalf("expected duplicate of bob, got %+v", qu.added)
+	}
+	if st, _ := srv.UsageOf(ctx, "bob"); st.ActiveJobs != 2 || st.Jobs != 2 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+
+	// the result of either attempt finishes both
+	dup := *qu.added[2]
+	srv.jobClaimed(&dup)
+	dup.Progress = queue.MaxProgress
+	srv.storeItem(dup)
+	if st, _ := srv.UsageOf(ctx, "bob"); st.ActiveJobs != 0 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+}
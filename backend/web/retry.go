@@ -0,0 +1,91 @@
+package web
+
+import (
+	"context"
+	"fmt"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/notify"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMaxJobAttempts is the default number of attempts of the jobs
+// that time out in workers, before they are moved to the dead letter bucket.
+const DefaultMaxJobAttempts = 3
+
+// WithMaxJobAttempts sets the number of attempts of the jobs that time out
+// in workers (see 'worker.Config.JobTimeout'), before they are moved to the
+// dead letter bucket (see 'etcdqueue.DeadLetterBucket'). 1 to not retry.
+// Defaults to 'DefaultMaxJobAttempts'.
+func WithMaxJobAttempts(n int) ServerOpOption {
+	return func(op *ServerOp) { op.maxJobAttempts = n }
+}
+
+// retryTimedOut adds the timed-out job to the queue again with the input
+// of the cached item, or moves it to the dead letter bucket after the
+// maximum number of attempts. Returns the item to store in the request
+// cache: the retried item, or the timed-out item to complete the job with.
+func (srv *Server) retryTimedOut(ctx context.Context, qu queue.Queue, item, cached queue.Item) (queue.Item, error) {
+	attempts := item.Attempts + 1
+	if attempts >= srv.maxJobAttempts {
+		dead := queue.CreateItem(queue.DeadLetterBucket(item.Bucket), 100, cached.Value)
+		dead.RequestID = item.RequestID
+		dead.JobType = cached.JobType
+		dead.GPU = cached.GPU
+		dead.User = cached.User
+		dead.Error = item.Error
+		dead.TimedOut = true
+		dead.Attempts = item.Attempts
+		if err := qu.Add(ctx, dead); err != nil {
+			return item, err
+		}
+		glog.Warningf("moved %q to %q after %d attempt(s) (%s)", item.RequestID, dead.Bucket, attempts, item.Error)
+		srv.notify(notify.Event{
+			Type:      notify.EventJobDeadLettered,
+			Bucket:    item.Bucket,
+			RequestID: item.RequestID,
+			Message:   fmt.Sprintf("moved %q to %q after %d attempt(s) (%s)", item.RequestID, dead.Bucket, attempts, item.Error),
+		})
+		return item, nil
+	}
+
+	retry := queue.CreateItem(item.Bucket, 100, cached.Value)
+	retry.RequestID = item.RequestID
+	retry.JobType = cached.JobType
+	retry.GPU = cached.GPU
+	retry.User = cached.User
+	retry.Attempts = attempts
+	if err := qu.Add(ctx, retry, queue.WithTTL(enqueueTTL)); err != nil {
+		return item, err
+	}
+	srv.emitJobEvent(JobEnqueued, retry)
+	if srv.spec != nil {
+		// the retry is tracked again when claimed
+		srv.spec.forget(item.RequestID)
+	}
+	glog.Infof("retrying %q (attempt %d of %d) after timeout (%s)", item.RequestID, attempts+1, srv.maxJobAttempts, item.Error)
+	return *retry, nil
+}
+
+// requeue adds the job that the worker gave up (e.g. on preemption) to the
+// queue again with the input of the cached item, without counting an attempt.
+// Returns the requeued item to store in the request cache.
+func (srv *Server) requeue(ctx context.Context, qu queue.Queue, item, cached queue.Item) (queue.Item, error) {
+	again := queue.CreateItem(item.Bucket, 100, cached.Value)
+	again.RequestID = item.RequestID
+	again.JobType = cached.JobType
+	again.GPU = cached.GPU
+	again.WorkerVersion = cached.WorkerVersion
+	again.User = cached.User
+	again.Attempts = item.Attempts
+	if err := qu.Add(ctx, again, queue.WithTTL(enqueueTTL)); err != nil {
+		return item, err
+	}
+	srv.emitJobEvent(JobEnqueued, again)
+	if srv.spec != nil {
+		srv.spec.forget(item.RequestID)
+	}
+	glog.Infof("requeued %q (%s)", item.RequestID, item.Error)
+	return *again, nil
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestRetryTimedOut(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu, maxJobAttempts: 2}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "req-1"
+	item.JobType = "cats-vs-dogs"
+	srv.requestCache.Store(item.RequestID, item)
+
+	tests := []struct {
+		attempts int
+		bucket   string
+		progress int
+	}{
+		{0, "/cats-request", 0},
+		{1, "/dead-letter/cats-request", queue.MaxProgress},
+	}
+	for i, tt := range tests {
+		body := fmt.Sprintf(`{"bucket": "/cats-request", "key": "k", "value": "partial", "progress": 100, "request_id": "req-1", "error": "job timed out after 1m0s", "timed_out": true, "attempts": %d}`, tt.attempts)
+		req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(body))
+		req.Header.Set(queue.ProtocolHeader, "2")
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, http.StatusOK, w.Code, w.Body.String())
+		}
+		if len(qu.added) != i+1 {
+			t.Fatalf("#%d: expected %d items added, got %d", i, i+1, len(qu.added))
+		}
+		added := qu.added[i]
+		if added.Bucket != tt.bucket || added.Value != item.Value || added.RequestID != item.RequestID || added.JobType != item.JobType {
+			t.Fatalf("#%d: unexpected item %+v", i, added)
+		}
+		got, err := srv.loadItem("req-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Progress != tt.progress {
+			t.Fatalf("#%d: expected progress %d, got %+v", i, tt.progress, got)
+		}
+	}
+	if qu.added[0].Attempts != 1 {
+		t.Fatalf("expected the retry with 1 attempt, got %d", qu.added[0].Attempts)
+	}
+	got, _ := srv.loadItem("req-1")
+	if got.Error != "job timed out after 1m0s" {
+		t.Fatalf("expected the job completed with the timeout, got %q", got.Error)
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu, maxJobAttempts: 1}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "req-1"
+	item.JobType = "cats-vs-dogs"
+	srv.requestCache.Store(item.RequestID, item)
+
+	// requeued regardless of the maximum attempts
+	body := `{"bucket": "/cats-request", "key": "k", "value": "partial", "progress": 100, "request_id": "req-1", "error": "worker preempted", "requeue": true, "attempts": 1}`
+	req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(body))
+	req.Header.Set(queue.ProtocolHeader, "2")
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(qu.added) != 1 {
+		t.Fatalf("expected 1 item added, got %d", len(qu.added))
+	}
+	added := qu.added[0]
+	if added.Bucket != "/cats-request" || added.Value != item.Value || added.JobType != item.JobType || added.Attempts != 1 {
+		t.Fatalf("unexpected item %+v", added)
+	}
+	got, err := srv.loadItem("req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Progress != 0 || got.Error != "" {
+		t.Fatalf("expected the job waiting again, got %+v", got)
+	}
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+
+	"github.com/golang/glog"
+)
+
+// WithScheduler campaigns for the scheduler leadership among the servers
+// sharing the etcd cluster of the queue, to enqueue the jobs of the
+// schedules when due. "/admin/schedules" manages the schedules.
+func WithScheduler(cfg scheduler.Config) ServerOpOption {
+	return func(op *ServerOp) { op.scheduler = &cfg }
+}
+
+// ScheduleRequest defines requests to the admin schedules endpoint.
+type ScheduleRequest struct {
+	// Schedule creates or replaces the schedule.
+	Schedule *scheduler.Schedule `json:"schedule,omitempty"`
+	// Name is the schedule to pause or resume (with Paused),
+	// or to delete (with Delete).
+	Name   string `json:"name,omitempty"`
+	Paused *bool  `json:"paused,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// SchedulesStatus defines the response of the admin schedules endpoint.
+type SchedulesStatus struct {
+	// Leading is true if the server enqueues the runs.
+	Leading   bool                 `json:"leading"`
+	Schedules []scheduler.Schedule `json:"schedules"`
+}
+
+// enqueueScheduled adds the job of the scheduled run to the queue,
+// counted against the quota of the user of the schedule. The runs
+// are not enqueued in maintenance mode.
+func (srv *Server) enqueueScheduled(ctx context.Context, item *queue.Item) error {
+	if srv.InMaintenance() {
+		return errors.New("server is in maintenance mode")
+	}
+	if aerr := srv.startUsageFor(ctx, item.User, item.RequestID); aerr != nil {
+		return aerr
+	}
+	if err := srv.qu.Add(ctx, item, queue.WithTTL(enqueueTTL)); err != nil {
+		srv.abortUsage(item.RequestID)
+		return err
+	}
+	srv.requestCache.Store(item.RequestID, item)
+	srv.emitJobEvent(JobEnqueued, item)
+	return nil
+}
+
+// ScheduleError converts the scheduler errors to *Error.
+func ScheduleError(err error) *Error {
+	if err == scheduler.ErrNotFound {
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	}
+	return QueueError(err)
+}
+
+// schedulesHandler returns the schedules on GET (or the schedule with the
+// "name" query), and creates, pauses, resumes, or deletes the schedule
+// on POST.
+func schedulesHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.scheduler == nil {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "scheduler is not enabled"))
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if name := req.URL.Query().Get("name"); name != "" {
+			sc, err := srv.scheduler.Get(ctx, name)
+			if err != nil {
+				return writeError(w, ScheduleError(err))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(&sc)
+		}
+		scs, err := srv.scheduler.List(ctx)
+		if err != nil {
+			return writeError(w, ScheduleError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(SchedulesStatus{Leading: srv.scheduler.Leading(), Schedules: scs})
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var sreq ScheduleRequest
+		if err = json.Unmarshal(rb, &sreq); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+
+		var sc scheduler.Schedule
+		switch {
+		case sreq.Schedule != nil:
+			if sreq.Name != "" || sreq.Paused != nil || sreq.Delete {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected either schedule, or name to pause, resume, or delete"))
+			}
+			if err = sreq.Schedule.Validate(); err != nil {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err))
+			}
+			// the runs are accounted to the user who created the schedule
+			sreq.Schedule.User, _ = ctx.Value(accountKey).(string)
+			sc, err = srv.scheduler.Put(ctx, *sreq.Schedule, time.Now())
+		case sreq.Name != "" && sreq.Delete:
+			if err = srv.scheduler.Delete(ctx, sreq.Name); err != nil {
+				return writeError(w, ScheduleError(err))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		case sreq.Name != "" && sreq.Paused != nil:
+			sc, err = srv.scheduler.SetPaused(ctx, sreq.Name, *sreq.Paused, time.Now())
+		default:
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "expected schedule, or name with paused or delete"))
+		}
+		if err != nil {
+			glog.Warning(err)
+			return writeError(w, ScheduleError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&sc)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+	"github.com/gyuho/dplearn/pkg/usage"
+)
+
+func TestSchedules(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "schedules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 36379, 36380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{rootCtx: context.Background(), qu: qu}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := with(ContextHandlerFunc(schedulesHandler), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if w := serve(http.MethodGet, "/admin/schedules", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when disabled, got %d", w.Code)
+	}
+	srv.scheduler = scheduler.New(qu.Client(), scheduler.Config{Name: "backend-1", Enqueue: srv.enqueueScheduled})
+
+	if w := serve(http.MethodPost, "/admin/schedules", `{"schedule":{"name":"nightly","cron":"61 * * * *","bucket":"/train"}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	w := serve(http.MethodPost, "/admin/schedules", `{"schedule":{"name":"nightly","cron":"0 2 * * *","bucket":"/train","value":"{{.Name}}"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", w.Code, w.Body.String())
+	}
+	var sc scheduler.Schedule
+	if err = json.NewDecoder(w.Body).Decode(&sc); err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "nightly" || sc.Next.Hour() != 2 || sc.Paused {
+		t.Fatalf("unexpected schedule %+v", sc)
+	}
+
+	w = serve(http.MethodPost, "/admin/schedules", `{"name":"nightly","paused":true}`)
+	if err = json.NewDecoder(w.Body).Decode(&sc); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Paused {
+		t.Fatalf("expected paused, got %+v", sc)
+	}
+
+	w = serve(http.MethodGet, "/admin/schedules", "")
+	var st SchedulesStatus
+	if err = json.NewDecoder(w.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Leading || len(st.Schedules) != 1 || st.Schedules[0].Name != "nightly" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	if w = serve(http.MethodPost, "/admin/schedules", `{"name":"nightly","delete":true}`); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if w = serve(http.MethodGet, "/admin/schedules?name=nightly", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	// the scheduled runs are tracked as the submitted jobs
+	item := queue.CreateItem("/train", 100, "nightly")
+	item.RequestID = "schedule-nightly-1"
+	if err = srv.enqueueScheduled(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.requestCache.Load(item.RequestID); !ok {
+		t.Fatalf("expected %q in the request cache", item.RequestID)
+	}
+
+	// the scheduled runs count against the quota of the user of the schedule
+	srv.quotas = newQuotas(usage.New(qu.Client(), usage.Config{Default: usage.Quota{MaxActiveJobs: 1}}))
+	for _, tt := range []struct {
+		requestID string
+		ok        bool
+	}{{"schedule-nightly-2", true}, {"schedule-nightly-3", false}} {
+		it := queue.CreateItem("/train", 100, "nightly")
+		it.RequestID, it.User = tt.requestID, "alice"
+		err = srv.enqueueScheduled(context.Background(), it)
+		if aerr, _ := err.(*Error); tt.ok != (err == nil) || (err != nil && (aerr == nil || aerr.Code != ErrCodeQuotaExceeded)) {
+			t.Fatalf("%q: unexpected error %v", tt.requestID, err)
+		}
+	}
+	if st, _ := srv.UsageOf(context.Background(), "alice"); st.ActiveJobs != 1 || st.Jobs != 1 {
+		t.Fatalf("unexpected usage %+v", st)
+	}
+
+	srv.SetMaintenance(true, "upgrade")
+	if err = srv.enqueueScheduled(context.Background(), item); err == nil {
+		t.Fatal("expected error in maintenance mode")
+	}
+}
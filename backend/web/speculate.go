@@ -0,0 +1,218 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// speculationInterval is the interval to check for straggler jobs.
+	speculationInterval = 5 * time.Second
+
+	// speculationWindow is the number of recent job durations
+	// to compute the percentile from.
+	speculationWindow = 200
+
+	// speculationMinSamples is the number of job durations
+	// to observe before duplicating any job.
+	speculationMinSamples = 20
+)
+
+// WithSpeculation enables speculative execution of straggler jobs: jobs
+// running longer than the percentile (e.g. 95) of recent job durations are
+// added to the queue again with the maximum weight, so that a second worker
+// runs them. The first result wins, and the other result is discarded.
+// Useful to mitigate stuck or slow workers for interactive users.
+func WithSpeculation(percentile float64) ServerOpOption {
+	return func(op *ServerOp) { op.speculationPercentile = percentile }
+}
+
+// attempt is the running job, as claimed by the first worker.
+type attempt struct {
+	item       queue.Item
+	start      time.Time
+	duplicated bool
+}
+
+// speculator tracks running jobs and recent job durations,
+// to find straggler jobs.
+type speculator struct {
+	percentile float64
+
+	// mu also serializes the result updates in the request cache,
+	// so that only the first result of duplicated jobs is stored.
+	mu        sync.Mutex
+	durations []time.Duration
+	next      int
+	running   map[string]*attempt
+}
+
+func newSpeculator(percentile float64) (*speculator, error) {
+	if percentile <= 0 || percentile >= 100 {
+		return nil, fmt.Errorf("invalid speculation percentile %v (must be between 0 and 100)", percentile)
+	}
+	return &speculator{percentile: percentile, running: make(map[string]*attempt)}, nil
+}
+
+// claimed records the job claim. The claims of duplicated
+// jobs do not reset the start time.
+func (s *speculator) claimed(item *queue.Item, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.running[item.RequestID]; !ok {
+		s.running[item.RequestID] = &attempt{item: *item, start: now}
+	}
+}
+
+// completed stops tracking the job, observing its duration.
+// 's.mu' must be held.
+func (s *speculator) completed(requestID string, now time.Time) {
+	a, ok := s.running[requestID]
+	if !ok {
+		return
+	}
+	delete(s.running, requestID)
+	if len(s.durations) < speculationWindow {
+		s.durations = append(s.durations, now.Sub(a.start))
+		return
+	}
+	s.durations[s.next] = now.Sub(a.start)
+	s.next = (s.next + 1) % speculationWindow
+}
+
+// forget stops tracking the job (e.g. canceled by user).
+func (s *speculator) forget(requestID string) {
+	s.mu.Lock()
+	delete(s.running, requestID)
+	s.mu.Unlock()
+}
+
+// threshold returns the percentile of recent job durations.
+// Returns false if not enough jobs have been observed.
+func (s *speculator) threshold() (time.Duration, bool) {
+	s.mu.Lock()
+	ds := append([]time.Duration(nil), s.durations...)
+	s.mu.Unlock()
+	if len(ds) < speculationMinSamples {
+		return 0, false
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	idx := int(math.Ceil(s.percentile/100*float64(len(ds)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return ds[idx], true
+}
+
+// stragglers returns the jobs running longer than the threshold that
+// are eligible, and marks them duplicated so that each job is duplicated
+// at most once.
+func (s *speculator) stragglers(now time.Time, eligible func(requestID string) bool) ([]queue.Item, time.Duration) {
+	thr, ok := s.threshold()
+	if !ok {
+		return nil, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []queue.Item
+	for _, a := range s.running {
+		if !a.duplicated && now.Sub(a.start) > thr && eligible(a.item.RequestID) {
+			a.duplicated = true
+			items = append(items, a.item)
+		}
+	}
+	return items, thr
+}
+
+func (srv *Server) runSpeculation(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.rootCtx.Done():
+			return
+		case <-srv.donec:
+			return
+		case <-ticker.C:
+		}
+		srv.speculate(srv.rootCtx)
+	}
+}
+
+// speculate duplicates the straggler jobs to the queue,
+// with the maximum weight to run them next. The duplicates
+// count against the quota of the user of the job.
+func (srv *Server) speculate(ctx context.Context) {
+	items, thr := srv.spec.stragglers(time.Now(), func(requestID string) bool {
+		return srv.featureEnabled(FeatureSpeculation, requestID)
+	})
+	for i := range items {
+		item := &items[i]
+		if _, err := srv.loadItem(item.RequestID); err != nil {
+			// canceled by user
+			srv.spec.forget(item.RequestID)
+			continue
+		}
+		dup := queue.CreateItem(item.Bucket, queue.MaxWeight, item.Value)
+		dup.RequestID = item.RequestID
+		dup.JobType = item.JobType
+		dup.GPU = item.GPU
+		dup.User = item.User
+		if aerr := srv.startUsageFor(ctx, item.User, duplicateKey(item.RequestID)); aerr != nil {
+			glog.Warningf("skipped duplicating straggler job %q (%v)", item.RequestID, aerr)
+			continue
+		}
+		if err := srv.qu.Add(ctx, dup, queue.WithTTL(enqueueTTL)); err != nil {
+			srv.abortUsage(duplicateKey(item.RequestID))
+			glog.Warningf("failed to duplicate straggler job %q (%v)", item.RequestID, err)
+			continue
+		}
+		glog.Infof("duplicated straggler job %q as %q (running longer than %v)", item.RequestID, dup.Key, thr)
+	}
+}
+
+// storeItem stores the job update from workers in the request cache.
+// When speculation is enabled, the updates after the first result of the
+// job are discarded, as well as the progress updates from the slower
+// attempt of the duplicated job. Returns the stored item, and false if
+// the update is discarded.
+func (srv *Server) storeItem(item queue.Item) (queue.Item, bool) {
+	prev := -1
+	if srv.spec == nil {
+		if cur, err := srv.loadItem(item.RequestID); err == nil {
+			prev = cur.Progress
+		}
+		srv.requestCache.Store(item.RequestID, &item)
+		srv.itemUpdated(&item, prev)
+		return item, true
+	}
+
+	srv.spec.mu.Lock()
+	defer srv.spec.mu.Unlock()
+	if cur, err := srv.loadItem(item.RequestID); err == nil {
+		prev = cur.Progress
+		if cur.Progress == queue.MaxProgress {
+			glog.Infof("discarded the later result of %q (%q)", item.RequestID, item.Key)
+			return cur, false
+		}
+		if a, ok := srv.spec.running[item.RequestID]; ok && a.duplicated &&
+			item.Progress != queue.MaxProgress && item.Progress < cur.Progress {
+			return cur, false
+		}
+	}
+	srv.requestCache.Store(item.RequestID, &item)
+	srv.itemUpdated(&item, prev)
+	if item.Progress == queue.MaxProgress {
+		srv.spec.completed(item.RequestID, time.Now())
+	}
+	return item, true
+}
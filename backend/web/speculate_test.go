@@ -0,0 +1,110 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+// addQueue records the added items.
+type addQueue struct {
+	nopQueue
+	added []*queue.Item
+}
+
+func (qu *addQueue) Add(ctx context.Context, it *queue.Item, opts ...queue.OpOption) error {
+	qu.added = append(qu.added, it)
+	return nil
+}
+
+func TestSpeculation(t *testing.T) {
+	if _, err := newSpeculator(100); err == nil {
+		t.Fatal("expected error on percentile 100")
+	}
+	spec, err := newSpeculator(90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qu := &addQueue{nopQueue: nopQueue{t: t}}
+	srv := &Server{qu: qu, spec: spec}
+	h := with(withValidation(ContextHandlerFunc(queueHandler), queueSchemas), srv, qu, lru.NewInMemory(imageCacheSize))
+
+	item := queue.CreateItem("/cats-request", 100, "/tmp/cat.jpg")
+	item.RequestID = "req-1"
+	item.JobType = "cats-vs-dogs"
+	srv.requestCache.Store(item.RequestID, item)
+	srv.jobClaimed(item)
+
+	// no duplicates until enough jobs are observed
+	spec.running[item.RequestID].start = time.Now().Add(-time.Minute)
+	srv.speculate(context.Background())
+	if len(qu.added) != 0 {
+		t.Fatalf("expected no duplicate, got %+v", qu.added)
+	}
+	for i := 0; i < speculationMinSamples; i++ {
+		spec.durations = append(spec.durations, time.Duration(i+1)*time.Second)
+	}
+	if thr, _ := spec.threshold(); thr != 18*time.Second {
+		t.Fatalf("expected p90 18s, got %v", thr)
+	}
+	srv.speculate(context.Background())
+	srv.speculate(context.Background())
+	if len(qu.added) != 1 {
+		t.Fatalf("expected one duplicate, got %+v", qu.added)
+	}
+	dup := qu.added[0]
+	if dup.RequestID != item.RequestID || dup.Value != item.Value || dup.JobType != item.JobType || dup.Key == item.Key ||
+		!strings.HasPrefix(dup.Key, "/cats-request/00000") {
+		t.Fatalf("unexpected duplicate %+v", dup)
+	}
+	srv.jobClaimed(dup)
+
+	tests := []struct {
+		key      string
+		progress int
+		value    string
+		want     string
+	}{
+		{dup.Key, 50, "dup", "dup"},
+		// slower attempt does not move the progress back
+		{item.Key, 20, "orig", "dup"},
+		{dup.Key, 100, "dog", "dog"},
+		// later result is discarded
+		{item.Key, 100, "cat", "dog"},
+		{item.Key, 30, "orig", "dog"},
+	}
+	for i, tt := range tests {
+		body := fmt.Sprintf(`{"bucket": "/cats-request", "key": %q, "value": %q, "progress": %d, "request_id": "req-1"}`, tt.key, tt.value, tt.progress)
+		req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(body))
+		req.Header.Set(queue.ProtocolHeader, "2")
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("#%d: expected %d, got %d (%s)", i, http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp queue.Item
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		got, err := srv.loadItem("req-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Value != tt.want || resp.Value != tt.want {
+			t.Fatalf("#%d: expected %q, got %q (response %q)", i, tt.want, got.Value, resp.Value)
+		}
+	}
+	if len(spec.running) != 0 || len(spec.durations) != speculationMinSamples+1 {
+		t.Fatalf("expected the completed job observed, got %d running, %d durations", len(spec.running), len(spec.durations))
+	}
+}
@@ -0,0 +1,325 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	"github.com/golang/glog"
+)
+
+// Resumable uploads with tus protocol (core, creation, termination).
+// https://tus.io/protocols/resumable-upload.html
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+
+	// UploadPath is the path prefix of the upload endpoint.
+	// Completed uploads can be submitted as a job with the upload URL
+	// (e.g. "/upload/8ab3...") as 'data_from_frontend'.
+	UploadPath = "/upload/"
+
+	uploadMaxSize = imageCacheSizeLimit
+)
+
+// uploadInfo is stored next to upload data, so that uploads
+// can be resumed across server restarts.
+type uploadInfo struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	// User is the user to account the upload bytes to.
+	User string `json:"user,omitempty"`
+}
+
+func uploadInfoKey(id string) string { return id + ".info" }
+
+func loadUploadInfo(store blobstore.Store, id string) (uploadInfo, error) {
+	rc, err := store.Open(uploadInfoKey(id))
+	if err != nil {
+		return uploadInfo{}, err
+	}
+	defer rc.Close()
+	var info uploadInfo
+	err = json.NewDecoder(rc).Decode(&info)
+	return info, err
+}
+
+// parseUploadMetadata parses "Upload-Metadata" header
+// (comma-separated key and base64-encoded value pairs).
+func parseUploadMetadata(v string) (map[string]string, error) {
+	md := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		if len(kv) == 1 {
+			md[kv[0]] = ""
+			continue
+		}
+		bv, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		md[kv[0]] = string(bv)
+	}
+	return md, nil
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func uploadHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	store := srv.blobs
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if req.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(uploadMaxSize))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if req.Method != http.MethodGet && req.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		return writeError(w, NewError(http.StatusPreconditionFailed, ErrCodeBadRequest, "unsupported Tus-Resumable %q (expected %q)", req.Header.Get("Tus-Resumable"), tusVersion))
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, UploadPath)
+	if id == "" || strings.Contains(id, "/") {
+		if req.Method == http.MethodPost {
+			if aerr := srv.loginRequired(ctx); aerr != nil {
+				return writeError(w, aerr)
+			}
+			return createUpload(ctx, srv, w, req)
+		}
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "no upload ID in %q", req.URL.Path))
+	}
+
+	info, err := loadUploadInfo(store, id)
+	if err == blobstore.ErrNotFound || err == blobstore.ErrInvalidKey {
+		return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "unknown upload %q", id))
+	}
+	if err != nil {
+		return err
+	}
+
+	switch req.Method {
+	case http.MethodHead:
+		offset, err := store.Size(id)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		return nil
+
+	case http.MethodPatch:
+		return patchUpload(srv, w, req, info)
+
+	case http.MethodGet:
+		offset, err := store.Size(id)
+		if err != nil {
+			return err
+		}
+		if offset != info.Length {
+			return writeError(w, NewError(http.StatusConflict, ErrCodeBadRequest, "upload %q is incomplete (%d/%d bytes)", id, offset, info.Length))
+		}
+		rc, err := store.Open(id)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Length, 10))
+		_, err = io.Copy(w, rc)
+		return err
+
+	case http.MethodDelete:
+		if err = store.Delete(id); err != nil {
+			return err
+		}
+		if err = store.Delete(uploadInfoKey(id)); err != nil {
+			return err
+		}
+		srv.releaseUpload(info)
+		glog.Infof("terminated upload %q", id)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+func createUpload(ctx context.Context, srv *Server, w http.ResponseWriter, req *http.Request) error {
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid Upload-Length %q", req.Header.Get("Upload-Length")))
+	}
+	if length > uploadMaxSize {
+		return writeError(w, NewError(http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "upload is too big; %d > %d(limit)", length, uploadMaxSize))
+	}
+	md, err := parseUploadMetadata(req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid Upload-Metadata (%v)", err))
+	}
+	switch strings.ToLower(filepath.Ext(md["filename"])) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeUnsupported, "not support filename %q (must be jpg, jpeg, png)", md["filename"]))
+	}
+	if aerr := srv.diskSpaceError(uint64(length)); aerr != nil {
+		glog.Warningf("rejected upload %q (%v)", md["filename"], aerr)
+		return writeError(w, aerr)
+	}
+
+	info := uploadInfo{ID: newUploadID(), Length: length, Metadata: md, CreatedAt: time.Now()}
+	if srv.quotas != nil {
+		info.User = usageUser(ctx)
+		if aerr := srv.addStorageUsage(ctx, info.User, length); aerr != nil {
+			glog.Warningf("rejected upload %q (%v)", md["filename"], aerr)
+			return writeError(w, aerr)
+		}
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err = srv.blobs.Put(uploadInfoKey(info.ID), data); err != nil {
+		return err
+	}
+	if _, err = srv.blobs.Append(info.ID, strings.NewReader("")); err != nil {
+		return err
+	}
+	glog.Infof("created upload %q (%d bytes, %q)", info.ID, length, md["filename"])
+
+	w.Header().Set("Location", path.Join(UploadPath, info.ID))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func patchUpload(srv *Server, w http.ResponseWriter, req *http.Request, info uploadInfo) error {
+	if req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return writeError(w, NewError(http.StatusUnsupportedMediaType, ErrCodeBadRequest, "unexpected Content-Type %q", req.Header.Get("Content-Type")))
+	}
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid Upload-Offset %q", req.Header.Get("Upload-Offset")))
+	}
+
+	// only one PATCH at a time per upload
+	if _, busy := srv.uploadLocks.LoadOrStore(info.ID, struct{}{}); busy {
+		return writeError(w, NewError(http.StatusConflict, ErrCodeBadRequest, "upload %q is in progress", info.ID))
+	}
+	defer srv.uploadLocks.Delete(info.ID)
+
+	cur, err := srv.blobs.Size(info.ID)
+	if err != nil {
+		return err
+	}
+	if offset != cur {
+		return writeError(w, NewError(http.StatusConflict, ErrCodeBadRequest, "Upload-Offset %d does not match current offset %d", offset, cur))
+	}
+
+	n, err := srv.blobs.Append(info.ID, io.LimitReader(req.Body, info.Length-cur))
+	io.Copy(ioutil.Discard, req.Body)
+	req.Body.Close()
+	if err != nil {
+		// partially written data is kept for resume
+		glog.Warningf("upload %q interrupted at %d bytes (%v)", info.ID, cur+n, err)
+		return err
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(cur+n, 10))
+	w.WriteHeader(http.StatusNoContent)
+	if cur+n == info.Length {
+		glog.Infof("completed upload %q (%d bytes)", info.ID, info.Length)
+	}
+	return nil
+}
+
+// WithShredUploads shreds the uploaded images (see 'fileutil.Shred') once
+// their requests are deleted, instead of keeping them in the temporary
+// directory, for the deployments with data-handling requirements. The
+// default local blob store also shreds the deleted uploads.
+func WithShredUploads() ServerOpOption {
+	return func(op *ServerOp) { op.shredUploads = true }
+}
+
+// shredUpload shreds the local image file of the upload, and deletes the upload.
+func (srv *Server) shredUpload(id, imgFilePath string) {
+	if err := fileutil.Shred(imgFilePath); err != nil && !os.IsNotExist(err) {
+		glog.Warningf("failed to shred %q (%v)", imgFilePath, err)
+	}
+	if info, err := loadUploadInfo(srv.blobs, id); err == nil {
+		srv.releaseUpload(info)
+	}
+	for _, key := range []string{id, uploadInfoKey(id)} {
+		if err := srv.blobs.Delete(key); err != nil {
+			glog.Warningf("failed to delete upload %q (%v)", key, err)
+		}
+	}
+	glog.Infof("shredded upload %q", id)
+}
+
+// uploadedImage writes the completed upload to a local file for workers,
+// and returns the file path.
+func uploadedImage(store blobstore.Store, uploadURL string) (string, error) {
+	id := strings.TrimPrefix(uploadURL, UploadPath)
+	info, err := loadUploadInfo(store, id)
+	if err != nil {
+		return "", NewError(http.StatusNotFound, ErrCodeNotFound, "unknown upload %q (%v)", id, err)
+	}
+	size, err := store.Size(id)
+	if err != nil {
+		return "", err
+	}
+	if size != info.Length {
+		return "", NewError(http.StatusConflict, ErrCodeBadRequest, "upload %q is incomplete (%d/%d bytes)", id, size, info.Length)
+	}
+
+	imgFilePath, err := fileutil.SecureJoin("/tmp", "upload-"+id+strings.ToLower(filepath.Ext(info.Metadata["filename"])))
+	if err != nil {
+		return "", NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid filename %q (%v)", info.Metadata["filename"], err)
+	}
+	if fileutil.Exist(imgFilePath) {
+		return imgFilePath, nil
+	}
+	rc, err := store.Open(id)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(fileutil.LimitReader(rc, uploadMaxSize))
+	if err != nil {
+		return "", err
+	}
+	if err = fileutil.WriteToFile(imgFilePath, data); err != nil {
+		return "", err
+	}
+	glog.Infof("saved upload %q to %q", id, imgFilePath)
+	return imgFilePath, nil
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/lru"
+)
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobstore.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{blobs: store}
+	h := with(ContextHandlerFunc(uploadHandler), srv, &nopQueue{t: t}, lru.NewInMemory(1))
+	do := func(method, target string, body string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	data := "0123456789"
+	w := do(http.MethodPost, "/upload", "", map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("cat.jpg")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusCreated, w.Code, w.Body.String())
+	}
+	loc := w.Header().Get("Location")
+	if !strings.HasPrefix(loc, UploadPath) {
+		t.Fatalf("unexpected Location %q", loc)
+	}
+
+	patch := func(offset, body string) *httptest.ResponseRecorder {
+		return do(http.MethodPatch, loc, body, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		})
+	}
+	if w = patch("0", data[:4]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "4" {
+		t.Fatalf("unexpected response %d, offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w = do(http.MethodHead, loc, "", nil); w.Header().Get("Upload-Offset") != "4" || w.Header().Get("Upload-Length") != "10" {
+		t.Fatalf("unexpected HEAD response %+v", w.Header())
+	}
+	if _, err = uploadedImage(store, loc); err == nil {
+		t.Fatal("expected error on incomplete upload")
+	}
+
+	// resume from wrong offset
+	if w = patch("0", data); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	// body beyond Upload-Length is truncated
+	if w = patch("4", data[4:]+"extra"); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("unexpected response %d, offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	if w = do(http.MethodGet, loc, "", nil); w.Body.String() != data {
+		t.Fatalf("expected %q, got %q", data, w.Body.String())
+	}
+	fpath, err := uploadedImage(store, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fpath)
+	if !strings.HasSuffix(fpath, ".jpg") {
+		t.Fatalf("unexpected file path %q", fpath)
+	}
+
+	if w = do(http.MethodDelete, loc, "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w = do(http.MethodHead, loc, "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// unsupported file type
+	w = do(http.MethodPost, "/upload", "", map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("cat.gif")),
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestUploadNoSpace(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobstore.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fileutil.DiskUsage(dir); err != nil {
+		t.Skip(err)
+	}
+
+	// no partition has this much space available
+	srv := &Server{blobs: store, diskDir: dir, minDiskSpace: math.MaxUint64}
+	h := with(ContextHandlerFunc(uploadHandler), srv, &nopQueue{t: t}, lru.NewInMemory(1))
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("cat.jpg")))
+	w := httptest.NewRecorder()
+	if err = h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusInsufficientStorage, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), ErrCodeNoSpace) {
+		t.Fatalf("expected %q, got %s", ErrCodeNoSpace, w.Body.String())
+	}
+}
+
+func TestShredUpload(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobstore.NewLocalShred(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := newUploadID()
+	if err = store.Put(uploadInfoKey(id), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Append(id, strings.NewReader("image")); err != nil {
+		t.Fatal(err)
+	}
+	imgFilePath := filepath.Join(dir, "upload-"+id+".jpg")
+	if err = ioutil.WriteFile(imgFilePath, []byte("image"), fileutil.PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{blobs: store, shredUploads: true}
+	srv.shredUpload(id, imgFilePath)
+	if fileutil.Exist(imgFilePath) {
+		t.Fatalf("expected %q shredded", imgFilePath)
+	}
+	for _, key := range []string{id, uploadInfoKey(id)} {
+		if _, err = store.Size(key); err != blobstore.ErrNotFound {
+			t.Fatalf("expected %q deleted, got %v", key, err)
+		}
+	}
+}
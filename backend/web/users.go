@@ -0,0 +1,294 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/audit"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/user"
+
+	"github.com/golang/glog"
+)
+
+// SessionCookie is the name of the cookie of the session token,
+// set on login for the browsers.
+const SessionCookie = "dplearn-session"
+
+// WithUsers enables the user accounts in the etcd cluster of the queue.
+// Users register at "/users/register", and log in at "/users/login" for
+// the session tokens, which identify the requests with the header
+// "Authorization: Bearer <token>" (or the session cookie), so that the
+// jobs are tied to the users. Requests without valid tokens are anonymous.
+func WithUsers(cfg user.Config, tokens user.Tokens) ServerOpOption {
+	return func(op *ServerOp) { op.users, op.userTokens = &cfg, tokens }
+}
+
+// WithLoginRequired rejects the job submissions and uploads of the
+// anonymous requests, with the user accounts enabled.
+func WithLoginRequired() ServerOpOption {
+	return func(op *ServerOp) { op.loginRequired = true }
+}
+
+// WithAdmins grants the admin role to the users of the names, to call the
+// admin endpoints (e.g. "/admin", "/admin/maintenance"). Without the user
+// accounts, the admin endpoints are only served to the loopback, not proxied.
+func WithAdmins(names ...string) ServerOpOption {
+	return func(op *ServerOp) { op.admins = append(op.admins, names...) }
+}
+
+// RegisterRequest defines requests to register the user.
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	user.Profile
+}
+
+// LoginRequest defines requests to log in.
+type LoginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// LoginResponse is the session token of the user.
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      user.User `json:"user"`
+}
+
+// UserUpdate defines requests to update the profile, the settings, or
+// the password (with the current password) of the user.
+type UserUpdate struct {
+	Profile     *user.Profile     `json:"profile,omitempty"`
+	Settings    map[string]string `json:"settings,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	NewPassword string            `json:"new_password,omitempty"`
+}
+
+// UserError converts the user store errors to *Error.
+func UserError(err error) *Error {
+	switch err {
+	case user.ErrNotFound:
+		return NewError(http.StatusNotFound, ErrCodeNotFound, "%v", err)
+	case user.ErrExists:
+		return NewError(http.StatusConflict, ErrCodeConflict, "%v", err)
+	case user.ErrInvalidUser, user.ErrWeakPassword:
+		return NewError(http.StatusBadRequest, ErrCodeBadRequest, "%v", err)
+	case user.ErrUnauthorized, user.ErrInvalidToken:
+		return NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "%v", err)
+	}
+	return QueueError(err)
+}
+
+// account returns the user name of the session token in the request,
+// or empty for the anonymous request.
+func (srv *Server) account(req *http.Request) string {
+	if srv.users == nil {
+		return ""
+	}
+	token := ""
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	} else if c, err := req.Cookie(SessionCookie); err == nil {
+		token = c.Value
+	}
+	if token == "" {
+		return ""
+	}
+	name, err := srv.userTokens.Verify(token)
+	if err != nil {
+		glog.Warningf("ignored session token from %q (%v)", req.RemoteAddr, err)
+		return ""
+	}
+	return name
+}
+
+// accountUserID returns the user ID of the account, in place of the
+// generated ID of the anonymous requests, so that the request IDs of the
+// user do not depend on the client address.
+func accountUserID(name string) string {
+	return hashSha512("user/" + name)[:35]
+}
+
+// loginRequired returns the error if the request is anonymous,
+// and the login is required.
+func (srv *Server) loginRequired(ctx context.Context) *Error {
+	if name, _ := ctx.Value(accountKey).(string); !srv.requireLogin || name != "" {
+		return nil
+	}
+	return NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "login required")
+}
+
+// UserJobs returns the jobs of the user known to the backend,
+// sorted by creation time.
+func (srv *Server) UserJobs(name string) []queue.Item {
+	var items []queue.Item
+	for _, item := range srv.Jobs("", false) {
+		if item.User == name {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func usersDisabled(w http.ResponseWriter) error {
+	return writeError(w, NewError(http.StatusNotFound, ErrCodeNotFound, "user accounts are not enabled"))
+}
+
+// registerHandler registers the user on POST.
+func registerHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.users == nil {
+		return usersDisabled(w)
+	}
+	if req.Method != http.MethodPost {
+		return methodNotAllowed(w, req)
+	}
+
+	rb, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, req.Body)
+	req.Body.Close()
+
+	var rreq RegisterRequest
+	if err = json.Unmarshal(rb, &rreq); err != nil {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+	}
+	u, err := srv.users.Register(ctx, rreq.Name, rreq.Password, rreq.Profile)
+	if err != nil {
+		return writeError(w, UserError(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&u)
+}
+
+// loginHandler returns the session token of the user on POST,
+// and sets the session cookie.
+func loginHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.users == nil {
+		return usersDisabled(w)
+	}
+	if req.Method != http.MethodPost {
+		return methodNotAllowed(w, req)
+	}
+
+	rb, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, req.Body)
+	req.Body.Close()
+
+	var lreq LoginRequest
+	if err = json.Unmarshal(rb, &lreq); err != nil {
+		return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+	}
+	u, err := srv.users.Authenticate(ctx, lreq.Name, lreq.Password)
+	if err != nil {
+		glog.Warningf("failed login of %q from %q (%v)", lreq.Name, req.RemoteAddr, err)
+		srv.Audit(audit.Entry{Action: "user.login", Actor: lreq.Name, IP: clientIP(req), Target: req.URL.Path, Outcome: auditOutcome(UserError(err).Status), Detail: err.Error()})
+		return writeError(w, UserError(err))
+	}
+	token, expiresAt, err := srv.userTokens.Issue(u.Name, time.Now())
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+	})
+	glog.Infof("user %q logged in from %q", u.Name, req.RemoteAddr)
+	srv.Audit(audit.Entry{Action: "user.login", Actor: u.Name, IP: clientIP(req), Target: req.URL.Path, Outcome: audit.OutcomeSuccess})
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&LoginResponse{Token: token, ExpiresAt: expiresAt, User: u})
+}
+
+// meHandler returns the user of the session on GET,
+// and updates the user on POST.
+func meHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.users == nil {
+		return usersDisabled(w)
+	}
+	name := ctx.Value(accountKey).(string)
+	if name == "" {
+		return writeError(w, NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "login required"))
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		u, err := srv.users.Get(ctx, name)
+		if err != nil {
+			return writeError(w, UserError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&u)
+
+	case http.MethodPost:
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var upd UserUpdate
+		if err = json.Unmarshal(rb, &upd); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if upd.NewPassword != "" {
+			if err = srv.users.ChangePassword(ctx, name, upd.Password, upd.NewPassword); err != nil {
+				return writeError(w, UserError(err))
+			}
+		}
+		if upd.Profile != nil {
+			if _, err = srv.users.UpdateProfile(ctx, name, *upd.Profile); err != nil {
+				return writeError(w, UserError(err))
+			}
+		}
+		if len(upd.Settings) > 0 {
+			if _, err = srv.users.UpdateSettings(ctx, name, upd.Settings); err != nil {
+				return writeError(w, UserError(err))
+			}
+		}
+		u, err := srv.users.Get(ctx, name)
+		if err != nil {
+			return writeError(w, UserError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(&u)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
+
+// userJobsHandler returns the jobs of the user of the session on GET.
+func userJobsHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+	if srv.users == nil {
+		return usersDisabled(w)
+	}
+	if req.Method != http.MethodGet {
+		return methodNotAllowed(w, req)
+	}
+	name := ctx.Value(accountKey).(string)
+	if name == "" {
+		return writeError(w, NewError(http.StatusUnauthorized, ErrCodeUnauthorized, "login required"))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(srv.UserJobs(name))
+}
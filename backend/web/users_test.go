@@ -0,0 +1,174 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/user"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUsers(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 30379, 30380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	srv := &Server{
+		qu:           qu,
+		users:        user.New(qu.Client(), user.Config{BcryptCost: bcrypt.MinCost}),
+		userTokens:   user.Tokens{Secret: []byte("secret")},
+		requireLogin: true,
+	}
+	cache := lru.NewInMemory(imageCacheSize)
+	serve := func(h ContextHandlerFunc, schemas Schemas, method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		if err := with(withValidation(h, schemas), srv, qu, cache).ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if w := serve(registerHandler, registerSchemas, http.MethodPost, "/users/register", "", `{"name": "alice", "password": "correct horse", "email": "alice@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if w := serve(registerHandler, registerSchemas, http.MethodPost, "/users/register", "", `{"name": "alice", "password": "correct horse"}`); w.Code != http.StatusConflict {
+		t.Fatalf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := serve(loginHandler, loginSchemas, http.MethodPost, "/users/login", "", `{"name": "alice", "password": "wrong password"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w := serve(loginHandler, loginSchemas, http.MethodPost, "/users/login", "", `{"name": "alice", "password": "correct horse"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Name != SessionCookie || !c[0].HttpOnly {
+		t.Fatalf("unexpected cookies %+v", c)
+	}
+	var lresp LoginResponse
+	if err = json.NewDecoder(w.Body).Decode(&lresp); err != nil {
+		t.Fatal(err)
+	}
+	token := lresp.Token
+
+	// anonymous (or invalid token) requests need login
+	for _, tk := range []string{"", "invalid"} {
+		if w = serve(meHandler, meSchemas, http.MethodGet, "/users/me", tk, ""); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+	if w = serve(clientRequestHandler, clientRequestSchemas, http.MethodPost, "/cats-request", "", `{"data_from_frontend": "/tmp/cat.jpg", "create_request": true}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = serve(meHandler, meSchemas, http.MethodPost, "/users/me", token, `{"profile": {"display_name": "Alice"}, "settings": {"theme": "dark"}, "password": "correct horse", "new_password": "new password"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	var u user.User
+	if err = json.NewDecoder(w.Body).Decode(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "alice" || u.DisplayName != "Alice" || u.Settings["theme"] != "dark" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Fatalf("password hash in response %s", w.Body)
+	}
+	if w = serve(loginHandler, loginSchemas, http.MethodPost, "/users/login", "", `{"name": "alice", "password": "new password"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+
+	mine := queue.CreateItem("/cats-request", 100, "mine")
+	mine.RequestID, mine.User = "mine-id", "alice"
+	other := queue.CreateItem("/cats-request", 100, "other")
+	other.RequestID = "other-id"
+	srv.requestCache.Store(mine.RequestID, mine)
+	srv.requestCache.Store(other.RequestID, other)
+	w = serve(userJobsHandler, nil, http.MethodGet, "/users/jobs", token, "")
+	var items []queue.Item
+	if err = json.NewDecoder(w.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].RequestID != "mine-id" {
+		t.Fatalf("unexpected jobs %+v", items)
+	}
+}
+
+func TestAdminRole(t *testing.T) {
+	srv := &Server{
+		users:      user.New(nil, user.Config{}),
+		userTokens: user.Tokens{Secret: []byte("secret")},
+		admins:     map[string]bool{"root": true},
+		csrfSecret: []byte("secret"),
+	}
+	h := with(withAdmin(ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		return nil
+	})), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		account    string
+		cookie     bool
+		csrf       bool
+		code       int
+	}{
+		{"anonymous", "192.0.2.1:1234", "", false, false, http.StatusUnauthorized},
+		// the loopback is not trusted with the user accounts
+		{"anonymous loopback", "127.0.0.1:1234", "", false, false, http.StatusUnauthorized},
+		{"user", "192.0.2.1:1234", "alice", false, false, http.StatusForbidden},
+		{"admin", "192.0.2.1:1234", "root", false, false, http.StatusOK},
+		// the browsers send the session cookie, also on the cross-site requests
+		{"admin cookie", "192.0.2.1:1234", "root", true, false, http.StatusForbidden},
+		{"admin cookie with CSRF token", "192.0.2.1:1234", "root", true, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.account != "" {
+				token, _, err := srv.userTokens.Issue(tt.account, time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.cookie {
+					req.Header.Set("Cookie", SessionCookie+"="+token)
+				} else {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+			}
+			if tt.csrf {
+				req.Header.Set(CSRFHeader, srv.csrfToken(req))
+			}
+			w := httptest.NewRecorder()
+			if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.code {
+				t.Fatalf("expected %d, got %d (%s)", tt.code, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+// FieldType is the JSON type of a request field.
+type FieldType string
+
+const (
+	// TypeString is JSON string.
+	TypeString FieldType = "string"
+	// TypeNumber is JSON number.
+	TypeNumber FieldType = "number"
+	// TypeBool is JSON boolean.
+	TypeBool FieldType = "bool"
+	// TypeStringMap is JSON object with string values.
+	TypeStringMap FieldType = "string_map"
+	// TypeObject is JSON object.
+	TypeObject FieldType = "object"
+	// TypeStringList is JSON array of strings.
+	TypeStringList FieldType = "string_list"
+)
+
+// Field defines the expected JSON field in the request body.
+type Field struct {
+	Name     string
+	Type     FieldType
+	Required bool
+
+	// NonEmpty is true if string field must not be empty.
+	NonEmpty bool
+	// MaxLen is the maximum length of string or list field (0 for no limit).
+	MaxLen int
+	// Enum lists the allowed string values (empty to allow any).
+	Enum []string
+
+	// Min and Max are the range of number field (nil for no limit).
+	Min *float64
+	Max *float64
+}
+
+// Schema defines the expected request of an endpoint for a method.
+type Schema struct {
+	// Headers lists the required headers.
+	Headers []string
+	// Fields lists the expected JSON fields in the request body.
+	Fields []Field
+	// AllowUnknown is true to allow fields not defined in the schema.
+	AllowUnknown bool
+}
+
+// Schemas maps HTTP method to its request schema.
+// Requests with methods not in the map are passed through.
+type Schemas map[string]Schema
+
+// FieldError describes the validation failure on a single field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// maxValidateBodySize is the maximum size of request body to validate.
+const maxValidateBodySize = 1 << 20 // 1 MB
+
+func float64Ptr(v float64) *float64 { return &v }
+
+// withValidation validates requests against the schema of the method,
+// before passing to the handler. Malformed requests are rejected with 400
+// and field-level error details.
+func withValidation(h ContextHandler, schemas Schemas) ContextHandler {
+	return ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		sc, ok := schemas[req.Method]
+		if !ok {
+			return h.ServeHTTPContext(ctx, w, req)
+		}
+
+		var ferrs []FieldError
+		for _, k := range sc.Headers {
+			if req.Header.Get(k) == "" {
+				ferrs = append(ferrs, FieldError{Field: k, Message: "required header is missing"})
+			}
+		}
+
+		if len(sc.Fields) > 0 {
+			var r io.Reader = req.Body
+			if req.Header.Get("Content-Encoding") == "gzip" {
+				// e.g. log lines shipped by worker supervisors
+				gr, err := fileutil.NewGzipReader(req.Body)
+				if err != nil {
+					return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "gzip error %q", err.Error()))
+				}
+				defer gr.Close()
+				r = gr
+				req.Header.Del("Content-Encoding")
+			}
+			// the size limit applies to the decompressed body
+			rb, err := ioutil.ReadAll(io.LimitReader(r, maxValidateBodySize+1))
+			if err != nil {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "failed to read body %q", err.Error()))
+			}
+			req.Body.Close()
+			if len(rb) > maxValidateBodySize {
+				return writeError(w, NewError(http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "request body exceeds %d bytes", maxValidateBodySize))
+			}
+			// restore body for the handler
+			req.Body = ioutil.NopCloser(bytes.NewReader(rb))
+
+			body := make(map[string]interface{})
+			if err = json.Unmarshal(rb, &body); err != nil {
+				return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+			}
+			ferrs = append(ferrs, sc.validate(body)...)
+		}
+
+		if len(ferrs) > 0 {
+			aerr := NewError(http.StatusBadRequest, ErrCodeBadRequest, "invalid request on %q (%d field errors)", req.URL.Path, len(ferrs))
+			aerr.Fields = ferrs
+			return writeError(w, aerr)
+		}
+		return h.ServeHTTPContext(ctx, w, req)
+	})
+}
+
+func (sc Schema) validate(body map[string]interface{}) (ferrs []FieldError) {
+	known := make(map[string]struct{}, len(sc.Fields))
+	for _, f := range sc.Fields {
+		known[f.Name] = struct{}{}
+
+		v, ok := body[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				ferrs = append(ferrs, FieldError{Field: f.Name, Message: "required field is missing"})
+			}
+			continue
+		}
+		if msg := f.validate(v); msg != "" {
+			ferrs = append(ferrs, FieldError{Field: f.Name, Message: msg})
+		}
+	}
+
+	if !sc.AllowUnknown {
+		var unknown []string
+		for k := range body {
+			if _, ok := known[k]; !ok {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		for _, k := range unknown {
+			ferrs = append(ferrs, FieldError{Field: k, Message: "unknown field"})
+		}
+	}
+	return ferrs
+}
+
+func (f Field) validate(v interface{}) string {
+	switch f.Type {
+	case TypeString:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Sprintf("expected string, got %T", v)
+		}
+		if f.NonEmpty && s == "" {
+			return "must not be empty"
+		}
+		if f.MaxLen > 0 && len(s) > f.MaxLen {
+			return fmt.Sprintf("length %d exceeds %d", len(s), f.MaxLen)
+		}
+		if len(f.Enum) > 0 {
+			for _, e := range f.Enum {
+				if s == e {
+					return ""
+				}
+			}
+			return fmt.Sprintf("%q is not one of %q", s, f.Enum)
+		}
+
+	case TypeNumber:
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Sprintf("expected number, got %T", v)
+		}
+		if f.Min != nil && n < *f.Min {
+			return fmt.Sprintf("%v is less than %v", n, *f.Min)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fmt.Sprintf("%v is greater than %v", n, *f.Max)
+		}
+
+	case TypeBool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Sprintf("expected bool, got %T", v)
+		}
+
+	case TypeStringList:
+		l, ok := v.([]interface{})
+		if !ok {
+			return fmt.Sprintf("expected array, got %T", v)
+		}
+		if f.MaxLen > 0 && len(l) > f.MaxLen {
+			return fmt.Sprintf("length %d exceeds %d", len(l), f.MaxLen)
+		}
+		for i, lv := range l {
+			if _, ok = lv.(string); !ok {
+				return fmt.Sprintf("expected string at index %d, got %T", i, lv)
+			}
+		}
+
+	case TypeObject:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return fmt.Sprintf("expected object, got %T", v)
+		}
+
+	case TypeStringMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("expected object, got %T", v)
+		}
+		for k, mv := range m {
+			if _, ok = mv.(string); !ok {
+				return fmt.Sprintf("expected string value for %q, got %T", k, mv)
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	// clientRequestSchemas validates requests from frontend.
+	clientRequestSchemas = Schemas{
+		http.MethodGet: {Headers: []string{RequestIDHeader}},
+		http.MethodPost: {Fields: []Field{
+			{Name: "data_from_frontend", Type: TypeString, Required: true, MaxLen: 2048},
+			{Name: "create_request", Type: TypeBool, Required: true},
+		}},
+	}
+
+	// queueSchemas validates requests from workers.
+	queueSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "bucket", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "created_at", Type: TypeString},
+			{Name: "key", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "value", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "progress", Type: TypeNumber, Required: true, Min: float64Ptr(0), Max: float64Ptr(100)},
+			{Name: "canceled", Type: TypeBool},
+			{Name: "error", Type: TypeString},
+			{Name: "request_id", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "job_type", Type: TypeString},
+			{Name: "gpu", Type: TypeBool},
+			{Name: "stage_progress", Type: TypeObject},
+			{Name: "timed_out", Type: TypeBool},
+			{Name: "requeue", Type: TypeBool},
+			{Name: "attempts", Type: TypeNumber, Min: float64Ptr(0)},
+			{Name: "worker_version", Type: TypeString},
+			{Name: "user", Type: TypeString},
+		}},
+	}
+
+	// workersSchemas validates liveness reports from worker supervisors.
+	workersSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "id", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "name", Type: TypeString, Required: true},
+			{Name: "host", Type: TypeString},
+			{Name: "pid", Type: TypeNumber, Min: float64Ptr(0)},
+			{Name: "alive", Type: TypeBool, Required: true},
+			{Name: "restarts", Type: TypeNumber, Min: float64Ptr(0)},
+			{Name: "last_exit", Type: TypeString},
+			{Name: "labels", Type: TypeStringMap},
+			{Name: "usage", Type: TypeObject},
+			{Name: "buckets", Type: TypeStringList},
+			{Name: "health_url", Type: TypeString},
+			{Name: "healthy", Type: TypeBool},
+			{Name: "health_error", Type: TypeString},
+			{Name: "protocol", Type: TypeNumber, Min: float64Ptr(0)},
+			{Name: "draining", Type: TypeBool},
+			{Name: "drain", Type: TypeBool},
+			{Name: "updated_at", Type: TypeString},
+		}},
+	}
+
+	// logsSchemas validates log lines from workers.
+	logsSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "request_id", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "lines", Type: TypeStringList, Required: true, MaxLen: 1000},
+		}},
+	}
+
+	// maintenanceSchemas validates requests to the admin maintenance endpoint.
+	maintenanceSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "enabled", Type: TypeBool, Required: true},
+			{Name: "message", Type: TypeString, MaxLen: 512},
+		}},
+	}
+
+	// canarySchemas validates requests to the admin canary endpoint.
+	canarySchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "version", Type: TypeString, Required: true, MaxLen: 256},
+			{Name: "percent", Type: TypeNumber, Required: true, Min: float64Ptr(0), Max: float64Ptr(100)},
+		}},
+	}
+
+	// coordinatorSchemas validates requests to the admin coordinator endpoint.
+	coordinatorSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "paused", Type: TypeBool},
+			{Name: "drains", Type: TypeStringList, MaxLen: 1000},
+		}},
+	}
+
+	// jobsSchemas validates requests to the admin jobs endpoint.
+	jobsSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "request_id", Type: TypeString, Required: true, NonEmpty: true},
+			{Name: "cancel", Type: TypeBool},
+		}},
+	}
+
+	// adminQueueSchemas validates requests to the admin queue endpoint.
+	adminQueueSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "bucket", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "purge", Type: TypeBool},
+			{Name: "redrive", Type: TypeBool},
+		}},
+	}
+
+	// modelsSchemas validates requests to the admin models endpoint.
+	modelsSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "name", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "version", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "framework", Type: TypeString, MaxLen: 256},
+			{Name: "metrics", Type: TypeObject},
+			{Name: "artifact_uri", Type: TypeString, MaxLen: 2048},
+			{Name: "created_at", Type: TypeString},
+			{Name: "promote", Type: TypeBool},
+		}},
+	}
+
+	// experimentsSchemas validates the runs started by training jobs.
+	experimentsSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "id", Type: TypeString, MaxLen: 256},
+			{Name: "experiment", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "params", Type: TypeStringMap},
+		}},
+	}
+
+	// experimentRunSchemas validates the epoch metrics and final scores
+	// of the runs.
+	experimentRunSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "run_id", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 256},
+			{Name: "epoch", Type: TypeObject},
+			{Name: "finished", Type: TypeBool},
+			{Name: "scores", Type: TypeObject},
+			{Name: "error", Type: TypeString, MaxLen: 4096},
+		}},
+	}
+
+	// registerSchemas validates requests to register the users.
+	registerSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "name", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 64},
+			{Name: "password", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 72},
+			{Name: "email", Type: TypeString, MaxLen: 256},
+			{Name: "display_name", Type: TypeString, MaxLen: 256},
+		}},
+	}
+
+	// loginSchemas validates requests to log in.
+	loginSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "name", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 64},
+			{Name: "password", Type: TypeString, Required: true, NonEmpty: true, MaxLen: 72},
+		}},
+	}
+
+	// meSchemas validates requests to update the user of the session.
+	meSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "profile", Type: TypeObject},
+			{Name: "settings", Type: TypeStringMap},
+			{Name: "password", Type: TypeString, MaxLen: 72},
+			{Name: "new_password", Type: TypeString, MaxLen: 72},
+		}},
+	}
+
+	// pipelinesSchemas validates requests to start and cancel the
+	// pipeline runs.
+	pipelinesSchemas = Schemas{
+		http.MethodPost: {Fields: []Field{
+			{Name: "pipeline", Type: TypeString, MaxLen: 256},
+			{Name: "definition", Type: TypeObject},
+			{Name: "input", Type: TypeString},
+			{Name: "id", Type: TypeString, MaxLen: 256},
+			{Name: "cancel", Type: TypeBool},
+		}},
+	}
+)
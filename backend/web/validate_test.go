@@ -0,0 +1,113 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	called := false
+	h := withValidation(ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		called = true
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		if req.Method == http.MethodPost && len(rb) == 0 {
+			t.Fatal("expected body to be restored")
+		}
+		return nil
+	}), queueSchemas)
+
+	tests := []struct {
+		body   string
+		fields []FieldError
+	}{
+		{
+			`{"bucket": "/cats-request", "key": "k", "value": "v", "progress": 100, "request_id": "id"}`,
+			nil,
+		},
+		{
+			`{"bucket": "", "key": "k", "value": "v", "progress": 101, "foo": 1}`,
+			[]FieldError{
+				{Field: "bucket", Message: "must not be empty"},
+				{Field: "progress", Message: "101 is greater than 100"},
+				{Field: "request_id", Message: "required field is missing"},
+				{Field: "foo", Message: "unknown field"},
+			},
+		},
+		{
+			`{"bucket": 1, "key": "k", "value": "v", "progress": "0", "request_id": "id"}`,
+			[]FieldError{
+				{Field: "bucket", Message: "expected string, got float64"},
+				{Field: "progress", Message: "expected number, got string"},
+			},
+		},
+	}
+	for i, tt := range tests {
+		called = false
+		req := httptest.NewRequest(http.MethodPost, "/cats-request/queue", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if len(tt.fields) == 0 {
+			if !called || w.Code != http.StatusOK {
+				t.Fatalf("#%d: expected handler call, got %d", i, w.Code)
+			}
+			continue
+		}
+		if called || w.Code != http.StatusBadRequest {
+			t.Fatalf("#%d: expected 400, got %d (handler called %v)", i, w.Code, called)
+		}
+		var aerr Error
+		if err := json.NewDecoder(w.Body).Decode(&aerr); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(aerr.Fields, tt.fields) {
+			t.Fatalf("#%d: expected %+v, got %+v", i, tt.fields, aerr.Fields)
+		}
+	}
+
+	// methods without schema are passed through
+	called = false
+	req := httptest.NewRequest(http.MethodGet, "/cats-request/queue", nil)
+	if err := h.ServeHTTPContext(context.Background(), httptest.NewRecorder(), req); err != nil || !called {
+		t.Fatalf("expected handler call, got %v", called)
+	}
+}
+
+func TestValidationGzip(t *testing.T) {
+	var got LogsRequest
+	h := withValidation(ContextHandlerFunc(func(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+		if req.Header.Get("Content-Encoding") != "" {
+			t.Fatal("expected Content-Encoding removed")
+		}
+		return json.NewDecoder(req.Body).Decode(&got)
+	}), logsSchemas)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(`{"request_id": "/cats-request-a", "lines": ["classifying"]}`))
+	gw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/cats-request/logs", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+	}
+	if want := (LogsRequest{RequestID: "/cats-request-a", Lines: []string{"classifying"}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/version"
+
+	"github.com/golang/glog"
+)
+
+// GetVersion returns the build and version information,
+// with etcd server version fetched from the queue service.
+func GetVersion(ctx context.Context, qu queue.Queue) version.Info {
+	info := version.Get()
+	if qu == nil || qu.Client() == nil {
+		return info
+	}
+	eps := qu.ClientEndpoints()
+	if len(eps) == 0 {
+		return info
+	}
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	resp, err := qu.Client().Status(cctx, eps[0])
+	cancel()
+	if err != nil {
+		glog.Warningf("failed to fetch etcd server version from %q (%v)", eps[0], err)
+		return info
+	}
+	info.EtcdServerVersion = resp.Version
+	return info
+}
+
+func versionHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	qu := ctx.Value(queueKey).(queue.Queue)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(GetVersion(ctx, qu))
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/tracing"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/golang/glog"
+)
+
+// workerTTL is the duration after which workers without
+// liveness reports are removed from the registry.
+const workerTTL = 5 * time.Minute
+
+// WithWorkerToken configures the shared secret that workers must send
+// in the workerproc.TokenHeader to register. Without a token, only the
+// admins can register workers.
+func WithWorkerToken(token string) ServerOpOption {
+	return func(op *ServerOp) { op.workerToken = token }
+}
+
+// workerRequired returns an error if the request is not
+// from a worker holding the token, nor from an admin.
+func (srv *Server) workerRequired(ctx context.Context, req *http.Request) *Error {
+	if tok := req.Header.Get(workerproc.TokenHeader); tok != "" {
+		if srv.workerToken != "" && hmac.Equal([]byte(tok), []byte(srv.workerToken)) {
+			return nil
+		}
+		return NewError(http.StatusForbidden, ErrCodeForbidden, "invalid worker token")
+	}
+	return srv.adminRequired(ctx, req)
+}
+
+// Workers returns the workers in the registry, sorted by ID.
+func (srv *Server) Workers() []workerproc.Liveness {
+	var ws []workerproc.Liveness
+	srv.workers.Range(func(k, v interface{}) bool {
+		l := v.(workerproc.Liveness)
+		if time.Since(l.UpdatedAt) > workerTTL {
+			glog.Warningf("removing worker %q (no report since %s)", l.ID, l.UpdatedAt)
+			srv.workers.Delete(k)
+			srv.notify(notify.Event{
+				Type:    notify.EventWorkerLost,
+				Worker:  l.ID,
+				Message: fmt.Sprintf("removed worker %q (no report since %s)", l.ID, l.UpdatedAt),
+			})
+			return true
+		}
+		ws = append(ws, l)
+		return true
+	})
+	sort.Slice(ws, func(i, j int) bool { return ws[i].ID < ws[j].ID })
+	return ws
+}
+
+func workersHandler(ctx context.Context, w http.ResponseWriter, req *http.Request) error {
+	srv := ctx.Value(serverKey).(*Server)
+
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(srv.Workers())
+
+	case http.MethodPost:
+		if aerr := srv.workerRequired(ctx, req); aerr != nil {
+			glog.Warningf("refused worker registration from %q (%v)", req.RemoteAddr, aerr)
+			return writeError(w, aerr)
+		}
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+
+		var l workerproc.Liveness
+		if err = json.Unmarshal(rb, &l); err != nil {
+			return writeError(w, NewError(http.StatusBadRequest, ErrCodeBadRequest, "JSON parse error %q", err.Error()))
+		}
+		if aerr := protocolError(l.Protocol); aerr != nil {
+			glog.Warningf("refused worker %q (%v)", l.ID, aerr.Message)
+			srv.notify(notify.Event{
+				Type:    notify.EventWorkerRefused,
+				Worker:  l.ID,
+				Message: fmt.Sprintf("refused worker %q (%s)", l.ID, aerr.Message),
+			})
+			return writeError(w, aerr)
+		}
+		// use server time, to not depend on worker clocks
+		l.UpdatedAt = time.Now()
+		// health is set by the registry, not by workers
+		l.Healthy, l.HealthError = l.Alive, ""
+		if old, ok := srv.workers.Load(l.ID); ok {
+			ol := old.(workerproc.Liveness)
+			if ol.Alive != l.Alive {
+				glog.Infof("worker %q is alive %v (restarts %d, last exit %q)", l.ID, l.Alive, l.Restarts, l.LastExit)
+				if !l.Alive {
+					srv.notify(notify.Event{
+						Type:    notify.EventWorkerExited,
+						Worker:  l.ID,
+						Message: fmt.Sprintf("worker %q exited (restarts %d, last exit %q)", l.ID, l.Restarts, l.LastExit),
+					})
+				}
+			}
+			if l.Draining && !ol.Draining {
+				glog.Infof("worker %q is draining", l.ID)
+			}
+			if l.HealthURL != "" {
+				// keep the last probe result until the next health check
+				l.Healthy, l.HealthError = l.Alive && ol.Healthy, ol.HealthError
+			}
+		} else {
+			srv.notify(notify.Event{
+				Type:    notify.EventWorkerRegistered,
+				Worker:  l.ID,
+				Message: fmt.Sprintf("registered worker %q for %v", l.ID, l.Buckets),
+			})
+		}
+		srv.workers.Store(l.ID, l)
+		// drain is set by the registry, on the coordinator decisions
+		l.Drain = srv.drainRequested(l.ID)
+		if l.Usage != nil {
+			tracing.GetGauge("worker.memory.usage", "Memory usage of the worker process.", "By").Set(l.Usage.MemoryBytes, "worker.id", l.ID)
+			tracing.GetGauge("worker.cpu.time", "CPU time of the worker process.", "ms").Set(int64(l.Usage.CPUSeconds*1000), "worker.id", l.ID)
+			tracing.GetGauge("worker.oom_kills", "Number of OOM kills in the worker process.", "{kill}").Set(l.Usage.OOMKills, "worker.id", l.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(l)
+
+	default:
+		return methodNotAllowed(w, req)
+	}
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/lru"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestWorkers(t *testing.T) {
+	srv := &Server{workerToken: "secret"}
+	h := with(withValidation(ContextHandlerFunc(workersHandler), workersSchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+	req := httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(`{"id": "host-cats-1", "name": "cats", "pid": 10, "alive": true, "labels": {"gpu": "true", "gpu.count": "1"}, "usage": {"cpu_seconds": 1.5, "memory_bytes": 1048576}}`))
+	req.Header.Set(workerproc.TokenHeader, "secret")
+	w := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// missing required 'alive'
+	req = httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(`{"id": "host-cats-2", "name": "cats"}`))
+	req.Header.Set(workerproc.TokenHeader, "secret")
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// labels must be strings
+	req = httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(`{"id": "host-cats-3", "name": "cats", "alive": true, "labels": {"gpu.count": 1}}`))
+	req.Header.Set(workerproc.TokenHeader, "secret")
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/workers", nil)
+	w = httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	var ws []workerproc.Liveness
+	if err := json.NewDecoder(w.Body).Decode(&ws); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws) != 1 || ws[0].ID != "host-cats-1" || !ws[0].Alive || ws[0].PID != 10 || ws[0].Labels["gpu"] != "true" || ws[0].Usage == nil || ws[0].Usage.MemoryBytes != 1<<20 {
+		t.Fatalf("unexpected workers %+v", ws)
+	}
+}
+
+func TestWorkersRegistrationAuth(t *testing.T) {
+	tests := []struct {
+		token      string
+		remoteAddr string
+		header     string
+		code       int
+	}{
+		{"", "192.0.2.1:1234", "", http.StatusForbidden},
+		{"", "192.0.2.1:1234", "secret", http.StatusForbidden},
+		{"", "127.0.0.1:1234", "", http.StatusOK},
+		{"secret", "192.0.2.1:1234", "", http.StatusForbidden},
+		{"secret", "192.0.2.1:1234", "wrong", http.StatusForbidden},
+		{"secret", "192.0.2.1:1234", "secret", http.StatusOK},
+	}
+	for i, tt := range tests {
+		srv := &Server{workerToken: tt.token}
+		h := with(withValidation(ContextHandlerFunc(workersHandler), workersSchemas), srv, &nopQueue{t: t}, lru.NewInMemory(imageCacheSize))
+
+		req := httptest.NewRequest(http.MethodPost, "/workers", strings.NewReader(`{"id": "host-cats-1", "name": "cats", "alive": true}`))
+		req.RemoteAddr = tt.remoteAddr
+		if tt.header != "" {
+			req.Header.Set(workerproc.TokenHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		if err := h.ServeHTTPContext(context.Background(), w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tt.code {
+			t.Fatalf("#%d: expected %d, got %d", i, tt.code, w.Code)
+		}
+		if n := len(srv.Workers()); (tt.code == http.StatusOK) != (n == 1) {
+			t.Fatalf("#%d: unexpected %d workers", i, n)
+		}
+	}
+}
@@ -62,7 +62,7 @@ def update_parameters(parameters, grads, learning_rate):
     return parameters
 
 
-def L_layer(X, Y, layers_dims, learning_rate=0.0075, num_iterations=3000, print_cost=True):
+def L_layer(X, Y, layers_dims, learning_rate=0.0075, num_iterations=3000, print_cost=True, on_cost=None):
     """
     Implements a L-layer neural network: [LINEAR->RELU]*(L-1)->LINEAR->SIGMOID.
 
@@ -73,6 +73,8 @@ def L_layer(X, Y, layers_dims, learning_rate=0.0075, num_iterations=3000, print_
     learning_rate -- learning rate of the gradient descent update rule
     num_iterations -- number of iterations of the optimization loop
     print_cost -- if True, it prints the cost every 100 steps
+    on_cost -- if given, it is called with the iteration and the cost every 100 steps
+               (e.g. to record to the experiment tracking, see experiment.py)
 
     Returns:
     parameters -- parameters learnt by the model. They can then be used to predict.
@@ -98,6 +100,8 @@ def L_layer(X, Y, layers_dims, learning_rate=0.0075, num_iterations=3000, print_
             log.info("Cost after iteration %i: %f" %(i, cost))
         if print_cost and i % 100 == 0:
             costs.append(cost)
+        if on_cost is not None and i % 100 == 0:
+            on_cost(i, cost)
 
     # plot the cost
     # plt.plot(np.squeeze(costs))
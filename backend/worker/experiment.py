@@ -0,0 +1,73 @@
+# -*- coding: utf-8 -*-
+"""This script records training runs to the experiment tracking
+of backend/web (backend-web-server -experiments), so that the results
+of repeated training runs can be compared with 'dplearn-ctl compare'.
+
+    client = ExperimentClient('http://localhost:2200')
+    run_id = client.start_run('cats', {'learning_rate': 0.0075})
+    parameters = L_layer(train_x, train_y, layers_dims,
+                         on_cost=lambda i, cost: client.log_epoch(run_id, i, cost=cost))
+    client.finish_run(run_id, {'test_accuracy': 0.8})
+"""
+
+from __future__ import print_function
+
+import json
+
+import requests
+
+
+class ExperimentError(Exception):
+    """ExperimentError is raised with the error response
+    from the experiment tracking.
+    """
+
+    def __init__(self, status, message):
+        Exception.__init__(self, '{0}: {1}'.format(status, message))
+        self.status = status
+
+
+class ExperimentClient(object):
+    """ExperimentClient is the HTTP client of the experiment tracking
+    (e.g. http://localhost:2200). 'session' defaults to the requests module.
+    """
+
+    def __init__(self, endpoint, session=None, timeout=5):
+        self.endpoint = endpoint.rstrip('/')
+        self.session = session or requests
+        self.timeout = timeout
+
+    def post(self, path, data):
+        rresp = self.session.post(self.endpoint + path, data=json.dumps(data),
+                                  timeout=self.timeout,
+                                  headers={'Content-Type': 'application/json'})
+        if rresp.status_code != 200:
+            raise ExperimentError(rresp.status_code, rresp.text)
+        return json.loads(rresp.text)
+
+    def start_run(self, experiment, params, run_id=''):
+        """start_run starts the run of the experiment with the hyperparameters,
+        and returns the run ID (generated if empty).
+        """
+        run = {'experiment': experiment,
+               'params': dict((k, str(v)) for k, v in params.items())}
+        if run_id:
+            run['id'] = run_id
+        return self.post('/experiments', run)['id']
+
+    def log_epoch(self, run_id, epoch, **metrics):
+        """log_epoch records the metrics of the epoch (or the iteration step).
+        """
+        self.post('/experiments/run', {
+            'run_id': run_id,
+            'epoch': {'epoch': epoch, 'metrics': dict((k, float(v)) for k, v in metrics.items())},
+        })
+
+    def finish_run(self, run_id, scores=None, error=''):
+        """finish_run records the final scores, and marks the run completed,
+        or failed if error is not empty.
+        """
+        update = {'run_id': run_id, 'finished': True, 'error': error}
+        if scores:
+            update['scores'] = dict((k, float(v)) for k, v in scores.items())
+        return self.post('/experiments/run', update)
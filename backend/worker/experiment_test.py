@@ -0,0 +1,58 @@
+# -*- coding: utf-8 -*-
+
+from __future__ import print_function
+
+import json
+import unittest
+
+from .experiment import ExperimentClient, ExperimentError
+
+
+class FakeResponse(object):
+    def __init__(self, status_code, text):
+        self.status_code = status_code
+        self.text = text
+
+
+class FakeSession(object):
+    """FakeSession records the requests, and responds with the run.
+    """
+
+    def __init__(self):
+        self.requests = []
+
+    def post(self, url, data=None, timeout=None, headers=None):
+        body = json.loads(data)
+        self.requests.append((url, body))
+        if body.get('run_id') == 'unknown':
+            return FakeResponse(404, '{"code": "not_found"}')
+        return FakeResponse(200, json.dumps({'id': body.get('id', 'generated'), 'status': 'running'}))
+
+
+class TestExperimentClient(unittest.TestCase):
+    def test_run(self):
+        session = FakeSession()
+        client = ExperimentClient('http://localhost:2200/', session=session)
+
+        run_id = client.start_run('cats', {'learning_rate': 0.0075, 'num_iterations': 2500})
+        self.assertEqual(run_id, 'generated')
+        url, body = session.requests[-1]
+        self.assertEqual(url, 'http://localhost:2200/experiments')
+        self.assertEqual(body['params'], {'learning_rate': '0.0075', 'num_iterations': '2500'})
+        self.assertNotIn('id', body)
+
+        client.log_epoch(run_id, 100, cost=0.5)
+        url, body = session.requests[-1]
+        self.assertEqual(url, 'http://localhost:2200/experiments/run')
+        self.assertEqual(body['epoch'], {'epoch': 100, 'metrics': {'cost': 0.5}})
+
+        client.finish_run(run_id, {'test_accuracy': 1})
+        _, body = session.requests[-1]
+        self.assertEqual(body, {'run_id': 'generated', 'finished': True, 'error': '',
+                                'scores': {'test_accuracy': 1.0}})
+
+        self.assertRaises(ExperimentError, client.log_epoch, 'unknown', 0, cost=0.1)
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,114 @@
+# -*- coding: utf-8 -*-
+"""This script serves the model predictions as a sidecar of cmd/worker-go.
+
+The Go worker claims jobs from the queue, and translates each job into
+a local HTTP request on the unix socket (see pkg/worker.SidecarConfig):
+
+    GET  /healthz  returns 200 once the model is loaded
+    POST /predict  {"request_id", "job_type", "value"}
+                   returns {"value", "error", "logs"}
+
+    worker-go -sidecar 'python3 backend/worker/model_server.py'
+"""
+
+from __future__ import print_function
+
+import json
+import os
+import os.path
+import socketserver
+import sys
+from http.server import BaseHTTPRequestHandler
+
+import numpy as np
+import glog as log
+
+from cats.model import classify
+
+
+def predict(req, parameters):
+    """predict returns the response of the prediction request.
+    Jobs without type (created before job routing) are processed as 'cats-vs-dogs'.
+    """
+    job_type, image_path = req.get('job_type', ''), req.get('value', '')
+    if job_type not in ['', 'cats-vs-dogs']:
+        return {'value': '', 'error': 'job type {0} is not supported by model server'.format(job_type), 'logs': []}
+    if not os.path.exists(image_path):
+        return {'value': '', 'error': 'cannot find image {0}'.format(image_path), 'logs': []}
+
+    img_class = classify(image_path, parameters)
+    return {
+        'value': "[WORKER - ACK] it's a '{0}'!".format(img_class),
+        'error': '',
+        'logs': ['classified image {0} as {1}'.format(os.path.basename(image_path), img_class)],
+    }
+
+
+class Handler(BaseHTTPRequestHandler):
+    """Handler serves the predictions with the parameters of the server.
+    """
+
+    def address_string(self):
+        # unix socket has no client address
+        return 'sidecar'
+
+    def reply(self, status, body):
+        data = json.dumps(body).encode('utf-8')
+        self.send_response(status)
+        self.send_header('Content-Type', 'application/json')
+        self.send_header('Content-Length', str(len(data)))
+        self.end_headers()
+        self.wfile.write(data)
+
+    def do_GET(self):
+        if self.path != '/healthz':
+            self.reply(404, {'error': 'unknown path {0}'.format(self.path)})
+            return
+        self.reply(200, {})
+
+    def do_POST(self):
+        if self.path != '/predict':
+            self.reply(404, {'error': 'unknown path {0}'.format(self.path)})
+            return
+        try:
+            length = int(self.headers.get('Content-Length', '0'))
+            req = json.loads(self.rfile.read(length).decode('utf-8'))
+        except ValueError as err:
+            self.reply(400, {'error': 'invalid request {0}'.format(err)})
+            return
+
+        log.info('predicting {0}'.format(req.get('request_id', '')))
+        self.reply(200, predict(req, self.server.parameters))
+
+
+class Server(socketserver.UnixStreamServer):
+    """Server serves HTTP on the unix socket, one request at a time.
+    """
+
+    def __init__(self, path, parameters):
+        if os.path.exists(path):
+            os.remove(path)
+        self.parameters = parameters
+        socketserver.UnixStreamServer.__init__(self, path, Handler)
+
+
+if __name__ == "__main__":
+    SOCKET = os.environ.get('DPLEARN_SIDECAR_SOCKET', '')
+    if len(sys.argv) > 1:
+        SOCKET = sys.argv[1]
+    if SOCKET == '':
+        log.fatal('Got empty socket path: {0}'.format(sys.argv))
+        sys.exit(1)
+
+    param_path = os.environ['CATS_PARAM_PATH']
+    if param_path == '':
+        log.fatal('Got empty CATS_PARAM_PATH')
+        sys.exit(1)
+
+    log.info("loading 'cats' parameters on {0}".format(param_path))
+    parameters = np.load(param_path).item()
+    log.info("loaded 'cats' parameters on {0}".format(param_path))
+
+    # listen after loading, so that /healthz is ready with the model
+    log.info('serving on {0}'.format(SOCKET))
+    Server(SOCKET, parameters).serve_forever()
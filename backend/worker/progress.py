@@ -0,0 +1,69 @@
+# -*- coding: utf-8 -*-
+"""This script reports job progress as named stages with weights.
+
+It mirrors etcdqueue.StageProgress in pkg/etcd-queue/progress.go,
+which the queue validates and derives the overall progress from.
+
+    stages = Stages([('download', 1), ('inference', 3)])
+    item['stage_progress'] = stages.report('inference', 50)
+    item['progress'] = stages.progress()
+"""
+
+from __future__ import print_function
+
+# MAX_PROGRESS is only reported on completion (see etcdqueue.MaxProgress).
+MAX_PROGRESS = 100
+
+
+class Stages(object):
+    """Stages tracks the current stage of the job, in order.
+    """
+
+    def __init__(self, stages):
+        if not stages:
+            raise ValueError('no stages')
+        names = set()
+        for name, weight in stages:
+            if name == '':
+                raise ValueError('empty stage name')
+            if name in names:
+                raise ValueError('duplicate stage {0}'.format(name))
+            if weight <= 0:
+                raise ValueError('stage {0} has non-positive weight {1}'.format(name, weight))
+            names.add(name)
+        self.stages = [{'name': name, 'weight': weight} for name, weight in stages]
+        self.current = 0
+        self.percent = 0
+
+    def index(self, name):
+        for i, stage in enumerate(self.stages):
+            if stage['name'] == name:
+                return i
+        raise ValueError('unknown stage {0}'.format(name))
+
+    def report(self, name, percent):
+        """report moves to the stage with its percent (0 to 100),
+        and returns the 'stage_progress' field of the item.
+        """
+        idx = self.index(name)
+        if percent < 0 or percent > 100:
+            raise ValueError('stage percent {0} out of range [0, 100]'.format(percent))
+        if idx < self.current or (idx == self.current and percent < self.percent):
+            raise ValueError('stage progress went backward to {0} {1}%'.format(name, percent))
+        self.current, self.percent = idx, percent
+        return self.to_dict()
+
+    def to_dict(self):
+        return {
+            'stages': self.stages,
+            'current': self.stages[self.current]['name'],
+            'percent': self.percent,
+        }
+
+    def progress(self):
+        """progress returns the overall progress, less than MAX_PROGRESS.
+        """
+        total = sum(s['weight'] for s in self.stages)
+        done = sum(s['weight'] * 100 for s in self.stages[:self.current])
+        done += self.stages[self.current]['weight'] * self.percent
+        return min(done * MAX_PROGRESS // (total * 100), MAX_PROGRESS - 1)
@@ -0,0 +1,30 @@
+# -*- coding: utf-8 -*-
+
+from __future__ import print_function
+
+import unittest
+
+from .progress import Stages
+
+
+class TestStages(unittest.TestCase):
+    def test_stages(self):
+        stages = Stages([('download', 1), ('inference', 3)])
+        self.assertEqual(stages.progress(), 0)
+
+        sp = stages.report('inference', 50)
+        self.assertEqual(sp['current'], 'inference')
+        self.assertEqual(sp['percent'], 50)
+        self.assertEqual(stages.progress(), 62)
+
+        stages.report('inference', 100)
+        self.assertEqual(stages.progress(), 99)
+
+        self.assertRaises(ValueError, stages.report, 'download', 100)
+        self.assertRaises(ValueError, stages.report, 'unknown', 0)
+        self.assertRaises(ValueError, Stages, [('a', 1), ('a', 1)])
+        self.assertRaises(ValueError, Stages, [('a', 0)])
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -0,0 +1,41 @@
+# -*- coding: utf-8 -*-
+
+from __future__ import print_function
+
+import json
+import unittest
+
+from .queue_client import Item, SchemaError, Stage, StageProgress
+
+
+class TestItem(unittest.TestCase):
+    def test_item(self):
+        data = json.loads('''{
+            "bucket": "/cats-request", "created_at": "2017-11-01T00:00:00Z",
+            "key": "/cats-request/00000", "value": "foo", "progress": 0,
+            "canceled": false, "error": "", "request_id": "id",
+            "job_type": "cats-vs-dogs", "gpu": false, "unknown": "ignored"
+        }''')
+        item = Item.from_dict(data)
+        self.assertEqual(item.job_type, 'cats-vs-dogs')
+        self.assertIsNone(item.stage_progress)
+        self.assertNotIn('stage_progress', item.to_dict())
+        self.assertNotIn('unknown', item.to_dict())
+
+        item.stage_progress = StageProgress(stages=[Stage(name='inference', weight=1)],
+                                            current='inference', percent=50)
+        self.assertEqual(Item.from_dict(json.loads(json.dumps(item.to_dict()))), item)
+
+        del data['job_type']
+        self.assertRaises(SchemaError, Item.from_dict, data)
+
+        data['job_type'] = 1
+        self.assertRaises(SchemaError, Item.from_dict, data)
+
+    def test_null(self):
+        sp = StageProgress.from_dict({'stages': None, 'current': '', 'percent': 0})
+        self.assertEqual(sp.stages, [])
+
+
+if __name__ == '__main__':
+    unittest.main()
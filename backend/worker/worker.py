@@ -1,5 +1,8 @@
 # -*- coding: utf-8 -*-
 """This script interacts with backend/web.
+
+Workers fetch jobs over the gRPC service defined in backend/workerpb/worker.proto.
+HTTP endpoints (e.g. http://localhost:2200/cats-request/queue) are still supported.
 """
 
 from __future__ import print_function
@@ -10,35 +13,54 @@ import os.path
 import sys
 import time
 
+try:
+    from queue import Queue
+except ImportError:
+    from Queue import Queue
+
 import numpy as np
 import glog as log
+import grpc
 import requests
 
 from cats.model import classify
+import queue_client
+from workerpb import worker_pb2, worker_pb2_grpc
+
 
+# PROTOCOL_VERSION is the worker protocol version (see etcdqueue.ProtocolVersion).
+# The backend refuses workers with unsupported versions. Items over HTTP
+# are decoded with the schema generated for this version (see queue_client.py).
+PROTOCOL_VERSION = queue_client.PROTOCOL_VERSION
 
-ITEM_KEYS = ['bucket', 'key', 'value', 'progress', 'canceled', 'error',
-             'request_id']
+# CAPABILITIES are the job types this worker can process.
+CAPABILITIES = ['cats-vs-dogs']
 
+# LOG_FILE is the job log file set by the worker supervisor (see workerproc.LogFileEnv),
+# which follows the file to stream the log lines to users. Empty if not supervised.
+LOG_FILE = os.environ.get('DPLEARN_LOG_FILE', '')
 
-def fetch_item(endpoint, timeout=None):
+
+def fetch_item(client, timeout=None, capabilities=None):
     """fetch_item fetches a scheduled job from queue service.
+    If capabilities are given, only the jobs of those types are fetched.
+    Returns None if the item does not match the schema.
     """
     while True:
         try:
             # blocks until first item is available
-            log.info('fetching item from {0}'.format(endpoint))
-            rresp = requests.get(endpoint, timeout=timeout)
-            log.info('fetched item from {0}'.format(endpoint))
+            log.info('fetching item from {0}'.format(client.endpoint))
+            item = client.fetch_item(capabilities=capabilities, timeout=timeout)
+            log.info('fetched item from {0}'.format(client.endpoint))
+            return item
 
-            # even empty, Go backend should encode every field
-            item = json.loads(rresp.text)
-            for key in ITEM_KEYS:
-                if key not in item:
-                    log.warning('{0} not in {1}'.format(key, rresp.text))
-                    return None
+        except queue_client.ClientError as err:
+            log.warning('error from {0}: {1} ({2})'.format(client.endpoint, err.error.message, err.error.code))
+            time.sleep(5)
 
-            return item
+        except queue_client.SchemaError as err:
+            log.warning('invalid item from {0}: {1}'.format(client.endpoint, err))
+            return None
 
         except requests.exceptions.ConnectionError as err:
             log.warning('Connection error: {0}'.format(err))
@@ -49,26 +71,27 @@ def fetch_item(endpoint, timeout=None):
             raise
 
 
-def post_item(endpoint, item):
+def post_item(client, item):
     """post posts the processed job to the queue service.
+    Returns None if the item cannot be posted.
     """
-    headers = {'Content-Type': 'application/json'}
     while True:
         try:
-            req_id = item['request_id']
-            log.info('posting item to {0} with request ID {1}'.format(endpoint, req_id))
-            rresp = requests.post(endpoint, data=json.dumps(item),
-                                  headers=headers)
-            log.info('posted item to {0} with request ID {1}'.format(endpoint, req_id))
-
-            item = json.loads(rresp.text)
-            # even empty, Go backend should encode every field
-            for key in ITEM_KEYS:
-                if key not in item:
-                    log.warning('{0} not in {1}'.format(key, rresp.text))
-                    return None
+            log.info('posting item to {0} with request ID {1}'.format(client.endpoint, item.request_id))
+            resp = client.post_item(item)
+            log.info('posted item to {0} with request ID {1}'.format(client.endpoint, item.request_id))
+            return resp
 
-            return item
+        except queue_client.ClientError as err:
+            log.warning('error from {0}: {1} ({2})'.format(client.endpoint, err.error.message, err.error.code))
+            if err.error.retryable:
+                time.sleep(5)
+                continue
+            return None
+
+        except queue_client.SchemaError as err:
+            log.warning('invalid item from {0}: {1}'.format(client.endpoint, err))
+            return None
 
         except requests.exceptions.ConnectionError as err:
             log.warning('Connection error: {0}'.format(err))
@@ -79,12 +102,161 @@ def post_item(endpoint, item):
             raise
 
 
-if __name__ == "__main__":
-    if len(sys.argv) == 1:
-        log.fatal('Got empty endpoint: {0}'.format(sys.argv))
-        sys.exit(1)
+def post_logs(client, request_id, lines):
+    """post_logs appends the log lines of the job, to be streamed to users
+    (e.g. http://localhost:2200/cats-request/logs). Logs are best-effort,
+    and failures are not retried.
+    """
+    try:
+        client.post_logs(request_id, lines)
+
+    except queue_client.ClientError as err:
+        log.warning('error from {0}: {1} ({2})'.format(client.logs_endpoint, err.error.message, err.error.code))
+
+    except requests.exceptions.RequestException as err:
+        log.warning('failed to post logs: {0}'.format(err))
+
+
+def file_logger(request_id):
+    """file_logger returns the logger that appends the log lines of the job
+    to LOG_FILE in JSON (see workerproc.LogLine). Logs are best-effort.
+    """
+    def logger(line):
+        try:
+            with open(LOG_FILE, 'a') as f:
+                f.write(json.dumps({'request_id': request_id, 'line': line}) + '\n')
+
+        except IOError as err:
+            log.warning('failed to write logs to {0}: {1}'.format(LOG_FILE, err))
+
+    return logger
+
+
+def fetch_jobs(stub, bucket, worker_id, capabilities=None):
+    """fetch_jobs yields jobs from the FetchJob stream of gRPC service.
+    The next job is requested only after the previous one is processed.
+    """
+    req = worker_pb2.FetchJobRequest(bucket=bucket, worker_id=worker_id,
+                                     capabilities=capabilities or [],
+                                     protocol_version=PROTOCOL_VERSION)
+    while True:
+        ready = Queue()
+        ready.put(req)
+        try:
+            log.info('fetching jobs from {0}'.format(bucket))
+            for job in stub.FetchJob(iter(ready.get, None)):
+                log.info('fetched job {0}'.format(job.request_id))
+                yield job
+                ready.put(req)
+
+        except grpc.RpcError as err:
+            log.warning('FetchJob error: {0} ({1})'.format(err.details(), err.code()))
+            time.sleep(5)
+
+        finally:
+            # stop the request iterator
+            ready.put(None)
+
+
+def complete_job(stub, job, value='', error=''):
+    """complete_job reports the result of the job to gRPC service.
+    Returns False if the job cannot be completed.
+    """
+    req = worker_pb2.CompleteRequest(bucket=job.bucket, key=job.key,
+                                     request_id=job.request_id,
+                                     value=value, error=error)
+    while True:
+        try:
+            log.info('completing job {0}'.format(job.request_id))
+            stub.Complete(req)
+            log.info('completed job {0}'.format(job.request_id))
+            return True
+
+        except grpc.RpcError as err:
+            log.warning('Complete error: {0} ({1})'.format(err.details(), err.code()))
+            if err.code() in [grpc.StatusCode.UNAVAILABLE, grpc.StatusCode.DEADLINE_EXCEEDED]:
+                time.sleep(5)
+                continue
+            return False
+
+
+def classify_image(image_path, parameters, logger=None):
+    """classify_image returns the result value and error of the cats job.
+    """
+    if not os.path.exists(image_path):
+        log.warning('cannot find image {0}'.format(image_path))
+        return '', 'cannot find image {0}'.format(image_path)
+
+    if logger:
+        logger('classifying image {0}'.format(os.path.basename(image_path)))
+    img_class = classify(image_path, parameters)
+    if logger:
+        logger('classified image as {0}'.format(img_class))
+    return "[WORKER - ACK] it's a '{0}'!".format(img_class), ''
+
+
+def process_job(job_type, value, parameters, logger=None):
+    """process_job returns the result value and error of the job.
+    Jobs without type (created before job routing) are processed as 'cats-vs-dogs'.
+    If logger is given, it is called with the log lines to stream to users.
+    """
+    if job_type in ['', u'', 'cats-vs-dogs', u'cats-vs-dogs']:
+        return classify_image(value, parameters, logger)
+    log.warning('job type {0} is unknown'.format(job_type))
+    return '', 'job type {0} is not supported by worker'.format(job_type)
+
+
+def run_http(endpoint, parameters):
+    """run_http processes jobs from the HTTP queue endpoint.
+    """
+    client = queue_client.QueueClient(endpoint)
+    while True:
+        item = fetch_item(client, capabilities=CAPABILITIES)
+        if item is None:
+            time.sleep(5)
+            continue
+        if item.error != '':
+            log.warning(item.error)
+            time.sleep(5)
+            continue
 
-    EP = sys.argv[1]
+        req_id = item.request_id
+        logger = lambda line: post_logs(client, req_id, [line])
+        if LOG_FILE != '':
+            logger = file_logger(req_id)
+        value, error = process_job(item.job_type, item.value, parameters, logger)
+        item.progress = queue_client.MAX_PROGRESS
+        if error != '':
+            item.error = error
+        else:
+            item.value = value
+
+        post_response = post_item(client, item)
+        if post_response is None:
+            log.warning('failed to post {0}'.format(item.request_id))
+        elif post_response.error != '':
+            log.warning(post_response.error)
+
+
+def run_grpc(target, parameters):
+    """run_grpc processes jobs from the gRPC service (e.g. localhost:2201).
+    """
+    stub = worker_pb2_grpc.WorkerStub(grpc.insecure_channel(target))
+    worker_id = '{0}-{1}'.format(os.uname()[1], os.getpid())
+    for job in fetch_jobs(stub, '/cats-request', worker_id, CAPABILITIES):
+        logger = None
+        if LOG_FILE != '':
+            logger = file_logger(job.request_id)
+        value, error = process_job(job.job_type, job.value, parameters, logger)
+        if not complete_job(stub, job, value=value, error=error):
+            log.warning('failed to complete {0}'.format(job.request_id))
+
+
+if __name__ == "__main__":
+    # endpoint is passed via environment variable in containers
+    EP = os.environ.get('DPLEARN_QUEUE_ENDPOINT', '')
+    if len(sys.argv) > 1:
+        EP = sys.argv[1]
     if EP == '':
         log.fatal('Got empty endpoint: {0}'.format(sys.argv))
         sys.exit(1)
@@ -106,29 +278,7 @@ if __name__ == "__main__":
     log.info("loaded 'cats' parameters on {0}".format(param_path))
 
     log.info("starting worker on {0}".format(EP))
-
-    while True:
-        ITEM = fetch_item(EP)
-        if ITEM['error'] not in ['', u'']:
-            log.warning(ITEM['error'])
-            time.sleep(5)
-            continue
-
-        if ITEM['bucket'] == '/cats-request':
-            IMAGE_PATH = ITEM['value']
-            if not os.path.exists(IMAGE_PATH):
-                log.warning('cannot find image {0}'.format(IMAGE_PATH))
-                ITEM['progress'] = 100
-                ITEM['error'] = 'cannot find image {0}'.format(IMAGE_PATH)
-            else:
-                img_class = classify(IMAGE_PATH, parameters)
-                ITEM['progress'] = 100
-                ITEM['value'] = "[WORKER - ACK] it's a '{0}'!".format(img_class)
-
-            POST_RESPONSE = post_item(EP, ITEM)
-            if POST_RESPONSE['error'] not in ['', u'']:
-                log.warning(POST_RESPONSE['error'])
-
-        else:
-            log.warning('{0} is unknown'.format(ITEM['bucket']))
-            raise
+    if EP.startswith('http://') or EP.startswith('https://'):
+        run_http(EP, parameters)
+    else:
+        run_grpc(EP, parameters)
@@ -16,7 +16,8 @@ import unittest
 import glog as log
 import requests
 
-from .worker import fetch_item, post_item
+from .queue_client import ClientError, Item, QueueClient
+from .worker import fetch_item
 
 
 class BACKEND(threading.Thread):
@@ -72,24 +73,21 @@ class TestBackend(unittest.TestCase):
         log.info('Sleeping...')
         time.sleep(5)
 
-        endpoint = 'http://localhost:2200/cats-request/queue'
+        client = QueueClient('http://localhost:2200/cats-request/queue')
 
         log.info('Posting client requests...')
         # invalid item
-        item = {
-            'bucket': '/cats-request',
-            'key': '/cats-request',
-            'value': '',
-            'request_id': '',
-        }
-        itemresp1 = post_item(endpoint, item)
-        self.assertIsNot(itemresp1['error'], '')
+        item = Item(bucket='/cats-request', key='/cats-request')
+        with self.assertRaises(ClientError) as ctx:
+            client.post_item(item)
+        self.assertEqual(ctx.exception.error.code, 'bad_request')
 
         # valid item
-        item['value'] = 'foo'
-        item['request_id'] = 'id'
-        itemresp2 = post_item(endpoint, item)
-        self.assertEqual(itemresp2['error'], u'unknown request ID \"id\"')
+        item.value = 'foo'
+        item.request_id = 'id'
+        with self.assertRaises(ClientError) as ctx:
+            client.post_item(item)
+        self.assertEqual(ctx.exception.error.message, u'unknown request ID \"id\"')
 
         def cleanup():
             log.info('Killing backend-web-server...')
@@ -104,7 +102,7 @@ class TestBackend(unittest.TestCase):
 
         log.info('Fetching items...')
         try:
-            fetch_item(endpoint, timeout=5)
+            fetch_item(client, timeout=5)
 
         except requests.exceptions.ReadTimeout:
             log.info('Got expected timeout!')
@@ -2,41 +2,759 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gyuho/dplearn/backend/web"
+	"github.com/gyuho/dplearn/pkg/audit"
+	"github.com/gyuho/dplearn/pkg/autoscale"
+	"github.com/gyuho/dplearn/pkg/aws"
+	"github.com/gyuho/dplearn/pkg/azure"
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/config"
+	"github.com/gyuho/dplearn/pkg/coordinator"
 	etcdqueue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/experiment"
+	"github.com/gyuho/dplearn/pkg/feature"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/gcp"
+	"github.com/gyuho/dplearn/pkg/notify"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/registry"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+	"github.com/gyuho/dplearn/pkg/secrets"
+	"github.com/gyuho/dplearn/pkg/tracing"
+	"github.com/gyuho/dplearn/pkg/usage"
+	"github.com/gyuho/dplearn/pkg/user"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/golang/glog"
+	compute "google.golang.org/api/compute/v1"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func main() {
 	webScheme := flag.String("web-scheme", "http", "Specify scheme for backend.")
 	hostPort := flag.String("web-host", "localhost:2200", "Specify host and port for backend.")
+	grpcHostPort := flag.String("grpc-host", "localhost:2201", "Specify host and port for worker gRPC service (empty to disable). Workers are not authenticated, so bind to a loopback or private interface.")
 	queuePortClient := flag.Int("queue-port-client", 22000, "Specify the client port for queue service.")
 	queuePortPeer := flag.Int("queue-port-peer", 22001, "Specify the peer port for queue service.")
 	dataDir := flag.String("data-dir", filepath.Join(os.TempDir(), "etcd-data"), "Specify the etcd data directory.")
+	shredUploads := flag.Bool("shred-uploads", false, "'true' to overwrite uploaded images before removing them, once their requests are deleted.")
+	minDiskSpace := flag.String("min-disk-space", "1GB", "Specify the disk space to keep available in the temporary directory, below which new uploads are refused (e.g. 500MB, 0 to only refuse uploads larger than the available space).")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Specify the OTLP/HTTP collector endpoint to export traces and metrics (e.g. http://localhost:4318).")
+	traceSampleRatio := flag.Float64("trace-sample-ratio", 0.1, "Specify the ratio of traces to sample (0.0 to 1.0).")
+	maxConcurrentSubmissions := flag.Int("max-concurrent-submissions", web.DefaultMaxConcurrentSubmissions, "Specify the maximum number of concurrent job submissions (0 for no limit).")
+	autoscaleEnabled := flag.Bool("autoscale", false, "'true' to compute the desired number of workers (served at /autoscale).")
+	autoscaleTargetLatency := flag.Duration("autoscale-target-latency", time.Minute, "Specify the desired time to drain the queue.")
+	autoscaleMinWorkers := flag.Int("autoscale-min-workers", 1, "Specify the minimum number of workers.")
+	autoscaleMaxWorkers := flag.Int("autoscale-max-workers", 10, "Specify the maximum number of workers (0 for no limit).")
+	autoscaleGCE := flag.String("autoscale-gce-instance-group", "", "Specify the GCE managed instance group to resize, as 'zone/name', or 'name' in the zone of the instance (with -gcp-key-path, or the instance service account).")
+	autoscaleGCEScaleUpCooldown := flag.Duration("autoscale-gce-scale-up-cooldown", time.Minute, "Specify the minimum duration between resizes of -autoscale-gce-instance-group, before scaling up.")
+	autoscaleGCEScaleDownCooldown := flag.Duration("autoscale-gce-scale-down-cooldown", 10*time.Minute, "Specify the minimum duration between resizes of -autoscale-gce-instance-group, before scaling down.")
+	gcpKeyPath := flag.String("gcp-key-path", "", "Specify the GCP service account key file path, or secret reference (e.g. 'env:GCP_KEY', 'gcp-secret:dplearn-key').")
+	gceFirewall := flag.String("gce-firewall", "", "'verify' to fail on startup if the GCE firewall does not allow -gce-firewall-ports to the instance, or 'create' to create the missing rule (with -gcp-key-path, or the instance service account).")
+	gceFirewallPorts := flag.String("gce-firewall-ports", "", "Specify the comma-separated TCP ports of -gce-firewall (empty for the -web-host, frontend 4200, and -queue-port-client ports).")
+	kmsKey := flag.String("kms-key", "", "Specify the Cloud KMS key ('projects/.../cryptoKeys/<key>'), or 'local:<path>' of the local key in development, to resolve 'kms-file:<path>' secret references to files sealed with the key.")
+	autoscaleGCEPool := flag.String("autoscale-gce-pool", "", "Specify the pool of ephemeral GCE instances to boot and delete, as 'zone/name', or 'name' in the zone of the instance (with -gcp-key-path, or the instance service account). With -autoscale-gce-gpu, zone may be a region or comma-separated zones, to boot in the first zone with the GPUs available.")
+	autoscaleGCEMachineType := flag.String("autoscale-gce-machine-type", "n1-standard-4", "Specify the machine type of -autoscale-gce-pool instances.")
+	autoscaleGCEImage := flag.String("autoscale-gce-image", "", "Specify the boot disk image of -autoscale-gce-pool instances (empty for Ubuntu).")
+	autoscaleGCEGPU := flag.String("autoscale-gce-gpu", "", "Specify the GPUs of -autoscale-gce-pool instances, as 'type:count' (e.g. nvidia-tesla-k80:1).")
+	autoscaleGCEStartupScript := flag.String("autoscale-gce-startup-script", "", "Specify the startup script file of -autoscale-gce-pool instances (e.g. to start the worker).")
+	autoscaleGCEPreemptible := flag.Bool("autoscale-gce-preemptible", false, "'true' to boot preemptible -autoscale-gce-pool instances.")
+	autoscaleEC2Pool := flag.String("autoscale-ec2-pool", "", "Specify the pool of ephemeral EC2 instances to launch and terminate, as 'region/name' (with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or the instance role).")
+	autoscaleEC2InstanceType := flag.String("autoscale-ec2-instance-type", "p2.xlarge", "Specify the instance type of -autoscale-ec2-pool instances.")
+	autoscaleEC2Image := flag.String("autoscale-ec2-image", "", "Specify the AMI ID of -autoscale-ec2-pool instances.")
+	autoscaleEC2UserData := flag.String("autoscale-ec2-user-data", "", "Specify the user data (startup script) file of -autoscale-ec2-pool instances (e.g. to start the worker).")
+	autoscaleEC2Spot := flag.Bool("autoscale-ec2-spot", false, "'true' to launch spot -autoscale-ec2-pool instances.")
+	autoscaleAzure := flag.String("autoscale-azure-scale-set", "", "Specify the Azure virtual machine scale set to resize, as 'subscription/resource-group/name' (with AZURE_TENANT_ID, AZURE_CLIENT_ID, and AZURE_CLIENT_SECRET, or the managed identity).")
+	autoscaleK8s := flag.String("autoscale-k8s", "", "Specify the Kubernetes resource to scale, as 'namespace/kind/name' (kind is 'deployment' or 'hpa').")
+	gpuRoutes := flag.String("gpu-routes", "", "Specify comma-separated request routes whose jobs prefer GPU workers (e.g. /cats-request).")
+	gpuFallback := flag.Duration("gpu-fallback", etcdqueue.DefaultGPUFallback, "Specify the duration that GPU jobs wait for GPU workers before falling back to CPU workers.")
+	healthCheckInterval := flag.Duration("health-check-interval", web.DefaultHealthCheckInterval, "Specify the interval to check worker health (0 to disable).")
+	notificationsConfig := flag.String("notifications-config", "", "Specify the YAML file of the notification sinks (log, webhook, slack, email, pubsub) and the routes of the event types to the sinks, for the job, worker, and server events (replaces -notify-webhook).")
+	notifyWebhook := flag.String("notify-webhook", "", "Specify the webhook URL to notify when a bucket has no healthy worker (e.g. Slack incoming webhook), or secret reference (e.g. 'env:NOTIFY_WEBHOOK', 'gcp-secret:slack-webhook').")
+	artifactSigning := flag.Bool("artifact-signing", false, "'true' to serve signed URLs of job artifacts in Cloud Storage at /cats-request/artifact (with -gcp-key-path, or the application default credentials).")
+	artifactURLTTL := flag.Duration("artifact-url-ttl", web.DefaultArtifactURLTTL, "Specify the expiration of signed artifact URLs.")
+	blobStore := flag.String("blob-store", "", "Specify the blob store of the job artifacts and backup snapshots: directory, 'gs://bucket/prefix' (with -gcp-key-path to sign URLs), or 's3://bucket/prefix?region=us-west-2'. The signed URLs of the local blobs are served at /blobs/.")
+	blobSecret := flag.String("blob-secret", "", "Specify the secret to sign the URLs of the local -blob-store with, or secret reference (e.g. 'env:BLOB_SECRET').")
+	backupInterval := flag.Duration("backup-interval", 0, "Specify the interval to snapshot the jobs not completed to 'backups/jobs.json' in -blob-store (0 to disable).")
+	speculationPercentile := flag.Float64("speculation-percentile", 0, "Specify the percentile of job durations (e.g. 95) after which jobs are duplicated to a second worker, keeping the first result (0 to disable).")
+	maxJobAttempts := flag.Int("max-job-attempts", web.DefaultMaxJobAttempts, "Specify the number of attempts of jobs that time out in workers, before they are moved to the dead letter bucket.")
+	canaryVersion := flag.String("canary-version", "", "Specify the worker version to route -canary-percent of new jobs to (workers labeled 'version', empty to disable).")
+	canaryPercent := flag.Int("canary-percent", 0, "Specify the percentage of new jobs routed to -canary-version workers (0 to 100).")
+	coordinatorEnabled := flag.Bool("coordinator", false, "'true' to elect a fleet coordinator among the servers sharing the queue, to rebalance buckets, drain workers, and pause dispatch (served at /admin/coordinator).")
+	coordinatorInterval := flag.Duration("coordinator-interval", 30*time.Second, "Specify the interval for the coordinator leader to recompute the decisions.")
+	schedulerEnabled := flag.Bool("scheduler", false, "'true' to elect a scheduler among the servers sharing the queue, to enqueue the jobs of the cron and one-off schedules (served at /admin/schedules).")
+	schedulerInterval := flag.Duration("scheduler-interval", 10*time.Second, "Specify the interval for the scheduler leader to check the due schedules.")
+	features := flag.Bool("features", false, "'true' to enable the feature flags in the queue etcd cluster, to toggle or roll out the risky features without redeploying (managed at /admin/features).")
+	deployment := flag.String("deployment", "", "Specify the deployment name of the server (e.g. prod, staging), to evaluate the per-deployment feature flag percentages (with -features).")
+	modelRegistry := flag.Bool("model-registry", false, "'true' to enable the model registry in the queue etcd cluster, to register and promote model versions at /admin/models, which workers with -model-name reload.")
+	modelDir := flag.String("model-dir", "", "Specify the directory to store the model artifacts uploaded to the registry (empty to store with the uploads under the temporary directory).")
+	experiments := flag.Bool("experiments", false, "'true' to enable the experiment tracking in the queue etcd cluster, where training jobs record the hyperparameters, per-epoch metrics, and final scores of the runs (served at /experiments).")
+	pipelines := flag.Bool("pipelines", false, "'true' to enable the pipelines at /pipelines, which enqueue the steps of each run as their dependencies complete.")
+	users := flag.Bool("users", false, "'true' to enable the user accounts in the queue etcd cluster, to register and log in at /users (with -session-secret).")
+	sessionSecret := flag.String("session-secret", "", "Specify the secret to sign the session tokens of the users with, or secret reference (e.g. 'env:SESSION_SECRET', 'gcp-secret:dplearn-session').")
+	sessionTTL := flag.Duration("session-ttl", user.DefaultTokenTTL, "Specify the lifetime of the session tokens.")
+	loginRequired := flag.Bool("login-required", false, "'true' to reject the job submissions and uploads without login (with -users).")
+	admins := flag.String("admins", "", "Specify the comma-separated user names with the admin role, to call the /admin endpoints (with -users). Without -users, the /admin endpoints are only served to the loopback.")
+	auditLog := flag.Bool("audit", false, "'true' to record the logins, job submissions, cancels, admin operations, and config reloads as append-only entries in the queue etcd cluster (served at /admin/audit).")
+	quotasConfig := flag.String("quotas-config", "", "Specify the YAML file of the per-user quotas, to account the usage of the users in the queue etcd cluster (served at /usage), and reject the submissions over the quotas.")
+	pipelinesConfig := flag.String("pipelines-config", "", "Specify the YAML file of the pipeline definitions to run by name (implies -pipelines).")
+	pubsubTopic := flag.String("pubsub-topic", "", "Specify the Pub/Sub topic to mirror job events to, as 'topic' or 'project/topic' (with -gcp-key-path, or the instance service account).")
+	cloudMonitoring := flag.Bool("cloud-monitoring", false, "'true' to export queue depth, job latency, worker count, and HTTP error rate to Cloud Monitoring as custom metrics (with -gcp-key-path, or the instance service account).")
+	cloudMonitoringInterval := flag.Duration("cloud-monitoring-interval", web.DefaultMetricsInterval, "Specify the interval to export metrics to Cloud Monitoring.")
+	maintenance := flag.Bool("maintenance", false, "'true' to start the web server in maintenance mode (rejects new requests).")
+	workerToken := flag.String("worker-token", os.Getenv("DPLEARN_WORKER_TOKEN"), "Specify the token for worker registrations (defaults to $DPLEARN_WORKER_TOKEN; empty to only accept registrations from the loopback).")
+	runtimeConfigPath := flag.String("runtime-config", "", "Specify the YAML file of the settings to reload on change without restart ('maintenance', 'maintenance-message', 'canary-version', 'canary-percent'), overriding the flags.")
+	configFlags := config.AddFlags(flag.CommandLine, "backend", "queue")
 	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
+
+	if *kmsKey != "" {
+		if err := registerKMS(*kmsKey, *gcpKeyPath); err != nil {
+			glog.Fatal(err)
+		}
+	}
 
 	rootCtx, rootCancel := context.WithCancel(context.Background())
 	defer rootCancel()
 
+	if *gceFirewall != "" {
+		ports := *gceFirewallPorts
+		if ports == "" {
+			_, webPort, err := net.SplitHostPort(*hostPort)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			ports = fmt.Sprintf("%s,4200,%d", webPort, *queuePortClient)
+		}
+		if err := checkFirewall(rootCtx, *gceFirewall, ports, *gcpKeyPath); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	if *otlpEndpoint != "" {
+		tp, err := tracing.NewProvider(tracing.Config{
+			ServiceName: "dplearn-backend-web-server",
+			Endpoint:    *otlpEndpoint,
+			SampleRatio: *traceSampleRatio,
+		})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		tracing.SetProvider(tp)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			tp.Shutdown(ctx)
+			cancel()
+		}()
+	}
+
+	// the lock file is next to the data directory, which etcd owns
+	lock, err := fileutil.TryLock(filepath.Clean(*dataDir) + ".lock")
+	if err != nil {
+		if err == fileutil.ErrLocked {
+			glog.Fatalf("%q is in use by another backend server", *dataDir)
+		}
+		glog.Fatal(err)
+	}
+	defer lock.Unlock()
+
 	qu, err := etcdqueue.NewEmbeddedQueue(rootCtx, *queuePortClient, *queuePortPeer, *dataDir)
 	if err != nil {
 		glog.Fatal(err)
 	}
 	defer qu.Stop()
 
+	glog.Infof("version: %s", web.GetVersion(rootCtx, qu))
+
+	opts := []web.ServerOpOption{
+		web.WithConcurrencyLimit("/cats-request", *maxConcurrentSubmissions, http.MethodPost),
+		web.WithGRPC(*grpcHostPort),
+		web.WithWorkerToken(*workerToken),
+		web.WithGPUFallback(*gpuFallback),
+		web.WithMaxJobAttempts(*maxJobAttempts),
+		web.WithCanary(*canaryVersion, *canaryPercent),
+	}
+	if minSpace, err := humanize.ParseBytes(*minDiskSpace); err != nil {
+		glog.Fatalf("invalid -min-disk-space %q (%v)", *minDiskSpace, err)
+	} else {
+		// uploads are stored in the temporary directory
+		opts = append(opts, web.WithMinDiskSpace(os.TempDir(), minSpace))
+	}
+	if *shredUploads {
+		opts = append(opts, web.WithShredUploads())
+	}
+	if *notificationsConfig != "" {
+		if *notifyWebhook != "" {
+			glog.Fatal("-notify-webhook cannot be used with -notifications-config (add a 'webhook' sink to the config)")
+		}
+		cfg, err := notify.ReadConfig(*notificationsConfig)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		key, err := readKey(*gcpKeyPath)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		rt, err := cfg.Build(context.Background(), notify.BuildOptions{Secrets: resolver, GCPKey: key})
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("loaded notifications %q", *notificationsConfig)
+		opts = append(opts, web.WithNotifications(rt))
+	}
+	if *healthCheckInterval > 0 {
+		var sink notify.Sink
+		if *notificationsConfig == "" {
+			// without the config, only the worker health is notified
+			cfg := notify.Config{
+				Sinks:  map[string]notify.SinkConfig{"log": {Type: notify.SinkLog}},
+				Routes: []notify.Route{{Events: []string{notify.EventNoHealthyWorkers, notify.EventWorkersRecovered}, Sinks: []string{"log"}}},
+			}
+			if *notifyWebhook != "" {
+				cfg.Sinks["webhook"] = notify.SinkConfig{Type: notify.SinkWebhook, URL: *notifyWebhook}
+				cfg.Routes[0].Sinks = append(cfg.Routes[0].Sinks, "webhook")
+			}
+			rt, err := cfg.Build(context.Background(), notify.BuildOptions{Secrets: resolver})
+			if err != nil {
+				glog.Fatal(err)
+			}
+			sink = rt
+		}
+		opts = append(opts, web.WithHealthCheck(*healthCheckInterval, sink))
+	}
+	if *artifactSigning {
+		var signer *gcp.Signer
+		if *gcpKeyPath != "" {
+			var key []byte
+			key, err = readKey(*gcpKeyPath)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			signer, err = gcp.NewSigner(key)
+		} else {
+			signer, err = gcp.NewDefaultSigner()
+		}
+		if err != nil {
+			glog.Fatal(err)
+		}
+		opts = append(opts, web.WithArtifactSigner(signer, *artifactURLTTL))
+	}
+	if *blobStore != "" {
+		cfg, err := blobstore.ParseURL(*blobStore)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		switch cfg.Driver {
+		case blobstore.DriverLocal:
+			if *blobSecret != "" {
+				secret, err := resolver.Value(context.Background(), *blobSecret)
+				if err != nil {
+					glog.Fatal(err)
+				}
+				cfg.URL, cfg.Secret = fmt.Sprintf("%s://%s/blobs/", *webScheme, *hostPort), []byte(secret)
+			}
+		case blobstore.DriverGCS:
+			if *gcpKeyPath != "" {
+				if cfg.Key, err = readKey(*gcpKeyPath); err != nil {
+					glog.Fatal(err)
+				}
+			}
+		}
+		b, err := blobstore.Open(context.Background(), cfg)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("storing blobs in %q", b.URI(""))
+		opts = append(opts, web.WithBlobBackend(b, *backupInterval))
+	} else if *backupInterval > 0 {
+		glog.Fatal("-backup-interval requires -blob-store")
+	}
+	if *speculationPercentile > 0 {
+		opts = append(opts, web.WithSpeculation(*speculationPercentile))
+	}
+	if *coordinatorEnabled {
+		opts = append(opts, web.WithCoordinator(coordinator.Config{Name: *hostPort, Interval: *coordinatorInterval}))
+	}
+	if *schedulerEnabled {
+		opts = append(opts, web.WithScheduler(scheduler.Config{Name: *hostPort, Interval: *schedulerInterval}))
+	}
+	if *features {
+		opts = append(opts, web.WithFeatures(feature.Config{Deployment: *deployment}))
+	}
+	if *modelRegistry {
+		var store blobstore.Store
+		if *modelDir != "" {
+			var err error
+			if store, err = blobstore.NewLocal(*modelDir); err != nil {
+				glog.Fatal(err)
+			}
+		}
+		opts = append(opts, web.WithModelRegistry(store, registry.Config{}))
+	}
+	if *experiments {
+		opts = append(opts, web.WithExperiments(experiment.Config{}))
+	}
+	if *users {
+		if *sessionSecret == "" {
+			glog.Fatal("-users requires -session-secret")
+		}
+		secret, err := resolver.Value(context.Background(), *sessionSecret)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		opts = append(opts, web.WithUsers(user.Config{}, user.Tokens{Secret: []byte(secret), TTL: *sessionTTL}))
+		if *loginRequired {
+			opts = append(opts, web.WithLoginRequired())
+		}
+		if *admins != "" {
+			opts = append(opts, web.WithAdmins(strings.Split(*admins, ",")...))
+		}
+	}
+	if *quotasConfig != "" {
+		cfg, err := usage.ReadConfig(*quotasConfig)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("loaded quotas %q", *quotasConfig)
+		opts = append(opts, web.WithQuotas(cfg))
+	}
+	if *auditLog {
+		opts = append(opts, web.WithAudit(audit.Config{}))
+	}
+	if *pipelines || *pipelinesConfig != "" {
+		var defs []pipeline.Definition
+		if *pipelinesConfig != "" {
+			var err error
+			if defs, err = pipeline.ReadDefinitions(*pipelinesConfig); err != nil {
+				glog.Fatal(err)
+			}
+			glog.Infof("loaded %d pipeline(s) from %q", len(defs), *pipelinesConfig)
+		}
+		opts = append(opts, web.WithPipelines(defs...))
+	}
+	if *pubsubTopic != "" {
+		sink, err := newPubSubSink(context.Background(), *pubsubTopic, *gcpKeyPath)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		opts = append(opts, web.WithJobEvents(sink))
+	}
+	if *cloudMonitoring {
+		sink, err := newMonitoringSink(context.Background(), *gcpKeyPath)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		opts = append(opts, web.WithMetricsExporter(sink, *cloudMonitoringInterval))
+	}
+	if *gpuRoutes != "" {
+		opts = append(opts, web.WithGPURoutes(strings.Split(*gpuRoutes, ",")...))
+	}
+	if *autoscaleEnabled {
+		cfg := autoscale.Config{
+			Bucket:        "/cats-request",
+			TargetLatency: *autoscaleTargetLatency,
+			MinWorkers:    *autoscaleMinWorkers,
+			MaxWorkers:    *autoscaleMaxWorkers,
+		}
+		template := gcp.InstanceConfig{
+			OS:          "ubuntu",
+			MachineType: *autoscaleGCEMachineType,
+			Image:       *autoscaleGCEImage,
+			DiskSizeGB:  50,
+			Preemptible: *autoscaleGCEPreemptible,
+		}
+		if *autoscaleGCEGPU != "" {
+			ss := strings.Split(*autoscaleGCEGPU, ":")
+			if len(ss) != 2 {
+				glog.Fatalf("invalid GPUs %q (must be 'type:count')", *autoscaleGCEGPU)
+			}
+			template.GPUType = ss[0]
+			if template.GPUCount, err = strconv.Atoi(ss[1]); err != nil {
+				glog.Fatalf("invalid GPU count %q (%v)", ss[1], err)
+			}
+		}
+		if *autoscaleGCEStartupScript != "" {
+			script, err := ioutil.ReadFile(*autoscaleGCEStartupScript)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			template.StartupScript = string(script)
+		}
+		group := gcp.InstanceGroupConfig{
+			MinSize:           *autoscaleMinWorkers,
+			MaxSize:           *autoscaleMaxWorkers,
+			ScaleUpCooldown:   *autoscaleGCEScaleUpCooldown,
+			ScaleDownCooldown: *autoscaleGCEScaleDownCooldown,
+		}
+		ec2Template := aws.InstanceConfig{
+			ImageID:      *autoscaleEC2Image,
+			InstanceType: *autoscaleEC2InstanceType,
+			Spot:         *autoscaleEC2Spot,
+		}
+		if *autoscaleEC2UserData != "" {
+			data, err := ioutil.ReadFile(*autoscaleEC2UserData)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			ec2Template.UserData = string(data)
+		}
+		cfg.Scaler, err = newScaler(rootCtx, *autoscaleGCE, group, *autoscaleGCEPool, template, *gcpKeyPath, *autoscaleEC2Pool, ec2Template, *autoscaleAzure, *autoscaleK8s)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		opts = append(opts, web.WithAutoscaler(autoscale.New(qu, cfg)))
+	}
+
 	glog.Infof("starting web server with %q (queue :%d/:%d, data-dir %q)", *hostPort, *queuePortClient, *queuePortPeer, *dataDir)
-	srv, err := web.StartServer(*webScheme, *hostPort, qu)
+	srv, err := web.StartServer(*webScheme, *hostPort, qu, opts...)
 	if err != nil {
 		glog.Fatal(err)
 	}
+	if *maintenance {
+		srv.SetMaintenance(true, "")
+	}
+	if *runtimeConfigPath != "" {
+		if err = watchRuntimeConfig(srv, *runtimeConfigPath); err != nil {
+			glog.Fatal(err)
+		}
+	}
 
 	select {
 	case <-srv.StopNotify():
 		glog.Warning("stopped web server")
 	}
 }
+
+// newScaler returns the scaler for GCE instance group with the bounds and
+// cooldowns of 'group', GCE instance pool of the template, EC2 instance pool
+// of 'ec2Template', Azure scale set, or Kubernetes resource. Returns nil if
+// none is specified.
+func newScaler(ctx context.Context, gceGroup string, group gcp.InstanceGroupConfig, gcePool string, template gcp.InstanceConfig, keyPath, ec2Pool string, ec2Template aws.InstanceConfig, azureScaleSet, k8s string) (autoscale.Scaler, error) {
+	switch {
+	case gceGroup != "":
+		ss, err := splitZoneName(ctx, gceGroup)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		c, err := gcp.NewCompute(ctx, compute.ComputeScope, key)
+		if err != nil {
+			return nil, err
+		}
+		group.Zone, group.Name = ss[0], ss[1]
+		return gcp.NewInstanceGroupScaler(c, group)
+
+	case gcePool != "":
+		ss, err := splitZoneName(ctx, gcePool)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		c, err := gcp.NewCompute(ctx, compute.ComputeScope, key)
+		if err != nil {
+			return nil, err
+		}
+		template.Zone = ss[0]
+		if zones := strings.Split(ss[0], ","); len(zones) > 1 || gcp.IsRegion(zones[0]) {
+			// pick the zone that has the GPUs available
+			if template.GPUCount == 0 {
+				return nil, fmt.Errorf("instance pool %q in a region or multiple zones requires a GPU count > 0 (with -autoscale-gce-gpu)", gcePool)
+			}
+			template.Zone, err = c.FindGPUZone(ctx, template.GPUType, template.GPUCount, template.Preemptible, zones...)
+			if err != nil {
+				return nil, err
+			}
+			glog.Infof("booting instance pool %q in %q with %d %q GPU(s)", ss[1], template.Zone, template.GPUCount, template.GPUType)
+		}
+		return gcp.NewInstancePool(c, ss[1], template), nil
+
+	case ec2Pool != "":
+		ss := strings.Split(ec2Pool, "/")
+		if len(ss) != 2 {
+			return nil, fmt.Errorf("invalid instance pool %q (must be 'region/name')", ec2Pool)
+		}
+		if ec2Template.ImageID == "" {
+			return nil, fmt.Errorf("instance pool %q has no image", ec2Pool)
+		}
+		return aws.NewInstancePool(aws.NewEC2(ss[0], nil), ss[1], ec2Template), nil
+
+	case azureScaleSet != "":
+		ss := strings.Split(azureScaleSet, "/")
+		if len(ss) != 3 {
+			return nil, fmt.Errorf("invalid scale set %q (must be 'subscription/resource-group/name')", azureScaleSet)
+		}
+		return azure.NewScaleSet(ctx, ss[0], ss[1], ss[2]), nil
+
+	case k8s != "":
+		ss := strings.Split(k8s, "/")
+		if len(ss) != 3 {
+			return nil, fmt.Errorf("invalid Kubernetes resource %q (must be 'namespace/kind/name')", k8s)
+		}
+		return autoscale.NewKubernetesScaler(ss[0], ss[1], ss[2])
+	}
+	return nil, nil
+}
+
+// checkFirewall verifies that the GCE firewall allows the comma-separated
+// ports to the instance, creating the missing rule in "create" mode.
+func checkFirewall(ctx context.Context, mode, ports, keyPath string) error {
+	if mode != "verify" && mode != "create" {
+		return fmt.Errorf("invalid firewall mode %q (must be 'verify' or 'create')", mode)
+	}
+	rule := gcp.FirewallRule{Name: "dplearn-services"}
+	for _, p := range strings.Split(ports, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return fmt.Errorf("invalid port %q (%v)", p, err)
+		}
+		rule.Ports = append(rule.Ports, n)
+	}
+	mc := gcp.NewMetadataClient("")
+	ifaces, err := mc.NetworkInterfaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to detect the network of the instance (%v)", err)
+	}
+	if len(ifaces) > 0 {
+		rule.Network = path.Base(ifaces[0].Network)
+	}
+	if rule.TargetTags, err = mc.Tags(ctx); err != nil {
+		return fmt.Errorf("failed to detect the tags of the instance (%v)", err)
+	}
+	key, err := readKey(keyPath)
+	if err != nil {
+		return err
+	}
+	c, err := gcp.NewCompute(ctx, compute.ComputeScope, key)
+	if err != nil {
+		return err
+	}
+	return c.EnsureFirewall(ctx, rule, mode == "create")
+}
+
+// splitZoneName splits the GCE resource of 'zone/name' into the zone and
+// name, defaulting to the zone of the instance if only the name is given.
+func splitZoneName(ctx context.Context, v string) ([]string, error) {
+	ss := strings.Split(v, "/")
+	if len(ss) == 1 {
+		zone := gcp.DetectEnvironment(ctx).Zone
+		if zone == "" {
+			return nil, fmt.Errorf("no zone of %q, and failed to detect the zone of the instance", v)
+		}
+		ss = []string{zone, v}
+	}
+	if len(ss) != 2 {
+		return nil, fmt.Errorf("invalid %q (must be 'zone/name')", v)
+	}
+	return ss, nil
+}
+
+// newPubSubSink returns the sink to publish job events to the Pub/Sub topic,
+// in JSON with the type and bucket attributes to filter subscriptions.
+func newPubSubSink(ctx context.Context, topic, keyPath string) (web.JobEventSink, error) {
+	project := ""
+	if ss := strings.SplitN(topic, "/", 2); len(ss) == 2 {
+		project, topic = ss[0], ss[1]
+	}
+	key, err := readKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	t, err := gcp.NewTopic(ctx, project, topic, key)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("mirroring job events to %q", t)
+	return web.JobEventSinkFunc(func(ctx context.Context, evs []web.JobEvent) error {
+		msgs := make([]gcp.PubSubMessage, len(evs))
+		for i, ev := range evs {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			msgs[i] = gcp.PubSubMessage{
+				Data:       data,
+				Attributes: map[string]string{"type": ev.Type, "bucket": ev.Bucket, "request_id": ev.RequestID},
+			}
+		}
+		_, err := t.Publish(ctx, msgs...)
+		return err
+	}), nil
+}
+
+// newMonitoringSink returns the sink to write the server metrics
+// to Cloud Monitoring as custom metrics.
+func newMonitoringSink(ctx context.Context, keyPath string) (web.MetricsSink, error) {
+	key, err := readKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	mon, err := gcp.NewMonitoring(ctx, "", key)
+	if err != nil {
+		return nil, err
+	}
+	return web.MetricsSinkFunc(func(ctx context.Context, m web.Metrics) error {
+		var pts []gcp.MetricPoint
+		for b, n := range m.QueueDepth {
+			pts = append(pts, gcp.MetricPoint{Name: "queue_depth", Labels: map[string]string{"bucket": b}, Int64: n})
+		}
+		for b, n := range m.Workers {
+			pts = append(pts, gcp.MetricPoint{Name: "workers", Labels: map[string]string{"bucket": b}, Int64: int64(n)})
+		}
+		for b, d := range m.JobLatency {
+			secs := d.Seconds()
+			pts = append(pts, gcp.MetricPoint{Name: "job_latency_seconds", Labels: map[string]string{"bucket": b}, Double: &secs})
+		}
+		rate := m.HTTPErrorRate()
+		pts = append(pts,
+			gcp.MetricPoint{Name: "http_requests", Int64: m.HTTPRequests},
+			gcp.MetricPoint{Name: "http_error_rate", Double: &rate},
+		)
+		return mon.Write(ctx, m.Time, pts...)
+	}), nil
+}
+
+// resolver resolves the secret references in flags. "gcp-secret" accesses
+// Secret Manager as the service account of the instance.
+var resolver = newResolver()
+
+func newResolver() *secrets.Resolver {
+	r := secrets.New()
+	var (
+		once sync.Once
+		sm   *gcp.SecretManager
+		err  error
+	)
+	r.Register("gcp-secret", secrets.ProviderFunc(func(ctx context.Context, name string) ([]byte, error) {
+		once.Do(func() { sm, err = gcp.NewSecretManager(ctx, "", nil) })
+		if err != nil {
+			return nil, err
+		}
+		return sm.Secret(ctx, name)
+	}))
+	return r
+}
+
+// registerKMS registers the "kms-file" secret provider, which opens the
+// envelope files sealed with the key (see 'gcp.Seal').
+func registerKMS(spec, keyPath string) error {
+	key, err := readKey(keyPath)
+	if err != nil {
+		return err
+	}
+	kek, err := gcp.NewKeyEncrypter(context.Background(), spec, key)
+	if err != nil {
+		return err
+	}
+	resolver.Register("kms-file", secrets.ProviderFunc(func(ctx context.Context, name string) ([]byte, error) {
+		env, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return gcp.Open(ctx, kek, env)
+	}))
+	return nil
+}
+
+// readKey reads the service account key file, or resolves the secret
+// reference. Returns nil if the path is empty, to authenticate as the
+// service account of the instance.
+func readKey(keyPath string) ([]byte, error) {
+	if keyPath == "" {
+		return nil, nil
+	}
+	if resolver.IsRef(keyPath) {
+		return resolver.Resolve(context.Background(), keyPath)
+	}
+	return ioutil.ReadFile(keyPath)
+}
+
+// runtimeConfig is the server settings reloaded on change.
+type runtimeConfig struct {
+	Maintenance        bool   `yaml:"maintenance"`
+	MaintenanceMessage string `yaml:"maintenance-message"`
+	CanaryVersion      string `yaml:"canary-version"`
+	CanaryPercent      int    `yaml:"canary-percent"`
+}
+
+// watchRuntimeConfig applies the runtime configuration file to the server,
+// and reapplies it whenever the file changes. Invalid changes are logged
+// and ignored, keeping the last valid configuration.
+func watchRuntimeConfig(srv *web.Server, p string) error {
+	apply := func(last *runtimeConfig) (runtimeConfig, error) {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return runtimeConfig{}, err
+		}
+		var cfg runtimeConfig
+		if err = yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return runtimeConfig{}, fmt.Errorf("invalid runtime config %q (%v)", p, err)
+		}
+		if cfg.CanaryPercent < 0 || cfg.CanaryPercent > 100 {
+			return runtimeConfig{}, fmt.Errorf("invalid canary-percent %d in %q", cfg.CanaryPercent, p)
+		}
+		if last == nil || cfg.Maintenance != last.Maintenance || cfg.MaintenanceMessage != last.MaintenanceMessage {
+			srv.SetMaintenance(cfg.Maintenance, cfg.MaintenanceMessage)
+		}
+		if last == nil || cfg.CanaryVersion != last.CanaryVersion || cfg.CanaryPercent != last.CanaryPercent {
+			srv.SetCanary(cfg.CanaryVersion, cfg.CanaryPercent)
+		}
+		glog.Infof("applied runtime config %q", p)
+		return cfg, nil
+	}
+
+	cfg, err := apply(nil)
+	if err != nil {
+		return err
+	}
+	w, err := fileutil.NewWatcher(0)
+	if err != nil {
+		return err
+	}
+	if err = w.Add(p); err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-srv.StopNotify():
+				return
+			case <-w.Events():
+			case err := <-w.Errors():
+				glog.Warningf("error watching %q (%v); reloading", p, err)
+			}
+			next, err := apply(&cfg)
+			if err != nil {
+				glog.Warningf("failed to reload runtime config (%v)", err)
+				srv.Audit(audit.Entry{Action: "config.reload", Target: p, Outcome: audit.OutcomeFailure, Detail: err.Error()})
+				continue
+			}
+			srv.Audit(audit.Entry{Action: "config.reload", Target: p, Outcome: audit.OutcomeSuccess})
+			cfg = next
+		}
+	}()
+	return nil
+}
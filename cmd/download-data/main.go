@@ -1,27 +1,48 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/gyuho/dplearn/pkg/archiver"
+	"github.com/gyuho/dplearn/pkg/download"
 	"github.com/gyuho/dplearn/pkg/fileutil"
 	"github.com/gyuho/dplearn/pkg/urlutil"
 
+	humanize "github.com/dustin/go-humanize"
 	"github.com/golang/glog"
-	"github.com/gyuho/archiver"
 )
 
 func main() {
 	sourcePath := flag.String("source-path", "", "Specify the URL to download from.")
 	targetPath := flag.String("target-path", "", "Specify the file path to store.")
-	outputDir := flag.String("output-dir", "", "Specify the output directory to unarchive.")
+	outputDir := flag.String("output-dir", "", "Specify the output directory to unarchive the target file (zip, tar.gz, tar.bz2, tar.xz, tar.zst, tar.lz4, tar.sz, rar).")
 	outputDirOverwrite := flag.Bool("output-dir-overwrite", false, "'true' to delete output directory before unarchive.")
+	extract := flag.String("extract", "", "Specify the comma-separated glob patterns of the files to unarchive (e.g. '*.pb'), empty to unarchive all. Patterns without '/' match the base names.")
+	list := flag.Bool("list", false, "'true' to list the files in the target archive without unarchiving.")
 	smartRename := flag.Bool("smart-rename", false, "'true' to update redundant directory hierarchy.")
 	verbose := flag.Bool("verbose", false, "'true' to run with 'verbose' mode.")
+	checksum := flag.String("checksum", "", "Specify the SHA-256 (or MD5) checksum in hex to verify the target file (e.g. of the release archive).")
+	checksumFile := flag.String("checksum-file", "", "Specify the checksum manifest ('sha256sum' format) to verify the unarchived files.")
+	resume := flag.Bool("resume", false, "'true' to resume the interrupted unarchive in the output directory, skipping the files already unarchived.")
+	requireManifest := flag.Bool("require-manifest", false, "'true' to require the checksum manifest embedded in the target archive (always verified if present).")
+	rateLimitTxt := flag.String("rate-limit", "", "Specify the maximum download rate per second (e.g. 10MB, empty for no limit).")
+	retries := flag.Int("retries", 3, "Specify the number of retries on download failure, resuming the download.")
 	flag.Parse()
 
+	var rateLimit uint64
+	if *rateLimitTxt != "" {
+		var err error
+		if rateLimit, err = humanize.ParseBytes(*rateLimitTxt); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
 	size, sizet, err := urlutil.GetContentLength(*sourcePath)
 	if err != nil {
 		glog.Fatal(err)
@@ -29,7 +50,15 @@ func main() {
 	glog.Infof("%q size is %s", *sourcePath, sizet)
 
 	needDownload := true
-	if fileutil.Exist(*targetPath) {
+	if fileutil.Exist(*targetPath) && *checksum != "" {
+		glog.Infof("%q exists, comparing the checksum", *targetPath)
+		if err = fileutil.VerifyChecksum(*targetPath, *checksum); err == nil {
+			needDownload = false
+			glog.Infof("%q matches the checksum (no need to download)", *targetPath)
+		} else {
+			glog.Warningf("target file %q does not match (%v)", *targetPath, err)
+		}
+	} else if fileutil.Exist(*targetPath) {
 		glog.Infof("%q exists, comparing the size", *targetPath)
 		fi, err := fileutil.GetFileInfo(*targetPath)
 		if err != nil {
@@ -45,19 +74,30 @@ func main() {
 
 	if needDownload {
 		glog.Infof("downloading %q to %q", *sourcePath, *targetPath)
-		data, err := urlutil.Get(urlutil.TrimQuery(*sourcePath))
+		err = download.File(context.Background(), urlutil.TrimQuery(*sourcePath), *targetPath, download.Config{
+			Checksum:  *checksum,
+			RateLimit: int64(rateLimit),
+			Retries:   *retries,
+			Progress: func(done, total int64) {
+				glog.Infof("downloaded %s / %s", humanize.Bytes(uint64(done)), sizet)
+			},
+			ProgressInterval: 10 * time.Second,
+		})
 		if err != nil {
 			glog.Fatal(err)
 		}
-		if !fileutil.Exist(filepath.Dir(*targetPath)) {
-			if err = fileutil.TouchDirAll(filepath.Dir(*targetPath)); err != nil {
-				glog.Fatal(err)
-			}
-		}
-		if err = fileutil.WriteToFile(*targetPath, data); err != nil {
+		glog.Infof("downloaded %q to %q", *sourcePath, *targetPath)
+	}
+
+	if *list {
+		entries, err := archiver.List(*targetPath)
+		if err != nil {
 			glog.Fatal(err)
 		}
-		glog.Infof("downloaded %q to %q", *sourcePath, *targetPath)
+		for _, e := range entries {
+			fmt.Printf("%s %10s %s\n", e.Mode, humanize.Bytes(uint64(e.Size)), e.Name)
+		}
+		return
 	}
 
 	var ff archiver.Archiver
@@ -84,12 +124,41 @@ func main() {
 			glog.Infof("deleted %q", *outputDir)
 		}
 
-		if !fileutil.Exist(*outputDir) {
+		resuming := *resume && fileutil.Exist(filepath.Join(*outputDir, archiver.JournalName))
+		if !fileutil.Exist(*outputDir) || resuming {
+			if resuming {
+				glog.Infof("resuming unarchive into %q", *outputDir)
+			} else {
+				// unarchived files take at least the archive size
+				fi, err := fileutil.GetFileInfo(*targetPath)
+				if err != nil {
+					glog.Fatal(err)
+				}
+				if err = fileutil.EnsureSpace(*outputDir, fi.Size); err != nil {
+					glog.Fatal(err)
+				}
+			}
 			glog.Infof("unarchiving %q", *targetPath)
-			var opts []archiver.OpOption
+			var last time.Time
+			opts := []archiver.OpOption{archiver.WithProgress(func(p archiver.Progress) {
+				if time.Since(last) < 10*time.Second {
+					return
+				}
+				last = time.Now()
+				glog.Infof("unarchived %d file(s), %s / %s (at %q)", p.Files, humanize.Bytes(uint64(p.Bytes)), humanize.Bytes(uint64(p.Total)), p.File)
+			})}
 			if *verbose {
 				opts = append(opts, archiver.WithVerbose())
 			}
+			if *extract != "" {
+				opts = append(opts, archiver.WithPatterns(strings.Split(*extract, ",")...))
+			}
+			if *requireManifest {
+				opts = append(opts, archiver.WithManifest())
+			}
+			if *resume {
+				opts = append(opts, archiver.WithResume())
+			}
 			if err := ff.Open(*targetPath, *outputDir, opts...); err != nil {
 				glog.Fatal(err)
 			}
@@ -121,7 +190,7 @@ func main() {
 
 					tmpPath := *outputDir + ".tmp"
 					glog.Infof("renaming %q to %q", lvl1.Path, tmpPath)
-					if err = os.Rename(lvl1.Path, tmpPath); err != nil {
+					if err = fileutil.MoveAtomic(context.Background(), lvl1.Path, tmpPath); err != nil {
 						glog.Fatal(err)
 					}
 					glog.Infof("renamed %q to %q", lvl1.Path, tmpPath)
@@ -133,7 +202,7 @@ func main() {
 					glog.Infof("removed %q", *outputDir)
 
 					glog.Infof("renaming %q to %q", tmpPath, *outputDir)
-					if err = os.Rename(tmpPath, *outputDir); err != nil {
+					if err = fileutil.MoveAtomic(context.Background(), tmpPath, *outputDir); err != nil {
 						glog.Fatal(err)
 					}
 					glog.Infof("renamed %q to %q", tmpPath, *outputDir)
@@ -155,6 +224,13 @@ func main() {
 	} else {
 		glog.Infof("no need to unarchive %q", *targetPath)
 	}
+
+	if *checksumFile != "" {
+		if err = fileutil.VerifyChecksumFile(*checksumFile); err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("verified checksums in %q", *checksumFile)
+	}
 	glog.Info("success!")
 }
 
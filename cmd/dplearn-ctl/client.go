@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/backend/web"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/experiment"
+	"github.com/gyuho/dplearn/pkg/feature"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/registry"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+	quota "github.com/gyuho/dplearn/pkg/usage"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+// client talks to the backend API (backend-web-server -web-host).
+type client struct {
+	endpoint string
+	http     *http.Client
+	// token is the session token of the user, sent as "Authorization: Bearer".
+	token string
+	// csrf is the CSRF token of the admin requests without the session
+	// token, fetched on the first admin request other than GET.
+	csrf string
+}
+
+func newClient(endpoint string) *client {
+	return &client{endpoint: strings.TrimSuffix(endpoint, "/"), http: &http.Client{}}
+}
+
+// do sends the request with the JSON body (if not nil), and decodes the
+// JSON response into out (if not nil). Error responses are returned as
+// *web.Error.
+func (c *client) do(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		d, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(d)
+	}
+	resp, err := c.send(ctx, method, path, header, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends the request, returning the error responses as *web.Error.
+func (c *client) send(ctx context.Context, method, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if method != http.MethodGet && method != http.MethodHead && strings.HasPrefix(path, "/admin") {
+		if c.csrf == "" {
+			var cresp web.CSRFResponse
+			if err = c.do(ctx, http.MethodGet, "/admin/csrf", nil, nil, &cresp); err != nil {
+				return nil, err
+			}
+			c.csrf = cresp.Token
+		}
+		req.Header.Set(web.CSRFHeader, c.csrf)
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		d, _ := ioutil.ReadAll(resp.Body)
+		aerr := &web.Error{}
+		if json.Unmarshal(d, aerr) != nil || aerr.Code == "" {
+			aerr = web.NewError(resp.StatusCode, web.ErrCodeInternal, "%s %s: %s", method, path, strings.TrimSpace(string(d)))
+		}
+		return nil, aerr
+	}
+	return resp, nil
+}
+
+// submit creates the job of the data (e.g. image URL) on the route.
+func (c *client) submit(ctx context.Context, route, data string) (queue.Item, error) {
+	var item queue.Item
+	err := c.do(ctx, http.MethodPost, route, nil, web.Request{DataFromFrontend: data, CreateRequest: true}, &item)
+	return item, err
+}
+
+// upload uploads the local image with the resumable upload protocol,
+// and returns the upload URL to submit.
+func (c *client) upload(ctx context.Context, fpath string) (string, error) {
+	d, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return "", err
+	}
+	h := make(http.Header)
+	h.Set("Tus-Resumable", "1.0.0")
+	h.Set("Upload-Length", strconv.Itoa(len(d)))
+	h.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filepath.Base(fpath))))
+	resp, err := c.send(ctx, http.MethodPost, web.UploadPath, h, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("upload of %q returned no location", fpath)
+	}
+
+	h = make(http.Header)
+	h.Set("Tus-Resumable", "1.0.0")
+	h.Set("Upload-Offset", "0")
+	h.Set("Content-Type", "application/offset+octet-stream")
+	if resp, err = c.send(ctx, http.MethodPatch, loc, h, bytes.NewReader(d)); err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return loc, nil
+}
+
+// job returns the current status of the job.
+func (c *client) job(ctx context.Context, route, requestID string) (queue.Item, error) {
+	h := make(http.Header)
+	h.Set(web.RequestIDHeader, requestID)
+	var item queue.Item
+	err := c.do(ctx, http.MethodGet, route, h, nil, &item)
+	return item, err
+}
+
+func (c *client) jobs(ctx context.Context, bucket string, active bool) ([]queue.Item, error) {
+	path := "/admin/jobs?bucket=" + url.QueryEscape(bucket)
+	if active {
+		path += "&active=true"
+	}
+	var items []queue.Item
+	err := c.do(ctx, http.MethodGet, path, nil, nil, &items)
+	return items, err
+}
+
+func (c *client) cancel(ctx context.Context, requestID string) (queue.Item, error) {
+	var item queue.Item
+	err := c.do(ctx, http.MethodPost, "/admin/jobs", nil, web.JobsRequest{RequestID: requestID, Cancel: true}, &item)
+	return item, err
+}
+
+func (c *client) workers(ctx context.Context) ([]workerproc.Liveness, error) {
+	var ws []workerproc.Liveness
+	err := c.do(ctx, http.MethodGet, "/workers", nil, nil, &ws)
+	return ws, err
+}
+
+func (c *client) backup(ctx context.Context) (web.Backup, error) {
+	var b web.Backup
+	err := c.do(ctx, http.MethodGet, "/admin/backup", nil, nil, &b)
+	return b, err
+}
+
+func (c *client) restore(ctx context.Context, b web.Backup) (web.RestoreResult, error) {
+	var ret web.RestoreResult
+	err := c.do(ctx, http.MethodPost, "/admin/backup", nil, b, &ret)
+	return ret, err
+}
+
+func (c *client) models(ctx context.Context, name string) (web.ModelsStatus, error) {
+	var st web.ModelsStatus
+	err := c.do(ctx, http.MethodGet, "/admin/models?name="+url.QueryEscape(name), nil, nil, &st)
+	return st, err
+}
+
+// putArtifact uploads the local model artifact to the registry,
+// and returns its URI to register.
+func (c *client) putArtifact(ctx context.Context, name, version, fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := make(http.Header)
+	h.Set("Content-Type", "application/octet-stream")
+	q := url.Values{"name": {name}, "version": {version}}
+	resp, err := c.send(ctx, http.MethodPut, "/admin/models/artifact?"+q.Encode(), h, f)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var ar web.ArtifactResponse
+	err = json.NewDecoder(resp.Body).Decode(&ar)
+	return ar.ArtifactURI, err
+}
+
+// register registers the model version, or promotes the registered
+// version with only the name and version.
+func (c *client) register(ctx context.Context, mreq web.ModelsRequest) (registry.Model, error) {
+	var m registry.Model
+	err := c.do(ctx, http.MethodPost, "/admin/models", nil, mreq, &m)
+	return m, err
+}
+
+func (c *client) runs(ctx context.Context, exp string) ([]experiment.Run, error) {
+	var rs []experiment.Run
+	err := c.do(ctx, http.MethodGet, "/experiments?experiment="+url.QueryEscape(exp), nil, nil, &rs)
+	return rs, err
+}
+
+func (c *client) compare(ctx context.Context, ids []string) (experiment.Comparison, error) {
+	var cmp experiment.Comparison
+	err := c.do(ctx, http.MethodGet, "/experiments/compare?ids="+url.QueryEscape(strings.Join(ids, ",")), nil, nil, &cmp)
+	return cmp, err
+}
+
+// pipeline starts or cancels the pipeline run.
+func (c *client) pipeline(ctx context.Context, preq web.PipelineRequest) (pipeline.Run, error) {
+	var r pipeline.Run
+	err := c.do(ctx, http.MethodPost, "/pipelines", nil, preq, &r)
+	return r, err
+}
+
+func (c *client) pipelineRun(ctx context.Context, id string) (pipeline.Run, error) {
+	var r pipeline.Run
+	err := c.do(ctx, http.MethodGet, "/pipelines?id="+url.QueryEscape(id), nil, nil, &r)
+	return r, err
+}
+
+func (c *client) pipelineRuns(ctx context.Context, name string) ([]pipeline.Run, error) {
+	var rs []pipeline.Run
+	err := c.do(ctx, http.MethodGet, "/pipelines?pipeline="+url.QueryEscape(name), nil, nil, &rs)
+	return rs, err
+}
+
+// schedule creates, pauses, resumes, or deletes the schedule.
+func (c *client) schedule(ctx context.Context, sreq web.ScheduleRequest) (scheduler.Schedule, error) {
+	var sc scheduler.Schedule
+	if sreq.Delete {
+		return sc, c.do(ctx, http.MethodPost, "/admin/schedules", nil, sreq, nil)
+	}
+	err := c.do(ctx, http.MethodPost, "/admin/schedules", nil, sreq, &sc)
+	return sc, err
+}
+
+func (c *client) schedules(ctx context.Context) (web.SchedulesStatus, error) {
+	var st web.SchedulesStatus
+	err := c.do(ctx, http.MethodGet, "/admin/schedules", nil, nil, &st)
+	return st, err
+}
+
+// queue purges or re-drives the bucket.
+func (c *client) queue(ctx context.Context, qreq web.QueueRequest) (web.QueueResult, error) {
+	var ret web.QueueResult
+	err := c.do(ctx, http.MethodPost, "/admin/queue", nil, qreq, &ret)
+	return ret, err
+}
+
+func (c *client) queueDepths(ctx context.Context) ([]web.BucketDepth, error) {
+	var ds []web.BucketDepth
+	err := c.do(ctx, http.MethodGet, "/admin/queue", nil, nil, &ds)
+	return ds, err
+}
+
+// feature creates, replaces, or deletes the feature flag.
+func (c *client) feature(ctx context.Context, freq web.FeatureRequest) (feature.Flag, error) {
+	var f feature.Flag
+	if freq.Delete {
+		return f, c.do(ctx, http.MethodPost, "/admin/features", nil, freq, nil)
+	}
+	err := c.do(ctx, http.MethodPost, "/admin/features", nil, freq, &f)
+	return f, err
+}
+
+// featureFlag returns the feature flag, and false if not defined.
+func (c *client) featureFlag(ctx context.Context, name string) (feature.Flag, bool, error) {
+	var f feature.Flag
+	err := c.do(ctx, http.MethodGet, "/admin/features?name="+url.QueryEscape(name), nil, nil, &f)
+	if aerr, ok := err.(*web.Error); ok && aerr.Code == web.ErrCodeNotFound && strings.Contains(aerr.Message, feature.ErrNotFound.Error()) {
+		return f, false, nil
+	}
+	return f, err == nil, err
+}
+
+func (c *client) features(ctx context.Context) (web.FeaturesStatus, error) {
+	var st web.FeaturesStatus
+	err := c.do(ctx, http.MethodGet, "/admin/features", nil, nil, &st)
+	return st, err
+}
+
+func (c *client) usage(ctx context.Context) ([]quota.Usage, error) {
+	var us []quota.Usage
+	err := c.do(ctx, http.MethodGet, "/admin/usage", nil, nil, &us)
+	return us, err
+}
+
+// logs streams the log lines of the job until the job is done (or ctx is
+// canceled), calling fn for each line. The server-sent events are:
+//
+//	id: <revision>
+//	data: {"rev":<revision>,"line":"loading model","time":"..."}
+func (c *client) logs(ctx context.Context, requestID string, fn func(queue.LogLine)) error {
+	h := make(http.Header)
+	h.Set("Accept", "text/event-stream")
+	resp, err := c.send(ctx, http.MethodGet, "/cats-request/logs?request_id="+url.QueryEscape(requestID), h, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event == "done" {
+				return nil
+			}
+			var ll queue.LogLine
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ll); err != nil {
+				return err
+			}
+			fn(ll)
+		}
+	}
+	if err = sc.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// watch polls the job status every interval, calling fn on progress,
+// until the job is completed, canceled, or failed.
+func (c *client) watch(ctx context.Context, route, requestID string, interval time.Duration, fn func(queue.Item)) (queue.Item, error) {
+	last := -1
+	for {
+		item, err := c.job(ctx, route, requestID)
+		if err != nil {
+			return item, err
+		}
+		if item.Progress != last {
+			last = item.Progress
+			fn(item)
+		}
+		if item.Progress == queue.MaxProgress || item.Canceled || item.Error != "" {
+			return item, nil
+		}
+		select {
+		case <-ctx.Done():
+			return item, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func readBackup(fpath string) (web.Backup, error) {
+	var b web.Backup
+	f, err := os.Open(fpath)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&b)
+	return b, err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/backend/web"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestClientWatch(t *testing.T) {
+	progress := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(web.RequestIDHeader) != "test-id" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(web.NewError(http.StatusNotFound, web.ErrCodeNotFound, "cannot find request ID"))
+			return
+		}
+		progress += 50
+		item := queue.Item{RequestID: "test-id", Progress: progress}
+		if progress == queue.MaxProgress {
+			item.Value = "cat"
+		}
+		json.NewEncoder(w).Encode(item)
+	}))
+	defer ts.Close()
+
+	c := newClient(ts.URL)
+	var seen []int
+	item, err := c.watch(context.Background(), "/cats-request", "test-id", time.Millisecond, func(item queue.Item) {
+		seen = append(seen, item.Progress)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Value != "cat" || fmt.Sprint(seen) != "[50 100]" {
+		t.Fatalf("unexpected item %+v (progress %v)", item, seen)
+	}
+
+	_, err = c.job(context.Background(), "/cats-request", "unknown-id")
+	if aerr, ok := err.(*web.Error); !ok || aerr.Code != web.ErrCodeNotFound {
+		t.Fatalf("expected %q error, got %v", web.ErrCodeNotFound, err)
+	}
+}
+
+func TestClientLogs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/cats-request/logs" || req.URL.Query().Get("request_id") != "test-id" {
+			t.Errorf("unexpected request %q", req.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 5\ndata: {\"rev\":5,\"line\":\"loading model\"}\n\n")
+		fmt.Fprint(w, "id: 6\ndata: {\"rev\":6,\"line\":\"predicted cat\"}\n\n")
+		fmt.Fprint(w, "event: done\ndata: {}\n\n")
+	}))
+	defer ts.Close()
+
+	var lines []string
+	if err := newClient(ts.URL).logs(context.Background(), "test-id", func(ll queue.LogLine) {
+		lines = append(lines, ll.Line)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(lines) != "[loading model predicted cat]" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
+func TestClientAdminAuth(t *testing.T) {
+	fetches := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/admin/csrf":
+			fetches++
+			json.NewEncoder(w).Encode(web.CSRFResponse{Token: "csrf-token"})
+		case "/admin/queue":
+			if req.Header.Get(web.CSRFHeader) != "csrf-token" && req.Header.Get("Authorization") != "Bearer session-token" {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(web.NewError(http.StatusForbidden, web.ErrCodeForbidden, "missing or invalid CSRF token"))
+				return
+			}
+			json.NewEncoder(w).Encode(web.QueueResult{Jobs: 1})
+		default:
+			t.Errorf("unexpected request %q", req.URL)
+		}
+	}))
+	defer ts.Close()
+
+	c := newClient(ts.URL)
+	for i := 0; i < 2; i++ {
+		if _, err := c.queue(context.Background(), web.QueueRequest{Bucket: "/cats-request", Purge: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 CSRF token fetch, got %d", fetches)
+	}
+
+	c = newClient(ts.URL)
+	c.token = "session-token"
+	if _, err := c.queue(context.Background(), web.QueueRequest{Bucket: "/cats-request", Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 {
+		t.Fatalf("unexpected CSRF token fetch with the session token (%d)", fetches)
+	}
+}
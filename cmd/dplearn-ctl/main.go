@@ -0,0 +1,804 @@
+// dplearn-ctl operates the backend (backend-web-server) through its API:
+// submits and watches jobs, lists and cancels jobs, inspects workers,
+// backs up and restores the queue, tails the job logs, registers and
+// promotes the model versions, compares the training runs, and manages
+// the job schedules and feature flags, and purges or re-drives the queue.
+//
+//	dplearn-ctl -endpoint http://localhost:2200 submit -data https://example.com/cat.jpg -watch
+//	dplearn-ctl list -active
+//	dplearn-ctl logs -id <request ID>
+//	dplearn-ctl register -name cats -version v2 -file ./cats.onnx -metrics accuracy=0.91 -promote
+//	dplearn-ctl compare -ids run-1,run-2
+//	dplearn-ctl schedule -file ./nightly.json
+//	dplearn-ctl feature -name worker-protocol-v2 -deployment prod -percent 10
+//	dplearn-ctl queue -bucket /cats-request -redrive
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gyuho/dplearn/backend/web"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/pipeline"
+	"github.com/gyuho/dplearn/pkg/registry"
+	"github.com/gyuho/dplearn/pkg/scheduler"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+// command is the subcommand of dplearn-ctl.
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client, args []string) error
+}
+
+var commands = map[string]command{
+	"submit":   {"submit a job with the image URL or file, and optionally watch it", runSubmit},
+	"watch":    {"watch the job progress until it is completed", runWatch},
+	"list":     {"list the jobs known to the backend", runList},
+	"cancel":   {"cancel the job", runCancel},
+	"workers":  {"list the workers and their health", runWorkers},
+	"backup":   {"back up the jobs not completed to a file", runBackup},
+	"restore":  {"restore the jobs from the backup file", runRestore},
+	"logs":     {"tail the log lines of the job", runLogs},
+	"models":   {"list the model versions in the registry", runModels},
+	"register": {"register the model version, uploading the artifact file", runRegister},
+	"promote":  {"promote the model version to serving, reloaded by the workers", runPromote},
+	"runs":     {"list the training runs of the experiment", runRuns},
+	"compare":  {"compare the hyperparameters and scores of the training runs", runCompare},
+	"pipeline": {"start, show, or cancel the pipeline runs", runPipeline},
+	"usage":    {"show the usage and quotas of the users", runUsage},
+	"schedule": {"list, create, pause, resume, or delete the job schedules", runSchedule},
+	"feature":  {"list, roll out, or delete the feature flags", runFeature},
+	"queue":    {"show the queue depths, or purge or re-drive the bucket", runQueue},
+}
+
+// jsonOutput is true to print the API responses as JSON.
+var jsonOutput bool
+
+func main() {
+	endpoint := flag.String("endpoint", "http://localhost:2200", "Specify the backend endpoint (backend-web-server -web-host).")
+	timeout := flag.Duration("timeout", 0, "Specify the timeout of the command, 0 for no timeout (e.g. 'watch' and 'logs' run until the job is completed).")
+	token := flag.String("token", "", "Specify the session token of the user (from /users/login), for the admin commands with the user accounts (backend-web-server -users -admins).")
+	flag.BoolVar(&jsonOutput, "json", false, "'true' to print the responses as JSON, instead of the tables.")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	// stop watching on Ctrl-C
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	go func() {
+		<-sigc
+		cancel()
+	}()
+
+	c := newClient(*endpoint)
+	c.token = *token
+	if err := cmd.run(ctx, c, flag.Args()[1:]); err != nil {
+		glog.Exit(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [command flags]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprint(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+func runSubmit(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("submit")
+	route := fs.String("route", "/cats-request", "Specify the route of the job.")
+	data := fs.String("data", "", "Specify the image URL to submit.")
+	file := fs.String("file", "", "Specify the local image file to upload and submit, instead of -data.")
+	watch := fs.Bool("watch", false, "'true' to watch the job until it is completed.")
+	interval := fs.Duration("interval", time.Second, "Specify the interval to poll the job status with -watch.")
+	fs.Parse(args)
+
+	if (*data == "") == (*file == "") {
+		return fmt.Errorf("submit requires one of -data or -file")
+	}
+	if *file != "" {
+		loc, err := c.upload(ctx, *file)
+		if err != nil {
+			return err
+		}
+		glog.Infof("uploaded %q to %q", *file, loc)
+		*data = loc
+	}
+	item, err := c.submit(ctx, *route, *data)
+	if err != nil {
+		return err
+	}
+	if jsonOutput && !*watch {
+		return printJSON(os.Stdout, item)
+	}
+	fmt.Println(item.RequestID)
+	if !*watch {
+		return nil
+	}
+	return watchJob(ctx, c, *route, item.RequestID, *interval)
+}
+
+func runWatch(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("watch")
+	route := fs.String("route", "/cats-request", "Specify the route of the job.")
+	id := fs.String("id", "", "Specify the request ID of the job.")
+	interval := fs.Duration("interval", time.Second, "Specify the interval to poll the job status.")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("watch requires -id")
+	}
+	return watchJob(ctx, c, *route, *id, *interval)
+}
+
+// watchJob prints the job progress until the job is completed,
+// and returns the error if the job is canceled or failed.
+func watchJob(ctx context.Context, c *client, route, requestID string, interval time.Duration) error {
+	item, err := c.watch(ctx, route, requestID, interval, func(item queue.Item) {
+		if jsonOutput {
+			printJSON(os.Stdout, item)
+			return
+		}
+		stage := ""
+		if item.StageProgress != nil {
+			stage = fmt.Sprintf(" (%s)", item.StageProgress.Current)
+		}
+		fmt.Printf("%s %3d%%%s\n", time.Now().Format("15:04:05"), item.Progress, stage)
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case item.Canceled:
+		return fmt.Errorf("job %q is canceled", requestID)
+	case item.Error != "":
+		return fmt.Errorf("job %q failed (%s)", requestID, item.Error)
+	}
+	if !jsonOutput {
+		fmt.Println(item.Value)
+	}
+	return nil
+}
+
+func runList(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("list")
+	bucket := fs.String("bucket", "", "Specify the bucket (route) of the jobs, empty for all.")
+	active := fs.Bool("active", false, "'true' to list only the jobs not completed or canceled.")
+	fs.Parse(args)
+
+	items, err := c.jobs(ctx, *bucket, *active)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, items)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REQUEST ID\tBUCKET\tSTATUS\tPROGRESS\tATTEMPTS\tCREATED")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d%%\t%d\t%s\n", item.RequestID, item.Bucket, jobStatus(item), item.Progress, item.Attempts, humanize.Time(item.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+func jobStatus(item queue.Item) string {
+	switch {
+	case item.Canceled:
+		return "canceled"
+	case item.Error != "":
+		return "failed"
+	case item.Progress == queue.MaxProgress:
+		return "completed"
+	case item.Progress > 0:
+		return "running"
+	}
+	return "queued"
+}
+
+func runCancel(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("cancel")
+	id := fs.String("id", "", "Specify the request ID of the job.")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("cancel requires -id")
+	}
+	item, err := c.cancel(ctx, *id)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, item)
+	}
+	fmt.Printf("canceled %q (progress %d%%)\n", item.RequestID, item.Progress)
+	return nil
+}
+
+func runWorkers(ctx context.Context, c *client, args []string) error {
+	newFlagSet("workers").Parse(args)
+
+	ws, err := c.workers(ctx)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, ws)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tHOST\tALIVE\tHEALTHY\tDRAINING\tRESTARTS\tBUCKETS\tUPDATED")
+	for _, l := range ws {
+		healthy := fmt.Sprint(l.Healthy)
+		if l.HealthError != "" {
+			healthy += " (" + l.HealthError + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%v\t%d\t%s\t%s\n", l.ID, l.Host, l.Alive, healthy, l.Draining, l.Restarts, strings.Join(l.Buckets, ","), humanize.Time(l.UpdatedAt))
+	}
+	return tw.Flush()
+}
+
+func runBackup(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("backup")
+	output := fs.String("output", "", "Specify the backup file path, empty for stdout.")
+	fs.Parse(args)
+
+	b, err := c.backup(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return printJSON(os.Stdout, b)
+	}
+	d, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = fileutil.WriteFileAtomic(*output, d, fileutil.PrivateFileMode); err != nil {
+		return err
+	}
+	glog.Infof("backed up %d job(s) to %q", len(b.Jobs), *output)
+	return nil
+}
+
+func runRestore(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("restore")
+	input := fs.String("input", "", "Specify the backup file path.")
+	fs.Parse(args)
+
+	if *input == "" {
+		return fmt.Errorf("restore requires -input")
+	}
+	b, err := readBackup(*input)
+	if err != nil {
+		return err
+	}
+	ret, err := c.restore(ctx, b)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, ret)
+	}
+	fmt.Printf("restored %d job(s), skipped %d job(s) already in the backend\n", ret.Restored, ret.Skipped)
+	return nil
+}
+
+func runLogs(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("logs")
+	id := fs.String("id", "", "Specify the request ID of the job.")
+	fs.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("logs requires -id")
+	}
+	return c.logs(ctx, *id, func(ll queue.LogLine) {
+		if jsonOutput {
+			printJSON(os.Stdout, ll)
+			return
+		}
+		fmt.Printf("%s %s\n", ll.Time.Format(time.RFC3339), ll.Line)
+	})
+}
+
+func runModels(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("models")
+	name := fs.String("name", "", "Specify the model name, empty for all.")
+	fs.Parse(args)
+
+	st, err := c.models(ctx, *name)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, st)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tFRAMEWORK\tSERVING\tMETRICS\tARTIFACT\tCREATED")
+	for _, m := range st.Models {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\t%s\t%s\n", m.Name, m.Version, m.Framework, st.Serving[m.Name] == m.Version, formatMetrics(m.Metrics), m.ArtifactURI, humanize.Time(m.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+func formatMetrics(metrics map[string]float64) string {
+	ss := make([]string, 0, len(metrics))
+	for k, v := range metrics {
+		ss = append(ss, fmt.Sprintf("%s=%g", k, v))
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+// parseMetrics parses the comma-separated metrics (e.g. "accuracy=0.91,loss=0.2").
+func parseMetrics(s string) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	for _, kv := range strings.Split(s, ",") {
+		if kv == "" {
+			continue
+		}
+		ss := strings.SplitN(kv, "=", 2)
+		if len(ss) != 2 {
+			return nil, fmt.Errorf("invalid metric %q (expected name=value)", kv)
+		}
+		v, err := strconv.ParseFloat(ss[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric %q (%v)", kv, err)
+		}
+		metrics[ss[0]] = v
+	}
+	return metrics, nil
+}
+
+func runRegister(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("register")
+	name := fs.String("name", "", "Specify the model name.")
+	version := fs.String("version", "", "Specify the model version.")
+	framework := fs.String("framework", "onnx", "Specify the inference runtime of the model ('tensorflow' or 'onnx').")
+	file := fs.String("file", "", "Specify the local model artifact file to upload to the registry.")
+	uri := fs.String("artifact-uri", "", "Specify the artifact URI instead of -file (e.g. 'gs://bucket/cats.onnx', or the path on the worker hosts).")
+	metricsTxt := fs.String("metrics", "", "Specify the comma-separated evaluation metrics (e.g. 'accuracy=0.91,loss=0.2').")
+	promote := fs.Bool("promote", false, "'true' to promote the version to serving once registered.")
+	fs.Parse(args)
+
+	if *name == "" || *version == "" {
+		return fmt.Errorf("register requires -name and -version")
+	}
+	if (*file == "") == (*uri == "") {
+		return fmt.Errorf("register requires one of -file or -artifact-uri")
+	}
+	metrics, err := parseMetrics(*metricsTxt)
+	if err != nil {
+		return err
+	}
+	if *file != "" {
+		if *uri, err = c.putArtifact(ctx, *name, *version, *file); err != nil {
+			return err
+		}
+		glog.Infof("uploaded %q to %q", *file, *uri)
+	}
+	m, err := c.register(ctx, web.ModelsRequest{
+		Model:   registry.Model{Name: *name, Version: *version, Framework: *framework, Metrics: metrics, ArtifactURI: *uri},
+		Promote: *promote,
+	})
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, m)
+	}
+	fmt.Printf("registered %s/%s (%s)\n", m.Name, m.Version, m.ArtifactURI)
+	if *promote {
+		fmt.Printf("promoted %s/%s to serving\n", m.Name, m.Version)
+	}
+	return nil
+}
+
+func runPromote(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("promote")
+	name := fs.String("name", "", "Specify the model name.")
+	version := fs.String("version", "", "Specify the registered model version.")
+	fs.Parse(args)
+
+	if *name == "" || *version == "" {
+		return fmt.Errorf("promote requires -name and -version")
+	}
+	m, err := c.register(ctx, web.ModelsRequest{Model: registry.Model{Name: *name, Version: *version}, Promote: true})
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, m)
+	}
+	fmt.Printf("promoted %s/%s to serving\n", m.Name, m.Version)
+	return nil
+}
+
+func runRuns(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("runs")
+	exp := fs.String("experiment", "", "Specify the experiment name, empty for all.")
+	fs.Parse(args)
+
+	rs, err := c.runs(ctx, *exp)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, rs)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEXPERIMENT\tSTATUS\tSCORES\tSTARTED\tDURATION")
+	for _, r := range rs {
+		took := "-"
+		if !r.FinishedAt.IsZero() {
+			took = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Experiment, r.Status, formatMetrics(r.Scores), humanize.Time(r.StartedAt), took)
+	}
+	return tw.Flush()
+}
+
+func runCompare(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("compare")
+	ids := fs.String("ids", "", "Specify the comma-separated run IDs to compare.")
+	all := fs.Bool("all-params", false, "'true' to show all hyperparameters, instead of the ones that differ.")
+	fs.Parse(args)
+
+	if *ids == "" {
+		return fmt.Errorf("compare requires -ids")
+	}
+	cmp, err := c.compare(ctx, strings.Split(*ids, ","))
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, cmp)
+	}
+
+	// one row per run, with the hyperparameters and the final scores
+	params := cmp.Differs
+	if *all {
+		params = cmp.Params
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "ID\tSTATUS\tEPOCHS")
+	for _, k := range params {
+		fmt.Fprintf(tw, "\t%s", k)
+	}
+	for _, k := range cmp.Scores {
+		fmt.Fprintf(tw, "\t%s", k)
+	}
+	fmt.Fprintln(tw)
+	for _, r := range cmp.Runs {
+		fmt.Fprintf(tw, "%s\t%s\t%d", r.ID, r.Status, len(r.Epochs))
+		for _, k := range params {
+			fmt.Fprintf(tw, "\t%s", r.Params[k])
+		}
+		for _, k := range cmp.Scores {
+			if v, ok := r.Scores[k]; ok {
+				fmt.Fprintf(tw, "\t%g", v)
+			} else {
+				fmt.Fprint(tw, "\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func runPipeline(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("pipeline")
+	name := fs.String("name", "", "Specify the pipeline name to start the run of (with -start), or to list the runs of.")
+	input := fs.String("input", "", "Specify the input of the run to start.")
+	start := fs.Bool("start", false, "'true' to start the run of the pipeline -name.")
+	id := fs.String("id", "", "Specify the run ID to show the steps of.")
+	cancel := fs.Bool("cancel", false, "'true' to cancel the run -id.")
+	fs.Parse(args)
+
+	var (
+		r   pipeline.Run
+		err error
+	)
+	switch {
+	case *start:
+		if *name == "" {
+			return fmt.Errorf("pipeline -start requires -name")
+		}
+		r, err = c.pipeline(ctx, web.PipelineRequest{Pipeline: *name, Input: *input})
+	case *cancel:
+		if *id == "" {
+			return fmt.Errorf("pipeline -cancel requires -id")
+		}
+		r, err = c.pipeline(ctx, web.PipelineRequest{ID: *id, Cancel: true})
+	case *id != "":
+		r, err = c.pipelineRun(ctx, *id)
+	default:
+		rs, err := c.pipelineRuns(ctx, *name)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(os.Stdout, rs)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPIPELINE\tSTATUS\tSTEPS\tCREATED\tUPDATED")
+		for _, r := range rs {
+			completed := 0
+			for _, st := range r.Steps {
+				if st.Status == pipeline.StatusCompleted {
+					completed++
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", r.ID, r.Definition.Name, r.Status, completed, len(r.Steps), humanize.Time(r.CreatedAt), humanize.Time(r.UpdatedAt))
+		}
+		return tw.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, r)
+	}
+
+	// one row per step, in the definition order
+	fmt.Printf("pipeline %q run %q: %s\n", r.Definition.Name, r.ID, r.Status)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATUS\tATTEMPTS\tREQUEST ID\tERROR")
+	for _, s := range r.Definition.Steps {
+		st := r.Steps[s.Name]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.Name, st.Status, st.Attempts, st.RequestID, st.Error)
+	}
+	return tw.Flush()
+}
+
+func runSchedule(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("schedule")
+	file := fs.String("file", "", "Specify the JSON file of the schedule to create or replace.")
+	name := fs.String("name", "", "Specify the schedule name to pause, resume, or delete.")
+	pause := fs.Bool("pause", false, "'true' to pause the schedule -name.")
+	resume := fs.Bool("resume", false, "'true' to resume the schedule -name.")
+	del := fs.Bool("delete", false, "'true' to delete the schedule -name.")
+	fs.Parse(args)
+
+	var sreq web.ScheduleRequest
+	switch {
+	case *file != "":
+		d, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		sreq.Schedule = &scheduler.Schedule{}
+		if err = json.Unmarshal(d, sreq.Schedule); err != nil {
+			return fmt.Errorf("%s: %v", *file, err)
+		}
+	case *pause, *resume, *del:
+		if *name == "" {
+			return fmt.Errorf("schedule -pause, -resume, and -delete require -name")
+		}
+		sreq.Name, sreq.Delete = *name, *del
+		if !*del {
+			paused := *pause
+			sreq.Paused = &paused
+		}
+	default:
+		st, err := c.schedules(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(os.Stdout, st)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tWHEN\tNEXT\tLAST RUN\tRUNS\tSKIPPED\tPAUSED\tLAST ERROR")
+		for _, sc := range st.Schedules {
+			when := sc.Cron
+			if when == "" {
+				when = fmt.Sprintf("%d one-off", len(sc.At))
+			}
+			next, last := "-", "-"
+			if !sc.Next.IsZero() {
+				next = humanize.Time(sc.Next)
+			}
+			if !sc.LastRun.IsZero() {
+				last = humanize.Time(sc.LastRun)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%v\t%s\n", sc.Name, when, next, last, sc.Runs, sc.Skipped, sc.Paused, sc.LastError)
+		}
+		return tw.Flush()
+	}
+
+	sc, err := c.schedule(ctx, sreq)
+	if err != nil {
+		return err
+	}
+	if sreq.Delete {
+		fmt.Printf("deleted schedule %q\n", sreq.Name)
+		return nil
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, sc)
+	}
+	fmt.Printf("schedule %q: next %s, paused %v\n", sc.Name, sc.Next.Format(time.RFC3339), sc.Paused)
+	return nil
+}
+
+func runFeature(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("feature")
+	name := fs.String("name", "", "Specify the feature flag name to roll out or delete.")
+	percent := fs.Int("percent", -1, "Specify the percentage (0 to 100) of the jobs or users to turn the feature -name on for.")
+	deployment := fs.String("deployment", "", "Specify the deployment to set -percent of, instead of the other deployments.")
+	description := fs.String("description", "", "Specify the description of the feature -name.")
+	del := fs.Bool("delete", false, "'true' to delete the feature flag -name.")
+	fs.Parse(args)
+
+	var freq web.FeatureRequest
+	switch {
+	case *del:
+		if *name == "" {
+			return fmt.Errorf("feature -delete requires -name")
+		}
+		freq.Name, freq.Delete = *name, true
+	case *percent >= 0:
+		if *name == "" {
+			return fmt.Errorf("feature -percent requires -name")
+		}
+		// keep the percentages of the other deployments
+		f, _, err := c.featureFlag(ctx, *name)
+		if err != nil {
+			return err
+		}
+		f.Name = *name
+		if *description != "" {
+			f.Description = *description
+		}
+		if *deployment != "" {
+			if f.Deployments == nil {
+				f.Deployments = make(map[string]int)
+			}
+			f.Deployments[*deployment] = *percent
+		} else {
+			f.Percent = *percent
+		}
+		freq.Flag = &f
+	default:
+		st, err := c.features(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(os.Stdout, st)
+		}
+		fmt.Printf("deployment %q\n", st.Deployment)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tPERCENT\tDEPLOYMENTS\tEFFECTIVE\tUPDATED\tDESCRIPTION")
+		for _, f := range st.Flags {
+			ds := make([]string, 0, len(f.Deployments))
+			for d, p := range f.Deployments {
+				ds = append(ds, fmt.Sprintf("%s=%d%%", d, p))
+			}
+			sort.Strings(ds)
+			fmt.Fprintf(tw, "%s\t%d%%\t%s\t%d%%\t%s\t%s\n", f.Name, f.Percent, strings.Join(ds, ","), f.PercentOf(st.Deployment), humanize.Time(f.UpdatedAt), f.Description)
+		}
+		return tw.Flush()
+	}
+
+	f, err := c.feature(ctx, freq)
+	if err != nil {
+		return err
+	}
+	if freq.Delete {
+		fmt.Printf("deleted feature %q\n", freq.Name)
+		return nil
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, f)
+	}
+	fmt.Printf("feature %q: %d%%, deployments %v\n", f.Name, f.Percent, f.Deployments)
+	return nil
+}
+
+func runQueue(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("queue")
+	bucket := fs.String("bucket", "", "Specify the bucket to purge or re-drive (e.g. /cats-request).")
+	purge := fs.Bool("purge", false, "'true' to cancel the jobs waiting in -bucket.")
+	redrive := fs.Bool("redrive", false, "'true' to move the jobs in the dead letter bucket of -bucket back to -bucket.")
+	fs.Parse(args)
+
+	if !*purge && !*redrive {
+		ds, err := c.queueDepths(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(os.Stdout, ds)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "BUCKET\tWAITING\tDEAD LETTER")
+		for _, d := range ds {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", d.Bucket, d.Depth, d.DeadLetter)
+		}
+		return tw.Flush()
+	}
+	if *bucket == "" || *purge == *redrive {
+		return fmt.Errorf("queue requires -bucket with either -purge or -redrive")
+	}
+
+	ret, err := c.queue(ctx, web.QueueRequest{Bucket: *bucket, Purge: *purge, Redrive: *redrive})
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, ret)
+	}
+	if *purge {
+		fmt.Printf("purged %d job(s) from %q\n", ret.Jobs, ret.Bucket)
+	} else {
+		fmt.Printf("re-drove %d job(s) to %q\n", ret.Jobs, ret.Bucket)
+	}
+	return nil
+}
+
+func runUsage(ctx context.Context, c *client, args []string) error {
+	newFlagSet("usage").Parse(args)
+
+	us, err := c.usage(ctx)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJSON(os.Stdout, us)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tDAY\tJOBS\tCOMPUTE\tTOTAL JOBS\tTOTAL COMPUTE\tSTORAGE\tUPDATED")
+	for _, u := range us {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n", u.User, u.Day, u.Jobs, seconds(u.ComputeSeconds), u.TotalJobs, seconds(u.TotalComputeSeconds), humanize.Bytes(uint64(u.StorageBytes)), humanize.Time(u.UpdatedAt))
+	}
+	return tw.Flush()
+}
+
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := parseMetrics("accuracy=0.91,loss=0.2,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string]float64{"accuracy": 0.91, "loss": 0.2}; !reflect.DeepEqual(metrics, exp) {
+		t.Fatalf("metrics expected %v, got %v", exp, metrics)
+	}
+	if s := formatMetrics(metrics); s != "accuracy=0.91,loss=0.2" {
+		t.Fatalf("unexpected formatted metrics %q", s)
+	}
+	for _, s := range []string{"accuracy", "accuracy=high"} {
+		if _, err = parseMetrics(s); err == nil {
+			t.Fatalf("expected error on %q", s)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	containerimage "github.com/gyuho/dplearn/container-image"
+	"github.com/gyuho/dplearn/pkg/config"
 	"github.com/gyuho/dplearn/pkg/fileutil"
 
 	"github.com/golang/glog"
@@ -13,7 +14,11 @@ import (
 
 func main() {
 	configPath := flag.String("config", "container.yaml", "Specify config file path.")
+	configFlags := config.AddFlags(flag.CommandLine, "generators.dockerfiles")
 	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
 
 	cfg, err := containerimage.Read(*configPath)
 	if err != nil {
@@ -28,32 +33,50 @@ func main() {
 	}
 
 	app := filepath.Join(dir, "Dockerfile-app")
-	if err = fileutil.WriteToFile(app, []byte(cfg.DockerfileApp)); err != nil {
+	if err = fileutil.WriteFileAtomic(app, []byte(cfg.DockerfileApp), 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", app)
 
 	proxy := filepath.Join(dir, "Dockerfile-reverse-proxy")
-	if err = fileutil.WriteToFile(proxy, []byte(cfg.DockerfileReverseProxy)); err != nil {
+	if err = fileutil.WriteFileAtomic(proxy, []byte(cfg.DockerfileReverseProxy), 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", proxy)
 
 	r := filepath.Join(dir, "Dockerfile-r")
-	if err = fileutil.WriteToFile(r, []byte(cfg.DockerfileR)); err != nil {
+	if err = fileutil.WriteFileAtomic(r, []byte(cfg.DockerfileR), 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", r)
 
 	python3CPU := filepath.Join(dir, "Dockerfile-python3-cpu")
-	if err = fileutil.WriteToFile(python3CPU, []byte(cfg.DockerfilePython3CPU)); err != nil {
+	if err = fileutil.WriteFileAtomic(python3CPU, []byte(cfg.DockerfilePython3CPU), 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", python3CPU)
 
 	python3GPU := filepath.Join(dir, "Dockerfile-python3-gpu")
-	if err = fileutil.WriteToFile(python3GPU, []byte(cfg.DockerfilePython3GPU)); err != nil {
+	if err = fileutil.WriteFileAtomic(python3GPU, []byte(cfg.DockerfilePython3GPU), 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", python3GPU)
+
+	frontend := filepath.Join(dir, "Dockerfile-frontend")
+	if err = fileutil.WriteFileAtomic(frontend, []byte(cfg.DockerfileFrontend), 0644); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %q", frontend)
+
+	backend := filepath.Join(dir, "Dockerfile-backend")
+	if err = fileutil.WriteFileAtomic(backend, []byte(cfg.DockerfileBackend), 0644); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %q", backend)
+
+	compose := filepath.Join(dir, "docker-compose.yml")
+	if err = fileutil.WriteFileAtomic(compose, []byte(cfg.DockerCompose), 0644); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %q", compose)
 }
@@ -1,12 +1,17 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"text/template"
-	"time"
 
+	frontenddep "github.com/gyuho/dplearn/frontend-dep"
+	"github.com/gyuho/dplearn/pkg/config"
 	"github.com/gyuho/dplearn/pkg/fileutil"
 	"github.com/gyuho/dplearn/pkg/gcp"
 
@@ -14,30 +19,58 @@ import (
 )
 
 func main() {
+	configPath := flag.String("config", "frontend.yaml", "Specify config file path, empty to use the default configuration.")
+	backendHost := flag.String("backend-host", "", "Specify the backend host and port to override 'backend-host' of the config (e.g. 'backend:2200' in docker-compose).")
 	outputPathPackageJSON := flag.String("output-package-json", "package.json", "Specify package.json output file path.")
-	outputPathAngularCLIJSON := flag.String("output-angular-cli-json", "package.json", "Specify angular-cli.json output file path.")
+	outputPathAngularCLIJSON := flag.String("output-angular-cli-json", "package.json", "Specify angular-cli.json output file path (Angular 5 or earlier), empty to skip.")
+	outputPathAngularJSON := flag.String("output-angular-json", "", "Specify angular.json output file path (Angular 6 or later), empty to skip.")
+	outputPathProxyConfigJSON := flag.String("output-proxy-config-json", "", "Specify proxy.config.json output file path, empty to skip.")
+	templatePackageJSON := flag.String("template-package-json", "", "Specify package.json template file path (Go text/template with .Env, default, require), empty to use the built-in template.")
+	templateAngularCLIJSON := flag.String("template-angular-cli-json", "", "Specify angular-cli.json template file path (Go text/template with .Env, default, require), empty to use the built-in template.")
+	templateAngularJSON := flag.String("template-angular-json", "", "Specify angular.json template file path (Go text/template with .Env, default, require), empty to use the built-in template.")
+	templateProxyConfigJSON := flag.String("template-proxy-config-json", "", "Specify proxy.config.json template file path (Go text/template with .Env, default, require), empty to use the built-in template.")
+	dryRun := flag.Bool("dry-run", false, "'true' to print the unified diff of the output files without writing (implies -diff).")
+	check := flag.Bool("check", false, "'true' to exit non-zero with the summary of the output files that differ from the rendered files, without writing.")
+	diff := flag.Bool("diff", false, "'true' to print the unified diff of the existing output files and the rendered files to stdout.")
+	merge := flag.Bool("merge", false, "'true' to merge the rendered package.json into the existing file, keeping the scripts and dependencies added locally, and reporting the local changes replaced by the template.")
+	stdout := flag.Bool("stdout", false, "'true' to write the rendered files to stdout in order, instead of the output paths (e.g. to pipe with '-output-angular-cli-json \"\"').")
+	sortKeys := flag.Bool("sort-keys", false, "'true' to sort the JSON object keys of the rendered files, for the output independent of the template order.")
+	lineEnding := flag.String("line-ending", "lf", "Specify the line ending of the rendered files ('lf' or 'crlf'), regardless of the template line endings.")
+	fileModeTxt := flag.String("file-mode", "0644", "Specify the permission bits in octal of the written files, regardless of umask.")
+	appNames := flag.String("apps", "", "Specify the comma-separated names of the apps in the config to render, empty to render all.")
+	refreshDependencies := flag.Bool("refresh-dependencies", false, "'true' to update the pinned versions of the packages in 'dependency-ranges' of the config to the highest versions satisfying the ranges.")
+	npmRegistry := flag.String("npm-registry", frontenddep.DefaultRegistry, "Specify the npm registry to query the package versions from (with -refresh-dependencies).")
+	lockfile := flag.String("lockfile", "", "Specify yarn.lock or package-lock.json to read the package versions from, instead of the npm registry (with -refresh-dependencies).")
+	configFlags := config.AddFlags(flag.CommandLine, "generators.frontend-dep")
 	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
 
-	cfg := configuration{
-		NgCommandServeStart:     "ng serve --aot",
-		NgCommandServeStartProd: "ng serve --aot --prod",
-
-		// 0.0.0.0 means "all IPv4 addresses on the local machine".
-		// If a host has two IP addresses, 192.168.1.1 and 10.1.2.1,
-		// and a server running on the host listens on 0.0.0.0,
-		// it will be reachable at both of those IPs
-		// (Source https://en.wikipedia.org/wiki/0.0.0.0).
-		Host:         "0.0.0.0",
-		HostPort:     4200,
-		HostProd:     "0.0.0.0",
-		HostProdPort: 4200,
+	eol := "\n"
+	switch *lineEnding {
+	case "lf":
+	case "crlf":
+		eol = "\r\n"
+	default:
+		glog.Fatalf("unknown -line-ending %q (expected 'lf' or 'crlf')", *lineEnding)
+	}
+	fileMode, err := strconv.ParseUint(*fileModeTxt, 8, 32)
+	if err != nil || fileMode > 0777 {
+		glog.Fatalf("invalid -file-mode %q (expected octal permission bits, e.g. 0644)", *fileModeTxt)
+	}
+	if *stdout && (*diff || *dryRun) {
+		glog.Fatal("-stdout cannot be used with -diff or -dry-run")
 	}
 
-	bts, err := gcp.GetComputeMetadata("instance/network-interfaces/0/access-configs/0/external-ip", 3, 300*time.Millisecond)
-	if err != nil {
-		glog.Warning(err)
-	} else {
-		ip := strings.TrimSpace(string(bts))
+	cfg := frontenddep.DefaultConfig()
+	if *configPath != "" {
+		if cfg, err = frontenddep.Read(*configPath); err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("loaded config %q", *configPath)
+	}
+	if ip := gcp.DetectEnvironment(context.Background()).ExternalIP; ip != "" {
 		glog.Infof("found public host IP %q", ip)
 
 		// TODO: angular-cli does not work with public IP, so need to use 0.0.0.0
@@ -45,167 +78,237 @@ func main() {
 		// https://github.com/webpack/webpack-dev-server/issues/882
 	}
 
-	buf := new(bytes.Buffer)
-	tp := template.Must(template.New("tmplPackageJSON").Parse(tmplPackageJSON))
-	if err := tp.Execute(buf, &cfg); err != nil {
-		glog.Fatal(err)
+	var src frontenddep.VersionSource = frontenddep.Registry{URL: *npmRegistry}
+	if *refreshDependencies && *lockfile != "" {
+		l, err := frontenddep.ReadLockfile(*lockfile)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("loaded lockfile %q", *lockfile)
+		src = l
 	}
-	txt := buf.Bytes()
-	if err := fileutil.WriteToFile(*outputPathPackageJSON, txt); err != nil {
-		glog.Fatal(err)
+
+	// without the apps, the top-level configuration is rendered
+	// to the output paths as is
+	apps := cfg.Apps
+	if len(apps) == 0 {
+		apps = []frontenddep.App{{Config: cfg}}
+	}
+	if *appNames != "" {
+		apps = selectApps(apps, strings.Split(*appNames, ","))
 	}
-	glog.Infof("wrote %q", *outputPathPackageJSON)
 
-	buf.Reset()
+	var drifted []string
+
+	// lock the directory of -output-package-json, also with the apps in
+	// their own directories, so that concurrent runs do not leave the
+	// outputs from different runs
+	lockPath := filepath.Join(filepath.Dir(*outputPathPackageJSON), ".gen-frontend-dep.lock")
+	if err := fileutil.WithLock(lockPath, func() error {
+		for _, app := range apps {
+			acfg := app.Config
+			if *backendHost != "" {
+				acfg.BackendHost = *backendHost
+			}
+			if app.Name != "" {
+				glog.Infof("rendering app %q into %q", app.Name, app.Dir)
+			}
 
-	tp = template.Must(template.New("tmplAngularCLIJSON").Parse(tmplAngularCLIJSON))
-	if err := tp.Execute(buf, &cfg); err != nil {
+			if *refreshDependencies {
+				tmpl, err := readTemplate(*templatePackageJSON)
+				if err != nil {
+					return err
+				}
+				var changes []frontenddep.VersionChange
+				if acfg, changes, err = acfg.RefreshDependencies(context.Background(), tmpl, src); err != nil {
+					return err
+				}
+				for _, c := range changes {
+					glog.Infof("updated %s", c)
+				}
+				glog.Infof("refreshed %d of %d package(s) (pin in 'dependencies' of the config to keep)", len(changes), len(acfg.DependencyRanges))
+			}
+
+			for _, o := range []struct {
+				templatePath string
+				render       func(tmpl string) ([]byte, error)
+				outputPath   string
+				merge        bool
+			}{
+				{*templatePackageJSON, acfg.PackageJSON, *outputPathPackageJSON, *merge},
+				{*templateAngularCLIJSON, acfg.AngularCLIJSON, *outputPathAngularCLIJSON, false},
+				{*templateAngularJSON, acfg.AngularJSON, *outputPathAngularJSON, false},
+				{*templateProxyConfigJSON, acfg.ProxyConfigJSON, *outputPathProxyConfigJSON, false},
+			} {
+				if o.outputPath == "" {
+					continue
+				}
+				outputPath := appPath(app.Dir, o.outputPath)
+				tmpl, err := readTemplate(o.templatePath)
+				if err != nil {
+					return err
+				}
+				txt, err := o.render(tmpl)
+				if err != nil {
+					return err
+				}
+				if o.merge {
+					if txt, err = mergeExisting(outputPath, txt); err != nil {
+						return err
+					}
+				}
+				if *sortKeys {
+					if txt, err = frontenddep.SortKeys(txt); err != nil {
+						return fmt.Errorf("%q: %v", outputPath, err)
+					}
+				}
+				txt = frontenddep.NormalizeLineEndings(txt, eol)
+				if *diff || *dryRun {
+					if err = printDiff(outputPath, txt); err != nil {
+						return err
+					}
+				}
+				if *check {
+					summary, err := checkDrift(outputPath, txt)
+					if err != nil {
+						return err
+					}
+					if summary != "" {
+						drifted = append(drifted, summary)
+					}
+					continue
+				}
+				if *stdout {
+					if _, err = os.Stdout.Write(txt); err != nil {
+						return err
+					}
+					glog.Infof("wrote %q to stdout", outputPath)
+					continue
+				}
+				if *dryRun {
+					glog.Infof("skipped writing %q (dry run)", outputPath)
+					continue
+				}
+				if err = fileutil.TouchDirAll(filepath.Dir(outputPath)); err != nil {
+					return err
+				}
+				if err = fileutil.WriteFileAtomic(outputPath, txt, os.FileMode(fileMode)); err != nil {
+					return err
+				}
+				glog.Infof("wrote %q", outputPath)
+			}
+		}
+		return nil
+	}); err != nil {
 		glog.Fatal(err)
 	}
-	txt = buf.Bytes()
-	if err := fileutil.WriteToFile(*outputPathAngularCLIJSON, txt); err != nil {
-		glog.Fatal(err)
+	if len(drifted) > 0 {
+		glog.Exitf("%d file(s) out of date (run gen-frontend-dep):\n%s", len(drifted), strings.Join(drifted, "\n"))
 	}
-	glog.Infof("wrote %q", *outputPathAngularCLIJSON)
 }
 
-type configuration struct {
-	NgCommandServeStart     string
-	NgCommandServeStartProd string
-	Host                    string
-	HostPort                int
-	HostProd                string
-	HostProdPort            int
+// selectApps returns the apps of the names, in the configuration order.
+func selectApps(apps []frontenddep.App, names []string) []frontenddep.App {
+	var selected []frontenddep.App
+	for _, name := range names {
+		found := false
+		for _, app := range apps {
+			if app.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			glog.Fatalf("app %q not found in the config", name)
+		}
+	}
+	for _, app := range apps {
+		for _, name := range names {
+			if app.Name == name {
+				selected = append(selected, app)
+				break
+			}
+		}
+	}
+	return selected
 }
 
-const tmplPackageJSON = `{
-    "name": "app-dplearn",
-    "version": "0.9.9",
-    "license": "Apache-2.0",
-    "angular-cli": {},
-    "bin": {
-        "tslint": "./bin/tslint"
-    },
-    "scripts": {
-        "start": "{{.NgCommandServeStart}} --port {{.HostPort}} --host {{.Host}}",
-        "start-prod": "{{.NgCommandServeStartProd}} --port {{.HostProdPort}} --host {{.HostProd}} --disable-host-check",
-        "lint": "tslint \"frontend/**/*.ts\"",
-        "test": "ng test",
-        "pree2e": "webdriver-manager update",
-        "e2e": "protractor"
-    },
-    "private": true,
-    "dependencies": {
-        "@angular/common": "5.2.1",
-        "@angular/compiler": "5.2.1",
-        "@angular/compiler-cli": "5.2.1",
-        "@angular/core": "5.2.1",
-        "@angular/forms": "5.2.1",
-        "@angular/http": "5.2.1",
-        "@angular/platform-browser": "5.2.1",
-        "@angular/platform-browser-dynamic": "5.2.1",
-        "@angular/animations": "5.2.1",
-        "@angular/router": "5.2.1",
-        "@angular/tsc-wrapped": "4.4.6",
-        "@angular/upgrade": "5.2.1",
-        "@angular/cli": "1.7.0-beta.0",
-        "@angular/cdk": "5.0.4",
-        "@angular/material": "5.0.4",
-        "@types/angular": "1.6.40",
-        "@types/angular-animate": "1.5.9",
-        "@types/angular-cookies": "1.4.5",
-        "@types/angular-mocks": "1.5.11",
-        "@types/angular-resource": "1.5.14",
-        "@types/angular-route": "1.3.4",
-        "@types/angular-sanitize": "1.3.7",
-        "@types/node": "9.3.0",
-        "@types/hammerjs": "2.0.35",
-        "@types/jasmine": "2.8.2",
-        "core-js": "2.5.3",
-        "rxjs": "5.5.6",
-        "typescript": "2.6.2",
-        "ts-node": "4.0.2",
-        "ts-helpers": "1.1.2",
-        "zone.js": "0.8.19",
-        "@types/hammerjs": "2.0.35",
-        "@types/jasmine": "2.8.3",
-        "core-js": "2.5.3",
-        "rxjs": "5.5.6",
-        "typescript": "2.6.2",
-        "ts-node": "4.1.0",
-        "ts-helpers": "1.1.2",
-        "zone.js": "0.8.19"
-    },
-    "devDependencies": {
-        "codelyzer": "4.0.2",
-        "jasmine-core": "2.8.0",
-        "jasmine-spec-reporter": "4.2.1",
-        "karma": "2.0.0",
-        "karma-chrome-launcher": "2.2.0",
-        "karma-cli": "1.0.1",
-        "karma-jasmine": "1.1.1",
-        "karma-remap-istanbul": "0.6.0",
-        "protractor": "5.2.2",
-        "tslint": "5.9.1"
-    },
-    "description": "website",
-    "main": "index.js",
-    "repository": {
-        "url": "https://github.com/gyuho/dplearn",
-        "type": "git"
-    },
-    "author": "Gyu-Ho Lee <gyuhox@gmail.com>"
+// appPath returns the output path of the app, the base name of the output
+// path in the app directory, or the output path as is without the apps.
+func appPath(dir, outputPath string) string {
+	if dir == "" {
+		return outputPath
+	}
+	return filepath.Join(dir, filepath.Base(outputPath))
 }
-`
-
-const tmplAngularCLIJSON = `{
-    "project": {
-        "version": "1.7.0-beta.0",
-        "name": "app-dplearn"
-    },
-    "apps": [{
-        "root": "frontend",
-        "outDir": "dist",
-        "assets": [
-            "assets",
-            "favicon.ico"
-        ],
-        "index": "index.html",
-        "main": "main.ts",
-        "test": "test.ts",
-        "tsconfig": "tsconfig.json",
-        "prefix": "app",
-        "mobile": false,
-        "styles": [
-            "styles.css",
-            "app-dplearn-theme.scss"
-        ],
-        "scripts": [],
-        "environmentSource": "environments/environment.ts",
-        "environments": {
-            "prod": "environments/environment.prod.ts",
-            "dev": "environments/environment.dev.ts"
-        }
-    }],
-    "addons": [],
-    "packages": [],
-    "e2e": {
-        "protractor": {
-            "config": "./protractor.conf.js"
-        }
-    },
-    "test": {
-        "karma": {
-            "config": "./karma.conf.js"
-        }
-    },
-    "defaults": {
-        "styleExt": "css",
-        "prefixInterfaces": false,
-        "lazyRoutePrefix": "+",
-        "serve": {
-            "proxyConfig": "proxy.config.json"
-        }
-    }
+
+// mergeExisting merges the rendered text into the existing file at fpath,
+// so that regeneration keeps the local additions (e.g. "yarn add").
+func mergeExisting(fpath string, txt []byte) ([]byte, error) {
+	cur, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		return txt, nil
+	} else if err != nil {
+		return nil, err
+	}
+	merged, conflicts, err := frontenddep.Merge(cur, txt)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", fpath, err)
+	}
+	for _, c := range conflicts {
+		glog.Warningf("%q: replacing local change %s", fpath, c)
+	}
+	glog.Infof("merged %q (%d conflict(s))", fpath, len(conflicts))
+	return merged, nil
+}
+
+// checkDrift returns the summary of the difference between the file at
+// fpath and the rendered text, or empty if up to date, so that deployment
+// scripts fail on the stale frontend configuration.
+func checkDrift(fpath string, txt []byte) (string, error) {
+	cur, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("%s: missing", fpath), nil
+	} else if err != nil {
+		return "", err
+	}
+	added, deleted := frontenddep.DiffStat(cur, txt)
+	if added == 0 && deleted == 0 {
+		glog.Infof("%q is up to date", fpath)
+		return "", nil
+	}
+	return fmt.Sprintf("%s: +%d -%d lines", fpath, added, deleted), nil
+}
+
+// printDiff prints the unified diff of the file at fpath and the rendered
+// text, to review the changes to the files edited by hand before writing.
+func printDiff(fpath string, txt []byte) error {
+	from := fpath
+	cur, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		from = "/dev/null"
+	} else if err != nil {
+		return err
+	}
+	if d := frontenddep.UnifiedDiff(from, fpath, cur, txt); d != "" {
+		fmt.Print(d)
+	} else {
+		glog.Infof("%q is up to date", fpath)
+	}
+	return nil
+}
+
+// readTemplate reads the template at templatePath, or returns empty
+// for the built-in template if templatePath is empty, so that
+// dependencies can be changed without rebuilding the generator.
+func readTemplate(templatePath string) (string, error) {
+	if templatePath == "" {
+		return "", nil
+	}
+	d, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return "", err
+	}
+	glog.Infof("loaded template %q", templatePath)
+	return string(d), nil
 }
-`
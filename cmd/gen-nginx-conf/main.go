@@ -2,12 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"os"
-	"strings"
 	"text/template"
-	"time"
 
+	"github.com/gyuho/dplearn/pkg/config"
 	"github.com/gyuho/dplearn/pkg/fileutil"
 	"github.com/gyuho/dplearn/pkg/gcp"
 
@@ -17,18 +17,18 @@ import (
 func main() {
 	outputPath := flag.String("output", "nginx.conf", "Specify nginx.conf output file path.")
 	targetPort := flag.Int("target-port", 4200, "Specify target host port to proxy requests to.")
+	configFlags := config.AddFlags(flag.CommandLine, "generators.nginx-conf")
 	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
 
 	cfg := configuration{
 		ServerName: "dplearn.com",
 		TargetPort: *targetPort,
 	}
 
-	bts, err := gcp.GetComputeMetadata("instance/network-interfaces/0/access-configs/0/external-ip", 3, 300*time.Millisecond)
-	if err != nil {
-		glog.Warning(err)
-	} else {
-		ip := strings.TrimSpace(string(bts))
+	if ip := gcp.DetectEnvironment(context.Background()).ExternalIP; ip != "" {
 		glog.Infof("found public host IP %q", ip)
 		cfg.ServerName = ip + " " + cfg.ServerName
 	}
@@ -40,16 +40,16 @@ func main() {
 	}
 	d := buf.Bytes()
 
-	if err := fileutil.WriteToFile(*outputPath, d); err != nil {
+	if err := fileutil.WriteFileAtomic(*outputPath, d, 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote %q", *outputPath)
 
 	glog.Infof("writing to /etc/nginx/sites-available/default")
-	if err = os.MkdirAll("/etc/nginx/sites-available/", os.ModePerm); err != nil {
+	if err := os.MkdirAll("/etc/nginx/sites-available/", os.ModePerm); err != nil {
 		glog.Fatal(err)
 	}
-	if err = fileutil.WriteToFile("/etc/nginx/sites-available/default", d); err != nil {
+	if err := fileutil.WriteFileAtomic("/etc/nginx/sites-available/default", d, 0644); err != nil {
 		glog.Fatal(err)
 	}
 	glog.Infof("wrote to /etc/nginx/sites-available/default")
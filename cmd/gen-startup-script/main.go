@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/gyuho/dplearn/pkg/config"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	startupscript "github.com/gyuho/dplearn/startup-script"
+
+	"github.com/golang/glog"
+)
+
+func main() {
+	configPath := flag.String("config", "startup.yaml", "Specify config file path.")
+	watch := flag.Bool("watch", false, "'true' to regenerate the scripts whenever the config file changes (development mode).")
+	configFlags := config.AddFlags(flag.CommandLine, "generators.startup-script")
+	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
+
+	if err := generate(*configPath); err != nil {
+		glog.Fatal(err)
+	}
+	if !*watch {
+		return
+	}
+
+	w, err := fileutil.NewWatcher(0)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.Add(*configPath); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("watching %q", *configPath)
+	for {
+		select {
+		case <-w.Events():
+		case err = <-w.Errors():
+			glog.Warningf("error watching %q (%v)", *configPath, err)
+		}
+		if err = generate(*configPath); err != nil {
+			glog.Warningf("failed to regenerate (%v)", err)
+		}
+	}
+}
+
+func generate(configPath string) error {
+	cfg, err := startupscript.Read(configPath)
+	if err != nil {
+		return err
+	}
+
+	dir := cfg.ScriptsDir
+	if !fileutil.Exist(dir) {
+		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	// lock the scripts directory, so that concurrent runs
+	// do not leave scripts from different configs
+	return fileutil.WithLock(filepath.Join(dir, ".gen-startup-script.lock"), func() error {
+		for _, s := range []struct {
+			path string
+			data string
+		}{
+			{cfg.ScriptPath("cpu"), cfg.ScriptCPU},
+			{cfg.ScriptPath("gpu"), cfg.ScriptGPU},
+			{cfg.CreatePath("cpu"), cfg.CreateCPU},
+			{cfg.CreatePath("gpu"), cfg.CreateGPU},
+		} {
+			if err := fileutil.WriteFileAtomic(s.path, []byte(s.data), 0755); err != nil {
+				return err
+			}
+			glog.Infof("wrote %q", s.path)
+		}
+		return nil
+	})
+}
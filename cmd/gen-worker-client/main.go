@@ -0,0 +1,381 @@
+// gen-worker-client generates the Python client of the queue service
+// (backend/worker/queue_client.py) from the Go item schema, so that Python
+// workers decode items with the same fields as the backend encodes.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gyuho/dplearn/backend/web"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	"github.com/golang/glog"
+)
+
+func main() {
+	outputPath := flag.String("output", "backend/worker/queue_client.py", "Specify Python client output file path.")
+	flag.Parse()
+
+	txt, err := generate()
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if err = fileutil.WriteFileAtomic(*outputPath, txt, 0644); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %q", *outputPath)
+}
+
+// messages are the Go types generated as Python messages,
+// in dependency order (nested types first).
+var messages = []reflect.Type{
+	reflect.TypeOf(queue.Stage{}),
+	reflect.TypeOf(queue.StageProgress{}),
+	reflect.TypeOf(queue.Item{}),
+	reflect.TypeOf(web.FieldError{}),
+	reflect.TypeOf(web.Error{}),
+}
+
+type configuration struct {
+	ProtocolVersion int
+	ProtocolHeader  string
+	MaxProgress     int
+	Messages        []message
+}
+
+type message struct {
+	Name   string
+	Source string
+	Fields []field
+}
+
+type field struct {
+	Name      string
+	Kind      string
+	Repeated  bool
+	OmitEmpty bool
+}
+
+// generate returns the Python client generated from the Go types.
+func generate() ([]byte, error) {
+	cfg := configuration{
+		ProtocolVersion: queue.ProtocolVersion,
+		ProtocolHeader:  queue.ProtocolHeader,
+		MaxProgress:     queue.MaxProgress,
+	}
+	known := make(map[reflect.Type]bool)
+	for _, typ := range messages {
+		msg, err := toMessage(typ, known)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Messages = append(cfg.Messages, msg)
+		known[typ] = true
+	}
+
+	buf := new(bytes.Buffer)
+	tp := template.Must(template.New("tmplClient").Parse(tmplClient))
+	if err := tp.Execute(buf, &cfg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toMessage(typ reflect.Type, known map[reflect.Type]bool) (message, error) {
+	msg := message{
+		Name:   typ.Name(),
+		Source: strings.TrimPrefix(typ.PkgPath(), "github.com/gyuho/dplearn/") + "." + typ.Name(),
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := strings.Split(sf.Tag.Get("json"), ",")
+		if tag[0] == "-" || sf.PkgPath != "" {
+			continue
+		}
+		f := field{Name: tag[0]}
+		if f.Name == "" {
+			return message{}, fmt.Errorf("%s.%s has no JSON name", msg.Name, sf.Name)
+		}
+		for _, opt := range tag[1:] {
+			if opt == "omitempty" {
+				f.OmitEmpty = true
+			}
+		}
+		var err error
+		f.Kind, f.Repeated, err = pyKind(sf.Type, known)
+		if err != nil {
+			return message{}, fmt.Errorf("%s.%s: %v", msg.Name, sf.Name, err)
+		}
+		msg.Fields = append(msg.Fields, f)
+	}
+	return msg, nil
+}
+
+// pyKind returns the Python type of the field, and true if it's a list.
+func pyKind(typ reflect.Type, known map[reflect.Type]bool) (string, bool, error) {
+	if typ == reflect.TypeOf(time.Time{}) {
+		// encoded in RFC 3339
+		return "str", false, nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return "str", false, nil
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return "int", false, nil
+	case reflect.Bool:
+		return "bool", false, nil
+	case reflect.Ptr:
+		return pyKind(typ.Elem(), known)
+	case reflect.Struct:
+		if !known[typ] {
+			return "", false, fmt.Errorf("%v is not generated before", typ)
+		}
+		return typ.Name(), false, nil
+	case reflect.Slice:
+		kind, repeated, err := pyKind(typ.Elem(), known)
+		if err != nil {
+			return "", false, err
+		}
+		if repeated {
+			return "", false, fmt.Errorf("nested list %v is not supported", typ)
+		}
+		return kind, true, nil
+	}
+	return "", false, fmt.Errorf("%v is not supported", typ)
+}
+
+const tmplClient = `# -*- coding: utf-8 -*-
+# Code generated by cmd/gen-worker-client. DO NOT EDIT.
+"""This script is the HTTP client of the queue service in backend/web,
+with the messages generated from the Go types.
+
+Regenerate with ./scripts/gen-worker-client.sh when the Go types change.
+Jobs over gRPC use the messages in workerpb, generated from worker.proto.
+
+    client = QueueClient('http://localhost:2200/cats-request/queue')
+    item = client.fetch_item(capabilities=['cats-vs-dogs'])
+    item.value, item.progress = 'done', MAX_PROGRESS
+    client.post_item(item)
+"""
+
+from __future__ import print_function
+
+import json
+
+import requests
+
+# PROTOCOL_VERSION is the worker protocol version of the generated schema
+# (see etcdqueue.ProtocolVersion).
+PROTOCOL_VERSION = {{.ProtocolVersion}}
+
+# PROTOCOL_HEADER is the HTTP header with the worker protocol version.
+PROTOCOL_HEADER = '{{.ProtocolHeader}}'
+
+# MAX_PROGRESS is the progress value when the job is done.
+MAX_PROGRESS = {{.MaxProgress}}
+
+try:
+    STRING_TYPES = (str, unicode)
+except NameError:
+    STRING_TYPES = (str,)
+
+
+class SchemaError(ValueError):
+    """SchemaError is raised when the JSON does not match the schema.
+    """
+
+
+class Field(object):
+    """Field is the JSON field of the message. Fields without 'omitempty'
+    are always encoded by Go backend, so they are required in responses.
+    """
+
+    def __init__(self, name, kind, repeated=False, omitempty=False):
+        self.name = name
+        self.kind = kind
+        self.repeated = repeated
+        self.omitempty = omitempty
+
+    def default(self):
+        if self.repeated:
+            return []
+        if issubclass(self.kind, Message):
+            return None
+        return self.kind()
+
+    def decode(self, owner, value):
+        if not self.repeated:
+            return self.decode_one(owner, value)
+        if not isinstance(value, list):
+            raise SchemaError('{0}.{1} is not a list: {2!r}'.format(owner, self.name, value))
+        return [self.decode_one(owner, v) for v in value]
+
+    def decode_one(self, owner, value):
+        if issubclass(self.kind, Message):
+            if not isinstance(value, dict):
+                raise SchemaError('{0}.{1} is not an object: {2!r}'.format(owner, self.name, value))
+            return self.kind.from_dict(value)
+        kinds = STRING_TYPES if self.kind is str else (self.kind,)
+        # bool is a subclass of int
+        if not isinstance(value, kinds) or (self.kind is int and isinstance(value, bool)):
+            raise SchemaError('{0}.{1} is not {2}: {3!r}'.format(owner, self.name, self.kind.__name__, value))
+        return value
+
+    def encode(self, value):
+        if self.repeated:
+            return [self.encode_one(v) for v in value]
+        return self.encode_one(value)
+
+    @staticmethod
+    def encode_one(value):
+        if isinstance(value, Message):
+            return value.to_dict()
+        return value
+
+
+class Message(object):
+    """Message is the base of the generated messages (Python 3.5 in worker
+    images has no dataclasses). Fields are set by keyword arguments.
+    """
+
+    FIELDS = ()
+
+    def __init__(self, **kwargs):
+        for field in self.FIELDS:
+            setattr(self, field.name, kwargs.pop(field.name, field.default()))
+        if kwargs:
+            raise TypeError('unknown fields {0} in {1}'.format(sorted(kwargs), type(self).__name__))
+
+    @classmethod
+    def from_dict(cls, data):
+        """from_dict returns the message decoded from the JSON object.
+        Unknown fields are ignored, so that newer backends can add fields.
+        """
+        kwargs = {}
+        for field in cls.FIELDS:
+            if field.name not in data:
+                if field.omitempty:
+                    continue
+                raise SchemaError('{0} is missing {1!r}: {2!r}'.format(cls.__name__, field.name, data))
+            # Go encodes nil lists and pointers as null
+            if data[field.name] is None:
+                continue
+            kwargs[field.name] = field.decode(cls.__name__, data[field.name])
+        return cls(**kwargs)
+
+    def to_dict(self):
+        """to_dict returns the JSON object of the message.
+        """
+        data = {}
+        for field in self.FIELDS:
+            value = getattr(self, field.name)
+            if field.omitempty and not value:
+                continue
+            data[field.name] = None if value is None else field.encode(value)
+        return data
+
+    def __eq__(self, other):
+        return type(self) is type(other) and self.to_dict() == other.to_dict()
+
+    def __ne__(self, other):
+        return not self.__eq__(other)
+
+    def __repr__(self):
+        return '{0}({1})'.format(type(self).__name__, ', '.join(
+            '{0}={1!r}'.format(f.name, getattr(self, f.name)) for f in self.FIELDS))
+{{range .Messages}}
+
+class {{.Name}}(Message):
+    """{{.Name}} is generated from {{.Source}}.
+    """
+
+    FIELDS = (
+{{- range .Fields}}
+        Field('{{.Name}}', {{.Kind}}{{if .Repeated}}, repeated=True{{end}}{{if .OmitEmpty}}, omitempty=True{{end}}),
+{{- end}}
+    )
+{{end}}
+
+class ClientError(Exception):
+    """ClientError is raised with the structured error response
+    from the queue service.
+    """
+
+    def __init__(self, error):
+        Exception.__init__(self, '{0} ({1}): {2}'.format(error.code, error.status, error.message))
+        self.error = error
+
+
+class QueueClient(object):
+    """QueueClient is the HTTP client of the queue endpoint
+    (e.g. http://localhost:2200/cats-request/queue).
+    """
+
+    def __init__(self, endpoint):
+        self.endpoint = endpoint
+        # e.g. http://localhost:2200/cats-request/logs
+        self.logs_endpoint = endpoint.rsplit('/', 1)[0] + '/logs'
+
+    def headers(self, content_type=None):
+        headers = {PROTOCOL_HEADER: str(PROTOCOL_VERSION)}
+        if content_type:
+            headers['Content-Type'] = content_type
+        return headers
+
+    def fetch_item(self, capabilities=None, timeout=None):
+        """fetch_item blocks until a scheduled job is available, and returns its Item.
+        If capabilities are given, only the jobs of those types are fetched.
+        """
+        params = None
+        if capabilities:
+            params = {'capabilities': ','.join(capabilities)}
+        rresp = requests.get(self.endpoint, params=params, timeout=timeout,
+                             headers=self.headers())
+        return Item.from_dict(decode_response(rresp))
+
+    def post_item(self, item, timeout=None):
+        """post_item posts the processed job, and returns the updated Item.
+        """
+        rresp = requests.post(self.endpoint, data=json.dumps(item.to_dict()), timeout=timeout,
+                              headers=self.headers('application/json'))
+        return Item.from_dict(decode_response(rresp))
+
+    def post_logs(self, request_id, lines, timeout=5):
+        """post_logs appends the log lines of the job, to be streamed to users.
+        """
+        rresp = requests.post(self.logs_endpoint, timeout=timeout,
+                              data=json.dumps({'request_id': request_id, 'lines': lines}),
+                              headers=self.headers('application/json'))
+        decode_response(rresp)
+
+
+def decode_response(rresp):
+    """decode_response returns the JSON object of the response,
+    or raises ClientError on non-200 responses.
+    """
+    if rresp.status_code != 200:
+        raise ClientError(decode_error(rresp))
+    try:
+        return json.loads(rresp.text)
+    except ValueError as err:
+        raise SchemaError('invalid JSON {0!r} ({1})'.format(rresp.text, err))
+
+
+def decode_error(rresp):
+    """decode_error returns the Error of the response, even if the response
+    is not the structured error (e.g. from the proxy).
+    """
+    try:
+        return Error.from_dict(json.loads(rresp.text))
+    except (ValueError, TypeError, AttributeError):
+        return Error(code='unknown', message=rresp.text,
+                     retryable=rresp.status_code >= 500,
+                     status=rresp.status_code)
+`
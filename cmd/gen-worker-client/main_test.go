@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	txt, err := generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := ioutil.ReadFile("../../backend/worker/queue_client.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(txt, existing) {
+		t.Fatal("backend/worker/queue_client.py is out of date with the Go types; run ./scripts/gen-worker-client.sh")
+	}
+}
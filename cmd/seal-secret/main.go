@@ -0,0 +1,62 @@
+// seal-secret seals the secret file in an envelope with the Cloud KMS key
+// (or local key in development), to be resolved by the backend with the
+// 'kms-file:<path>' secret reference, or opens the sealed file.
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/gcp"
+
+	"github.com/golang/glog"
+)
+
+func main() {
+	kmsKey := flag.String("kms-key", "", "Specify the Cloud KMS key ('projects/.../cryptoKeys/<key>'), or 'local:<path>' of the local key in development.")
+	gcpKeyPath := flag.String("gcp-key-path", "", "Specify the GCP service account key file path (empty for the instance service account).")
+	input := flag.String("input", "", "Specify the file path to seal (or open).")
+	output := flag.String("output", "", "Specify the output file path.")
+	open := flag.Bool("open", false, "'true' to open the sealed input file.")
+	shredInput := flag.Bool("shred-input", false, "'true' to shred the plaintext input file once sealed.")
+	flag.Parse()
+
+	var key []byte
+	if *gcpKeyPath != "" {
+		var err error
+		if key, err = ioutil.ReadFile(*gcpKeyPath); err != nil {
+			glog.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	kek, err := gcp.NewKeyEncrypter(ctx, *kmsKey, key)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(*input)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if *open {
+		data, err = gcp.Open(ctx, kek, data)
+	} else {
+		data, err = gcp.Seal(ctx, kek, data)
+	}
+	if err != nil {
+		glog.Fatal(err)
+	}
+	// opened secrets must not be readable by others
+	if err = fileutil.WriteFileAtomic(*output, data, fileutil.PrivateFileMode); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %q", *output)
+
+	if *shredInput && !*open {
+		if err = fileutil.Shred(*input); err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("shredded %q", *input)
+	}
+}
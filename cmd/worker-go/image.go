@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"os"
+)
+
+// loadImage decodes the JPEG or PNG image, and resizes it to size x size
+// with nearest-neighbor sampling, returning RGB values in [height][width][3].
+// Values are scaled to [0, 1] if normalize is true, or kept in [0, 255].
+func loadImage(fpath string, size int, normalize bool) ([][][3]float32, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q (%v)", fpath, err)
+	}
+	return resizeRGB(img, size, normalize), nil
+}
+
+func resizeRGB(img image.Image, size int, normalize bool) [][][3]float32 {
+	b := img.Bounds()
+	scale := float32(1)
+	if normalize {
+		scale = 1.0 / 255
+	}
+	px := make([][][3]float32, size)
+	for y := 0; y < size; y++ {
+		px[y] = make([][3]float32, size)
+		sy := b.Min.Y + y*b.Dy()/size
+		for x := 0; x < size; x++ {
+			sx := b.Min.X + x*b.Dx()/size
+			r, g, bl, _ := img.At(sx, sy).RGBA()
+			// RGBA returns 16-bit values
+			px[y][x] = [3]float32{
+				float32(r>>8) * scale,
+				float32(g>>8) * scale,
+				float32(bl>>8) * scale,
+			}
+		}
+	}
+	return px
+}
+
+// flatten returns the pixels in [1, size, size, 3] (NHWC) order,
+// or in [1, 3, size, size] (NCHW) order if nchw is true.
+func flatten(px [][][3]float32, nchw bool) []float32 {
+	h := len(px)
+	if h == 0 {
+		return nil
+	}
+	w := len(px[0])
+	vs := make([]float32, 0, h*w*3)
+	if !nchw {
+		for y := range px {
+			for x := range px[y] {
+				vs = append(vs, px[y][x][0], px[y][x][1], px[y][x][2])
+			}
+		}
+		return vs
+	}
+	for c := 0; c < 3; c++ {
+		for y := range px {
+			for x := range px[y] {
+				vs = append(vs, px[y][x][c])
+			}
+		}
+	}
+	return vs
+}
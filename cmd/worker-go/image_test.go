@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestResizeRGB(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	px := resizeRGB(img, 2, true)
+	if len(px) != 2 || len(px[0]) != 2 {
+		t.Fatalf("unexpected size %dx%d", len(px), len(px[0]))
+	}
+	if px[0][0] != [3]float32{1, 0, 0} || px[1][1] != [3]float32{0, 0, 1} {
+		t.Fatalf("unexpected pixels %v", px)
+	}
+
+	px = resizeRGB(img, 2, false)
+	if px[0][0] != [3]float32{255, 0, 0} {
+		t.Fatalf("unexpected pixels %v", px)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	px := [][][3]float32{
+		{{1, 2, 3}, {4, 5, 6}},
+		{{7, 8, 9}, {10, 11, 12}},
+	}
+	nhwc := []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if vs := flatten(px, false); !reflect.DeepEqual(vs, nhwc) {
+		t.Fatalf("expected %v, got %v", nhwc, vs)
+	}
+	nchw := []float32{1, 4, 7, 10, 2, 5, 8, 11, 3, 6, 9, 12}
+	if vs := flatten(px, true); !reflect.DeepEqual(vs, nchw) {
+		t.Fatalf("expected %v, got %v", nchw, vs)
+	}
+}
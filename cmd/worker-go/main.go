@@ -0,0 +1,383 @@
+// worker-go serves cats-vs-dogs classification without the Python stack,
+// claiming jobs through pkg/worker. The inference runtime is selected with
+// '-runtime', and each runtime is compiled in with its build tag:
+//
+//	tensorflow: TensorFlow SavedModel, requires the TensorFlow C library
+//	            (https://www.tensorflow.org/install/install_go), 2.0.x
+//	            to match the vendored Go bindings
+//	            go install -tags tensorflow ./cmd/worker-go
+//	            worker-go -runtime tensorflow -model ./cats-model
+//
+//	onnx:       ONNX model (e.g. exported from PyTorch), requires the
+//	            onnxruntime shared library (https://onnxruntime.ai)
+//	            and Go 1.19+ (github.com/yalue/onnxruntime_go is vendored)
+//	            go install -tags onnxruntime ./cmd/worker-go
+//	            worker-go -runtime onnx -model ./cats.onnx -onnxruntime-lib /usr/lib/libonnxruntime.so
+//
+// With '-sidecar', the Python model server runs as a sidecar process over
+// a unix socket, and worker-go translates queue items into its predictions:
+//
+//	worker-go -sidecar 'python3 backend/worker/model_server.py'
+//
+// With '-model-name', the worker loads the serving version of the model
+// in the backend model registry, and reloads it when another version is
+// promoted, without swapping the files on the worker hosts:
+//
+//	worker-go -runtime onnx -model-name cats
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/aws"
+	"github.com/gyuho/dplearn/pkg/azure"
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	"github.com/gyuho/dplearn/pkg/cloud"
+	"github.com/gyuho/dplearn/pkg/config"
+	"github.com/gyuho/dplearn/pkg/datacache"
+	"github.com/gyuho/dplearn/pkg/gcp"
+	"github.com/gyuho/dplearn/pkg/worker"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+// model classifies the image pixels, returning the probability of 'cat'.
+type model interface {
+	Predict(px [][][3]float32) (float32, error)
+	Close() error
+}
+
+// modelConfig configures the model to load.
+type modelConfig struct {
+	path     string
+	tags     []string
+	inputOp  string
+	outputOp string
+	// size is the input image width and height.
+	size int
+	// onnxLib is the path to the onnxruntime shared library.
+	onnxLib string
+	// nchw is true to feed the input in [1, 3, size, size], as in PyTorch.
+	nchw bool
+}
+
+// runtimes maps the runtime names to model loaders,
+// registered by build-tagged files.
+var runtimes = make(map[string]func(cfg modelConfig) (model, error))
+
+func availableRuntimes() []string {
+	rs := make([]string, 0, len(runtimes))
+	for r := range runtimes {
+		rs = append(rs, r)
+	}
+	sort.Strings(rs)
+	return rs
+}
+
+func main() {
+	endpoint := flag.String("endpoint", "http://localhost:2200", "Specify the backend web server endpoint.")
+	runtime := flag.String("runtime", "tensorflow", "Specify the inference runtime ('tensorflow' or 'onnx').")
+	modelPath := flag.String("model", "", "Specify the model path (SavedModel directory, or ONNX file). ONNX files in Cloud Storage ('gs://bucket/object') or S3 ('s3://bucket/object', in the AWS_REGION region) are downloaded through -cache-dir.")
+	tags := flag.String("model-tags", "serve", "Specify the comma-separated SavedModel tags (tensorflow).")
+	inputOp := flag.String("input-op", "input", "Specify the input operation name.")
+	outputOp := flag.String("output-op", "output", "Specify the output operation name (probability of 'cat').")
+	onnxLib := flag.String("onnxruntime-lib", "libonnxruntime.so", "Specify the onnxruntime shared library path (onnx).")
+	layout := flag.String("input-layout", "", "Specify the input layout 'nhwc' or 'nchw' (defaults to 'nhwc' for tensorflow, 'nchw' for onnx).")
+	imageSize := flag.Int("image-size", 64, "Specify the input image width and height.")
+	normalize := flag.Bool("normalize", true, "'true' to scale pixel values to [0, 1].")
+	concurrency := flag.Int("concurrency", 1, "Specify the number of jobs to process concurrently.")
+	drainTimeout := flag.Duration("drain-timeout", 25*time.Second, "Specify the duration for jobs in process to finish on SIGTERM, before they are canceled.")
+	jobTimeout := flag.Duration("job-timeout", 0, "Specify the maximum duration of each job, after which it is canceled and retried by the queue (0 for no timeout).")
+	sidecar := flag.String("sidecar", "", "Specify the model server command to run as a sidecar (e.g. 'python3 backend/worker/model_server.py'), instead of loading -model.")
+	sidecarSocket := flag.String("sidecar-socket", "", "Specify the unix socket path of the sidecar model server (defaults to a temporary file).")
+	registryEndpoint := flag.String("registry-endpoint", "", "Specify the worker registry endpoint to report liveness (e.g. http://localhost:2200/workers).")
+	registryToken := flag.String("registry-token", os.Getenv("DPLEARN_WORKER_TOKEN"), "Specify the worker registry token (defaults to $DPLEARN_WORKER_TOKEN).")
+	version := flag.String("version", "", "Specify the worker version label reported to the registry (e.g. to receive canary jobs, requires -registry-endpoint).")
+	watchPreemption := flag.Bool("watch-preemption", false, "'true' to drain the worker and requeue its jobs when the GCE instance is preempted, or terminates on host maintenance (keep -drain-timeout under 30 seconds), or the EC2 spot instance or Azure spot VM is interrupted.")
+	cloudProvider := flag.String("cloud", "gcp", "Specify the cloud of the instance to watch with -watch-preemption ('gcp', 'aws', or 'azure').")
+	cacheDir := flag.String("cache-dir", filepath.Join(os.TempDir(), "dplearn-datasets"), "Specify the local directory to mirror Cloud Storage and S3 files to, across runs.")
+	cacheBudget := flag.String("cache-budget", "20GB", "Specify the disk budget of -cache-dir, after which the least recently used files are evicted (0 for no limit).")
+	cacheVerify := flag.Bool("cache-verify", false, "'true' to verify the checksum of the model cached in -cache-dir by previous runs, downloading it again if corrupted.")
+	modelName := flag.String("model-name", "", "Specify the model name in the backend model registry, to load its serving version and reload on promotion (-model, if given, is served until the serving version is loaded).")
+	gcpKeyPath := flag.String("gcp-key-path", "", "Specify the GCP service account key file path to download Cloud Storage files (empty for the instance service account).")
+	configFlags := config.AddFlags(flag.CommandLine, "worker")
+	flag.Parse()
+	if _, err := configFlags.Apply(); err != nil {
+		glog.Fatal(err)
+	}
+
+	labels := make(map[string]string)
+	if *version != "" {
+		if *registryEndpoint == "" {
+			glog.Fatal("-version requires -registry-endpoint")
+		}
+		labels[workerproc.VersionLabel] = *version
+	}
+	w := worker.New(worker.Config{
+		Endpoint:         *endpoint,
+		Capabilities:     []string{"cats-vs-dogs"},
+		Concurrency:      *concurrency,
+		DrainTimeout:     *drainTimeout,
+		JobTimeout:       *jobTimeout,
+		RegistryEndpoint: *registryEndpoint,
+		RegistryToken:    *registryToken,
+		Labels:           labels,
+	})
+
+	// the first signal drains the worker, and the second one stops it
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := make(chan os.Signal, 2)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		w.Drain()
+		<-sigc
+		cancel()
+	}()
+	if *watchPreemption {
+		var md cloud.MetadataProvider
+		switch *cloudProvider {
+		case "gcp":
+			md = gcp.NewMetadataClient("")
+		case "aws":
+			md = aws.NewMetadataClient("")
+		case "azure":
+			md = azure.NewMetadataClient("")
+		default:
+			glog.Fatalf("unknown cloud %q (must be 'gcp', 'aws', or 'azure')", *cloudProvider)
+		}
+		go func() {
+			reason, err := md.WaitTermination(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					glog.Warningf("stopped watching preemption (%v)", err)
+				}
+				return
+			}
+			glog.Warningf("draining worker before the instance is reclaimed (%s)", reason)
+			w.Preempt()
+		}()
+	}
+
+	if *sidecar != "" || *sidecarSocket != "" {
+		// only '-sidecar-socket' connects to the running model server
+		cfg := worker.SidecarConfig{Socket: *sidecarSocket}
+		if args := strings.Fields(*sidecar); len(args) > 0 {
+			cfg.Command, cfg.Args = args[0], args[1:]
+		}
+		sc, err := worker.StartSidecar(ctx, cfg)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		defer sc.Stop()
+		go func() {
+			<-sc.Done()
+			glog.Warningf("sidecar exited (%v); stopping worker", sc.Err())
+			cancel()
+		}()
+		w.Handle("/cats-request", sc.Handler())
+		if err = w.Run(ctx); err != nil && err != context.Canceled {
+			glog.Fatal(err)
+		}
+		return
+	}
+
+	load, ok := runtimes[*runtime]
+	if !ok {
+		glog.Fatalf("runtime %q is not compiled in (available %q; see 'go doc ./cmd/worker-go')", *runtime, availableRuntimes())
+	}
+	if *modelPath == "" && *modelName == "" {
+		glog.Fatal("empty -model (or -model-name)")
+	}
+	if *layout == "" {
+		*layout = "nhwc"
+		if *runtime == "onnx" {
+			*layout = "nchw"
+		}
+	}
+	if *layout != "nhwc" && *layout != "nchw" {
+		glog.Fatalf("unknown -input-layout %q", *layout)
+	}
+
+	fetch := func(ctx context.Context, uri string) (string, error) {
+		budget, err := humanize.ParseBytes(*cacheBudget)
+		if err != nil {
+			return "", fmt.Errorf("invalid -cache-budget %q (%v)", *cacheBudget, err)
+		}
+		return fetchCached(ctx, uri, *cacheDir, int64(budget), *cacheVerify, *gcpKeyPath)
+	}
+	cfg := modelConfig{
+		path:     *modelPath,
+		tags:     splitComma(*tags),
+		inputOp:  *inputOp,
+		outputOp: *outputOp,
+		size:     *imageSize,
+		onnxLib:  *onnxLib,
+		nchw:     *layout == "nchw",
+	}
+	var r *reloader
+	if *modelName != "" {
+		r = &reloader{
+			endpoint: strings.TrimSuffix(*endpoint, "/"),
+			name:     *modelName,
+			runtime:  *runtime,
+			dir:      *cacheDir,
+			client:   &http.Client{},
+			cfg:      cfg,
+			load:     load,
+			fetch:    fetch,
+		}
+	}
+
+	var (
+		m       model
+		serving string
+		err     error
+	)
+	if *modelPath != "" {
+		if remoteURI(*modelPath) {
+			if cfg.path, err = fetch(ctx, *modelPath); err != nil {
+				glog.Fatal(err)
+			}
+		}
+		glog.Infof("loading %s model %q", *runtime, cfg.path)
+		if m, err = load(cfg); err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("loaded %s model %q", *runtime, cfg.path)
+	} else {
+		// without -model, the worker starts with the serving version
+		glog.Infof("waiting for serving model %q", *modelName)
+		sm, err := r.next(ctx, "")
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if m, err = r.loadVersion(ctx, sm); err != nil {
+			glog.Fatal(err)
+		}
+		serving = sm.Version
+		glog.Infof("loaded %s model %s/%s", *runtime, sm.Name, sm.Version)
+	}
+
+	c := &classifier{model: m, size: *imageSize, normalize: *normalize}
+	defer func() { c.swap(nil).Close() }()
+	if r != nil {
+		go r.run(ctx, c, serving)
+	}
+	w.Handle("/cats-request", c.handle)
+	if err = w.Run(ctx); err != nil && err != context.Canceled {
+		glog.Fatal(err)
+	}
+}
+
+// remoteURI returns true if the path is a Cloud Storage or S3 URI,
+// fetched with 'fetchCached'.
+func remoteURI(fpath string) bool {
+	return strings.HasPrefix(fpath, "gs://") || strings.HasPrefix(fpath, "s3://")
+}
+
+// fetchCached returns the local path of the Cloud Storage or S3 file,
+// mirrored under the cache directory of its bucket on first use. If
+// 'verify' is true, the file cached by previous runs is verified before use.
+func fetchCached(ctx context.Context, uri, dir string, budget int64, verify bool, keyPath string) (string, error) {
+	cfg, err := blobstore.ParseURL(uri)
+	if err != nil {
+		return "", err
+	}
+	// the bucket is the source, and the object name is the key
+	object := cfg.Prefix
+	if cfg.Driver == blobstore.DriverLocal || object == "" {
+		return "", fmt.Errorf("%q is not a Cloud Storage or S3 object", uri)
+	}
+	cfg.Prefix, cfg.ReadOnly = "", true
+	if keyPath != "" {
+		if cfg.Key, err = ioutil.ReadFile(keyPath); err != nil {
+			return "", err
+		}
+	}
+	src, err := blobstore.Open(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	if cl, ok := src.(io.Closer); ok {
+		defer cl.Close()
+	}
+	c, err := datacache.New(filepath.Join(dir, cfg.Bucket), src, budget)
+	if err != nil {
+		return "", err
+	}
+	if verify {
+		// corrupted file is evicted, and downloaded again
+		if err = c.Verify(object); err != nil {
+			glog.Infof("not using cached %q (%v)", uri, err)
+		}
+	}
+	return c.Get(ctx, object)
+}
+
+type classifier struct {
+	// mu protects the model, held for reading during predictions
+	// so that the model replaced on reload is closed once unused.
+	mu        sync.RWMutex
+	model     model
+	size      int
+	normalize bool
+}
+
+// swap replaces the model, and returns the previous one
+// after the predictions in process are done.
+func (c *classifier) swap(m model) model {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.model
+	c.model = m
+	return old
+}
+
+func (c *classifier) handle(ctx context.Context, item *worker.Item) error {
+	px, err := loadImage(item.Value, c.size, c.normalize)
+	if err != nil {
+		return err
+	}
+	worker.Progress(ctx, 50)
+	worker.Log(ctx, "loaded image, running inference")
+
+	c.mu.RLock()
+	prob, err := c.model.Predict(px)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	class := "non-cat"
+	if prob > 0.5 {
+		class = "cat"
+	}
+	worker.Log(ctx, "classified as %q (%.3f)", class, prob)
+	item.Value = fmt.Sprintf("[WORKER - ACK] it's a '%s'!", class)
+	return nil
+}
+
+func splitComma(s string) []string {
+	var ss []string
+	for _, v := range strings.Split(s, ",") {
+		if v != "" {
+			ss = append(ss, v)
+		}
+	}
+	return ss
+}
@@ -0,0 +1,105 @@
+//go:build onnxruntime
+// +build onnxruntime
+
+package main
+
+import (
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+func init() { runtimes["onnx"] = loadONNX }
+
+// onnxModel runs the ONNX model with onnxruntime. The session is bound to
+// the input and output tensors, so predictions are serialized.
+type onnxModel struct {
+	mu      sync.Mutex
+	session *ort.AdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32]
+	nchw    bool
+}
+
+// the onnxruntime environment is shared by the models, so that the
+// serving model is reloaded while the previous one is in use
+var (
+	envMu   sync.Mutex
+	envRefs int
+)
+
+func acquireEnvironment(lib string) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		ort.SetSharedLibraryPath(lib)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return err
+		}
+	}
+	envRefs++
+	return nil
+}
+
+func releaseEnvironment() error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs--; envRefs > 0 {
+		return nil
+	}
+	return ort.DestroyEnvironment()
+}
+
+func loadONNX(cfg modelConfig) (model, error) {
+	if err := acquireEnvironment(cfg.onnxLib); err != nil {
+		return nil, err
+	}
+
+	// sessions are created with preallocated tensors of the fixed size
+	size := int64(cfg.size)
+	shape := ort.NewShape(1, size, size, 3)
+	if cfg.nchw {
+		shape = ort.NewShape(1, 3, size, size)
+	}
+	input, err := ort.NewEmptyTensor[float32](shape)
+	if err != nil {
+		releaseEnvironment()
+		return nil, err
+	}
+	output, err := ort.NewEmptyTensor[float32](ort.NewShape(1, 1))
+	if err != nil {
+		input.Destroy()
+		releaseEnvironment()
+		return nil, err
+	}
+	session, err := ort.NewAdvancedSession(cfg.path,
+		[]string{cfg.inputOp}, []string{cfg.outputOp},
+		[]ort.ArbitraryTensor{input}, []ort.ArbitraryTensor{output},
+		nil,
+	)
+	if err != nil {
+		input.Destroy()
+		output.Destroy()
+		releaseEnvironment()
+		return nil, err
+	}
+	return &onnxModel{session: session, input: input, output: output, nchw: cfg.nchw}, nil
+}
+
+func (m *onnxModel) Predict(px [][][3]float32) (float32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copy(m.input.GetData(), flatten(px, m.nchw))
+	if err := m.session.Run(); err != nil {
+		return 0, err
+	}
+	return m.output.GetData()[0], nil
+}
+
+func (m *onnxModel) Close() error {
+	m.session.Destroy()
+	m.input.Destroy()
+	m.output.Destroy()
+	return releaseEnvironment()
+}
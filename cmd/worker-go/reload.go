@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/registry"
+
+	"github.com/golang/glog"
+)
+
+// reloader watches the serving version of the model in the registry,
+// and reloads the model of the classifier on promotion. Artifacts in the
+// registry blob store are downloaded under 'dir'; they are single files
+// (e.g. ONNX), so SavedModel directories are registered with the path on
+// the worker hosts.
+type reloader struct {
+	endpoint string
+	name     string
+	runtime  string
+	dir      string
+	client   *http.Client
+
+	// cfg is the model configuration, with the path of each version.
+	cfg  modelConfig
+	load func(cfg modelConfig) (model, error)
+	// fetch returns the local path of Cloud Storage and S3 artifacts.
+	fetch func(ctx context.Context, uri string) (string, error)
+}
+
+// next returns the serving version, once it is not 'version' (empty to
+// return any serving version), until the context is canceled.
+func (r *reloader) next(ctx context.Context, version string) (registry.Model, error) {
+	q := url.Values{"name": {r.name}, "version": {version}}
+	for {
+		req, err := http.NewRequest(http.MethodGet, r.endpoint+"/models/serving?"+q.Encode(), nil)
+		if err != nil {
+			return registry.Model{}, err
+		}
+		resp, err := r.client.Do(req.WithContext(ctx))
+		if err == nil {
+			var m registry.Model
+			switch resp.StatusCode {
+			case http.StatusOK:
+				err = json.NewDecoder(resp.Body).Decode(&m)
+			case http.StatusNotModified:
+			default:
+				d, _ := ioutil.ReadAll(resp.Body)
+				err = fmt.Errorf("serving model %q: %s (%s)", r.name, resp.Status, strings.TrimSpace(string(d)))
+			}
+			resp.Body.Close()
+			if err == nil && m.Version != "" {
+				return m, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return registry.Model{}, ctx.Err()
+		}
+		if err != nil {
+			glog.Warningf("failed to watch model %q (%v)", r.name, err)
+			select {
+			case <-ctx.Done():
+				return registry.Model{}, ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+// loadVersion loads the model version, from its artifact URI.
+func (r *reloader) loadVersion(ctx context.Context, m registry.Model) (model, error) {
+	if m.Framework != r.runtime {
+		return nil, fmt.Errorf("model %s/%s is for %q, not runtime %q", m.Name, m.Version, m.Framework, r.runtime)
+	}
+	fpath := m.ArtifactURI
+	var err error
+	switch {
+	case strings.HasPrefix(fpath, registry.ArtifactScheme):
+		fpath, err = r.download(ctx, m)
+	case remoteURI(fpath):
+		fpath, err = r.fetch(ctx, fpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := r.cfg
+	cfg.path = fpath
+	glog.Infof("loading %s model %s/%s %q", r.runtime, m.Name, m.Version, fpath)
+	return r.load(cfg)
+}
+
+// download returns the local path of the registry artifact, downloaded
+// on first use. Versions are immutable, so the downloaded file is reused.
+func (r *reloader) download(ctx context.Context, m registry.Model) (string, error) {
+	fpath := filepath.Join(r.dir, "registry", m.Name+"@"+m.Version)
+	if fileutil.Exist(fpath) {
+		return fpath, nil
+	}
+	if err := fileutil.TouchDirAll(filepath.Dir(fpath)); err != nil {
+		return "", err
+	}
+	q := url.Values{"name": {m.Name}, "version": {m.Version}}
+	req, err := http.NewRequest(http.MethodGet, r.endpoint+"/models/artifact?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %q (%s)", m.ArtifactURI, resp.Status)
+	}
+
+	// rename on completion, so that partial downloads are not reused
+	f, err := ioutil.TempFile(filepath.Dir(fpath), filepath.Base(fpath)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fpath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	glog.Infof("downloaded %q to %q (%d bytes)", m.ArtifactURI, fpath, n)
+	return fpath, nil
+}
+
+// run reloads the classifier model on every promotion after 'version',
+// until the context is canceled. The jobs in process finish with the
+// previous model, which is closed once they are done.
+func (r *reloader) run(ctx context.Context, c *classifier, version string) {
+	for {
+		m, err := r.next(ctx, version)
+		if err != nil {
+			return
+		}
+		version = m.Version
+		loaded, err := r.loadVersion(ctx, m)
+		if err != nil {
+			glog.Warningf("failed to reload model %s/%s, keeping the current model (%v)", m.Name, m.Version, err)
+			continue
+		}
+		if err = c.swap(loaded).Close(); err != nil {
+			glog.Warningf("failed to close the previous model (%v)", err)
+		}
+		glog.Infof("reloaded %s model %s/%s", r.runtime, m.Name, m.Version)
+	}
+}
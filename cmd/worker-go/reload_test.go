@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/registry"
+)
+
+// fakeModel records the path it is loaded from, and whether it is closed.
+type fakeModel struct {
+	path   string
+	mu     sync.Mutex
+	closed bool
+}
+
+func (m *fakeModel) Predict(px [][][3]float32) (float32, error) { return 0, nil }
+func (m *fakeModel) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	return nil
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the backend serves "v1" first, and "v2" for the next wait
+	servingc := make(chan registry.Model, 2)
+	servingc <- registry.Model{Name: "cats", Version: "v1", Framework: "onnx", ArtifactURI: "registry://cats/v1"}
+	servingc <- registry.Model{Name: "cats", Version: "v2", Framework: "onnx", ArtifactURI: "/models/cats-v2.onnx"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models/serving", func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case m := <-servingc:
+			json.NewEncoder(w).Encode(m)
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusNotModified)
+		}
+	})
+	mux.HandleFunc("/models/artifact", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("version") != "v1" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte("weights-v1"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	loadedc := make(chan *fakeModel, 2)
+	r := &reloader{
+		endpoint: ts.URL,
+		name:     "cats",
+		runtime:  "onnx",
+		dir:      dir,
+		client:   &http.Client{},
+		load: func(cfg modelConfig) (model, error) {
+			m := &fakeModel{path: cfg.path}
+			loadedc <- m
+			return m, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sm, err := r.next(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.loadVersion(ctx, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-loadedc
+	d, err := ioutil.ReadFile(m.(*fakeModel).path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "weights-v1" {
+		t.Fatalf("artifact expected 'weights-v1', got %q", string(d))
+	}
+
+	c := &classifier{model: m}
+	go r.run(ctx, c, sm.Version)
+	select {
+	case m2 := <-loadedc:
+		if m2.path != "/models/cats-v2.onnx" {
+			t.Fatalf("path expected '/models/cats-v2.onnx', got %q", m2.path)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("took too long to reload the model")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		c.mu.RLock()
+		cur := c.model
+		c.mu.RUnlock()
+		m1 := m.(*fakeModel)
+		m1.mu.Lock()
+		closed := m1.closed
+		m1.mu.Unlock()
+		if cur.(*fakeModel).path == "/models/cats-v2.onnx" && closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("took too long to swap the model")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err = r.loadVersion(ctx, registry.Model{Name: "cats", Version: "v3", Framework: "tensorflow", ArtifactURI: "/models/cats"}); err == nil {
+		t.Fatal("expected error on the model of another runtime")
+	}
+}
@@ -0,0 +1,100 @@
+//go:build tensorflow
+// +build tensorflow
+
+package main
+
+import (
+	"fmt"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+func init() { runtimes["tensorflow"] = loadTensorFlow }
+
+type tfModel struct {
+	model  *tf.SavedModel
+	input  tf.Output
+	output tf.Output
+	nchw   bool
+}
+
+func loadTensorFlow(cfg modelConfig) (model, error) {
+	sm, err := tf.LoadSavedModel(cfg.path, cfg.tags, nil)
+	if err != nil {
+		return nil, err
+	}
+	m := &tfModel{model: sm, nchw: cfg.nchw}
+	if m.input, err = operationOutput(sm.Graph, cfg.inputOp); err != nil {
+		sm.Session.Close()
+		return nil, err
+	}
+	if m.output, err = operationOutput(sm.Graph, cfg.outputOp); err != nil {
+		sm.Session.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func operationOutput(g *tf.Graph, name string) (tf.Output, error) {
+	op := g.Operation(name)
+	if op == nil {
+		return tf.Output{}, fmt.Errorf("operation %q not found in graph", name)
+	}
+	return op.Output(0), nil
+}
+
+func (m *tfModel) Predict(px [][][3]float32) (float32, error) {
+	size := int64(len(px))
+	shape := []int64{1, size, size, 3}
+	if m.nchw {
+		shape = []int64{1, 3, size, size}
+	}
+	tensor, err := tf.NewTensor(batch(flatten(px, m.nchw), shape))
+	if err != nil {
+		return 0, err
+	}
+	out, err := m.model.Session.Run(
+		map[tf.Output]*tf.Tensor{m.input: tensor},
+		[]tf.Output{m.output},
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return firstValue(out[0].Value())
+}
+
+func (m *tfModel) Close() error { return m.model.Session.Close() }
+
+// batch slices the flat values into a [d0][d1][d2][d3] nested slice,
+// which tf.NewTensor turns into a tensor of that shape.
+func batch(vs []float32, shape []int64) [][][][]float32 {
+	b := make([][][][]float32, shape[0])
+	for i := range b {
+		b[i] = make([][][]float32, shape[1])
+		for j := range b[i] {
+			b[i][j] = make([][]float32, shape[2])
+			for k := range b[i][j] {
+				b[i][j][k], vs = vs[:shape[3]], vs[shape[3]:]
+			}
+		}
+	}
+	return b
+}
+
+// firstValue returns the first value of the output tensor.
+func firstValue(v interface{}) (float32, error) {
+	switch t := v.(type) {
+	case float32:
+		return t, nil
+	case []float32:
+		if len(t) > 0 {
+			return t[0], nil
+		}
+	case [][]float32:
+		if len(t) > 0 && len(t[0]) > 0 {
+			return t[0][0], nil
+		}
+	}
+	return 0, fmt.Errorf("unexpected output %T", v)
+}
@@ -0,0 +1,291 @@
+// worker-supervisor runs worker processes, restarting them on crash,
+// and reports their liveness to the backend worker registry.
+//
+//	worker-supervisor -name cats -workers 2 -- python3 ./backend/worker/worker.py localhost:2201
+//
+// With '-cpus' or '-memory-mb', each worker process runs in its own cgroup (Linux only),
+// so that one runaway inference does not take down the whole host.
+//
+// With '-log-dir', each worker process appends the job log lines to its own file
+// in the directory (see "DPLEARN_LOG_FILE" environment variable), which the supervisor
+// follows to stream the lines to the backend log endpoint of the bucket:
+//
+//	worker-supervisor -name cats -log-dir /var/log/dplearn -- python3 ./backend/worker/worker.py localhost:2201
+//
+// With '-fetch-url', the file (e.g. model weights) is downloaded before starting workers:
+//
+//	worker-supervisor -name cats -fetch-url https://storage.googleapis.com/my-bucket/parameters-cats.npy -fetch-path ./datasets/parameters-cats.npy -- python3 ./backend/worker/worker.py localhost:2201
+//
+// With '-docker-image', each worker runs in a Docker container instead,
+// with the queue endpoint in "DPLEARN_QUEUE_ENDPOINT" environment variable:
+//
+//	worker-supervisor -name cats -docker-image gcr.io/gcp-dplearn/dplearn:latest-cpu -- python3 /gopath/src/github.com/gyuho/dplearn/backend/worker/worker.py
+//
+// With '-docker-mode job', each job runs in a new container for isolation,
+// with the job in "DPLEARN_JOB" environment variable and the result from stdout:
+//
+//	worker-supervisor -name cats -docker-image my-job-image -docker-mode job -bucket /cats-request
+//
+// With '-k8s-job-image', each job runs as a Kubernetes Job (e.g. heavy training tasks),
+// from inside the cluster:
+//
+//	worker-supervisor -name train -k8s-job-image my-train-image -gpus 1 -bucket /train-request
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/docker"
+	"github.com/gyuho/dplearn/pkg/download"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/kube"
+	"github.com/gyuho/dplearn/pkg/worker"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+func main() {
+	name := flag.String("name", "cats", "Specify the worker name.")
+	workers := flag.Int("workers", 1, "Specify the number of worker processes to run.")
+	registry := flag.String("registry-endpoint", "http://localhost:2200/workers", "Specify the worker registry endpoint (empty to disable liveness reports).")
+	registryToken := flag.String("registry-token", os.Getenv("DPLEARN_WORKER_TOKEN"), "Specify the worker registry token (defaults to $DPLEARN_WORKER_TOKEN).")
+	cpus := flag.Float64("cpus", 0, "Specify the CPU limit per worker process in cores (0 for no limit).")
+	memoryMB := flag.Int64("memory-mb", 0, "Specify the memory limit per worker process in MB (0 for no limit).")
+	cgroup := flag.Bool("cgroup", false, "'true' to run each worker process in its own cgroup to report resource usage, even without limits.")
+	cgroupRoot := flag.String("cgroup-root", "/sys/fs/cgroup", "Specify the cgroup file system root.")
+	dockerImage := flag.String("docker-image", "", "Specify the Docker image to run workers in containers (empty to run host processes).")
+	dockerHost := flag.String("docker-host", docker.DefaultHost, "Specify the Docker daemon host.")
+	dockerNetwork := flag.String("docker-network", "host", "Specify the Docker container network.")
+	dockerMode := flag.String("docker-mode", "worker", "Specify 'worker' to run each worker in a container, or 'job' to run each job in a new container.")
+	scratchDir := flag.String("scratch-dir", "", "Specify the host directory to mount scratch volumes at /scratch (empty to disable).")
+	queueEndpoint := flag.String("queue-endpoint", "localhost:2201", "Specify the queue endpoint for workers in containers (e.g. localhost:2201, http://localhost:2200/cats-request/queue).")
+	backendEndpoint := flag.String("backend-endpoint", "http://localhost:2200", "Specify the backend endpoint to claim jobs from with '-docker-mode job', and to stream job logs to with '-log-dir'.")
+	bucket := flag.String("bucket", "/cats-request", "Specify the bucket that workers process (claimed from directly with '-docker-mode job').")
+	capabilities := flag.String("capabilities", "", "Specify comma-separated job types to claim, with '-docker-mode job' or '-k8s-job-image'.")
+	k8sJobImage := flag.String("k8s-job-image", "", "Specify the image to run each job as a Kubernetes Job (empty to disable).")
+	k8sNamespace := flag.String("k8s-namespace", "", "Specify the namespace of Kubernetes Jobs (defaults to the pod namespace).")
+	gpus := flag.Int("gpus", 0, "Specify the number of GPUs to request per Kubernetes Job.")
+	logDir := flag.String("log-dir", "", "Specify the directory of job log files of worker processes, to stream to the backend (empty to disable).")
+	fetchURL := flag.String("fetch-url", "", "Specify the URL of the file to download before starting workers (e.g. model weights), resuming the partial download.")
+	fetchPath := flag.String("fetch-path", "", "Specify the file path to download '-fetch-url' to, kept if it exists and matches '-fetch-checksum'.")
+	fetchChecksum := flag.String("fetch-checksum", "", "Specify the SHA-256 (or MD5) checksum in hex of '-fetch-url'.")
+	fetchRateLimit := flag.String("fetch-rate-limit", "", "Specify the maximum download rate per second of '-fetch-url' (e.g. 10MB, empty for no limit).")
+	healthURL := flag.String("health-url", "", "Specify the health endpoint of worker processes for the registry to probe (empty to check liveness reports only).")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 && *dockerImage == "" && *k8sJobImage == "" {
+		glog.Fatal("expected worker command after flags (e.g. -- python3 ./backend/worker/worker.py localhost:2201)")
+	}
+
+	// the first signal stops workers (draining the jobs in process
+	// with 'runJobs'), and the second one cancels them
+	ctx, cancel := context.WithCancel(context.Background())
+	stopc := make(chan struct{})
+	sigc := make(chan os.Signal, 2)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigc
+		glog.Infof("received %v; stopping workers", sig)
+		close(stopc)
+		sig = <-sigc
+		glog.Infof("received %v; canceling workers", sig)
+		cancel()
+	}()
+
+	if *fetchURL != "" {
+		if err := fetch(ctx, *fetchURL, *fetchPath, *fetchChecksum, *fetchRateLimit); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	limits := workerproc.Limits{
+		CPUs:        *cpus,
+		MemoryBytes: *memoryMB << 20,
+	}
+	jobCfg := worker.Config{
+		Endpoint:         *backendEndpoint,
+		Concurrency:      *workers,
+		Name:             *name,
+		RegistryEndpoint: *registry,
+	}
+	if *capabilities != "" {
+		jobCfg.Capabilities = strings.Split(*capabilities, ",")
+	}
+	if *k8sJobImage != "" {
+		cli, err := kube.InClusterClient()
+		if err != nil {
+			glog.Fatal(err)
+		}
+		ns := *k8sNamespace
+		if ns == "" {
+			ns = kube.InClusterNamespace()
+		}
+		spec := kube.JobSpec{Image: *k8sJobImage, Args: args, GPUs: *gpus}
+		if limits.CPUs > 0 {
+			spec.CPU = strconv.FormatFloat(limits.CPUs, 'f', -1, 64)
+		}
+		if *memoryMB > 0 {
+			spec.Memory = fmt.Sprintf("%dMi", *memoryMB)
+		}
+		runJobs(ctx, stopc, jobCfg, *bucket, worker.KubernetesJobHandler(cli, ns, spec, 0))
+		return
+	}
+
+	var dc *workerproc.DockerConfig
+	if *dockerImage != "" {
+		cli, err := docker.NewClient(*dockerHost)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if *dockerMode == "job" {
+			if *scratchDir != "" {
+				go fileutil.RunTempCleaner(ctx, *scratchDir, worker.JobScratchPrefix, time.Minute, 10*time.Minute)
+			}
+			runJobs(ctx, stopc, jobCfg, *bucket, worker.DockerHandler(cli, docker.ContainerConfig{
+				Image:       *dockerImage,
+				Cmd:         args,
+				NetworkMode: *dockerNetwork,
+				NanoCPUs:    int64(limits.CPUs * 1e9),
+				Memory:      limits.MemoryBytes,
+			}, *scratchDir))
+			return
+		}
+		dc = &workerproc.DockerConfig{
+			Client:           cli,
+			Image:            *dockerImage,
+			NetworkMode:      *dockerNetwork,
+			ScratchDir:       *scratchDir,
+			QueueEndpoint:    *queueEndpoint,
+			RegistryEndpoint: *registry,
+		}
+	}
+
+	var reporter workerproc.Reporter
+	if *registry != "" {
+		reporter = &workerproc.HTTPReporter{Endpoint: *registry, Token: *registryToken}
+	}
+
+	if *logDir != "" {
+		if err := os.MkdirAll(*logDir, os.ModePerm); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	var command string
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	go func() {
+		<-stopc
+		cancel()
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		workerName := fmt.Sprintf("%s-%d", *name, i)
+		var logFile, logEndpoint string
+		if *logDir != "" {
+			logFile = filepath.Join(*logDir, workerName+".log")
+			logEndpoint = *backendEndpoint + *bucket + "/logs"
+		}
+		s := workerproc.New(workerproc.Config{
+			Name:       workerName,
+			Command:    command,
+			Args:       args,
+			Reporter:   reporter,
+			Limits:     limits,
+			Cgroup:     *cgroup,
+			CgroupRoot: *cgroupRoot,
+			Docker:     dc,
+			Buckets:    []string{*bucket},
+			HealthURL:  *healthURL,
+
+			LogFile:     logFile,
+			LogEndpoint: logEndpoint,
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Run(ctx); err != nil && err != context.Canceled {
+				glog.Fatal(err)
+			}
+		}()
+	}
+	wg.Wait()
+	glog.Info("stopped workers")
+}
+
+// fetch downloads the file (e.g. model weights) unless it exists and
+// matches the checksum, retrying with resume on failure.
+func fetch(ctx context.Context, ep, fpath, checksum, rateLimitTxt string) error {
+	if fpath == "" {
+		return fmt.Errorf("'-fetch-path' is required with '-fetch-url'")
+	}
+	if fileutil.Exist(fpath) {
+		if checksum == "" {
+			glog.Infof("%q exists (no need to download)", fpath)
+			return nil
+		}
+		err := fileutil.VerifyChecksum(fpath, checksum)
+		if err == nil {
+			glog.Infof("%q matches the checksum (no need to download)", fpath)
+			return nil
+		}
+		glog.Warningf("%q does not match (%v)", fpath, err)
+	}
+
+	var rateLimit uint64
+	if rateLimitTxt != "" {
+		var err error
+		if rateLimit, err = humanize.ParseBytes(rateLimitTxt); err != nil {
+			return err
+		}
+	}
+	glog.Infof("downloading %q to %q", ep, fpath)
+	err := download.File(ctx, ep, fpath, download.Config{
+		Checksum:  checksum,
+		RateLimit: int64(rateLimit),
+		Retries:   5,
+		Progress: func(done, total int64) {
+			glog.Infof("downloaded %s of %q", humanize.Bytes(uint64(done)), ep)
+		},
+		ProgressInterval: 10 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	glog.Infof("downloaded %q to %q", ep, fpath)
+	return nil
+}
+
+// runJobs claims jobs from the queue, and runs each job with the handler,
+// until the worker is drained on 'stopc'.
+func runJobs(ctx context.Context, stopc <-chan struct{}, cfg worker.Config, bucket string, h worker.HandlerFunc) {
+	w := worker.New(cfg)
+	w.Handle(bucket, h)
+	go func() {
+		select {
+		case <-stopc:
+			w.Drain()
+		case <-ctx.Done():
+		}
+	}()
+
+	glog.Infof("running jobs from %q", bucket)
+	if err := w.Run(ctx); err != nil && err != context.Canceled {
+		glog.Fatal(err)
+	}
+	glog.Info("stopped workers")
+}
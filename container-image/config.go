@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"html/template"
 	"io/ioutil"
+	"path/filepath"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
@@ -23,6 +24,18 @@ type Config struct {
 
 	KerasVersion string `yaml:"keras-version"`
 
+	// WebPort is the port of the frontend (frontend.yaml host-prod-port),
+	// and BackendPort, GRPCPort, QueuePortClient, and QueuePortPeer are the
+	// ports of the backend-web-server, in docker-compose.yml.
+	WebPort         int `yaml:"web-port"`
+	BackendPort     int `yaml:"backend-port"`
+	GRPCPort        int `yaml:"grpc-port"`
+	QueuePortClient int `yaml:"queue-port-client"`
+	QueuePortPeer   int `yaml:"queue-port-peer"`
+	// EtcdDataVolume is the docker volume of the embedded etcd data
+	// directory of the backend, kept across the container restarts.
+	EtcdDataVolume string `yaml:"etcd-data-volume"`
+
 	DockerfileApp          string
 	DockerfileReverseProxy string
 
@@ -30,6 +43,12 @@ type Config struct {
 
 	DockerfilePython3CPU string
 	DockerfilePython3GPU string
+
+	// DockerfileFrontend and DockerfileBackend are the separate images
+	// of the frontend and backend, run together by DockerCompose.
+	DockerfileFrontend string
+	DockerfileBackend  string
+	DockerCompose      string
 }
 
 // Read reads container image configuration.
@@ -44,6 +63,23 @@ func Read(p string) (Config, error) {
 		return Config{}, err
 	}
 	cfg.Updated = nowPST().String()
+	for _, v := range []struct {
+		port *int
+		def  int
+	}{
+		{&cfg.WebPort, 4200},
+		{&cfg.BackendPort, 2200},
+		{&cfg.GRPCPort, 2201},
+		{&cfg.QueuePortClient, 22000},
+		{&cfg.QueuePortPeer, 22001},
+	} {
+		if *v.port == 0 {
+			*v.port = v.def
+		}
+	}
+	if cfg.EtcdDataVolume == "" {
+		cfg.EtcdDataVolume = "etcd-data"
+	}
 
 	buf := new(bytes.Buffer)
 
@@ -138,6 +174,43 @@ func Read(p string) (Config, error) {
 	cfg.DockerfilePython3GPU = buf.String()
 	buf.Reset()
 
+	if err = template.Must(template.New("tmpl").
+		Parse(dockerfileFrontend)).
+		Execute(buf, cfg); err != nil {
+		return Config{}, err
+	}
+	cfg.DockerfileFrontend = buf.String()
+	buf.Reset()
+
+	if err = template.Must(template.New("tmpl").
+		Parse(dockerfileBackend)).
+		Execute(buf, cfg); err != nil {
+		return Config{}, err
+	}
+	cfg.DockerfileBackend = buf.String()
+	buf.Reset()
+
+	// the build context is the repository root, relative to docker-compose.yml
+	buildContext, err := filepath.Rel(cfg.DockerfilesBaseDir, ".")
+	if err != nil {
+		return Config{}, err
+	}
+	if err = template.Must(template.New("tmpl").
+		Parse(dockerCompose)).
+		Execute(buf, struct {
+			Config
+			BuildContext   string
+			DockerfilesDir string
+		}{
+			cfg,
+			filepath.ToSlash(buildContext),
+			filepath.ToSlash(filepath.Clean(cfg.DockerfilesBaseDir)),
+		}); err != nil {
+		return Config{}, err
+	}
+	cfg.DockerCompose = buf.String()
+	buf.Reset()
+
 	return cfg, nil
 }
 
@@ -149,7 +222,8 @@ func nowPST() time.Time {
 	return time.Now().In(tzone)
 }
 
-// TODO(gyuho): separate backend, frontend images
+// TODO(gyuho): replace with the separate backend, frontend images
+// (dockerfileBackend, dockerfileFrontend) in docker-compose.yml
 // currently docker doesn't work with --net=host on Mac
 // which is my development machine
 const dockerfileApp = `##########################
@@ -217,8 +291,10 @@ ADD ./pkg ${GOPATH}/src/github.com/gyuho/dplearn/pkg
 ADD ./vendor ${GOPATH}/src/github.com/gyuho/dplearn/vendor
 ADD ./Gopkg.lock ${GOPATH}/src/github.com/gyuho/dplearn/Gopkg.lock
 ADD ./Gopkg.toml ${GOPATH}/src/github.com/gyuho/dplearn/Gopkg.toml
+ADD ./frontend-dep ${GOPATH}/src/github.com/gyuho/dplearn/frontend-dep
 
 ADD ./frontend ${GOPATH}/src/github.com/gyuho/dplearn/frontend
+ADD ./frontend.yaml ${GOPATH}/src/github.com/gyuho/dplearn/frontend.yaml
 ADD ./angular-cli.json ${GOPATH}/src/github.com/gyuho/dplearn/angular-cli.json
 ADD ./package.json ${GOPATH}/src/github.com/gyuho/dplearn/package.json
 ADD ./proxy.config.json ${GOPATH}/src/github.com/gyuho/dplearn/proxy.config.json
@@ -226,9 +302,10 @@ ADD ./yarn.lock ${GOPATH}/src/github.com/gyuho/dplearn/yarn.lock
 
 ADD ./scripts/docker/run ${GOPATH}/src/github.com/gyuho/dplearn/scripts/docker/run
 ADD ./scripts/tests ${GOPATH}/src/github.com/gyuho/dplearn/scripts/tests
+ADD ./scripts/build.sh ${GOPATH}/src/github.com/gyuho/dplearn/scripts/build.sh
 
-RUN go install -v ./cmd/backend-web-server \
-  && go install -v ./cmd/gen-frontend-dep
+ARG GIT_SHA
+RUN GIT_SHA=${GIT_SHA} ./scripts/build.sh
 ##########################
 
 ##########################
@@ -323,6 +400,121 @@ ADD nginx.conf /etc/nginx/sites-available/default
 
 `
 
+const dockerfileFrontend = `##########################
+# Last updated at {{.Updated}}
+# renders package.json, angular-cli.json, proxy.config.json from frontend.yaml
+# with the backend service of docker-compose.yml
+FROM golang:{{.GoVersion}} AS generator
+##########################
+
+##########################
+WORKDIR ${GOPATH}/src/github.com/gyuho/dplearn
+ADD ./cmd ${GOPATH}/src/github.com/gyuho/dplearn/cmd
+ADD ./pkg ${GOPATH}/src/github.com/gyuho/dplearn/pkg
+ADD ./vendor ${GOPATH}/src/github.com/gyuho/dplearn/vendor
+ADD ./frontend-dep ${GOPATH}/src/github.com/gyuho/dplearn/frontend-dep
+ADD ./frontend.yaml ${GOPATH}/src/github.com/gyuho/dplearn/frontend.yaml
+
+ARG BACKEND_HOST=backend:{{.BackendPort}}
+RUN go install -v ./cmd/gen-frontend-dep \
+  && mkdir -p /frontend-dep \
+  && gen-frontend-dep \
+  -config frontend.yaml \
+  -backend-host ${BACKEND_HOST} \
+  -output-package-json /frontend-dep/package.json \
+  -output-angular-cli-json /frontend-dep/angular-cli.json \
+  -output-proxy-config-json /frontend-dep/proxy.config.json \
+  -logtostderr
+##########################
+
+##########################
+FROM node:{{.NodeVersion}}
+WORKDIR /dplearn
+
+COPY --from=generator /frontend-dep/ /dplearn/
+ADD ./yarn.lock /dplearn/yarn.lock
+RUN yarn install
+
+ADD ./frontend /dplearn/frontend
+##########################
+
+EXPOSE {{.WebPort}}
+CMD ["yarn", "start-prod"]
+`
+
+const dockerfileBackend = `##########################
+# Last updated at {{.Updated}}
+FROM golang:{{.GoVersion}} AS builder
+##########################
+
+##########################
+WORKDIR ${GOPATH}/src/github.com/gyuho/dplearn
+ADD ./cmd ${GOPATH}/src/github.com/gyuho/dplearn/cmd
+ADD ./backend ${GOPATH}/src/github.com/gyuho/dplearn/backend
+ADD ./pkg ${GOPATH}/src/github.com/gyuho/dplearn/pkg
+ADD ./vendor ${GOPATH}/src/github.com/gyuho/dplearn/vendor
+
+ARG GIT_SHA
+RUN CGO_ENABLED=0 go install -v \
+  -ldflags "-X github.com/gyuho/dplearn/pkg/version.GitSHA=${GIT_SHA}" \
+  ./cmd/backend-web-server
+##########################
+
+##########################
+FROM debian:stretch-slim
+RUN apt-get -y update \
+  && apt-get -y install ca-certificates \
+  && rm -rf /var/lib/apt/lists/*
+
+COPY --from=builder /go/bin/backend-web-server /usr/local/bin/backend-web-server
+##########################
+
+# embedded etcd data of the queue service
+VOLUME /var/lib/etcd
+EXPOSE {{.BackendPort}} {{.GRPCPort}} {{.QueuePortClient}} {{.QueuePortPeer}}
+CMD ["backend-web-server", \
+  "-web-host", "0.0.0.0:{{.BackendPort}}", \
+  "-grpc-host", "0.0.0.0:{{.GRPCPort}}", \
+  "-queue-port-client", "{{.QueuePortClient}}", \
+  "-queue-port-peer", "{{.QueuePortPeer}}", \
+  "-data-dir", "/var/lib/etcd", \
+  "-logtostderr=true"]
+`
+
+const dockerCompose = `# Last updated at {{.Updated}}
+# GIT_SHA=$(git rev-parse --short HEAD) docker-compose -f {{.DockerfilesDir}}/docker-compose.yml up --build
+version: "3"
+
+services:
+  backend:
+    build:
+      context: {{.BuildContext}}
+      dockerfile: {{.DockerfilesDir}}/Dockerfile-backend
+      args:
+        GIT_SHA: ${GIT_SHA}
+    ports:
+    - "{{.BackendPort}}:{{.BackendPort}}"
+    - "127.0.0.1:{{.GRPCPort}}:{{.GRPCPort}}"
+    volumes:
+    - {{.EtcdDataVolume}}:/var/lib/etcd
+    restart: unless-stopped
+
+  frontend:
+    build:
+      context: {{.BuildContext}}
+      dockerfile: {{.DockerfilesDir}}/Dockerfile-frontend
+      args:
+        BACKEND_HOST: backend:{{.BackendPort}}
+    ports:
+    - "{{.WebPort}}:{{.WebPort}}"
+    depends_on:
+    - backend
+    restart: unless-stopped
+
+volumes:
+  {{.EtcdDataVolume}}: {}
+`
+
 /*
 # install pandoc, latex for R
 # http://pandoc.org/installing.html
@@ -514,6 +706,8 @@ RUN echo 'debconf debconf/frontend select Noninteractive' | debconf-set-selectio
 RUN {{.PipCommand}} --no-cache-dir install \
   requests \
   glog \
+  grpcio \
+  protobuf \
   humanize \
   bcolz \
   h5py
@@ -0,0 +1,274 @@
+package frontenddep
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config defines the frontend development server and dependencies,
+// the template data of package.json and angular-cli.json.
+type Config struct {
+	// Host and HostPort are the address of the development server ("yarn start").
+	// 0.0.0.0 means "all IPv4 addresses on the local machine".
+	// If a host has two IP addresses, 192.168.1.1 and 10.1.2.1,
+	// and a server running on the host listens on 0.0.0.0,
+	// it will be reachable at both of those IPs
+	// (Source https://en.wikipedia.org/wiki/0.0.0.0).
+	Host     string `yaml:"host"`
+	HostPort int    `yaml:"host-port"`
+	// HostProd and HostProdPort are the address of the production server
+	// ("yarn start-prod").
+	HostProd     string `yaml:"host-prod"`
+	HostProdPort int    `yaml:"host-prod-port"`
+
+	NgCommandServeStart     string `yaml:"ng-command-serve-start"`
+	NgCommandServeStartProd string `yaml:"ng-command-serve-start-prod"`
+
+	// BackendHost is the host and port of the backend web server
+	// (backend-web-server -web-host), which the development server
+	// proxies the API requests to (proxy.config.json).
+	BackendHost string `yaml:"backend-host"`
+	// ProxyPaths are the API paths proxied to the backend,
+	// including the sub-paths (e.g. "/cats-request/queue").
+	ProxyPaths []string `yaml:"proxy-paths"`
+
+	// Scripts are the package.json scripts to add, or to replace
+	// the template scripts (e.g. "build-prod": "ng build --prod").
+	Scripts map[string]string `yaml:"scripts"`
+	// Dependencies and DevDependencies are the package versions to add,
+	// or to replace the template versions.
+	Dependencies    map[string]string `yaml:"dependencies"`
+	DevDependencies map[string]string `yaml:"dev-dependencies"`
+	// DependencyRanges are the npm semver ranges of the packages
+	// (e.g. "@angular/core": "^5.2.0") to refresh the pinned versions
+	// within (gen-frontend-dep -refresh-dependencies).
+	DependencyRanges map[string]string `yaml:"dependency-ranges"`
+
+	// Apps are the frontend apps rendered into the separate directories
+	// (e.g. the public demo UI and the internal admin UI), with the fields
+	// above as the defaults, parsed from "apps" in the configuration file.
+	Apps []App `yaml:"-"`
+}
+
+// App is the frontend app of the configuration. The fields omitted in the
+// app take the top-level values, and the scripts and dependencies of the
+// app are added to the top-level ones.
+type App struct {
+	Name string
+	// Dir is the output directory of the app files, the name if empty.
+	Dir string
+	Config
+}
+
+// DefaultConfig returns the configuration of the fields omitted
+// in the configuration file.
+func DefaultConfig() Config {
+	return Config{
+		Host:                    "0.0.0.0",
+		HostPort:                4200,
+		HostProd:                "0.0.0.0",
+		HostProdPort:            4200,
+		NgCommandServeStart:     "ng serve --aot",
+		NgCommandServeStartProd: "ng serve --aot --prod",
+		BackendHost:             "0.0.0.0:2200",
+		ProxyPaths:              []string{"/cats-request", "/upload", "/status", "/users"},
+	}
+}
+
+// Read reads the frontend dependency configuration.
+func Read(p string) (Config, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := DefaultConfig()
+	if err = yaml.Unmarshal(bts, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err = cfg.validate(); err != nil {
+		return Config{}, fmt.Errorf("%q %v", p, err)
+	}
+
+	// the app fields override the top-level fields
+	var apps struct {
+		Apps []map[string]interface{} `yaml:"apps"`
+	}
+	if err = yaml.Unmarshal(bts, &apps); err != nil {
+		return Config{}, err
+	}
+	names := make(map[string]bool)
+	for i, raw := range apps.Apps {
+		app := App{Config: cfg.clone()}
+		app.Name, _ = raw["name"].(string)
+		app.Dir, _ = raw["dir"].(string)
+		if app.Name == "" || names[app.Name] {
+			return Config{}, fmt.Errorf("%q has empty or duplicate app name at apps[%d]", p, i)
+		}
+		names[app.Name] = true
+		if app.Dir == "" {
+			app.Dir = app.Name
+		}
+		delete(raw, "name")
+		delete(raw, "dir")
+		d, err := yaml.Marshal(raw)
+		if err != nil {
+			return Config{}, err
+		}
+		if err = yaml.Unmarshal(d, &app.Config); err != nil {
+			return Config{}, fmt.Errorf("%q app %q: %v", p, app.Name, err)
+		}
+		if err = app.validate(); err != nil {
+			return Config{}, fmt.Errorf("%q app %q %v", p, app.Name, err)
+		}
+		cfg.Apps = append(cfg.Apps, app)
+	}
+	return cfg, nil
+}
+
+// validate returns the error of the invalid field.
+func (cfg Config) validate() error {
+	if cfg.Host == "" || cfg.HostProd == "" {
+		return fmt.Errorf("must specify host and host-prod")
+	}
+	if !validPort(cfg.HostPort) || !validPort(cfg.HostProdPort) {
+		return fmt.Errorf("has invalid host-port %d or host-prod-port %d", cfg.HostPort, cfg.HostProdPort)
+	}
+	if cfg.NgCommandServeStart == "" || cfg.NgCommandServeStartProd == "" {
+		return fmt.Errorf("must specify ng-command-serve-start and ng-command-serve-start-prod")
+	}
+	if _, port, err := net.SplitHostPort(cfg.BackendHost); err != nil || port == "" {
+		return fmt.Errorf("has invalid backend-host %q (expected host:port)", cfg.BackendHost)
+	}
+	for _, pt := range cfg.ProxyPaths {
+		if !strings.HasPrefix(pt, "/") || strings.ContainsAny(pt, `"\ `) {
+			return fmt.Errorf("has invalid proxy path %q", pt)
+		}
+	}
+	for name, r := range cfg.DependencyRanges {
+		if _, err := parseRange(r); err != nil {
+			return fmt.Errorf("has invalid dependency range for %q (%v)", name, err)
+		}
+	}
+	return nil
+}
+
+// clone returns the copy of the configuration without the apps,
+// not sharing the maps and slices.
+func (cfg Config) clone() Config {
+	c := cfg
+	c.ProxyPaths = append([]string(nil), cfg.ProxyPaths...)
+	c.Scripts = copyMap(cfg.Scripts)
+	c.Dependencies = copyMap(cfg.Dependencies)
+	c.DevDependencies = copyMap(cfg.DevDependencies)
+	c.DependencyRanges = copyMap(cfg.DependencyRanges)
+	c.Apps = nil
+	return c
+}
+
+func validPort(port int) bool {
+	return port > 0 && port < 65536
+}
+
+// PackageJSON renders package.json with the template, or the built-in
+// template if empty, and sets the scripts and dependencies of the
+// configuration.
+func (cfg Config) PackageJSON(tmpl string) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = tmplPackageJSON
+	}
+	d, err := execute("tmplPackageJSON", tmpl, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Scripts) == 0 && len(cfg.Dependencies) == 0 && len(cfg.DevDependencies) == 0 {
+		return d, nil
+	}
+	return overlay(d, map[string]map[string]string{
+		"scripts":         cfg.Scripts,
+		"dependencies":    cfg.Dependencies,
+		"devDependencies": cfg.DevDependencies,
+	})
+}
+
+// AngularCLIJSON renders angular-cli.json with the template,
+// or the built-in template if empty.
+func (cfg Config) AngularCLIJSON(tmpl string) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = tmplAngularCLIJSON
+	}
+	return execute("tmplAngularCLIJSON", tmpl, cfg)
+}
+
+// AngularJSON renders angular.json, the workspace configuration of Angular
+// CLI 6 or later replacing angular-cli.json, with the template, or the
+// built-in template if empty.
+func (cfg Config) AngularJSON(tmpl string) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = tmplAngularJSON
+	}
+	return execute("tmplAngularJSON", tmpl, cfg)
+}
+
+// ProxyConfigJSON renders proxy.config.json, the proxy configuration of
+// the development server ("ng serve"), with the template, or the built-in
+// template if empty, so that the API requests are routed to the backend
+// of the configuration.
+func (cfg Config) ProxyConfigJSON(tmpl string) ([]byte, error) {
+	if tmpl == "" {
+		tmpl = tmplProxyConfigJSON
+	}
+	return execute("tmplProxyConfigJSON", tmpl, cfg)
+}
+
+// tmplData is the template data, the configuration and the environment
+// variables at generation time (e.g. {{.Env.API_BASE_URL}}).
+type tmplData struct {
+	Config
+	Env map[string]string
+}
+
+// tmplFuncs are the template functions for the environment variables,
+// e.g. {{.Env.PUBLIC_IP | default "0.0.0.0"}} for the fallback value,
+// and {{require "ANALYTICS_ID"}} to fail the generation if not set.
+var tmplFuncs = template.FuncMap{
+	"default": func(def, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+	"require": func(name string) (string, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return "", fmt.Errorf("environment variable %q is required", name)
+		}
+		return v, nil
+	},
+}
+
+func execute(name, tmpl string, cfg Config) ([]byte, error) {
+	// unset environment variables are empty
+	tp, err := template.New(name).Funcs(tmplFuncs).Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err = tp.Execute(buf, tmplData{Config: cfg, Env: env}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
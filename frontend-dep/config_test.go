@@ -0,0 +1,237 @@
+package frontenddep
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRead ensures that the repository configuration renders
+// the built-in templates as is.
+func TestRead(t *testing.T) {
+	cfg, err := Read("../frontend.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := cfg.PackageJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(d), `"start": "ng serve --aot --port 4200 --host 0.0.0.0"`) {
+		t.Fatalf("unexpected package.json:\n%s", d)
+	}
+	if d, err = cfg.AngularCLIJSON(""); err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != tmplAngularCLIJSON {
+		t.Fatalf("unexpected angular-cli.json:\n%s", d)
+	}
+
+	if d, err = cfg.ProxyConfigJSON(""); err != nil {
+		t.Fatal(err)
+	}
+	bts, err := ioutil.ReadFile("../proxy.config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bts) != string(d) {
+		t.Fatalf("proxy.config.json is out of date (run ./scripts/dep/frontend.sh):\n%s", UnifiedDiff("proxy.config.json", "rendered", bts, d))
+	}
+}
+
+func TestProxyConfigJSON(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BackendHost = "10.0.0.2:8080"
+	cfg.ProxyPaths = []string{"/status"}
+
+	d, err := cfg.ProxyConfigJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxy map[string]struct {
+		Target string `json:"target"`
+	}
+	if err = json.Unmarshal(d, &proxy); err != nil {
+		t.Fatalf("invalid proxy.config.json (%v):\n%s", err, d)
+	}
+	if len(proxy) != 1 || proxy["/status"].Target != "http://10.0.0.2:8080" {
+		t.Fatalf("unexpected proxy.config.json:\n%s", d)
+	}
+}
+
+func TestAngularJSON(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostProdPort = 80
+
+	d, err := cfg.AngularJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ws struct {
+		Version  int `json:"version"`
+		Projects map[string]struct {
+			SourceRoot string `json:"sourceRoot"`
+			Architect  map[string]struct {
+				Builder        string                            `json:"builder"`
+				Options        map[string]interface{}            `json:"options"`
+				Configurations map[string]map[string]interface{} `json:"configurations"`
+			} `json:"architect"`
+		} `json:"projects"`
+		DefaultProject string `json:"defaultProject"`
+	}
+	if err = json.Unmarshal(d, &ws); err != nil {
+		t.Fatalf("invalid angular.json (%v):\n%s", err, d)
+	}
+	app, ok := ws.Projects[ws.DefaultProject]
+	if ws.Version != 1 || !ok || app.SourceRoot != "frontend" {
+		t.Fatalf("unexpected angular.json:\n%s", d)
+	}
+	serve := app.Architect["serve"]
+	if serve.Options["proxyConfig"] != "proxy.config.json" || serve.Options["port"] != float64(4200) {
+		t.Fatalf("unexpected serve options %v", serve.Options)
+	}
+	if serve.Configurations["production"]["port"] != float64(80) {
+		t.Fatalf("unexpected serve configurations %v", serve.Configurations)
+	}
+	if _, ok = ws.Projects["app-dplearn-e2e"].Architect["e2e"]; !ok {
+		t.Fatalf("expected e2e target:\n%s", d)
+	}
+}
+
+func TestPackageJSONOverlay(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Scripts = map[string]string{"build-prod": "ng build --prod && gzip -r dist"}
+	cfg.Dependencies = map[string]string{"rxjs": "5.5.7", "lodash": "4.17.4"}
+	cfg.DevDependencies = map[string]string{"tslint": "5.9.2"}
+
+	d, err := cfg.PackageJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkg struct {
+		Name            string            `json:"name"`
+		Scripts         map[string]string `json:"scripts"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err = json.Unmarshal(d, &pkg); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name != "app-dplearn" || pkg.Scripts["start"] != "ng serve --aot --port 4200 --host 0.0.0.0" {
+		t.Fatalf("unexpected package.json:\n%s", d)
+	}
+	if pkg.Scripts["build-prod"] != cfg.Scripts["build-prod"] {
+		t.Fatalf("expected script %q, got %q", cfg.Scripts["build-prod"], pkg.Scripts["build-prod"])
+	}
+	for name, ver := range map[string]string{"rxjs": "5.5.7", "lodash": "4.17.4", "@angular/core": "5.2.1"} {
+		if pkg.Dependencies[name] != ver {
+			t.Fatalf("%q: expected %q, got %q", name, ver, pkg.Dependencies[name])
+		}
+	}
+	if pkg.DevDependencies["tslint"] != "5.9.2" {
+		t.Fatalf("unexpected devDependencies %v", pkg.DevDependencies)
+	}
+
+	// the template duplicates "rxjs", and both are replaced
+	if strings.Count(string(d), `"rxjs": "5.5.7"`) != 2 || strings.Contains(string(d), `"rxjs": "5.5.6"`) {
+		t.Fatalf("expected the duplicate fields replaced:\n%s", d)
+	}
+	// the order is preserved, and new fields are appended
+	if strings.Index(string(d), `"name"`) > strings.Index(string(d), `"scripts"`) ||
+		strings.Index(string(d), `"e2e"`) > strings.Index(string(d), `"build-prod"`) {
+		t.Fatalf("unexpected order:\n%s", d)
+	}
+	if !strings.HasPrefix(string(d), "{\n    \"name\": \"app-dplearn\",\n") || !strings.HasSuffix(string(d), "}\n") {
+		t.Fatalf("unexpected indentation:\n%s", d)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "frontenddep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	for cfg, expected := range map[string]string{
+		"host-port: 70000\n":                 "invalid host-port",
+		"backend-host: localhost\n":          "invalid backend-host",
+		"proxy-paths: [status]\n":            "invalid proxy path",
+		"apps:\n- dir: web\n":                "empty or duplicate app name",
+		"apps:\n- name: a\n  host-port: 0\n": "invalid host-port",
+	} {
+		if err = ioutil.WriteFile(f.Name(), []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Read(f.Name()); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%q: expected %q error, got %v", cfg, expected, err)
+		}
+	}
+}
+
+func TestReadApps(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "frontenddep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`host-port: 4200
+dependencies:
+  rxjs: 5.5.11
+apps:
+- name: demo
+- name: admin
+  dir: frontend/admin
+  host-port: 4300
+  proxy-paths: [/admin]
+  dependencies:
+    chart.js: 2.7.2
+`)
+	f.Close()
+
+	cfg, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Apps) != 2 {
+		t.Fatalf("expected 2 apps, got %+v", cfg.Apps)
+	}
+	demo, admin := cfg.Apps[0], cfg.Apps[1]
+	if demo.Name != "demo" || demo.Dir != "demo" || demo.HostPort != 4200 || len(demo.ProxyPaths) != 4 {
+		t.Fatalf("unexpected app %+v", demo)
+	}
+	if admin.Dir != "frontend/admin" || admin.HostPort != 4300 || !reflect.DeepEqual(admin.ProxyPaths, []string{"/admin"}) {
+		t.Fatalf("unexpected app %+v", admin)
+	}
+	expected := map[string]string{"rxjs": "5.5.11", "chart.js": "2.7.2"}
+	if !reflect.DeepEqual(admin.Dependencies, expected) {
+		t.Fatalf("expected dependencies %v, got %v", expected, admin.Dependencies)
+	}
+	if len(cfg.Dependencies) != 1 || len(demo.Dependencies) != 1 {
+		t.Fatalf("app dependencies leaked to %v, %v", cfg.Dependencies, demo.Dependencies)
+	}
+}
+
+func TestTemplateEnv(t *testing.T) {
+	os.Setenv("FRONTENDDEP_TEST_API", "https://api.dplearn.com")
+	defer os.Unsetenv("FRONTENDDEP_TEST_API")
+	os.Unsetenv("FRONTENDDEP_TEST_MISSING")
+
+	cfg := DefaultConfig()
+	d, err := cfg.AngularCLIJSON(`{{.Env.FRONTENDDEP_TEST_API}} {{.Env.FRONTENDDEP_TEST_MISSING | default .Host}} {{require "FRONTENDDEP_TEST_API"}} {{.HostPort}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "https://api.dplearn.com 0.0.0.0 https://api.dplearn.com 4200"; string(d) != expected {
+		t.Fatalf("expected %q, got %q", expected, d)
+	}
+
+	_, err = cfg.AngularCLIJSON(`{{require "FRONTENDDEP_TEST_MISSING"}}`)
+	if err == nil || !strings.Contains(err.Error(), `"FRONTENDDEP_TEST_MISSING" is required`) {
+		t.Fatalf("expected required error, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package frontenddep
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around the changes.
+const diffContext = 3
+
+// diffOp is the line of the edit script, with the line indexes
+// before the line in the old and new text.
+type diffOp struct {
+	kind   byte // ' ', '-', or '+'
+	ai, bi int
+	line   string
+}
+
+// UnifiedDiff returns the unified diff from the old text to the new text
+// (e.g. the file on disk and the rendered template), or empty if equal.
+func UnifiedDiff(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// merge the changes not separated by more than the context
+		start, end := maxInt(0, i-diffContext), i+1
+		for j := i + 1; j < len(ops); j++ {
+			if ops[j].kind == ' ' {
+				continue
+			}
+			if j-end > 2*diffContext {
+				break
+			}
+			end = j + 1
+		}
+		stop := minInt(len(ops), end+diffContext)
+		writeHunk(buf, ops[start:stop])
+		i = stop
+	}
+	return buf.String()
+}
+
+// DiffStat returns the number of the lines added and deleted
+// from the old text to the new text.
+func DiffStat(from, to []byte) (added, deleted int) {
+	if bytes.Equal(from, to) {
+		return 0, 0
+	}
+	for _, op := range diffLines(splitLines(from), splitLines(to)) {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+func writeHunk(buf *bytes.Buffer, ops []diffOp) {
+	var na, nb int
+	for _, op := range ops {
+		if op.kind != '+' {
+			na++
+		}
+		if op.kind != '-' {
+			nb++
+		}
+	}
+	// the empty range starts at the line before
+	sa, sb := ops[0].ai, ops[0].bi
+	if na > 0 {
+		sa++
+	}
+	if nb > 0 {
+		sb++
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", sa, na, sb, nb)
+	for _, op := range ops {
+		buf.WriteByte(op.kind)
+		buf.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffLines returns the edit script from a to b, with the longest
+// common subsequence of the lines (the generated files are small).
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// lcs[i*(m+1)+j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([]int, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = maxInt(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', ai: i, bi: j, line: a[i]})
+			i, j = i+1, j+1
+		case j == m || (i < n && lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]):
+			ops = append(ops, diffOp{kind: '-', ai: i, bi: j, line: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', ai: i, bi: j, line: b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// splitLines splits the text after each newline.
+func splitLines(d []byte) []string {
+	lines := strings.SplitAfter(string(d), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,44 @@
+package frontenddep
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		from, to string
+		diff     string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			"--- old\n+++ new\n" +
+				"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n" +
+				"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n",
+		},
+		{
+			"",
+			"{\n}\n",
+			"--- old\n+++ new\n@@ -0,0 +1,2 @@\n+{\n+}\n",
+		},
+		{
+			"a\nb",
+			"a\nc\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+	}
+	for i, tt := range tests {
+		if diff := UnifiedDiff("old", "new", []byte(tt.from), []byte(tt.to)); diff != tt.diff {
+			t.Errorf("#%d: expected\n%s\ngot\n%s", i, tt.diff, diff)
+		}
+	}
+}
+
+func TestDiffStat(t *testing.T) {
+	added, deleted := DiffStat([]byte("a\nb\nc\n"), []byte("a\nB\nc\nd\n"))
+	if added != 2 || deleted != 1 {
+		t.Fatalf("expected +2 -1, got +%d -%d", added, deleted)
+	}
+	if added, deleted = DiffStat([]byte("a\n"), []byte("a\n")); added != 0 || deleted != 0 {
+		t.Fatalf("expected no change, got +%d -%d", added, deleted)
+	}
+}
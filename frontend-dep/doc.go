@@ -0,0 +1,4 @@
+// Package frontenddep defines the frontend dependency templates
+// (package.json, angular-cli.json, angular.json,
+// proxy.config.json) and their configuration.
+package frontenddep
@@ -0,0 +1,138 @@
+package frontenddep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// member is the field of the JSON object. The fields are kept in order,
+// with the duplicate keys, to change the rendered templates minimally.
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// overlay sets the fields of the objects at the top-level keys of the
+// JSON document (e.g. "scripts"), replacing the values of the existing
+// fields, and appending the others in the sorted order. The document is
+// returned indented with 4 spaces, as the templates.
+func overlay(doc []byte, fields map[string]map[string]string) ([]byte, error) {
+	top, err := members(doc)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if len(fields[k]) == 0 {
+			continue
+		}
+		found := false
+		for i := range top {
+			if top[i].key != k {
+				continue
+			}
+			found = true
+			if top[i].value, err = set(top[i].value, fields[k]); err != nil {
+				return nil, fmt.Errorf("%q: %v", k, err)
+			}
+		}
+		if !found {
+			v, err := set(json.RawMessage("{}"), fields[k])
+			if err != nil {
+				return nil, err
+			}
+			top = append(top, member{key: k, value: v})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, marshal(top), "", "    "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// set sets the string fields of the JSON object.
+func set(obj json.RawMessage, fields map[string]string) (json.RawMessage, error) {
+	ms, err := members(obj)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := quote(fields[name])
+		found := false
+		for i := range ms {
+			if ms[i].key == name {
+				ms[i].value, found = v, true
+			}
+		}
+		if !found {
+			ms = append(ms, member{key: name, value: v})
+		}
+	}
+	return marshal(ms), nil
+}
+
+// members returns the fields of the JSON object in order.
+func members(obj []byte) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("expected JSON object (%v)", err)
+	}
+	var ms []member
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v json.RawMessage
+		if err = dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		ms = append(ms, member{key: t.(string), value: v})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// marshal returns the JSON object of the fields (not indented).
+func marshal(ms []member) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range ms {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(quote(m.key))
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// quote returns the JSON string, without escaping HTML characters
+// (e.g. "&&" in the scripts).
+func quote(s string) json.RawMessage {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimSpace(buf.Bytes())
+}
@@ -0,0 +1,136 @@
+package frontenddep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Conflict is the field changed in the existing file, replaced by
+// the template-managed value on merge.
+type Conflict struct {
+	// Field is the top-level key (e.g. "dependencies").
+	Field string
+	// Key is the key in the object field, empty for the top-level values.
+	Key string
+	// Existing and Rendered are the JSON values.
+	Existing string
+	Rendered string
+}
+
+func (c Conflict) String() string {
+	name := c.Field
+	if c.Key != "" {
+		name += "." + c.Key
+	}
+	return fmt.Sprintf("%s: %s (existing) -> %s (template)", name, c.Existing, c.Rendered)
+}
+
+// Merge overlays the rendered JSON document (e.g. package.json) onto the
+// existing one, so that regeneration keeps the local additions. The fields
+// of the rendered document take precedence, and the fields only in the
+// existing document (e.g. the dependencies added with "yarn add") are kept,
+// appended in the existing order, both at the top level and in the objects
+// (e.g. "scripts", "dependencies"). It returns the existing values replaced
+// by the template values, as conflicts.
+func Merge(existing, rendered []byte) ([]byte, []Conflict, error) {
+	cur, err := members(existing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("existing: %v", err)
+	}
+	top, err := members(rendered)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rendered: %v", err)
+	}
+
+	var conflicts []Conflict
+	for k, c := range cur {
+		if lastIndex(cur, c.key) != k {
+			// the last one of the duplicate keys takes effect
+			continue
+		}
+		i := lastIndex(top, c.key)
+		if i < 0 {
+			top = append(top, c)
+			continue
+		}
+		if isObject(top[i].value) && isObject(c.value) {
+			v, cs, err := mergeObject(c.key, c.value, top[i].value)
+			if err != nil {
+				return nil, nil, err
+			}
+			// duplicate keys share the merged object
+			for j := range top {
+				if top[j].key == c.key {
+					top[j].value = v
+				}
+			}
+			conflicts = append(conflicts, cs...)
+			continue
+		}
+		if !equalJSON(c.value, top[i].value) {
+			conflicts = append(conflicts, Conflict{Field: c.key, Existing: compact(c.value), Rendered: compact(top[i].value)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, marshal(top), "", "    "); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), conflicts, nil
+}
+
+// mergeObject appends the fields only in the existing object to the
+// rendered object, and reports the fields with the different values.
+func mergeObject(field string, existing, rendered json.RawMessage) (json.RawMessage, []Conflict, error) {
+	cur, err := members(existing)
+	if err != nil {
+		return nil, nil, fmt.Errorf("existing %q: %v", field, err)
+	}
+	ms, err := members(rendered)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rendered %q: %v", field, err)
+	}
+	var conflicts []Conflict
+	for k, c := range cur {
+		if lastIndex(cur, c.key) != k {
+			continue
+		}
+		i := lastIndex(ms, c.key)
+		if i < 0 {
+			ms = append(ms, c)
+			continue
+		}
+		if !equalJSON(c.value, ms[i].value) {
+			conflicts = append(conflicts, Conflict{Field: field, Key: c.key, Existing: compact(c.value), Rendered: compact(ms[i].value)})
+		}
+	}
+	return marshal(ms), conflicts, nil
+}
+
+func lastIndex(ms []member, key string) int {
+	for i := len(ms) - 1; i >= 0; i-- {
+		if ms[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func isObject(v json.RawMessage) bool {
+	v = bytes.TrimSpace(v)
+	return len(v) > 0 && v[0] == '{'
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	return compact(a) == compact(b)
+}
+
+func compact(v json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return string(v)
+	}
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+package frontenddep
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	existing := `{
+    "name": "app",
+    "version": "0.9.8",
+    "scripts": {
+        "start": "ng serve",
+        "lint-fix": "tslint --fix"
+    },
+    "dependencies": {
+        "rxjs": "5.5.2",
+        "rxjs": "5.5.6",
+        "lodash": "4.17.4"
+    },
+    "browserslist": ["> 1%"]
+}
+`
+	rendered := `{
+    "name": "app",
+    "version": "0.9.9",
+    "scripts": {
+        "start": "ng serve --aot"
+    },
+    "dependencies": {
+        "rxjs": "5.5.6",
+        "zone.js": "0.8.19"
+    }
+}
+`
+	merged, conflicts, err := Merge([]byte(existing), []byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+    "name": "app",
+    "version": "0.9.9",
+    "scripts": {
+        "start": "ng serve --aot",
+        "lint-fix": "tslint --fix"
+    },
+    "dependencies": {
+        "rxjs": "5.5.6",
+        "zone.js": "0.8.19",
+        "lodash": "4.17.4"
+    },
+    "browserslist": [
+        "> 1%"
+    ]
+}
+`
+	if string(merged) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, merged)
+	}
+	expectedConflicts := []Conflict{
+		{Field: "version", Existing: `"0.9.8"`, Rendered: `"0.9.9"`},
+		{Field: "scripts", Key: "start", Existing: `"ng serve"`, Rendered: `"ng serve --aot"`},
+	}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Fatalf("expected %+v, got %+v", expectedConflicts, conflicts)
+	}
+
+	// merging the merged document changes nothing
+	again, conflicts, err := Merge(merged, []byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(merged) || len(conflicts) != 0 {
+		t.Fatalf("expected no change, got %+v\n%s", conflicts, again)
+	}
+}
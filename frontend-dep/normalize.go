@@ -0,0 +1,83 @@
+package frontenddep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SortKeys returns the JSON document with the object keys sorted
+// recursively, indented with 4 spaces, so that the output does not
+// depend on the template order. The last one of the duplicate keys
+// is kept.
+func SortKeys(doc []byte) ([]byte, error) {
+	v, err := sortKeys(bytes.TrimSpace(doc))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, v, "", "    "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func sortKeys(v json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case isObject(v):
+		ms, err := members(v)
+		if err != nil {
+			return nil, err
+		}
+		var sorted []member
+		for i, m := range ms {
+			if lastIndex(ms, m.key) != i {
+				continue
+			}
+			if m.value, err = sortKeys(m.value); err != nil {
+				return nil, fmt.Errorf("%q: %v", m.key, err)
+			}
+			sorted = append(sorted, m)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+		return marshal(sorted), nil
+
+	case len(v) > 0 && v[0] == '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(v, &elems); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, e := range elems {
+			e, err := sortKeys(bytes.TrimSpace(e))
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(e)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	}
+	return v, nil
+}
+
+// NormalizeLineEndings converts the line endings to eol ("\n" or "\r\n"),
+// and ends the text with eol, so that the output does not depend on the
+// line endings of the templates (e.g. checked out on Windows).
+func NormalizeLineEndings(d []byte, eol string) []byte {
+	d = bytes.Replace(d, []byte("\r\n"), []byte("\n"), -1)
+	d = bytes.Replace(d, []byte("\r"), []byte("\n"), -1)
+	if len(d) > 0 && d[len(d)-1] != '\n' {
+		d = append(d, '\n')
+	}
+	if eol != "\n" {
+		d = bytes.Replace(d, []byte("\n"), []byte(eol), -1)
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+package frontenddep
+
+import "testing"
+
+func TestSortKeys(t *testing.T) {
+	d, err := SortKeys([]byte(`{"b": 1, "a": {"d": [{"z": true, "y": null}], "c": "x"}, "b": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+    "a": {
+        "c": "x",
+        "d": [
+            {
+                "y": null,
+                "z": true
+            }
+        ]
+    },
+    "b": 2
+}
+`
+	if string(d) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, d)
+	}
+
+	// the same regardless of the template order
+	a, err := SortKeys([]byte(`{"name": "app", "scripts": {"start": "ng serve", "lint": "ng lint"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SortKeys([]byte(`{"scripts": {"lint": "ng lint", "start": "ng serve"}, "name": "app"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Fatalf("expected no change:\n%s", UnifiedDiff("a", "b", a, b))
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	tests := []struct {
+		in, eol, out string
+	}{
+		{"a\r\nb\r\n", "\n", "a\nb\n"},
+		{"a\nb", "\n", "a\nb\n"},
+		{"a\r\nb\n", "\r\n", "a\r\nb\r\n"},
+		{"a\rb", "\r\n", "a\r\nb\r\n"},
+		{"", "\n", ""},
+	}
+	for i, tt := range tests {
+		if out := string(NormalizeLineEndings([]byte(tt.in), tt.eol)); out != tt.out {
+			t.Errorf("#%d: expected %q, got %q", i, tt.out, out)
+		}
+	}
+}
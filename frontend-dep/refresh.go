@@ -0,0 +1,298 @@
+package frontenddep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultRegistry is the public npm registry.
+const DefaultRegistry = "https://registry.npmjs.org"
+
+// VersionSource returns the available versions of the npm package.
+type VersionSource interface {
+	Versions(ctx context.Context, name string) ([]string, error)
+}
+
+// Registry queries the npm registry for the package versions.
+type Registry struct {
+	// URL is the registry endpoint, DefaultRegistry if empty.
+	URL    string
+	Client *http.Client
+}
+
+// Versions fetches the abbreviated package metadata ("corgi" document)
+// and returns the published versions.
+func (r Registry) Versions(ctx context.Context, name string) ([]string, error) {
+	ep := r.URL
+	if ep == "" {
+		ep = DefaultRegistry
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	// scoped packages are "@scope%2fname"
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(ep, "/")+"/"+strings.Replace(name, "/", "%2f", 1), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.npm.install-v1+json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("%q: registry returned %s", name, resp.Status)
+	}
+
+	var doc struct {
+		Versions map[string]json.RawMessage `json:"versions"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%q: invalid registry response (%v)", name, err)
+	}
+	vs := make([]string, 0, len(doc.Versions))
+	for v := range doc.Versions {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs, nil
+}
+
+// Lockfile is the package versions resolved in the lockfile,
+// to refresh the dependencies without the registry access.
+type Lockfile map[string][]string
+
+// Versions returns the versions of the package in the lockfile.
+func (l Lockfile) Versions(ctx context.Context, name string) ([]string, error) {
+	vs, ok := l[name]
+	if !ok {
+		return nil, fmt.Errorf("%q not found in lockfile", name)
+	}
+	return vs, nil
+}
+
+// ReadLockfile reads yarn.lock (v1), or package-lock.json
+// (lockfileVersion 1 or 2).
+func ReadLockfile(p string) (Lockfile, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	l := make(Lockfile)
+	if filepath.Ext(p) == ".json" {
+		err = l.readPackageLock(bts)
+	} else {
+		err = l.readYarnLock(bts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", p, err)
+	}
+	for name, vs := range l {
+		sort.Strings(vs)
+		l[name] = vs
+	}
+	return l, nil
+}
+
+type packageLockDep struct {
+	Version      string                    `json:"version"`
+	Dependencies map[string]packageLockDep `json:"dependencies"`
+}
+
+func (l Lockfile) readPackageLock(bts []byte) error {
+	var doc struct {
+		// lockfileVersion 2 or later
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+		Dependencies map[string]packageLockDep `json:"dependencies"`
+	}
+	if err := json.Unmarshal(bts, &doc); err != nil {
+		return err
+	}
+	for k, pkg := range doc.Packages {
+		i := strings.LastIndex(k, "node_modules/")
+		if i < 0 || pkg.Version == "" {
+			// the root package
+			continue
+		}
+		l.add(k[i+len("node_modules/"):], pkg.Version)
+	}
+	l.addPackageLockDeps(doc.Dependencies)
+	return nil
+}
+
+func (l Lockfile) addPackageLockDeps(deps map[string]packageLockDep) {
+	for name, dep := range deps {
+		l.add(name, dep.Version)
+		l.addPackageLockDeps(dep.Dependencies)
+	}
+}
+
+// readYarnLock reads the entries of yarn.lock v1, e.g.
+//
+//	"@angular/core@5.2.1", "@angular/core@^5.0.0":
+//	  version "5.2.1"
+func (l Lockfile) readYarnLock(bts []byte) error {
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(bts))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case !strings.HasPrefix(line, " "):
+			names = names[:0]
+			for _, spec := range strings.Split(strings.TrimSuffix(line, ":"), ",") {
+				spec = strings.Trim(strings.TrimSpace(spec), `"`)
+				// "@scope/name@range"
+				if i := strings.LastIndex(spec, "@"); i > 0 {
+					names = append(names, spec[:i])
+				}
+			}
+		case strings.HasPrefix(line, "  version "):
+			v := strings.Trim(strings.TrimPrefix(line, "  version "), `"`)
+			for _, name := range names {
+				l.add(name, v)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(l) == 0 {
+		return fmt.Errorf("no entries found (expected yarn lockfile v1)")
+	}
+	return nil
+}
+
+func (l Lockfile) add(name, v string) {
+	if name == "" || v == "" {
+		return
+	}
+	for _, s := range l[name] {
+		if s == v {
+			return
+		}
+	}
+	l[name] = append(l[name], v)
+}
+
+// VersionChange is the dependency version updated by RefreshDependencies.
+type VersionChange struct {
+	Name string
+	From string
+	To   string
+	// Dev is true for devDependencies.
+	Dev bool
+}
+
+func (c VersionChange) String() string {
+	if c.Dev {
+		return fmt.Sprintf("%s %s -> %s (dev)", c.Name, c.From, c.To)
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Name, c.From, c.To)
+}
+
+// RefreshDependencies updates the pinned versions of the packages in the
+// dependency ranges to the highest versions of the source satisfying the
+// ranges, with the package.json template or the built-in template if empty.
+// It returns the configuration overriding the updated versions, and the
+// changes in the package name order.
+func (cfg Config) RefreshDependencies(ctx context.Context, tmpl string, src VersionSource) (Config, []VersionChange, error) {
+	d, err := cfg.PackageJSON(tmpl)
+	if err != nil {
+		return cfg, nil, err
+	}
+	top, err := members(d)
+	if err != nil {
+		return cfg, nil, err
+	}
+	pinned := func(key string) (map[string]string, error) {
+		vs := make(map[string]string)
+		for _, m := range top {
+			if m.key != key {
+				continue
+			}
+			ms, err := members(m.value)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", key, err)
+			}
+			for _, dep := range ms {
+				// the last one of the duplicate keys takes effect
+				var v string
+				if err = json.Unmarshal(dep.value, &v); err != nil {
+					return nil, fmt.Errorf("%q: %v", dep.key, err)
+				}
+				vs[dep.key] = v
+			}
+		}
+		return vs, nil
+	}
+	deps, err := pinned("dependencies")
+	if err != nil {
+		return cfg, nil, err
+	}
+	devDeps, err := pinned("devDependencies")
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	names := make([]string, 0, len(cfg.DependencyRanges))
+	for name := range cfg.DependencyRanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := cfg
+	ret.Dependencies = copyMap(cfg.Dependencies)
+	ret.DevDependencies = copyMap(cfg.DevDependencies)
+	var changes []VersionChange
+	for _, name := range names {
+		rangeTxt := cfg.DependencyRanges[name]
+		cur, ok := deps[name]
+		target, dev := ret.Dependencies, false
+		if !ok {
+			if cur, ok = devDeps[name]; !ok {
+				return cfg, nil, fmt.Errorf("%q in dependency-ranges is not a dependency in package.json", name)
+			}
+			target, dev = ret.DevDependencies, true
+		}
+		vs, err := src.Versions(ctx, name)
+		if err != nil {
+			return cfg, nil, err
+		}
+		latest, err := maxSatisfying(vs, rangeTxt)
+		if err != nil {
+			return cfg, nil, fmt.Errorf("%q: %v", name, err)
+		}
+		if latest == "" {
+			return cfg, nil, fmt.Errorf("%q: no version satisfies %q", name, rangeTxt)
+		}
+		if latest == cur {
+			continue
+		}
+		target[name] = latest
+		changes = append(changes, VersionChange{Name: name, From: cur, To: latest, Dev: dev})
+	}
+	return ret, changes, nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
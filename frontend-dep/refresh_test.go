@@ -0,0 +1,90 @@
+package frontenddep
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefreshDependencies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.EscapedPath() {
+		case "/@angular%2fcore":
+			w.Write([]byte(`{"name":"@angular/core","versions":{"5.2.1":{},"5.2.11":{},"6.0.0":{}}}`))
+		case "/karma":
+			w.Write([]byte(`{"name":"karma","versions":{"2.0.0":{},"2.0.5":{},"3.0.0":{}}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer ts.Close()
+
+	cfg := DefaultConfig()
+	cfg.DependencyRanges = map[string]string{"@angular/core": "^5.2.0", "karma": "~2.0.0"}
+	cfg, changes, err := cfg.RefreshDependencies(context.Background(), "", Registry{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionChange{
+		{Name: "@angular/core", From: "5.2.1", To: "5.2.11"},
+		{Name: "karma", From: "2.0.0", To: "2.0.5", Dev: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+	d, err := cfg.PackageJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(d), `"@angular/core": "5.2.11"`) || !strings.Contains(string(d), `"karma": "2.0.5"`) {
+		t.Fatalf("unexpected package.json:\n%s", d)
+	}
+
+	// up to date
+	if _, changes, err = cfg.RefreshDependencies(context.Background(), "", Registry{URL: ts.URL}); err != nil || len(changes) != 0 {
+		t.Fatalf("expected no change, got %+v (%v)", changes, err)
+	}
+
+	cfg.DependencyRanges = map[string]string{"left-pad": "^1.0.0"}
+	if _, _, err = cfg.RefreshDependencies(context.Background(), "", Registry{URL: ts.URL}); err == nil {
+		t.Fatal("expected error for the package not in package.json")
+	}
+}
+
+func TestReadLockfile(t *testing.T) {
+	l, err := ReadLockfile("../yarn.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs, _ := l.Versions(context.Background(), "@angular/core"); len(vs) == 0 {
+		t.Fatalf("expected @angular/core in yarn.lock, got %v", l["@angular/core"])
+	}
+	if l, err = ReadLockfile("../package-lock.json"); err != nil {
+		t.Fatal(err)
+	}
+	if vs, _ := l.Versions(context.Background(), "@angular/core"); len(vs) == 0 {
+		t.Fatalf("expected @angular/core in package-lock.json, got %v", l["@angular/core"])
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "frontenddep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "package-lock.json")
+	if err = ioutil.WriteFile(p, []byte(`{"lockfileVersion":2,"packages":{"":{"version":"1.0.0"},"node_modules/rxjs":{"version":"5.5.11"},"node_modules/a/node_modules/rxjs":{"version":"5.5.6"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = ReadLockfile(p); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, Lockfile{"rxjs": {"5.5.11", "5.5.6"}}) {
+		t.Fatalf("unexpected lockfile %v", l)
+	}
+}
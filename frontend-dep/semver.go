@@ -0,0 +1,317 @@
+package frontenddep
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is the semantic version of the npm package
+// (https://semver.org), without the build metadata.
+type version struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+// parseVersion parses the full version (e.g. "5.2.1", "6.0.0-rc.1").
+func parseVersion(s string) (version, error) {
+	v, n, err := parsePartial(s)
+	if err != nil {
+		return version{}, err
+	}
+	if n < 3 {
+		return version{}, fmt.Errorf("%q is not a full version", s)
+	}
+	return v, nil
+}
+
+// parsePartial parses the version with the number of the components
+// given, e.g. 2 for "1.2", "1.2.x", "1.2.*".
+func parsePartial(s string) (version, int, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "="), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	var v version
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	n := 0
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" || p == "" {
+			break
+		}
+		d, err := strconv.Atoi(p)
+		if err != nil || d < 0 {
+			return version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		switch i {
+		case 0:
+			v.major = d
+		case 1:
+			v.minor = d
+		case 2:
+			v.patch = d
+		}
+		n++
+	}
+	return v, n, nil
+}
+
+func (v version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if len(v.pre) > 0 {
+		s += "-" + strings.Join(v.pre, ".")
+	}
+	return s
+}
+
+// compare returns -1, 0, or 1 if v is lower, equal, or higher than o.
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	// the prerelease is lower than the release
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		a, errA := strconv.Atoi(v.pre[i])
+		b, errB := strconv.Atoi(o.pre[i])
+		switch {
+		case errA == nil && errB == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case errA == nil:
+			// numeric identifiers are lower
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], o.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(v.pre) - len(o.pre))
+}
+
+func sign(d int) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
+
+// comparator is the bound of the version range (e.g. ">=", "1.2.3").
+type comparator struct {
+	op string
+	v  version
+}
+
+func (c comparator) match(v version) bool {
+	d := v.compare(c.v)
+	switch c.op {
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// versionRange is the npm version range (e.g. "^5.2.0", "~2.6.1",
+// ">=4.0.0 <5", "1.x || 2.x"), the comparator sets joined by "||".
+type versionRange [][]comparator
+
+// parseRange parses the npm version range
+// (https://docs.npmjs.com/misc/semver#ranges).
+func parseRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, set := range strings.Split(s, "||") {
+		fields := strings.Fields(set)
+		if len(fields) == 3 && fields[1] == "-" {
+			// hyphen range "1.2.3 - 2.3"
+			lo, _, err := parsePartial(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			hi, n, err := parsePartial(fields[2])
+			if err != nil {
+				return nil, err
+			}
+			cs := []comparator{{">=", lo}}
+			if n > 0 {
+				cs = append(cs, upper("<=", hi, n)...)
+			}
+			r = append(r, cs)
+			continue
+		}
+
+		var cs []comparator
+		for _, f := range fields {
+			c, err := parseComparator(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q (%v)", s, err)
+			}
+			cs = append(cs, c...)
+		}
+		r = append(r, cs)
+	}
+	return r, nil
+}
+
+// parseComparator returns the bounds of the comparator,
+// e.g. ">=1.2.3 <2.0.0-0" for "^1.2.3".
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, p := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, p) {
+			op, s = p, s[len(p):]
+			break
+		}
+	}
+	v, n, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// "*", "x", or "" is any version
+		if op == "<" || op == ">" {
+			return []comparator{{"<", version{}}}, nil
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "^":
+		// the changes not modifying the left-most non-zero component
+		hi := version{major: v.major + 1}
+		switch {
+		case v.major == 0 && n >= 2 && v.minor == 0 && n == 3:
+			hi = version{patch: v.patch + 1}
+		case v.major == 0 && n >= 2:
+			hi = version{minor: v.minor + 1}
+		}
+		return []comparator{{">=", v}, {"<", lowest(hi)}}, nil
+	case "~":
+		hi := version{major: v.major, minor: v.minor + 1}
+		if n == 1 {
+			hi = version{major: v.major + 1}
+		}
+		return []comparator{{">=", v}, {"<", lowest(hi)}}, nil
+	case ">":
+		if n < 3 {
+			// ">1.2" is ">=1.3.0"
+			return []comparator{{">=", lowest(next(v, n))}}, nil
+		}
+		return []comparator{{">", v}}, nil
+	case "<=":
+		return upper("<=", v, n), nil
+	case ">=", "<":
+		return []comparator{{op, v}}, nil
+	}
+	if n < 3 {
+		// "1.2" is ">=1.2.0 <1.3.0"
+		return []comparator{{">=", v}, {"<", lowest(next(v, n))}}, nil
+	}
+	return []comparator{{"", v}}, nil
+}
+
+// upper returns the upper bound of "<=" the partial version.
+func upper(op string, v version, n int) []comparator {
+	if n < 3 {
+		// "<=1.2" is "<1.3.0"
+		return []comparator{{"<", lowest(next(v, n))}}
+	}
+	return []comparator{{op, v}}
+}
+
+// next returns the version incrementing the last given component.
+func next(v version, n int) version {
+	switch n {
+	case 1:
+		return version{major: v.major + 1}
+	case 2:
+		return version{major: v.major, minor: v.minor + 1}
+	}
+	return version{major: v.major, minor: v.minor, patch: v.patch + 1}
+}
+
+// lowest returns the lowest prerelease of the version, the upper
+// bound excluding its prereleases (e.g. "<2.0.0-0").
+func lowest(v version) version {
+	v.pre = []string{"0"}
+	return v
+}
+
+// match returns true if the version is in the range. The prereleases
+// only match the comparators with the prerelease of the same version.
+func (r versionRange) match(v version) bool {
+	for _, set := range r {
+		ok := true
+		for _, c := range set {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if len(v.pre) == 0 {
+			return true
+		}
+		for _, c := range set {
+			if len(c.v.pre) > 0 && c.v.pre[0] != "0" &&
+				c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxSatisfying returns the highest version in the range, or empty.
+func maxSatisfying(versions []string, rangeTxt string) (string, error) {
+	r, err := parseRange(rangeTxt)
+	if err != nil {
+		return "", err
+	}
+	var (
+		found bool
+		max   version
+		maxS  string
+	)
+	for _, s := range versions {
+		v, err := parseVersion(s)
+		if err != nil {
+			// e.g. tags in the lockfiles
+			continue
+		}
+		if r.match(v) && (!found || v.compare(max) > 0) {
+			found, max, maxS = true, v, s
+		}
+	}
+	return maxS, nil
+}
@@ -0,0 +1,62 @@
+package frontenddep
+
+import "testing"
+
+func TestMaxSatisfying(t *testing.T) {
+	versions := []string{"1.2.3", "1.2.10", "1.3.0", "1.4.0-beta.1", "2.0.0-rc.0", "2.0.0", "2.1.5", "0.2.1", "0.2.4", "0.3.0", "latest"}
+	tests := []struct {
+		rangeTxt string
+		max      string
+	}{
+		{"^1.2.3", "1.3.0"},
+		{"~1.2.3", "1.2.10"},
+		{"1.2.x", "1.2.10"},
+		{"1", "1.3.0"},
+		{"*", "2.1.5"},
+		{"^0.2.1", "0.2.4"},
+		{"~0.2", "0.2.4"},
+		{">=1.2.5 <2", "1.3.0"},
+		{"1.2.3 - 1.2", "1.2.10"},
+		{"<=1.2", "1.2.10"},
+		{">1.2", "2.1.5"},
+		{"2.0.0", "2.0.0"},
+		{"^1.4.0-beta.0", "1.4.0-beta.1"},
+		{"^2.0.0-rc.0", "2.1.5"},
+		{"0.1.x || 1.2.3", "1.2.3"},
+		{"^3.0.0", ""},
+	}
+	for i, tt := range tests {
+		max, err := maxSatisfying(versions, tt.rangeTxt)
+		if err != nil {
+			t.Fatalf("#%d: %q: %v", i, tt.rangeTxt, err)
+		}
+		if max != tt.max {
+			t.Errorf("#%d: %q expected %q, got %q", i, tt.rangeTxt, tt.max, max)
+		}
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0"}
+	for i := 1; i < len(ordered); i++ {
+		a, err := parseVersion(ordered[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseVersion(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.compare(b) != -1 || b.compare(a) != 1 {
+			t.Errorf("expected %q < %q", a, b)
+		}
+	}
+}
+
+func TestParseRangeInvalid(t *testing.T) {
+	for _, r := range []string{"latest", "1.2.3.4", "^a.b"} {
+		if _, err := parseRange(r); err == nil {
+			t.Errorf("%q: expected error", r)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package frontenddep
+
+const tmplPackageJSON = `{
+    "name": "app-dplearn",
+    "version": "0.9.9",
+    "license": "Apache-2.0",
+    "angular-cli": {},
+    "bin": {
+        "tslint": "./bin/tslint"
+    },
+    "scripts": {
+        "start": "{{.NgCommandServeStart}} --port {{.HostPort}} --host {{.Host}}",
+        "start-prod": "{{.NgCommandServeStartProd}} --port {{.HostProdPort}} --host {{.HostProd}} --disable-host-check",
+        "lint": "tslint \"frontend/**/*.ts\"",
+        "test": "ng test",
+        "pree2e": "webdriver-manager update",
+        "e2e": "protractor"
+    },
+    "private": true,
+    "dependencies": {
+        "@angular/common": "5.2.1",
+        "@angular/compiler": "5.2.1",
+        "@angular/compiler-cli": "5.2.1",
+        "@angular/core": "5.2.1",
+        "@angular/forms": "5.2.1",
+        "@angular/http": "5.2.1",
+        "@angular/platform-browser": "5.2.1",
+        "@angular/platform-browser-dynamic": "5.2.1",
+        "@angular/animations": "5.2.1",
+        "@angular/router": "5.2.1",
+        "@angular/tsc-wrapped": "4.4.6",
+        "@angular/upgrade": "5.2.1",
+        "@angular/cli": "1.7.0-beta.0",
+        "@angular/cdk": "5.0.4",
+        "@angular/material": "5.0.4",
+        "@types/angular": "1.6.40",
+        "@types/angular-animate": "1.5.9",
+        "@types/angular-cookies": "1.4.5",
+        "@types/angular-mocks": "1.5.11",
+        "@types/angular-resource": "1.5.14",
+        "@types/angular-route": "1.3.4",
+        "@types/angular-sanitize": "1.3.7",
+        "@types/node": "9.3.0",
+        "@types/hammerjs": "2.0.35",
+        "@types/jasmine": "2.8.2",
+        "core-js": "2.5.3",
+        "rxjs": "5.5.6",
+        "typescript": "2.6.2",
+        "ts-node": "4.0.2",
+        "ts-helpers": "1.1.2",
+        "zone.js": "0.8.19",
+        "@types/hammerjs": "2.0.35",
+        "@types/jasmine": "2.8.3",
+        "core-js": "2.5.3",
+        "rxjs": "5.5.6",
+        "typescript": "2.6.2",
+        "ts-node": "4.1.0",
+        "ts-helpers": "1.1.2",
+        "zone.js": "0.8.19"
+    },
+    "devDependencies": {
+        "codelyzer": "4.0.2",
+        "jasmine-core": "2.8.0",
+        "jasmine-spec-reporter": "4.2.1",
+        "karma": "2.0.0",
+        "karma-chrome-launcher": "2.2.0",
+        "karma-cli": "1.0.1",
+        "karma-jasmine": "1.1.1",
+        "karma-remap-istanbul": "0.6.0",
+        "protractor": "5.2.2",
+        "tslint": "5.9.1"
+    },
+    "description": "website",
+    "main": "index.js",
+    "repository": {
+        "url": "https://github.com/gyuho/dplearn",
+        "type": "git"
+    },
+    "author": "Gyu-Ho Lee <gyuhox@gmail.com>"
+}
+`
+
+const tmplAngularCLIJSON = `{
+    "project": {
+        "version": "1.7.0-beta.0",
+        "name": "app-dplearn"
+    },
+    "apps": [{
+        "root": "frontend",
+        "outDir": "dist",
+        "assets": [
+            "assets",
+            "favicon.ico"
+        ],
+        "index": "index.html",
+        "main": "main.ts",
+        "test": "test.ts",
+        "tsconfig": "tsconfig.json",
+        "prefix": "app",
+        "mobile": false,
+        "styles": [
+            "styles.css",
+            "app-dplearn-theme.scss"
+        ],
+        "scripts": [],
+        "environmentSource": "environments/environment.ts",
+        "environments": {
+            "prod": "environments/environment.prod.ts",
+            "dev": "environments/environment.dev.ts"
+        }
+    }],
+    "addons": [],
+    "packages": [],
+    "e2e": {
+        "protractor": {
+            "config": "./protractor.conf.js"
+        }
+    },
+    "test": {
+        "karma": {
+            "config": "./karma.conf.js"
+        }
+    },
+    "defaults": {
+        "styleExt": "css",
+        "prefixInterfaces": false,
+        "lazyRoutePrefix": "+",
+        "serve": {
+            "proxyConfig": "proxy.config.json"
+        }
+    }
+}
+`
+
+// tmplAngularJSON is the workspace configuration of Angular CLI 6 or later,
+// replacing angular-cli.json.
+const tmplAngularJSON = `{
+    "$schema": "./node_modules/@angular/cli/lib/config/schema.json",
+    "version": 1,
+    "newProjectRoot": "projects",
+    "projects": {
+        "app-dplearn": {
+            "root": "",
+            "sourceRoot": "frontend",
+            "projectType": "application",
+            "prefix": "app",
+            "schematics": {
+                "@schematics/angular:component": {
+                    "styleext": "css"
+                }
+            },
+            "architect": {
+                "build": {
+                    "builder": "@angular-devkit/build-angular:browser",
+                    "options": {
+                        "outputPath": "dist",
+                        "index": "frontend/index.html",
+                        "main": "frontend/main.ts",
+                        "tsConfig": "frontend/tsconfig.json",
+                        "assets": [
+                            "frontend/assets",
+                            "frontend/favicon.ico"
+                        ],
+                        "styles": [
+                            "frontend/styles.css",
+                            "frontend/app-dplearn-theme.scss"
+                        ],
+                        "scripts": []
+                    },
+                    "configurations": {
+                        "production": {
+                            "fileReplacements": [{
+                                "replace": "frontend/environments/environment.ts",
+                                "with": "frontend/environments/environment.prod.ts"
+                            }],
+                            "optimization": true,
+                            "outputHashing": "all",
+                            "sourceMap": false,
+                            "extractCss": true,
+                            "namedChunks": false,
+                            "aot": true,
+                            "extractLicenses": true,
+                            "vendorChunk": false,
+                            "buildOptimizer": true
+                        },
+                        "dev": {
+                            "fileReplacements": [{
+                                "replace": "frontend/environments/environment.ts",
+                                "with": "frontend/environments/environment.dev.ts"
+                            }]
+                        }
+                    }
+                },
+                "serve": {
+                    "builder": "@angular-devkit/build-angular:dev-server",
+                    "options": {
+                        "browserTarget": "app-dplearn:build",
+                        "host": "{{.Host}}",
+                        "port": {{.HostPort}},
+                        "proxyConfig": "proxy.config.json"
+                    },
+                    "configurations": {
+                        "production": {
+                            "browserTarget": "app-dplearn:build:production",
+                            "host": "{{.HostProd}}",
+                            "port": {{.HostProdPort}},
+                            "disableHostCheck": true
+                        }
+                    }
+                },
+                "test": {
+                    "builder": "@angular-devkit/build-angular:karma",
+                    "options": {
+                        "main": "frontend/test.ts",
+                        "tsConfig": "frontend/tsconfig.json",
+                        "karmaConfig": "./karma.conf.js",
+                        "styles": [
+                            "frontend/styles.css",
+                            "frontend/app-dplearn-theme.scss"
+                        ],
+                        "scripts": [],
+                        "assets": [
+                            "frontend/assets",
+                            "frontend/favicon.ico"
+                        ]
+                    }
+                },
+                "lint": {
+                    "builder": "@angular-devkit/build-angular:tslint",
+                    "options": {
+                        "tsConfig": [
+                            "frontend/tsconfig.json"
+                        ],
+                        "exclude": [
+                            "**/node_modules/**"
+                        ]
+                    }
+                }
+            }
+        },
+        "app-dplearn-e2e": {
+            "root": "",
+            "projectType": "application",
+            "architect": {
+                "e2e": {
+                    "builder": "@angular-devkit/build-angular:protractor",
+                    "options": {
+                        "protractorConfig": "./protractor.conf.js",
+                        "devServerTarget": "app-dplearn:serve"
+                    }
+                }
+            }
+        }
+    },
+    "defaultProject": "app-dplearn"
+}
+`
+
+const tmplProxyConfigJSON = `{
+{{- range $i, $path := .ProxyPaths}}{{if $i}},{{end}}
+    "{{$path}}": {
+        "target": "http://{{$.BackendHost}}",
+        "secure": "false"
+    }
+{{- end}}
+}
+`
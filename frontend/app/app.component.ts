@@ -1,4 +1,19 @@
-import { Component } from "@angular/core";
+import {
+  Component,
+  OnDestroy,
+  OnInit,
+} from "@angular/core";
+
+import {
+  Http,
+  Response,
+} from "@angular/http";
+
+// Status represents TypeScript version of Status in https://github.com/gyuho/dplearn/blob/master/backend/web/maintenance.go.
+export class Status {
+  public maintenance: boolean;
+  public message: string;
+}
 
 @Component({
   selector: "app-dplearn",
@@ -6,4 +21,34 @@ import { Component } from "@angular/core";
   templateUrl: "app.component.html",
 })
 
-export class AppComponent { }
+export class AppComponent implements OnInit, OnDestroy {
+  public maintenance = false;
+  public maintenanceMessage = "";
+
+  private statusEndpoint = "status";
+  private pollingHandler;
+
+  constructor(private http: Http) { }
+
+  public ngOnInit() {
+    this.fetchStatus();
+    this.pollingHandler = setInterval(() => this.fetchStatus(), 30000);
+  }
+
+  public ngOnDestroy() {
+    clearInterval(this.pollingHandler);
+  }
+
+  // fetchStatus checks if backend is in maintenance mode.
+  public fetchStatus() {
+    this.http.get(this.statusEndpoint)
+      .map((res: Response) => res.json() as Status)
+      .subscribe(
+        (st) => {
+          this.maintenance = st.maintenance;
+          this.maintenanceMessage = st.message;
+        },
+        (error) => console.error("failed to fetch status", error),
+      );
+  }
+}
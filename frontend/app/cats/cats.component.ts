@@ -6,16 +6,34 @@ import {
   BackendService,
 } from "../request.service";
 
+import {
+  UploadService,
+} from "../upload.service";
+
 @Component({
-  providers: [BackendService],
+  providers: [BackendService, UploadService],
   selector: "app",
   styleUrls: ["cats.component.css"],
   templateUrl: "cats.component.html",
 })
 export class CatsComponent {
   public endpoint = "cats-request";
-  constructor(public backendService: BackendService) {
+  constructor(public backendService: BackendService, public uploadService: UploadService) {
     backendService.endpoint = this.endpoint;
     backendService.inputValue = "https://static.pexels.com/photos/127028/pexels-photo-127028.jpeg";
   }
+
+  // uploadFile uploads the selected photo, and requests with the upload URL.
+  public uploadFile(files: FileList) {
+    if (files.length === 0) {
+      return;
+    }
+    this.backendService.result = `Uploading '${files[0].name}'...`;
+    this.uploadService.upload(files[0])
+      .then((location) => {
+        this.backendService.inputValue = location;
+        this.backendService.clickPOST();
+      })
+      .catch((err) => this.backendService.result = `Upload failed (${err})`);
+  }
 }
@@ -44,6 +44,7 @@ export class Item {
   public canceled: boolean;
   public error: string;
   public request_id: string;
+  public stage_progress: StageProgress;
   constructor(
     bucket: string,
     key: string,
@@ -63,6 +64,35 @@ export class Item {
   }
 }
 
+// Stage represents TypeScript version of Stage in https://github.com/gyuho/dplearn/blob/master/pkg/etcd-queue/progress.go.
+export class Stage {
+  public name: string;
+  public weight: number;
+}
+
+// StageProgress represents TypeScript version of StageProgress in https://github.com/gyuho/dplearn/blob/master/pkg/etcd-queue/progress.go.
+export class StageProgress {
+  public stages: Stage[];
+  public current: string;
+  public percent: number;
+}
+
+// LogLine represents TypeScript version of LogLine in https://github.com/gyuho/dplearn/blob/master/pkg/etcd-queue/logs.go.
+export class LogLine {
+  public rev: number;
+  public line: string;
+  public time: string;
+}
+
+// APIError represents TypeScript version of Error in https://github.com/gyuho/dplearn/blob/master/backend/web/error.go.
+export class APIError {
+  public code: string;
+  public message: string;
+  public request_id: string;
+  public retryable: boolean;
+  public status: number;
+}
+
 @Injectable()
 export class BackendService implements OnDestroy {
   public endpoint = "";
@@ -71,6 +101,13 @@ export class BackendService implements OnDestroy {
   public result: string;
 
   public progress = 0;
+  // stage is the current stage of the job with its progress
+  // (e.g. "inference 40%"), empty if the worker reports no stages.
+  public stage = "";
+  public logs: string[] = [];
+  // artifactURL is the URL of the job output uploaded by the worker
+  // (e.g. generated image), empty if the result has no artifact.
+  public artifactURL = "";
   public spinnerColor = "primary";
   public spinnerMode = "indeterminate";
 
@@ -79,6 +116,7 @@ export class BackendService implements OnDestroy {
   private requestID: string;
   private needInterval: boolean;
   private pollingHandler;
+  private logSource: EventSource;
   private url: string;
 
   constructor(
@@ -97,6 +135,7 @@ export class BackendService implements OnDestroy {
     console.log("user left page; destroying!", this.url);
     this.needInterval = false;
     clearInterval(this.pollingHandler);
+    this.closeLogs();
 
     const body = JSON.stringify(new Request(this.inputValue, false));
     const headers = new Headers({"Content-Type" : "application/json"});
@@ -117,6 +156,9 @@ export class BackendService implements OnDestroy {
     this.inputValue = "";
     this.result = "Nothing to show yet...";
     this.progress = 0;
+    this.stage = "";
+    this.logs = [];
+    this.artifactURL = "";
     this.errorFromServer = "";
     console.log("user left page; destroyed!", this.url);
 
@@ -131,6 +173,7 @@ export class BackendService implements OnDestroy {
     if (this.needInterval) {
       this.needInterval = false;
       this.pollingHandler = setInterval(() => this.fetchStatus(), 500);
+      this.streamLogs();
     }
 
     if (resp.error !== "") {
@@ -144,17 +187,58 @@ export class BackendService implements OnDestroy {
     }
 
     this.progress = resp.progress;
+    if (resp.stage_progress) {
+      this.stage = `${resp.stage_progress.current} ${resp.stage_progress.percent}%`;
+    }
     if (this.progress === 100) {
       clearInterval(this.pollingHandler);
+      // workers record only the object URI of large outputs,
+      // and backend redirects to its signed URL
+      if (resp.error === "" && resp.value.indexOf("gs://") === 0) {
+        this.artifactURL = `${this.endpoint}/artifact?request_id=${encodeURIComponent(this.requestID)}`;
+      }
+    }
+  }
+
+  // streamLogs streams worker logs of the request (e.g. model loading),
+  // until the job is done.
+  public streamLogs() {
+    this.closeLogs();
+    this.logSource = new EventSource(`${this.endpoint}/logs?request_id=${encodeURIComponent(this.requestID)}`);
+    this.logSource.onmessage = (ev: MessageEvent) => {
+      const ll = JSON.parse(ev.data) as LogLine;
+      this.logs.push(ll.line);
+    };
+    this.logSource.addEventListener("done", () => this.closeLogs());
+  }
+
+  public closeLogs() {
+    if (this.logSource) {
+      this.logSource.close();
+      this.logSource = null;
     }
   }
 
+  public processErrorFromServer(errMsg: string) {
+    clearInterval(this.pollingHandler);
+    this.errorFromServer = errMsg;
+    this.result = errMsg;
+  }
+
   public processHTTPResponseClient(res: Response) {
     return (res.json() as Item) || {};
   }
 
   public processHTTPErrorClient(error: any) {
-    const errMsg = (error.message) ? error.message :
+    // backend returns structured error (see APIError) with non-2xx status
+    let apiErr: APIError;
+    try {
+      apiErr = error.json() as APIError;
+    } catch (e) {
+      apiErr = null;
+    }
+    const errMsg = (apiErr && apiErr.message) ? `${apiErr.message} (${apiErr.code})` :
+      (error.message) ? error.message :
       error.status ? `${error.status} - ${error.statusText}` : "Server error";
     console.error(errMsg);
     this.errorFromServer = errMsg;
@@ -177,7 +261,7 @@ export class BackendService implements OnDestroy {
       .catch(this.processHTTPErrorClient)
       .subscribe(
         (resp) => itemFromServer = resp,
-        (error) => this.errorFromServer = error as any,
+        (error) => this.processErrorFromServer(error),
         () => this.processItemFromServer(itemFromServer), // on-complete
       );
   }
@@ -188,6 +272,9 @@ export class BackendService implements OnDestroy {
     });
 
     this.progress = 0;
+    this.stage = "";
+    this.logs = [];
+    this.artifactURL = "";
     this.result = `[FRONTEND - ACK] Requested '${this.inputValue}' (request ID: ${this.requestID})`;
 
     const body = JSON.stringify(new Request(this.inputValue, true));
@@ -204,7 +291,7 @@ export class BackendService implements OnDestroy {
       .catch(this.processHTTPErrorClient)
       .subscribe(
         (resp) => itemFromServer = resp,
-        (error) => this.errorFromServer = error as any,
+        (error) => this.processErrorFromServer(error),
         () => this.processItemFromServer(itemFromServer), // on-complete
       );
 
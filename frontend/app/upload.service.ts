@@ -0,0 +1,76 @@
+import { Injectable } from "@angular/core";
+
+// UploadService uploads files with tus resumable upload protocol
+// (see https://github.com/gyuho/dplearn/blob/master/backend/web/upload.go).
+// Interrupted uploads resume from the offset reported by the backend.
+@Injectable()
+export class UploadService {
+  public endpoint = "upload";
+  public chunkSize = 512 * 1024;
+  public maxRetries = 10;
+  public retryDelay = 2000;
+
+  public progress = 0;
+
+  // upload returns the upload URL once the whole file is uploaded.
+  public async upload(file: File): Promise<string> {
+    this.progress = 0;
+    const resp = await fetch(this.endpoint, {
+      headers: {
+        "Tus-Resumable": "1.0.0",
+        "Upload-Length": `${file.size}`,
+        "Upload-Metadata": `filename ${btoa(file.name)}`,
+      },
+      method: "POST",
+    });
+    if (resp.status !== 201) {
+      throw new Error(`failed to create upload (${resp.status} ${await resp.text()})`);
+    }
+    const location = resp.headers.get("Location");
+
+    let offset = 0;
+    let retries = 0;
+    while (offset < file.size) {
+      try {
+        offset = await this.patch(location, file, offset);
+        retries = 0;
+      } catch (err) {
+        if (++retries > this.maxRetries) {
+          throw err;
+        }
+        console.warn("upload interrupted; resuming", err);
+        await new Promise((resolve) => setTimeout(resolve, this.retryDelay));
+        offset = await this.fetchOffset(location);
+      }
+      this.progress = Math.floor(offset * 100 / file.size);
+    }
+    return location;
+  }
+
+  private async patch(location: string, file: File, offset: number): Promise<number> {
+    const resp = await fetch(location, {
+      body: file.slice(offset, offset + this.chunkSize),
+      headers: {
+        "Content-Type": "application/offset+octet-stream",
+        "Tus-Resumable": "1.0.0",
+        "Upload-Offset": `${offset}`,
+      },
+      method: "PATCH",
+    });
+    if (resp.status !== 204) {
+      throw new Error(`failed to upload chunk (${resp.status})`);
+    }
+    return parseInt(resp.headers.get("Upload-Offset"), 10);
+  }
+
+  private async fetchOffset(location: string): Promise<number> {
+    const resp = await fetch(location, {
+      headers: { "Tus-Resumable": "1.0.0" },
+      method: "HEAD",
+    });
+    if (resp.status !== 200) {
+      throw new Error(`failed to fetch upload offset (${resp.status})`);
+    }
+    return parseInt(resp.headers.get("Upload-Offset"), 10);
+  }
+}
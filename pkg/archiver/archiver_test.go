@@ -0,0 +1,63 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles writes the files, from relative path to contents, under 'dir'.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles returns the regular files under 'dir', from relative path to contents.
+func readFiles(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return files
+	}
+	err := filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		b, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func checkFiles(t *testing.T, dir string, expected map[string]string) {
+	if files := readFiles(t, dir); !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "archiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
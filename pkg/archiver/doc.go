@@ -0,0 +1,7 @@
+// Package archiver makes and extracts .zip and .tar.* archives
+// (e.g. the datasets unarchived by cmd/download-data).
+//
+// It is forked from github.com/gyuho/archiver at 0c5460b, itself forked
+// from github.com/mholt/archiver (MIT License, see LICENSE), so that the
+// changes are made and tested in this repository.
+package archiver
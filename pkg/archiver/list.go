@@ -0,0 +1,75 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Entry is a file in the archive, returned by 'List'.
+type Entry struct {
+	// Name is the path in the archive, with "/" separators.
+	Name string
+	// Size is the uncompressed size of the file.
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	// Link is the target of the symlinks and hard links (tarballs only).
+	Link string
+}
+
+// Lister lists the entries of the archive without extracting them.
+type Lister interface {
+	List(source string) ([]Entry, error)
+}
+
+// List returns the entries of the archive file without extracting them,
+// so that the contents (e.g. of uploads) can be validated or displayed
+// before extraction. The archive format is detected with 'MatchingFormat'.
+func List(source string) ([]Entry, error) {
+	format := MatchingFormat(source)
+	if format == nil {
+		return nil, fmt.Errorf("%s: unknown archive format", source)
+	}
+	l, ok := format.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("%s: listing is not supported for %T", source, format)
+	}
+	return l.List(source)
+}
+
+// listTar lists the entries of the tarball, decompressed by 'decompress'.
+func listTar(source string, decompress func(io.Reader) (io.ReadCloser, error)) ([]Entry, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open archive: %v", source, err)
+	}
+	defer f.Close()
+
+	rc, err := decompress(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error decompressing: %v", source, err)
+	}
+	defer rc.Close()
+
+	var entries []Entry
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		entries = append(entries, Entry{
+			Name:    header.Name,
+			Size:    header.Size,
+			Mode:    header.FileInfo().Mode(),
+			ModTime: header.ModTime,
+			Link:    header.Linkname,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,65 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "cats")
+	writeFiles(t, src, map[string]string{
+		"train/cat.1.jpg": "cat",
+		"train/cat.2.jpg": "cat2",
+		"labels.txt":      "cat\ndog\n",
+	})
+	expected := map[string]int64{
+		"cats/train/cat.1.jpg": 3,
+		"cats/train/cat.2.jpg": 4,
+		"cats/labels.txt":      8,
+	}
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tar.bz2", ".tar.xz", ".tar.lz4", ".tar.sz", ".tar.zst"} {
+		fpath := filepath.Join(dir, "cats"+ext)
+		format := MatchingFormat(fpath)
+		if format == nil {
+			t.Fatalf("%s: no matching format", ext)
+		}
+		if err := format.Make(fpath, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := List(fpath)
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		files := make(map[string]int64)
+		for _, e := range entries {
+			if e.Mode.IsDir() {
+				if !strings.HasPrefix(e.Name, "cats") {
+					t.Fatalf("%s: unexpected directory %q", ext, e.Name)
+				}
+				continue
+			}
+			if !e.Mode.IsRegular() {
+				t.Fatalf("%s: %q expected regular file, got %v", ext, e.Name, e.Mode)
+			}
+			files[e.Name] = e.Size
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Fatalf("%s: expected %v, got %v", ext, expected, files)
+		}
+
+		// listing does not extract
+		if _, err := os.Stat(filepath.Join(filepath.Dir(fpath), "train")); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected no extraction, got %v", ext, err)
+		}
+	}
+
+	if _, err := List(filepath.Join(dir, "cats.txt")); err == nil {
+		t.Fatal("expected error for unknown archive format")
+	}
+}
@@ -0,0 +1,133 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ManifestName is the name of the manifest entry at the root of the archive,
+// in the format of sha256sum (e.g. "sha256sum -c .archiver.sha256" in the
+// extracted directory). The name is specific to archiver, not to verify the
+// checksum files shipped in the archives made by other tools.
+const ManifestName = ".archiver.sha256"
+
+// maxManifestSize is the size limit of the manifest entry read on extraction.
+const maxManifestSize = 64 * 1024 * 1024
+
+// manifest is the SHA-256 digests of the archived regular files.
+type manifest struct {
+	buf bytes.Buffer
+}
+
+// hash returns the writer to copy the file contents to, and
+// the function to record the digest after the copy.
+func (m *manifest) hash(name string, w io.Writer) (io.Writer, func()) {
+	if m == nil {
+		return w, func() {}
+	}
+	h := sha256.New()
+	return io.MultiWriter(w, h), func() {
+		fmt.Fprintf(&m.buf, "%x  %s\n", h.Sum(nil), manifestEntryName(name))
+	}
+}
+
+// verifier computes the SHA-256 digests of the extracted regular files,
+// and verifies them against the manifest entry, if any.
+type verifier struct {
+	hashes   map[string]hash.Hash
+	manifest []byte
+}
+
+func newVerifier() *verifier {
+	return &verifier{hashes: make(map[string]hash.Hash)}
+}
+
+// reader returns the reader of the file contents, computing the digest.
+func (v *verifier) reader(name string, r io.Reader) io.Reader {
+	h := sha256.New()
+	v.hashes[manifestEntryName(name)] = h
+	return io.TeeReader(r, h)
+}
+
+// sum returns the SHA-256 in hex of the extracted regular file,
+// or "-" for the other entries.
+func (v *verifier) sum(name string) string {
+	h, ok := v.hashes[manifestEntryName(name)]
+	if !ok {
+		return "-"
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readManifest reads the manifest entry, and returns its contents
+// to extract.
+func (v *verifier) readManifest(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ManifestName, err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, fmt.Errorf("%s: manifest exceeds %d bytes", ManifestName, maxManifestSize)
+	}
+	v.manifest = data
+	return bytes.NewReader(data), nil
+}
+
+// verify returns an error if the extracted files do not match the
+// manifest, or the manifest is required (see 'WithManifest') but
+// not found. With 'WithPatterns', only the matched files are verified.
+func (v *verifier) verify(op Op) error {
+	if v.manifest == nil {
+		if op.manifest {
+			return fmt.Errorf("%s: manifest not found in the archive", ManifestName)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(v.manifest))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return fmt.Errorf("%s:%d: invalid line %q", ManifestName, n, line)
+		}
+		// " " (text) or "*" (binary) mode of sha256sum
+		name := manifestEntryName(strings.TrimLeft(fields[1], " *"))
+		ok, err := op.match(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		h, ok := v.hashes[name]
+		if !ok {
+			return fmt.Errorf("%s: listed in %s but not found in the archive", name, ManifestName)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(fields[0]) {
+			return fmt.Errorf("%s: SHA-256 mismatch (expected %s, got %s)", name, fields[0], got)
+		}
+	}
+	return scanner.Err()
+}
+
+// manifestEntryName returns the name of the entry in the manifest,
+// with "/" separators and without the leading "./".
+func manifestEntryName(name string) string {
+	return strings.TrimPrefix(strings.Replace(name, `\`, "/", -1), "./")
+}
+
+// isManifest returns true if the entry is the manifest at the root.
+func isManifest(name string) bool {
+	return manifestEntryName(name) == ManifestName
+}
@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "cats")
+	files := map[string]string{
+		"cats/model/saved_model.pb": "graph",
+		"cats/train/cat.1.jpg":      "cat",
+	}
+	writeFiles(t, dir, files)
+
+	for _, format := range []Archiver{Zip, TarGz} {
+		fpath := filepath.Join(dir, "cats.archive")
+		if err := format.Make(fpath, []string{src}, WithManifest()); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "out")
+		if err := format.Open(fpath, dst, WithManifest()); err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dst, ManifestName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range files {
+			line := fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(data)), name)
+			if !strings.Contains(string(b), line) {
+				t.Fatalf("%T: expected %q in manifest, got %q", format, line, b)
+			}
+		}
+		os.RemoveAll(dst)
+
+		// only the matched files are verified
+		if err := format.Open(fpath, dst, WithManifest(), WithPatterns("*.pb")); err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		os.RemoveAll(dst)
+
+		// the manifest is required, but not found
+		if err := format.Make(fpath, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+		if err := format.Open(fpath, dst); err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		os.RemoveAll(dst)
+		if err := format.Open(fpath, dst, WithManifest()); err == nil || !strings.Contains(err.Error(), "manifest not found") {
+			t.Fatalf("%T: expected manifest not found error, got %v", format, err)
+		}
+		os.RemoveAll(dst)
+	}
+}
+
+func TestManifestMismatch(t *testing.T) {
+	sum := func(data string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(data))) }
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"tampered", sum("cat") + "  train/cat.1.jpg\n" + sum("cat") + "  train/cat.2.jpg\n", "train/cat.2.jpg: SHA-256 mismatch"},
+		{"missing file", sum("cat") + "  train/cat.3.jpg\n", "train/cat.3.jpg: listed in"},
+		{"invalid line", "deadbeef  train/cat.1.jpg\n", "invalid line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			data := makeTar(t,
+				tarEntry{name: "train/cat.1.jpg", data: "cat"},
+				tarEntry{name: "train/cat.2.jpg", data: "corrupted"},
+				tarEntry{name: ManifestName, data: tt.manifest},
+			)
+			fpath := filepath.Join(dir, "cats.tar")
+			if err := ioutil.WriteFile(fpath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := Tar.Open(fpath, filepath.Join(dir, "out"))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package archiver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Op represents an Operation that archiver can execute.
+type Op struct {
+	verbose           bool
+	directoryToIgnore string
+	progress          func(Progress)
+	patterns          []string
+	concurrency       int
+	manifest          bool
+	resume            bool
+
+	total   int64  // archive size on Open
+	archive string // archive identity on Open, to resume
+	tracker *tracker
+	sums    *manifest // digests of the archived files on Make
+}
+
+// OpOption configures archiver operations.
+type OpOption func(*Op)
+
+// WithVerbose configures verbose mode.
+func WithVerbose() OpOption {
+	return func(op *Op) { op.verbose = true }
+}
+
+// WithDirectoryToIgnore add directory to ignore.
+func WithDirectoryToIgnore(dir string) OpOption {
+	return func(op *Op) { op.directoryToIgnore = dir }
+}
+
+// WithProgress reports the progress of Make and Open to the function,
+// on each file and every few megabytes within large files, so that long
+// operations (e.g. dataset extraction) can be surfaced. The function is
+// called synchronously, from the goroutine of the operation.
+func WithProgress(fn func(Progress)) OpOption {
+	return func(op *Op) { op.progress = fn }
+}
+
+// WithConcurrency compresses with 'n' goroutines on Make, to use all cores
+// (e.g. runtime.NumCPU()) when packaging large archives. The tar.gz and
+// tar.bz2 formats compress the blocks of the tarball in parallel, writing
+// the concatenated streams (e.g. gzip members) that gunzip and bunzip2
+// decompress as one, and tar.zst uses the concurrent zstd encoder. Other
+// formats ignore the option.
+func WithConcurrency(n int) OpOption {
+	return func(op *Op) { op.concurrency = n }
+}
+
+// WithPatterns extracts only the entries matching any of the glob patterns
+// (see 'path.Match') on Open, e.g. "*.pb" to extract the model files from
+// the archive with the training data. The patterns without "/" match the
+// base name of the entries, and the others the full name
+// (e.g. "model/variables/*").
+func WithPatterns(patterns ...string) OpOption {
+	return func(op *Op) { op.patterns = append(op.patterns, patterns...) }
+}
+
+// WithManifest includes the SHA-256 digests of the regular files on Make,
+// as the sha256sum format entry 'ManifestName' at the root of the archive.
+// On Open, the extracted files are always verified against the manifest
+// if present, and the option requires the manifest, so that corrupted
+// archives (e.g. releases, state backups) are rejected at extraction.
+func WithManifest() OpOption {
+	return func(op *Op) { op.manifest = true }
+}
+
+// WithResume records the extracted entries in the destination on Open, and
+// on retry skips the ones extracted before the interruption whose files are
+// intact, so that the interrupted extraction of a large dataset does not
+// start over. The records are discarded when the archive changes (size or
+// modification time), and removed when the extraction completes.
+func WithResume() OpOption {
+	return func(op *Op) { op.resume = true }
+}
+
+// match returns true if the entry name matches any of the patterns,
+// or no pattern is given.
+func (op Op) match(name string) (bool, error) {
+	if len(op.patterns) == 0 {
+		return true, nil
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	for _, pattern := range op.patterns {
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		ok, err := path.Match(pattern, target)
+		if err != nil {
+			return false, fmt.Errorf("%q: %v", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
@@ -0,0 +1,125 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// parallelBlockSize is the size of the blocks compressed in parallel.
+// Each block is a separate compressed stream (e.g. gzip member), which
+// costs a little in the compression ratio, and the readers decompress
+// the concatenated streams as one.
+const parallelBlockSize = 1024 * 1024
+
+// parallelWriter compresses the blocks of the input with the worker
+// pool, and writes the compressed blocks in order.
+type parallelWriter struct {
+	w         io.Writer
+	compress  func(w io.Writer) (io.WriteCloser, error)
+	blockSize int
+
+	buf     []byte
+	written bool
+	pending chan chan blockResult // in order, at most 'workers' blocks in flight
+	donec   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+type blockResult struct {
+	data []byte
+	err  error
+}
+
+// newParallelWriter returns the writer compressing with 'workers' goroutines.
+// Close must be called to flush the last block.
+func newParallelWriter(w io.Writer, workers, blockSize int, compress func(w io.Writer) (io.WriteCloser, error)) *parallelWriter {
+	pw := &parallelWriter{
+		w:         w,
+		compress:  compress,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		pending:   make(chan chan blockResult, workers),
+		donec:     make(chan struct{}),
+	}
+	go pw.writeBlocks()
+	return pw
+}
+
+func (pw *parallelWriter) writeBlocks() {
+	defer close(pw.donec)
+	for resc := range pw.pending {
+		res := <-resc
+		if pw.error() != nil {
+			continue
+		}
+		if res.err == nil {
+			_, res.err = pw.w.Write(res.data)
+		}
+		if res.err != nil {
+			pw.setError(res.err)
+		}
+	}
+}
+
+func (pw *parallelWriter) Write(p []byte) (int, error) {
+	if err := pw.error(); err != nil {
+		return 0, err
+	}
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(pw.buf[len(pw.buf):cap(pw.buf)], p)
+		pw.buf = pw.buf[:len(pw.buf)+n]
+		p = p[n:]
+		if len(pw.buf) == cap(pw.buf) {
+			pw.flush()
+		}
+	}
+	return written, nil
+}
+
+// flush compresses the buffered block in the background.
+func (pw *parallelWriter) flush() {
+	block := pw.buf
+	pw.buf = make([]byte, 0, pw.blockSize)
+	pw.written = true
+
+	resc := make(chan blockResult, 1)
+	// blocks when 'workers' blocks are in flight
+	pw.pending <- resc
+	go func() {
+		var out bytes.Buffer
+		cw, err := pw.compress(&out)
+		if err == nil {
+			if _, err = cw.Write(block); err == nil {
+				err = cw.Close()
+			}
+		}
+		resc <- blockResult{data: out.Bytes(), err: err}
+	}()
+}
+
+// Close flushes the last block, and waits for all blocks written.
+func (pw *parallelWriter) Close() error {
+	if len(pw.buf) > 0 || !pw.written {
+		// at least one stream, even for empty input
+		pw.flush()
+	}
+	close(pw.pending)
+	<-pw.donec
+	return pw.error()
+}
+
+func (pw *parallelWriter) error() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+func (pw *parallelWriter) setError(err error) {
+	pw.mu.Lock()
+	pw.err = err
+	pw.mu.Unlock()
+}
@@ -0,0 +1,115 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithConcurrency(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// larger than a few blocks, to compress in parallel
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 3*parallelBlockSize+100; i++ {
+		fmt.Fprintf(&buf, "cat.%d.jpg,%d\n", i, i*7%13)
+	}
+	src := filepath.Join(dir, "cats")
+	expected := map[string]string{
+		"cats/labels.csv":     buf.String(),
+		"cats/train/cat.jpg":  "cat",
+		"cats/train/empty.db": "",
+	}
+	writeFiles(t, dir, expected)
+
+	for _, format := range []Archiver{TarGz, TarBz2, TarZst} {
+		serial, parallel := filepath.Join(dir, "serial.archive"), filepath.Join(dir, "parallel.archive")
+		if err := format.Make(serial, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+		if err := format.Make(parallel, []string{src}, WithConcurrency(4)); err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		for _, fpath := range []string{serial, parallel} {
+			dst := filepath.Join(dir, "out")
+			if err := format.Open(fpath, dst); err != nil {
+				t.Fatalf("%T: %v", format, err)
+			}
+			checkFiles(t, dst, expected)
+			os.RemoveAll(dst)
+		}
+		os.Remove(serial)
+		os.Remove(parallel)
+	}
+}
+
+func TestParallelWriter(t *testing.T) {
+	gz := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	for _, size := range []int{0, 1, 99, 100, 101, 1000} {
+		data := bytes.Repeat([]byte("x"), size)
+
+		var out bytes.Buffer
+		pw := newParallelWriter(&out, 3, 100, gz)
+		// uneven writes across the block boundaries
+		for p := data; len(p) > 0; {
+			n := 33
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := pw.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// gzip reader decompresses the concatenated members as one
+		gr, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		b, err := ioutil.ReadAll(gr)
+		if err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("%d: expected %d bytes, got %d", size, len(data), len(b))
+		}
+	}
+}
+
+func TestTarSymlinkTarget(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "model")
+	writeFiles(t, src, map[string]string{"v1/saved_model.pb": "graph"})
+	if err := os.Symlink("v1", filepath.Join(src, "latest")); err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(dir, "model.tar")
+	if err := Tar.Make(fpath, []string{src}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := List(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name == "model/latest" {
+			if e.Link != "v1" {
+				t.Fatalf("expected link target %q, got %q", "v1", e.Link)
+			}
+			return
+		}
+	}
+	t.Fatalf("model/latest not found in %v", entries)
+}
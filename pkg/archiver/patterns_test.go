@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithPatterns(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "cats")
+	writeFiles(t, src, map[string]string{
+		"model/saved_model.pb":      "graph",
+		"model/variables/variables": "weights",
+		"model/variables/index.pb":  "index",
+		"train/cat.1.jpg":           "cat",
+		"train/cat.2.jpg":           "cat2",
+	})
+	tests := []struct {
+		patterns []string
+		expected map[string]string
+	}{
+		{
+			// base name
+			[]string{"*.pb"},
+			map[string]string{"cats/model/saved_model.pb": "graph", "cats/model/variables/index.pb": "index"},
+		},
+		{
+			// full name
+			[]string{"cats/model/variables/*"},
+			map[string]string{"cats/model/variables/variables": "weights", "cats/model/variables/index.pb": "index"},
+		},
+		{
+			[]string{"saved_model.pb", "cat.1.jpg"},
+			map[string]string{"cats/model/saved_model.pb": "graph", "cats/train/cat.1.jpg": "cat"},
+		},
+		{
+			[]string{"*.txt"},
+			map[string]string{},
+		},
+	}
+	for _, format := range []Archiver{Zip, TarGz} {
+		fpath := filepath.Join(dir, "cats.archive")
+		if err := format.Make(fpath, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+		for i, tt := range tests {
+			dst := filepath.Join(dir, "out")
+			var files int
+			if err := format.Open(fpath, dst, WithPatterns(tt.patterns...), WithProgress(func(p Progress) { files = p.Files })); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+			checkFiles(t, dst, tt.expected)
+			if files != len(tt.expected) {
+				t.Fatalf("#%d: expected %d files in progress, got %d", i, len(tt.expected), files)
+			}
+			os.RemoveAll(dst)
+		}
+
+		// malformed pattern
+		if err := format.Open(fpath, filepath.Join(dir, "out"), WithPatterns("[")); err == nil {
+			t.Fatal("expected error")
+		}
+		os.RemoveAll(filepath.Join(dir, "out"))
+		os.Remove(fpath)
+	}
+}
@@ -0,0 +1,141 @@
+package archiver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Progress is the progress of Make and Open, reported with 'WithProgress'.
+type Progress struct {
+	// File is the name of the file being archived or extracted.
+	File string
+	// Files is the number of files archived or extracted so far,
+	// including the current one.
+	Files int
+	// Bytes is the number of bytes processed out of Total: the file
+	// contents on Make and zip Open, and the archive file (compressed)
+	// on tarball and rar Open, whose file contents are unknown until
+	// the end.
+	Bytes int64
+	// Total is 0 if unknown (e.g. Read from a stream).
+	Total int64
+}
+
+// progressInterval is the number of bytes between the progress
+// reports within a file.
+const progressInterval = 4 * 1024 * 1024
+
+// tracker reports the progress of an operation.
+// All methods are no-op on nil tracker.
+type tracker struct {
+	// mu serializes the reports, since the decompressors may read
+	// ahead in their own goroutines (e.g. zstd).
+	mu       sync.Mutex
+	fn       func(Progress)
+	p        Progress
+	reported int64
+	finished bool
+}
+
+// track returns the op with the progress tracker, and the input counting
+// the bytes read. It is no-op when no progress is requested, or the op is
+// already tracked (e.g. by the decompressing format).
+func (op Op) track(input io.Reader) (Op, io.Reader) {
+	if op.progress == nil || op.tracker != nil {
+		return op, input
+	}
+	op.tracker = &tracker{fn: op.progress, p: Progress{Total: op.total}}
+	return op, &trackReader{r: input, t: op.tracker}
+}
+
+// setArchive sets the total of the progress, and the identity
+// of the archive to resume (see 'WithResume') on Open.
+func (op *Op) setArchive(f *os.File) {
+	if op.progress == nil && !op.resume {
+		return
+	}
+	if fi, err := f.Stat(); err == nil {
+		op.total = fi.Size()
+		op.archive = archiveID(fi)
+	}
+}
+
+func (t *tracker) file(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.File = name
+	t.p.Files++
+	t.report()
+}
+
+func (t *tracker) add(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Bytes += n
+	if t.p.Bytes-t.reported >= progressInterval {
+		t.report()
+	}
+}
+
+// done reports the final progress.
+func (t *tracker) done() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.p.Total > 0 && t.p.Bytes < t.p.Total {
+		// e.g. tar padding not read by the reader
+		t.p.Bytes = t.p.Total
+	}
+	t.report()
+	t.finished = true
+}
+
+// report must be called with 'mu' held.
+func (t *tracker) report() {
+	if t.finished {
+		// e.g. read-ahead after the last entry
+		return
+	}
+	t.reported = t.p.Bytes
+	t.fn(t.p)
+}
+
+type trackReader struct {
+	r io.Reader
+	t *tracker
+}
+
+func (r *trackReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.add(int64(n))
+	return n, err
+}
+
+// trackSources returns the op with the progress tracker, whose total is
+// the size of the regular files under the sources.
+func (op Op) trackSources(sources []string) Op {
+	if op.progress == nil || op.tracker != nil {
+		return op
+	}
+	var total int64
+	for _, src := range sources {
+		filepath.Walk(src, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	op.tracker = &tracker{fn: op.progress, p: Progress{Total: total}}
+	return op
+}
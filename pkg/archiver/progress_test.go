@@ -0,0 +1,69 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "dogscats")
+	writeFiles(t, src, map[string]string{
+		"cat.jpg": "cat",
+		"dog.jpg": "dog",
+		// reported within the file
+		"large.bin": strings.Repeat("x", 2*progressInterval+1),
+	})
+	var size int64 = 3 + 3 + 2*progressInterval + 1
+
+	for _, format := range []Archiver{Zip, TarGz, TarZst} {
+		fpath := filepath.Join(dir, "dogscats.archive")
+		var ps []Progress
+		if err := format.Make(fpath, []string{src}, WithProgress(func(p Progress) { ps = append(ps, p) })); err != nil {
+			t.Fatal(err)
+		}
+		checkProgress(t, "Make", ps, 3, size, size, true)
+
+		fi, err := os.Stat(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := fi.Size()
+		if format == Zip {
+			// zip counts the file contents
+			total = size
+		}
+		ps = nil
+		if err = format.Open(fpath, filepath.Join(dir, "out"), WithProgress(func(p Progress) { ps = append(ps, p) })); err != nil {
+			t.Fatal(err)
+		}
+		// compressed tarballs are smaller than progressInterval
+		checkProgress(t, "Open", ps, 3, total, total, format == Zip)
+
+		os.Remove(fpath)
+		os.RemoveAll(filepath.Join(dir, "out"))
+	}
+}
+
+func checkProgress(t *testing.T, name string, ps []Progress, files int, bytes, total int64, within bool) {
+	if len(ps) == 0 {
+		t.Fatalf("%s: no progress reported", name)
+	}
+	for i := 1; i < len(ps); i++ {
+		if ps[i].Files < ps[i-1].Files || ps[i].Bytes < ps[i-1].Bytes {
+			t.Fatalf("%s: progress went backwards %+v -> %+v", name, ps[i-1], ps[i])
+		}
+	}
+	last := ps[len(ps)-1]
+	if last.Files != files || last.Bytes != bytes || last.Total != total {
+		t.Fatalf("%s: expected %d files and %d/%d bytes, got %+v", name, files, bytes, total, last)
+	}
+	// 'large.bin' is reported every progressInterval
+	if within && len(ps) < files+2 {
+		t.Fatalf("%s: expected reports within large files, got %+v", name, ps)
+	}
+}
@@ -62,10 +62,17 @@ func (rarFormat) Make(rarPath string, filePaths []string, opts ...OpOption) erro
 // Read extracts the RAR file read from input and puts the contents
 // into destination.
 func (rarFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	rr, err := rardecode.NewReader(input, "")
 	if err != nil {
 		return fmt.Errorf("read: failed to create reader: %v", err)
 	}
+	v := newVerifier()
+	j, err := op.openJournal(destination)
+	if err != nil {
+		return err
+	}
+	defer j.close(false)
 
 	for {
 		header, err := rr.Next()
@@ -75,28 +82,57 @@ func (rarFormat) Read(input io.Reader, destination string, op Op) error {
 			return err
 		}
 
+		ok, err := op.match(header.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		skip, err := j.skip(destination, header.Name, v)
+		if err != nil {
+			return err
+		}
+		if skip {
+			continue
+		}
+		fpath, err := safePath(destination, header.Name)
+		if err != nil {
+			return err
+		}
 		if header.IsDir {
-			err = mkdir(filepath.Join(destination, header.Name))
+			err = mkdir(fpath)
 			if err != nil {
 				return err
 			}
+			if err = j.record(header.Name, v); err != nil {
+				return err
+			}
 			continue
 		}
+		if err = checkMode(header.Name, header.Mode()); err != nil {
+			return err
+		}
 
 		// if files come before their containing folders, then we must
 		// create their folders before writing the file
-		err = mkdir(filepath.Dir(filepath.Join(destination, header.Name)))
+		err = mkdir(filepath.Dir(fpath))
 		if err != nil {
 			return err
 		}
 
-		err = writeNewFile(filepath.Join(destination, header.Name), rr, header.Mode())
+		op.tracker.file(header.Name)
+		err = writeNewFile(fpath, v.reader(header.Name, rr), header.Mode())
 		if err != nil {
 			return err
 		}
+		if err = j.record(header.Name, v); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	op.tracker.done()
+	return j.close(true)
 }
 
 // Open extracts the RAR file at source and puts the contents
@@ -110,6 +146,37 @@ func (rarFormat) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open file: %v", source, err)
 	}
 	defer rf.Close()
+	ret.setArchive(rf)
 
 	return Rar.Read(rf, destination, ret)
 }
+
+// List returns the entries of the RAR file at source.
+func (rarFormat) List(source string) ([]Entry, error) {
+	rf, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open file: %v", source, err)
+	}
+	defer rf.Close()
+
+	rr, err := rardecode.NewReader(rf, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to create reader: %v", source, err)
+	}
+	var entries []Entry
+	for {
+		header, err := rr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{
+			Name:    header.Name,
+			Size:    header.UnPackedSize,
+			Mode:    header.Mode(),
+			ModTime: header.ModificationTime,
+		})
+	}
+	return entries, nil
+}
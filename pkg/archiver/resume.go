@@ -0,0 +1,151 @@
+package archiver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// JournalName is the name of the journal of the extracted entries in the
+// destination, removed when the extraction completes (i.e. the destination
+// with the journal has the interrupted extraction to resume).
+const JournalName = ".archiver.resume"
+
+// journal records the extracted entries to resume (see 'WithResume'),
+// one line per entry with the SHA-256 of the regular file, or "-".
+// All methods are no-op on nil journal.
+type journal struct {
+	f    *os.File
+	done map[string]string
+}
+
+// archiveID returns the identity of the archive file in the journal.
+func archiveID(fi os.FileInfo) string {
+	return fmt.Sprintf("%d %d", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// openJournal returns the journal in the destination, with the entries
+// recorded for the same archive, or nil when not resuming.
+func (op Op) openJournal(destination string) (*journal, error) {
+	if !op.resume {
+		return nil, nil
+	}
+	if err := mkdir(destination); err != nil {
+		return nil, err
+	}
+	fpath := filepath.Join(destination, JournalName)
+	header := "# " + op.archive
+
+	j := &journal{done: make(map[string]string)}
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if lines[0] == header {
+		// the last line is empty, or torn by the interruption
+		for _, line := range lines[1 : len(lines)-1] {
+			fields := strings.SplitN(line, "  ", 2)
+			if len(fields) == 2 && (fields[0] == "-" || len(fields[0]) == sha256.Size*2) {
+				j.done[fields[1]] = fields[0]
+			}
+		}
+	}
+
+	// rewritten without the torn line
+	if j.f, err = os.Create(fpath); err != nil {
+		return nil, fmt.Errorf("%s: %v", fpath, err)
+	}
+	fmt.Fprintln(j.f, header)
+	for name, sum := range j.done {
+		fmt.Fprintf(j.f, "%s  %s\n", sum, name)
+	}
+	return j, nil
+}
+
+// skip returns true if the entry was extracted before the interruption,
+// and the regular file is intact (its digest is added to the verifier).
+func (j *journal) skip(destination, name string, v *verifier) (bool, error) {
+	if j == nil {
+		return false, nil
+	}
+	name = manifestEntryName(name)
+	sum, ok := j.done[name]
+	if !ok {
+		return false, nil
+	}
+	fpath, err := safePath(destination, name)
+	if err != nil {
+		return false, err
+	}
+	if sum == "-" {
+		_, err = os.Lstat(fpath)
+		return err == nil, nil
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+	if _, err = io.Copy(ioutil.Discard, v.reader(name, f)); err != nil {
+		return false, nil
+	}
+	return v.sum(name) == sum, nil
+}
+
+// clear removes the link extracted but not recorded before the
+// interruption, since links are not overwritten.
+func (j *journal) clear(destination, name string) error {
+	if j == nil {
+		return nil
+	}
+	name = strings.TrimSuffix(manifestEntryName(name), "/")
+	dir, err := safePath(destination, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	fpath := filepath.Join(dir, path.Base(name))
+	if fi, err := os.Lstat(fpath); err == nil && !fi.IsDir() {
+		return os.Remove(fpath)
+	}
+	return nil
+}
+
+// record records the extracted entry.
+func (j *journal) record(name string, v *verifier) error {
+	if j == nil {
+		return nil
+	}
+	name = manifestEntryName(name)
+	if strings.Contains(name, "\n") {
+		// not resumable, extracted again on retry
+		return nil
+	}
+	if _, err := fmt.Fprintf(j.f, "%s  %s\n", v.sum(name), name); err != nil {
+		return fmt.Errorf("%s: %v", j.f.Name(), err)
+	}
+	return nil
+}
+
+// close closes the journal, and removes it if the extraction completed.
+// It is no-op if already closed.
+func (j *journal) close(completed bool) error {
+	if j == nil || j.f == nil {
+		return nil
+	}
+	f := j.f
+	j.f = nil
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if completed {
+		return os.Remove(f.Name())
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package archiver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// openInterrupted extracts the archive, interrupted when starting
+// the n-th file.
+func openInterrupted(format Archiver, source, destination string, n int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(error)
+		}
+	}()
+	return format.Open(source, destination, WithResume(), WithProgress(func(p Progress) {
+		if p.Files == n {
+			panic(errInterrupted)
+		}
+	}))
+}
+
+func TestWithResume(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "cats")
+	expected := map[string]string{
+		"cats/a.jpg": "cat a",
+		"cats/b.jpg": "cat b",
+		"cats/c.jpg": "cat c",
+	}
+	writeFiles(t, dir, expected)
+
+	for _, format := range []Archiver{Zip, TarGz} {
+		fpath := filepath.Join(dir, "cats.archive")
+		if err := format.Make(fpath, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "out")
+		if err := openInterrupted(format, fpath, dst, 3); err != errInterrupted {
+			t.Fatalf("%T: expected %v, got %v", format, errInterrupted, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, JournalName)); err != nil {
+			t.Fatalf("%T: expected journal after interruption, got %v", format, err)
+		}
+		// changed after the interruption, extracted again
+		if err := ioutil.WriteFile(filepath.Join(dst, "cats", "a.jpg"), []byte("corrupted"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var extracted []string
+		err := format.Open(fpath, dst, WithResume(), WithProgress(func(p Progress) {
+			if len(extracted) < p.Files {
+				extracted = append(extracted, p.File)
+			}
+		}))
+		if err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		if exp := []string{"cats/a.jpg", "cats/c.jpg"}; !reflect.DeepEqual(extracted, exp) {
+			t.Fatalf("%T: expected %v extracted on resume, got %v", format, exp, extracted)
+		}
+		// the journal is removed on completion
+		checkFiles(t, dst, expected)
+		os.RemoveAll(dst)
+
+		// the journal of another archive is discarded
+		writeFiles(t, dst, map[string]string{
+			JournalName:  "# 1 2\n-  cats\n-  cats/a.jpg\n",
+			"cats/a.jpg": "stale",
+		})
+		if err := format.Open(fpath, dst, WithResume()); err != nil {
+			t.Fatalf("%T: %v", format, err)
+		}
+		checkFiles(t, dst, expected)
+		os.RemoveAll(dst)
+	}
+}
@@ -0,0 +1,84 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Archives may come from untrusted sources (e.g. user uploads), so the
+// entries are extracted only under the destination ("zip slip"), and the
+// entries with dangerous modes are rejected.
+
+// safePath returns the path of the archive entry under the destination,
+// or an error if it escapes the destination, lexically (e.g. "../x",
+// absolute paths) or through the symlinks already extracted.
+func safePath(destination, name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("%q: invalid entry name", name)
+	}
+	p := filepath.FromSlash(name)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" || strings.HasPrefix(p, string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: absolute path is not allowed", name)
+	}
+	destination = filepath.Clean(destination)
+	fpath := filepath.Join(destination, p)
+	if !within(destination, fpath) {
+		return "", fmt.Errorf("%s: path escapes the destination %s", name, destination)
+	}
+
+	realDest, err := filepath.EvalSymlinks(destination)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// nothing extracted yet
+			return fpath, nil
+		}
+		return "", err
+	}
+	// the rest of the path is created under the longest existing prefix
+	existing := fpath
+	for existing != destination {
+		if _, err = os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil || !within(realDest, real) {
+		return "", fmt.Errorf("%s: path escapes the destination %s through symlink", name, destination)
+	}
+	return fpath, nil
+}
+
+// checkLinkTarget rejects the symlink whose target is outside the destination.
+func checkLinkTarget(destination, linkPath, target string) error {
+	t := filepath.FromSlash(target)
+	if filepath.IsAbs(t) || filepath.VolumeName(t) != "" {
+		return fmt.Errorf("%s: absolute symlink target %q is not allowed", linkPath, target)
+	}
+	if !within(filepath.Clean(destination), filepath.Join(filepath.Dir(linkPath), t)) {
+		return fmt.Errorf("%s: symlink target %q escapes the destination %s", linkPath, target, destination)
+	}
+	return nil
+}
+
+// checkMode rejects the setuid, setgid, and special files (e.g. device nodes).
+func checkMode(name string, mode os.FileMode) error {
+	if mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		return fmt.Errorf("%s: setuid/setgid mode %v is not allowed", name, mode)
+	}
+	if mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0 {
+		return fmt.Errorf("%s: special file mode %v is not allowed", name, mode)
+	}
+	return nil
+}
+
+// within returns true if the cleaned path is the root or under the root.
+func within(root, fpath string) bool {
+	rel, err := filepath.Rel(root, fpath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,161 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typ      byte
+	linkname string
+	mode     int64
+	data     string
+}
+
+func makeTar(t *testing.T, entries ...tarEntry) []byte {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		typ, mode := e.typ, e.mode
+		if typ == 0 {
+			typ = tar.TypeReg
+		}
+		if mode == 0 {
+			mode = 0644
+		}
+		h := &tar.Header{Name: e.name, Typeflag: typ, Linkname: e.linkname, Mode: mode, Size: int64(len(e.data))}
+		if typ != tar.TypeReg {
+			h.Size = 0
+		}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			if _, err := w.Write([]byte(e.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent", []tarEntry{{name: "../evil.txt", data: "evil"}}},
+		{"nested parent", []tarEntry{{name: "a/../../evil.txt", data: "evil"}}},
+		{"absolute", []tarEntry{{name: "/tmp/evil.txt", data: "evil"}}},
+		{"symlink absolute target", []tarEntry{{name: "link", typ: tar.TypeSymlink, linkname: "/etc"}}},
+		{"symlink escaping target", []tarEntry{{name: "a/link", typ: tar.TypeSymlink, linkname: "../../outside"}}},
+		{"hardlink escaping target", []tarEntry{{name: "passwd", typ: tar.TypeLink, linkname: "../outside/secret.txt"}}},
+		{"hardlink absolute target", []tarEntry{{name: "passwd", typ: tar.TypeLink, linkname: "/etc/passwd"}}},
+		{"setuid", []tarEntry{{name: "bin/sh", mode: 04755, data: "#!/bin/sh"}}},
+		{"setgid", []tarEntry{{name: "bin/sh", mode: 02755, data: "#!/bin/sh"}}},
+		{"device", []tarEntry{{name: "dev/sda", typ: tar.TypeBlock}}},
+		{"fifo", []tarEntry{{name: "fifo", typ: tar.TypeFifo}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			outside := filepath.Join(dir, "outside")
+			writeFiles(t, outside, map[string]string{"secret.txt": "secret"})
+
+			dst := filepath.Join(dir, "out")
+			if err := Tar.Read(bytes.NewReader(makeTar(t, tt.entries...)), dst, Op{}); err == nil {
+				t.Fatal("expected error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+				t.Fatalf("entry written outside the destination (%v)", err)
+			}
+			checkFiles(t, outside, map[string]string{"secret.txt": "secret"})
+		})
+	}
+}
+
+func TestTarSymlinkOnDisk(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	outside := filepath.Join(dir, "outside")
+	writeFiles(t, outside, map[string]string{"secret.txt": "secret"})
+
+	// symlink left by a previous extraction, or made by another process
+	dst := filepath.Join(dir, "out")
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dst, "data")); err != nil {
+		t.Fatal(err)
+	}
+	err := Tar.Read(bytes.NewReader(makeTar(t, tarEntry{name: "data/secret.txt", data: "overwritten"})), dst, Op{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	checkFiles(t, outside, map[string]string{"secret.txt": "secret"})
+}
+
+func TestTarSafeLinks(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "out")
+	err := Tar.Read(bytes.NewReader(makeTar(t,
+		tarEntry{name: "train/cat.jpg", data: "cat"},
+		tarEntry{name: "valid/cat.jpg", typ: tar.TypeLink, linkname: "train/cat.jpg"},
+		tarEntry{name: "latest", typ: tar.TypeSymlink, linkname: "train"},
+		tarEntry{name: "run.sh", mode: 0755, data: "#!/bin/sh"},
+	)), dst, Op{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dst, map[string]string{
+		"train/cat.jpg": "cat",
+		"valid/cat.jpg": "cat",
+		"run.sh":        "#!/bin/sh",
+	})
+	if target, err := os.Readlink(filepath.Join(dst, "latest")); err != nil || target != "train" {
+		t.Fatalf("unexpected symlink %q (%v)", target, err)
+	}
+}
+
+func TestZipUnsafeEntries(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "/tmp/evil.txt", `..\evil.txt`} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		fpath := filepath.Join(dir, "evil.zip")
+		f, err := os.Create(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := zip.NewWriter(f)
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write([]byte("evil")); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		if err = Zip.Open(fpath, filepath.Join(dir, "out")); err == nil {
+			t.Fatalf("%q: expected error", name)
+		}
+		if _, err = os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+			t.Fatalf("%q: entry written outside the destination (%v)", name, err)
+		}
+	}
+}
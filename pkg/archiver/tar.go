@@ -5,10 +5,12 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 )
@@ -118,21 +120,41 @@ func writeTar(filePaths []string, output io.Writer, dest string, op Op) error {
 // tarball writes all files listed in filePaths into tarWriter, which is
 // writing into a file located at dest.
 func tarball(filePaths []string, tarWriter *tar.Writer, dest string, op Op) error {
+	op = op.trackSources(filePaths)
+	if op.manifest {
+		op.sums = &manifest{}
+	}
 	for _, fpath := range filePaths {
 		if op.verbose {
 			glog.Infof("tar %q", fpath)
 		}
-		err := tarFile(tarWriter, fpath, dest)
+		err := tarFile(tarWriter, fpath, dest, op)
 		if err != nil {
 			return err
 		}
 	}
+	if op.sums != nil {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     ManifestName,
+			Mode:     0644,
+			Size:     int64(op.sums.buf.Len()),
+			ModTime:  time.Now(),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: writing header: %v", ManifestName, err)
+		}
+		if _, err = op.sums.buf.WriteTo(tarWriter); err != nil {
+			return fmt.Errorf("%s: writing: %v", ManifestName, err)
+		}
+	}
+	op.tracker.done()
 	return nil
 }
 
 // tarFile writes the file at source into tarWriter. It does so
 // recursively for directories.
-func tarFile(tarWriter *tar.Writer, source, dest string) error {
+func tarFile(tarWriter *tar.Writer, source, dest string, op Op) error {
 	sourceInfo, err := os.Stat(source)
 	if err != nil {
 		return fmt.Errorf("%s: stat: %v", source, err)
@@ -148,7 +170,13 @@ func tarFile(tarWriter *tar.Writer, source, dest string) error {
 			return fmt.Errorf("error walking to %s: %v", path, err)
 		}
 
-		header, err := tar.FileInfoHeader(info, path)
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return fmt.Errorf("%s: reading symlink: %v", path, err)
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
 		if err != nil {
 			return fmt.Errorf("%s: making header: %v", path, err)
 		}
@@ -176,24 +204,40 @@ func tarFile(tarWriter *tar.Writer, source, dest string) error {
 		}
 
 		if header.Typeflag == tar.TypeReg {
-			file, err := os.Open(path)
-			if err != nil {
-				return fmt.Errorf("%s: open: %v", path, err)
+			if op.sums != nil && isManifest(header.Name) {
+				return fmt.Errorf("%s: conflicts with the manifest %s", path, ManifestName)
 			}
-			defer file.Close()
-
-			_, err = io.CopyN(tarWriter, file, info.Size())
-			if err != nil && err != io.EOF {
-				return fmt.Errorf("%s: copying contents: %v", path, err)
+			op.tracker.file(header.Name)
+			w, record := op.sums.hash(header.Name, tarWriter)
+			if err = tarCopy(w, path, info.Size(), op.tracker); err != nil {
+				return err
 			}
+			record()
 		}
 		return nil
 	})
 }
 
+// tarCopy copies the file contents, closing the file before
+// walking to the next one.
+func tarCopy(w io.Writer, path string, size int64, t *tracker) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: open: %v", path, err)
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(w, &trackReader{r: file, t: t}, size)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("%s: copying contents: %v", path, err)
+	}
+	return nil
+}
+
 // Read untars a .tar file read from a Reader and puts
 // the contents into destination.
 func (tarFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	return untar(tar.NewReader(input), destination, op)
 }
 
@@ -207,12 +251,20 @@ func (tarFormat) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return Tar.Read(f, destination, ret)
 }
 
 // untar un-tarballs the contents of tr into destination.
 func untar(tr *tar.Reader, destination string, op Op) error {
+	v := newVerifier()
+	j, err := op.openJournal(destination)
+	if err != nil {
+		return err
+	}
+	defer j.close(false)
+
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -221,28 +273,94 @@ func untar(tr *tar.Reader, destination string, op Op) error {
 			return err
 		}
 
+		isReg := header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA
+		var r io.Reader = tr
+		if isReg && isManifest(header.Name) {
+			// read even if not extracted, to verify the matched files
+			if r, err = v.readManifest(tr); err != nil {
+				return err
+			}
+		}
+		ok, err := op.match(header.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		skip, err := j.skip(destination, header.Name, v)
+		if err != nil {
+			return err
+		}
+		if skip {
+			if op.verbose {
+				glog.Infof("skipping %q (already extracted)", header.Name)
+			}
+			continue
+		}
 		if op.verbose {
 			glog.Infof("untar %q", header.Name)
 		}
-		if err := untarFile(tr, header, destination); err != nil {
+		if isReg {
+			op.tracker.file(header.Name)
+			r = v.reader(header.Name, r)
+		}
+		if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+			if err = j.clear(destination, header.Name); err != nil {
+				return err
+			}
+		}
+		if err = untarFile(r, header, destination); err != nil {
+			return err
+		}
+		if err = j.record(header.Name, v); err != nil {
 			return err
 		}
 	}
-	return nil
+	op.tracker.done()
+	// removed even if the verification fails, not to skip
+	// the corrupted files on retry
+	if err = j.close(true); err != nil {
+		return err
+	}
+	return v.verify(op)
 }
 
-// untarFile untars a single file from tr with header header into destination.
-func untarFile(tr *tar.Reader, header *tar.Header, destination string) error {
+// untarFile untars a single file from r with header header into destination.
+// Device nodes and FIFOs are rejected (see 'checkMode').
+func untarFile(r io.Reader, header *tar.Header, destination string) error {
+	fpath, err := safePath(destination, header.Name)
+	if err != nil {
+		return err
+	}
+	if err = checkMode(header.Name, header.FileInfo().Mode()); err != nil {
+		return err
+	}
+
 	switch header.Typeflag {
 	case tar.TypeDir:
-		return mkdir(filepath.Join(destination, header.Name))
-	case tar.TypeReg, tar.TypeRegA, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
-		return writeNewFile(filepath.Join(destination, header.Name), tr, header.FileInfo().Mode())
+		return mkdir(fpath)
+	case tar.TypeReg, tar.TypeRegA:
+		return writeNewFile(fpath, r, header.FileInfo().Mode())
 	case tar.TypeSymlink:
-		return writeNewSymbolicLink(filepath.Join(destination, header.Name), header.Linkname)
+		if err = checkLinkTarget(destination, fpath, header.Linkname); err != nil {
+			return err
+		}
+		return writeNewSymbolicLink(fpath, header.Linkname)
 	case tar.TypeLink:
-		return writeNewHardLink(filepath.Join(destination, header.Name), filepath.Join(destination, header.Linkname))
+		target, err := safePath(destination, header.Linkname)
+		if err != nil {
+			return err
+		}
+		return writeNewHardLink(fpath, target)
 	default:
 		return fmt.Errorf("%s: unknown type flag: %c", header.Name, header.Typeflag)
 	}
 }
+
+// List returns the entries of the .tar file at source.
+func (tarFormat) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	})
+}
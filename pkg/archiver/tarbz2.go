@@ -76,6 +76,20 @@ func (tarBz2Format) Make(tarbz2Path string, filePaths []string, opts ...OpOption
 }
 
 func writeTarBz2(filePaths []string, output io.Writer, dest string, op Op) error {
+	if op.concurrency > 1 {
+		pw := newParallelWriter(output, op.concurrency, parallelBlockSize, func(w io.Writer) (io.WriteCloser, error) {
+			return bzip2.NewWriter(w, nil)
+		})
+		if err := writeTar(filePaths, pw, dest, op); err != nil {
+			pw.Close()
+			return err
+		}
+		if err := pw.Close(); err != nil {
+			return fmt.Errorf("error compressing bzip2: %v", err)
+		}
+		return nil
+	}
+
 	bz2w, err := bzip2.NewWriter(output, nil)
 	if err != nil {
 		return fmt.Errorf("error compressing bzip2: %v", err)
@@ -88,6 +102,7 @@ func writeTarBz2(filePaths []string, output io.Writer, dest string, op Op) error
 // Read untars a .tar.bz2 file read from a Reader and decompresses
 // the contents into destination.
 func (tarBz2Format) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	bz2r, err := bzip2.NewReader(input, nil)
 	if err != nil {
 		return fmt.Errorf("error decompressing bzip2: %v", err)
@@ -107,6 +122,14 @@ func (tarBz2Format) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return TarBz2.Read(f, destination, ret)
 }
+
+// List returns the entries of the .tar.bz2 file at source.
+func (tarBz2Format) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		return bzip2.NewReader(r, nil)
+	})
+}
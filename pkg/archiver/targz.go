@@ -71,6 +71,17 @@ func (tarGzFormat) Make(targzPath string, filePaths []string, opts ...OpOption)
 }
 
 func writeTarGz(filePaths []string, output io.Writer, dest string, op Op) error {
+	if op.concurrency > 1 {
+		pw := newParallelWriter(output, op.concurrency, parallelBlockSize, func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		})
+		if err := writeTar(filePaths, pw, dest, op); err != nil {
+			pw.Close()
+			return err
+		}
+		return pw.Close()
+	}
+
 	gzw := gzip.NewWriter(output)
 	defer gzw.Close()
 
@@ -80,6 +91,7 @@ func writeTarGz(filePaths []string, output io.Writer, dest string, op Op) error
 // Read untars a .tar.gz file read from a Reader and decompresses
 // the contents into destination.
 func (tarGzFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	gzr, err := gzip.NewReader(input)
 	if err != nil {
 		return fmt.Errorf("error decompressing: %v", err)
@@ -99,6 +111,14 @@ func (tarGzFormat) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return TarGz.Read(f, destination, ret)
 }
+
+// List returns the entries of the .tar.gz file at source.
+func (tarGzFormat) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	})
+}
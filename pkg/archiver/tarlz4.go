@@ -3,6 +3,7 @@ package archiver
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -78,6 +79,7 @@ func writeTarLz4(filePaths []string, output io.Writer, dest string, op Op) error
 // Read untars a .tar.xz file read from a Reader and decompresses
 // the contents into destination.
 func (tarLz4Format) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	lz4r := lz4.NewReader(input)
 
 	return Tar.Read(lz4r, destination, op)
@@ -93,6 +95,14 @@ func (tarLz4Format) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return TarLz4.Read(f, destination, ret)
 }
+
+// List returns the entries of the .tar.lz4 file at source.
+func (tarLz4Format) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(lz4.NewReader(r)), nil
+	})
+}
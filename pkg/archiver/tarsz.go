@@ -3,6 +3,7 @@ package archiver
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -78,6 +79,7 @@ func writeTarSz(filePaths []string, output io.Writer, dest string, op Op) error
 // Read untars a .tar.sz file read from a Reader and decompresses
 // the contents into destination.
 func (tarSzFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	szr := snappy.NewReader(input)
 
 	return Tar.Read(szr, destination, op)
@@ -93,6 +95,14 @@ func (tarSzFormat) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return TarSz.Read(f, destination, ret)
 }
+
+// List returns the entries of the .tar.sz file at source.
+func (tarSzFormat) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(snappy.NewReader(r)), nil
+	})
+}
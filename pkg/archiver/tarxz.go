@@ -3,6 +3,7 @@ package archiver
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -88,6 +89,7 @@ func writeTarXZ(filePaths []string, output io.Writer, dest string, op Op) error
 // Read untars a .tar.xz file read from a Reader and decompresses
 // the contents into destination.
 func (xzFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
 	xzr, err := xz.NewReader(input)
 	if err != nil {
 		return fmt.Errorf("error decompressing xz: %v", err)
@@ -106,6 +108,18 @@ func (xzFormat) Open(source, destination string, opts ...OpOption) error {
 		return fmt.Errorf("%s: failed to open archive: %v", source, err)
 	}
 	defer f.Close()
+	ret.setArchive(f)
 
 	return TarXZ.Read(f, destination, ret)
 }
+
+// List returns the entries of the .tar.xz file at source.
+func (xzFormat) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		xzr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xzr), nil
+	})
+}
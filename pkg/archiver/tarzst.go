@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TarZst is for TarZst format
+var TarZst tarZstFormat
+
+func init() {
+	RegisterFormat("TarZst", TarZst)
+}
+
+type tarZstFormat struct{}
+
+func (tarZstFormat) Match(filename string) bool {
+	return strings.HasSuffix(strings.ToLower(filename), ".tar.zst") ||
+		strings.HasSuffix(strings.ToLower(filename), ".tzst") ||
+		isTarZst(filename)
+}
+
+// zstdMagic is the magic number of the zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// isTarZst checks the file has the zstd compressed Tar format header by
+// reading its beginning block.
+func isTarZst(tarzstPath string) bool {
+	f, err := os.Open(tarzstPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(zstdMagic))
+	if _, err = io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, zstdMagic) {
+		return false
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+
+	zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return false
+	}
+	defer zr.Close()
+
+	buf := make([]byte, tarBlockSize)
+	if _, err = io.ReadFull(zr, buf); err != nil {
+		return false
+	}
+
+	return hasTarHeader(buf)
+}
+
+// Write outputs a .tar.zst file to a Writer containing
+// the contents of files listed in filePaths. File paths
+// can be those of regular files or directories. Regular
+// files are stored at the 'root' of the archive, and
+// directories are recursively added.
+func (tarZstFormat) Write(output io.Writer, filePaths []string, op Op) error {
+	return writeTarZst(filePaths, output, "", op)
+}
+
+// Make creates a .tar.zst file at tarzstPath containing
+// the contents of files listed in filePaths. File paths
+// can be those of regular files or directories. Regular
+// files are stored at the 'root' of the archive, and
+// directories are recursively added.
+func (tarZstFormat) Make(tarzstPath string, filePaths []string, opts ...OpOption) error {
+	ret := Op{verbose: false}
+	ret.applyOpts(opts)
+
+	out, err := os.Create(tarzstPath)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", tarzstPath, err)
+	}
+	defer out.Close()
+
+	return writeTarZst(filePaths, out, tarzstPath, ret)
+}
+
+func writeTarZst(filePaths []string, output io.Writer, dest string, op Op) error {
+	var zopts []zstd.EOption
+	if op.concurrency > 0 {
+		zopts = append(zopts, zstd.WithEncoderConcurrency(op.concurrency))
+	}
+	zw, err := zstd.NewWriter(output, zopts...)
+	if err != nil {
+		return fmt.Errorf("error compressing zstd: %v", err)
+	}
+	if err = writeTar(filePaths, zw, dest, op); err != nil {
+		zw.Close()
+		return err
+	}
+	// flushes the last frame
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("error compressing zstd: %v", err)
+	}
+	return nil
+}
+
+// Read untars a .tar.zst file read from a Reader and decompresses
+// the contents into destination.
+func (tarZstFormat) Read(input io.Reader, destination string, op Op) error {
+	op, input = op.track(input)
+	zr, err := zstd.NewReader(input)
+	if err != nil {
+		return fmt.Errorf("error decompressing zstd: %v", err)
+	}
+	defer zr.Close()
+
+	return Tar.Read(zr, destination, op)
+}
+
+// Open untars source and decompresses the contents into destination.
+func (tarZstFormat) Open(source, destination string, opts ...OpOption) error {
+	ret := Op{verbose: false}
+	ret.applyOpts(opts)
+
+	f, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("%s: failed to open archive: %v", source, err)
+	}
+	defer f.Close()
+	ret.setArchive(f)
+
+	return TarZst.Read(f, destination, ret)
+}
+
+// List returns the entries of the .tar.zst file at source.
+func (tarZstFormat) List(source string) ([]Entry, error) {
+	return listTar(source, func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	})
+}
@@ -0,0 +1,46 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarZst(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"train/cats/cat.1.jpg": "cat",
+		"train/dogs/dog.1.jpg": "dog",
+		"labels.txt":           "cat\ndog\n",
+	}
+	src := filepath.Join(dir, "dogscats")
+	writeFiles(t, src, files)
+	fpath := filepath.Join(dir, "dogscats.tar.zst")
+	if err := TarZst.Make(fpath, []string{src}); err != nil {
+		t.Fatal(err)
+	}
+
+	// detected by the contents, without the extension
+	renamed := filepath.Join(dir, "dogscats.bin")
+	if err := os.Rename(fpath, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if !isTarZst(renamed) || MatchingFormat(renamed) != TarZst {
+		t.Fatalf("%q does not match tar.zst", renamed)
+	}
+	if isTarZst(filepath.Join(src, "labels.txt")) {
+		t.Fatal("text file matches tar.zst")
+	}
+
+	dst := filepath.Join(dir, "out")
+	if err := TarZst.Open(renamed, dst); err != nil {
+		t.Fatal(err)
+	}
+	expected := make(map[string]string)
+	for name, data := range files {
+		expected["dogscats/"+name] = data
+	}
+	checkFiles(t, dst, expected)
+}
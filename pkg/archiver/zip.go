@@ -1,5 +1,3 @@
-// Package archiver makes it super easy to create and open .zip,
-// .tar.gz, and .tar.bz2 files.
 package archiver
 
 import (
@@ -12,6 +10,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 )
@@ -56,6 +55,10 @@ func isZip(zipPath string) bool {
 // compressed will be stored only, not compressed.
 func (zipFormat) Write(output io.Writer, filePaths []string, op Op) error {
 	w := zip.NewWriter(output)
+	op = op.trackSources(filePaths)
+	if op.manifest {
+		op.sums = &manifest{}
+	}
 	for _, fpath := range filePaths {
 		if op.verbose {
 			glog.Infof("zipping %q", fpath)
@@ -65,7 +68,21 @@ func (zipFormat) Write(output io.Writer, filePaths []string, op Op) error {
 			return err
 		}
 	}
+	if op.sums != nil {
+		header := &zip.FileHeader{Name: ManifestName, Method: zip.Deflate}
+		header.SetModTime(time.Now())
+		header.SetMode(0644)
+		mw, err := w.CreateHeader(header)
+		if err == nil {
+			_, err = op.sums.buf.WriteTo(mw)
+		}
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("%s: writing: %v", ManifestName, err)
+		}
+	}
 
+	op.tracker.done()
 	return w.Close()
 }
 
@@ -102,13 +119,14 @@ func zipFile(w *zip.Writer, source string, op Op) error {
 	}
 
 	return filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
-		if op.directoryToIgnore != "" {
-			if strings.HasPrefix(fpath, op.directoryToIgnore) {
-				if op.verbose {
-					glog.Infof("walk: skipping %q (ignore %q)", fpath, op.directoryToIgnore)
-					return nil
-				}
+		if op.directoryToIgnore != "" && strings.HasPrefix(fpath, op.directoryToIgnore) {
+			if op.verbose {
+				glog.Infof("walk: skipping %q (ignore %q)", fpath, op.directoryToIgnore)
+			}
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 		if op.verbose {
 			glog.Infof("walk: zipping %q", fpath)
@@ -152,22 +170,37 @@ func zipFile(w *zip.Writer, source string, op Op) error {
 		}
 
 		if header.Mode().IsRegular() {
-			file, err := os.Open(fpath)
-			if err != nil {
-				return fmt.Errorf("%s: opening: %v", fpath, err)
+			if op.sums != nil && isManifest(header.Name) {
+				return fmt.Errorf("%s: conflicts with the manifest %s", fpath, ManifestName)
 			}
-			defer file.Close()
-
-			_, err = io.CopyN(writer, file, info.Size())
-			if err != nil && err != io.EOF {
-				return fmt.Errorf("%s: copying contents: %v", fpath, err)
+			op.tracker.file(header.Name)
+			w, record := op.sums.hash(header.Name, writer)
+			if err = zipCopy(w, fpath, info.Size(), op.tracker); err != nil {
+				return err
 			}
+			record()
 		}
 
 		return nil
 	})
 }
 
+// zipCopy copies the file contents, closing the file before
+// walking to the next one (datasets often have many files).
+func zipCopy(w io.Writer, fpath string, size int64, t *tracker) error {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("%s: opening: %v", fpath, err)
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(w, &trackReader{r: file, t: t}, size)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("%s: copying contents: %v", fpath, err)
+	}
+	return nil
+}
+
 // Read unzips the .zip file read from the input Reader into destination.
 func (zipFormat) Read(input io.Reader, destination string, op Op) error {
 	buf, err := ioutil.ReadAll(input)
@@ -189,6 +222,14 @@ func (zipFormat) Open(source, destination string, opts ...OpOption) error {
 	ret := Op{verbose: false}
 	ret.applyOpts(opts)
 
+	if ret.resume {
+		fi, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		ret.archive = archiveID(fi)
+	}
+
 	r, err := zip.OpenReader(source)
 	if err != nil {
 		return err
@@ -199,21 +240,136 @@ func (zipFormat) Open(source, destination string, opts ...OpOption) error {
 }
 
 func unzipAll(r *zip.Reader, destination string, op Op) error {
+	var (
+		files    []*zip.File
+		total    int64
+		manifest *zip.File
+	)
 	for _, zf := range r.File {
+		if !normalizeZipName(zf) {
+			if op.verbose {
+				glog.Infof("skipping %q", zf.Name)
+			}
+			continue
+		}
+		ok, err := op.match(zf.Name)
+		if err != nil {
+			return err
+		}
+		if isManifest(zf.Name) && !zf.Mode().IsDir() {
+			manifest = zf
+		}
+		if ok {
+			files = append(files, zf)
+			total += int64(zf.UncompressedSize64)
+		}
+	}
+	if op.progress != nil && op.tracker == nil {
+		op.tracker = &tracker{fn: op.progress, p: Progress{Total: total}}
+	}
+
+	v := newVerifier()
+	if manifest != nil {
+		// read up front, to verify the matched files even if
+		// the manifest is not extracted (or skipped on resume)
+		rc, err := manifest.Open()
+		if err != nil {
+			return fmt.Errorf("%s: open compressed file: %v", manifest.Name, err)
+		}
+		_, err = v.readManifest(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	j, err := op.openJournal(destination)
+	if err != nil {
+		return err
+	}
+	defer j.close(false)
+
+	for _, zf := range files {
+		skip, err := j.skip(destination, zf.Name, v)
+		if err != nil {
+			return err
+		}
+		if skip {
+			if op.verbose {
+				glog.Infof("skipping %q (already extracted)", zf.Name)
+			}
+			op.tracker.add(int64(zf.UncompressedSize64))
+			continue
+		}
 		if op.verbose {
 			glog.Infof("unzipping %q", zf.Name)
 		}
-		if err := unzipFile(zf, destination); err != nil {
+		if !strings.HasSuffix(zf.Name, "/") {
+			op.tracker.file(zf.Name)
+		}
+		if err = unzipFile(zf, destination, op.tracker, v); err != nil {
+			return err
+		}
+		if err = j.record(zf.Name, v); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	op.tracker.done()
+	// removed even if the verification fails, not to skip
+	// the corrupted files on retry
+	if err = j.close(true); err != nil {
+		return err
+	}
+	return v.verify(op)
 }
 
-func unzipFile(zf *zip.File, destination string) error {
+// macOSMetadataDir is the directory of the resource forks
+// in the zip files made by macOS Finder.
+const macOSMetadataDir = "__MACOSX"
+
+// normalizeZipName updates the name of the zip entry to use "/"
+// separators, since archives made on Windows may use backslashes,
+// and returns false for the entries not to extract (e.g. the resource
+// forks added by macOS Finder).
+func normalizeZipName(zf *zip.File) bool {
+	zf.Name = strings.Replace(zf.Name, `\`, "/", -1)
+	return zf.Name != macOSMetadataDir && !strings.HasPrefix(zf.Name, macOSMetadataDir+"/")
+}
+
+// List returns the entries of the .zip file at source,
+// except the ones not to extract (e.g. macOS resource forks).
+func (zipFormat) List(source string) ([]Entry, error) {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entries []Entry
+	for _, zf := range r.File {
+		if !normalizeZipName(zf) {
+			continue
+		}
+		entries = append(entries, Entry{
+			Name:    zf.Name,
+			Size:    int64(zf.UncompressedSize64),
+			Mode:    zf.Mode(),
+			ModTime: zf.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+func unzipFile(zf *zip.File, destination string, t *tracker, v *verifier) error {
+	fpath, err := safePath(destination, zf.Name)
+	if err != nil {
+		return err
+	}
 	if strings.HasSuffix(zf.Name, "/") {
-		return mkdir(filepath.Join(destination, zf.Name))
+		return mkdir(fpath)
+	}
+	if err = checkMode(zf.Name, zf.FileInfo().Mode()); err != nil {
+		return err
 	}
 
 	rc, err := zf.Open()
@@ -222,7 +378,7 @@ func unzipFile(zf *zip.File, destination string) error {
 	}
 	defer rc.Close()
 
-	return writeNewFile(filepath.Join(destination, zf.Name), rc, zf.FileInfo().Mode())
+	return writeNewFile(fpath, v.reader(zf.Name, &trackReader{r: rc, t: t}), zf.FileInfo().Mode())
 }
 
 // compressedFormats is a (non-exhaustive) set of lowercased
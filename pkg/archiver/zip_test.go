@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "dogscats")
+	writeFiles(t, src, map[string]string{
+		"train/cats/cat.1.jpg": "cat",
+		"train/dogs/dog.1.jpg": "dog",
+		"valid/cats/cat.2.jpg": "cat2",
+		"sample/dog.2.jpg":     "ignored",
+	})
+	fpath := filepath.Join(dir, "dogscats.zip")
+	if err := Zip.Make(fpath, []string{src}, WithDirectoryToIgnore(filepath.Join(src, "sample"))); err != nil {
+		t.Fatal(err)
+	}
+	if !Zip.Match(fpath) || MatchingFormat(fpath) != Zip {
+		t.Fatalf("%q does not match zip", fpath)
+	}
+
+	dst := filepath.Join(dir, "out")
+	if err := Zip.Open(fpath, dst); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dst, map[string]string{
+		"dogscats/train/cats/cat.1.jpg": "cat",
+		"dogscats/train/dogs/dog.1.jpg": "dog",
+		"dogscats/valid/cats/cat.2.jpg": "cat2",
+	})
+}
+
+func TestZipWindowsAndMacOS(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "dogscats.zip")
+	f, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, data := range map[string]string{
+		`dogscats\train\cat.1.jpg`:            "cat",
+		"__MACOSX/dogscats/._cat.1.jpg":       "fork",
+		"dogscats/valid/dog.1.jpg":            "dog",
+		"__MACOSX/dogscats/valid/._dog.1.jpg": "fork",
+	} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "out")
+	if err = Zip.Open(fpath, dst); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, dst, map[string]string{
+		"dogscats/train/cat.1.jpg": "cat",
+		"dogscats/valid/dog.1.jpg": "dog",
+	})
+}
@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+)
+
+// Outcomes of the actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeDenied is the outcome of the unauthenticated,
+	// or unauthorized actions.
+	OutcomeDenied = "denied"
+)
+
+// Entry is the audit entry of the action.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Action is the name of the action (e.g. "user.login").
+	Action string `json:"action"`
+	// Actor is the user name, "anonymous", or "system"
+	// for the actions of the server (e.g. config reloads).
+	Actor     string `json:"actor"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Target is the target of the action (e.g. "POST /admin/canary").
+	Target  string `json:"target,omitempty"`
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+	// Revision is the etcd revision of the entry, set on append.
+	Revision int64 `json:"revision"`
+}
+
+// Query selects the entries. Zero values match all entries.
+type Query struct {
+	Since  time.Time
+	Until  time.Time
+	Action string
+	Actor  string
+	// Limit is the maximum number of the entries to return,
+	// the most recent first if limited.
+	Limit int
+}
+
+func (q Query) match(e Entry) bool {
+	return (q.Action == "" || q.Action == e.Action) && (q.Actor == "" || q.Actor == e.Actor)
+}
+
+// Config defines audit log configuration.
+type Config struct {
+	// Prefix is the etcd key prefix of the entries. Defaults to "_audit".
+	Prefix string
+}
+
+// Log is the append-only audit log.
+type Log struct {
+	cli *clientv3.Client
+	cfg Config
+}
+
+// New creates a new audit log.
+func New(cli *clientv3.Client, cfg Config) *Log {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_audit"
+	}
+	return &Log{cli: cli, cfg: cfg}
+}
+
+func (l *Log) entriesPrefix() string { return path.Join(l.cfg.Prefix, "entries") + "/" }
+
+// entryKey is zero-padded with the time, so that the entries are sorted
+// by key, and suffixed with the random bytes for the concurrent entries.
+func (l *Log) entryKey(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s%020d-%s", l.entriesPrefix(), t.UnixNano(), hex.EncodeToString(b))
+}
+
+// Append appends the entry, setting its time if zero.
+// Entries are never updated, or deleted.
+func (l *Log) Append(ctx context.Context, e Entry) (Entry, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	key := l.entryKey(e.Time)
+	resp, err := l.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return e, err
+	}
+	if !resp.Succeeded {
+		return e, fmt.Errorf("audit: entry %q already exists", key)
+	}
+	e.Revision = resp.Header.Revision
+	return e, nil
+}
+
+// exportBatch is the number of the entries to read at once.
+const exportBatch = 500
+
+// Export writes the entries matching the query as JSON lines in time
+// order, reading the entries in batches.
+func (l *Log) Export(ctx context.Context, w io.Writer, q Query) error {
+	enc := json.NewEncoder(w)
+	return l.scan(ctx, q, func(e Entry) error { return enc.Encode(e) })
+}
+
+// List returns the entries matching the query in time order.
+func (l *Log) List(ctx context.Context, q Query) ([]Entry, error) {
+	var es []Entry
+	err := l.scan(ctx, q, func(e Entry) error {
+		es = append(es, e)
+		if q.Limit > 0 && len(es) > q.Limit {
+			es = es[1:]
+		}
+		return nil
+	})
+	return es, err
+}
+
+func (l *Log) scan(ctx context.Context, q Query, fn func(Entry) error) error {
+	from := l.entriesPrefix()
+	if !q.Since.IsZero() {
+		from = fmt.Sprintf("%s%020d", l.entriesPrefix(), q.Since.UnixNano())
+	}
+	end := clientv3.GetPrefixRangeEnd(l.entriesPrefix())
+	if !q.Until.IsZero() {
+		end = fmt.Sprintf("%s%020d", l.entriesPrefix(), q.Until.UnixNano())
+	}
+	for {
+		resp, err := l.cli.Get(ctx, from,
+			clientv3.WithRange(end),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+			clientv3.WithLimit(exportBatch),
+		)
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			var e Entry
+			if err = json.Unmarshal(kv.Value, &e); err != nil {
+				glog.Warningf("audit entry %q is invalid (%v)", string(kv.Key), err)
+				continue
+			}
+			e.Revision = kv.CreateRevision
+			if !q.match(e) {
+				continue
+			}
+			if err = fn(e); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		// continue after the last key
+		from = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
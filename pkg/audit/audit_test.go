@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestLog(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 33379, 33380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	ctx := context.Background()
+	l := New(qu.Client(), Config{})
+	now := time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	for i, e := range []Entry{
+		{Action: "user.login", Actor: "alice", IP: "10.0.0.1", Outcome: OutcomeSuccess},
+		{Action: "job.submit", Actor: "alice", RequestID: "req-1", Outcome: OutcomeSuccess},
+		{Action: "user.login", Actor: "bob", Outcome: OutcomeDenied},
+		{Action: "config.reload", Actor: "system", Outcome: OutcomeSuccess},
+	} {
+		e.Time = now.Add(time.Duration(i) * time.Minute)
+		appended, err := l.Append(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appended.Revision == 0 {
+			t.Fatalf("#%d: expected revision, got %+v", i, appended)
+		}
+	}
+
+	es, err := l.List(ctx, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 4 || es[0].Action != "user.login" || es[3].Action != "config.reload" {
+		t.Fatalf("unexpected entries %+v", es)
+	}
+	if es, err = l.List(ctx, Query{Action: "user.login"}); err != nil || len(es) != 2 || es[1].Actor != "bob" {
+		t.Fatalf("unexpected login entries %+v (%v)", es, err)
+	}
+	if es, err = l.List(ctx, Query{Actor: "alice", Limit: 1}); err != nil || len(es) != 1 || es[0].Action != "job.submit" {
+		t.Fatalf("expected the most recent entry of alice, got %+v (%v)", es, err)
+	}
+	if es, err = l.List(ctx, Query{Since: now.Add(time.Minute), Until: now.Add(3 * time.Minute)}); err != nil || len(es) != 2 {
+		t.Fatalf("expected 2 entries in range, got %+v (%v)", es, err)
+	}
+
+	var buf bytes.Buffer
+	if err = l.Export(ctx, &buf, Query{}); err != nil {
+		t.Fatal(err)
+	}
+	sc, n := bufio.NewScanner(&buf), 0
+	for sc.Scan() {
+		var e Entry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if !e.Time.Equal(now.Add(time.Duration(n) * time.Minute)) {
+			t.Fatalf("#%d: unexpected time %s", n, e.Time)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 exported entries, got %d", n)
+	}
+}
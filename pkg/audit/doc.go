@@ -0,0 +1,5 @@
+// Package audit records the security-relevant actions (e.g. logins, job
+// submissions, admin operations) as append-only entries in etcd, with the
+// actor, client IP, and request ID of each action, for the deployments
+// that need accountability.
+package audit
@@ -0,0 +1,222 @@
+package autoscale
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/tracing"
+
+	"github.com/golang/glog"
+)
+
+// Scaler scales the worker group to the number of workers.
+type Scaler interface {
+	Scale(ctx context.Context, workers int) error
+}
+
+// ScalerFunc adapts the function to Scaler.
+type ScalerFunc func(ctx context.Context, workers int) error
+
+// Scale calls f(ctx, workers).
+func (f ScalerFunc) Scale(ctx context.Context, workers int) error { return f(ctx, workers) }
+
+// Config defines autoscaler configuration.
+type Config struct {
+	// Bucket is the job bucket to compute the signal for (e.g. "/cats-request").
+	Bucket string
+
+	// TargetLatency is the desired time to drain the queue. Defaults to 1 minute.
+	TargetLatency time.Duration
+	// DefaultJobDuration is the job duration until any job is observed.
+	// Defaults to 10 seconds.
+	DefaultJobDuration time.Duration
+
+	// MinWorkers is the lower bound of desired workers.
+	MinWorkers int
+	// MaxWorkers is the upper bound of desired workers, 0 for no limit.
+	MaxWorkers int
+
+	// Interval is the interval to recompute the signal. Defaults to 30 seconds.
+	Interval time.Duration
+
+	// Scaler is called when the desired worker count changes, if not nil.
+	Scaler Scaler
+}
+
+// Signal is the autoscaling signal.
+type Signal struct {
+	Bucket                string    `json:"bucket"`
+	QueueDepth            int64     `json:"queue_depth"`
+	InFlight              int64     `json:"in_flight"`
+	AvgJobDurationSeconds float64   `json:"avg_job_duration_seconds"`
+	DesiredWorkers        int       `json:"desired_workers"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+const (
+	// ewmaWeight is the weight of the latest job duration.
+	ewmaWeight = 0.2
+
+	// staleClaim is the duration after which claimed jobs are
+	// considered abandoned (e.g. worker crashed).
+	staleClaim = time.Hour
+)
+
+// Autoscaler computes autoscaling signals.
+type Autoscaler struct {
+	qu  queue.Queue
+	cfg Config
+
+	mu       sync.RWMutex
+	avg      time.Duration
+	observed bool
+	claimed  map[string]time.Time
+	last     Signal
+	scaled   int
+}
+
+// New creates a new autoscaler.
+func New(qu queue.Queue, cfg Config) *Autoscaler {
+	if cfg.TargetLatency == 0 {
+		cfg.TargetLatency = time.Minute
+	}
+	if cfg.DefaultJobDuration == 0 {
+		cfg.DefaultJobDuration = 10 * time.Second
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	return &Autoscaler{
+		qu:      qu,
+		cfg:     cfg,
+		avg:     cfg.DefaultJobDuration,
+		claimed: make(map[string]time.Time),
+		last:    Signal{Bucket: cfg.Bucket, DesiredWorkers: cfg.MinWorkers},
+		scaled:  -1,
+	}
+}
+
+// Claimed records that a worker has claimed the job.
+func (a *Autoscaler) Claimed(requestID string) {
+	a.mu.Lock()
+	a.claimed[requestID] = time.Now()
+	a.mu.Unlock()
+}
+
+// Completed records that the job has been completed, observing its duration.
+func (a *Autoscaler) Completed(requestID string) {
+	a.mu.Lock()
+	start, ok := a.claimed[requestID]
+	delete(a.claimed, requestID)
+	a.mu.Unlock()
+	if ok {
+		a.Observe(time.Since(start))
+	}
+}
+
+// Observe records the job duration.
+func (a *Autoscaler) Observe(d time.Duration) {
+	a.mu.Lock()
+	if !a.observed {
+		a.avg, a.observed = d, true
+	} else {
+		a.avg = time.Duration(ewmaWeight*float64(d) + (1-ewmaWeight)*float64(a.avg))
+	}
+	a.mu.Unlock()
+}
+
+// Signal returns the last computed signal.
+func (a *Autoscaler) Signal() Signal {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.last
+}
+
+// Compute computes the signal from the current queue depth and job durations.
+func (a *Autoscaler) Compute(ctx context.Context) (Signal, error) {
+	depth, err := a.qu.Depth(ctx, a.cfg.Bucket)
+	if err != nil {
+		return Signal{}, err
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	for id, start := range a.claimed {
+		if now.Sub(start) > staleClaim {
+			delete(a.claimed, id)
+		}
+	}
+	inFlight := int64(len(a.claimed))
+	avg := a.avg
+	a.last = Signal{
+		Bucket:                a.cfg.Bucket,
+		QueueDepth:            depth,
+		InFlight:              inFlight,
+		AvgJobDurationSeconds: avg.Seconds(),
+		DesiredWorkers:        DesiredWorkers(depth, inFlight, avg, a.cfg.TargetLatency, a.cfg.MinWorkers, a.cfg.MaxWorkers),
+		UpdatedAt:             now,
+	}
+	sig := a.last
+	a.mu.Unlock()
+
+	tracing.GetGauge("autoscale.queue_depth", "Number of jobs waiting in the queue.", "{job}").Set(sig.QueueDepth, "bucket", sig.Bucket)
+	tracing.GetGauge("autoscale.desired_workers", "Desired number of workers.", "{worker}").Set(int64(sig.DesiredWorkers), "bucket", sig.Bucket)
+	return sig, nil
+}
+
+// Run recomputes the signal periodically, and calls the scaler
+// on changes, until the context is canceled.
+func (a *Autoscaler) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		a.step(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Autoscaler) step(ctx context.Context) {
+	sig, err := a.Compute(ctx)
+	if err != nil {
+		glog.Warningf("failed to compute autoscaling signal for %q (%v)", a.cfg.Bucket, err)
+		return
+	}
+	if a.cfg.Scaler == nil || sig.DesiredWorkers == a.scaled {
+		return
+	}
+	glog.Infof("scaling workers for %q to %d (queue depth %d, in-flight %d, avg job duration %.1fs)",
+		sig.Bucket, sig.DesiredWorkers, sig.QueueDepth, sig.InFlight, sig.AvgJobDurationSeconds)
+	if err = a.cfg.Scaler.Scale(ctx, sig.DesiredWorkers); err != nil {
+		glog.Warningf("failed to scale workers for %q (%v)", a.cfg.Bucket, err)
+		return
+	}
+	a.scaled = sig.DesiredWorkers
+}
+
+// DesiredWorkers returns the number of workers to process the queued and
+// in-flight jobs within the target latency, bounded by [min, max].
+// It never goes below the in-flight jobs, to not interrupt running jobs.
+// 'max' 0 means no upper bound.
+func DesiredWorkers(depth, inFlight int64, avg, target time.Duration, min, max int) int {
+	n := inFlight
+	if target > 0 {
+		work := float64(depth+inFlight) * float64(avg)
+		if v := int64(math.Ceil(work / float64(target))); v > n {
+			n = v
+		}
+	}
+	if n < int64(min) {
+		n = int64(min)
+	}
+	if max > 0 && n > int64(max) {
+		n = int64(max)
+	}
+	return int(n)
+}
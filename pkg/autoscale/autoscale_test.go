@@ -0,0 +1,122 @@
+package autoscale
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/kube"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	tests := []struct {
+		depth, inFlight int64
+		avg, target     time.Duration
+		min, max        int
+		expected        int
+	}{
+		{0, 0, 10 * time.Second, time.Minute, 0, 0, 0},
+		{0, 0, 10 * time.Second, time.Minute, 1, 0, 1},
+		{12, 0, 10 * time.Second, time.Minute, 0, 0, 2},
+		{13, 0, 10 * time.Second, time.Minute, 0, 0, 3},
+		{100, 0, 10 * time.Second, time.Minute, 0, 5, 5},
+		{0, 4, 10 * time.Second, time.Minute, 0, 0, 4},
+	}
+	for i, tt := range tests {
+		n := DesiredWorkers(tt.depth, tt.inFlight, tt.avg, tt.target, tt.min, tt.max)
+		if n != tt.expected {
+			t.Fatalf("#%d: expected %d, got %d", i, tt.expected, n)
+		}
+	}
+}
+
+type depthQueue struct {
+	depth int64
+}
+
+func (qu *depthQueue) Add(ctx context.Context, it *queue.Item, opts ...queue.OpOption) error {
+	return nil
+}
+func (qu *depthQueue) Pop(ctx context.Context, bucket string, opts ...queue.OpOption) queue.ItemWatcher {
+	return nil
+}
+func (qu *depthQueue) TryPop(ctx context.Context, bucket string, opts ...queue.OpOption) (*queue.Item, error) {
+	return nil, nil
+}
+func (qu *depthQueue) Depth(ctx context.Context, bucket string) (int64, error) { return qu.depth, nil }
+func (qu *depthQueue) AppendLog(ctx context.Context, key string, lines []string, opts ...queue.OpOption) error {
+	return nil
+}
+func (qu *depthQueue) WatchLogs(ctx context.Context, key string, fromRev int64) queue.LogWatcher {
+	return nil
+}
+func (qu *depthQueue) Stop()                     {}
+func (qu *depthQueue) Client() *clientv3.Client  { return nil }
+func (qu *depthQueue) ClientEndpoints() []string { return nil }
+
+func TestAutoscaler(t *testing.T) {
+	var scaled []int
+	a := New(&depthQueue{depth: 30}, Config{
+		Bucket:        "/cats-request",
+		TargetLatency: time.Minute,
+		MaxWorkers:    10,
+		Scaler: ScalerFunc(func(ctx context.Context, n int) error {
+			scaled = append(scaled, n)
+			return nil
+		}),
+	})
+
+	a.Observe(4 * time.Second)
+	a.Claimed("a")
+	a.step(context.Background())
+	sig := a.Signal()
+	if sig.QueueDepth != 30 || sig.InFlight != 1 || sig.AvgJobDurationSeconds != 4 {
+		t.Fatalf("unexpected signal %+v", sig)
+	}
+	// 31 jobs * 4s / 60s
+	if sig.DesiredWorkers != 3 {
+		t.Fatalf("expected 3 workers, got %d", sig.DesiredWorkers)
+	}
+
+	// same signal does not scale again
+	a.step(context.Background())
+	if len(scaled) != 1 || scaled[0] != 3 {
+		t.Fatalf("expected one scale to 3, got %v", scaled)
+	}
+
+	// 30 jobs * 3.2s(0.2*0s + 0.8*4s) / 60s
+	a.Completed("a")
+	a.step(context.Background())
+	if len(scaled) != 2 || scaled[1] != 2 {
+		t.Fatalf("expected scale to 2, got %v", scaled)
+	}
+}
+
+func TestKubernetesScaler(t *testing.T) {
+	var body, auth, path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body, auth, path = string(b), req.Header.Get("Authorization"), req.URL.Path
+	}))
+	defer ts.Close()
+
+	s, err := newKubernetesScaler(kube.NewClient(ts.URL, "test-token", nil), "default", "hpa", "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Scale(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/apis/autoscaling/v1/namespaces/default/horizontalpodautoscalers/worker" {
+		t.Fatalf("unexpected path %q", path)
+	}
+	if body != `{"spec":{"minReplicas":3}}` || auth != "Bearer test-token" {
+		t.Fatalf("unexpected request %q (%q)", body, auth)
+	}
+}
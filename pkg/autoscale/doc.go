@@ -0,0 +1,3 @@
+// Package autoscale computes the desired number of workers from the queue depth
+// and job durations, and optionally scales the worker group.
+package autoscale
@@ -0,0 +1,57 @@
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gyuho/dplearn/pkg/kube"
+)
+
+// KubernetesScaler scales workers in Kubernetes, from inside the cluster.
+// For "deployment" kind, it sets the replicas of the deployment.
+// For "hpa" kind, it sets the minimum replicas of the horizontal pod
+// autoscaler, so that the HPA scales up to the desired workers while
+// still managing the upper bound.
+type KubernetesScaler struct {
+	cli   *kube.Client
+	path  string
+	body  string
+	isHPA bool
+}
+
+// NewKubernetesScaler creates a scaler for the resource ("deployment" or "hpa")
+// with the in-cluster service account credentials.
+func NewKubernetesScaler(namespace, kind, name string) (*KubernetesScaler, error) {
+	cli, err := kube.InClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	return newKubernetesScaler(cli, namespace, kind, name)
+}
+
+func newKubernetesScaler(cli *kube.Client, namespace, kind, name string) (*KubernetesScaler, error) {
+	s := &KubernetesScaler{cli: cli}
+	switch kind {
+	case "deployment":
+		s.path = fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/%s/scale", namespace, name)
+		s.body = `{"spec":{"replicas":%d}}`
+	case "hpa":
+		s.path = fmt.Sprintf("/apis/autoscaling/v1/namespaces/%s/horizontalpodautoscalers/%s", namespace, name)
+		s.body = `{"spec":{"minReplicas":%d}}`
+		s.isHPA = true
+	default:
+		return nil, fmt.Errorf("unknown kind %q (must be 'deployment' or 'hpa')", kind)
+	}
+	return s, nil
+}
+
+// Scale patches the resource to the number of workers.
+func (s *KubernetesScaler) Scale(ctx context.Context, workers int) error {
+	if workers < 1 && s.isHPA {
+		workers = 1 // HPA requires minReplicas >= 1
+	}
+	patch := json.RawMessage(fmt.Sprintf(s.body, workers))
+	return s.cli.Do(ctx, http.MethodPatch, s.path, "application/merge-patch+json", patch, nil)
+}
@@ -0,0 +1,109 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are the AWS access keys to sign requests with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials (e.g. instance roles).
+	SessionToken string
+	// Expiry is zero if the credentials do not expire.
+	Expiry time.Time
+}
+
+// CredentialsProvider returns the credentials to sign requests with.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials returns the same credentials on every call.
+type StaticCredentials Credentials
+
+// Credentials returns the static credentials.
+func (s StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// EnvCredentials returns the credentials from "AWS_ACCESS_KEY_ID",
+// "AWS_SECRET_ACCESS_KEY", and "AWS_SESSION_TOKEN" environment variables,
+// or false if not set.
+func EnvCredentials() (StaticCredentials, bool) {
+	cr := StaticCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	return cr, cr.AccessKeyID != "" && cr.SecretAccessKey != ""
+}
+
+// RoleCredentials returns the temporary credentials of the IAM role of the
+// instance from the metadata service, reused until five minutes before they
+// expire.
+func (c *MetadataClient) RoleCredentials() CredentialsProvider {
+	return &roleCredentials{c: c}
+}
+
+type roleCredentials struct {
+	c *MetadataClient
+
+	mu    sync.Mutex
+	creds Credentials
+}
+
+func (rc *roleCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.creds.AccessKeyID != "" && time.Now().Before(rc.creds.Expiry.Add(-5*time.Minute)) {
+		return rc.creds, nil
+	}
+	roles, err := rc.c.Get(ctx, "iam/security-credentials/")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to fetch instance role (%v)", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, fmt.Errorf("instance has no IAM role")
+	}
+	v, err := rc.c.Get(ctx, "iam/security-credentials/"+role)
+	if err != nil {
+		return Credentials{}, err
+	}
+	var resp struct {
+		Code            string
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err = json.Unmarshal([]byte(v), &resp); err != nil {
+		return Credentials{}, err
+	}
+	if resp.Code != "Success" {
+		return Credentials{}, fmt.Errorf("instance role %q credentials returned %q", role, resp.Code)
+	}
+	rc.creds = Credentials{
+		AccessKeyID:     resp.AccessKeyID,
+		SecretAccessKey: resp.SecretAccessKey,
+		SessionToken:    resp.Token,
+		Expiry:          resp.Expiration,
+	}
+	return rc.creds, nil
+}
+
+// DefaultCredentials returns the credentials from the environment variables
+// if set (see 'EnvCredentials'), or of the IAM role of the instance otherwise.
+func DefaultCredentials() CredentialsProvider {
+	if cr, ok := EnvCredentials(); ok {
+		return cr
+	}
+	return NewMetadataClient("").RoleCredentials()
+}
@@ -0,0 +1,4 @@
+// Package aws implements the cloud abstractions of pkg/cloud on AWS: the EC2
+// instance metadata (IMDSv2), S3 objects, and EC2 instance pools, over the
+// REST and query APIs signed with Signature Version 4.
+package aws
@@ -0,0 +1,269 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// PoolTag is the tag of the instances in an instance pool,
+	// whose value is the pool name.
+	PoolTag = "dplearn-pool"
+
+	ec2APIVersion = "2016-11-15"
+)
+
+// EC2 calls the EC2 query API in the region.
+type EC2 struct {
+	endpoint string
+	region   string
+	creds    CredentialsProvider
+	client   *http.Client
+}
+
+// NewEC2 returns the EC2 client of the region.
+// Nil 'creds' defaults to 'DefaultCredentials'.
+func NewEC2(region string, creds CredentialsProvider) *EC2 {
+	if creds == nil {
+		creds = DefaultCredentials()
+	}
+	return &EC2{
+		endpoint: fmt.Sprintf("https://ec2.%s.amazonaws.com/", region),
+		region:   region,
+		creds:    creds,
+		client:   http.DefaultClient,
+	}
+}
+
+// call calls the action with the parameters, and decodes the XML response to 'v'.
+func (c *EC2) call(ctx context.Context, action string, params url.Values, v interface{}) error {
+	params.Set("Action", action)
+	params.Set("Version", ec2APIVersion)
+	body := []byte(params.Encode())
+	return retry(ctx, requestAttempts, requestBackoff, strings.ToLower(action), func() error {
+		cr, err := c.creds.Credentials(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, c.endpoint, strings.NewReader(string(body)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signer{creds: cr, region: c.region, service: "ec2"}.sign(req, hashHex(body), time.Now())
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return apiError(resp, b)
+		}
+		return xml.Unmarshal(b, v)
+	})
+}
+
+// Instance is the EC2 instance.
+type Instance struct {
+	ID         string    `xml:"instanceId"`
+	Type       string    `xml:"instanceType"`
+	State      string    `xml:"instanceState>name"`
+	LaunchTime time.Time `xml:"launchTime"`
+	PrivateIP  string    `xml:"privateIpAddress"`
+	PublicIP   string    `xml:"ipAddress"`
+	Zone       string    `xml:"placement>availabilityZone"`
+}
+
+// InstanceConfig is the configuration of the instances to launch.
+type InstanceConfig struct {
+	ImageID      string
+	InstanceType string
+	// Zone is the availability zone (e.g. "us-west-2a"),
+	// or any zone in the region if empty.
+	Zone             string
+	SubnetID         string
+	SecurityGroupIDs []string
+	KeyName          string
+	// InstanceProfile is the name of the IAM instance profile,
+	// whose role credentials the instances use.
+	InstanceProfile string
+	// UserData is the startup script of the instances.
+	UserData string
+	// Spot requests spot instances, which are interrupted
+	// when EC2 needs the capacity back.
+	Spot bool
+	Tags map[string]string
+}
+
+// DescribeInstances returns the pending and running instances
+// with the tag value.
+func (c *EC2) DescribeInstances(ctx context.Context, tag, value string) ([]Instance, error) {
+	params := url.Values{
+		"Filter.1.Name":    {"tag:" + tag},
+		"Filter.1.Value.1": {value},
+		"Filter.2.Name":    {"instance-state-name"},
+		"Filter.2.Value.1": {"pending"},
+		"Filter.2.Value.2": {"running"},
+	}
+	var insts []Instance
+	for {
+		var resp struct {
+			Instances []Instance `xml:"reservationSet>item>instancesSet>item"`
+			NextToken string     `xml:"nextToken"`
+		}
+		if err := c.call(ctx, "DescribeInstances", params, &resp); err != nil {
+			return nil, err
+		}
+		insts = append(insts, resp.Instances...)
+		if resp.NextToken == "" {
+			return insts, nil
+		}
+		params.Set("NextToken", resp.NextToken)
+	}
+}
+
+// RunInstances launches the number of instances of the configuration,
+// and returns their IDs.
+func (c *EC2) RunInstances(ctx context.Context, cfg InstanceConfig, count int) ([]string, error) {
+	params := url.Values{
+		"ImageId":      {cfg.ImageID},
+		"InstanceType": {cfg.InstanceType},
+		"MinCount":     {fmt.Sprint(count)},
+		"MaxCount":     {fmt.Sprint(count)},
+	}
+	if cfg.Zone != "" {
+		params.Set("Placement.AvailabilityZone", cfg.Zone)
+	}
+	if cfg.SubnetID != "" {
+		params.Set("SubnetId", cfg.SubnetID)
+	}
+	for i, id := range cfg.SecurityGroupIDs {
+		params.Set(fmt.Sprintf("SecurityGroupId.%d", i+1), id)
+	}
+	if cfg.KeyName != "" {
+		params.Set("KeyName", cfg.KeyName)
+	}
+	if cfg.InstanceProfile != "" {
+		params.Set("IamInstanceProfile.Name", cfg.InstanceProfile)
+	}
+	if cfg.UserData != "" {
+		params.Set("UserData", base64.StdEncoding.EncodeToString([]byte(cfg.UserData)))
+	}
+	if cfg.Spot {
+		params.Set("InstanceMarketOptions.MarketType", "spot")
+		params.Set("InstanceMarketOptions.SpotOptions.InstanceInterruptionBehavior", "terminate")
+	}
+	if len(cfg.Tags) > 0 {
+		keys := make([]string, 0, len(cfg.Tags))
+		for k := range cfg.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		params.Set("TagSpecification.1.ResourceType", "instance")
+		for i, k := range keys {
+			params.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Key", i+1), k)
+			params.Set(fmt.Sprintf("TagSpecification.1.Tag.%d.Value", i+1), cfg.Tags[k])
+		}
+	}
+	var resp struct {
+		Instances []Instance `xml:"instancesSet>item"`
+	}
+	if err := c.call(ctx, "RunInstances", params, &resp); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(resp.Instances))
+	for i, inst := range resp.Instances {
+		ids[i] = inst.ID
+	}
+	return ids, nil
+}
+
+// TerminateInstances terminates the instances of the IDs.
+func (c *EC2) TerminateInstances(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	params := url.Values{}
+	for i, id := range ids {
+		params.Set(fmt.Sprintf("InstanceId.%d", i+1), id)
+	}
+	var resp struct{}
+	return c.call(ctx, "TerminateInstances", params, &resp)
+}
+
+// InstancePool launches and terminates ephemeral instances from the template,
+// to scale the number of workers on queue pressure (e.g. as the scaler of the
+// autoscaler). Instances are tagged with 'PoolTag'.
+type InstancePool struct {
+	c        *EC2
+	name     string
+	template InstanceConfig
+}
+
+// NewInstancePool returns the pool of the instances tagged with the name,
+// launched from the template.
+func NewInstancePool(c *EC2, name string, template InstanceConfig) *InstancePool {
+	return &InstancePool{c: c, name: name, template: template}
+}
+
+// Instances returns the IDs of the instances in the pool,
+// from the oldest to the newest.
+func (p *InstancePool) Instances(ctx context.Context) ([]string, error) {
+	insts, err := p.c.DescribeInstances(ctx, PoolTag, p.name)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(insts, func(i, j int) bool { return insts[i].LaunchTime.Before(insts[j].LaunchTime) })
+	ids := make([]string, len(insts))
+	for i, inst := range insts {
+		ids[i] = inst.ID
+	}
+	return ids, nil
+}
+
+// Scale launches or terminates the instances in the pool, to the number
+// of workers. The newest instances are terminated first.
+func (p *InstancePool) Scale(ctx context.Context, workers int) error {
+	ids, err := p.Instances(ctx)
+	if err != nil {
+		return err
+	}
+	if workers < 0 {
+		workers = 0
+	}
+	switch {
+	case len(ids) < workers:
+		glog.Infof("scaling instance pool %q from %d to %d", p.name, len(ids), workers)
+		cfg := p.template
+		cfg.Tags = make(map[string]string, len(p.template.Tags)+1)
+		for k, v := range p.template.Tags {
+			cfg.Tags[k] = v
+		}
+		cfg.Tags[PoolTag] = p.name
+		_, err = p.c.RunInstances(ctx, cfg, workers-len(ids))
+		return err
+
+	case len(ids) > workers:
+		glog.Infof("scaling instance pool %q from %d to %d", p.name, len(ids), workers)
+		var del []string
+		for i := len(ids) - 1; i >= workers; i-- {
+			del = append(del, ids[i])
+		}
+		return p.c.TerminateInstances(ctx, del...)
+	}
+	return nil
+}
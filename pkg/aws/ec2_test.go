@@ -0,0 +1,94 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestInstancePool(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		insts = map[string]int{"i-0": 0, "i-1": 1}
+		next  = 2
+		tags  = make(map[string]string)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Form.Get("Action") {
+		case "DescribeInstances":
+			if req.Form.Get("Filter.1.Name") != "tag:"+PoolTag || req.Form.Get("Filter.1.Value.1") != "workers" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>`)
+			for id, i := range insts {
+				fmt.Fprintf(w, `<item><instanceId>%s</instanceId><launchTime>2018-01-01T00:00:%02dZ</launchTime></item>`, id, i)
+			}
+			fmt.Fprint(w, `</instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+		case "RunInstances":
+			if req.Form.Get("MinCount") != "2" || req.Form.Get("ImageId") != "ami-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tags[req.Form.Get("TagSpecification.1.Tag.1.Key")] = req.Form.Get("TagSpecification.1.Tag.1.Value")
+			fmt.Fprint(w, `<RunInstancesResponse><instancesSet>`)
+			for i := 0; i < 2; i++ {
+				id := fmt.Sprintf("i-%d", next)
+				insts[id] = next
+				next++
+				fmt.Fprintf(w, `<item><instanceId>%s</instanceId></item>`, id)
+			}
+			fmt.Fprint(w, `</instancesSet></RunInstancesResponse>`)
+		case "TerminateInstances":
+			for i := 1; req.Form.Get(fmt.Sprintf("InstanceId.%d", i)) != ""; i++ {
+				delete(insts, req.Form.Get(fmt.Sprintf("InstanceId.%d", i)))
+			}
+			fmt.Fprint(w, `<TerminateInstancesResponse></TerminateInstancesResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>InvalidAction</Code><Message>unknown</Message></Error></Errors></Response>`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewEC2("us-west-2", StaticCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	c.endpoint = ts.URL
+	p := NewInstancePool(c, "workers", InstanceConfig{ImageID: "ami-1", InstanceType: "p2.xlarge", Spot: true})
+	ctx := context.Background()
+
+	if err := p.Scale(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if tags[PoolTag] != "workers" {
+		t.Fatalf("instances not tagged with the pool (%v)", tags)
+	}
+	if err := p.Scale(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := p.Instances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newest instances are terminated first
+	sort.Strings(ids)
+	if len(ids) != 1 || ids[0] != "i-0" {
+		t.Fatalf("unexpected instances %q", ids)
+	}
+
+	var resp struct{}
+	err = c.call(ctx, "Unknown", url.Values{}, &resp)
+	if e, ok := err.(*Error); !ok || e.Code != "InvalidAction" {
+		t.Fatalf("expected InvalidAction, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	requestAttempts = 4
+	requestBackoff  = time.Second
+)
+
+// Error is the error response of the AWS APIs.
+type Error struct {
+	// StatusCode is the HTTP status code (e.g. 404).
+	StatusCode int
+	// Code is the error code (e.g. "NoSuchKey", "InvalidInstanceID.NotFound").
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("aws: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// apiError returns the error of the response body, in the S3
+// (<Error>) or EC2 (<Response><Errors><Error>) format.
+func apiError(resp *http.Response, body []byte) error {
+	e := &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+	var s3e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	var ec2e struct {
+		Errors []struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Errors>Error"`
+	}
+	if xml.Unmarshal(body, &ec2e) == nil && len(ec2e.Errors) > 0 {
+		e.Code, e.Message = ec2e.Errors[0].Code, ec2e.Errors[0].Message
+	} else if xml.Unmarshal(body, &s3e) == nil && s3e.Code != "" {
+		e.Code, e.Message = s3e.Code, s3e.Message
+	}
+	return e
+}
+
+// retryable returns true if the error is transient
+// (connection errors, throttling, or server errors).
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case net.Error:
+		return true
+	case *Error:
+		return e.StatusCode >= http.StatusInternalServerError ||
+			e.StatusCode == http.StatusTooManyRequests ||
+			e.Code == "RequestLimitExceeded" || e.Code == "SlowDown"
+	}
+	return false
+}
+
+// retry calls f until it succeeds or returns a permanent error, doubling
+// the backoff between the attempts.
+func retry(ctx context.Context, attempts int, backoff time.Duration, desc string, f func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil || !retryable(err) {
+			return err
+		}
+		glog.Warningf("failed to %s (%v); retrying in %v", desc, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("failed to %s after %d attempts (%v)", desc, attempts, err)
+}
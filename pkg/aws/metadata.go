@@ -0,0 +1,230 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMetadataEndpoint is the endpoint of the EC2 instance metadata service.
+const DefaultMetadataEndpoint = "http://169.254.169.254"
+
+const (
+	// metadataTokenTTL is the TTL of the IMDSv2 session tokens.
+	metadataTokenTTL = 6 * time.Hour
+
+	metadataAttempts = 3
+	metadataBackoff  = 300 * time.Millisecond
+	metadataTimeout  = 5 * time.Second
+
+	// terminationPollInterval is the interval to poll the spot interruption
+	// notice, which is issued two minutes before the instance stops.
+	terminationPollInterval = 5 * time.Second
+)
+
+// TerminationSpot is returned by 'WaitTermination' when the spot instance
+// is interrupted (about two minutes before it stops).
+const TerminationSpot = "spot-interruption"
+
+// ErrMetadataNotFound is returned when the metadata key does not exist.
+var ErrMetadataNotFound = errors.New("aws: metadata not found")
+
+// MetadataClient fetches the instance metadata from the EC2 instance metadata
+// service, with IMDSv2 session tokens. Instance properties are cached, since
+// they do not change while the instance runs.
+type MetadataClient struct {
+	endpoint string
+	client   *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	cache       map[string]string
+}
+
+// NewMetadataClient returns the metadata client of the endpoint. Empty
+// 'endpoint' defaults to "AWS_EC2_METADATA_SERVICE_ENDPOINT" environment
+// variable, or 'DefaultMetadataEndpoint'.
+func NewMetadataClient(endpoint string) *MetadataClient {
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	return &MetadataClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: metadataTimeout},
+		cache:    make(map[string]string),
+	}
+}
+
+// sessionToken returns the IMDSv2 session token, reused until
+// a minute before it expires.
+func (c *MetadataClient) sessionToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.tokenExpiry.Add(-time.Minute)) {
+		return c.token, nil
+	}
+	req, err := http.NewRequest(http.MethodPut, c.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", fmt.Sprint(int64(metadataTokenTTL/time.Second)))
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata token request returned %q", resp.Status)
+	}
+	c.token, c.tokenExpiry = string(b), time.Now().Add(metadataTokenTTL)
+	return c.token, nil
+}
+
+// Get fetches the metadata of the key under "/latest/meta-data/"
+// (e.g. "instance-id"), retrying connection and server errors.
+// Returns 'ErrMetadataNotFound' if the key does not exist.
+func (c *MetadataClient) Get(ctx context.Context, key string) (string, error) {
+	var (
+		v   string
+		err error
+	)
+	for i := 0; i < metadataAttempts; i++ {
+		if i > 0 {
+			glog.Warningf("failed to fetch metadata %q (%v); retrying in %v", key, err, metadataBackoff)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(metadataBackoff):
+			}
+		}
+		var retryable bool
+		v, retryable, err = c.fetch(ctx, key)
+		if err == nil || !retryable || ctx.Err() != nil {
+			return v, err
+		}
+	}
+	return "", fmt.Errorf("could not fetch %q after %d attempt(s) (%v)", key, metadataAttempts, err)
+}
+
+func (c *MetadataClient) fetch(ctx context.Context, key string) (string, bool, error) {
+	token, err := c.sessionToken(ctx)
+	if err != nil {
+		return "", true, err
+	}
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+"/latest/meta-data/"+key, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", false, ErrMetadataNotFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		// token expired or revoked; fetch a new one on retry
+		io.Copy(ioutil.Discard, resp.Body)
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		return "", true, fmt.Errorf("%q returned %q", key, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("%q returned %q", key, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", true, err
+	}
+	return strings.TrimSpace(string(b)), false, nil
+}
+
+func (c *MetadataClient) getCached(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	v, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.cache[key] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// InstanceID returns the ID of the instance (e.g. "i-1234567890abcdef0").
+func (c *MetadataClient) InstanceID(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "instance-id")
+}
+
+// Zone returns the availability zone of the instance (e.g. "us-west-2a").
+func (c *MetadataClient) Zone(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "placement/availability-zone")
+}
+
+// Region returns the region of the instance (e.g. "us-west-2").
+func (c *MetadataClient) Region(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "placement/region")
+}
+
+// InternalIP returns the private IPv4 address of the instance.
+func (c *MetadataClient) InternalIP(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "local-ipv4")
+}
+
+// ExternalIP returns the public IPv4 address of the instance.
+// Returns 'ErrMetadataNotFound' if the instance has no public address.
+func (c *MetadataClient) ExternalIP(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "public-ipv4")
+}
+
+// WaitTermination blocks until the spot instance is interrupted, and returns
+// 'TerminationSpot', so that workers drain and requeue their jobs beforehand.
+// On-demand instances never return until the context is canceled.
+func (c *MetadataClient) WaitTermination(ctx context.Context) (string, error) {
+	ticker := time.NewTicker(terminationPollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := c.Get(ctx, "spot/instance-action")
+		switch err {
+		case nil:
+			glog.Warningf("instance is terminating (%s)", TerminationSpot)
+			return TerminationSpot, nil
+		case ErrMetadataNotFound:
+		default:
+			if ctx.Err() == nil {
+				glog.Warningf("failed to poll spot interruption (%v)", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
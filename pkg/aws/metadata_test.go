@@ -0,0 +1,91 @@
+package aws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetadataClient(t *testing.T) {
+	var tokens, gets int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest/api/token" {
+			if req.Method != http.MethodPut || req.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			atomic.AddInt32(&tokens, 1)
+			w.Write([]byte("token"))
+			return
+		}
+		if req.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		switch req.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234567890abcdef0\n"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-west-2a"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		id, err := c.InstanceID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "i-1234567890abcdef0" {
+			t.Fatalf("unexpected instance ID %q", id)
+		}
+	}
+	zone, err := c.Zone(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone != "us-west-2a" {
+		t.Fatalf("unexpected zone %q", zone)
+	}
+	if _, err = c.ExternalIP(ctx); err != ErrMetadataNotFound {
+		t.Fatalf("expected %v, got %v", ErrMetadataNotFound, err)
+	}
+	// token is reused, instance properties are cached
+	if n := atomic.LoadInt32(&tokens); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+	if n := atomic.LoadInt32(&gets); n != 3 {
+		t.Fatalf("expected 3 metadata requests, got %d", n)
+	}
+}
+
+func TestRoleCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/latest/api/token":
+			w.Write([]byte("token"))
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("worker-role"))
+		case "/latest/meta-data/iam/security-credentials/worker-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"2100-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	cr, err := NewMetadataClient(ts.URL).RoleCredentials().Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.AccessKeyID != "ASIA" || cr.SecretAccessKey != "secret" || cr.SessionToken != "session" || cr.Expiry.Year() != 2100 {
+		t.Fatalf("unexpected credentials %+v", cr)
+	}
+}
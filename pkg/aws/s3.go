@@ -0,0 +1,230 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// S3 stores the objects in an S3 bucket under the prefix,
+// over the REST API with virtual-hosted-style URLs.
+type S3 struct {
+	// endpoint is the URL of the bucket (e.g. "https://bucket.s3.us-west-2.amazonaws.com").
+	endpoint string
+	bucket   string
+	prefix   string
+	region   string
+	creds    CredentialsProvider
+	client   *http.Client
+}
+
+// NewS3 returns the S3 client of the bucket in the region, whose object keys
+// are namespaced with the prefix. Nil 'creds' defaults to 'DefaultCredentials'.
+func NewS3(bucket, region, prefix string, creds CredentialsProvider) *S3 {
+	if creds == nil {
+		creds = DefaultCredentials()
+	}
+	return &S3{
+		endpoint: fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region),
+		bucket:   bucket,
+		prefix:   prefix,
+		region:   region,
+		creds:    creds,
+		client:   http.DefaultClient,
+	}
+}
+
+// ObjectURI returns the URI of the object in the bucket (e.g. "s3://bucket/key").
+func ObjectURI(bucket, object string) string {
+	return "s3://" + bucket + "/" + object
+}
+
+func (s *S3) objectName(key string) string {
+	return path.Join(s.prefix, key)
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u, _ := url.Parse(s.endpoint)
+	u.Path = "/" + s.objectName(key)
+	return u
+}
+
+func (s *S3) signer(ctx context.Context) (signer, error) {
+	cr, err := s.creds.Credentials(ctx)
+	if err != nil {
+		return signer{}, err
+	}
+	return signer{creds: cr, region: s.region, service: "s3"}, nil
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	sg, err := s.signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	ph := emptyPayload
+	if len(body) > 0 {
+		ph = hashHex(body)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", ph)
+	sg.sign(req, ph, time.Now())
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, apiError(resp, b)
+	}
+	return resp, nil
+}
+
+// Upload writes 'r' with 'key' as the object name under the prefix, and
+// returns the object URI (e.g. "s3://bucket/prefix/key"). The data is
+// buffered in memory to sign the payload. Empty 'contentType' is detected
+// from the data. The CRC32C checksum is stored with the object (see 'Stat').
+func (s *S3) Upload(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	h := http.Header{
+		"Content-Type":          {contentType},
+		"X-Amz-Checksum-Crc32c": {crc32cBase64(crc32.Checksum(data, castagnoli))},
+	}
+	err = retry(ctx, requestAttempts, requestBackoff, "upload "+key, func() error {
+		resp, err := s.do(ctx, http.MethodPut, key, data, h)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Body.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return ObjectURI(s.bucket, s.objectName(key)), nil
+}
+
+// Download streams the object of 'key' to 'w', and returns the number of
+// bytes written. Interrupted downloads are resumed from the last byte
+// written, with range requests.
+func (s *S3) Download(ctx context.Context, key string, w io.Writer) (int64, error) {
+	var n int64
+	err := retry(ctx, requestAttempts, requestBackoff, "download "+key, func() error {
+		var h http.Header
+		if n > 0 {
+			h = http.Header{"Range": {fmt.Sprintf("bytes=%d-", n)}}
+		}
+		resp, err := s.do(ctx, http.MethodGet, key, nil, h)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if n > 0 && resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("%q does not support range requests (%q)", key, resp.Status)
+		}
+		// broken connections (net.Error) resume from the last byte written
+		m, err := io.Copy(w, resp.Body)
+		n += m
+		return err
+	})
+	return n, err
+}
+
+// Stat returns the size and the CRC32C checksum (Castagnoli) of the object
+// of 'key'. The objects uploaded without the checksum (e.g. by other tools)
+// return an error.
+func (s *S3) Stat(ctx context.Context, key string) (int64, uint32, error) {
+	var (
+		size int64
+		sum  string
+	)
+	err := retry(ctx, requestAttempts, requestBackoff, "stat "+key, func() error {
+		resp, err := s.do(ctx, http.MethodHead, key, nil, http.Header{"X-Amz-Checksum-Mode": {"ENABLED"}})
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		size, sum = resp.ContentLength, resp.Header.Get("X-Amz-Checksum-Crc32c")
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil || len(b) != 4 {
+		return 0, 0, fmt.Errorf("%q has no CRC32C checksum", key)
+	}
+	return size, binary.BigEndian.Uint32(b), nil
+}
+
+// crc32cBase64 returns the checksum in the "x-amz-checksum-crc32c" format,
+// base64 of the big-endian bytes.
+func crc32cBase64(sum uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], sum)
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// Delete deletes the object of 'key'.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return retry(ctx, requestAttempts, requestBackoff, "delete "+key, func() error {
+		resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Body.Close()
+	})
+}
+
+// SignedURL returns the URL to GET the object of 'key' without
+// credentials, which expires after 'ttl' (at most seven days).
+func (s *S3) SignedURL(key string, ttl time.Duration) (string, error) {
+	if ttl > 7*24*time.Hour {
+		return "", fmt.Errorf("ttl %v exceeds seven days", ttl)
+	}
+	sg, err := s.signer(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return sg.presign(s.objectURL(key), ttl, time.Now()), nil
+}
+
+// ParseObjectURI returns the bucket and object name of the URI
+// (e.g. "s3://bucket/prefix/key").
+func ParseObjectURI(uri string) (bucket, object string, err error) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", fmt.Errorf("%q is not an S3 URI", uri)
+	}
+	ss := strings.SplitN(strings.TrimPrefix(uri, "s3://"), "/", 2)
+	if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+		return "", "", fmt.Errorf("%q has no object name", uri)
+	}
+	return ss[0], ss[1], nil
+}
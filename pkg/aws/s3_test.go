@@ -0,0 +1,121 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string][]byte)
+		sums    = make(map[string]string)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case http.MethodPut:
+			b, _ := ioutil.ReadAll(req.Body)
+			if req.Header.Get("X-Amz-Content-Sha256") != hashHex(b) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[req.URL.Path] = b
+			sums[req.URL.Path] = req.Header.Get("X-Amz-Checksum-Crc32c")
+		case http.MethodHead:
+			b, ok := objects[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if req.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+				w.Header().Set("X-Amz-Checksum-Crc32c", sums[req.URL.Path])
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		case http.MethodGet:
+			b, ok := objects[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+				return
+			}
+			w.Write(b)
+		case http.MethodDelete:
+			delete(objects, req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewS3("bucket", "us-west-2", "jobs", StaticCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	s.endpoint = ts.URL
+	ctx := context.Background()
+
+	uri, err := s.Upload(ctx, "a/model.bin", strings.NewReader("hello"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "s3://bucket/jobs/a/model.bin" {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+	size, sum, err := s.Stat(ctx, "a/model.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 || sum != crc32.Checksum([]byte("hello"), castagnoli) {
+		t.Fatalf("unexpected stat %d %08x", size, sum)
+	}
+
+	var buf bytes.Buffer
+	n, err := s.Download(ctx, "a/model.bin", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || buf.String() != "hello" {
+		t.Fatalf("unexpected download %d %q", n, buf.String())
+	}
+
+	if err = s.Delete(ctx, "a/model.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = s.Stat(ctx, "a/model.bin"); err == nil {
+		t.Fatal("expected error on deleted object")
+	}
+	_, err = s.Download(ctx, "a/model.bin", ioutil.Discard)
+	if e, ok := err.(*Error); !ok || e.Code != "NoSuchKey" {
+		t.Fatalf("expected NoSuchKey, got %v", err)
+	}
+
+	u, err := s.SignedURL("a/model.bin", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(u, "/jobs/a/model.bin?") || !strings.Contains(u, "X-Amz-Signature=") {
+		t.Fatalf("unexpected signed URL %q", u)
+	}
+	if _, err = s.SignedURL("a/model.bin", 8*24*time.Hour); err == nil {
+		t.Fatal("expected error on TTL over seven days")
+	}
+
+	bucket, object, err := ParseObjectURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "bucket" || object != "jobs/a/model.bin" {
+		t.Fatalf("unexpected %q %q", bucket, object)
+	}
+}
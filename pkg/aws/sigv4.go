@@ -0,0 +1,170 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigv4Algorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat  = "20060102T150405Z"
+
+	// unsignedPayload skips the payload hash (e.g. streamed uploads, presigned URLs).
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// emptyPayload is the SHA256 of the empty payload.
+var emptyPayload = hashHex(nil)
+
+func hashHex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signer signs requests with Signature Version 4.
+type signer struct {
+	creds   Credentials
+	region  string
+	service string
+}
+
+func (s signer) scope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format("20060102"), s.region, s.service)
+}
+
+func (s signer) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{sigv4Algorithm, t.Format(amzDateFormat), s.scope(t), hashHex([]byte(canonicalRequest))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.creds.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign signs the request at the time, with the hex SHA256 of the payload
+// (or 'unsignedPayload'), by setting the "Authorization" header. The host,
+// "Content-Type", and "X-Amz-*" headers are signed.
+func (s signer) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	if s.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": requestHost(req)}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var ch bytes.Buffer
+	for _, k := range names {
+		ch.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	cr := strings.Join([]string{
+		req.Method,
+		uriEncode(canonicalPath(req.URL), false),
+		canonicalQuery(req.URL.Query()),
+		ch.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigv4Algorithm, s.creds.AccessKeyID, s.scope(t), signed, s.signature(t, cr)))
+}
+
+// presign returns the URL of the GET request signed in the query,
+// which expires after the TTL.
+func (s signer) presign(u *url.URL, ttl time.Duration, t time.Time) string {
+	t = t.UTC()
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", sigv4Algorithm)
+	q.Set("X-Amz-Credential", s.creds.AccessKeyID+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", fmt.Sprint(int64(ttl/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if s.creds.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.creds.SessionToken)
+	}
+	cr := strings.Join([]string{
+		http.MethodGet,
+		uriEncode(canonicalPath(u), false),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	return u.Scheme + "://" + u.Host + uriEncode(canonicalPath(u), false) + "?" + canonicalQuery(q) + "&X-Amz-Signature=" + s.signature(t, cr)
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func canonicalPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ps []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			ps = append(ps, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(ps, "&")
+}
+
+// uriEncode encodes the string as required by Signature Version 4:
+// unreserved characters as-is, others in uppercase percent-encoding.
+func uriEncode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
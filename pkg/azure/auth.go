@@ -0,0 +1,127 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Resources of the Azure AD tokens.
+const (
+	// ManagementResource is the resource to call Azure Resource Manager.
+	ManagementResource = "https://management.azure.com/"
+	// StorageResource is the resource to access Blob Storage.
+	StorageResource = "https://storage.azure.com/"
+
+	identityAPIVersion = "2018-02-01"
+	loginEndpoint      = "https://login.microsoftonline.com"
+)
+
+// NewTokenSource returns the Azure AD token source of the resource, which
+// refreshes the access tokens before they expire. The tokens are issued to
+// the service principal of "AZURE_TENANT_ID", "AZURE_CLIENT_ID", and
+// "AZURE_CLIENT_SECRET" environment variables if set, or to the managed
+// identity of the VM otherwise.
+func NewTokenSource(resource string) oauth2.TokenSource {
+	tenant, id, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant != "" && id != "" && secret != "" {
+		return oauth2.ReuseTokenSource(nil, &clientSecretTokenSource{
+			endpoint: loginEndpoint,
+			tenant:   tenant,
+			clientID: id,
+			secret:   secret,
+			resource: resource,
+		})
+	}
+	return NewMetadataClient("").TokenSource(resource)
+}
+
+// TokenSource returns the token source of the managed identity of the VM,
+// whose tokens are fetched from the metadata service and reused until
+// they expire.
+func (c *MetadataClient) TokenSource(resource string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &identityTokenSource{c: c, resource: resource})
+}
+
+type identityTokenSource struct {
+	c        *MetadataClient
+	resource string
+}
+
+func (ts *identityTokenSource) Token() (*oauth2.Token, error) {
+	b, err := ts.c.get(context.Background(), "/metadata/identity/oauth2/token", url.Values{
+		"api-version": {identityAPIVersion},
+		"resource":    {ts.resource},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresOn is the expiry in Unix seconds, encoded as string.
+		ExpiresOn string `json:"expires_on"`
+		TokenType string `json:"token_type"`
+	}
+	if err = json.Unmarshal(b, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("metadata service returned empty token for %q", ts.resource)
+	}
+	sec, err := strconv.ParseInt(resp.ExpiresOn, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token expiry %q (%v)", resp.ExpiresOn, err)
+	}
+	return &oauth2.Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType, Expiry: time.Unix(sec, 0)}, nil
+}
+
+type clientSecretTokenSource struct {
+	endpoint string
+	tenant   string
+	clientID string
+	secret   string
+	resource string
+}
+
+func (ts *clientSecretTokenSource) Token() (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {ts.clientID},
+		"client_secret": {ts.secret},
+		"scope":         {strings.TrimSuffix(ts.resource, "/") + "/.default"},
+	}
+	resp, err := http.PostForm(fmt.Sprintf("%s/%s/oauth2/v2.0/token", ts.endpoint, ts.tenant), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request of %q returned %q (%s)", ts.clientID, resp.Status, string(b))
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err = json.Unmarshal(b, &tr); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: tr.AccessToken,
+		TokenType:   tr.TokenType,
+		Expiry:      time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,198 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// blobAPIVersion is the version of the Blob Storage REST API,
+	// and of the shared access signatures.
+	blobAPIVersion = "2019-12-12"
+
+	// MaxBlobUpload is the maximum size of the blob uploaded in a request.
+	MaxBlobUpload = 5000 << 20
+)
+
+// Blob stores the objects as block blobs in a Blob Storage container,
+// under the prefix.
+type Blob struct {
+	// endpoint is the URL of the storage account (e.g. "https://account.blob.core.windows.net").
+	endpoint  string
+	account   string
+	container string
+	prefix    string
+
+	// key is the storage account key, which signs the requests and URLs
+	// with shared access signatures; nil to authenticate with Azure AD.
+	key    []byte
+	client *http.Client
+}
+
+// NewBlob returns the Blob Storage client of the container in the storage
+// account, whose blob names are namespaced with the prefix. 'key' is the
+// storage account key in base64, or empty to authenticate with Azure AD
+// (see 'NewTokenSource'), without signed URLs.
+func NewBlob(ctx context.Context, account, container, prefix, key string) (*Blob, error) {
+	b := &Blob{
+		endpoint:  fmt.Sprintf("https://%s.blob.core.windows.net", account),
+		account:   account,
+		container: container,
+		prefix:    prefix,
+		client:    http.DefaultClient,
+	}
+	if key == "" {
+		b.client = oauth2.NewClient(ctx, NewTokenSource(StorageResource))
+		return b, nil
+	}
+	var err error
+	if b.key, err = base64.StdEncoding.DecodeString(key); err != nil {
+		return nil, fmt.Errorf("storage account key is not base64 (%v)", err)
+	}
+	return b, nil
+}
+
+func (b *Blob) blobName(key string) string {
+	return path.Join(b.prefix, key)
+}
+
+// BlobURL returns the URL of the blob (without credentials).
+func (b *Blob) BlobURL(key string) string {
+	return b.endpoint + "/" + b.container + "/" + b.blobName(key)
+}
+
+// sas returns the service shared access signature of the blob
+// with the permissions (e.g. "r", "cw", "d") until the expiry.
+func (b *Blob) sas(key, perms string, expiry time.Time) url.Values {
+	se := expiry.UTC().Format(time.RFC3339)
+	resource := "/blob/" + b.account + "/" + b.container + "/" + b.blobName(key)
+	// signedPermissions, signedStart, signedExpiry, canonicalizedResource,
+	// signedIdentifier, signedIP, signedProtocol, signedVersion,
+	// signedResource, signedSnapshotTime, and response headers
+	sts := strings.Join([]string{perms, "", se, resource, "", "", "https", blobAPIVersion, "b", "", "", "", "", "", ""}, "\n")
+	h := hmac.New(sha256.New, b.key)
+	h.Write([]byte(sts))
+	return url.Values{
+		"sp":  {perms},
+		"se":  {se},
+		"spr": {"https"},
+		"sv":  {blobAPIVersion},
+		"sr":  {"b"},
+		"sig": {base64.StdEncoding.EncodeToString(h.Sum(nil))},
+	}
+}
+
+func (b *Blob) do(ctx context.Context, method, key, perms string, body []byte, header http.Header) (*http.Response, error) {
+	u := b.BlobURL(key)
+	if b.key != nil {
+		u += "?" + b.sas(key, perms, time.Now().Add(15*time.Minute)).Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("x-ms-version", blobAPIVersion)
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, &Error{StatusCode: resp.StatusCode, Code: resp.Header.Get("x-ms-error-code"), Message: fmt.Sprintf("%q returned %q", b.blobName(key), resp.Status)}
+	}
+	return resp, nil
+}
+
+// Upload writes 'r' as the block blob of 'key' under the prefix, and returns
+// the blob URL (e.g. "https://account.blob.core.windows.net/container/prefix/key").
+// The data is buffered in memory to retry, up to 'MaxBlobUpload' bytes.
+// Empty 'contentType' is detected from the data.
+func (b *Blob) Upload(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxBlobUpload+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxBlobUpload {
+		return "", fmt.Errorf("%q exceeds %d bytes", key, MaxBlobUpload)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	h := http.Header{"x-ms-blob-type": {"BlockBlob"}, "Content-Type": {contentType}}
+	err = retry(ctx, requestAttempts, requestBackoff, "upload "+key, func() error {
+		resp, err := b.do(ctx, http.MethodPut, key, "cw", data, h)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Body.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.BlobURL(key), nil
+}
+
+// Download streams the blob of 'key' to 'w', and returns the number of
+// bytes written. Interrupted downloads are resumed from the last byte
+// written, with range requests.
+func (b *Blob) Download(ctx context.Context, key string, w io.Writer) (int64, error) {
+	var n int64
+	err := retry(ctx, requestAttempts, requestBackoff, "download "+key, func() error {
+		var h http.Header
+		if n > 0 {
+			h = http.Header{"x-ms-range": {fmt.Sprintf("bytes=%d-", n)}}
+		}
+		resp, err := b.do(ctx, http.MethodGet, key, "r", nil, h)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if n > 0 && resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("%q does not support range requests (%q)", key, resp.Status)
+		}
+		// broken connections (net.Error) resume from the last byte written
+		m, err := io.Copy(w, resp.Body)
+		n += m
+		return err
+	})
+	return n, err
+}
+
+// Delete deletes the blob of 'key'.
+func (b *Blob) Delete(ctx context.Context, key string) error {
+	return retry(ctx, requestAttempts, requestBackoff, "delete "+key, func() error {
+		resp, err := b.do(ctx, http.MethodDelete, key, "d", nil, nil)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Body.Close()
+	})
+}
+
+// SignedURL returns the URL to GET the blob of 'key' without credentials,
+// which expires after 'ttl'. Requires the storage account key.
+func (b *Blob) SignedURL(key string, ttl time.Duration) (string, error) {
+	if b.key == nil {
+		return "", fmt.Errorf("no storage account key to sign %q", key)
+	}
+	return b.BlobURL(key) + "?" + b.sas(key, "r", time.Now().Add(ttl)).Encode(), nil
+}
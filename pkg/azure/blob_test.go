@@ -0,0 +1,106 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBlob(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("account-key"))
+	b, err := NewBlob(context.Background(), "account", "jobs", "v1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu    sync.Mutex
+		blobs = make(map[string][]byte)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// verify the signature of the permissions in the request
+		name := strings.TrimPrefix(req.URL.Path, "/jobs/v1/")
+		q := req.URL.Query()
+		se, err := time.Parse(time.RFC3339, q.Get("se"))
+		if err != nil || q.Get("sig") != b.sas(name, q.Get("sp"), se).Get("sig") {
+			w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case http.MethodPut:
+			if req.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blobs[name], _ = ioutil.ReadAll(req.Body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			v, ok := blobs[name]
+			if !ok {
+				w.Header().Set("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(v)
+		case http.MethodDelete:
+			delete(blobs, name)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer ts.Close()
+	b.endpoint = ts.URL
+	ctx := context.Background()
+
+	u, err := b.Upload(ctx, "a/model.bin", strings.NewReader("hello"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != ts.URL+"/jobs/v1/a/model.bin" {
+		t.Fatalf("unexpected URL %q", u)
+	}
+	var buf bytes.Buffer
+	n, err := b.Download(ctx, "a/model.bin", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || buf.String() != "hello" {
+		t.Fatalf("unexpected download %d %q", n, buf.String())
+	}
+
+	su, err := b.SignedURL("a/model.bin", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(su)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "hello" {
+		t.Fatalf("unexpected signed URL download %q", data)
+	}
+
+	if err = b.Delete(ctx, "a/model.bin"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Download(ctx, "a/model.bin", ioutil.Discard)
+	if e, ok := err.(*Error); !ok || e.Code != "BlobNotFound" {
+		t.Fatalf("expected BlobNotFound, got %v", err)
+	}
+
+	b.key = nil
+	if _, err = b.SignedURL("a/model.bin", time.Hour); err == nil {
+		t.Fatal("expected error without storage account key")
+	}
+}
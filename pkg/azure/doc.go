@@ -0,0 +1,4 @@
+// Package azure implements the cloud abstractions of pkg/cloud on Azure: the
+// instance metadata service (IMDS), Blob Storage, and virtual machine scale
+// sets, over the REST APIs authenticated with Azure AD tokens.
+package azure
@@ -0,0 +1,60 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	requestAttempts = 4
+	requestBackoff  = time.Second
+)
+
+// Error is the error response of the Azure APIs.
+type Error struct {
+	// StatusCode is the HTTP status code (e.g. 404).
+	StatusCode int
+	// Code is the error code (e.g. "BlobNotFound", "ResourceNotFound").
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("azure: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// retryable returns true if the error is transient
+// (connection errors, throttling, or server errors).
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case net.Error:
+		return true
+	case *Error:
+		return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retry calls f until it succeeds or returns a permanent error, doubling
+// the backoff between the attempts.
+func retry(ctx context.Context, attempts int, backoff time.Duration, desc string, f func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil || !retryable(err) {
+			return err
+		}
+		glog.Warningf("failed to %s (%v); retrying in %v", desc, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("failed to %s after %d attempts (%v)", desc, attempts, err)
+}
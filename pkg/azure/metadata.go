@@ -0,0 +1,275 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMetadataEndpoint is the endpoint of the Azure instance metadata service.
+const DefaultMetadataEndpoint = "http://169.254.169.254"
+
+const (
+	metadataAPIVersion       = "2021-02-01"
+	scheduledEventAPIVersion = "2020-07-01"
+
+	metadataAttempts = 3
+	metadataBackoff  = 300 * time.Millisecond
+	metadataTimeout  = 5 * time.Second
+
+	// terminationPollInterval is the interval to poll the scheduled events,
+	// which are issued at least 30 seconds before spot VMs are evicted.
+	terminationPollInterval = 5 * time.Second
+)
+
+// Reasons of the instance termination, returned by 'WaitTermination'.
+const (
+	// TerminationPreempted is returned when the spot VM is evicted.
+	TerminationPreempted = "preempted"
+	// TerminationScheduled is returned when the VM is deleted
+	// (e.g. by scale-in of the scale set).
+	TerminationScheduled = "terminated"
+)
+
+// ErrMetadataNotFound is returned when the metadata key does not exist.
+var ErrMetadataNotFound = errors.New("azure: metadata not found")
+
+// MetadataClient fetches the instance metadata from the Azure instance
+// metadata service. Instance properties are cached, since they do not
+// change while the instance runs.
+type MetadataClient struct {
+	endpoint string
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewMetadataClient returns the metadata client of the endpoint.
+// Empty 'endpoint' defaults to 'DefaultMetadataEndpoint'.
+func NewMetadataClient(endpoint string) *MetadataClient {
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	return &MetadataClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: metadataTimeout},
+		cache:    make(map[string]string),
+	}
+}
+
+// get fetches the metadata of the path (e.g. "/metadata/instance/compute/vmId")
+// with the query, retrying connection and server errors.
+func (c *MetadataClient) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	for i := 0; i < metadataAttempts; i++ {
+		if i > 0 {
+			glog.Warningf("failed to fetch metadata %q (%v); retrying in %v", path, err, metadataBackoff)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(metadataBackoff):
+			}
+		}
+		var retryable bool
+		b, retryable, err = c.fetch(ctx, path, query)
+		if err == nil || !retryable || ctx.Err() != nil {
+			return b, err
+		}
+	}
+	return nil, fmt.Errorf("could not fetch %q after %d attempt(s) (%v)", path, metadataAttempts, err)
+}
+
+func (c *MetadataClient) fetch(ctx context.Context, path string, query url.Values) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	// required, and never set by proxies, against SSRF
+	req.Header.Set("Metadata", "true")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, ErrMetadataNotFound
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return nil, true, fmt.Errorf("%q returned %q", path, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("%q returned %q (%s)", path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return b, false, nil
+}
+
+// Get fetches the instance metadata of the key under "/metadata/instance/"
+// in text (e.g. "compute/vmId"). Returns 'ErrMetadataNotFound' if the key
+// does not exist.
+func (c *MetadataClient) Get(ctx context.Context, key string) (string, error) {
+	b, err := c.get(ctx, "/metadata/instance/"+key, url.Values{"api-version": {metadataAPIVersion}, "format": {"text"}})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (c *MetadataClient) getCached(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	v, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.cache[key] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// InstanceID returns the unique ID of the VM.
+func (c *MetadataClient) InstanceID(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "compute/vmId")
+}
+
+// Location returns the region of the VM (e.g. "westus2").
+func (c *MetadataClient) Location(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "compute/location")
+}
+
+// Zone returns the availability zone of the VM as "location-zone"
+// (e.g. "westus2-1"), or the location if the VM is not zonal.
+func (c *MetadataClient) Zone(ctx context.Context) (string, error) {
+	loc, err := c.Location(ctx)
+	if err != nil {
+		return "", err
+	}
+	zone, err := c.getCached(ctx, "compute/zone")
+	if err != nil && err != ErrMetadataNotFound {
+		return "", err
+	}
+	if zone == "" {
+		return loc, nil
+	}
+	return loc + "-" + zone, nil
+}
+
+// SubscriptionID returns the subscription of the VM.
+func (c *MetadataClient) SubscriptionID(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "compute/subscriptionId")
+}
+
+// ResourceGroup returns the resource group of the VM.
+func (c *MetadataClient) ResourceGroup(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "compute/resourceGroupName")
+}
+
+// InternalIP returns the private IPv4 address of the first network interface.
+func (c *MetadataClient) InternalIP(ctx context.Context) (string, error) {
+	return c.getCached(ctx, "network/interface/0/ipv4/ipAddress/0/privateIpAddress")
+}
+
+// ExternalIP returns the public IPv4 address of the first network interface.
+// Returns 'ErrMetadataNotFound' if the VM has no public address.
+func (c *MetadataClient) ExternalIP(ctx context.Context) (string, error) {
+	ip, err := c.getCached(ctx, "network/interface/0/ipv4/ipAddress/0/publicIpAddress")
+	if err == nil && ip == "" {
+		err = ErrMetadataNotFound
+	}
+	return ip, err
+}
+
+// ScheduledEvent is the maintenance event scheduled for the VMs.
+type ScheduledEvent struct {
+	EventID string `json:"EventId"`
+	// EventType is "Preempt", "Terminate", "Reboot", "Redeploy", or "Freeze".
+	EventType string
+	Resources []string
+	NotBefore string
+}
+
+// ScheduledEvents returns the maintenance events scheduled for the VMs
+// of the deployment (e.g. spot eviction).
+func (c *MetadataClient) ScheduledEvents(ctx context.Context) ([]ScheduledEvent, error) {
+	b, err := c.get(ctx, "/metadata/scheduledevents", url.Values{"api-version": {scheduledEventAPIVersion}})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Events []ScheduledEvent
+	}
+	if err = json.Unmarshal(b, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Events, nil
+}
+
+// WaitTermination blocks until the VM is about to be evicted or deleted,
+// and returns the reason, so that workers drain and requeue their jobs
+// beforehand. Returns an error if canceled first.
+func (c *MetadataClient) WaitTermination(ctx context.Context) (string, error) {
+	name, err := c.getCached(ctx, "compute/name")
+	if err != nil {
+		return "", err
+	}
+	ticker := time.NewTicker(terminationPollInterval)
+	defer ticker.Stop()
+	for {
+		evs, err := c.ScheduledEvents(ctx)
+		if err != nil && ctx.Err() == nil {
+			glog.Warningf("failed to poll scheduled events (%v)", err)
+		}
+		if reason := terminationReason(evs, name); reason != "" {
+			glog.Warningf("instance is terminating (%s)", reason)
+			return reason, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// terminationReason returns the reason of the termination event
+// of the VM, or empty if none is scheduled.
+func terminationReason(evs []ScheduledEvent, name string) string {
+	for _, ev := range evs {
+		affected := false
+		for _, r := range ev.Resources {
+			if r == name {
+				affected = true
+			}
+		}
+		if !affected {
+			continue
+		}
+		switch ev.EventType {
+		case "Preempt":
+			return TerminationPreempted
+		case "Terminate":
+			return TerminationScheduled
+		}
+	}
+	return ""
+}
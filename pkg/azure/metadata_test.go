@@ -0,0 +1,99 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetadataClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.URL.Path {
+		case "/metadata/instance/compute/vmId":
+			w.Write([]byte("02aab8a4-74ef-476e-8182-f6d2ba4166a6"))
+		case "/metadata/instance/compute/location":
+			w.Write([]byte("westus2"))
+		case "/metadata/instance/compute/zone":
+			w.Write([]byte("1"))
+		case "/metadata/instance/compute/name":
+			w.Write([]byte("workers_3"))
+		case "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress":
+			// VMs without public address return empty
+		case "/metadata/scheduledevents":
+			w.Write([]byte(`{"Events":[{"EventId":"1","EventType":"Preempt","Resources":["workers_3"]}]}`))
+		case "/metadata/identity/oauth2/token":
+			if req.URL.Query().Get("resource") != StorageResource {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"token","expires_on":"4102444800","token_type":"Bearer"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL)
+	ctx := context.Background()
+	id, err := c.InstanceID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "02aab8a4-74ef-476e-8182-f6d2ba4166a6" {
+		t.Fatalf("unexpected instance ID %q", id)
+	}
+	zone, err := c.Zone(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone != "westus2-1" {
+		t.Fatalf("unexpected zone %q", zone)
+	}
+	if _, err = c.ExternalIP(ctx); err != ErrMetadataNotFound {
+		t.Fatalf("expected %v, got %v", ErrMetadataNotFound, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	reason, err := c.WaitTermination(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != TerminationPreempted {
+		t.Fatalf("expected %q, got %q", TerminationPreempted, reason)
+	}
+
+	tok, err := c.TokenSource(StorageResource).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token" || tok.Expiry.Year() != 2100 {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+}
+
+func TestTerminationReason(t *testing.T) {
+	evs := []ScheduledEvent{
+		{EventType: "Reboot", Resources: []string{"vm0"}},
+		{EventType: "Terminate", Resources: []string{"vm1", "vm2"}},
+	}
+	tests := []struct {
+		name string
+		exp  string
+	}{
+		{"vm0", ""},
+		{"vm2", TerminationScheduled},
+		{"vm3", ""},
+	}
+	for i, tt := range tests {
+		if v := terminationReason(evs, tt.name); v != tt.exp {
+			t.Fatalf("#%d: expected %q, got %q", i, tt.exp, v)
+		}
+	}
+}
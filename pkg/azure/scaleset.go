@@ -0,0 +1,140 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	managementEndpoint = "https://management.azure.com"
+	computeAPIVersion  = "2021-07-01"
+)
+
+// ScaleSet resizes a virtual machine scale set, to scale the number
+// of workers on queue pressure (e.g. as the scaler of the autoscaler).
+type ScaleSet struct {
+	endpoint string
+	// id is the resource ID of the scale set
+	// ("/subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachineScaleSets/<name>").
+	id     string
+	client *http.Client
+}
+
+// NewScaleSet returns the scale set in the subscription and resource group,
+// authenticated with Azure AD (see 'NewTokenSource').
+func NewScaleSet(ctx context.Context, subscription, group, name string) *ScaleSet {
+	return &ScaleSet{
+		endpoint: managementEndpoint,
+		id:       fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s", subscription, group, name),
+		client:   oauth2.NewClient(ctx, NewTokenSource(ManagementResource)),
+	}
+}
+
+// String returns the resource ID of the scale set.
+func (s *ScaleSet) String() string { return s.id }
+
+func (s *ScaleSet) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return retry(ctx, requestAttempts, requestBackoff, method+" "+s.id+path, func() error {
+		req, err := http.NewRequest(method, s.endpoint+s.id+path+"?api-version="+computeAPIVersion, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			var er struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			json.Unmarshal(b, &er)
+			return &Error{StatusCode: resp.StatusCode, Code: er.Error.Code, Message: er.Error.Message}
+		}
+		if out == nil || len(b) == 0 {
+			return nil
+		}
+		return json.Unmarshal(b, out)
+	})
+}
+
+// Capacity returns the number of VMs the scale set is configured to run.
+func (s *ScaleSet) Capacity(ctx context.Context) (int, error) {
+	var resp struct {
+		SKU struct {
+			Capacity int `json:"capacity"`
+		} `json:"sku"`
+	}
+	if err := s.do(ctx, http.MethodGet, "", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.SKU.Capacity, nil
+}
+
+// Instances returns the names of the VMs in the scale set,
+// from the oldest to the newest.
+func (s *ScaleSet) Instances(ctx context.Context) ([]string, error) {
+	var resp struct {
+		Value []struct {
+			InstanceID string `json:"instanceId"`
+			Name       string `json:"name"`
+		} `json:"value"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/virtualMachines", nil, &resp); err != nil {
+		return nil, err
+	}
+	// instance IDs increase as the VMs are created
+	vms := resp.Value
+	sort.SliceStable(vms, func(i, j int) bool {
+		a, _ := strconv.Atoi(vms[i].InstanceID)
+		b, _ := strconv.Atoi(vms[j].InstanceID)
+		return a < b
+	})
+	names := make([]string, len(vms))
+	for i, vm := range vms {
+		names[i] = vm.Name
+	}
+	return names, nil
+}
+
+// Scale sets the capacity of the scale set to the number of workers.
+// The scale-in policy of the scale set picks the VMs to delete.
+func (s *ScaleSet) Scale(ctx context.Context, workers int) error {
+	if workers < 0 {
+		workers = 0
+	}
+	n, err := s.Capacity(ctx)
+	if err != nil {
+		return err
+	}
+	if n == workers {
+		return nil
+	}
+	glog.Infof("resizing scale set %q from %d to %d", s.id, n, workers)
+	req := map[string]interface{}{"sku": map[string]int{"capacity": workers}}
+	return s.do(ctx, http.MethodPatch, "", req, nil)
+}
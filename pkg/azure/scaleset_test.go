@@ -0,0 +1,72 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScaleSet(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		capacity = 2
+		patches  int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/virtualMachines"):
+			fmt.Fprint(w, `{"value":[{"instanceId":"10","name":"workers_10"},{"instanceId":"2","name":"workers_2"}]}`)
+		case req.Method == http.MethodGet:
+			fmt.Fprintf(w, `{"sku":{"capacity":%d}}`, capacity)
+		case req.Method == http.MethodPatch:
+			var r struct {
+				SKU struct {
+					Capacity int `json:"capacity"`
+				} `json:"sku"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			capacity = r.SKU.Capacity
+			patches++
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer ts.Close()
+
+	s := &ScaleSet{endpoint: ts.URL, id: "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachineScaleSets/workers", client: http.DefaultClient}
+	ctx := context.Background()
+
+	names, err := s.Instances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"workers_2", "workers_10"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected %q, got %q", exp, names)
+	}
+	if err = s.Scale(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Scale(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Capacity(ctx); err != nil || n != 5 {
+		t.Fatalf("expected capacity 5, got %d (%v)", n, err)
+	}
+	if patches != 1 {
+		t.Fatalf("expected 1 resize, got %d", patches)
+	}
+}
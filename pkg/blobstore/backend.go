@@ -0,0 +1,154 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Backend stores complete blobs (e.g. job artifacts, queue backups, dataset
+// files) by their slash-separated keys, in the local file system, Cloud
+// Storage, or S3, selected by 'Config' (see 'Open').
+type Backend interface {
+	// Put writes the blob of the key, and returns its URI (e.g.
+	// "file:///dir/key", "gs://bucket/prefix/key", "s3://bucket/prefix/key").
+	// Empty 'contentType' is detected from the data.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+
+	// Get streams the blob to 'w', and returns the number of bytes written,
+	// or 'ErrNotFound'.
+	Get(ctx context.Context, key string, w io.Writer) (int64, error)
+
+	// Stat returns the size and the CRC32C checksum (Castagnoli) of the blob,
+	// or 'ErrNotFound'.
+	Stat(ctx context.Context, key string) (int64, uint32, error)
+
+	// SignedURL returns the URL to GET the blob without credentials,
+	// which expires after 'ttl'.
+	SignedURL(key string, ttl time.Duration) (string, error)
+
+	// Delete deletes the blob. It returns nil if the blob does not exist.
+	Delete(ctx context.Context, key string) error
+
+	// URI returns the URI of the blob of the key, as returned by 'Put'.
+	URI(key string) string
+}
+
+// Drivers of 'Config'.
+const (
+	DriverLocal = "local"
+	DriverGCS   = "gcs"
+	DriverS3    = "s3"
+)
+
+// Config configures the backend.
+type Config struct {
+	// Driver is "local", "gcs", or "s3".
+	Driver string
+
+	// Dir is the directory of the "local" driver.
+	Dir string
+	// URL is the base URL of the "local" blobs to sign URLs to
+	// (e.g. "http://localhost:2200/blobs/"), served by 'FS'.
+	URL string
+	// Secret signs the URLs of the "local" blobs.
+	Secret []byte
+
+	// Bucket is the bucket of the "gcs" and "s3" drivers, whose
+	// object names are namespaced with Prefix.
+	Bucket string
+	Prefix string
+	// Region is the region of the "s3" bucket,
+	// defaults to the "AWS_REGION" environment variable.
+	Region string
+	// Key is the GCP service account JSON key of the "gcs" driver
+	// (empty for the instance service account, without signed URLs).
+	Key []byte
+	// ReadOnly is true to access the "gcs" bucket with the read-only scope.
+	ReadOnly bool
+}
+
+// ParseURL returns the configuration of the backend URL: the directory
+// ("/var/lib/dplearn/blobs" or "file:///var/lib/dplearn/blobs"), the Cloud
+// Storage bucket ("gs://bucket/prefix"), or the S3 bucket
+// ("s3://bucket/prefix?region=us-west-2").
+func ParseURL(s string) (Config, error) {
+	if !strings.Contains(s, "://") {
+		if s == "" {
+			return Config{}, fmt.Errorf("empty blob store URL")
+		}
+		return Config{Driver: DriverLocal, Dir: s}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Config{}, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return Config{}, fmt.Errorf("%q has no directory", s)
+		}
+		return Config{Driver: DriverLocal, Dir: u.Path}, nil
+	case "gs", "s3":
+		if u.Host == "" {
+			return Config{}, fmt.Errorf("%q has no bucket", s)
+		}
+		cfg := Config{Driver: DriverGCS, Bucket: u.Host, Prefix: strings.Trim(u.Path, "/")}
+		if u.Scheme == "s3" {
+			cfg.Driver, cfg.Region = DriverS3, u.Query().Get("region")
+		}
+		return cfg, nil
+	default:
+		return Config{}, fmt.Errorf("unknown blob store scheme %q (expected 'file', 'gs', or 's3')", u.Scheme)
+	}
+}
+
+// Open returns the backend of the configuration.
+func Open(ctx context.Context, cfg Config) (Backend, error) {
+	switch cfg.Driver {
+	case DriverLocal:
+		return NewFS(cfg.Dir, cfg.URL, cfg.Secret)
+	case DriverGCS:
+		return newGCS(ctx, cfg)
+	case DriverS3:
+		if cfg.Region == "" {
+			cfg.Region = os.Getenv("AWS_REGION")
+		}
+		if cfg.Region == "" {
+			return nil, fmt.Errorf("s3 bucket %q has no region", cfg.Bucket)
+		}
+		return newS3(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store driver %q", cfg.Driver)
+	}
+}
+
+// KeyOf returns the key of the blob URI in the backend,
+// or false if the URI is not of the backend.
+func KeyOf(b Backend, uri string) (string, bool) {
+	prefix := strings.TrimSuffix(b.URI(""), "/") + "/"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(uri, prefix)
+	return key, validKey(key) == nil
+}
+
+// validKey returns 'ErrInvalidKey' if the key is empty, absolute,
+// or has the empty, "." or ".." elements.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key {
+		return ErrInvalidKey
+	}
+	for _, el := range strings.Split(key, "/") {
+		if el == "." || el == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package blobstore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url string
+		cfg Config
+		err bool
+	}{
+		{url: "/var/lib/blobs", cfg: Config{Driver: DriverLocal, Dir: "/var/lib/blobs"}},
+		{url: "file:///var/lib/blobs", cfg: Config{Driver: DriverLocal, Dir: "/var/lib/blobs"}},
+		{url: "gs://bucket", cfg: Config{Driver: DriverGCS, Bucket: "bucket"}},
+		{url: "gs://bucket/a/b/", cfg: Config{Driver: DriverGCS, Bucket: "bucket", Prefix: "a/b"}},
+		{url: "s3://bucket/jobs?region=us-west-2", cfg: Config{Driver: DriverS3, Bucket: "bucket", Prefix: "jobs", Region: "us-west-2"}},
+		{url: "", err: true},
+		{url: "gs:///prefix", err: true},
+		{url: "azure://container", err: true},
+	}
+	for i, tt := range tests {
+		cfg, err := ParseURL(tt.url)
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: %q unexpected error %v", i, tt.url, err)
+		}
+		if !reflect.DeepEqual(cfg, tt.cfg) {
+			t.Fatalf("#%d: expected %+v, got %+v", i, tt.cfg, cfg)
+		}
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	b := &s3{bucket: "bucket", prefix: "jobs"}
+	tests := []struct {
+		uri string
+		key string
+		ok  bool
+	}{
+		{uri: "s3://bucket/jobs/cats-request/req-1/output.png", key: "cats-request/req-1/output.png", ok: true},
+		{uri: "s3://bucket/jobs/../etc/passwd", key: "../etc/passwd"},
+		{uri: "s3://bucket/jobsx/a"},
+		{uri: "gs://bucket/jobs/a"},
+	}
+	for i, tt := range tests {
+		key, ok := KeyOf(b, tt.uri)
+		if ok != tt.ok || (ok && key != tt.key) {
+			t.Fatalf("#%d: expected %q %v, got %q %v", i, tt.key, tt.ok, key, ok)
+		}
+	}
+}
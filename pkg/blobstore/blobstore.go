@@ -0,0 +1,37 @@
+package blobstore
+
+import (
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNotFound is returned when the blob is not found.
+	ErrNotFound = fmt.Errorf("blobstore: blob not found")
+
+	// ErrInvalidKey is returned when the blob key is not valid.
+	ErrInvalidKey = fmt.Errorf("blobstore: invalid key")
+
+	// ErrInvalidSignature is returned when the signed URL of
+	// the blob is not valid, or has expired.
+	ErrInvalidSignature = fmt.Errorf("blobstore: invalid or expired signature")
+)
+
+// Store defines blob storage, where blobs can be written incrementally.
+type Store interface {
+	// Append appends data to the blob, creating one if not exists.
+	// It returns the number of bytes written.
+	Append(key string, r io.Reader) (int64, error)
+
+	// Size returns the current size of the blob, or 'ErrNotFound'.
+	Size(key string) (int64, error)
+
+	// Open returns the reader of the blob, or 'ErrNotFound'.
+	Open(key string) (io.ReadCloser, error)
+
+	// Put overwrites the blob with the data.
+	Put(key string, data []byte) error
+
+	// Delete deletes the blob. It returns nil if the blob does not exist.
+	Delete(key string) error
+}
@@ -0,0 +1,5 @@
+// Package blobstore implements blob storage abstraction: 'Store' for partial
+// and complete uploads, and 'Backend' for complete blobs (job artifacts,
+// queue backups, dataset files) in the local file system, Cloud Storage,
+// or S3.
+package blobstore
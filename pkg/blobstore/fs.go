@@ -0,0 +1,207 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// FS implements Backend with the local file system. Its signed URLs
+// are served by 'ServeBlob' at the base URL.
+type FS struct {
+	dir string
+	// url is the base URL of the blobs, empty to not sign URLs.
+	url    *url.URL
+	secret []byte
+}
+
+// NewFS returns the backend of the directory, creating one if not exists.
+// The signed URLs are under 'baseURL' (e.g. "http://localhost:2200/blobs/"),
+// signed with the secret. Empty 'baseURL' disables the signed URLs.
+func NewFS(dir, baseURL string, secret []byte) (*FS, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("empty blob store directory")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = fileutil.TouchDirAll(dir); err != nil {
+		return nil, err
+	}
+	fs := &FS{dir: dir}
+	if baseURL != "" {
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("signed URLs of %q require the secret", dir)
+		}
+		if fs.url, err = url.Parse(strings.TrimSuffix(baseURL, "/") + "/"); err != nil {
+			return nil, err
+		}
+		fs.secret = secret
+	}
+	return fs, nil
+}
+
+func (fs *FS) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	p, err := fileutil.SecureJoin(fs.dir, filepath.FromSlash(key))
+	if err != nil {
+		return "", ErrInvalidKey
+	}
+	return p, nil
+}
+
+// Put writes the blob to a temporary file first, so that
+// readers never see the partial blob.
+func (fs *FS) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err = fileutil.TouchDirAll(filepath.Dir(p)); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), fileutil.PrivateFileMode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return fs.URI(key), nil
+}
+
+func (fs *FS) open(key string) (*os.File, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs *FS) Get(ctx context.Context, key string, w io.Writer) (int64, error) {
+	f, err := fs.open(key)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// Stat computes the checksum from the file.
+func (fs *FS) Stat(ctx context.Context, key string) (int64, uint32, error) {
+	f, err := fs.open(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	h := crc32.New(castagnoli)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return n, h.Sum32(), nil
+}
+
+// SignedURL returns the URL under the base URL, with the expiry
+// and the HMAC-SHA256 signature of the key in the query.
+func (fs *FS) SignedURL(key string, ttl time.Duration) (string, error) {
+	if fs.url == nil {
+		return "", fmt.Errorf("blob store %q has no URL to sign", fs.dir)
+	}
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	u := *fs.url
+	u.Path += key
+	u.RawQuery = url.Values{"expires": {expires}, "signature": {fs.sign(key, expires)}}.Encode()
+	return u.String(), nil
+}
+
+func (fs *FS) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, fs.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeBlob serves the blob of the signed URL, mounted at the path of
+// the base URL. It returns 'ErrNotFound' or 'ErrInvalidSignature' without
+// writing the response, for the caller to write the error.
+func (fs *FS) ServeBlob(w http.ResponseWriter, req *http.Request) error {
+	if fs.url == nil || !strings.HasPrefix(req.URL.Path, fs.url.Path) {
+		return ErrNotFound
+	}
+	key := strings.TrimPrefix(req.URL.Path, fs.url.Path)
+	q := req.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!hmac.Equal([]byte(q.Get("signature")), []byte(fs.sign(key, q.Get("expires")))) {
+		return ErrInvalidSignature
+	}
+	f, err := fs.open(key)
+	if err != nil {
+		return ErrNotFound
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	http.ServeContent(w, req, key, fi.ModTime(), f)
+	return nil
+}
+
+func (fs *FS) Delete(ctx context.Context, key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *FS) URI(key string) string {
+	return "file://" + filepath.ToSlash(filepath.Join(fs.dir, filepath.FromSlash(key)))
+}
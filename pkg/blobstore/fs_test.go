@@ -0,0 +1,124 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFS(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	b, err := NewFS(dir, ts.URL+"/blobs", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/blobs/", func(w http.ResponseWriter, req *http.Request) {
+		switch err := b.ServeBlob(w, req); err {
+		case nil:
+		case ErrNotFound:
+			http.NotFound(w, req)
+		case ErrInvalidSignature:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	ctx := context.Background()
+
+	if _, err = b.Put(ctx, "../foo", strings.NewReader("a"), ""); err != ErrInvalidKey {
+		t.Fatalf("expected %v, got %v", ErrInvalidKey, err)
+	}
+	if _, _, err = b.Stat(ctx, "backups/foo.json"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	uri, err := b.Put(ctx, "backups/foo.json", strings.NewReader("hello"), "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "file://"+filepath.ToSlash(filepath.Join(dir, "backups", "foo.json")) {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+	if key, ok := KeyOf(b, uri); !ok || key != "backups/foo.json" {
+		t.Fatalf("unexpected key %q %v", key, ok)
+	}
+	size, sum, err := b.Stat(ctx, "backups/foo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 || sum != crc32.Checksum([]byte("hello"), castagnoli) {
+		t.Fatalf("unexpected stat %d %08x", size, sum)
+	}
+	var buf bytes.Buffer
+	if _, err = b.Get(ctx, "backups/foo.json", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello" {
+		t.Fatalf("unexpected data %q", buf.String())
+	}
+
+	u, err := b.SignedURL("backups/foo.json", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(u string) (int, string) {
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		d, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(d)
+	}
+	if code, body := get(u); code != http.StatusOK || body != "hello" {
+		t.Fatalf("unexpected response %d %q", code, body)
+	}
+	if code, _ := get(strings.Split(u, "?")[0]); code != http.StatusForbidden {
+		t.Fatalf("expected 403 on unsigned URL, got %d", code)
+	}
+	if code, _ := get(strings.Replace(u, "foo.json", "bar.json", 1)); code != http.StatusForbidden {
+		t.Fatalf("expected 403 on tampered URL, got %d", code)
+	}
+	expired, err := b.SignedURL("backups/foo.json", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get(expired); code != http.StatusForbidden {
+		t.Fatalf("expected 403 on expired URL, got %d", code)
+	}
+
+	if err = b.Delete(ctx, "backups/foo.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Get(ctx, "backups/foo.json", ioutil.Discard); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if err = b.Delete(ctx, "backups/foo.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := NewFS(dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = unsigned.SignedURL("backups/foo.json", time.Minute); err == nil {
+		t.Fatal("expected error without the base URL")
+	}
+}
@@ -0,0 +1,101 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"path"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/gcp"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcs implements Backend with a Cloud Storage bucket,
+// whose object names are namespaced with the prefix.
+type gcs struct {
+	bucket string
+	prefix string
+	b      *gcp.Bucket
+}
+
+func newGCS(ctx context.Context, cfg Config) (Backend, error) {
+	scope := storage.ScopeReadWrite
+	if cfg.ReadOnly {
+		scope = storage.ScopeReadOnly
+	}
+	b, err := gcp.NewBucket(ctx, cfg.Bucket, cfg.Key, scope)
+	if err != nil {
+		return nil, err
+	}
+	return &gcs{bucket: cfg.Bucket, prefix: cfg.Prefix, b: b}, nil
+}
+
+func (s *gcs) object(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, key), nil
+}
+
+// gcsError converts the missing object error to 'ErrNotFound'.
+func gcsError(err error) error {
+	if err == storage.ErrObjectNotExist {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *gcs) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return "", err
+	}
+	return s.b.Upload(ctx, obj, r, contentType)
+}
+
+func (s *gcs) Get(ctx context.Context, key string, w io.Writer) (int64, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.b.Download(ctx, obj, w)
+	return n, gcsError(err)
+}
+
+func (s *gcs) Stat(ctx context.Context, key string) (int64, uint32, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, sum, err := s.b.Stat(ctx, obj)
+	return size, sum, gcsError(err)
+}
+
+func (s *gcs) SignedURL(key string, ttl time.Duration) (string, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return "", err
+	}
+	return s.b.SignedURL(obj, ttl)
+}
+
+func (s *gcs) Delete(ctx context.Context, key string) error {
+	obj, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	if err = gcsError(s.b.Delete(ctx, obj)); err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Close closes the client.
+func (s *gcs) Close() error {
+	return s.b.Close()
+}
+
+func (s *gcs) URI(key string) string {
+	return gcp.ObjectURI(s.bucket, path.Join(s.prefix, key))
+}
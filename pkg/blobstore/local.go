@@ -0,0 +1,119 @@
+package blobstore
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+// local implements Store with local file system.
+type local struct {
+	dir string
+	// shred is true to overwrite the blobs before removing.
+	shred bool
+}
+
+// NewLocal returns a new blob store backed by the directory,
+// creating one if not exists.
+func NewLocal(dir string) (Store, error) {
+	if err := fileutil.TouchDirAll(dir); err != nil {
+		return nil, err
+	}
+	return &local{dir: dir}, nil
+}
+
+// NewLocalShred returns a new blob store backed by the directory, like
+// 'NewLocal', that shreds the deleted blobs (see 'fileutil.Shred').
+func NewLocalShred(dir string) (Store, error) {
+	if err := fileutil.TouchDirAll(dir); err != nil {
+		return nil, err
+	}
+	return &local{dir: dir, shred: true}, nil
+}
+
+func (s *local) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", ErrInvalidKey
+	}
+	p, err := fileutil.SecureJoin(s.dir, key)
+	if err != nil {
+		return "", ErrInvalidKey
+	}
+	return p, nil
+}
+
+func (s *local) Append(key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, fileutil.PrivateFileMode)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// write as much as possible, even on read errors
+	// (e.g. client disconnect), so that uploads can be resumed
+	n, err := io.Copy(f, r)
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	return n, err
+}
+
+func (s *local) Size(key string) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *local) Open(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *local) Put(key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteToFile(p, data)
+}
+
+func (s *local) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if s.shred {
+		err = fileutil.Shred(p)
+	} else {
+		err = os.Remove(p)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package blobstore
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T)      { testLocal(t, NewLocal) }
+func TestLocalShred(t *testing.T) { testLocal(t, NewLocalShred) }
+
+func testLocal(t *testing.T, newStore func(dir string) (Store, error)) {
+	dir, err := ioutil.TempDir(os.TempDir(), "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Size("foo"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if _, err = s.Append("../foo", strings.NewReader("a")); err != ErrInvalidKey {
+		t.Fatalf("expected %v, got %v", ErrInvalidKey, err)
+	}
+
+	for _, v := range []string{"hello", " ", "world"} {
+		if _, err = s.Append("foo", strings.NewReader(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, err := s.Size("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 11 {
+		t.Fatalf("expected 11, got %d", size)
+	}
+
+	rc, err := s.Open("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("unexpected data %q", string(data))
+	}
+
+	if err = s.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Open("foo"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if err = s.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+}
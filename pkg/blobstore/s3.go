@@ -0,0 +1,73 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/aws"
+)
+
+// s3 implements Backend with an S3 bucket,
+// whose object names are namespaced with the prefix.
+type s3 struct {
+	bucket string
+	prefix string
+	s      *aws.S3
+}
+
+func newS3(cfg Config) Backend {
+	return &s3{bucket: cfg.Bucket, prefix: cfg.Prefix, s: aws.NewS3(cfg.Bucket, cfg.Region, cfg.Prefix, nil)}
+}
+
+// s3Error converts the missing object error to 'ErrNotFound'.
+func s3Error(err error) error {
+	if e, ok := err.(*aws.Error); ok && e.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *s3) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return s.s.Upload(ctx, key, r, contentType)
+}
+
+func (s *s3) Get(ctx context.Context, key string, w io.Writer) (int64, error) {
+	if err := validKey(key); err != nil {
+		return 0, err
+	}
+	n, err := s.s.Download(ctx, key, w)
+	return n, s3Error(err)
+}
+
+func (s *s3) Stat(ctx context.Context, key string) (int64, uint32, error) {
+	if err := validKey(key); err != nil {
+		return 0, 0, err
+	}
+	size, sum, err := s.s.Stat(ctx, key)
+	return size, sum, s3Error(err)
+}
+
+func (s *s3) SignedURL(key string, ttl time.Duration) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return s.s.SignedURL(key, ttl)
+}
+
+// Delete succeeds on the missing objects, as S3 does.
+func (s *s3) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	return s.s.Delete(ctx, key)
+}
+
+func (s *s3) URI(key string) string {
+	return aws.ObjectURI(s.bucket, path.Join(s.prefix, key))
+}
@@ -0,0 +1,47 @@
+package cloud
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// MetadataProvider returns the identity of the instance from the metadata
+// service of the cloud (e.g. GCE metadata server, EC2 IMDSv2).
+type MetadataProvider interface {
+	// InstanceID returns the ID of the instance.
+	InstanceID(ctx context.Context) (string, error)
+	// Zone returns the zone of the instance (e.g. "us-west1-b", "us-west-2a").
+	Zone(ctx context.Context) (string, error)
+	// InternalIP returns the private IP of the instance.
+	InternalIP(ctx context.Context) (string, error)
+	// ExternalIP returns the public IP of the instance.
+	ExternalIP(ctx context.Context) (string, error)
+	// WaitTermination blocks until the instance is about to be reclaimed
+	// (e.g. preemption, spot interruption), and returns the reason.
+	WaitTermination(ctx context.Context) (string, error)
+}
+
+// ObjectStore stores the objects (e.g. job artifacts) in the cloud storage
+// (e.g. Cloud Storage, S3), under the prefix of the store.
+type ObjectStore interface {
+	// Upload writes the object of the key, and returns its URI
+	// (e.g. "gs://bucket/v1/prefix/key", "s3://bucket/prefix/key").
+	Upload(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+	// Download streams the object of the key to 'w', and returns
+	// the number of bytes written.
+	Download(ctx context.Context, key string, w io.Writer) (int64, error)
+	// SignedURL returns the URL to GET the object of the key without
+	// credentials, until the TTL expires.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// InstanceManager boots and deletes the ephemeral worker instances
+// (e.g. as the scaler of the autoscaler).
+type InstanceManager interface {
+	// Instances returns the names (or IDs) of the instances,
+	// from the oldest to the newest.
+	Instances(ctx context.Context) ([]string, error)
+	// Scale boots or deletes the instances, to the number of workers.
+	Scale(ctx context.Context, workers int) error
+}
@@ -0,0 +1,22 @@
+package cloud_test
+
+import (
+	"github.com/gyuho/dplearn/pkg/aws"
+	"github.com/gyuho/dplearn/pkg/azure"
+	"github.com/gyuho/dplearn/pkg/cloud"
+	"github.com/gyuho/dplearn/pkg/gcp"
+)
+
+var (
+	_ cloud.MetadataProvider = &gcp.MetadataClient{}
+	_ cloud.ObjectStore      = &gcp.Storage{}
+	_ cloud.InstanceManager  = &gcp.InstancePool{}
+
+	_ cloud.MetadataProvider = &aws.MetadataClient{}
+	_ cloud.ObjectStore      = &aws.S3{}
+	_ cloud.InstanceManager  = &aws.InstancePool{}
+
+	_ cloud.MetadataProvider = &azure.MetadataClient{}
+	_ cloud.ObjectStore      = &azure.Blob{}
+	_ cloud.InstanceManager  = &azure.ScaleSet{}
+)
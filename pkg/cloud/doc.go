@@ -0,0 +1,4 @@
+// Package cloud defines the cloud provider abstractions (instance metadata,
+// object storage, and instances), implemented by pkg/gcp, pkg/aws, and pkg/azure,
+// so that dplearn is deployed to any of the clouds without code forks.
+package cloud
@@ -0,0 +1,125 @@
+package config
+
+import "time"
+
+// Config is the configuration of the dplearn components.
+type Config struct {
+	Backend    Backend    `yaml:"backend,omitempty"`
+	Queue      Queue      `yaml:"queue,omitempty"`
+	Worker     Worker     `yaml:"worker,omitempty"`
+	Generators Generators `yaml:"generators,omitempty"`
+
+	// sources maps the field paths to the sources of the values.
+	sources map[string]string
+}
+
+// Backend configures backend-web-server.
+type Backend struct {
+	WebScheme string `yaml:"web-scheme"`
+	WebHost   string `yaml:"web-host"`
+	// GRPCHost is the address of the worker gRPC service, empty to disable.
+	// The service does not authenticate the workers: keep it private.
+	GRPCHost string `yaml:"grpc-host"`
+	// WorkerToken is the token of the worker registrations,
+	// empty to only accept the registrations from the loopback.
+	WorkerToken string `yaml:"worker-token"`
+
+	ShredUploads             bool   `yaml:"shred-uploads"`
+	MinDiskSpace             string `yaml:"min-disk-space"`
+	MaxConcurrentSubmissions int    `yaml:"max-concurrent-submissions"`
+	MaxJobAttempts           int    `yaml:"max-job-attempts"`
+
+	CanaryVersion string `yaml:"canary-version"`
+	CanaryPercent int    `yaml:"canary-percent"`
+
+	Autoscale           bool `yaml:"autoscale"`
+	AutoscaleMinWorkers int  `yaml:"autoscale-min-workers"`
+	AutoscaleMaxWorkers int  `yaml:"autoscale-max-workers"`
+
+	Users bool `yaml:"users"`
+	// SessionSecret is the secret, or secret reference (e.g. "env:SESSION_SECRET").
+	SessionSecret string        `yaml:"session-secret"`
+	SessionTTL    time.Duration `yaml:"session-ttl"`
+	LoginRequired bool          `yaml:"login-required"`
+	Admins        string        `yaml:"admins"`
+	Audit         bool          `yaml:"audit"`
+
+	Coordinator         bool          `yaml:"coordinator"`
+	CoordinatorInterval time.Duration `yaml:"coordinator-interval"`
+	Scheduler           bool          `yaml:"scheduler"`
+	SchedulerInterval   time.Duration `yaml:"scheduler-interval"`
+	Features            bool          `yaml:"features"`
+	Deployment          string        `yaml:"deployment"`
+
+	BlobStore      string        `yaml:"blob-store"`
+	BlobSecret     string        `yaml:"blob-secret"`
+	BackupInterval time.Duration `yaml:"backup-interval"`
+
+	GCPKeyPath       string  `yaml:"gcp-key-path"`
+	OTLPEndpoint     string  `yaml:"otlp-endpoint"`
+	TraceSampleRatio float64 `yaml:"trace-sample-ratio"`
+
+	NotificationsConfig string `yaml:"notifications-config"`
+	QuotasConfig        string `yaml:"quotas-config"`
+	PipelinesConfig     string `yaml:"pipelines-config"`
+	RuntimeConfig       string `yaml:"runtime-config"`
+}
+
+// Queue configures the embedded etcd of the queue in backend-web-server.
+type Queue struct {
+	PortClient int    `yaml:"port-client" flag:"queue-port-client"`
+	PortPeer   int    `yaml:"port-peer" flag:"queue-port-peer"`
+	DataDir    string `yaml:"data-dir"`
+}
+
+// Worker configures worker-go.
+type Worker struct {
+	Endpoint         string        `yaml:"endpoint"`
+	RegistryEndpoint string        `yaml:"registry-endpoint"`
+	Version          string        `yaml:"version"`
+	Concurrency      int           `yaml:"concurrency"`
+	DrainTimeout     time.Duration `yaml:"drain-timeout"`
+	JobTimeout       time.Duration `yaml:"job-timeout"`
+
+	Runtime     string `yaml:"runtime"`
+	Model       string `yaml:"model"`
+	ModelName   string `yaml:"model-name"`
+	InputLayout string `yaml:"input-layout"`
+	ImageSize   int    `yaml:"image-size"`
+	Sidecar     string `yaml:"sidecar"`
+	// SidecarSocket connects to the running sidecar model server.
+	SidecarSocket string `yaml:"sidecar-socket"`
+
+	WatchPreemption bool   `yaml:"watch-preemption"`
+	Cloud           string `yaml:"cloud"`
+	CacheDir        string `yaml:"cache-dir"`
+	CacheBudget     string `yaml:"cache-budget"`
+	GCPKeyPath      string `yaml:"gcp-key-path"`
+}
+
+// Generators configures the generator commands (gen-*).
+type Generators struct {
+	Dockerfiles   Generator   `yaml:"dockerfiles,omitempty"`
+	StartupScript Generator   `yaml:"startup-script,omitempty"`
+	FrontendDep   FrontendDep `yaml:"frontend-dep,omitempty"`
+	NginxConf     NginxConf   `yaml:"nginx-conf,omitempty"`
+}
+
+// Generator configures the generator of its configuration file
+// (e.g. "container.yaml" of gen-dockerfiles).
+type Generator struct {
+	Config string `yaml:"config"`
+}
+
+// FrontendDep configures gen-frontend-dep.
+type FrontendDep struct {
+	Config string `yaml:"config"`
+	// BackendHost overrides "backend-host" of the config (e.g. "backend:2200").
+	BackendHost string `yaml:"backend-host"`
+}
+
+// NginxConf configures gen-nginx-conf.
+type NginxConf struct {
+	Output     string `yaml:"output"`
+	TargetPort int    `yaml:"target-port"`
+}
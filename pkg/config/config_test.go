@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("backend-web-server", flag.ContinueOnError)
+	fs.String("web-scheme", "http", "")
+	fs.String("web-host", "localhost:2200", "")
+	fs.String("grpc-host", "localhost:2201", "")
+	fs.Int("queue-port-client", 22000, "")
+	fs.Int("queue-port-peer", 22001, "")
+	fs.String("data-dir", "/tmp/etcd-data", "")
+	fs.Int("max-job-attempts", 3, "")
+	fs.Bool("users", false, "")
+	fs.String("session-secret", "", "")
+	fs.String("admins", "", "")
+	fs.Duration("scheduler-interval", 10*time.Second, "")
+	fs.Float64("trace-sample-ratio", 0.1, "")
+	// not in the configuration
+	fs.Bool("maintenance", false, "")
+	return fs
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dplearn.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+backend:
+  web-host: 0.0.0.0:2200
+  max-job-attempts: 5
+  scheduler-interval: 1m
+queue:
+  port-client: 23000
+  port-peer: 23001
+worker:
+  concurrency: 8
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"DPLEARN_BACKEND_MAX_JOB_ATTEMPTS": "7",
+		"DPLEARN_QUEUE_PORT_PEER":          "23002",
+		"DPLEARN_WORKER_CONCURRENCY":       "2",
+	}
+	lookupEnv := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	fs := newFlagSet()
+	f := AddFlags(fs, "backend", "queue")
+	if err = fs.Parse([]string{"-dplearn-config", path, "-queue-port-peer", "23003", "-users", "-session-secret", "env:SECRET"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(f.Path, lookupEnv, fs, "backend", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path, source, flag, value string
+	}{
+		{"backend.web-scheme", sourceDefault, "web-scheme", "http"},
+		{"backend.web-host", sourceFile, "web-host", "0.0.0.0:2200"},
+		{"backend.max-job-attempts", sourceEnv, "max-job-attempts", "7"},
+		{"backend.scheduler-interval", sourceFile, "scheduler-interval", "1m0s"},
+		{"backend.users", sourceFlag, "users", "true"},
+		{"queue.port-client", sourceFile, "queue-port-client", "23000"},
+		{"queue.port-peer", sourceFlag, "queue-port-peer", "23003"},
+		{"queue.data-dir", sourceDefault, "data-dir", "/tmp/etcd-data"},
+	} {
+		if src := cfg.Source(tt.path); src != tt.source {
+			t.Fatalf("%s: expected source %q, got %q", tt.path, tt.source, src)
+		}
+		if v := fs.Lookup(tt.flag).Value.String(); v != tt.value {
+			t.Fatalf("-%s: expected %q, got %q", tt.flag, tt.value, v)
+		}
+	}
+	if cfg.Backend.WebHost != "0.0.0.0:2200" || cfg.Backend.MaxJobAttempts != 7 || cfg.Queue.PortPeer != 23003 || cfg.Backend.TraceSampleRatio != 0.1 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	// the unbound sections are from the file and the environment only
+	if cfg.Worker.Concurrency != 2 || cfg.Source("worker.concurrency") != sourceEnv {
+		t.Fatalf("unexpected worker config %+v", cfg.Worker)
+	}
+
+	var buf bytes.Buffer
+	if err = cfg.Print(&buf, "backend", "queue"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"#   backend.max-job-attempts: env\n", "  web-host: 0.0.0.0:2200\n", "  port-peer: 23003\n"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("expected %q in\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "\nworker:") {
+		t.Fatalf("unexpected worker section in\n%s", out)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	noEnv := func(string) (string, bool) { return "", false }
+	for i, tt := range []struct {
+		yaml string
+		args []string
+		err  string
+	}{
+		{yaml: "backend:\n  web-hots: :2200\n", err: "web-hots"},
+		{args: []string{"-queue-port-client", "2200"}, err: "queue.port-client 2200 conflicts"},
+		{args: []string{"-users"}, err: "backend.users requires backend.session-secret"},
+		{yaml: "backend:\n  admins: alice\n", err: "backend.admins requires backend.users"},
+		{yaml: "queue:\n  port-peer: 22000\n", err: "same port"},
+		{yaml: "backend:\n  trace-sample-ratio: 2\n  web-host: localhost\n", err: "backend.web-host \"localhost\""},
+	} {
+		fs := newFlagSet()
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		path := ""
+		if tt.yaml != "" {
+			path = filepath.Join(dir, "dplearn.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := Load(path, noEnv, fs, "backend", "queue")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("#%d: expected error with %q, got %v", i, tt.err, err)
+		}
+	}
+
+	_, err = Load("", func(k string) (string, bool) { return "x", k == "DPLEARN_QUEUE_PORT_CLIENT" }, newFlagSet(), "backend", "queue")
+	if err == nil || !strings.Contains(err.Error(), "DPLEARN_QUEUE_PORT_CLIENT") {
+		t.Fatalf("expected environment error, got %v", err)
+	}
+}
+
+func TestValidateWorker(t *testing.T) {
+	w := Worker{Endpoint: "http://localhost:2200", Concurrency: 1, Runtime: "onnx", ImageSize: 64, ModelName: "cats", Cloud: "gcp", CacheBudget: "20GB"}
+	cfg := &Config{Worker: w}
+	if err := cfg.Validate("worker"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Worker.Version, cfg.Worker.Runtime = "v2", "pytorch"
+	err := cfg.Validate("worker")
+	if err == nil || !strings.Contains(err.Error(), "worker.version requires") || !strings.Contains(err.Error(), "worker.runtime \"pytorch\"") {
+		t.Fatalf("expected all errors, got %v", err)
+	}
+	// the sidecar loads the model
+	cfg.Worker = Worker{Endpoint: "http://localhost:2200", Concurrency: 1, Sidecar: "python3 model_server.py"}
+	if err = cfg.Validate("worker"); err != nil {
+		t.Fatal(err)
+	}
+}
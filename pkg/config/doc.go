@@ -0,0 +1,25 @@
+// Package config defines the typed configuration of the dplearn components
+// (backend, queue, workers, and generators), loaded with the precedence:
+//
+//  1. command-line flags, given explicitly
+//  2. environment variables, "DPLEARN_" and the upper-cased path of the
+//     field (e.g. "DPLEARN_BACKEND_WEB_HOST", "DPLEARN_QUEUE_PORT_CLIENT")
+//  3. configuration file (-dplearn-config), in YAML
+//  4. defaults of the command-line flags
+//
+// Each command binds the sections it reads to its flags (see 'AddFlags'),
+// so that the flags not given on the command line are set to the effective
+// configuration. The flags not in the configuration are command-line only.
+// With -validate-config, the command prints the effective configuration
+// and exits, non-zero if invalid.
+//
+//	backend:
+//	  web-host: 0.0.0.0:2200
+//	  users: true
+//	  session-secret: env:SESSION_SECRET
+//	queue:
+//	  data-dir: /var/lib/etcd
+//	worker:
+//	  endpoint: http://backend:2200
+//	  concurrency: 4
+package config
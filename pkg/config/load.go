@@ -0,0 +1,337 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// envPrefix is the prefix of the environment variables of the fields.
+const envPrefix = "DPLEARN_"
+
+// Sources of the effective field values.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// Flags are the command-line flags of the configuration (see 'AddFlags').
+type Flags struct {
+	// Path is the configuration file path (-dplearn-config).
+	Path string
+	// Validate is true to print the effective configuration and exit
+	// (-validate-config).
+	Validate bool
+
+	fs       *flag.FlagSet
+	sections []string
+}
+
+// AddFlags adds -dplearn-config and -validate-config to the flag set, and
+// binds its flags to the fields of the sections (e.g. "backend", "queue",
+// "generators.nginx-conf"). A field is bound to the flag of the same name
+// as the field, or of its "flag" tag (e.g. "queue.port-client" to
+// -queue-port-client).
+func AddFlags(fs *flag.FlagSet, sections ...string) *Flags {
+	for _, s := range sections {
+		if _, ok := lookup(reflect.ValueOf(&Config{}).Elem(), s); !ok {
+			panic(fmt.Sprintf("config: unknown section %q", s))
+		}
+	}
+	f := &Flags{fs: fs, sections: sections}
+	fs.StringVar(&f.Path, "dplearn-config", "", "Specify the dplearn configuration file (YAML), overridden by the 'DPLEARN_*' environment variables and the command-line flags.")
+	fs.BoolVar(&f.Validate, "validate-config", false, "'true' to print the effective configuration from -dplearn-config, the environment variables, and the flags, and exit (non-zero if invalid).")
+	return f
+}
+
+// Load loads the configuration after the flags are parsed (see 'Load').
+func (f *Flags) Load() (*Config, error) {
+	return Load(f.Path, os.LookupEnv, f.fs, f.sections...)
+}
+
+// Apply loads the configuration after the flags are parsed. With
+// -validate-config, it prints the effective configuration to stdout
+// and exits, with status 1 if invalid.
+func (f *Flags) Apply() (*Config, error) {
+	cfg, err := f.Load()
+	if !f.Validate {
+		return cfg, err
+	}
+	if cfg != nil {
+		cfg.Print(os.Stdout, f.sections...)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+	return cfg, nil
+}
+
+// Load returns the configuration of the file (empty to skip), overridden
+// by the environment variables, and the flags given on the command line.
+// The flags bound to the fields of the sections, not given on the command
+// line, are set to the effective values of the fields, and the fields not
+// in the file or the environment default to the flag defaults. The
+// configuration is returned with the validation error of the sections.
+func Load(path string, lookupEnv func(string) (string, bool), fs *flag.FlagSet, sections ...string) (*Config, error) {
+	cfg := &Config{sources: make(map[string]string)}
+	var fileKeys map[interface{}]interface{}
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(b, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if err = yaml.Unmarshal(b, &fileKeys); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	given := make(map[string]bool)
+	if fs != nil {
+		fs.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+	}
+	var errs []string
+	walk(reflect.ValueOf(cfg).Elem(), "", func(f field) {
+		if present(fileKeys, f.path) {
+			cfg.sources[f.path] = sourceFile
+		}
+		if s, ok := lookupEnv(f.env()); ok {
+			if err := setValue(f.v, s); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", f.env(), err))
+				return
+			}
+			cfg.sources[f.path] = sourceEnv
+		}
+		if fs == nil || !inSections(f.path, sections) {
+			return
+		}
+		fl := fs.Lookup(f.flag)
+		if fl == nil {
+			return
+		}
+		switch {
+		case given[f.flag]:
+			if err := setValue(f.v, fl.Value.String()); err != nil {
+				errs = append(errs, fmt.Sprintf("-%s: %v", f.flag, err))
+				return
+			}
+			cfg.sources[f.path] = sourceFlag
+		case cfg.sources[f.path] != "":
+			if err := fs.Set(f.flag, formatValue(f.v)); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", f.path, err))
+			}
+		default:
+			if err := setValue(f.v, fl.DefValue); err != nil {
+				errs = append(errs, fmt.Sprintf("-%s default: %v", f.flag, err))
+				return
+			}
+			cfg.sources[f.path] = sourceDefault
+		}
+	})
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return cfg, cfg.Validate(sections...)
+}
+
+// Print writes the configuration of the sections (all if empty) in YAML,
+// after the comments of the fields not from the flag defaults.
+func (c *Config) Print(w io.Writer, sections ...string) error {
+	out := &Config{}
+	if len(sections) == 0 {
+		*out = *c
+	}
+	for _, s := range sections {
+		src, _ := lookup(reflect.ValueOf(c).Elem(), s)
+		dst, _ := lookup(reflect.ValueOf(out).Elem(), s)
+		dst.Set(src)
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# effective configuration (flags > environment > file > defaults)\n")
+	paths := make([]string, 0, len(c.sources))
+	for p, src := range c.sources {
+		if src != sourceDefault && (len(sections) == 0 || inSections(p, sections)) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&buf, "#   %s: %s\n", p, c.sources[p])
+	}
+	buf.Write(b)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Source returns where the effective value of the field (e.g.
+// "backend.web-host") is from: "flag", "env", "file", or "default",
+// or empty if not set.
+func (c *Config) Source(path string) string {
+	return c.sources[path]
+}
+
+// field is the leaf field of the configuration.
+type field struct {
+	// path is the dot-separated YAML names (e.g. "backend.web-host").
+	path string
+	// flag is the name of the bound flag.
+	flag string
+	v    reflect.Value
+}
+
+// env returns the environment variable of the field
+// (e.g. "DPLEARN_BACKEND_WEB_HOST").
+func (f field) env() string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(f.path))
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walk calls fn with the leaf fields of the struct, in the order of declaration.
+func walk(v reflect.Value, prefix string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := yamlName(sf)
+		if name == "" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if sf.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), path, fn)
+			continue
+		}
+		fl := sf.Tag.Get("flag")
+		if fl == "" {
+			fl = name
+		}
+		fn(field{path: path, flag: fl, v: v.Field(i)})
+	}
+}
+
+// yamlName returns the YAML name of the field, or empty if not serialized.
+func yamlName(sf reflect.StructField) string {
+	if sf.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// lookup returns the field of the dot-separated YAML names.
+func lookup(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if yamlName(v.Type().Field(i)) == name {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
+}
+
+// present returns true if the YAML document has the key of the path.
+func present(m map[interface{}]interface{}, path string) bool {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		v, ok := m[name]
+		if !ok {
+			return false
+		}
+		if i == len(names)-1 {
+			return true
+		}
+		if m, ok = v.(map[interface{}]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// inSections returns true if the field path is in any of the sections.
+func inSections(path string, sections []string) bool {
+	for _, s := range sections {
+		if path == s || strings.HasPrefix(path, s+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
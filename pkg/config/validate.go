@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Validate returns the error of all the invalid fields of the sections
+// (all if empty), including the fields across the sections (e.g. the
+// queue ports conflicting with the backend port).
+func (c *Config) Validate(sections ...string) error {
+	in := func(s string) bool { return len(sections) == 0 || inSections(s, sections) }
+
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	if in("backend") {
+		c.Backend.validate(check)
+	}
+	if in("queue") {
+		c.Queue.validate(check)
+	}
+	if in("backend") && in("queue") {
+		web, grpc := port(c.Backend.WebHost), port(c.Backend.GRPCHost)
+		for _, p := range []struct {
+			name string
+			port int
+		}{{"queue.port-client", c.Queue.PortClient}, {"queue.port-peer", c.Queue.PortPeer}} {
+			check(p.port == 0 || (p.port != web && p.port != grpc), "%s %d conflicts with backend.web-host or backend.grpc-host", p.name, p.port)
+		}
+	}
+	if in("worker") {
+		c.Worker.validate(check)
+	}
+	if in("generators.frontend-dep") && c.Generators.FrontendDep.BackendHost != "" {
+		check(port(c.Generators.FrontendDep.BackendHost) > 0, "generators.frontend-dep.backend-host %q is not 'host:port'", c.Generators.FrontendDep.BackendHost)
+	}
+	if in("generators.nginx-conf") {
+		p := c.Generators.NginxConf.TargetPort
+		check(p == 0 || validPort(p), "generators.nginx-conf.target-port %d is out of range", p)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func (b Backend) validate(check func(bool, string, ...interface{})) {
+	check(b.WebScheme == "" || b.WebScheme == "http" || b.WebScheme == "https", "backend.web-scheme %q is not 'http' or 'https'", b.WebScheme)
+	check(port(b.WebHost) > 0, "backend.web-host %q is not 'host:port'", b.WebHost)
+	if b.GRPCHost != "" {
+		check(port(b.GRPCHost) > 0, "backend.grpc-host %q is not 'host:port'", b.GRPCHost)
+		check(port(b.GRPCHost) != port(b.WebHost), "backend.grpc-host %q conflicts with backend.web-host %q", b.GRPCHost, b.WebHost)
+	}
+	if b.MinDiskSpace != "" {
+		_, err := humanize.ParseBytes(b.MinDiskSpace)
+		check(err == nil, "backend.min-disk-space %q is not a size (e.g. '1GB')", b.MinDiskSpace)
+	}
+	check(b.MaxConcurrentSubmissions >= 0, "backend.max-concurrent-submissions %d is negative", b.MaxConcurrentSubmissions)
+	check(b.MaxJobAttempts >= 0, "backend.max-job-attempts %d is negative", b.MaxJobAttempts)
+	check(b.CanaryPercent >= 0 && b.CanaryPercent <= 100, "backend.canary-percent %d is not in [0, 100]", b.CanaryPercent)
+	check(b.CanaryPercent == 0 || b.CanaryVersion != "", "backend.canary-percent requires backend.canary-version")
+	check(b.AutoscaleMinWorkers >= 0, "backend.autoscale-min-workers %d is negative", b.AutoscaleMinWorkers)
+	check(b.AutoscaleMaxWorkers == 0 || b.AutoscaleMinWorkers <= b.AutoscaleMaxWorkers, "backend.autoscale-min-workers %d exceeds backend.autoscale-max-workers %d", b.AutoscaleMinWorkers, b.AutoscaleMaxWorkers)
+	check(!b.Users || b.SessionSecret != "", "backend.users requires backend.session-secret")
+	check(!b.LoginRequired || b.Users, "backend.login-required requires backend.users")
+	check(b.Admins == "" || b.Users, "backend.admins requires backend.users")
+	check(b.SessionTTL >= 0, "backend.session-ttl %v is negative", b.SessionTTL)
+	check(!b.Coordinator || b.CoordinatorInterval > 0, "backend.coordinator requires positive backend.coordinator-interval")
+	check(!b.Scheduler || b.SchedulerInterval > 0, "backend.scheduler requires positive backend.scheduler-interval")
+	check(b.Deployment == "" || b.Features, "backend.deployment requires backend.features")
+	check(b.BackupInterval >= 0, "backend.backup-interval %v is negative", b.BackupInterval)
+	check(b.BackupInterval == 0 || b.BlobStore != "", "backend.backup-interval requires backend.blob-store")
+	check(b.BlobSecret == "" || b.BlobStore != "", "backend.blob-secret requires backend.blob-store")
+	check(b.TraceSampleRatio >= 0 && b.TraceSampleRatio <= 1, "backend.trace-sample-ratio %v is not in [0, 1]", b.TraceSampleRatio)
+	if b.OTLPEndpoint != "" {
+		check(httpURL(b.OTLPEndpoint), "backend.otlp-endpoint %q is not an HTTP URL", b.OTLPEndpoint)
+	}
+}
+
+func (q Queue) validate(check func(bool, string, ...interface{})) {
+	check(validPort(q.PortClient), "queue.port-client %d is out of range", q.PortClient)
+	check(validPort(q.PortPeer), "queue.port-peer %d is out of range", q.PortPeer)
+	check(q.PortClient != q.PortPeer, "queue.port-client and queue.port-peer are the same port %d", q.PortClient)
+	check(q.DataDir != "", "queue.data-dir is empty")
+}
+
+func (w Worker) validate(check func(bool, string, ...interface{})) {
+	check(httpURL(w.Endpoint), "worker.endpoint %q is not an HTTP URL", w.Endpoint)
+	if w.RegistryEndpoint != "" {
+		check(httpURL(w.RegistryEndpoint), "worker.registry-endpoint %q is not an HTTP URL", w.RegistryEndpoint)
+	}
+	check(w.Version == "" || w.RegistryEndpoint != "", "worker.version requires worker.registry-endpoint")
+	check(w.Concurrency >= 1, "worker.concurrency %d is less than 1", w.Concurrency)
+	check(w.DrainTimeout >= 0, "worker.drain-timeout %v is negative", w.DrainTimeout)
+	check(w.JobTimeout >= 0, "worker.job-timeout %v is negative", w.JobTimeout)
+	if w.Sidecar == "" && w.SidecarSocket == "" {
+		// the model is loaded by the worker, not by the sidecar
+		check(w.Runtime == "tensorflow" || w.Runtime == "onnx", "worker.runtime %q is not 'tensorflow' or 'onnx'", w.Runtime)
+		check(w.InputLayout == "" || w.InputLayout == "nhwc" || w.InputLayout == "nchw", "worker.input-layout %q is not 'nhwc' or 'nchw'", w.InputLayout)
+		check(w.ImageSize > 0, "worker.image-size %d is not positive", w.ImageSize)
+		check(w.Model != "" || w.ModelName != "", "worker requires worker.model, worker.model-name, or worker.sidecar")
+	}
+	check(!w.WatchPreemption || w.Cloud == "gcp" || w.Cloud == "aws" || w.Cloud == "azure", "worker.cloud %q is not 'gcp', 'aws', or 'azure'", w.Cloud)
+	if w.CacheBudget != "" {
+		_, err := humanize.ParseBytes(w.CacheBudget)
+		check(err == nil, "worker.cache-budget %q is not a size (e.g. '20GB')", w.CacheBudget)
+	}
+}
+
+// port returns the port of the 'host:port' address, or 0 if invalid.
+func port(hostPort string) int {
+	_, p, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || !validPort(n) {
+		return 0
+	}
+	return n
+}
+
+func validPort(p int) bool { return p > 0 && p < 65536 }
+
+func httpURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
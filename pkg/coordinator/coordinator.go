@@ -0,0 +1,271 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/golang/glog"
+)
+
+// Source provides the fleet state to the leader.
+type Source interface {
+	// Workers returns the workers in the registry.
+	Workers() []workerproc.Liveness
+	// Depth returns the number of jobs waiting in the bucket.
+	Depth(ctx context.Context, bucket string) (int64, error)
+	// InMaintenance returns true if the server is in maintenance mode.
+	InMaintenance() bool
+}
+
+// Config defines coordinator configuration.
+type Config struct {
+	// Name identifies the server in the election (e.g. "backend-1:2200").
+	Name string
+	// Prefix is the etcd key prefix of the election, decisions,
+	// and intents. Defaults to "_coordinator".
+	Prefix string
+	// Interval is the interval to recompute the decisions.
+	// Defaults to 30 seconds.
+	Interval time.Duration
+	// TTL is the leader lease TTL, after which other servers take over
+	// when the leader is gone. Defaults to 10 seconds.
+	TTL time.Duration
+
+	// Source provides the fleet state.
+	Source Source
+}
+
+var errNotLeader = errors.New("coordinator: not the leader")
+
+// Coordinator campaigns for the leadership, makes the decisions while
+// leading, and keeps the latest decisions of the leader on every server.
+type Coordinator struct {
+	cli *clientv3.Client
+	cfg Config
+
+	mu        sync.RWMutex
+	leading   bool
+	decisions Decisions
+	intents   Intents
+}
+
+// New creates a new coordinator.
+func New(cli *clientv3.Client, cfg Config) *Coordinator {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_coordinator"
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 10 * time.Second
+	}
+	return &Coordinator{cli: cli, cfg: cfg}
+}
+
+func (c *Coordinator) electionKey() string  { return path.Join(c.cfg.Prefix, "election") }
+func (c *Coordinator) decisionsKey() string { return path.Join(c.cfg.Prefix, "decisions") }
+func (c *Coordinator) intentsKey() string   { return path.Join(c.cfg.Prefix, "intents") }
+
+// Leading returns true if the server is the leader.
+func (c *Coordinator) Leading() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.leading
+}
+
+// Decisions returns the latest decisions of the leader.
+func (c *Coordinator) Decisions() Decisions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.decisions
+}
+
+// Intents returns the latest operator intents.
+func (c *Coordinator) Intents() Intents {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.intents
+}
+
+// SetIntents stores the operator intents, to be decided on
+// by the leader in the next interval.
+func (c *Coordinator) SetIntents(ctx context.Context, in Intents) error {
+	sort.Strings(in.Drains)
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if _, err = c.cli.Put(ctx, c.intentsKey(), string(data)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.intents = in
+	c.mu.Unlock()
+	glog.Infof("coordinator intents updated (paused %v, drains %q)", in.Paused, in.Drains)
+	return nil
+}
+
+// Run campaigns for the leadership and keeps the latest decisions,
+// until the context is canceled.
+func (c *Coordinator) Run(ctx context.Context) error {
+	go c.watch(ctx)
+	for {
+		err := c.lead(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		glog.Warningf("coordinator %q lost leadership (%v); campaigning again in %v", c.cfg.Name, err, c.cfg.Interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.cfg.Interval):
+		}
+	}
+}
+
+// lead campaigns for the leadership, and decides every interval
+// until the leadership is lost.
+func (c *Coordinator) lead(ctx context.Context) error {
+	sess, err := concurrency.NewSession(c.cli, concurrency.WithTTL(int(c.cfg.TTL.Seconds())), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	e := concurrency.NewElection(sess, c.electionKey())
+	if err = e.Campaign(ctx, c.cfg.Name); err != nil {
+		return err
+	}
+	glog.Infof("coordinator %q elected as leader", c.cfg.Name)
+	c.setLeading(true)
+	defer c.setLeading(false)
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err = c.decide(ctx, e); err == errNotLeader {
+			return err
+		} else if err != nil && ctx.Err() == nil {
+			glog.Warningf("coordinator failed to decide (%v)", err)
+		}
+		select {
+		case <-ctx.Done():
+			// let other servers take over without waiting for the lease
+			rctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			e.Resign(rctx)
+			cancel()
+			return ctx.Err()
+		case <-sess.Done():
+			return errors.New("session expired")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Coordinator) setLeading(leading bool) {
+	c.mu.Lock()
+	c.leading = leading
+	c.mu.Unlock()
+}
+
+// decide makes the decisions on the current state, and stores them
+// only if the server still holds the leadership.
+func (c *Coordinator) decide(ctx context.Context, e *concurrency.Election) error {
+	st := State{
+		Workers:     c.cfg.Source.Workers(),
+		Depths:      make(map[string]int64),
+		Maintenance: c.cfg.Source.InMaintenance(),
+		Intents:     c.Intents(),
+	}
+	for _, l := range st.Workers {
+		for _, b := range l.Buckets {
+			if _, ok := st.Depths[b]; ok {
+				continue
+			}
+			depth, err := c.cfg.Source.Depth(ctx, b)
+			if err != nil {
+				return err
+			}
+			st.Depths[b] = depth
+		}
+	}
+	d := Decide(st)
+	d.Leader, d.UpdatedAt = c.cfg.Name, time.Now()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	resp, err := c.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(e.Key()), "=", e.Rev())).
+		Then(clientv3.OpPut(c.decisionsKey(), string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errNotLeader
+	}
+	c.mu.Lock()
+	c.decisions = d
+	c.mu.Unlock()
+	return nil
+}
+
+// watch keeps the latest decisions and intents, until the context is canceled.
+func (c *Coordinator) watch(ctx context.Context) {
+	for ctx.Err() == nil {
+		resp, err := c.cli.Get(ctx, c.cfg.Prefix+"/", clientv3.WithPrefix())
+		if err != nil {
+			if ctx.Err() == nil {
+				glog.Warningf("coordinator failed to get decisions (%v)", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, kv := range resp.Kvs {
+			c.apply(string(kv.Key), kv.Value)
+		}
+		wch := c.cli.Watch(ctx, c.cfg.Prefix+"/", clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wresp := range wch {
+			for _, ev := range wresp.Events {
+				if ev.Type == clientv3.EventTypePut {
+					c.apply(string(ev.Kv.Key), ev.Kv.Value)
+				}
+			}
+		}
+	}
+}
+
+func (c *Coordinator) apply(key string, val []byte) {
+	switch key {
+	case c.decisionsKey():
+		var d Decisions
+		if err := json.Unmarshal(val, &d); err != nil {
+			glog.Warningf("coordinator decisions %q are invalid (%v)", string(val), err)
+			return
+		}
+		c.mu.Lock()
+		c.decisions = d
+		c.mu.Unlock()
+	case c.intentsKey():
+		var in Intents
+		if err := json.Unmarshal(val, &in); err != nil {
+			glog.Warningf("coordinator intents %q are invalid (%v)", string(val), err)
+			return
+		}
+		c.mu.Lock()
+		c.intents = in
+		c.mu.Unlock()
+	}
+}
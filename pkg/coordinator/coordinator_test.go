@@ -0,0 +1,85 @@
+package coordinator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+// testSource has one worker of two buckets, with waiting jobs in "/a".
+type testSource struct{}
+
+func (testSource) Workers() []workerproc.Liveness {
+	return []workerproc.Liveness{{ID: "w1", Alive: true, Buckets: []string{"/a", "/b"}}}
+}
+func (testSource) Depth(ctx context.Context, bucket string) (int64, error) {
+	if bucket == "/a" {
+		return 1, nil
+	}
+	return 0, nil
+}
+func (testSource) InMaintenance() bool { return false }
+
+func TestCoordinator(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "coordinator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 23379, 23380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	newCoordinator := func(name string) (*Coordinator, context.CancelFunc) {
+		c := New(qu.Client(), Config{Name: name, Interval: 50 * time.Millisecond, TTL: 5 * time.Second, Source: testSource{}})
+		ctx, cancel := context.WithCancel(context.Background())
+		go c.Run(ctx)
+		return c, cancel
+	}
+	waitFor := func(desc string, cond func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("took too long to %s", desc)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	c1, cancel1 := newCoordinator("s1")
+	defer cancel1()
+	waitFor("elect s1", c1.Leading)
+	c2, cancel2 := newCoordinator("s2")
+	defer cancel2()
+
+	// the follower receives the leader decisions and intents
+	if err = c2.SetIntents(context.Background(), Intents{Drains: []string{"w1"}}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("decide on intents", func() bool {
+		d := c2.Decisions()
+		return d.Leader == "s1" && d.Draining("w1")
+	})
+	if c2.Leading() {
+		t.Fatal("expected one leader")
+	}
+
+	// the follower takes over when the leader resigns
+	cancel1()
+	waitFor("elect s2", c2.Leading)
+	if err = c2.SetIntents(context.Background(), Intents{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("decide on s2", func() bool {
+		d := c2.Decisions()
+		return d.Leader == "s2" && !d.Draining("w1") && !d.Assigned("w1", "/b")
+	})
+}
@@ -0,0 +1,152 @@
+package coordinator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+// Intents are the operator requests that the leader decides on,
+// shared by all servers (e.g. from the admin API of any server).
+type Intents struct {
+	// Paused is true to pause dispatching jobs to workers.
+	Paused bool `json:"paused"`
+	// Drains are the IDs of the workers to drain (e.g. before host maintenance).
+	Drains []string `json:"drains,omitempty"`
+}
+
+// State is the fleet state to decide on.
+type State struct {
+	Workers []workerproc.Liveness
+	// Depths are the number of jobs waiting in each bucket.
+	Depths map[string]int64
+	// Maintenance is true if the server is in maintenance mode.
+	Maintenance bool
+	Intents     Intents
+}
+
+// Decisions are the global decisions of the leader.
+type Decisions struct {
+	// Leader is the name of the leader that made the decisions.
+	Leader string `json:"leader"`
+	// Paused is true if dispatching jobs to workers is paused.
+	Paused bool `json:"paused"`
+	// Assignments are the buckets assigned to the workers that process more
+	// than one bucket. Workers without assignments claim from any bucket.
+	Assignments map[string][]string `json:"assignments,omitempty"`
+	// Drains are the IDs of the workers to drain.
+	Drains []string `json:"drains,omitempty"`
+	// Reasons explain the decisions to operators.
+	Reasons   []string  `json:"reasons,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Assigned returns true if the worker may claim jobs from the bucket.
+func (d Decisions) Assigned(workerID, bucket string) bool {
+	buckets, ok := d.Assignments[workerID]
+	if !ok {
+		return true
+	}
+	for _, b := range buckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// Draining returns true if the worker should drain.
+func (d Decisions) Draining(workerID string) bool {
+	for _, id := range d.Drains {
+		if id == workerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Decide makes the decisions on the fleet state. Workers that process more
+// than one bucket are assigned one bucket each, to the bucket with the most
+// waiting jobs per assigned worker, preferring the buckets without workers.
+// Workers that process one bucket, or are draining, are not reassigned.
+func Decide(st State) Decisions {
+	var d Decisions
+	switch {
+	case st.Intents.Paused:
+		d.Paused = true
+		d.Reasons = append(d.Reasons, "paused dispatch (requested by operator)")
+	case st.Maintenance:
+		d.Paused = true
+		d.Reasons = append(d.Reasons, "paused dispatch (maintenance mode)")
+	}
+
+	registered := make(map[string]bool, len(st.Workers))
+	for _, l := range st.Workers {
+		registered[l.ID] = true
+	}
+	drains := make(map[string]bool)
+	for _, id := range st.Intents.Drains {
+		if !registered[id] {
+			// drained, or not registered yet
+			continue
+		}
+		drains[id] = true
+		d.Drains = append(d.Drains, id)
+		d.Reasons = append(d.Reasons, fmt.Sprintf("draining %q (requested by operator)", id))
+	}
+
+	assigned := make(map[string]int)
+	var flexible []workerproc.Liveness
+	for _, l := range st.Workers {
+		if !l.Alive || l.Draining || drains[l.ID] {
+			continue
+		}
+		switch len(l.Buckets) {
+		case 0:
+		case 1:
+			assigned[l.Buckets[0]]++
+		default:
+			flexible = append(flexible, l)
+		}
+	}
+	sort.Slice(flexible, func(i, j int) bool { return flexible[i].ID < flexible[j].ID })
+	for _, l := range flexible {
+		bucket := pickBucket(l.Buckets, st.Depths, assigned)
+		if bucket == "" {
+			continue
+		}
+		assigned[bucket]++
+		if d.Assignments == nil {
+			d.Assignments = make(map[string][]string)
+		}
+		d.Assignments[l.ID] = []string{bucket}
+		d.Reasons = append(d.Reasons, fmt.Sprintf("assigned %q to %q (%d waiting jobs, %d worker(s))", l.ID, bucket, st.Depths[bucket], assigned[bucket]))
+	}
+	return d
+}
+
+// pickBucket returns the bucket with the most waiting jobs per assigned
+// worker, preferring the buckets with waiting jobs and no worker.
+// Returns empty if no bucket has waiting jobs.
+func pickBucket(buckets []string, depths map[string]int64, assigned map[string]int) string {
+	bs := append([]string(nil), buckets...)
+	sort.Strings(bs)
+	var (
+		pick       string
+		pickStarve bool
+		pickLoad   float64
+	)
+	for _, b := range bs {
+		if depths[b] == 0 {
+			continue
+		}
+		starve := assigned[b] == 0
+		load := float64(depths[b]) / float64(assigned[b]+1)
+		if pick == "" || (starve && !pickStarve) || (starve == pickStarve && load > pickLoad) {
+			pick, pickStarve, pickLoad = b, starve, load
+		}
+	}
+	return pick
+}
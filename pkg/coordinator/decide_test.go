@@ -0,0 +1,92 @@
+package coordinator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       State
+		paused      bool
+		assignments map[string][]string
+		drains      []string
+	}{
+		{
+			name:  "idle",
+			state: State{Workers: []workerproc.Liveness{{ID: "w1", Alive: true, Buckets: []string{"/a", "/b"}}}},
+		},
+		{
+			name: "maintenance",
+			state: State{
+				Workers:     []workerproc.Liveness{{ID: "w1", Alive: true, Buckets: []string{"/a"}}},
+				Maintenance: true,
+			},
+			paused: true,
+		},
+		{
+			name: "rebalance",
+			state: State{
+				Workers: []workerproc.Liveness{
+					{ID: "w1", Alive: true, Buckets: []string{"/a", "/b"}},
+					{ID: "w2", Alive: true, Buckets: []string{"/a", "/b"}},
+					{ID: "w3", Alive: true, Buckets: []string{"/a", "/b"}},
+					{ID: "w4", Alive: true, Buckets: []string{"/a", "/b"}, Draining: true},
+				},
+				Depths: map[string]int64{"/a": 100, "/b": 10},
+			},
+			// bucket without workers first, then by waiting jobs per worker
+			assignments: map[string][]string{"w1": {"/a"}, "w2": {"/b"}, "w3": {"/a"}},
+		},
+		{
+			name: "fixed workers",
+			state: State{
+				Workers: []workerproc.Liveness{
+					{ID: "w1", Alive: true, Buckets: []string{"/a"}},
+					{ID: "w2", Alive: true, Buckets: []string{"/a", "/b"}},
+				},
+				Depths: map[string]int64{"/a": 100, "/b": 10},
+			},
+			assignments: map[string][]string{"w2": {"/b"}},
+		},
+		{
+			name: "drains",
+			state: State{
+				Workers: []workerproc.Liveness{
+					{ID: "w1", Alive: true, Buckets: []string{"/a", "/b"}},
+					{ID: "w2", Alive: true, Buckets: []string{"/a", "/b"}},
+				},
+				Depths:  map[string]int64{"/a": 100},
+				Intents: Intents{Paused: true, Drains: []string{"w1", "gone"}},
+			},
+			paused:      true,
+			assignments: map[string][]string{"w2": {"/a"}},
+			drains:      []string{"w1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Decide(tt.state)
+			if d.Paused != tt.paused {
+				t.Fatalf("expected paused %v, got %v", tt.paused, d.Paused)
+			}
+			if !reflect.DeepEqual(d.Assignments, tt.assignments) {
+				t.Fatalf("expected assignments %v, got %v", tt.assignments, d.Assignments)
+			}
+			if !reflect.DeepEqual(d.Drains, tt.drains) {
+				t.Fatalf("expected drains %q, got %q", tt.drains, d.Drains)
+			}
+			if (tt.paused || len(tt.assignments) > 0) && len(d.Reasons) == 0 {
+				t.Fatal("expected reasons")
+			}
+		})
+	}
+
+	d := Decide(tests[2].state)
+	if !d.Assigned("w2", "/b") || d.Assigned("w2", "/a") || !d.Assigned("w4", "/a") {
+		t.Fatalf("unexpected assignments %v", d.Assignments)
+	}
+}
@@ -0,0 +1,4 @@
+// Package coordinator elects a leader among backend servers via etcd, to own
+// the global decisions on the worker fleet: rebalancing buckets across
+// workers, triggering drains, and pausing dispatch during maintenance.
+package coordinator
@@ -0,0 +1,310 @@
+package datacache
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+// Source is the remote store of the dataset files (e.g. Cloud Storage
+// bucket). 'blobstore.Backend' implements it.
+type Source interface {
+	// Stat returns the size and the CRC32C checksum (Castagnoli) of the file.
+	Stat(ctx context.Context, key string) (int64, uint32, error)
+	// Get streams the file to 'w', and returns the number of bytes written.
+	Get(ctx context.Context, key string, w io.Writer) (int64, error)
+}
+
+const (
+	// downloadSuffix is the suffix of the files being downloaded,
+	// which are removed on restart.
+	downloadSuffix = ".download"
+	// digestSuffix is the suffix of the files next to the cached files,
+	// with their chunked SHA-256 checksums (see 'Verify').
+	digestSuffix = ".sha256c"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Cache mirrors the files of the source to the local directory.
+// It is safe for concurrent use, and concurrent requests of the
+// same file share the download.
+type Cache struct {
+	dir    string
+	src    Source
+	budget int64
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	used     int64
+	inflight map[string]*call
+}
+
+type entry struct {
+	size    int64
+	lastUse time.Time
+}
+
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns the cache of the source in the directory, restoring the
+// files cached by previous runs. 'budget' is the maximum total size of the
+// cached files in bytes, 0 for no limit.
+func New(dir string, src Source, budget int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:      dir,
+		src:      src,
+		budget:   budget,
+		entries:  make(map[string]*entry),
+		inflight: make(map[string]*call),
+	}
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(fpath, downloadSuffix) {
+			// interrupted download
+			return os.Remove(fpath)
+		}
+		if strings.HasSuffix(fpath, digestSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		c.entries[filepath.ToSlash(rel)] = &entry{size: fi.Size(), lastUse: fi.ModTime()}
+		c.used += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("restored %d cached file(s) in %q (%s)", len(c.entries), dir, humanize.Bytes(uint64(c.used)))
+	return c, nil
+}
+
+// Used returns the total size of the cached files.
+func (c *Cache) Used() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
+
+// Get returns the local path of the file of the key, downloading it from
+// the source if not cached. Downloaded files are verified against the
+// checksum of the source, and older files are evicted to fit the budget.
+func (c *Cache) Get(ctx context.Context, key string) (string, error) {
+	fpath, err := c.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	// entry is reserved before the download completes
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		return fpath, cl.err
+	}
+	if e, ok := c.entries[key]; ok {
+		e.lastUse = time.Now()
+		c.mu.Unlock()
+		// mtime persists the recency across restarts
+		os.Chtimes(fpath, e.lastUse, e.lastUse)
+		return fpath, nil
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	cl.err = c.fetch(ctx, key, fpath)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(cl.done)
+	return fpath, cl.err
+}
+
+// path returns the local path of the key, rejecting keys outside the directory.
+func (c *Cache) path(key string) (string, error) {
+	for _, suffix := range []string{downloadSuffix, digestSuffix} {
+		if strings.HasSuffix(key, suffix) {
+			return "", fmt.Errorf("invalid dataset key %q (reserved suffix %q)", key, suffix)
+		}
+	}
+	fpath, err := fileutil.SecureJoin(c.dir, key)
+	if err != nil {
+		return "", fmt.Errorf("invalid dataset key %q (%v)", key, err)
+	}
+	return fpath, nil
+}
+
+// fetch downloads the file, and verifies its size and checksum.
+func (c *Cache) fetch(ctx context.Context, key, fpath string) error {
+	size, sum, err := c.src.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err = c.reserve(key, size); err != nil {
+		return err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			c.release(key)
+		}
+	}()
+
+	if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fpath), filepath.Base(fpath)+".*"+downloadSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h, d := crc32.New(castagnoli), fileutil.NewChunkedSHA256(0)
+	n, err := c.src.Get(ctx, key, io.MultiWriter(f, h, d))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%q size mismatch (expected %d, got %d)", key, size, n)
+	}
+	if h.Sum32() != sum {
+		return fmt.Errorf("%q checksum mismatch (expected crc32c %08x, got %08x)", key, sum, h.Sum32())
+	}
+	if err = fileutil.WriteToFile(fpath+digestSuffix, []byte(hex.EncodeToString(d.Sum(nil)))); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), fpath); err != nil {
+		return err
+	}
+	ok = true
+	glog.Infof("cached %q at %q (%s)", key, fpath, humanize.Bytes(uint64(size)))
+	return nil
+}
+
+// reserve evicts the least recently used files to fit the size in the
+// budget, and adds the entry of the key.
+func (c *Cache) reserve(key string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget > 0 && size > c.budget {
+		return fmt.Errorf("%q (%s) exceeds the cache budget %s", key, humanize.Bytes(uint64(size)), humanize.Bytes(uint64(c.budget)))
+	}
+	if c.budget > 0 && c.used+size > c.budget {
+		keys := make([]string, 0, len(c.entries))
+		for k := range c.entries {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return c.entries[keys[i]].lastUse.Before(c.entries[keys[j]].lastUse) })
+		for _, k := range keys {
+			if c.used+size <= c.budget {
+				break
+			}
+			if _, ok := c.inflight[k]; ok {
+				// being downloaded
+				continue
+			}
+			fpath, _ := c.path(k)
+			if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			os.Remove(fpath + digestSuffix)
+			glog.Infof("evicted %q (%s)", k, humanize.Bytes(uint64(c.entries[k].size)))
+			c.used -= c.entries[k].size
+			delete(c.entries, k)
+		}
+		if c.used+size > c.budget {
+			return fmt.Errorf("no space for %q (%s) in the cache budget %s", key, humanize.Bytes(uint64(size)), humanize.Bytes(uint64(c.budget)))
+		}
+	}
+	c.entries[key] = &entry{size: size, lastUse: time.Now()}
+	c.used += size
+	return nil
+}
+
+func (c *Cache) release(key string) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.used -= e.size
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+}
+
+// Verify re-computes the chunked SHA-256 checksum of the cached file (see
+// 'fileutil.ChunkedSHA256File') in parallel, and compares it with the one
+// computed on download, to detect corrupted files on disk (e.g. of the
+// previous runs). Mismatching, unreadable files, and files with no checksum
+// are evicted, so that the next 'Get' downloads them again.
+func (c *Cache) Verify(key string) error {
+	fpath, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	_, cached := c.entries[key]
+	_, inflight := c.inflight[key]
+	c.mu.Unlock()
+	if !cached || inflight {
+		return fmt.Errorf("%q is not cached", key)
+	}
+
+	if err = verify(fpath); err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%q %v", key, err)
+	c.release(key)
+	os.Remove(fpath)
+	os.Remove(fpath + digestSuffix)
+	glog.Warningf("%v; evicted", err)
+	return err
+}
+
+func verify(fpath string) error {
+	want, err := ioutil.ReadFile(fpath + digestSuffix)
+	if err != nil {
+		return fmt.Errorf("has no checksum (%v)", err)
+	}
+	got, err := fileutil.ChunkedSHA256File(fpath, 0, 0)
+	if err != nil {
+		return err
+	}
+	if got != string(want) {
+		return fmt.Errorf("checksum mismatch (expected chunked sha256 %s, got %s)", want, got)
+	}
+	return nil
+}
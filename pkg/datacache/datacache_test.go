@@ -0,0 +1,158 @@
+package datacache
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memSource struct {
+	mu        sync.Mutex
+	files     map[string]string
+	corrupt   map[string]bool
+	downloads int
+}
+
+func (s *memSource) Stat(ctx context.Context, key string) (int64, uint32, error) {
+	data, ok := s.files[key]
+	if !ok {
+		return 0, 0, os.ErrNotExist
+	}
+	return int64(len(data)), crc32.Checksum([]byte(data), castagnoli), nil
+}
+
+func (s *memSource) Get(ctx context.Context, key string, w io.Writer) (int64, error) {
+	s.mu.Lock()
+	s.downloads++
+	s.mu.Unlock()
+	data := s.files[key]
+	if s.corrupt[key] {
+		data = strings.ToUpper(data)
+	}
+	return io.Copy(w, bytes.NewReader([]byte(data)))
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "datacache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := &memSource{
+		files: map[string]string{
+			"cats/1.jpg": "aaaa",
+			"cats/2.jpg": "bbbb",
+			"dogs/1.jpg": "cccc",
+			"corrupt":    "dddd",
+			"large":      "0123456789",
+		},
+		corrupt: map[string]bool{"corrupt": true},
+	}
+	c, err := New(dir, src, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent requests share the download
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Get(context.Background(), "cats/1.jpg"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	fpath, err := c.Get(context.Background(), "cats/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(fpath); err != nil || string(data) != "aaaa" {
+		t.Fatalf("unexpected cached file %q (%v)", data, err)
+	}
+	if src.downloads != 1 {
+		t.Fatalf("expected 1 download, got %d", src.downloads)
+	}
+
+	if _, err = c.Get(context.Background(), "cats/2.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	// "cats/1.jpg" is more recently used
+	if _, err = c.Get(context.Background(), "cats/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Get(context.Background(), "dogs/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cats", "2.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("expected least recently used file evicted, got %v", err)
+	}
+	if c.Used() != 8 {
+		t.Fatalf("expected 8 bytes used, got %d", c.Used())
+	}
+
+	for _, key := range []string{"corrupt", "large", "../escape", "missing"} {
+		if _, err = c.Get(context.Background(), key); err == nil {
+			t.Fatalf("expected error on %q", key)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "corrupt")); !os.IsNotExist(err) {
+		t.Fatalf("expected corrupt file removed, got %v", err)
+	}
+	// space for the failed download was made by evicting "cats/1.jpg"
+	if c.Used() != 4 {
+		t.Fatalf("expected 4 bytes used after failures, got %d", c.Used())
+	}
+
+	// restored on restart
+	c, err = New(dir, src, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Used() != 4 {
+		t.Fatalf("expected 4 bytes restored, got %d", c.Used())
+	}
+	downloads := src.downloads
+	if _, err = c.Get(context.Background(), "dogs/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if src.downloads != downloads {
+		t.Fatal("expected restored file not downloaded again")
+	}
+
+	if err = c.Verify("dogs/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Verify("cats/2.jpg"); err == nil {
+		t.Fatal("expected error on uncached file")
+	}
+	// corrupted on disk
+	if err = ioutil.WriteFile(filepath.Join(dir, "dogs", "1.jpg"), []byte("CCCC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Verify("dogs/1.jpg"); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if c.Used() != 0 {
+		t.Fatalf("expected corrupted file evicted, got %d bytes used", c.Used())
+	}
+	if fpath, err = c.Get(context.Background(), "dogs/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(fpath); err != nil || string(data) != "cccc" {
+		t.Fatalf("expected file downloaded again, got %q (%v)", data, err)
+	}
+	if err = c.Verify("dogs/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+}
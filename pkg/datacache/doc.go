@@ -0,0 +1,4 @@
+// Package datacache mirrors remote dataset files (e.g. in Cloud Storage) to
+// a local directory on first use, verifying their checksums, and evicts the
+// least recently used files to stay within the disk budget.
+package datacache
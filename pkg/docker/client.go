@@ -0,0 +1,337 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultHost is the default Docker daemon socket.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// apiVersion is the minimum Docker Engine API version with 'NanoCPUs' (Docker 1.13).
+const apiVersion = "v1.25"
+
+// Client is the Docker Engine API client.
+type Client struct {
+	base string
+	cli  *http.Client
+}
+
+// NewClient creates a client for the Docker daemon host
+// (e.g. "unix:///var/run/docker.sock", "tcp://localhost:2375").
+// Empty host defaults to 'DefaultHost'.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		sock := u.Path
+		tr := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		}
+		return &Client{base: "http://docker/" + apiVersion, cli: &http.Client{Transport: tr}}, nil
+	case "tcp", "http":
+		return &Client{base: "http://" + u.Host + "/" + apiVersion, cli: &http.Client{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown Docker host scheme %q", host)
+	}
+}
+
+// Mount is the bind mount of the host path.
+type Mount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// ContainerConfig defines the container to create.
+type ContainerConfig struct {
+	Name  string
+	Image string
+	Cmd   []string
+	// Env is the list of "KEY=VALUE".
+	Env    []string
+	Mounts []Mount
+	// NetworkMode is "bridge" by default ("host" to reach services on localhost).
+	NetworkMode string
+	// NanoCPUs is the CPU quota in units of 1e-9 CPUs. 0 for no limit.
+	NanoCPUs int64
+	// Memory is the memory limit in bytes. 0 for no limit.
+	Memory int64
+}
+
+type hostConfig struct {
+	Binds       []string `json:",omitempty"`
+	NetworkMode string   `json:",omitempty"`
+	NanoCPUs    int64    `json:"NanoCpus,omitempty"`
+	Memory      int64    `json:",omitempty"`
+}
+
+type createRequest struct {
+	Image      string
+	Cmd        []string `json:",omitempty"`
+	Env        []string `json:",omitempty"`
+	HostConfig hostConfig
+}
+
+// Create creates the container, and returns its ID.
+func (c *Client) Create(ctx context.Context, cfg ContainerConfig) (string, error) {
+	req := createRequest{
+		Image: cfg.Image,
+		Cmd:   cfg.Cmd,
+		Env:   cfg.Env,
+		HostConfig: hostConfig{
+			NetworkMode: cfg.NetworkMode,
+			NanoCPUs:    cfg.NanoCPUs,
+			Memory:      cfg.Memory,
+		},
+	}
+	for _, m := range cfg.Mounts {
+		b := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			b += ":ro"
+		}
+		req.HostConfig.Binds = append(req.HostConfig.Binds, b)
+	}
+	p := "/containers/create"
+	if cfg.Name != "" {
+		p += "?name=" + url.QueryEscape(cfg.Name)
+	}
+	var resp struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do(ctx, http.MethodPost, p, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// Pull pulls the image (e.g. "gcr.io/gcp-dplearn/dplearn:latest-cpu").
+func (c *Client) Pull(ctx context.Context, image string) error {
+	ref, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		ref, tag = image[:i], image[i+1:]
+	}
+	rc, err := c.stream(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(ref)+"&tag="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// progress messages, with error in the last message on failure
+	dec := json.NewDecoder(rc)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err = dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull %q (%s)", image, msg.Error)
+		}
+	}
+}
+
+// Start starts the container.
+func (c *Client) Start(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil)
+}
+
+// Wait blocks until the container stops, and returns its exit code.
+func (c *Client) Wait(ctx context.Context, id string) (int, error) {
+	var resp struct {
+		StatusCode int
+	}
+	if err := c.do(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+// Stop stops the container, killing it after the timeout in seconds.
+func (c *Client) Stop(ctx context.Context, id string, timeoutSeconds int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/stop?t=%d", id, timeoutSeconds), nil, nil)
+}
+
+// Remove force-removes the container with its anonymous volumes.
+func (c *Client) Remove(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/containers/"+id+"?force=1&v=1", nil, nil)
+}
+
+// State is the container state.
+type State struct {
+	Running   bool
+	OOMKilled bool
+	ExitCode  int
+}
+
+// Inspect returns the container state.
+func (c *Client) Inspect(ctx context.Context, id string) (State, error) {
+	var resp struct {
+		State State
+	}
+	err := c.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, &resp)
+	return resp.State, err
+}
+
+// Logs follows the container outputs until the container stops,
+// and writes stdout and stderr to the writers.
+func (c *Client) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	rc, err := c.stream(ctx, http.MethodGet, "/containers/"+id+"/logs?follow=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return Demux(rc, stdout, stderr)
+}
+
+// Demux splits the multiplexed stream of the container without TTY.
+// Each frame has 8-byte header of stream type (1 for stdout, 2 for stderr)
+// and big-endian uint32 payload size.
+func Demux(r io.Reader, stdout, stderr io.Writer) error {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if hdr[0] == 2 {
+			w = stderr
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return err
+		}
+	}
+}
+
+// Run creates and starts the container, pulling the image if not exists.
+// It writes the container outputs to the writers until the container stops,
+// and returns the final state. The container is removed on return,
+// or stopped when the context is canceled.
+func (c *Client) Run(ctx context.Context, cfg ContainerConfig, stdout, stderr io.Writer) (State, error) {
+	id, err := c.Create(ctx, cfg)
+	if IsNotFound(err) {
+		if err = c.Pull(ctx, cfg.Image); err != nil {
+			return State{}, err
+		}
+		id, err = c.Create(ctx, cfg)
+	}
+	if err != nil {
+		return State{}, err
+	}
+	defer func() {
+		// remove with a fresh context, since the run context may be canceled
+		rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		c.Remove(rctx, id)
+		cancel()
+	}()
+
+	if err = c.Start(ctx, id); err != nil {
+		return State{}, err
+	}
+	if err = c.Logs(ctx, id, stdout, stderr); err != nil && ctx.Err() == nil {
+		return State{}, err
+	}
+	if ctx.Err() != nil {
+		sctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		c.Stop(sctx, id, 10)
+		cancel()
+		return State{}, ctx.Err()
+	}
+	code, err := c.Wait(ctx, id)
+	if err != nil {
+		return State{}, err
+	}
+	st, err := c.Inspect(ctx, id)
+	if err != nil {
+		return State{ExitCode: code}, nil
+	}
+	return st, nil
+}
+
+// Error is the error response from the Docker daemon.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("docker: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound returns true if the error is 404 (e.g. image does not exist).
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) do(ctx context.Context, method, p string, in, out interface{}) error {
+	rc, err := c.stream(ctx, method, p, in)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, rc)
+		return nil
+	}
+	return json.NewDecoder(rc).Decode(out)
+}
+
+func (c *Client) stream(ctx context.Context, method, p string, in interface{}) (io.ReadCloser, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+p, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+			msg.Message = string(b)
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: msg.Message}
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func frame(stream byte, s string) []byte {
+	hdr := make([]byte, 8)
+	hdr[0] = stream
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(s)))
+	return append(hdr, s...)
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	pulled := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls = append(calls, req.Method+" "+strings.TrimPrefix(req.URL.Path, "/"+apiVersion))
+		mu.Unlock()
+
+		switch {
+		case req.URL.Path == "/"+apiVersion+"/containers/create":
+			if !pulled {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":"No such image: test:latest"}`))
+				return
+			}
+			var cr createRequest
+			if err := json.NewDecoder(req.Body).Decode(&cr); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cr.HostConfig.Binds, []string{"/tmp/scratch:/scratch"}) || cr.HostConfig.Memory != 1<<20 {
+				t.Fatalf("unexpected create request %+v", cr)
+			}
+			w.Write([]byte(`{"Id":"abc"}`))
+		case req.URL.Path == "/"+apiVersion+"/images/create":
+			if req.URL.Query().Get("fromImage") != "test" || req.URL.Query().Get("tag") != "latest" {
+				t.Fatalf("unexpected pull %q", req.URL.RawQuery)
+			}
+			pulled = true
+			w.Write([]byte(`{"status":"Pulling"}` + "\n" + `{"status":"Done"}`))
+		case req.URL.Path == "/"+apiVersion+"/containers/abc/logs":
+			w.Write(frame(1, "hello\n"))
+			w.Write(frame(2, "world\n"))
+		case req.URL.Path == "/"+apiVersion+"/containers/abc/wait":
+			w.Write([]byte(`{"StatusCode":137}`))
+		case req.URL.Path == "/"+apiVersion+"/containers/abc/json":
+			w.Write([]byte(`{"State":{"Running":false,"OOMKilled":true,"ExitCode":137}}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	c, err := NewClient("tcp://" + strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	st, err := c.Run(context.Background(), ContainerConfig{
+		Image:  "test",
+		Mounts: []Mount{{Source: "/tmp/scratch", Target: "/scratch"}},
+		Memory: 1 << 20,
+	}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.OOMKilled || st.ExitCode != 137 {
+		t.Fatalf("unexpected state %+v", st)
+	}
+	if stdout.String() != "hello\n" || stderr.String() != "world\n" {
+		t.Fatalf("unexpected outputs %q, %q", stdout.String(), stderr.String())
+	}
+
+	exp := []string{
+		"POST /containers/create",
+		"POST /images/create",
+		"POST /containers/create",
+		"POST /containers/abc/start",
+		"GET /containers/abc/logs",
+		"POST /containers/abc/wait",
+		"GET /containers/abc/json",
+		"DELETE /containers/abc",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("expected %q, got %q", exp, calls)
+	}
+}
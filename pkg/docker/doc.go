@@ -0,0 +1,3 @@
+// Package docker implements a minimal Docker Engine API client,
+// to run worker containers without the Docker CLI.
+package docker
@@ -0,0 +1,4 @@
+// Package download downloads files over HTTP, resuming the partial
+// downloads with range requests (e.g. model weights and datasets fetched
+// at worker startup), with checksum verification and bandwidth limiting.
+package download
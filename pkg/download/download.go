@@ -0,0 +1,239 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+	"github.com/gyuho/dplearn/pkg/tracing"
+
+	"github.com/golang/glog"
+)
+
+// PartialSuffix is the suffix of the partially downloaded file, which
+// is resumed by the next download of the same file.
+const PartialSuffix = ".download"
+
+// defaultProgressInterval is the default interval to report the progress.
+const defaultProgressInterval = time.Second
+
+// Config defines the download configuration.
+type Config struct {
+	// Client defaults to the client propagating the trace context.
+	Client *http.Client
+
+	// Checksum is the SHA-256 (or MD5) checksum in hex to verify the
+	// downloaded file. Empty to skip verification.
+	Checksum string
+
+	// RateLimit is the maximum download rate in bytes per second.
+	// Zero for no limit.
+	RateLimit int64
+
+	// Retries is the number of retries on failure, resuming the download.
+	Retries int
+	// RetryInterval defaults to 1 second.
+	RetryInterval time.Duration
+
+	// Progress is called with the number of bytes downloaded and the
+	// total size (-1 if unknown) every ProgressInterval, and on completion.
+	// ProgressInterval defaults to 1 second.
+	Progress         func(done, total int64)
+	ProgressInterval time.Duration
+}
+
+var defaultClient = &http.Client{Transport: &tracing.Transport{}}
+
+// File downloads the URL to the file, replacing the existing file once the
+// download completes and matches the checksum. The data is written to the
+// file with 'PartialSuffix' first, which is resumed with a range request
+// if it exists (e.g. the previous download was interrupted), or restarted
+// if the server does not support range requests. The partial file is
+// removed on checksum mismatch. It fails before writing if the disk does
+// not have enough space for the known content length.
+func File(ctx context.Context, ep, fpath string, cfg Config) error {
+	if cfg.Client == nil {
+		cfg.Client = defaultClient
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = time.Second
+	}
+	if cfg.ProgressInterval == 0 {
+		cfg.ProgressInterval = defaultProgressInterval
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+
+	partial := fpath + PartialSuffix
+	var err error
+	for i := 0; ; i++ {
+		if err = get(ctx, ep, partial, cfg); err == nil {
+			break
+		}
+		if _, ok := err.(*fileutil.NoSpaceError); ok || ctx.Err() != nil || i >= cfg.Retries {
+			return err
+		}
+		glog.Warningf("failed to download %q (%v); retrying in %v", ep, err, cfg.RetryInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.RetryInterval):
+		}
+	}
+
+	if cfg.Checksum != "" {
+		if err = fileutil.VerifyChecksum(partial, cfg.Checksum); err != nil {
+			os.Remove(partial)
+			return err
+		}
+	}
+	return os.Rename(partial, fpath)
+}
+
+// get downloads the rest of the partial file.
+func get(ctx context.Context, ep, partial string, cfg Config) error {
+	var offset int64
+	if fi, err := os.Stat(partial); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ep, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_WRONLY | os.O_CREATE
+	total := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// range not supported, or no partial file
+		flag |= os.O_TRUNC
+		offset = 0
+	case http.StatusPartialContent:
+		flag |= os.O_APPEND
+		if total >= 0 {
+			total += offset
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// partial file already complete
+		io.Copy(ioutil.Discard, resp.Body)
+		if cfg.Progress != nil {
+			cfg.Progress(offset, offset)
+		}
+		return nil
+	default:
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%q returned %q (%s)", ep, resp.Status, string(b))
+	}
+	if offset > 0 {
+		glog.Infof("resuming download of %q from %d bytes", ep, offset)
+	}
+	if total >= 0 {
+		if err = fileutil.EnsureSpace(partial, uint64(total-offset)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(partial, flag, fileutil.PrivateFileMode)
+	if err != nil {
+		return err
+	}
+	pw := &progressWriter{
+		w:        f,
+		done:     offset,
+		total:    total,
+		fn:       cfg.Progress,
+		interval: cfg.ProgressInterval,
+	}
+	var r io.Reader = resp.Body
+	if cfg.RateLimit > 0 {
+		r = &limitedReader{ctx: ctx, r: r, rate: cfg.RateLimit, start: time.Now()}
+	}
+	if _, err = io.Copy(pw, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	pw.report()
+	if total >= 0 && pw.done != total {
+		return fmt.Errorf("%q downloaded %d bytes, expected %d", ep, pw.done, total)
+	}
+	return nil
+}
+
+// progressWriter reports the progress every interval.
+type progressWriter struct {
+	w     io.Writer
+	done  int64
+	total int64
+
+	fn       func(done, total int64)
+	interval time.Duration
+	last     time.Time
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	if pw.fn != nil && time.Since(pw.last) >= pw.interval {
+		pw.report()
+	}
+	return n, err
+}
+
+func (pw *progressWriter) report() {
+	if pw.fn != nil {
+		pw.fn(pw.done, pw.total)
+		pw.last = time.Now()
+	}
+}
+
+// limitedReader limits the read rate in bytes per second.
+type limitedReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// read at most a tenth of a second worth of bytes at once
+	if max := lr.rate/10 + 1; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+
+	// wait until the bytes read are within the rate
+	wait := time.Duration(float64(lr.n)/float64(lr.rate)*float64(time.Second)) - time.Since(lr.start)
+	if wait > 0 {
+		select {
+		case <-lr.ctx.Done():
+			return n, lr.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,136 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+func TestFile(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	sum, err := fileutil.SHA256(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, req.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, req, "parameters-cats.npy", time.Time{}, bytes.NewReader(data))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "datasets", "parameters-cats.npy")
+
+	// interrupted download is resumed
+	if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fpath+PartialSuffix, data[:30000], fileutil.PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	var lastDone, lastTotal int64
+	err = File(context.Background(), ts.URL, fpath, Config{
+		Checksum: sum,
+		Progress: func(done, total int64) { lastDone, lastTotal = done, total },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(fpath); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("unexpected content (%v)", err)
+	}
+	if fileutil.Exist(fpath + PartialSuffix) {
+		t.Fatal("expected partial file renamed")
+	}
+	if lastDone != int64(len(data)) || lastTotal != int64(len(data)) {
+		t.Fatalf("progress expected %d/%d, got %d/%d", len(data), len(data), lastDone, lastTotal)
+	}
+	mu.Lock()
+	if len(ranges) != 1 || ranges[0] != "bytes=30000-" {
+		t.Fatalf("unexpected range requests %q", ranges)
+	}
+	mu.Unlock()
+
+	// partial file is removed on checksum mismatch
+	err = File(context.Background(), ts.URL, fpath, Config{Checksum: strings.Repeat("0", 64)})
+	if err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if fileutil.Exist(fpath + PartialSuffix) {
+		t.Fatal("expected partial file removed")
+	}
+}
+
+func TestFileRateLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 3000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	if err = File(context.Background(), ts.URL, filepath.Join(dir, "a"), Config{RateLimit: 10000}); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(now); took < 250*time.Millisecond {
+		t.Fatalf("expected rate-limited download, took %v", took)
+	}
+}
+
+func TestFileRetry(t *testing.T) {
+	var mu sync.Mutex
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			failed = true
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("a"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "a")
+	if err = File(context.Background(), ts.URL, fpath, Config{}); err == nil {
+		t.Fatal("expected error without retries")
+	}
+	mu.Lock()
+	failed = false
+	mu.Unlock()
+	if err = File(context.Background(), ts.URL, fpath, Config{Retries: 1, RetryInterval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package etcdqueue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultMinDiskSpace is the available disk space of the data directory
+	// partition, below which the embedded queue compacts all history and
+	// defragments the database, without waiting for the periodic compaction.
+	DefaultMinDiskSpace = 1 << 30 // 1 GiB
+
+	// diskCheckInterval is the interval to check the disk space.
+	diskCheckInterval = time.Minute
+)
+
+// runDiskGC compacts and defragments the database whenever the available
+// disk space of the data directory drops below 'min', until the context
+// is canceled.
+func (qu *embeddedQueue) runDiskGC(ctx context.Context, min uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		st, err := fileutil.DiskUsage(qu.dataDir)
+		if err != nil {
+			glog.Warningf("failed to get disk usage of %q (%v)", qu.dataDir, err)
+			return
+		}
+		if st.Available >= min {
+			continue
+		}
+		glog.Warningf("%q has %s available (below %s); compacting queue", qu.dataDir, humanize.Bytes(st.Available), humanize.Bytes(min))
+		if err = qu.compact(ctx); err != nil {
+			glog.Warningf("failed to compact queue (%v)", err)
+		}
+	}
+}
+
+// compact compacts all history up to the current revision, and
+// defragments the database to release the space to the file system.
+func (qu *embeddedQueue) compact(ctx context.Context) error {
+	before, _ := fileutil.DirSize(qu.dataDir)
+
+	cli := qu.Client()
+	resp, err := cli.Get(ctx, "foo")
+	if err != nil {
+		return err
+	}
+	_, err = cli.Compact(ctx, resp.Header.Revision, clientv3.WithCompactPhysical())
+	if err != nil && err != rpctypes.ErrCompacted {
+		return err
+	}
+	// defragmentation rewrites the database file
+	if fi, err := os.Stat(filepath.Join(qu.dataDir, "member", "snap", "db")); err == nil {
+		if err = fileutil.EnsureSpace(qu.dataDir, uint64(fi.Size())); err != nil {
+			return fmt.Errorf("compacted at revision %d, but cannot defragment (%v)", resp.Header.Revision, err)
+		}
+	}
+	// in-process client ignores the endpoint
+	if _, err = cli.Defragment(ctx, ""); err != nil {
+		return err
+	}
+
+	after, _ := fileutil.DirSize(qu.dataDir)
+	glog.Infof("compacted queue at revision %d (%q %s -> %s)", resp.Header.Revision, qu.dataDir, humanize.Bytes(before), humanize.Bytes(after))
+	return nil
+}
@@ -0,0 +1,61 @@
+package etcdqueue
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+func TestEmbeddedQueueCompact(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	cli := qu.Client()
+	var first int64
+	for i := 0; i < 10; i++ {
+		resp, err := cli.Put(context.Background(), "foo", fmt.Sprintf("bar%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = resp.Header.Revision
+		}
+	}
+
+	if err = qu.(*embeddedQueue).compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// compacting again at the same revision is not an error
+	if err = qu.(*embeddedQueue).compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.Get(context.Background(), "foo", clientv3.WithRev(first)); err != rpctypes.ErrCompacted {
+		t.Fatalf("expected %v, got %v", rpctypes.ErrCompacted, err)
+	}
+	resp, err := cli.Get(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "bar9" {
+		t.Fatalf("unexpected response %+v", resp.Kvs)
+	}
+}
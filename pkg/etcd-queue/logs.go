@@ -0,0 +1,117 @@
+package etcdqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// LogLine is a log line appended by the worker processing the item.
+type LogLine struct {
+	// Rev is the revision of the line, shared by lines appended together.
+	// Pass 'Rev+1' of the last received line to 'WatchLogs' to resume streaming.
+	Rev  int64     `json:"rev"`
+	Line string    `json:"line"`
+	Time time.Time `json:"time"`
+
+	// Error contains any error message on streaming.
+	Error string `json:"error,omitempty"`
+}
+
+// LogWatcher is receive-only channel, used for streaming log lines.
+type LogWatcher <-chan *LogLine
+
+// pfxLogs is the prefix of log lines, with sub-keys under the item key.
+const pfxLogs = "_logs"
+
+func (qu *queue) AppendLog(ctx context.Context, key string, lines []string, opts ...OpOption) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	ret := Op{}
+	ret.applyOpts(opts)
+
+	var putOpts []clientv3.OpOption
+	if ret.ttl > 5 {
+		resp, err := qu.cli.Grant(ctx, ret.ttl)
+		if err != nil {
+			return err
+		}
+		putOpts = append(putOpts, clientv3.WithLease(resp.ID))
+	}
+
+	now := time.Now()
+	ops := make([]clientv3.Op, 0, len(lines))
+	for i, line := range lines {
+		data, err := json.Marshal(LogLine{Line: line, Time: now})
+		if err != nil {
+			return err
+		}
+		// lexicographically ordered by time, and by order in the batch
+		k := path.Join(pfxLogs, key, fmt.Sprintf("%020d%05d", now.UnixNano(), i))
+		ops = append(ops, clientv3.OpPut(k, string(data), putOpts...))
+	}
+	_, err := qu.cli.Txn(ctx).Then(ops...).Commit()
+	return err
+}
+
+func (qu *queue) WatchLogs(ctx context.Context, key string, fromRev int64) LogWatcher {
+	ch := make(chan *LogLine, 100)
+	pfxLogsKey := path.Join(pfxLogs, key) + "/"
+
+	send := func(kv *mvccpb.KeyValue) bool {
+		ll := &LogLine{}
+		if err := json.Unmarshal(kv.Value, ll); err != nil {
+			ll = &LogLine{Error: fmt.Sprintf("%q returned wrong JSON %q (%v)", string(kv.Key), string(kv.Value), err)}
+		}
+		ll.Rev = kv.ModRevision
+		select {
+		case ch <- ll:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(ch)
+
+		opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend)}
+		if fromRev > 0 {
+			opts = append(opts, clientv3.WithMinCreateRev(fromRev))
+		}
+		resp, err := qu.cli.Get(ctx, pfxLogsKey, opts...)
+		if err != nil {
+			ch <- &LogLine{Error: err.Error()}
+			return
+		}
+		for _, kv := range resp.Kvs {
+			if !send(kv) {
+				return
+			}
+		}
+
+		// watch from the revision of the range request, to not miss any line
+		wch := qu.cli.Watch(ctx, pfxLogsKey, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wresp := range wch {
+			if wresp.Err() != nil {
+				ch <- &LogLine{Error: fmt.Sprintf("%q returned error %v", pfxLogsKey, wresp.Err())}
+				return
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				if !send(ev.Kv) {
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
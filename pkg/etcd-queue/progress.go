@@ -0,0 +1,103 @@
+package etcdqueue
+
+import "fmt"
+
+// Stage is the named stage of the job (e.g. "download", "inference"),
+// weighted relative to the other stages of the job.
+type Stage struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// StageProgress reports the job progress as the current stage and its
+// percentage, so that every worker reports progress consistently.
+// The overall progress is the weighted sum of the completed stages,
+// and the completed part of the current stage.
+type StageProgress struct {
+	// Stages are the stages of the job in order, declared once per job.
+	Stages []Stage `json:"stages"`
+	// Current is the name of the stage in process.
+	Current string `json:"current"`
+	// Percent is the progress of the current stage, from 0 to 100.
+	Percent int `json:"percent"`
+}
+
+// Validate returns an error if the stages or the current stage are not valid.
+func (sp *StageProgress) Validate() error {
+	if len(sp.Stages) == 0 {
+		return fmt.Errorf("no stages")
+	}
+	seen := make(map[string]struct{}, len(sp.Stages))
+	for _, s := range sp.Stages {
+		if s.Name == "" {
+			return fmt.Errorf("empty stage name")
+		}
+		if _, ok := seen[s.Name]; ok {
+			return fmt.Errorf("duplicate stage %q", s.Name)
+		}
+		seen[s.Name] = struct{}{}
+		if s.Weight <= 0 {
+			return fmt.Errorf("stage %q has non-positive weight %d", s.Name, s.Weight)
+		}
+	}
+	if sp.index() < 0 {
+		return fmt.Errorf("unknown current stage %q", sp.Current)
+	}
+	if sp.Percent < 0 || sp.Percent > 100 {
+		return fmt.Errorf("stage percent %d out of range [0, 100]", sp.Percent)
+	}
+	return nil
+}
+
+func (sp *StageProgress) index() int {
+	for i, s := range sp.Stages {
+		if s.Name == sp.Current {
+			return i
+		}
+	}
+	return -1
+}
+
+// Progress returns the overall progress, less than 'MaxProgress'
+// (only completion reports the max progress).
+func (sp *StageProgress) Progress() (int, error) {
+	if err := sp.Validate(); err != nil {
+		return 0, err
+	}
+	var total, done int
+	cur := sp.index()
+	for i, s := range sp.Stages {
+		total += s.Weight
+		if i < cur {
+			done += s.Weight * 100
+		}
+	}
+	done += sp.Stages[cur].Weight * sp.Percent
+	p := done * MaxProgress / (total * 100)
+	if p >= MaxProgress {
+		p = MaxProgress - 1
+	}
+	return p, nil
+}
+
+// Follows returns an error if the stage progress does not follow the
+// previous report: the stages must not change, and the progress must not
+// go backward.
+func (sp *StageProgress) Follows(prev *StageProgress) error {
+	if prev == nil {
+		return nil
+	}
+	if len(sp.Stages) != len(prev.Stages) {
+		return fmt.Errorf("stages changed from %v to %v", prev.Stages, sp.Stages)
+	}
+	for i := range sp.Stages {
+		if sp.Stages[i] != prev.Stages[i] {
+			return fmt.Errorf("stages changed from %v to %v", prev.Stages, sp.Stages)
+		}
+	}
+	ci, pi := sp.index(), prev.index()
+	if ci < pi || (ci == pi && sp.Percent < prev.Percent) {
+		return fmt.Errorf("stage progress went backward from %q %d%% to %q %d%%", prev.Current, prev.Percent, sp.Current, sp.Percent)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package etcdqueue
+
+import "testing"
+
+func TestStageProgress(t *testing.T) {
+	stages := []Stage{{Name: "download", Weight: 1}, {Name: "inference", Weight: 2}, {Name: "upload", Weight: 1}}
+	tests := []struct {
+		sp       StageProgress
+		progress int
+		err      bool
+	}{
+		{StageProgress{Stages: stages, Current: "download"}, 0, false},
+		{StageProgress{Stages: stages, Current: "inference", Percent: 50}, 50, false},
+		{StageProgress{Stages: stages, Current: "upload", Percent: 100}, MaxProgress - 1, false},
+		{StageProgress{Stages: stages, Current: "unknown"}, 0, true},
+		{StageProgress{Stages: stages, Current: "download", Percent: 101}, 0, true},
+		{StageProgress{Stages: []Stage{{Name: "a", Weight: 0}}, Current: "a"}, 0, true},
+		{StageProgress{Stages: []Stage{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}, Current: "a"}, 0, true},
+		{StageProgress{Current: "a"}, 0, true},
+	}
+	for i, tt := range tests {
+		p, err := tt.sp.Progress()
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+		if p != tt.progress {
+			t.Fatalf("#%d: expected progress %d, got %d", i, tt.progress, p)
+		}
+	}
+
+	prev := &StageProgress{Stages: stages, Current: "inference", Percent: 50}
+	if err := (&StageProgress{Stages: stages, Current: "inference", Percent: 60}).Follows(prev); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&StageProgress{Stages: stages, Current: "inference", Percent: 40}).Follows(prev); err == nil {
+		t.Fatal("expected error on backward progress")
+	}
+	if err := (&StageProgress{Stages: stages[:2], Current: "inference", Percent: 60}).Follows(prev); err == nil {
+		t.Fatal("expected error on changed stages")
+	}
+}
@@ -0,0 +1,70 @@
+package etcdqueue
+
+import (
+	"fmt"
+	"time"
+)
+
+// Worker protocol versions. The protocol version determines the item schema
+// exchanged with workers, so that old and new workers are served side by side
+// during rolling upgrades.
+const (
+	// ProtocolV1 is the protocol of workers that predate version negotiation.
+	// Items have no 'job_type' and 'gpu' fields.
+	ProtocolV1 = 1
+	// ProtocolV2 adds 'job_type' and 'gpu' to items, for job routing.
+	ProtocolV2 = 2
+
+	// ProtocolVersion is the latest protocol version.
+	ProtocolVersion = ProtocolV2
+	// MinProtocolVersion is the oldest protocol version still supported.
+	MinProtocolVersion = ProtocolV1
+
+	// ProtocolHeader is the HTTP header with the worker protocol version.
+	ProtocolHeader = "Worker-Protocol"
+)
+
+// CheckProtocol returns an error if the protocol version is not supported.
+// Zero version is treated as 'ProtocolV1'.
+func CheckProtocol(version int) error {
+	if version == 0 {
+		version = ProtocolV1
+	}
+	switch {
+	case version < MinProtocolVersion:
+		return fmt.Errorf("worker protocol version %d is no longer supported (supported %d to %d); upgrade the worker", version, MinProtocolVersion, ProtocolVersion)
+	case version > ProtocolVersion:
+		return fmt.Errorf("worker protocol version %d is newer than supported (supported %d to %d); upgrade the backend first", version, MinProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// ItemV1 is the item schema of 'ProtocolV1'.
+type ItemV1 struct {
+	Bucket    string    `json:"bucket"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Progress  int       `json:"progress"`
+	Canceled  bool      `json:"canceled"`
+	Error     string    `json:"error"`
+	RequestID string    `json:"request_id"`
+}
+
+// Encode returns the item in the schema of the protocol version,
+// to be encoded in JSON.
+func (it *Item) Encode(version int) interface{} {
+	if version > ProtocolV1 {
+		return it
+	}
+	return &ItemV1{
+		Bucket:    it.Bucket,
+		CreatedAt: it.CreatedAt,
+		Key:       it.Key,
+		Value:     it.Value,
+		Progress:  it.Progress,
+		Canceled:  it.Canceled,
+		Error:     it.Error,
+		RequestID: it.RequestID,
+	}
+}
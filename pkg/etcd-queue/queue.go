@@ -4,11 +4,14 @@ package etcdqueue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
 	"sync"
 	"time"
 
+	"github.com/gyuho/dplearn/pkg/tracing"
+
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/golang/glog"
@@ -20,6 +23,25 @@ const (
 
 	// MaxProgress is the progress value when the job is done!
 	MaxProgress = 100
+
+	// GPUJobType is the job type advertised by workers with GPUs.
+	GPUJobType = "gpu"
+
+	// DefaultGPUFallback is the duration that GPU jobs wait for GPU workers,
+	// before being delivered to CPU workers.
+	DefaultGPUFallback = 30 * time.Second
+
+	// DefaultVersionFallback is the duration that jobs routed to a worker
+	// version (e.g. canary) wait for the workers of the version, before
+	// being delivered to other workers.
+	DefaultVersionFallback = 30 * time.Second
+
+	// MaxBatchSize is the maximum number of items that workers claim at a time.
+	MaxBatchSize = 64
+
+	// DeadLetterPrefix is the bucket prefix of the items that are not
+	// retried anymore (e.g. timed out in every attempt), kept for inspection.
+	DeadLetterPrefix = "/dead-letter"
 )
 
 // Item represents a job item in the queue. Key is stored as a key,
@@ -52,6 +74,45 @@ type Item struct {
 	// RequestID is used/generated by external service,
 	// to help identify each item.
 	RequestID string `json:"request_id"`
+
+	// JobType is the type of the job (e.g. "cats-vs-dogs"), to route the item
+	// to workers with the matching capability. Empty JobType matches any worker.
+	JobType string `json:"job_type"`
+
+	// GPU is true if the job should run on GPU workers. GPU jobs are delivered
+	// to GPU workers first, and to CPU workers after the fallback delay.
+	GPU bool `json:"gpu"`
+
+	// StageProgress is the progress reported as named stages, if any.
+	// The queue validates it, and derives 'Progress' from it.
+	StageProgress *StageProgress `json:"stage_progress,omitempty"`
+
+	// TimedOut is true if the worker canceled the job at its deadline.
+	// The queue retries the timed-out item, or moves it to the dead letter
+	// bucket after the maximum number of attempts.
+	TimedOut bool `json:"timed_out,omitempty"`
+
+	// Attempts is the number of times the item has been retried.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Requeue is true if the worker gave up the job before completing it
+	// (e.g. the VM is preempted). The queue adds the item again, without
+	// counting an attempt.
+	Requeue bool `json:"requeue,omitempty"`
+
+	// WorkerVersion is the worker version to deliver the item to
+	// (e.g. canary workers of a new model), empty for any worker.
+	WorkerVersion string `json:"worker_version,omitempty"`
+
+	// User is the name of the user who submitted the job,
+	// empty for anonymous jobs.
+	User string `json:"user,omitempty"`
+}
+
+// DeadLetterBucket returns the dead letter bucket of the bucket.
+// Workers do not claim the items in dead letter buckets.
+func DeadLetterBucket(bucket string) string {
+	return path.Join(DeadLetterPrefix, bucket)
 }
 
 // CreateItem creates an item with auto-generated ID of unix nano seconds.
@@ -103,6 +164,15 @@ func (item1 *Item) Equal(item2 *Item) error {
 	if item1.RequestID != item2.RequestID {
 		return fmt.Errorf("expected RequestID %s, got %s", item1.RequestID, item2.RequestID)
 	}
+	if item1.JobType != item2.JobType {
+		return fmt.Errorf("expected JobType %s, got %s", item1.JobType, item2.JobType)
+	}
+	if item1.GPU != item2.GPU {
+		return fmt.Errorf("expected GPU %v, got %v", item1.GPU, item2.GPU)
+	}
+	if item1.WorkerVersion != item2.WorkerVersion {
+		return fmt.Errorf("expected WorkerVersion %q, got %q", item1.WorkerVersion, item2.WorkerVersion)
+	}
 	return nil
 }
 
@@ -111,7 +181,13 @@ type ItemWatcher <-chan *Item
 
 // Op represents an operation that queue can execute.
 type Op struct {
-	ttl int64
+	ttl         int64
+	jobTypes    []string
+	gpuFallback time.Duration
+
+	versioned       bool
+	workerVersion   string
+	versionFallback time.Duration
 }
 
 // OpOption configures queue operations.
@@ -122,6 +198,88 @@ func WithTTL(dur time.Duration) OpOption {
 	return func(op *Op) { op.ttl = int64(dur.Seconds()) }
 }
 
+// WithJobTypes configures Pop to return only the items of the job types
+// (or items without job type), as the capabilities of the worker.
+func WithJobTypes(types ...string) OpOption {
+	return func(op *Op) { op.jobTypes = types }
+}
+
+// WithGPUFallback configures the duration that GPU jobs wait for GPU workers,
+// before Pop delivers them to the worker without "gpu" job type.
+// Defaults to 'DefaultGPUFallback'.
+func WithGPUFallback(dur time.Duration) OpOption {
+	return func(op *Op) { op.gpuFallback = dur }
+}
+
+// WithWorkerVersion configures Pop to return only the items routed to the
+// worker version (e.g. canary), or the items without version if empty.
+// Items routed to other versions are delivered to the workers without
+// version after 'DefaultVersionFallback', so that they are not stuck when
+// the workers of the version are gone.
+func WithWorkerVersion(version string) OpOption {
+	return func(op *Op) { op.versioned, op.workerVersion = true, version }
+}
+
+// WithVersionFallback configures the duration that items routed to a worker
+// version wait for the workers of the version, before Pop delivers them to
+// the worker without version. Defaults to 'DefaultVersionFallback'.
+func WithVersionFallback(dur time.Duration) OpOption {
+	return func(op *Op) { op.versionFallback = dur }
+}
+
+// matching returns true if Pop should skip the items that do not match.
+func (op *Op) matching() bool {
+	return len(op.jobTypes) > 0 || op.versioned
+}
+
+// gpu returns true if the worker has GPUs.
+func (op *Op) gpu() bool {
+	for _, tp := range op.jobTypes {
+		if tp == GPUJobType {
+			return true
+		}
+	}
+	return false
+}
+
+// deferUntil returns the time until the GPU item can be delivered to
+// the CPU worker, or the item routed to other worker version can be
+// delivered to the worker without version. Returns zero time if the item
+// can be delivered now.
+func (op *Op) deferUntil(item *Item, now time.Time) time.Time {
+	var t time.Time
+	if item.GPU && !op.gpu() {
+		t = item.CreatedAt.Add(op.gpuFallback)
+	}
+	if op.versioned && item.WorkerVersion != "" && item.WorkerVersion != op.workerVersion {
+		if vt := item.CreatedAt.Add(op.versionFallback); vt.After(t) {
+			t = vt
+		}
+	}
+	if now.Before(t) {
+		return t
+	}
+	return time.Time{}
+}
+
+// match returns true if the item can be delivered with the job types,
+// and the worker version.
+func (op *Op) match(item *Item) bool {
+	if op.workerVersion != "" && item.WorkerVersion != op.workerVersion {
+		// only the items routed to the version
+		return false
+	}
+	if len(op.jobTypes) == 0 || item.JobType == "" {
+		return true
+	}
+	for _, tp := range op.jobTypes {
+		if tp == item.JobType {
+			return true
+		}
+	}
+	return false
+}
+
 func (op *Op) applyOpts(opts []OpOption) {
 	for _, opt := range opts {
 		opt(op)
@@ -135,7 +293,24 @@ type Queue interface {
 
 	// Pop returns ItemWatcher that returns the first item in the queue.
 	// It blocks until there is at least one item to return.
-	Pop(ctx context.Context, bucket string) ItemWatcher
+	// Use 'WithJobTypes' to pop only the items of the job types.
+	Pop(ctx context.Context, bucket string, opts ...OpOption) ItemWatcher
+
+	// TryPop claims the first item in the queue without waiting,
+	// returning nil if there is no item to claim (e.g. to fill a batch).
+	// It accepts the same options as Pop.
+	TryPop(ctx context.Context, bucket string, opts ...OpOption) (*Item, error)
+
+	// Depth returns the number of items waiting in the bucket.
+	Depth(ctx context.Context, bucket string) (int64, error)
+
+	// AppendLog appends the log lines of the worker, under the item key.
+	// Use 'WithTTL' to expire the lines.
+	AppendLog(ctx context.Context, key string, lines []string, opts ...OpOption) error
+
+	// WatchLogs streams the log lines of the item key, from the revision
+	// (0 for all lines), until the context is canceled.
+	WatchLogs(ctx context.Context, key string, fromRev int64) LogWatcher
 
 	// Stop stops the queue service and any embedded clients.
 	Stop()
@@ -176,11 +351,19 @@ func NewQueue(cli *clientv3.Client) (Queue, error) {
 
 const pfxQueue = "_queue"
 
-func (qu *queue) Add(ctx context.Context, item *Item, opts ...OpOption) error {
+func (qu *queue) Add(ctx context.Context, item *Item, opts ...OpOption) (err error) {
 	if item == nil {
 		return fmt.Errorf("received <nil> Item")
 	}
 
+	ctx, span := tracing.Start(ctx, "etcdqueue.Add", tracing.SpanKindClient)
+	span.SetAttribute("queue.bucket", item.Bucket)
+	span.SetAttribute("queue.key", item.Key)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	ret := Op{}
 	ret.applyOpts(opts)
 
@@ -201,7 +384,55 @@ func (qu *queue) Add(ctx context.Context, item *Item, opts ...OpOption) error {
 	return nil
 }
 
-func (qu *queue) Pop(ctx context.Context, bucket string) ItemWatcher {
+func (qu *queue) Pop(ctx context.Context, bucket string, opts ...OpOption) ItemWatcher {
+	ret := Op{gpuFallback: DefaultGPUFallback, versionFallback: DefaultVersionFallback}
+	ret.applyOpts(opts)
+
+	ctx, span := tracing.Start(ctx, "etcdqueue.Pop", tracing.SpanKindClient)
+	if span == nil {
+		if ret.matching() {
+			return qu.popMatch(ctx, bucket, ret)
+		}
+		return qu.pop(ctx, bucket)
+	}
+	span.SetAttribute("queue.bucket", bucket)
+
+	// pop synchronously to create watch before returning,
+	// and end the span when the item is received
+	var wch ItemWatcher
+	if ret.matching() {
+		wch = qu.popMatch(ctx, bucket, ret)
+	} else {
+		wch = qu.pop(ctx, bucket)
+	}
+	ch := make(chan *Item, 1)
+	go func() {
+		defer close(ch)
+		defer span.End()
+
+		item, ok := <-wch
+		if !ok {
+			return
+		}
+		if item.Error != "" {
+			span.SetError(errors.New(item.Error))
+		} else {
+			span.SetAttribute("queue.key", item.Key)
+		}
+		ch <- item
+	}()
+	return ch
+}
+
+func (qu *queue) TryPop(ctx context.Context, bucket string, opts ...OpOption) (*Item, error) {
+	ret := Op{gpuFallback: DefaultGPUFallback, versionFallback: DefaultVersionFallback}
+	ret.applyOpts(opts)
+
+	item, _, _, err := qu.scanMatch(ctx, path.Join(pfxQueue, bucket)+"/", ret)
+	return item, err
+}
+
+func (qu *queue) pop(ctx context.Context, bucket string) ItemWatcher {
 	ch := make(chan *Item, 1)
 
 	pfxQueueBucket := path.Join(pfxQueue, bucket)
@@ -285,6 +516,179 @@ func (qu *queue) Pop(ctx context.Context, bucket string) ItemWatcher {
 	return ch
 }
 
+// popMatch pops the first item that matches the job types and the worker
+// version. Unlike 'pop', it skips non-matching items and deletes the item
+// in a transaction, so that the item is never delivered to more than one
+// worker. GPU items are skipped for CPU workers until the GPU fallback
+// delay, as are the items routed to other worker versions.
+func (qu *queue) popMatch(ctx context.Context, bucket string, op Op) ItemWatcher {
+	ch := make(chan *Item, 1)
+
+	pfxQueueBucket := path.Join(pfxQueue, bucket) + "/"
+	item, rev, next, err := qu.scanMatch(ctx, pfxQueueBucket, op)
+	if err != nil {
+		ch <- &Item{Error: err.Error()}
+		close(ch)
+		return ch
+	}
+	if item != nil {
+		ch <- item
+		close(ch)
+		return ch
+	}
+
+	go func() {
+		defer close(ch)
+		for {
+			// watch from the revision of the range request, to not miss any item
+			wctx, wcancel := context.WithCancel(ctx)
+			wch := qu.cli.Watch(wctx, pfxQueueBucket, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+			item, err := qu.watchMatch(ctx, pfxQueueBucket, wch, op, next)
+			wcancel()
+			if err != nil {
+				ch <- &Item{Error: err.Error()}
+				return
+			}
+			if item != nil {
+				ch <- item
+				return
+			}
+
+			// deferred GPU item is now eligible
+			item, rev, next, err = qu.scanMatch(ctx, pfxQueueBucket, op)
+			if err != nil {
+				ch <- &Item{Error: err.Error()}
+				return
+			}
+			if item != nil {
+				ch <- item
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// scanMatch claims the first matching item in the bucket. If none is claimed,
+// it returns the revision of the range request and the earliest time that
+// a deferred GPU item can be delivered (zero if none).
+func (qu *queue) scanMatch(ctx context.Context, pfxQueueBucket string, op Op) (*Item, int64, time.Time, error) {
+	resp, err := qu.cli.Get(ctx, pfxQueueBucket, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+	var next time.Time
+	for _, kv := range resp.Kvs {
+		item, deferred, err := qu.claim(ctx, kv, op)
+		if err != nil {
+			return nil, 0, time.Time{}, err
+		}
+		if item != nil {
+			return item, 0, time.Time{}, nil
+		}
+		next = earliest(next, deferred)
+	}
+	return nil, resp.Header.Revision, next, nil
+}
+
+// watchMatch claims the first matching item from the watch events.
+// It returns nil item and nil error when the deferred GPU item
+// becomes eligible at 'next', so that the caller rescans the bucket.
+func (qu *queue) watchMatch(ctx context.Context, pfxQueueBucket string, wch clientv3.WatchChan, op Op, next time.Time) (*Item, error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		var timec <-chan time.Time
+		if !next.IsZero() {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(time.Until(next))
+			timec = timer.C
+		}
+
+		select {
+		case wresp, ok := <-wch:
+			if !ok {
+				return nil, fmt.Errorf("%q watch has been closed (%v)", pfxQueueBucket, ctx.Err())
+			}
+			if wresp.Err() != nil {
+				return nil, fmt.Errorf("%q returned error %v", pfxQueueBucket, wresp.Err())
+			}
+			for _, ev := range wresp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				item, deferred, err := qu.claim(ctx, ev.Kv, op)
+				if err != nil {
+					return nil, err
+				}
+				if item != nil {
+					return item, nil
+				}
+				next = earliest(next, deferred)
+			}
+
+		case <-timec:
+			return nil, nil
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// claim deletes the item if it matches the job types and has not been
+// modified or claimed by other workers. Returns nil item if not claimed,
+// with the time that the deferred GPU item can be delivered.
+func (qu *queue) claim(ctx context.Context, kv *mvccpb.KeyValue, op Op) (*Item, time.Time, error) {
+	var item Item
+	if err := json.Unmarshal(kv.Value, &item); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%q returned wrong JSON %q (%v)", string(kv.Key), string(kv.Value), err)
+	}
+	if !op.match(&item) {
+		return nil, time.Time{}, nil
+	}
+	if t := op.deferUntil(&item, time.Now()); !t.IsZero() {
+		return nil, t, nil
+	}
+	key := string(kv.Key)
+	resp, err := qu.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to delete %q (%v)", key, err)
+	}
+	if !resp.Succeeded {
+		return nil, time.Time{}, nil
+	}
+	if item.GPU && !op.gpu() {
+		glog.Warningf("queue: no GPU worker claimed %q in %v, delivering GPU job to CPU worker", item.Key, op.gpuFallback)
+	}
+	return &item, time.Time{}, nil
+}
+
+// earliest returns the earlier non-zero time.
+func earliest(t1, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
+
+func (qu *queue) Depth(ctx context.Context, bucket string) (int64, error) {
+	resp, err := qu.cli.Get(ctx, path.Join(pfxQueue, bucket)+"/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
 func (qu *queue) Stop() {
 	qu.writemu.Lock()
 	defer qu.writemu.Unlock()
@@ -13,7 +13,8 @@ import (
 
 // implements Queue interface with a single-node embedded etcd cluster.
 type embeddedQueue struct {
-	srv *embed.Etcd
+	srv     *embed.Etcd
+	dataDir string
 	Queue
 }
 
@@ -66,14 +67,17 @@ func NewEmbeddedQueue(ctx context.Context, cport, pport int, dataDir string) (Qu
 	glog.Infof("sent GET to endpoint %q (error: %v)", curl.String(), err)
 
 	cctx, cancel := context.WithCancel(ctx)
-	return &embeddedQueue{
-		srv: srv,
+	qu := &embeddedQueue{
+		srv:     srv,
+		dataDir: dataDir,
 		Queue: &queue{
 			cli:        cli,
 			rootCtx:    cctx,
 			rootCancel: cancel,
 		},
-	}, err
+	}
+	go qu.runDiskGC(cctx, DefaultMinDiskSpace, diskCheckInterval)
+	return qu, err
 }
 
 func (qu *embeddedQueue) Stop() {
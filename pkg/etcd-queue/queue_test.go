@@ -85,6 +85,13 @@ func TestQueue(t *testing.T) {
 	if err = qu.Add(context.Background(), item4); err != nil {
 		t.Fatal(err)
 	}
+	depth, err := qu.Depth(context.Background(), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth != 2 {
+		t.Fatalf("expected depth 2, got %d", depth)
+	}
 	popCh3 := qu.Pop(context.Background(), testBucket)
 	if err != nil {
 		t.Fatal(err)
@@ -131,3 +138,335 @@ func TestQueue(t *testing.T) {
 	default:
 	}
 }
+
+func TestQueueJobTypes(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	testBucket := "test-bucket"
+
+	item1 := CreateItem(testBucket, 9000, "test-data-1")
+	item1.JobType = "word-predict"
+	item2 := CreateItem(testBucket, 1000, "test-data-2")
+	item2.JobType = "cats-vs-dogs"
+	if err = qu.Add(context.Background(), item1); err != nil {
+		t.Fatal(err)
+	}
+	if err = qu.Add(context.Background(), item2); err != nil {
+		t.Fatal(err)
+	}
+
+	// skips higher priority 'word-predict'
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs")):
+		if err = item2.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item2, item, err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected events, but got none")
+	}
+
+	// blocks until matching item is added
+	popCh := qu.Pop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs"))
+	item3 := CreateItem(testBucket, 1000, "test-data-3")
+	item3.JobType = "gpu"
+	if err = qu.Add(context.Background(), item3); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case item := <-popCh:
+		t.Fatalf("unexpected item %+v", item)
+	case <-time.After(time.Second):
+	}
+	item4 := CreateItem(testBucket, 1000, "test-data-4")
+	item4.JobType = "cats-vs-dogs"
+	if err = qu.Add(context.Background(), item4); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case item := <-popCh:
+		if err = item4.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item4, item, err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected events, but got none")
+	}
+
+	depth, err := qu.Depth(context.Background(), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth != 2 {
+		t.Fatalf("expected depth 2, got %d", depth)
+	}
+}
+
+func TestQueueTryPop(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	testBucket := "test-bucket"
+
+	item, err := qu.TryPop(context.Background(), testBucket)
+	if err != nil || item != nil {
+		t.Fatalf("expected no item, got %+v (%v)", item, err)
+	}
+
+	item1 := CreateItem(testBucket, 1000, "test-data-1")
+	item2 := CreateItem(testBucket, 9000, "test-data-2")
+	item2.JobType = "word-predict"
+	for _, it := range []*Item{item1, item2} {
+		if err = qu.Add(context.Background(), it); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// skips higher priority 'word-predict'
+	item, err = qu.TryPop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = item1.Equal(item); err != nil {
+		t.Fatalf("expected %+v, got %+v (%v)", item1, item, err)
+	}
+	item, err = qu.TryPop(context.Background(), testBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = item2.Equal(item); err != nil {
+		t.Fatalf("expected %+v, got %+v (%v)", item2, item, err)
+	}
+	item, err = qu.TryPop(context.Background(), testBucket)
+	if err != nil || item != nil {
+		t.Fatalf("expected no item, got %+v (%v)", item, err)
+	}
+}
+
+func TestQueueGPUFallback(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	testBucket := "test-bucket"
+
+	item1 := CreateItem(testBucket, 9000, "test-data-1")
+	item1.JobType = "cats-vs-dogs"
+	item1.GPU = true
+	item2 := CreateItem(testBucket, 1000, "test-data-2")
+	item2.JobType = "cats-vs-dogs"
+	if err = qu.Add(context.Background(), item1); err != nil {
+		t.Fatal(err)
+	}
+	if err = qu.Add(context.Background(), item2); err != nil {
+		t.Fatal(err)
+	}
+
+	// CPU worker skips higher priority GPU item
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs"), WithGPUFallback(2*time.Second)):
+		if err = item2.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item2, item, err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected events, but got none")
+	}
+
+	// CPU worker receives GPU item after fallback
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs"), WithGPUFallback(2*time.Second)):
+		if err = item1.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item1, item, err)
+		}
+		if time.Since(item1.CreatedAt) < 2*time.Second {
+			t.Fatalf("expected GPU item after fallback, got in %v", time.Since(item1.CreatedAt))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected events, but got none")
+	}
+
+	// GPU worker receives GPU item immediately
+	item3 := CreateItem(testBucket, 1000, "test-data-3")
+	item3.JobType = "cats-vs-dogs"
+	item3.GPU = true
+	if err = qu.Add(context.Background(), item3); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithJobTypes("cats-vs-dogs", GPUJobType)):
+		if err = item3.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item3, item, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected events, but got none")
+	}
+}
+
+func TestQueueWorkerVersion(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	testBucket := "test-bucket"
+
+	item1 := CreateItem(testBucket, 9000, "test-data-1")
+	item1.WorkerVersion = "v2"
+	item2 := CreateItem(testBucket, 1000, "test-data-2")
+	if err = qu.Add(context.Background(), item1); err != nil {
+		t.Fatal(err)
+	}
+	if err = qu.Add(context.Background(), item2); err != nil {
+		t.Fatal(err)
+	}
+
+	// canary worker receives only the items routed to its version
+	item, err := qu.TryPop(context.Background(), testBucket, WithWorkerVersion("v3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item != nil {
+		t.Fatalf("expected no item for other version, got %+v", item)
+	}
+	item, err = qu.TryPop(context.Background(), testBucket, WithWorkerVersion("v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = item1.Equal(item); err != nil {
+		t.Fatalf("expected %+v, got %+v (%v)", item1, item, err)
+	}
+
+	// stable worker skips higher priority canary item until fallback
+	item3 := CreateItem(testBucket, 9000, "test-data-3")
+	item3.WorkerVersion = "v2"
+	if err = qu.Add(context.Background(), item3); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithWorkerVersion(""), WithVersionFallback(2*time.Second)):
+		if err = item2.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item2, item, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected events, but got none")
+	}
+	select {
+	case item := <-qu.Pop(context.Background(), testBucket, WithWorkerVersion(""), WithVersionFallback(2*time.Second)):
+		if err = item3.Equal(item); err != nil {
+			t.Fatalf("expected %+v, got %+v (%v)", item3, item, err)
+		}
+		if time.Since(item3.CreatedAt) < 2*time.Second {
+			t.Fatalf("expected canary item after fallback, got in %v", time.Since(item3.CreatedAt))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected events, but got none")
+	}
+}
+
+func TestQueueLogs(t *testing.T) {
+	cport := int(atomic.LoadInt32(&basePort))
+	atomic.StoreInt32(&basePort, int32(cport)+2)
+
+	dataDir, err := ioutil.TempDir(os.TempDir(), "etcd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := NewEmbeddedQueue(context.Background(), cport, cport+1, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	item := CreateItem("test-bucket", 1000, "test-data")
+	if err = qu.AppendLog(context.Background(), item.Key, []string{"loading model", "loaded model"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wch := qu.WatchLogs(ctx, item.Key, 0)
+	var last *LogLine
+	for _, exp := range []string{"loading model", "loaded model"} {
+		select {
+		case ll := <-wch:
+			if ll.Error != "" || ll.Line != exp {
+				t.Fatalf("expected %q, got %+v", exp, ll)
+			}
+			last = ll
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected log lines, but got none")
+		}
+	}
+
+	// streams lines appended after watch
+	if err = qu.AppendLog(context.Background(), item.Key, []string{"classified"}, WithTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ll := <-wch:
+		if ll.Line != "classified" {
+			t.Fatalf("expected %q, got %+v", "classified", ll)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected log lines, but got none")
+	}
+	cancel()
+
+	// resumes after the last line
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	select {
+	case ll := <-qu.WatchLogs(ctx2, item.Key, last.Rev+1):
+		if ll.Line != "classified" {
+			t.Fatalf("expected %q, got %+v", "classified", ll)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected log lines, but got none")
+	}
+}
@@ -0,0 +1,4 @@
+// Package experiment tracks training runs in etcd: the hyperparameters,
+// per-epoch metrics, and final scores of each run, keyed by run ID, so
+// that repeated training runs can be listed and compared.
+package experiment
@@ -0,0 +1,307 @@
+package experiment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+)
+
+// Run status.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+var (
+	// ErrNotFound is returned when the run is not found.
+	ErrNotFound = errors.New("experiment: run not found")
+
+	// ErrExists is returned when the run ID is already used.
+	ErrExists = errors.New("experiment: run already exists")
+
+	// ErrFinished is returned when the run is already finished.
+	ErrFinished = errors.New("experiment: run already finished")
+
+	// ErrInvalidRun is returned when the run ID or experiment name is not valid.
+	ErrInvalidRun = errors.New("experiment: invalid run ID or experiment name")
+)
+
+// Epoch is the metrics of the training epoch (or the iteration step).
+type Epoch struct {
+	Epoch   int                `json:"epoch"`
+	Metrics map[string]float64 `json:"metrics"`
+	Time    time.Time          `json:"time"`
+}
+
+// Run is the training run.
+type Run struct {
+	ID string `json:"id"`
+	// Experiment groups the runs to compare (e.g. "cats-vs-dogs").
+	Experiment string `json:"experiment"`
+	// Params are the hyperparameters (e.g. "learning_rate").
+	Params map[string]string `json:"params,omitempty"`
+	// Scores are the final scores (e.g. "test_accuracy").
+	Scores map[string]float64 `json:"scores,omitempty"`
+
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Epochs are the per-epoch metrics, only returned by 'Get' and 'Compare'.
+	Epochs []Epoch `json:"epochs,omitempty"`
+}
+
+// Comparison is the side-by-side comparison of the runs.
+type Comparison struct {
+	Runs []Run `json:"runs"`
+	// Params are the names of all hyperparameters of the runs,
+	// and Differs are the ones with different values across the runs.
+	Params  []string `json:"params"`
+	Differs []string `json:"differs"`
+	// Scores are the names of all scores of the runs.
+	Scores []string `json:"scores"`
+}
+
+// Config defines experiment tracker configuration.
+type Config struct {
+	// Prefix is the etcd key prefix of the runs, and epochs.
+	// Defaults to "_experiment".
+	Prefix string
+}
+
+// Tracker records the training runs.
+type Tracker struct {
+	cli *clientv3.Client
+	cfg Config
+}
+
+// New creates a new experiment tracker.
+func New(cli *clientv3.Client, cfg Config) *Tracker {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_experiment"
+	}
+	return &Tracker{cli: cli, cfg: cfg}
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func valid(s string) bool { return len(s) <= 256 && validName.MatchString(s) }
+
+func (t *Tracker) runsPrefix() string      { return path.Join(t.cfg.Prefix, "runs") + "/" }
+func (t *Tracker) runKey(id string) string { return t.runsPrefix() + id }
+func (t *Tracker) epochsPrefix(id string) string {
+	return path.Join(t.cfg.Prefix, "epochs", id) + "/"
+}
+
+// epochKey is zero-padded, so that the epochs are sorted by key.
+func (t *Tracker) epochKey(id string, epoch int) string {
+	return fmt.Sprintf("%s%010d", t.epochsPrefix(id), epoch)
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)[:8]
+}
+
+// Start records the new run, generating the ID if empty.
+func (t *Tracker) Start(ctx context.Context, r Run) (Run, error) {
+	if r.ID == "" {
+		r.ID = newRunID()
+	}
+	if !valid(r.ID) || !valid(r.Experiment) {
+		return r, ErrInvalidRun
+	}
+	r.Scores, r.Epochs, r.Error = nil, nil, ""
+	r.Status, r.StartedAt, r.FinishedAt = StatusRunning, time.Now(), time.Time{}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+	key := t.runKey(r.ID)
+	resp, err := t.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return r, err
+	}
+	if !resp.Succeeded {
+		return r, ErrExists
+	}
+	glog.Infof("started run %q of experiment %q (params %v)", r.ID, r.Experiment, r.Params)
+	return r, nil
+}
+
+// get returns the run without the epochs, and its revision.
+func (t *Tracker) get(ctx context.Context, id string) (Run, int64, error) {
+	if !valid(id) {
+		return Run{}, 0, ErrInvalidRun
+	}
+	resp, err := t.cli.Get(ctx, t.runKey(id))
+	if err != nil {
+		return Run{}, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return Run{}, 0, ErrNotFound
+	}
+	var r Run
+	err = json.Unmarshal(resp.Kvs[0].Value, &r)
+	return r, resp.Kvs[0].ModRevision, err
+}
+
+// LogEpoch records the metrics of the epoch, overwriting the previous
+// metrics of the same epoch (e.g. on retried jobs).
+func (t *Tracker) LogEpoch(ctx context.Context, id string, e Epoch) error {
+	if e.Epoch < 0 {
+		return fmt.Errorf("experiment: invalid epoch %d", e.Epoch)
+	}
+	r, _, err := t.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.Status != StatusRunning {
+		return ErrFinished
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = t.cli.Put(ctx, t.epochKey(id, e.Epoch), string(data))
+	return err
+}
+
+// Finish records the final scores of the run, and marks it completed,
+// or failed if 'errMsg' is not empty.
+func (t *Tracker) Finish(ctx context.Context, id string, scores map[string]float64, errMsg string) (Run, error) {
+	for {
+		r, rev, err := t.get(ctx, id)
+		if err != nil {
+			return r, err
+		}
+		if r.Status != StatusRunning {
+			return r, ErrFinished
+		}
+		r.Scores, r.Error, r.FinishedAt = scores, errMsg, time.Now()
+		r.Status = StatusCompleted
+		if errMsg != "" {
+			r.Status = StatusFailed
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return r, err
+		}
+
+		// retry if updated concurrently (e.g. finished by another job)
+		key := t.runKey(id)
+		resp, err := t.cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+			Then(clientv3.OpPut(key, string(data))).
+			Commit()
+		if err != nil {
+			return r, err
+		}
+		if resp.Succeeded {
+			glog.Infof("run %q %s (scores %v)", id, r.Status, scores)
+			return r, nil
+		}
+	}
+}
+
+// Get returns the run with the epochs, or 'ErrNotFound'.
+func (t *Tracker) Get(ctx context.Context, id string) (Run, error) {
+	r, _, err := t.get(ctx, id)
+	if err != nil {
+		return r, err
+	}
+	resp, err := t.cli.Get(ctx, t.epochsPrefix(id), clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return r, err
+	}
+	for _, kv := range resp.Kvs {
+		var e Epoch
+		if err = json.Unmarshal(kv.Value, &e); err != nil {
+			glog.Warningf("epoch %q is invalid (%v)", string(kv.Key), err)
+			continue
+		}
+		r.Epochs = append(r.Epochs, e)
+	}
+	return r, nil
+}
+
+// List returns the runs without the epochs sorted by start time,
+// of the experiment, or of all experiments if empty.
+func (t *Tracker) List(ctx context.Context, experiment string) ([]Run, error) {
+	resp, err := t.cli.Get(ctx, t.runsPrefix(), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	rs := make([]Run, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var r Run
+		if err = json.Unmarshal(kv.Value, &r); err != nil {
+			glog.Warningf("run %q is invalid (%v)", string(kv.Key), err)
+			continue
+		}
+		if experiment == "" || r.Experiment == experiment {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].StartedAt.Before(rs[j].StartedAt) })
+	return rs, nil
+}
+
+// Compare returns the comparison of the runs, in the order of the IDs,
+// or 'ErrNotFound' if any of the runs is not found.
+func (t *Tracker) Compare(ctx context.Context, ids []string) (Comparison, error) {
+	c := Comparison{Runs: make([]Run, 0, len(ids))}
+	params, scores := make(map[string]bool), make(map[string]bool)
+	for _, id := range ids {
+		r, err := t.Get(ctx, id)
+		if err != nil {
+			return c, err
+		}
+		for k := range r.Params {
+			params[k] = true
+		}
+		for k := range r.Scores {
+			scores[k] = true
+		}
+		c.Runs = append(c.Runs, r)
+	}
+	c.Params, c.Scores = sortedKeys(params), sortedKeys(scores)
+	c.Differs = []string{}
+	for _, k := range c.Params {
+		for _, r := range c.Runs {
+			if v, ok := r.Params[k]; !ok || v != c.Runs[0].Params[k] {
+				c.Differs = append(c.Differs, k)
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,115 @@
+package experiment
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestTracker(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "experiment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 27379, 27380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	ctx := context.Background()
+	tr := New(qu.Client(), Config{})
+
+	r1, err := tr.Start(ctx, Run{Experiment: "cats", Params: map[string]string{"learning_rate": "0.0075", "layers": "20,7,5,1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.ID == "" || r1.Status != StatusRunning {
+		t.Fatalf("unexpected run %+v", r1)
+	}
+	if _, err = tr.Start(ctx, Run{ID: r1.ID, Experiment: "cats"}); err != ErrExists {
+		t.Fatalf("expected %v, got %v", ErrExists, err)
+	}
+	if _, err = tr.Start(ctx, Run{ID: "a/b", Experiment: "cats"}); err != ErrInvalidRun {
+		t.Fatalf("expected %v, got %v", ErrInvalidRun, err)
+	}
+	r2, err := tr.Start(ctx, Run{ID: "run-2", Experiment: "cats", Params: map[string]string{"learning_rate": "0.01", "layers": "20,7,5,1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Start(ctx, Run{ID: "other-1", Experiment: "dogs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// epochs are sorted numerically, and overwritten on retries
+	for _, e := range []Epoch{
+		{Epoch: 100, Metrics: map[string]float64{"cost": 0.5}},
+		{Epoch: 0, Metrics: map[string]float64{"cost": 0.9}},
+		{Epoch: 100, Metrics: map[string]float64{"cost": 0.4}},
+	} {
+		if err = tr.LogEpoch(ctx, r1.ID, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tr.LogEpoch(ctx, "unknown", Epoch{}); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	if _, err = tr.Finish(ctx, r1.ID, map[string]float64{"test_accuracy": 0.8}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Finish(ctx, r1.ID, nil, ""); err != ErrFinished {
+		t.Fatalf("expected %v, got %v", ErrFinished, err)
+	}
+	if err = tr.LogEpoch(ctx, r1.ID, Epoch{Epoch: 200}); err != ErrFinished {
+		t.Fatalf("expected %v, got %v", ErrFinished, err)
+	}
+	if r2, err = tr.Finish(ctx, r2.ID, nil, "diverged"); err != nil {
+		t.Fatal(err)
+	}
+	if r2.Status != StatusFailed {
+		t.Fatalf("status expected %q, got %q", StatusFailed, r2.Status)
+	}
+
+	r, err := tr.Get(ctx, r1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusCompleted || r.Scores["test_accuracy"] != 0.8 || r.FinishedAt.IsZero() {
+		t.Fatalf("unexpected run %+v", r)
+	}
+	if len(r.Epochs) != 2 || r.Epochs[0].Epoch != 0 || r.Epochs[1].Metrics["cost"] != 0.4 {
+		t.Fatalf("unexpected epochs %+v", r.Epochs)
+	}
+
+	rs, err := tr.List(ctx, "cats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].ID != r1.ID || rs[1].ID != "run-2" || rs[0].Epochs != nil {
+		t.Fatalf("unexpected runs %+v", rs)
+	}
+	if rs, err = tr.List(ctx, ""); err != nil || len(rs) != 3 {
+		t.Fatalf("expected 3 runs, got %+v (%v)", rs, err)
+	}
+
+	c, err := tr.Compare(ctx, []string{"run-2", r1.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Runs[0].ID != "run-2" || len(c.Runs[1].Epochs) != 2 {
+		t.Fatalf("unexpected runs %+v", c.Runs)
+	}
+	if !reflect.DeepEqual(c.Params, []string{"layers", "learning_rate"}) || !reflect.DeepEqual(c.Differs, []string{"learning_rate"}) || !reflect.DeepEqual(c.Scores, []string{"test_accuracy"}) {
+		t.Fatalf("unexpected comparison %+v", c)
+	}
+	if _, err = tr.Compare(ctx, []string{r1.ID, "unknown"}); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,6 @@
+// Package feature implements the feature flags stored in etcd, to toggle
+// risky features (e.g. a new worker protocol, speculative execution) per
+// deployment, or roll them out to a percentage of the jobs or users,
+// without redeploying. Every server keeps the flags in memory, updated
+// by an etcd watch.
+package feature
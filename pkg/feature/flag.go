@@ -0,0 +1,75 @@
+package feature
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+
+// Flag defines a feature flag.
+type Flag struct {
+	// Name is the name of the feature (e.g. "worker-protocol-v2").
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Percent is the percentage (0 to 100) of the keys (e.g. request
+	// IDs, users) the feature is on for. 0 turns it off, and 100 on.
+	Percent int `json:"percent"`
+	// Deployments overrides the percentage in the deployments
+	// (e.g. {"staging": 100, "prod": 5}).
+	Deployments map[string]int `json:"deployments,omitempty"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// Validate returns an error if the flag is not valid.
+func (f Flag) Validate() error {
+	if !validName.MatchString(f.Name) {
+		return fmt.Errorf("invalid feature name %q (lowercase letters, digits, '.', and '-')", f.Name)
+	}
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("feature %q percent %d is not in [0, 100]", f.Name, f.Percent)
+	}
+	for d, p := range f.Deployments {
+		if d == "" {
+			return fmt.Errorf("feature %q has empty deployment name", f.Name)
+		}
+		if p < 0 || p > 100 {
+			return fmt.Errorf("feature %q percent %d in deployment %q is not in [0, 100]", f.Name, p, d)
+		}
+	}
+	return nil
+}
+
+// PercentOf returns the percentage of the feature in the deployment.
+func (f Flag) PercentOf(deployment string) int {
+	if p, ok := f.Deployments[deployment]; ok {
+		return p
+	}
+	return f.Percent
+}
+
+// On returns true if the feature is on for the key in the deployment.
+// The same key is always in or out of the rollout, and stays in as
+// the percentage increases.
+func (f Flag) On(deployment, key string) bool {
+	p := f.PercentOf(deployment)
+	switch {
+	case p <= 0:
+		return false
+	case p >= 100:
+		return true
+	}
+	return rolloutBucket(f.Name, key) < p
+}
+
+// rolloutBucket hashes the key to [0, 100), with the feature name
+// so that each feature rolls out to a different subset of the keys.
+func rolloutBucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,54 @@
+package feature
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFlagValidate(t *testing.T) {
+	for i, tt := range []struct {
+		flag Flag
+		ok   bool
+	}{
+		{Flag{Name: "worker-protocol-v2", Percent: 100}, true},
+		{Flag{Name: "api.v2", Deployments: map[string]int{"staging": 100}}, true},
+		{Flag{Name: "Speculation"}, false},
+		{Flag{Name: ""}, false},
+		{Flag{Name: "a", Percent: 101}, false},
+		{Flag{Name: "a", Deployments: map[string]int{"prod": -1}}, false},
+		{Flag{Name: "a", Deployments: map[string]int{"": 10}}, false},
+	} {
+		if err := tt.flag.Validate(); (err == nil) != tt.ok {
+			t.Fatalf("#%d: expected ok %v, got %v", i, tt.ok, err)
+		}
+	}
+}
+
+func TestFlagOn(t *testing.T) {
+	f := Flag{Name: "speculative-execution", Percent: 20, Deployments: map[string]int{"staging": 100, "prod": 0}}
+	if !f.On("staging", "x") || f.On("prod", "x") {
+		t.Fatal("expected per-deployment override")
+	}
+
+	on := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("req-%d", i)
+		if f.On("dev", key) {
+			on[key] = true
+		}
+		if f.On("dev", key) != on[key] {
+			t.Fatalf("%q: expected the same result", key)
+		}
+	}
+	if len(on) < 150 || len(on) > 250 {
+		t.Fatalf("expected about 20%% of keys, got %d", len(on))
+	}
+
+	// keys stay in the rollout as the percentage increases
+	f.Percent = 50
+	for key := range on {
+		if !f.On("dev", key) {
+			t.Fatalf("%q: expected on at 50%%", key)
+		}
+	}
+}
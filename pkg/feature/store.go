@@ -0,0 +1,180 @@
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+)
+
+// ErrNotFound is returned when the feature flag is not found.
+var ErrNotFound = errors.New("feature: flag not found")
+
+// Config defines feature flag store configuration.
+type Config struct {
+	// Deployment is the name of the deployment of the server (e.g. "prod"),
+	// to evaluate the per-deployment percentages.
+	Deployment string
+	// Prefix is the etcd key prefix of the flags. Defaults to "_features".
+	Prefix string
+}
+
+// Store stores the feature flags in etcd, and evaluates them
+// on the flags kept in memory by 'Run'.
+type Store struct {
+	cli *clientv3.Client
+	cfg Config
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// New creates a new feature flag store.
+func New(cli *clientv3.Client, cfg Config) *Store {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_features"
+	}
+	return &Store{cli: cli, cfg: cfg, flags: make(map[string]Flag)}
+}
+
+// Deployment returns the deployment name of the server.
+func (s *Store) Deployment() string { return s.cfg.Deployment }
+
+func (s *Store) prefix() string             { return strings.TrimSuffix(s.cfg.Prefix, "/") + "/" }
+func (s *Store) flagKey(name string) string { return s.prefix() + name }
+
+// Put creates or replaces the flag.
+func (s *Store) Put(ctx context.Context, f Flag, now time.Time) (Flag, error) {
+	if err := f.Validate(); err != nil {
+		return f, err
+	}
+	f.UpdatedAt = now
+	data, err := json.Marshal(f)
+	if err != nil {
+		return f, err
+	}
+	if _, err = s.cli.Put(ctx, s.flagKey(f.Name), string(data)); err != nil {
+		return f, err
+	}
+	s.mu.Lock()
+	s.flags[f.Name] = f
+	s.mu.Unlock()
+	glog.Infof("put feature %q (%d%%, deployments %v)", f.Name, f.Percent, f.Deployments)
+	return f, nil
+}
+
+// Delete deletes the flag.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	resp, err := s.cli.Delete(ctx, s.flagKey(name))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.flags, name)
+	s.mu.Unlock()
+	if resp.Deleted == 0 {
+		return ErrNotFound
+	}
+	glog.Infof("deleted feature %q", name)
+	return nil
+}
+
+// Lookup returns the flag, and false if not defined.
+func (s *Store) Lookup(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[name]
+	return f, ok
+}
+
+// List returns the flags, sorted by name.
+func (s *Store) List() []Flag {
+	s.mu.RLock()
+	fs := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		fs = append(fs, f)
+	}
+	s.mu.RUnlock()
+	sort.Slice(fs, func(i, j int) bool { return fs[i].Name < fs[j].Name })
+	return fs
+}
+
+// Enabled returns true if the feature is on for the key in the
+// deployment of the server. Undefined features are off.
+func (s *Store) Enabled(name, key string) bool {
+	f, ok := s.Lookup(name)
+	return ok && f.On(s.cfg.Deployment, key)
+}
+
+// Evaluate returns whether each feature is on for the key.
+func (s *Store) Evaluate(key string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[string]bool, len(s.flags))
+	for name, f := range s.flags {
+		m[name] = f.On(s.cfg.Deployment, key)
+	}
+	return m
+}
+
+// Run keeps the flags in memory up to date with etcd,
+// until the context is canceled.
+func (s *Store) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		resp, err := s.cli.Get(ctx, s.prefix(), clientv3.WithPrefix())
+		if err != nil {
+			if ctx.Err() == nil {
+				glog.Warningf("failed to get features (%v)", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		flags := make(map[string]Flag, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			if f, ok := s.decode(kv.Key, kv.Value); ok {
+				flags[f.Name] = f
+			}
+		}
+		s.mu.Lock()
+		s.flags = flags
+		s.mu.Unlock()
+
+		wch := s.cli.Watch(ctx, s.prefix(), clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wresp := range wch {
+			for _, ev := range wresp.Events {
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					if f, ok := s.decode(ev.Kv.Key, ev.Kv.Value); ok {
+						s.mu.Lock()
+						s.flags[f.Name] = f
+						s.mu.Unlock()
+					}
+				case clientv3.EventTypeDelete:
+					s.mu.Lock()
+					delete(s.flags, strings.TrimPrefix(string(ev.Kv.Key), s.prefix()))
+					s.mu.Unlock()
+				}
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Store) decode(key, val []byte) (Flag, bool) {
+	var f Flag
+	if err := json.Unmarshal(val, &f); err != nil {
+		glog.Warningf("invalid feature %q (%v)", string(key), err)
+		return f, false
+	}
+	if err := f.Validate(); err != nil {
+		glog.Warningf("invalid feature %q (%v)", string(key), err)
+		return f, false
+	}
+	return f, true
+}
@@ -0,0 +1,74 @@
+package feature
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestStore(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 37379, 37380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s1 := New(qu.Client(), Config{Deployment: "staging"})
+	if _, err = s1.Put(ctx, Flag{Name: "worker-protocol-v2", Deployments: map[string]int{"staging": 100}}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s1.Put(ctx, Flag{Name: "Invalid"}, time.Now()); err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	// another server sees the flags, and their updates
+	s2 := New(qu.Client(), Config{Deployment: "prod"})
+	go s2.Run(ctx)
+	waitFor(t, func() bool { _, ok := s2.Lookup("worker-protocol-v2"); return ok })
+	if !s1.Enabled("worker-protocol-v2", "req-1") || s2.Enabled("worker-protocol-v2", "req-1") {
+		t.Fatal("expected the feature on in staging only")
+	}
+	if s2.Enabled("unknown", "req-1") {
+		t.Fatal("expected undefined feature off")
+	}
+
+	if _, err = s1.Put(ctx, Flag{Name: "worker-protocol-v2", Percent: 100}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return s2.Enabled("worker-protocol-v2", "req-1") })
+	if ev := s2.Evaluate("req-1"); len(ev) != 1 || !ev["worker-protocol-v2"] {
+		t.Fatalf("unexpected evaluation %v", ev)
+	}
+
+	if err = s1.Delete(ctx, "worker-protocol-v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s1.Delete(ctx, "worker-protocol-v2"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	waitFor(t, func() bool { return len(s2.List()) == 0 })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("took too long")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
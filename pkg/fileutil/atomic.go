@@ -0,0 +1,53 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temporary file in the same directory,
+// syncs it, and renames it to the path, so that readers never observe a
+// partially written file: the path holds either the previous content or
+// the new one. The file is created with the permission 'perm'.
+func WriteFileAtomic(fpath string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(fpath)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(fpath)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, fpath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory, to persist the renamed entry.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
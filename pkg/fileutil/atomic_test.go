@@ -0,0 +1,52 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "package.json")
+	for _, data := range []string{"{}", `{"name": "dplearn"}`} {
+		if err = WriteFileAtomic(fpath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		bts, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bts) != data {
+			t.Fatalf("expected %q, got %q", data, string(bts))
+		}
+	}
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Fatalf("expected mode 0644, got %v", fi.Mode().Perm())
+	}
+
+	// no temporary file is left
+	names, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "package.json" {
+		t.Fatalf("unexpected files %q", names)
+	}
+
+	// missing directory fails without creating the file
+	if err = WriteFileAtomic(filepath.Join(dir, "missing", "a"), []byte("a"), 0644); err == nil {
+		t.Fatal("expected error on missing directory")
+	}
+}
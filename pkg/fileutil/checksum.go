@@ -0,0 +1,115 @@
+package fileutil
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SHA256 returns the hex-encoded SHA-256 checksum of the reader.
+func SHA256(r io.Reader) (string, error) {
+	return checksum(sha256.New(), r)
+}
+
+// SHA256File returns the hex-encoded SHA-256 checksum of the file.
+func SHA256File(fpath string) (string, error) {
+	return checksumFile(sha256.New(), fpath)
+}
+
+// MD5 returns the hex-encoded MD5 checksum of the reader.
+func MD5(r io.Reader) (string, error) {
+	return checksum(md5.New(), r)
+}
+
+// MD5File returns the hex-encoded MD5 checksum of the file.
+func MD5File(fpath string) (string, error) {
+	return checksumFile(md5.New(), fpath)
+}
+
+func checksum(h hash.Hash, r io.Reader) (string, error) {
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func checksumFile(h hash.Hash, fpath string) (string, error) {
+	f, err := openToRead(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return checksum(h, f)
+}
+
+// VerifyChecksum verifies the file against the hex-encoded checksum,
+// SHA-256 (64 digits) or MD5 (32 digits).
+func VerifyChecksum(fpath, sum string) error {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	var (
+		algo string
+		got  string
+		err  error
+	)
+	switch len(sum) {
+	case sha256.Size * 2:
+		algo = "sha256"
+		got, err = SHA256File(fpath)
+	case md5.Size * 2:
+		algo = "md5"
+		got, err = MD5File(fpath)
+	default:
+		return fmt.Errorf("unknown checksum %q of %q (expected SHA-256 or MD5 in hex)", sum, fpath)
+	}
+	if err != nil {
+		return err
+	}
+	if got != sum {
+		return fmt.Errorf("%q checksum mismatch (expected %s %s, got %s)", fpath, algo, sum, got)
+	}
+	return nil
+}
+
+// VerifyChecksumFile verifies the files listed in the checksum manifest,
+// in the format of 'sha256sum' or 'md5sum' ("<checksum>  <path>" per line).
+// Relative paths are relative to the directory of the manifest. Returns the
+// error of the first missing or mismatching file.
+func VerifyChecksumFile(manifest string) error {
+	f, err := openToRead(manifest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(manifest)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("%q:%d: invalid checksum line %q", manifest, n, line)
+		}
+		// "*" marks binary mode
+		fpath := strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		if !filepath.IsAbs(fpath) {
+			fpath = filepath.Join(dir, filepath.FromSlash(fpath))
+		}
+		if err = VerifyChecksum(fpath, fields[0]); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%q:%d: %q not found", manifest, n, fpath)
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,77 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const (
+		data      = "hello"
+		sha256Sum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		md5Sum    = "5d41402abc4b2a76b9719d911017c592"
+	)
+	if sum, err := SHA256(strings.NewReader(data)); err != nil || sum != sha256Sum {
+		t.Fatalf("unexpected SHA-256 %q (%v)", sum, err)
+	}
+	if sum, err := MD5(strings.NewReader(data)); err != nil || sum != md5Sum {
+		t.Fatalf("unexpected MD5 %q (%v)", sum, err)
+	}
+
+	if err = os.MkdirAll(filepath.Join(dir, "data"), PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(dir, "data", "cats.npy")
+	if err = ioutil.WriteFile(fpath, []byte(data), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := SHA256File(fpath); err != nil || sum != sha256Sum {
+		t.Fatalf("unexpected SHA-256 %q (%v)", sum, err)
+	}
+	if sum, err := MD5File(fpath); err != nil || sum != md5Sum {
+		t.Fatalf("unexpected MD5 %q (%v)", sum, err)
+	}
+	if err = VerifyChecksum(fpath, strings.ToUpper(sha256Sum)); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyChecksum(fpath, md5Sum); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyChecksum(fpath, strings.Repeat("0", 64)); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if err = VerifyChecksum(fpath, "abc"); err == nil {
+		t.Fatal("expected error on unknown checksum")
+	}
+
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	tests := []struct {
+		content string
+		ok      bool
+	}{
+		{sha256Sum + "  data/cats.npy\n", true},
+		{"# comment\n\n" + md5Sum + " *data/cats.npy\n", true},
+		{sha256Sum + "  " + fpath + "\n", true},
+		{strings.Repeat("0", 64) + "  data/cats.npy\n", false},
+		{sha256Sum + "  data/missing\n", false},
+		{"invalid\n", false},
+	}
+	for i, tt := range tests {
+		if err = ioutil.WriteFile(manifest, []byte(tt.content), PrivateFileMode); err != nil {
+			t.Fatal(err)
+		}
+		err = VerifyChecksumFile(manifest)
+		if (err == nil) != tt.ok {
+			t.Fatalf("#%d: expected ok %v, got error %v", i, tt.ok, err)
+		}
+	}
+}
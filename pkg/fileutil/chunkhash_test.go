@@ -0,0 +1,64 @@
+package fileutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkedSHA256(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 1000)
+	rand.Read(data)
+	for _, size := range []int{0, 1, 99, 100, 101, 1000} {
+		fpath := filepath.Join(dir, "data")
+		if err = ioutil.WriteFile(fpath, data[:size], PrivateFileMode); err != nil {
+			t.Fatal(err)
+		}
+		h := NewChunkedSHA256(100)
+		// uneven writes across the chunk boundaries
+		for p := data[:size]; len(p) > 0; {
+			n := 33
+			if len(p) < n {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		want := hex.EncodeToString(h.Sum(nil))
+		if want != hex.EncodeToString(h.Sum(nil)) {
+			t.Fatalf("size %d: Sum changed the state", size)
+		}
+		for _, workers := range []int{0, 1, 4, 20} {
+			got, err := ChunkedSHA256File(fpath, 100, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("size %d, %d workers: expected %s, got %s", size, workers, want, got)
+			}
+		}
+
+		// not the same as SHA-256 of the data
+		sum, err := SHA256(bytes.NewReader(data[:size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size > 0 && sum == want {
+			t.Fatalf("size %d: expected chunked checksum different from SHA-256", size)
+		}
+	}
+
+	if _, err = ChunkedSHA256File(filepath.Join(dir, "missing"), 0, 0); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package fileutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyFile copies the regular file, or recreates the symlink, preserving
+// the permissions. The destination file is overwritten if it exists.
+// Copying stops with the context error when the context is canceled.
+func CopyFile(ctx context.Context, src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	return copyEntry(ctx, src, dst, fi)
+}
+
+// CopyDir copies the directory tree, preserving the permissions and the
+// symlinks (not followed). The destination must not exist, and is removed
+// if the copy fails or the context is canceled.
+func CopyDir(ctx context.Context, src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", src)
+	}
+	if _, err = os.Lstat(dst); err == nil {
+		return fmt.Errorf("%q already exists", dst)
+	}
+	if err = copyTree(ctx, src, dst, fi); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return nil
+}
+
+func copyTree(ctx context.Context, src, dst string, fi os.FileInfo) error {
+	// writable until the entries are copied, for read-only directories
+	if err := os.Mkdir(dst, PrivateDirMode); err != nil {
+		return err
+	}
+	names, err := ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		sp, dp := filepath.Join(src, name), filepath.Join(dst, name)
+		cfi, err := os.Lstat(sp)
+		if err != nil {
+			return err
+		}
+		if cfi.IsDir() {
+			err = copyTree(ctx, sp, dp, cfi)
+		} else {
+			err = copyEntry(ctx, sp, dp, cfi)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// copyEntry copies the regular file or the symlink.
+func copyEntry(ctx context.Context, src, dst string, fi os.FileInfo) error {
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case !fi.Mode().IsRegular():
+		return fmt.Errorf("cannot copy %q (unsupported file mode %v)", src, fi.Mode())
+	}
+
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, PrivateFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(df, &ctxReader{ctx: ctx, r: sf}); err != nil {
+		df.Close()
+		return err
+	}
+	if err = df.Chmod(fi.Mode().Perm()); err != nil {
+		df.Close()
+		return err
+	}
+	if err = df.Sync(); err != nil {
+		df.Close()
+		return err
+	}
+	return df.Close()
+}
+
+// MoveAtomic moves the file or the directory to the destination, which
+// must not exist. It is renamed if on the same file system. Otherwise,
+// it is copied to a temporary path next to the destination and renamed
+// into place, before removing the source, so that the destination is
+// never seen partially copied.
+func MoveAtomic(ctx context.Context, src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%q already exists", dst)
+	}
+	err := os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err = os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = CopyDir(ctx, src, tmp)
+	} else if err = copyEntry(ctx, src, tmp, fi); err != nil {
+		os.Remove(tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err = syncDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// isCrossDevice returns true if the rename failed across file systems.
+func isCrossDevice(err error) bool {
+	le, ok := err.(*os.LinkError)
+	return ok && le.Err == syscall.EXDEV
+}
+
+// ctxReader stops reading when the context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
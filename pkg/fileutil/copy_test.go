@@ -0,0 +1,111 @@
+package fileutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "run.sh"), []byte("echo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("a"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join("sub", "a.txt"), filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// read-only directory must be copied with its contents
+	if err = os.Chmod(filepath.Join(src, "sub"), 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(src, "sub"), PrivateDirMode)
+
+	dst := filepath.Join(dir, "dst")
+	if err = CopyDir(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dst, "sub"), PrivateDirMode)
+
+	for fpath, mode := range map[string]os.FileMode{
+		"run.sh":    0755,
+		"sub":       os.ModeDir | 0500,
+		"sub/a.txt": 0640,
+	} {
+		fi, err := os.Stat(filepath.Join(dst, fpath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != mode {
+			t.Fatalf("%q mode expected %v, got %v", fpath, mode, fi.Mode())
+		}
+	}
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Join("sub", "a.txt") {
+		t.Fatalf("unexpected link target %q", target)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "link")); err != nil || string(b) != "a" {
+		t.Fatalf("unexpected link content %q (%v)", b, err)
+	}
+
+	if err = CopyDir(context.Background(), src, dst); err == nil {
+		t.Fatal("expected error on existing destination")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := filepath.Join(dir, "canceled")
+	if err = CopyDir(ctx, src, canceled); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if Exist(canceled) {
+		t.Fatalf("expected %q removed on cancel", canceled)
+	}
+}
+
+func TestMoveAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src.txt")
+	if err = ioutil.WriteFile(src, []byte("a"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst.txt")
+	if err = CopyFile(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if err = MoveAtomic(context.Background(), src, dst); err == nil {
+		t.Fatal("expected error on existing destination")
+	}
+
+	moved := filepath.Join(dir, "moved.txt")
+	if err = MoveAtomic(context.Background(), src, moved); err != nil {
+		t.Fatal(err)
+	}
+	if Exist(src) {
+		t.Fatalf("expected %q removed", src)
+	}
+	if b, err := ioutil.ReadFile(moved); err != nil || string(b) != "a" {
+		t.Fatalf("unexpected content %q (%v)", b, err)
+	}
+}
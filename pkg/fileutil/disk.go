@@ -0,0 +1,98 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// DirSize returns the total size of the regular files under the directory,
+// including hidden files.
+func DirSize(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// files may be removed while walking (e.g. etcd WAL)
+			if os.IsNotExist(err) && path != dir {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += uint64(fi.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
+// DiskStat is the disk space of the file system partition.
+type DiskStat struct {
+	// Total is the size of the partition.
+	Total uint64
+	// Free is the free space, including the space reserved for root.
+	Free uint64
+	// Available is the free space available to unprivileged users.
+	Available uint64
+}
+
+// UsedPercent returns the percentage of the used space.
+func (st DiskStat) UsedPercent() float64 {
+	if st.Total == 0 {
+		return 0
+	}
+	return float64(st.Total-st.Free) / float64(st.Total) * 100
+}
+
+var errDiskUsageUnsupported = fmt.Errorf("disk usage is not supported on %s", runtime.GOOS)
+
+// DiskUsage returns the disk space of the partition that contains the path.
+func DiskUsage(fpath string) (DiskStat, error) {
+	return diskUsage(fpath)
+}
+
+// NoSpaceError is returned by 'EnsureSpace' when the partition does not
+// have enough space available.
+type NoSpaceError struct {
+	Path      string
+	Need      uint64
+	Available uint64
+}
+
+func (e *NoSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space for %q (need %s, %s available); free up %s on its partition",
+		e.Path, humanize.Bytes(e.Need), humanize.Bytes(e.Available), humanize.Bytes(e.Need-e.Available))
+}
+
+// EnsureSpace returns '*NoSpaceError' if the partition that contains the
+// path has less than 'size' bytes available, so that large writes (e.g.
+// archive extraction) fail before starting, instead of with ENOSPC halfway.
+// The path does not need to exist yet. It returns nil if the disk usage is
+// not supported on the platform.
+func EnsureSpace(fpath string, size uint64) error {
+	dir := fpath
+	for {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	st, err := DiskUsage(dir)
+	if err != nil {
+		if err == errDiskUsageUnsupported {
+			return nil
+		}
+		return err
+	}
+	if st.Available < size {
+		return &NoSpaceError{Path: fpath, Need: size, Available: st.Available}
+	}
+	return nil
+}
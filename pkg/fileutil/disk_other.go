@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fileutil
+
+func diskUsage(fpath string) (DiskStat, error) {
+	return DiskStat{}, errDiskUsageUnsupported
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fileutil
+
+import "syscall"
+
+func diskUsage(fpath string) (DiskStat, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(fpath, &st); err != nil {
+		return DiskStat{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return DiskStat{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+	}, nil
+}
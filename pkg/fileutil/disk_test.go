@@ -0,0 +1,70 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirSize(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "member", "wal"), PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	for p, n := range map[string]int{
+		"a":                     10,
+		".hidden":               5,
+		"member/wal/0.wal":      100,
+		"member/wal/.tmp.empty": 0,
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, p), make([]byte, n), PrivateFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size, err := DirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 115 {
+		t.Fatalf("expected 115, got %d", size)
+	}
+
+	if _, err = DirSize(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error on missing directory")
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	st, err := DiskUsage(os.TempDir())
+	if err != nil {
+		t.Skip(err)
+	}
+	if st.Total == 0 || st.Available > st.Free || st.Free > st.Total {
+		t.Fatalf("unexpected disk stat %+v", st)
+	}
+	if p := st.UsedPercent(); p < 0 || p > 100 {
+		t.Fatalf("unexpected used percent %f", p)
+	}
+}
+
+func TestEnsureSpace(t *testing.T) {
+	st, err := DiskUsage(os.TempDir())
+	if err != nil {
+		t.Skip(err)
+	}
+	missing := filepath.Join(os.TempDir(), "fileutil-missing", "a", "b")
+	if err = EnsureSpace(missing, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = EnsureSpace(missing, st.Total+1)
+	if nerr, ok := err.(*NoSpaceError); !ok || nerr.Need != st.Total+1 {
+		t.Fatalf("expected *NoSpaceError, got %v", err)
+	}
+}
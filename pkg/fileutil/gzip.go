@@ -0,0 +1,87 @@
+package fileutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// gzipMagic is the header of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// NewGzipReader returns the reader that decompresses 'r' if it is
+// gzip-compressed (detected by the magic bytes), or reads 'r' as is.
+// Closing the reader does not close 'r'.
+func NewGzipReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return nopCloser{br}, nil
+	}
+	return gzip.NewReader(br)
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// OpenGzip opens the file to read, decompressing if gzip-compressed,
+// so that the compressed and plain files are read the same way.
+func OpenGzip(fpath string) (io.ReadCloser, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewGzipReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFileReader{ReadCloser: r, f: f}, nil
+}
+
+type gzipFileReader struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r *gzipFileReader) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// CreateGzip creates the file to write gzip-compressed data, truncating
+// the file if it exists. The data is flushed and synced on Close.
+func CreateGzip(fpath string, perm os.FileMode) (io.WriteCloser, error) {
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipFileWriter{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+type gzipFileWriter struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (w *gzipFileWriter) Close() error {
+	err := w.Writer.Close()
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
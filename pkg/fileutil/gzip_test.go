@@ -0,0 +1,59 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := strings.Repeat(`{"request_id":"/cats-request-a","line":"classifying"}`+"\n", 100)
+	gz := filepath.Join(dir, "logs.gz")
+	w, err := CreateGzip(gz, PrivateFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(gz); err != nil || fi.Size() >= int64(len(data)) {
+		t.Fatalf("expected compressed file, got %v (%v)", fi.Size(), err)
+	}
+
+	plain := filepath.Join(dir, "logs")
+	if err = ioutil.WriteFile(plain, []byte(data), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err = ioutil.WriteFile(empty, nil, PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for fpath, want := range map[string]string{gz: data, plain: data, empty: ""} {
+		r, err := OpenGzip(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Fatalf("%q: unexpected content %q", fpath, b)
+		}
+	}
+}
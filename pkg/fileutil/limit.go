@@ -0,0 +1,62 @@
+package fileutil
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ErrTooLarge is returned when the input exceeds the size limit
+// of 'LimitReader' or 'ReadFileMax'.
+var ErrTooLarge = errors.New("fileutil: input exceeds the size limit")
+
+// LimitReader returns the reader that reads at most 'max' bytes from 'r',
+// and returns 'ErrTooLarge' if 'r' has more. Unlike io.LimitReader, the
+// oversized input (e.g. user upload) is not silently truncated.
+func LimitReader(r io.Reader, max int64) io.Reader {
+	return &limitedReader{r: r, n: max}
+}
+
+type limitedReader struct {
+	r io.Reader
+	// n is the number of bytes remaining.
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// probe for more data beyond the limit
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// ReadFileMax reads the file, or returns 'ErrTooLarge' if the file
+// is larger than 'max' bytes, without reading it.
+func ReadFileMax(fpath string, max int64) ([]byte, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > max {
+		return nil, ErrTooLarge
+	}
+	// the file may grow while reading
+	return ioutil.ReadAll(LimitReader(f, max))
+}
@@ -0,0 +1,38 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimitReader(t *testing.T) {
+	b, err := ioutil.ReadAll(LimitReader(strings.NewReader("abcd"), 4))
+	if err != nil || string(b) != "abcd" {
+		t.Fatalf("expected %q, got %q (%v)", "abcd", b, err)
+	}
+	if _, err = ioutil.ReadAll(LimitReader(strings.NewReader("abcde"), 4)); err != ErrTooLarge {
+		t.Fatalf("expected %v, got %v", ErrTooLarge, err)
+	}
+}
+
+func TestReadFileMax(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "upload.jpg")
+	if err = ioutil.WriteFile(fpath, []byte("abcde"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ReadFileMax(fpath, 5); err != nil || string(b) != "abcde" {
+		t.Fatalf("expected %q, got %q (%v)", "abcde", b, err)
+	}
+	if _, err = ReadFileMax(fpath, 4); err != ErrTooLarge {
+		t.Fatalf("expected %v, got %v", ErrTooLarge, err)
+	}
+}
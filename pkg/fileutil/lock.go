@@ -0,0 +1,41 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by 'TryLock' when the file is locked by another process.
+var ErrLocked = errors.New("fileutil: file already locked")
+
+// LockedFile is the file locked by 'Lock' or 'TryLock'.
+type LockedFile struct {
+	*os.File
+}
+
+// TryLock acquires the exclusive advisory lock of the file, creating the
+// file if it does not exist, or returns 'ErrLocked' if another process
+// holds the lock. The lock is released on 'Unlock', or when the process
+// exits. Locks are advisory: only the processes that lock the same file
+// are excluded (e.g. two backend servers sharing the etcd data directory).
+func TryLock(fpath string) (*LockedFile, error) {
+	return tryLockFile(fpath)
+}
+
+// Lock acquires the exclusive advisory lock of the file, waiting until
+// the other process releases it (see 'TryLock').
+func Lock(fpath string) (*LockedFile, error) {
+	return lockFile(fpath)
+}
+
+// WithLock runs 'f' while holding the lock of the file (see 'Lock'),
+// so that the processes writing the same set of files do not interleave
+// (e.g. two generators running at once leave the outputs of one run).
+func WithLock(fpath string, f func() error) error {
+	l, err := Lock(fpath)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return f()
+}
@@ -0,0 +1,51 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+func tryLockFile(fpath string) (*LockedFile, error) {
+	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE, PrivateFileMode)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			err = ErrLocked
+		}
+		return nil, err
+	}
+	return &LockedFile{f}, nil
+}
+
+func lockFile(fpath string) (*LockedFile, error) {
+	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE, PrivateFileMode)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &LockedFile{f}, nil
+}
+
+// Unlock releases the lock, and closes the file.
+func (l *LockedFile) Unlock() error {
+	if err := syscall.Flock(int(l.Fd()), syscall.LOCK_UN); err != nil {
+		l.Close()
+		return err
+	}
+	return l.Close()
+}
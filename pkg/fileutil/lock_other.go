@@ -0,0 +1,46 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package fileutil
+
+import (
+	"os"
+	"time"
+)
+
+// Without flock, the lock is held by exclusively creating the file,
+// and released by removing it. Unlike flock, the lock is not released
+// when the process exits, so a stale lock file must be removed manually.
+
+// lockRetryInterval is the interval to retry the lock in 'Lock'.
+const lockRetryInterval = 100 * time.Millisecond
+
+func tryLockFile(fpath string) (*LockedFile, error) {
+	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_EXCL, PrivateFileMode)
+	if err != nil {
+		if os.IsExist(err) {
+			err = ErrLocked
+		}
+		return nil, err
+	}
+	return &LockedFile{f}, nil
+}
+
+func lockFile(fpath string) (*LockedFile, error) {
+	for {
+		l, err := tryLockFile(fpath)
+		if err != ErrLocked {
+			return l, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock, and closes the file.
+func (l *LockedFile) Unlock() error {
+	if err := l.Close(); err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	return os.Remove(l.Name())
+}
@@ -0,0 +1,103 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "etcd-data.lock")
+	l, err := TryLock(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = TryLock(fpath); err != ErrLocked {
+		t.Fatalf("expected %v, got %v", ErrLocked, err)
+	}
+
+	lockc := make(chan *LockedFile)
+	errc := make(chan error, 1)
+	go func() {
+		l2, err := Lock(fpath)
+		if err != nil {
+			errc <- err
+			return
+		}
+		lockc <- l2
+	}()
+	select {
+	case <-lockc:
+		t.Fatal("lock acquired while locked")
+	case err = <-errc:
+		t.Fatal(err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case l2 := <-lockc:
+		if err = l2.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	case err = <-errc:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after unlock")
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lockPath, fpath := filepath.Join(dir, ".gen.lock"), filepath.Join(dir, "out.txt")
+	errc := make(chan error, 10)
+	for i := 0; i < cap(errc); i++ {
+		go func() {
+			errc <- WithLock(lockPath, func() error {
+				// read-modify-write, which loses updates without the lock
+				b, err := ioutil.ReadFile(fpath)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				time.Sleep(10 * time.Millisecond)
+				return WriteFileAtomic(fpath, append(b, 'x'), 0644)
+			})
+		}()
+	}
+	for i := 0; i < cap(errc); i++ {
+		if err = <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != cap(errc) {
+		t.Fatalf("expected %d writes, got %q", cap(errc), b)
+	}
+
+	if err = WithLock(lockPath, func() error { return ErrLocked }); err != ErrLocked {
+		t.Fatalf("expected %v, got %v", ErrLocked, err)
+	}
+	l, err := TryLock(lockPath)
+	if err != nil {
+		t.Fatalf("lock not released (%v)", err)
+	}
+	l.Unlock()
+}
@@ -0,0 +1,68 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathEscapes is returned by 'SecureJoin' when the path escapes the root.
+var ErrPathEscapes = errors.New("fileutil: path escapes the root directory")
+
+// SecureJoin joins the user-supplied path (e.g. upload filename, or
+// dataset key) to the root directory, and returns 'ErrPathEscapes' if the
+// result is outside the root, either lexically (e.g. "../etc/passwd", or
+// absolute paths) or through the existing symlinks under the root. The
+// path is checked at the time of the call, so the root must not be
+// writable by untrusted processes.
+func SecureJoin(root, userPath string) (string, error) {
+	if userPath == "" || strings.ContainsRune(userPath, 0) {
+		return "", ErrPathEscapes
+	}
+	p := filepath.FromSlash(userPath)
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" || strings.HasPrefix(p, string(filepath.Separator)) {
+		return "", ErrPathEscapes
+	}
+	root = filepath.Clean(root)
+	joined := filepath.Join(root, p)
+	if !within(root, joined) {
+		return "", ErrPathEscapes
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// nothing to resolve under the missing root
+			return joined, nil
+		}
+		return "", err
+	}
+	// resolve the longest existing prefix, since the rest is created
+	// under it (e.g. the file to write)
+	existing := joined
+	for existing != root {
+		if _, err = os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		// e.g. dangling symlink, which may be written through
+		return "", ErrPathEscapes
+	}
+	if !within(realRoot, real) {
+		return "", ErrPathEscapes
+	}
+	return joined, nil
+}
+
+// within returns true if the cleaned path is the root or under the root.
+func within(root, fpath string) bool {
+	rel, err := filepath.Rel(root, fpath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
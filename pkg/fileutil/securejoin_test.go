@@ -0,0 +1,59 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecureJoin(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	if err = os.MkdirAll(filepath.Join(root, "sub"), PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(dir, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("sub", filepath.Join(root, "in")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join(dir, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		userPath string
+		want     string
+	}{
+		{"cat.jpg", filepath.Join(root, "cat.jpg")},
+		{"sub/../cat.jpg", filepath.Join(root, "cat.jpg")},
+		{"sub/new/cat.jpg", filepath.Join(root, "sub", "new", "cat.jpg")},
+		{"in/cat.jpg", filepath.Join(root, "in", "cat.jpg")},
+		{"", ""},
+		{"../cat.jpg", ""},
+		{"sub/../../cat.jpg", ""},
+		{"/etc/passwd", ""},
+		{"out/cat.jpg", ""},
+		{"out", ""},
+		{"dangling", ""},
+		{"cat.jpg\x00.png", ""},
+	} {
+		got, err := SecureJoin(root, tt.userPath)
+		if tt.want == "" {
+			if err != ErrPathEscapes {
+				t.Fatalf("%q: expected %v, got %q (%v)", tt.userPath, ErrPathEscapes, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("%q: expected %q, got %q (%v)", tt.userPath, tt.want, got, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package fileutil
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+)
+
+// Shred overwrites the file with random data, syncs, and removes it (e.g.
+// uploaded user images, or decrypted key material), for the deployments
+// with data-handling requirements. Symlinks and other non-regular files
+// are removed without overwriting their targets. Overwriting does not
+// guarantee that the data is unrecoverable on copy-on-write or journaling
+// file systems, or on SSDs with wear leveling.
+func Shred(fpath string) error {
+	fi, err := os.Lstat(fpath)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() && fi.Size() > 0 {
+		if err = overwrite(fpath, fi.Size()); err != nil {
+			return err
+		}
+	}
+	return os.Remove(fpath)
+}
+
+func overwrite(fpath string, size int64) error {
+	f, err := os.OpenFile(fpath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(f, rand.Reader, size); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,42 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShred(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "upload.jpg")
+	if err = ioutil.WriteFile(fpath, []byte("secret"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	// target of the symlink must not be overwritten
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(fpath, link); err != nil {
+		t.Fatal(err)
+	}
+	if err = Shred(link); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(fpath); err != nil || string(b) != "secret" {
+		t.Fatalf("expected symlink target kept, got %q (%v)", b, err)
+	}
+
+	if err = Shred(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if Exist(fpath) {
+		t.Fatalf("expected %q removed", fpath)
+	}
+	if err = Shred(fpath); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package fileutil
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// tailPollInterval is the interval to poll the tailed file for appends.
+	tailPollInterval = 250 * time.Millisecond
+	// tailMaxLineSize is the maximum size of a line, longer lines are split.
+	tailMaxLineSize = 1024 * 1024
+)
+
+// Tail follows the appends to the file from its current end (e.g. 'tail -F'),
+// and returns the channel of the non-empty lines without the newlines. If
+// the file does not exist yet, it is read from the beginning once created.
+// The file is reopened when rotated (renamed or removed, and then recreated),
+// after reading the rest of the previous file, and read again from the
+// beginning when truncated. The channel is closed when the context is canceled.
+func Tail(ctx context.Context, fpath string) (<-chan string, error) {
+	f, err := os.Open(fpath)
+	switch {
+	case err == nil:
+		if _, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		f = nil
+	default:
+		return nil, err
+	}
+
+	t := &tailer{
+		ctx:   ctx,
+		fpath: fpath,
+		f:     f,
+		linec: make(chan string),
+		buf:   make([]byte, 32*1024),
+	}
+	go t.run()
+	return t.linec, nil
+}
+
+type tailer struct {
+	ctx   context.Context
+	fpath string
+	// f is the file being read, nil until the file is created.
+	f     *os.File
+	linec chan string
+
+	buf []byte
+	// partial is the last line not terminated by newline yet.
+	partial []byte
+}
+
+func (t *tailer) run() {
+	defer close(t.linec)
+	defer func() {
+		if t.f != nil {
+			t.f.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		if t.f != nil && !t.read() {
+			return
+		}
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(t.fpath)
+		if err != nil {
+			// removed, keep reading the previous file until recreated
+			continue
+		}
+		if t.f != nil {
+			cur, err := t.f.Stat()
+			if err == nil && os.SameFile(fi, cur) {
+				if off, err := t.f.Seek(0, io.SeekCurrent); err == nil && fi.Size() < off {
+					// truncated
+					t.f.Seek(0, io.SeekStart)
+					t.partial = t.partial[:0]
+				}
+				continue
+			}
+			// rotated
+			if !t.read() || !t.flush() {
+				return
+			}
+			t.f.Close()
+			t.f = nil
+		}
+		if t.f, err = os.Open(t.fpath); err != nil {
+			t.f = nil
+		}
+	}
+}
+
+// read sends the lines read until EOF, and returns false on cancel.
+func (t *tailer) read() bool {
+	for {
+		n, err := t.f.Read(t.buf)
+		data := t.buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				t.partial = append(t.partial, data...)
+				if len(t.partial) >= tailMaxLineSize && !t.flush() {
+					return false
+				}
+				break
+			}
+			t.partial = append(t.partial, data[:i]...)
+			data = data[i+1:]
+			if !t.flush() {
+				return false
+			}
+		}
+		if err != nil {
+			// io.EOF, or retried on the next poll
+			return true
+		}
+	}
+}
+
+// flush sends the pending line if any, and returns false on cancel.
+func (t *tailer) flush() bool {
+	if len(t.partial) == 0 {
+		return true
+	}
+	line := string(bytes.TrimSuffix(t.partial, []byte("\r")))
+	t.partial = t.partial[:0]
+	select {
+	case t.linec <- line:
+		return true
+	case <-t.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package fileutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "worker.log")
+	if err = ioutil.WriteFile(fpath, []byte("old\n"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	linec, err := Tail(ctx, fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile := func(data string) {
+		f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, PrivateFileMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err = f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(lines ...string) {
+		for _, want := range lines {
+			select {
+			case line := <-linec:
+				if line != want {
+					t.Fatalf("line expected %q, got %q", want, line)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	// partial line is sent once terminated
+	appendFile("a\nb")
+	expect("a")
+	appendFile("c\r\n\n")
+	expect("bc")
+
+	// rest of the rotated file is read before the new file
+	appendFile("d\ne")
+	expect("d")
+	if err = os.Rename(fpath, fpath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile("f\n")
+	expect("e", "f")
+
+	// truncated file is read again from the beginning
+	time.Sleep(2 * tailPollInterval)
+	if err = os.Truncate(fpath, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * tailPollInterval)
+	appendFile("g\n")
+	expect("g")
+
+	cancel()
+	for range linec {
+	}
+}
+
+func TestTailNotExist(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "worker.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	linec, err := Tail(ctx, fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fpath, []byte("a\n"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-linec:
+		if line != "a" {
+			t.Fatalf("line expected %q, got %q", "a", line)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+}
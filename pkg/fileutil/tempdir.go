@@ -0,0 +1,105 @@
+package fileutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// tempLockSuffix is the suffix of the lock file next to the temporary
+// directory, held while the directory is in use.
+const tempLockSuffix = ".lock"
+
+// TempScope creates a new temporary directory with the prefix in the
+// default directory for temporary files (see 'TempScopeIn').
+func TempScope(prefix string) (string, func(), error) {
+	return TempScopeIn("", prefix)
+}
+
+// TempScopeIn creates a new temporary directory with the prefix in the
+// directory (os.TempDir() if empty), and returns the cleanup function
+// that removes it. The directory is locked until cleaned up, so that
+// 'CleanTempOrphans' only removes the directories of the processes that
+// exited without cleanup (e.g. crashed while unpacking the archive).
+func TempScopeIn(dir, prefix string) (string, func(), error) {
+	tmp, err := ioutil.TempDir(dir, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	l, err := TryLock(tmp + tempLockSuffix)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			glog.Warningf("failed to remove %q (%v)", tmp, err)
+		}
+		l.Unlock()
+		os.Remove(tmp + tempLockSuffix)
+	}
+	return tmp, cleanup, nil
+}
+
+// CleanTempOrphans removes the temporary directories with the prefix in
+// the directory (os.TempDir() if empty), that are not locked by
+// 'TempScopeIn' and not modified for 'minAge'. It returns the number of
+// the removed directories.
+func CleanTempOrphans(dir, prefix string, minAge time.Duration) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	names, err := ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, tempLockSuffix) {
+			continue
+		}
+		fpath := filepath.Join(dir, name)
+		fi, err := os.Lstat(fpath)
+		if err != nil || !fi.IsDir() || time.Since(fi.ModTime()) < minAge {
+			continue
+		}
+		l, err := TryLock(fpath + tempLockSuffix)
+		if err != nil {
+			// in use, or not writable
+			continue
+		}
+		err = os.RemoveAll(fpath)
+		l.Unlock()
+		os.Remove(fpath + tempLockSuffix)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunTempCleaner calls 'CleanTempOrphans' every interval, until the
+// context is canceled.
+func RunTempCleaner(ctx context.Context, dir, prefix string, minAge, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := CleanTempOrphans(dir, prefix, minAge)
+		if err != nil {
+			glog.Warningf("failed to clean temporary directories %q in %q (%v)", prefix, dir, err)
+		} else if n > 0 {
+			glog.Infof("removed %d orphaned temporary directories %q in %q", n, prefix, dir)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempScope(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inUse, cleanup, err := TempScopeIn(dir, "unpack-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err = ioutil.WriteFile(filepath.Join(inUse, "a"), []byte("a"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	done, cleanupDone, err := TempScopeIn(dir, "unpack-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanupDone()
+	if Exist(done) || Exist(done+tempLockSuffix) {
+		t.Fatalf("expected %q removed on cleanup", done)
+	}
+
+	// left by the crashed process, without the lock held
+	orphan := filepath.Join(dir, "unpack-orphan")
+	if err = os.MkdirAll(filepath.Join(orphan, "sub"), PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other")
+	if err = os.MkdirAll(other, PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := CleanTempOrphans(dir, "unpack-", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 removed, got %d", n)
+	}
+	if Exist(orphan) {
+		t.Fatalf("expected %q removed", orphan)
+	}
+	if !Exist(filepath.Join(inUse, "a")) || !Exist(other) {
+		t.Fatal("expected directories in use and without prefix kept")
+	}
+}
@@ -0,0 +1,142 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchDebounce is the default duration that the changes must
+// settle for, before the watcher reports them.
+const DefaultWatchDebounce = 100 * time.Millisecond
+
+// Watcher watches files and directories for changes (e.g. to reload the
+// configuration, or to regenerate the files from the templates). Changes
+// are debounced, so that a burst of writes (e.g. editor saving the file
+// with a rename) is reported once.
+type Watcher struct {
+	debounce time.Duration
+	backend  watchBackend
+
+	// rawc receives the changed paths from the backend.
+	rawc   chan string
+	eventc chan []string
+	errc   chan error
+
+	closeOnce sync.Once
+	donec     chan struct{}
+}
+
+// watchBackend watches the paths, sending the changed paths to 'rawc'.
+type watchBackend interface {
+	// add watches the directory tree (recursive), or the file.
+	add(fpath string, dir bool) error
+	close() error
+}
+
+// NewWatcher returns the watcher that reports the changes once they
+// settle for the debounce duration (zero for 'DefaultWatchDebounce').
+func NewWatcher(debounce time.Duration) (*Watcher, error) {
+	if debounce == 0 {
+		debounce = DefaultWatchDebounce
+	}
+	w := &Watcher{
+		debounce: debounce,
+		rawc:     make(chan string, 1024),
+		eventc:   make(chan []string),
+		errc:     make(chan error, 1),
+		donec:    make(chan struct{}),
+	}
+	var err error
+	if w.backend, err = newWatchBackend(w); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add watches the file, or the directory and all its subdirectories,
+// including the ones created later. Files are watched by the name, so
+// that the changes are reported when the file is replaced (e.g. with
+// 'WriteFileAtomic'), or created after being removed.
+func (w *Watcher) Add(fpath string) error {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(fpath)
+	if err != nil {
+		return err
+	}
+	return w.backend.add(abs, fi.IsDir())
+}
+
+// Events returns the channel of the changed paths (absolute, sorted),
+// which is closed when the watcher is closed.
+func (w *Watcher) Events() <-chan []string { return w.eventc }
+
+// Errors returns the channel of the watch errors (e.g. events dropped
+// on overflow, so the watched files must be reloaded).
+func (w *Watcher) Errors() <-chan error { return w.errc }
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.donec)
+		err = w.backend.close()
+	})
+	return err
+}
+
+// changed is called by the backend with the changed path.
+func (w *Watcher) changed(fpath string) {
+	select {
+	case w.rawc <- fpath:
+	case <-w.donec:
+	}
+}
+
+// fail is called by the backend with the error, dropped if the
+// previous error has not been received.
+func (w *Watcher) fail(err error) {
+	select {
+	case w.errc <- err:
+	default:
+	}
+}
+
+// run reports the changed paths once no change is made for the debounce duration.
+func (w *Watcher) run() {
+	defer close(w.eventc)
+
+	pending := make(map[string]struct{})
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-w.donec:
+			return
+		case p := <-w.rawc:
+			pending[p] = struct{}{}
+			settled = time.After(w.debounce)
+			continue
+		case <-settled:
+		}
+
+		paths := make([]string, 0, len(pending))
+		for p := range pending {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		pending = make(map[string]struct{})
+		settled = nil
+
+		select {
+		case w.eventc <- paths:
+		case <-w.donec:
+			return
+		}
+	}
+}
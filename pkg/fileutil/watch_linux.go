@@ -0,0 +1,170 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotify watches the directories with inotify(7). Files are watched
+// through their parent directories, to survive renames over the file.
+type inotify struct {
+	w  *Watcher
+	fd int
+	// f is the non-blocking inotify file, so that reads are
+	// interrupted on close.
+	f *os.File
+
+	mu sync.Mutex
+	// dirs maps the watch descriptors to the directories.
+	dirs map[int]*watchDir
+	wds  map[string]int
+}
+
+type watchDir struct {
+	path string
+	// recursive is true to report all entries, and to watch the subdirectories.
+	recursive bool
+	// names are the watched files in the directory, if not recursive.
+	names map[string]bool
+}
+
+func newWatchBackend(w *Watcher) (watchBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	in := &inotify{
+		w:    w,
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int]*watchDir),
+		wds:  make(map[string]int),
+	}
+	go in.read()
+	return in, nil
+}
+
+func (in *inotify) add(fpath string, dir bool) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if !dir {
+		return in.addDir(filepath.Dir(fpath), false, filepath.Base(fpath))
+	}
+	return in.addTree(fpath)
+}
+
+// addTree watches the directory and its subdirectories, with 'mu' held.
+func (in *inotify) addTree(root string) error {
+	return filepath.Walk(root, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// removed while walking
+			if os.IsNotExist(err) && fpath != root {
+				return nil
+			}
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		return in.addDir(fpath, true, "")
+	})
+}
+
+// addDir watches the directory, with 'mu' held.
+func (in *inotify) addDir(dir string, recursive bool, name string) error {
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("failed to watch %q (%v)", dir, err)
+	}
+	d, ok := in.dirs[wd]
+	if !ok {
+		d = &watchDir{path: dir, names: make(map[string]bool)}
+		in.dirs[wd] = d
+		in.wds[dir] = wd
+	}
+	if recursive {
+		d.recursive = true
+	}
+	if name != "" {
+		d.names[name] = true
+	}
+	return nil
+}
+
+func (in *inotify) close() error {
+	return in.f.Close()
+}
+
+func (in *inotify) read() {
+	var buf [(syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1) * 64]byte
+	for {
+		n, err := in.f.Read(buf[:])
+		if err != nil {
+			select {
+			case <-in.w.donec:
+			default:
+				in.w.fail(err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := ""
+			if ev.Len > 0 {
+				start := off + syscall.SizeofInotifyEvent
+				name = strings.TrimRight(string(buf[start:start+int(ev.Len)]), "\x00")
+			}
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				in.w.fail(fmt.Errorf("inotify queue overflow (events dropped)"))
+				continue
+			}
+			if fpath, ok := in.handle(int(ev.Wd), ev.Mask, name); ok {
+				in.w.changed(fpath)
+			}
+		}
+	}
+}
+
+// handle returns the changed path of the event, and true if watched.
+func (in *inotify) handle(wd int, mask uint32, name string) (string, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	d, ok := in.dirs[wd]
+	if !ok {
+		return "", false
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// directory removed, or unwatched
+		delete(in.dirs, wd)
+		if in.wds[d.path] == wd {
+			delete(in.wds, d.path)
+		}
+		return "", false
+	}
+	if name == "" {
+		// events of the directory itself
+		return d.path, d.recursive
+	}
+	if !d.recursive && !d.names[name] {
+		return "", false
+	}
+	fpath := filepath.Join(d.path, name)
+	if d.recursive && mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := in.addTree(fpath); err != nil {
+			in.w.fail(err)
+		}
+	}
+	return fpath, true
+}
@@ -0,0 +1,105 @@
+//go:build !linux
+// +build !linux
+
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// watchPollInterval is the interval to poll the watched paths.
+const watchPollInterval = 500 * time.Millisecond
+
+// poller watches the paths by comparing the modification times and sizes
+// every interval, on the platforms without inotify.
+type poller struct {
+	w *Watcher
+
+	mu    sync.Mutex
+	roots map[string]bool
+	// stats are the last modification times and sizes of the watched paths.
+	stats map[string]fileStat
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+func newWatchBackend(w *Watcher) (watchBackend, error) {
+	p := &poller{w: w, roots: make(map[string]bool), stats: make(map[string]fileStat)}
+	go p.run()
+	return p, nil
+}
+
+func (p *poller) add(fpath string, dir bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.roots[fpath] = dir
+	for k, v := range p.scan(fpath, dir) {
+		p.stats[k] = v
+	}
+	return nil
+}
+
+// scan returns the stats of the file, or of the directory tree.
+func (p *poller) scan(root string, dir bool) map[string]fileStat {
+	stats := make(map[string]fileStat)
+	if !dir {
+		if fi, err := os.Stat(root); err == nil {
+			stats[root] = fileStat{fi.ModTime(), fi.Size()}
+		}
+		return stats
+	}
+	filepath.Walk(root, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		stats[fpath] = fileStat{fi.ModTime(), fi.Size()}
+		return nil
+	})
+	return stats
+}
+
+func (p *poller) close() error { return nil }
+
+func (p *poller) run() {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.w.donec:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		cur := make(map[string]fileStat)
+		for root, dir := range p.roots {
+			for k, v := range p.scan(root, dir) {
+				cur[k] = v
+			}
+		}
+		var changed []string
+		for k, v := range cur {
+			if prev, ok := p.stats[k]; !ok || prev != v {
+				changed = append(changed, k)
+			}
+		}
+		for k := range p.stats {
+			if _, ok := cur[k]; !ok {
+				changed = append(changed, k)
+			}
+		}
+		p.stats = cur
+		p.mu.Unlock()
+
+		for _, k := range changed {
+			p.w.changed(k)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// resolve symlinks (e.g. /tmp on macOS), to compare the reported paths
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tmplDir := filepath.Join(dir, "templates")
+	if err = os.MkdirAll(tmplDir, PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	cfg := filepath.Join(dir, "config.yaml")
+	if err = ioutil.WriteFile(cfg, []byte("a: 1"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.yaml")
+
+	w, err := NewWatcher(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.Add(tmplDir); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Add(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Add(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error on missing path")
+	}
+
+	// wait returns once all the paths are reported, failing on unwatched paths
+	wait := func(paths ...string) {
+		want := make(map[string]bool)
+		for _, p := range paths {
+			want[p] = true
+		}
+		timeout := time.After(10 * time.Second)
+		for len(want) > 0 {
+			select {
+			case ps := <-w.Events():
+				for _, p := range ps {
+					if p == other {
+						t.Fatalf("unexpected change of unwatched %q", p)
+					}
+					delete(want, p)
+				}
+			case err := <-w.Errors():
+				t.Fatal(err)
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v", want)
+			}
+		}
+	}
+
+	// replaced by rename, and unwatched file in the same directory
+	if err = ioutil.WriteFile(other, []byte("b"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteFileAtomic(cfg, []byte("a: 2"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	wait(cfg)
+
+	// files in the new subdirectory
+	sub := filepath.Join(tmplDir, "app")
+	if err = os.MkdirAll(sub, PrivateDirMode); err != nil {
+		t.Fatal(err)
+	}
+	wait(sub)
+	tmpl := filepath.Join(sub, "package.json.tmpl")
+	if err = ioutil.WriteFile(tmpl, []byte("{}"), PrivateFileMode); err != nil {
+		t.Fatal(err)
+	}
+	wait(tmpl)
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range w.Events() {
+	}
+}
@@ -0,0 +1,183 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// Accelerator is the accelerator type available in a zone.
+type Accelerator struct {
+	Zone string
+	// Type is the accelerator type (e.g. "nvidia-tesla-k80").
+	Type string
+	// MaxPerInstance is the maximum number of cards per instance.
+	MaxPerInstance int64
+}
+
+// GPUQuota is the GPU quota of a region (e.g. "NVIDIA_K80_GPUS").
+type GPUQuota struct {
+	Region string
+	Metric string
+	Limit  float64
+	Usage  float64
+}
+
+// Available returns the number of GPUs left in the quota.
+func (q GPUQuota) Available() int64 {
+	if q.Usage >= q.Limit {
+		return 0
+	}
+	return int64(q.Limit - q.Usage)
+}
+
+// ListAccelerators lists the accelerator types available in all zones,
+// sorted by zone and type.
+func (c *Compute) ListAccelerators(ctx context.Context) ([]Accelerator, error) {
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return nil, err
+	}
+	var accs []Accelerator
+	err = csrv.AcceleratorTypes.
+		AggregatedList(c.projectID).
+		Pages(ctx, func(l *compute.AcceleratorTypeAggregatedList) error {
+			for _, sl := range l.Items {
+				for _, at := range sl.AcceleratorTypes {
+					if at.Deprecated != nil && at.Deprecated.State != "" {
+						continue
+					}
+					accs = append(accs, Accelerator{
+						// e.g. "https://www.googleapis.com/compute/v1/projects/dplearn/zones/us-west1-b"
+						Zone:           path.Base(at.Zone),
+						Type:           at.Name,
+						MaxPerInstance: at.MaximumCardsPerInstance,
+					})
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(accs, func(i, j int) bool {
+		if accs[i].Zone != accs[j].Zone {
+			return accs[i].Zone < accs[j].Zone
+		}
+		return accs[i].Type < accs[j].Type
+	})
+	return accs, nil
+}
+
+// GPUQuotas returns the GPU quotas of the region, including
+// the quotas of preemptible GPUs.
+func (c *Compute) GPUQuotas(ctx context.Context, region string) ([]GPUQuota, error) {
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return nil, err
+	}
+	r, err := csrv.Regions.Get(c.projectID, region).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	var qs []GPUQuota
+	for _, q := range r.Quotas {
+		if strings.HasSuffix(q.Metric, "_GPUS") {
+			qs = append(qs, GPUQuota{Region: region, Metric: q.Metric, Limit: q.Limit, Usage: q.Usage})
+		}
+	}
+	sort.Slice(qs, func(i, j int) bool { return qs[i].Metric < qs[j].Metric })
+	return qs, nil
+}
+
+// FindGPUZone returns the zone that has the GPU type with enough cards per
+// instance and enough regional quota left for the count, so that instances
+// are not created in zones that fail at creation. Candidates are zones or
+// regions (e.g. "us-west1-b", "us-east1"), in the order of preference.
+// Empty candidates match all zones.
+func (c *Compute) FindGPUZone(ctx context.Context, gpuType string, count int, preemptible bool, candidates ...string) (string, error) {
+	accs, err := c.ListAccelerators(ctx)
+	if err != nil {
+		return "", err
+	}
+	quotas := make(map[string][]GPUQuota)
+	for _, zone := range gpuZones(accs, gpuType, count, candidates) {
+		region := zoneRegion(zone)
+		if _, ok := quotas[region]; !ok {
+			if quotas[region], err = c.GPUQuotas(ctx, region); err != nil {
+				return "", err
+			}
+		}
+	}
+	return pickGPUZone(accs, quotas, gpuType, count, preemptible, candidates)
+}
+
+// pickGPUZone returns the first zone of 'gpuZones' whose regional
+// quota has the count of the GPU type left.
+func pickGPUZone(accs []Accelerator, quotas map[string][]GPUQuota, gpuType string, count int, preemptible bool, candidates []string) (string, error) {
+	metric := gpuQuotaMetric(gpuType, preemptible)
+	zones := gpuZones(accs, gpuType, count, candidates)
+	for _, zone := range zones {
+		for _, q := range quotas[zoneRegion(zone)] {
+			if q.Metric == metric && q.Available() >= int64(count) {
+				return zone, nil
+			}
+		}
+		glog.Infof("skipping %q (not enough %q quota for %d GPU(s))", zone, metric, count)
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("no zone in %q has %d %q GPU(s) per instance", candidates, count, gpuType)
+	}
+	return "", fmt.Errorf("no zone in %q has %q quota for %d GPU(s)", zones, metric, count)
+}
+
+// gpuZones returns the zones that have the GPU type with the count of cards
+// per instance, in the order of the candidates, or sorted if empty.
+func gpuZones(accs []Accelerator, gpuType string, count int, candidates []string) []string {
+	var zones []string
+	if len(candidates) == 0 {
+		candidates = []string{""}
+	}
+	seen := make(map[string]bool)
+	for _, cand := range candidates {
+		for _, a := range accs {
+			if a.Type != gpuType || a.MaxPerInstance < int64(count) || seen[a.Zone] {
+				continue
+			}
+			if cand == "" || a.Zone == cand || zoneRegion(a.Zone) == cand {
+				seen[a.Zone] = true
+				zones = append(zones, a.Zone)
+			}
+		}
+	}
+	return zones
+}
+
+// zoneRegion returns the region of the zone (e.g. "us-west1" of "us-west1-b").
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// IsRegion returns true if the name is a region, not a zone
+// (e.g. "us-west1", not "us-west1-b").
+func IsRegion(name string) bool {
+	return strings.Count(name, "-") == 1
+}
+
+// gpuQuotaMetric returns the quota metric of the GPU type
+// (e.g. "NVIDIA_K80_GPUS" of "nvidia-tesla-k80").
+func gpuQuotaMetric(gpuType string, preemptible bool) string {
+	m := strings.ToUpper(strings.Replace(strings.Replace(gpuType, "tesla-", "", 1), "-", "_", -1)) + "_GPUS"
+	if preemptible {
+		m = "PREEMPTIBLE_" + m
+	}
+	return m
+}
@@ -0,0 +1,65 @@
+package gcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGPUQuotaMetric(t *testing.T) {
+	tests := []struct {
+		gpuType     string
+		preemptible bool
+		metric      string
+	}{
+		{"nvidia-tesla-k80", false, "NVIDIA_K80_GPUS"},
+		{"nvidia-tesla-v100", true, "PREEMPTIBLE_NVIDIA_V100_GPUS"},
+		{"nvidia-tesla-p4-vws", false, "NVIDIA_P4_VWS_GPUS"},
+	}
+	for i, tt := range tests {
+		if m := gpuQuotaMetric(tt.gpuType, tt.preemptible); m != tt.metric {
+			t.Fatalf("#%d: expected %q, got %q", i, tt.metric, m)
+		}
+	}
+}
+
+func TestPickGPUZone(t *testing.T) {
+	accs := []Accelerator{
+		{Zone: "asia-east1-a", Type: "nvidia-tesla-k80", MaxPerInstance: 8},
+		{Zone: "us-east1-c", Type: "nvidia-tesla-k80", MaxPerInstance: 8},
+		{Zone: "us-west1-a", Type: "nvidia-tesla-v100", MaxPerInstance: 8},
+		{Zone: "us-west1-b", Type: "nvidia-tesla-k80", MaxPerInstance: 2},
+	}
+	quotas := map[string][]GPUQuota{
+		"asia-east1": {{Metric: "NVIDIA_K80_GPUS", Limit: 8, Usage: 0}},
+		"us-east1":   {{Metric: "NVIDIA_K80_GPUS", Limit: 4, Usage: 3}, {Metric: "PREEMPTIBLE_NVIDIA_K80_GPUS", Limit: 8}},
+		"us-west1":   {{Metric: "NVIDIA_K80_GPUS", Limit: 8, Usage: 0}},
+	}
+
+	if zs := gpuZones(accs, "nvidia-tesla-k80", 1, []string{"us-west1", "us-east1-c"}); !reflect.DeepEqual(zs, []string{"us-west1-b", "us-east1-c"}) {
+		t.Fatalf("unexpected zones %q", zs)
+	}
+
+	tests := []struct {
+		count       int
+		preemptible bool
+		candidates  []string
+		zone        string
+		err         bool
+	}{
+		{1, false, nil, "asia-east1-a", false},
+		{1, false, []string{"us-west1", "us-east1"}, "us-west1-b", false},
+		// not enough cards per instance in us-west1-b, not enough quota in us-east1
+		{4, false, []string{"us-west1", "us-east1"}, "", true},
+		{4, true, []string{"us-west1", "us-east1"}, "us-east1-c", false},
+		{1, false, []string{"europe-west1"}, "", true},
+	}
+	for i, tt := range tests {
+		zone, err := pickGPUZone(accs, quotas, "nvidia-tesla-k80", tt.count, tt.preemptible, tt.candidates)
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+		if zone != tt.zone {
+			t.Fatalf("#%d: expected %q, got %q", i, tt.zone, zone)
+		}
+	}
+}
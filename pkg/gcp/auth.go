@@ -0,0 +1,132 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultServiceAccount is the alias of the default service account
+// of the instance.
+const DefaultServiceAccount = "default"
+
+// NewTokenSource returns the OAuth2 token source of the scopes, which
+// refreshes the access tokens before they expire. The tokens are signed
+// with the service account JSON key if not empty, or fetched from the
+// metadata server for the default service account of the instance.
+func NewTokenSource(ctx context.Context, key []byte, scopes ...string) (oauth2.TokenSource, error) {
+	if len(key) > 0 {
+		jwt, err := google.JWTConfigFromJSON(key, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.TokenSource(ctx), nil
+	}
+	return NewMetadataClient("").TokenSource(DefaultServiceAccount, scopes...), nil
+}
+
+// credentials returns the project ID and the token source of the scopes,
+// from the service account JSON key if not empty, or from the metadata
+// server otherwise.
+func credentials(ctx context.Context, key []byte, scopes ...string) (string, oauth2.TokenSource, error) {
+	if len(key) > 0 {
+		// key must be JSON-format as {"project_id":...}
+		credMap := make(map[string]string)
+		if err := json.Unmarshal(key, &credMap); err != nil {
+			return "", nil, fmt.Errorf("key has wrong format (%v)", err)
+		}
+		project, ok := credMap["project_id"]
+		if !ok {
+			return "", nil, fmt.Errorf("key has no project_id")
+		}
+		ts, err := NewTokenSource(ctx, key, scopes...)
+		return project, ts, err
+	}
+	c := NewMetadataClient("")
+	project, err := c.ProjectID(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("no key, and failed to fetch project ID from metadata server (%v)", err)
+	}
+	return project, c.TokenSource(DefaultServiceAccount, scopes...), nil
+}
+
+// TokenSource returns the token source of the service account of the
+// instance (e.g. 'DefaultServiceAccount'), whose tokens are fetched from
+// the metadata server and reused until they expire. Empty scopes default
+// to the scopes of the instance.
+func (c *MetadataClient) TokenSource(account string, scopes ...string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &metadataTokenSource{c: c, account: account, scopes: scopes})
+}
+
+type metadataTokenSource struct {
+	c       *MetadataClient
+	account string
+	scopes  []string
+}
+
+func (ts *metadataTokenSource) Token() (*oauth2.Token, error) {
+	key := "instance/service-accounts/" + ts.account + "/token"
+	if len(ts.scopes) > 0 {
+		key += "?" + url.Values{"scopes": {strings.Join(ts.scopes, ",")}}.Encode()
+	}
+	v, err := ts.c.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err = json.Unmarshal([]byte(v), &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("metadata server returned empty token for %q", ts.account)
+	}
+	return &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+		Expiry:      time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// CheckScopes returns an error if the service account of the instance
+// is not granted the scopes (e.g. 'storage.ScopeReadWrite'), to fail
+// fast on startup instead of on the first API call.
+func (c *MetadataClient) CheckScopes(ctx context.Context, account string, scopes ...string) error {
+	sas, err := c.ServiceAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sa := range sas {
+		if sa.Alias != account && sa.Email != account {
+			continue
+		}
+		granted := make(map[string]bool, len(sa.Scopes))
+		for _, s := range sa.Scopes {
+			granted[s] = true
+		}
+		// cloud-platform scope grants all the other scopes
+		if granted["https://www.googleapis.com/auth/cloud-platform"] {
+			return nil
+		}
+		var missing []string
+		for _, s := range scopes {
+			if !granted[s] {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("service account %q is not granted scopes %q", sa.Email, missing)
+		}
+		return nil
+	}
+	return fmt.Errorf("instance has no service account %q", account)
+}
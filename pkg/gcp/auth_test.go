@@ -0,0 +1,69 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetadataTokenSource(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch req.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			atomic.AddInt32(&requests, 1)
+			if scopes := req.URL.Query().Get("scopes"); scopes != "a,b" {
+				t.Errorf("unexpected scopes %q", scopes)
+			}
+			w.Write([]byte(`{"access_token": "token-1", "expires_in": 3599, "token_type": "Bearer"}`))
+		case "/computeMetadata/v1/instance/service-accounts/":
+			w.Write([]byte(`{"default": {"email": "sa@test.iam.gserviceaccount.com", "scopes": ["a", "b"]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL + "/computeMetadata/v1")
+	src := c.TokenSource(DefaultServiceAccount, "a", "b")
+	for i := 0; i < 3; i++ {
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.AccessToken != "token-1" || tok.Type() != "Bearer" || tok.Expiry.Before(time.Now().Add(time.Hour-time.Minute)) {
+			t.Fatalf("unexpected token %+v", tok)
+		}
+	}
+	// reused until expiry
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+	if _, err := c.TokenSource("missing").Token(); err == nil {
+		t.Fatal("expected error on missing service account")
+	}
+
+	ctx := context.Background()
+	if err := c.CheckScopes(ctx, DefaultServiceAccount, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckScopes(ctx, "sa@test.iam.gserviceaccount.com", "a", "c"); err == nil {
+		t.Fatal("expected error on missing scope")
+	}
+	if err := c.CheckScopes(ctx, "missing", "a"); err == nil {
+		t.Fatal("expected error on missing service account")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	if _, _, err := credentials(context.Background(), []byte(`{"type": "service_account"}`), "a"); err == nil {
+		t.Fatal("expected error on key without project_id")
+	}
+	if _, _, err := credentials(context.Background(), []byte(`{`), "a"); err == nil {
+		t.Fatal("expected error on invalid key")
+	}
+}
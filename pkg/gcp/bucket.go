@@ -0,0 +1,111 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/glog"
+	"google.golang.org/api/option"
+)
+
+// Bucket accesses the objects of a Cloud Storage bucket by their full names
+// (e.g. datasets uploaded by other tools), unlike 'Storage', which keeps
+// its objects under the versioned prefix, and does not create the bucket.
+type Bucket struct {
+	name   string
+	client *storage.Client
+	signer *Signer
+}
+
+// NewBucket returns the bucket client, authenticated with the service account
+// JSON key, or the service account of the instance if the key is empty
+// (without signed URLs). The scope defaults to 'storage.ScopeReadOnly'.
+func NewBucket(ctx context.Context, name string, key []byte, scopes ...string) (*Bucket, error) {
+	if len(scopes) == 0 {
+		scopes = []string{storage.ScopeReadOnly}
+	}
+	_, ts, err := credentials(ctx, key, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	var signer *Signer
+	if len(key) > 0 {
+		if signer, err = NewSigner(key); err != nil {
+			return nil, err
+		}
+	}
+	cli, err := storage.NewClient(ctx, option.WithTokenSource(ts))
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{name: name, client: cli, signer: signer}, nil
+}
+
+// Close closes the client.
+func (b *Bucket) Close() error {
+	return b.client.Close()
+}
+
+// Stat returns the size and the CRC32C checksum (Castagnoli) of the object.
+// Returns 'storage.ErrObjectNotExist' if the object does not exist.
+func (b *Bucket) Stat(ctx context.Context, object string) (int64, uint32, error) {
+	var attrs *storage.ObjectAttrs
+	err := retry(ctx, transferAttempts, transferBackoff, "stat "+ObjectURI(b.name, object), func() error {
+		var err error
+		attrs, err = b.client.Bucket(b.name).Object(object).Attrs(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return attrs.Size, attrs.CRC32C, nil
+}
+
+// Download streams the object to 'w', and returns the number of bytes
+// written. Transient errors are retried, resuming from the last byte written.
+func (b *Bucket) Download(ctx context.Context, object string, w io.Writer) (int64, error) {
+	glog.Infof("downloading %q", ObjectURI(b.name, object))
+	obj := b.client.Bucket(b.name).Object(object)
+	return download(ctx, w, transferAttempts, transferBackoff, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return obj.NewRangeReader(ctx, offset, -1)
+	})
+}
+
+// Upload streams 'r' to the object in resumable chunks of 'UploadChunkSize',
+// and returns the object URI (e.g. "gs://bucket/object"). Empty
+// 'contentType' is detected from the data. It requires the
+// 'storage.ScopeReadWrite' scope.
+func (b *Bucket) Upload(ctx context.Context, object string, r io.Reader, contentType string) (string, error) {
+	glog.Infof("uploading %q", ObjectURI(b.name, object))
+	wr := b.client.Bucket(b.name).Object(object).NewWriter(ctx)
+	wr.ContentType = contentType
+	wr.ChunkSize = UploadChunkSize
+	if _, err := io.Copy(wr, r); err != nil {
+		wr.CloseWithError(err)
+		return "", err
+	}
+	if err := wr.Close(); err != nil {
+		return "", err
+	}
+	return ObjectURI(b.name, object), nil
+}
+
+// Delete deletes the object. Returns 'storage.ErrObjectNotExist'
+// if the object does not exist.
+func (b *Bucket) Delete(ctx context.Context, object string) error {
+	return retry(ctx, transferAttempts, transferBackoff, "delete "+ObjectURI(b.name, object), func() error {
+		return b.client.Bucket(b.name).Object(object).Delete(ctx)
+	})
+}
+
+// SignedURL returns the URL to GET the object without credentials,
+// which expires after 'ttl'.
+func (b *Bucket) SignedURL(object string, ttl time.Duration) (string, error) {
+	if b.signer == nil {
+		return "", fmt.Errorf("bucket has no service account key to sign URLs")
+	}
+	return b.signer.SignedURL(ObjectURI(b.name, object), ttl)
+}
@@ -2,7 +2,6 @@ package gcp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
@@ -10,7 +9,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
-	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -24,21 +23,13 @@ type Compute struct {
 
 // NewCompute returns a Google Cloud Compute client.
 // Create/Download the key file from https://console.cloud.google.com/apis/credentials.
+// Empty 'key' authenticates as the default service account of the instance.
 func NewCompute(ctx context.Context, scope string, key []byte) (*Compute, error) {
-	// key must be JSON-format as {"project_id":...}
-	credMap := make(map[string]string)
-	if err := json.Unmarshal(key, &credMap); err != nil {
-		return nil, fmt.Errorf("key has wrong format %q (%v)", string(key), err)
-	}
-	project, ok := credMap["project_id"]
-	if !ok {
-		return nil, fmt.Errorf("key has no project_id %q", string(key))
-	}
-	jwt, err := google.JWTConfigFromJSON(key, scope)
+	project, ts, err := credentials(ctx, key, scope)
 	if err != nil {
 		return nil, err
 	}
-	return &Compute{projectID: project, ctx: ctx, client: jwt.Client(ctx)}, nil
+	return &Compute{projectID: project, ctx: ctx, client: oauth2.NewClient(ctx, ts)}, nil
 }
 
 // ListMachines lists virtual machines in a zone.
@@ -212,6 +203,54 @@ func (c *Compute) DeleteMachine(ctx context.Context, cfg InstanceConfig) (st *co
 	return cfg.watchStatus()
 }
 
+// ResizeInstanceGroup resizes the managed instance group in the zone.
+func (c *Compute) ResizeInstanceGroup(ctx context.Context, zone, name string, size int64) error {
+	glog.Infof("resizing instance group %q in %q to %d", name, zone, size)
+
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return err
+	}
+	op, err := csrv.InstanceGroupManagers.
+		Resize(c.projectID, zone, name, size).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return err
+	}
+
+	// call is asynchronous; poll for the completion of op
+	for op.Status != "DONE" {
+		time.Sleep(1 * time.Second)
+		op, err = csrv.ZoneOperations.Get(c.projectID, zone, op.Name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("failed to resize %q (%s)", name, op.Error.Errors[0].Message)
+	}
+
+	glog.Infof("resized instance group %q in %q to %d", name, zone, size)
+	return nil
+}
+
+// InstanceGroupSize returns the target size of the managed instance group in the zone.
+func (c *Compute) InstanceGroupSize(ctx context.Context, zone, name string) (int64, error) {
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return 0, err
+	}
+	m, err := csrv.InstanceGroupManagers.
+		Get(c.projectID, zone, name).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return 0, err
+	}
+	return m.TargetSize, nil
+}
+
 // Machine represents a virtual machine in Google Compute Engine.
 type Machine struct {
 	Created            string
@@ -241,7 +280,9 @@ func ConvertToMachine(v compute.Instance) Machine {
 		}
 	}
 	if len(v.Disks) != 0 {
-		machine.SourceImageLicense = strings.Replace(v.Disks[0].Licenses[0], ComputeVersion, "", 1)
+		if len(v.Disks[0].Licenses) != 0 {
+			machine.SourceImageLicense = strings.Replace(v.Disks[0].Licenses[0], ComputeVersion, "", 1)
+		}
 		if v.Disks[0].InitializeParams != nil {
 			machine.SourceImage = v.Disks[0].InitializeParams.SourceImage
 		}
@@ -266,6 +307,29 @@ type InstanceConfig struct {
 	Memory     int
 	DiskSizeGB int
 
+	// MachineType is the predefined machine type (e.g. "n1-standard-4"),
+	// instead of the custom machine type of 'CPU' and 'Memory'.
+	MachineType string
+	// Image is the boot disk image (e.g. "projects/deeplearning-platform-release/global/images/family/tf-latest-gpu"),
+	// instead of the image of 'OS'.
+	Image string
+
+	// GPUType is the accelerator type to attach (e.g. "nvidia-tesla-k80").
+	// Instances with GPUs terminate on host maintenance.
+	GPUType  string
+	GPUCount int
+
+	// Preemptible is true to create the instance at lower cost,
+	// which Compute Engine may stop at any time (e.g. ephemeral workers).
+	Preemptible bool
+
+	// StartupScript is run on every boot (e.g. to start the worker),
+	// set as the 'startup-script' metadata.
+	StartupScript string
+
+	// Labels are the instance labels (e.g. to find the instances in a pool).
+	Labels map[string]string
+
 	// OnHostMaintenance is either MIGRATE or TERMINATE.
 	// If you do not want your instance to live migrate, you can
 	// choose to terminate and optionally restart your instance.
@@ -336,15 +400,32 @@ func (c *InstanceConfig) watchStatus() (st *compute.Instance, err error) {
 const ComputeVersion = "https://www.googleapis.com/compute/v1"
 
 func (c *InstanceConfig) genInstance() (instance compute.Instance) {
-	bv := true
+	// preemptible instances cannot restart automatically
+	bv := !c.Preemptible
+	onHostMaintenance := c.OnHostMaintenance
+	if c.GPUCount > 0 || c.Preemptible {
+		onHostMaintenance = "TERMINATE"
+	}
+	machineType := getComputeMachineType(c.projectID, c.Zone, c.CPU, c.Memory)
+	if c.MachineType != "" {
+		machineType = getComputePredefinedMachineType(c.projectID, c.Zone, c.MachineType)
+	}
+	sourceImage := getSourceImage(c.OS)
+	if c.Image != "" {
+		sourceImage = c.Image
+	}
+	var licenses []string
+	if l := getLicense(c.OS); l != "" && c.Image == "" {
+		licenses = []string{l}
+	}
 	instance = compute.Instance{
 		Name:        c.Name,
 		Zone:        getComputeZone(c.projectID, c.Zone),
-		MachineType: getComputeMachineType(c.projectID, c.Zone, c.CPU, c.Memory),
+		MachineType: machineType,
 		Scheduling: &compute.Scheduling{
 			AutomaticRestart:  &bv,
-			OnHostMaintenance: c.OnHostMaintenance, // GPU must be OnHostMaintenance: "TERMINATE"
-			Preemptible:       false,
+			OnHostMaintenance: onHostMaintenance, // GPU must be OnHostMaintenance: "TERMINATE"
+			Preemptible:       c.Preemptible,
 		},
 		Disks: []*compute.AttachedDisk{
 			{
@@ -353,14 +434,14 @@ func (c *InstanceConfig) genInstance() (instance compute.Instance) {
 				Boot:       true,
 				Interface:  "SCSI",
 				Kind:       "compute#attachedDisk",
-				Licenses:   []string{getLicense(c.OS)},
+				Licenses:   licenses,
 				Mode:       "READ_WRITE",
 				Type:       "PERSISTENT",
 				InitializeParams: &compute.AttachedDiskInitializeParams{
 					DiskName:    c.Name,
 					DiskType:    getComputeDiskType(c.projectID, c.Zone, "pd-ssd"),
 					DiskSizeGb:  int64(c.DiskSizeGB),
-					SourceImage: getSourceImage(c.OS),
+					SourceImage: sourceImage,
 				},
 			},
 		},
@@ -384,11 +465,26 @@ func (c *InstanceConfig) genInstance() (instance compute.Instance) {
 			},
 		},
 		// e.g. http-server,https-server
-		Tags: &compute.Tags{Items: c.Tags},
+		Tags:   &compute.Tags{Items: c.Tags},
+		Labels: c.Labels,
+	}
+	if c.GPUCount > 0 {
+		instance.GuestAccelerators = []*compute.AcceleratorConfig{{
+			AcceleratorCount: int64(c.GPUCount),
+			AcceleratorType:  getComputeAcceleratorType(c.projectID, c.Zone, c.GPUType),
+		}}
 	}
-	if len(c.MetadataItems) != 0 {
-		items := make([]*compute.MetadataItems, 0, len(c.MetadataItems))
+	metadata := c.MetadataItems
+	if c.StartupScript != "" {
+		metadata = make(map[string]string, len(c.MetadataItems)+1)
 		for k, v := range c.MetadataItems {
+			metadata[k] = v
+		}
+		metadata["startup-script"] = c.StartupScript
+	}
+	if len(metadata) != 0 {
+		items := make([]*compute.MetadataItems, 0, len(metadata))
+		for k, v := range metadata {
 			// make sure to copy as value before passing as reference!
 			copied := v
 			items = append(items, &compute.MetadataItems{Key: k, Value: &copied})
@@ -415,6 +511,16 @@ func getComputeMachineType(project, zone string, cpu, memory int) string {
 	return fmt.Sprintf("%s/projects/%s/zones/%s/machineTypes/custom-%d-%d", ComputeVersion, project, zone, cpu, mv)
 }
 
+// https://www.googleapis.com/compute/v1/projects/etcd-development/zones/us-west1-a/machineTypes/n1-standard-4
+func getComputePredefinedMachineType(project, zone, name string) string {
+	return fmt.Sprintf("%s/projects/%s/zones/%s/machineTypes/%s", ComputeVersion, project, zone, name)
+}
+
+// https://www.googleapis.com/compute/v1/projects/etcd-development/zones/us-west1-b/acceleratorTypes/nvidia-tesla-k80
+func getComputeAcceleratorType(project, zone, name string) string {
+	return fmt.Sprintf("%s/projects/%s/zones/%s/acceleratorTypes/%s", ComputeVersion, project, zone, name)
+}
+
 // https://www.googleapis.com/compute/v1/projects/etcd-development/zones/us-west1-a/diskTypes/pd-ssd
 func getComputeDiskType(project, zone, dtype string) string {
 	return fmt.Sprintf("%s/projects/%s/zones/%s/diskTypes/%s", ComputeVersion, project, zone, dtype)
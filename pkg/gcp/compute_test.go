@@ -148,3 +148,56 @@ apt-get -y --allow-unauthenticated install ansible`
 
 	glog.Info("done!")
 }
+
+func TestGenInstance(t *testing.T) {
+	cfg := InstanceConfig{
+		projectID:     "test",
+		Zone:          "us-west1-b",
+		Name:          "worker-1",
+		MachineType:   "n1-standard-4",
+		Image:         "projects/deeplearning-platform-release/global/images/family/tf-latest-gpu",
+		GPUType:       "nvidia-tesla-k80",
+		GPUCount:      1,
+		DiskSizeGB:    50,
+		StartupScript: "#!/bin/bash\necho hello",
+		MetadataItems: map[string]string{"a": "b"},
+		Labels:        map[string]string{PoolLabel: "workers"},
+	}
+	inst := cfg.genInstance()
+	if inst.MachineType != ComputeVersion+"/projects/test/zones/us-west1-b/machineTypes/n1-standard-4" {
+		t.Fatalf("unexpected machine type %q", inst.MachineType)
+	}
+	if len(inst.GuestAccelerators) != 1 ||
+		inst.GuestAccelerators[0].AcceleratorCount != 1 ||
+		inst.GuestAccelerators[0].AcceleratorType != ComputeVersion+"/projects/test/zones/us-west1-b/acceleratorTypes/nvidia-tesla-k80" {
+		t.Fatalf("unexpected accelerators %+v", inst.GuestAccelerators)
+	}
+	if inst.Scheduling.OnHostMaintenance != "TERMINATE" {
+		t.Fatalf("expected TERMINATE on host maintenance with GPUs, got %q", inst.Scheduling.OnHostMaintenance)
+	}
+	if inst.Disks[0].InitializeParams.SourceImage != cfg.Image || len(inst.Disks[0].Licenses) != 0 {
+		t.Fatalf("unexpected boot disk %+v", inst.Disks[0])
+	}
+	metadata := make(map[string]string)
+	for _, item := range inst.Metadata.Items {
+		metadata[item.Key] = *item.Value
+	}
+	if metadata["startup-script"] != cfg.StartupScript || metadata["a"] != "b" {
+		t.Fatalf("unexpected metadata %v", metadata)
+	}
+	if _, ok := cfg.MetadataItems["startup-script"]; ok {
+		t.Fatal("expected the config metadata unchanged")
+	}
+	if inst.Labels[PoolLabel] != "workers" {
+		t.Fatalf("unexpected labels %v", inst.Labels)
+	}
+
+	cfg = InstanceConfig{projectID: "test", Zone: "us-west1-b", Name: "worker-2", OS: "ubuntu", CPU: 2, Memory: 4, Preemptible: true}
+	inst = cfg.genInstance()
+	if !inst.Scheduling.Preemptible || *inst.Scheduling.AutomaticRestart || inst.Scheduling.OnHostMaintenance != "TERMINATE" {
+		t.Fatalf("unexpected scheduling %+v", inst.Scheduling)
+	}
+	if inst.MachineType != ComputeVersion+"/projects/test/zones/us-west1-b/machineTypes/custom-2-4096" || len(inst.Disks[0].Licenses) != 1 {
+		t.Fatalf("unexpected instance %+v", inst)
+	}
+}
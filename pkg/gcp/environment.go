@@ -0,0 +1,122 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Environment is the project and location of the process, detected from the
+// metadata server on Compute Engine, or from the environment otherwise.
+type Environment struct {
+	// OnGCE is true if the metadata server is reachable.
+	OnGCE bool
+
+	ProjectID string
+	Zone      string
+	Region    string
+
+	InternalIP string
+	// ExternalIP is empty if the instance has no external IP,
+	// or outside Compute Engine.
+	ExternalIP string
+}
+
+// detectTimeout is the timeout to reach the metadata server, which
+// responds in milliseconds on Compute Engine.
+const detectTimeout = time.Second
+
+// DetectEnvironment returns the project, zone, region, and IPs of the instance
+// from the metadata server. Outside Compute Engine, it falls back to the
+// "GOOGLE_CLOUD_PROJECT" environment variable (or the project of the key of
+// "GOOGLE_APPLICATION_CREDENTIALS"), "CLOUDSDK_COMPUTE_ZONE" and
+// "CLOUDSDK_COMPUTE_REGION" (as set by gcloud), and the IP of the first
+// non-loopback interface. Fields that cannot be detected are left empty.
+func DetectEnvironment(ctx context.Context) Environment {
+	c := NewMetadataClient("", WithMetadataRetry(1, 0, 0), WithMetadataTimeout(detectTimeout))
+	return detectEnvironment(ctx, c, os.Getenv)
+}
+
+func detectEnvironment(ctx context.Context, c *MetadataClient, getenv func(string) string) Environment {
+	var env Environment
+	if project, err := c.ProjectID(ctx); err == nil {
+		env.OnGCE = true
+		env.ProjectID = project
+		if env.Zone, err = c.Zone(ctx); err != nil {
+			glog.Warningf("failed to detect zone (%v)", err)
+		}
+		if env.InternalIP, err = c.InternalIP(ctx); err != nil {
+			glog.Warningf("failed to detect internal IP (%v)", err)
+		}
+		if env.ExternalIP, err = c.ExternalIP(ctx); err != nil && err != ErrMetadataNotFound {
+			glog.Warningf("failed to detect external IP (%v)", err)
+		}
+		if env.Zone != "" {
+			env.Region = zoneRegion(env.Zone)
+		}
+		return env
+	}
+
+	env.ProjectID = getenv("GOOGLE_CLOUD_PROJECT")
+	if env.ProjectID == "" {
+		env.ProjectID = getenv("GCLOUD_PROJECT")
+	}
+	if env.ProjectID == "" {
+		env.ProjectID = keyProject(getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	}
+	env.Zone = getenv("CLOUDSDK_COMPUTE_ZONE")
+	env.Region = getenv("CLOUDSDK_COMPUTE_REGION")
+	if env.Region == "" && env.Zone != "" {
+		env.Region = zoneRegion(env.Zone)
+	}
+	env.InternalIP = localIP()
+	return env
+}
+
+// keyProject returns the project of the service account JSON key file,
+// or empty if it cannot be read.
+func keyProject(path string) string {
+	if path == "" {
+		return ""
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var key struct {
+		ProjectID string `json:"project_id"`
+	}
+	if json.Unmarshal(b, &key) != nil {
+		return ""
+	}
+	return key.ProjectID
+}
+
+// localIP returns the IPv4 address of the first non-loopback interface
+// that is up, or empty if none.
+func localIP() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipn, ok := addr.(*net.IPNet); ok && ipn.IP.To4() != nil {
+				return ipn.IP.String()
+			}
+		}
+	}
+	return ""
+}
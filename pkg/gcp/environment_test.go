@@ -0,0 +1,72 @@
+package gcp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectEnvironment(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch req.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("dplearn"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/123/zones/us-west1-b"))
+		case "/computeMetadata/v1/instance/network-interfaces/":
+			w.Write([]byte(`[{"ip": "10.138.0.2", "accessConfigs": [{"externalIp": "35.1.2.3"}]}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL+"/computeMetadata/v1", WithMetadataRetry(1, 0, 0))
+	env := detectEnvironment(context.Background(), c, func(string) string { return "ignored" })
+	exp := Environment{
+		OnGCE:      true,
+		ProjectID:  "dplearn",
+		Zone:       "us-west1-b",
+		Region:     "us-west1",
+		InternalIP: "10.138.0.2",
+		ExternalIP: "35.1.2.3",
+	}
+	if env != exp {
+		t.Fatalf("expected %+v, got %+v", exp, env)
+	}
+}
+
+func TestDetectEnvironmentFallback(t *testing.T) {
+	// nothing listens, so the metadata server is unreachable
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "gcp-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "key.json")
+	if err = ioutil.WriteFile(keyPath, []byte(`{"project_id": "from-key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{
+		"GOOGLE_APPLICATION_CREDENTIALS": keyPath,
+		"CLOUDSDK_COMPUTE_ZONE":          "europe-west4-a",
+	}
+
+	c := NewMetadataClient(ts.URL, WithMetadataRetry(1, 0, 0), WithMetadataTimeout(time.Second))
+	env := detectEnvironment(context.Background(), c, func(k string) string { return vars[k] })
+	if env.OnGCE {
+		t.Fatal("expected not on GCE")
+	}
+	if env.ProjectID != "from-key" || env.Zone != "europe-west4-a" || env.Region != "europe-west4" || env.ExternalIP != "" {
+		t.Fatalf("unexpected environment %+v", env)
+	}
+}
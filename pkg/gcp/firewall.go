@@ -0,0 +1,239 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// FirewallRule is the ingress rule to allow TCP traffic to the service ports
+// (e.g. backend, frontend, and etcd client ports).
+type FirewallRule struct {
+	// Name is the name of the rule to create if any port is not allowed.
+	Name string
+	// Network is the network name (e.g. "default").
+	Network string
+	Ports   []int
+	// SourceRanges are the CIDR ranges allowed to connect.
+	// Empty defaults to "0.0.0.0/0".
+	SourceRanges []string
+	// TargetTags are the network tags of the instances to allow traffic to
+	// (e.g. tags of the instance); empty applies to all instances in the network.
+	TargetTags []string
+}
+
+// Firewalls returns the firewall rules of the project.
+func (c *Compute) Firewalls(ctx context.Context) ([]*compute.Firewall, error) {
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return nil, err
+	}
+	var fws []*compute.Firewall
+	err = csrv.Firewalls.List(c.projectID).Pages(ctx, func(l *compute.FirewallList) error {
+		fws = append(fws, l.Items...)
+		return nil
+	})
+	return fws, err
+}
+
+// MissingPorts returns the ports of the rule that no ingress rule
+// in the network allows over TCP to the target tags.
+func (c *Compute) MissingPorts(ctx context.Context, rule FirewallRule) ([]int, error) {
+	fws, err := c.Firewalls(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return missingPorts(fws, rule), nil
+}
+
+// CreateFirewall creates the ingress rule allowing the TCP ports,
+// and waits until it takes effect.
+func (c *Compute) CreateFirewall(ctx context.Context, rule FirewallRule) error {
+	glog.Infof("creating firewall rule %q for ports %v", rule.Name, rule.Ports)
+
+	csrv, err := compute.New(c.client)
+	if err != nil {
+		return err
+	}
+	op, err := csrv.Firewalls.
+		Insert(c.projectID, rule.firewall(c.projectID)).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return err
+	}
+
+	// call is asynchronous; poll for the completion of op
+	for op.Status != "DONE" {
+		time.Sleep(1 * time.Second)
+		op, err = csrv.GlobalOperations.Get(c.projectID, op.Name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("failed to create firewall rule %q (%s)", rule.Name, op.Error.Errors[0].Message)
+	}
+
+	glog.Infof("created firewall rule %q", rule.Name)
+	return nil
+}
+
+// EnsureFirewall verifies that the ports of the rule are allowed, and
+// creates the rule for the missing ports if 'create' is true. Otherwise,
+// returns the error with the command to create the rule, so that binaries
+// fail fast on startup instead of clients timing out silently.
+func (c *Compute) EnsureFirewall(ctx context.Context, rule FirewallRule, create bool) error {
+	missing, err := c.MissingPorts(ctx, rule)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall rules (%v)", err)
+	}
+	if len(missing) == 0 {
+		glog.Infof("firewall allows ports %v in network %q", rule.Ports, rule.Network)
+		return nil
+	}
+	rule.Ports = missing
+	if !create {
+		return fmt.Errorf("firewall does not allow TCP ports %v in network %q; create the rule with %q", missing, rule.Network, rule.Command())
+	}
+	return c.CreateFirewall(ctx, rule)
+}
+
+// Command returns the gcloud command to create the rule.
+func (r FirewallRule) Command() string {
+	ports := make([]string, len(r.Ports))
+	for i, p := range r.Ports {
+		ports[i] = "tcp:" + strconv.Itoa(p)
+	}
+	cmd := fmt.Sprintf("gcloud compute firewall-rules create %s --network=%s --direction=INGRESS --allow=%s --source-ranges=%s",
+		r.Name, r.network(), strings.Join(ports, ","), strings.Join(r.sourceRanges(), ","))
+	if len(r.TargetTags) > 0 {
+		cmd += " --target-tags=" + strings.Join(r.TargetTags, ",")
+	}
+	return cmd
+}
+
+func (r FirewallRule) network() string {
+	if r.Network == "" {
+		return "default"
+	}
+	return r.Network
+}
+
+func (r FirewallRule) sourceRanges() []string {
+	if len(r.SourceRanges) == 0 {
+		return []string{"0.0.0.0/0"}
+	}
+	return r.SourceRanges
+}
+
+func (r FirewallRule) firewall(project string) *compute.Firewall {
+	ports := make([]string, len(r.Ports))
+	for i, p := range r.Ports {
+		ports[i] = strconv.Itoa(p)
+	}
+	return &compute.Firewall{
+		Name:         r.Name,
+		Description:  "dplearn service ports",
+		Network:      fmt.Sprintf("%s/projects/%s/global/networks/%s", ComputeVersion, project, r.network()),
+		Direction:    "INGRESS",
+		Allowed:      []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: ports}},
+		SourceRanges: r.sourceRanges(),
+		TargetTags:   r.TargetTags,
+	}
+}
+
+// missingPorts returns the ports of the rule not allowed by the firewalls.
+func missingPorts(fws []*compute.Firewall, rule FirewallRule) []int {
+	var missing []int
+	for _, p := range rule.Ports {
+		allowed := false
+		for _, fw := range fws {
+			if firewallAllows(fw, rule.network(), rule.TargetTags, p) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			missing = append(missing, p)
+		}
+	}
+	sort.Ints(missing)
+	return missing
+}
+
+// firewallAllows returns true if the firewall rule allows the TCP port
+// to the instances of the tags in the network.
+func firewallAllows(fw *compute.Firewall, network string, tags []string, port int) bool {
+	if (fw.Direction != "" && fw.Direction != "INGRESS") || len(fw.Allowed) == 0 {
+		return false
+	}
+	if path.Base(fw.Network) != network {
+		return false
+	}
+	if len(fw.TargetTags) > 0 && !intersects(fw.TargetTags, tags) {
+		return false
+	}
+	for _, a := range fw.Allowed {
+		if a.IPProtocol != "tcp" && a.IPProtocol != "all" {
+			continue
+		}
+		if len(a.Ports) == 0 {
+			return true
+		}
+		for _, pr := range a.Ports {
+			if portInRange(pr, port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// portInRange returns true if the port is in the range (e.g. "80", "8000-9000").
+func portInRange(pr string, port int) bool {
+	ss := strings.SplitN(pr, "-", 2)
+	lo, err := strconv.Atoi(ss[0])
+	if err != nil {
+		return false
+	}
+	hi := lo
+	if len(ss) == 2 {
+		if hi, err = strconv.Atoi(ss[1]); err != nil {
+			return false
+		}
+	}
+	return lo <= port && port <= hi
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tags returns the network tags of the instance.
+func (c *MetadataClient) Tags(ctx context.Context) ([]string, error) {
+	v, err := c.getCached(ctx, "instance/tags")
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err = json.Unmarshal([]byte(v), &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
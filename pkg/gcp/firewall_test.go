@@ -0,0 +1,56 @@
+package gcp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestMissingPorts(t *testing.T) {
+	network := ComputeVersion + "/projects/p/global/networks/default"
+	fws := []*compute.Firewall{
+		{Network: network, Direction: "INGRESS", Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"2200", "22000-22010"}}}},
+		// other network
+		{Network: ComputeVersion + "/projects/p/global/networks/other", Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"4200"}}}},
+		// UDP only
+		{Network: network, Allowed: []*compute.FirewallAllowed{{IPProtocol: "udp", Ports: []string{"4200"}}}},
+		// other tags
+		{Network: network, TargetTags: []string{"db"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"4200"}}}},
+		// egress
+		{Network: network, Direction: "EGRESS", Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}},
+		// all protocols and ports to the web tag
+		{Network: network, TargetTags: []string{"web"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}},
+	}
+
+	tests := []struct {
+		tags    []string
+		ports   []int
+		missing []int
+	}{
+		{nil, []int{2200, 22005, 4200}, []int{4200}},
+		{[]string{"db"}, []int{4200, 22011}, []int{22011}},
+		{[]string{"web"}, []int{4200, 9999}, nil},
+	}
+	for i, tt := range tests {
+		missing := missingPorts(fws, FirewallRule{Network: "default", Ports: tt.ports, TargetTags: tt.tags})
+		if !reflect.DeepEqual(missing, tt.missing) {
+			t.Fatalf("#%d: expected missing %v, got %v", i, tt.missing, missing)
+		}
+	}
+}
+
+func TestFirewallRuleCommand(t *testing.T) {
+	r := FirewallRule{Name: "dplearn", Ports: []int{2200, 4200}, TargetTags: []string{"web"}}
+	cmd := r.Command()
+	for _, s := range []string{"--network=default", "--allow=tcp:2200,tcp:4200", "--source-ranges=0.0.0.0/0", "--target-tags=web"} {
+		if !strings.Contains(cmd, s) {
+			t.Fatalf("%q does not contain %q", cmd, s)
+		}
+	}
+	fw := r.firewall("p")
+	if fw.Network != ComputeVersion+"/projects/p/global/networks/default" || !reflect.DeepEqual(fw.Allowed[0].Ports, []string{"2200", "4200"}) {
+		t.Fatalf("unexpected firewall %+v", fw)
+	}
+}
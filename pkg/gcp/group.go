@@ -0,0 +1,98 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// InstanceGroupConfig defines the bounds and cooldowns to resize
+// the managed instance group of workers.
+type InstanceGroupConfig struct {
+	Zone string
+	Name string
+
+	// MinSize is the lower bound of the group size.
+	MinSize int
+	// MaxSize is the upper bound of the group size, 0 for no limit.
+	MaxSize int
+
+	// ScaleUpCooldown is the minimum duration between the last resize
+	// and a scale-up, to let the booted instances start taking jobs.
+	ScaleUpCooldown time.Duration
+	// ScaleDownCooldown is the minimum duration between the last resize
+	// and a scale-down, to not flap on bursty queues.
+	ScaleDownCooldown time.Duration
+}
+
+// InstanceGroupScaler resizes the managed instance group within the bounds
+// and the cooldowns (e.g. as the scaler of the autoscaler).
+type InstanceGroupScaler struct {
+	cfg InstanceGroupConfig
+
+	size   func(ctx context.Context) (int64, error)
+	resize func(ctx context.Context, size int64) error
+
+	mu        sync.Mutex
+	lastScale time.Time
+}
+
+// NewInstanceGroupScaler returns the scaler of the managed instance group.
+func NewInstanceGroupScaler(c *Compute, cfg InstanceGroupConfig) (*InstanceGroupScaler, error) {
+	if cfg.Zone == "" || cfg.Name == "" {
+		return nil, fmt.Errorf("empty instance group zone or name (%q/%q)", cfg.Zone, cfg.Name)
+	}
+	if cfg.MaxSize > 0 && cfg.MinSize > cfg.MaxSize {
+		return nil, fmt.Errorf("instance group min size %d > max size %d", cfg.MinSize, cfg.MaxSize)
+	}
+	return &InstanceGroupScaler{
+		cfg: cfg,
+		size: func(ctx context.Context) (int64, error) {
+			return c.InstanceGroupSize(ctx, cfg.Zone, cfg.Name)
+		},
+		resize: func(ctx context.Context, size int64) error {
+			return c.ResizeInstanceGroup(ctx, cfg.Zone, cfg.Name, size)
+		},
+	}, nil
+}
+
+// Scale resizes the group to the number of workers, bounded by the min and
+// max size. Returns an error if the resize is deferred by the cooldown, so
+// that the caller retries later.
+func (s *InstanceGroupScaler) Scale(ctx context.Context, workers int) error {
+	n := int64(workers)
+	if n < int64(s.cfg.MinSize) {
+		n = int64(s.cfg.MinSize)
+	}
+	if s.cfg.MaxSize > 0 && n > int64(s.cfg.MaxSize) {
+		n = int64(s.cfg.MaxSize)
+	}
+
+	cur, err := s.size(ctx)
+	if err != nil {
+		return err
+	}
+	if n == cur {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cooldown := s.cfg.ScaleUpCooldown
+	if n < cur {
+		cooldown = s.cfg.ScaleDownCooldown
+	}
+	if since := time.Since(s.lastScale); since < cooldown {
+		return fmt.Errorf("instance group %q is cooling down for %v (resize from %d to %d deferred)",
+			s.cfg.Name, (cooldown - since).Round(time.Second), cur, n)
+	}
+	glog.Infof("scaling instance group %q from %d to %d (%d workers desired)", s.cfg.Name, cur, n, workers)
+	if err = s.resize(ctx, n); err != nil {
+		return err
+	}
+	s.lastScale = time.Now()
+	return nil
+}
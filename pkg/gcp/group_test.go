@@ -0,0 +1,55 @@
+package gcp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInstanceGroupScaler(t *testing.T) {
+	cur := int64(2)
+	var resized []int64
+	s := &InstanceGroupScaler{
+		cfg: InstanceGroupConfig{Name: "workers", MinSize: 1, MaxSize: 5, ScaleUpCooldown: 0, ScaleDownCooldown: time.Hour},
+		size: func(ctx context.Context) (int64, error) {
+			return cur, nil
+		},
+		resize: func(ctx context.Context, size int64) error {
+			resized = append(resized, size)
+			cur = size
+			return nil
+		},
+	}
+
+	tests := []struct {
+		workers int
+		size    int64
+		err     bool
+	}{
+		{2, 2, false},  // no-op
+		{10, 5, false}, // bounded by max
+		{8, 5, false},  // already at max
+		{0, 5, true},   // scale-down in cooldown
+	}
+	for i, tt := range tests {
+		err := s.Scale(context.Background(), tt.workers)
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+		if cur != tt.size {
+			t.Fatalf("#%d: expected size %d, got %d", i, tt.size, cur)
+		}
+	}
+
+	// cooldown passed
+	s.lastScale = time.Now().Add(-2 * time.Hour)
+	if err := s.Scale(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if cur != 1 {
+		t.Fatalf("expected size bounded by min 1, got %d", cur)
+	}
+	if len(resized) != 2 {
+		t.Fatalf("expected 2 resizes, got %v", resized)
+	}
+}
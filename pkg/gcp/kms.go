@@ -0,0 +1,283 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	kmsEndpoint = "https://cloudkms.googleapis.com"
+
+	// DataKeySize is the size of the AES-256 data keys of the envelopes.
+	DataKeySize = 32
+
+	// envelopeVersion is the first byte of the sealed envelopes.
+	envelopeVersion = 1
+)
+
+// ErrEnvelopeCorrupt is returned when the sealed envelope cannot be opened.
+var ErrEnvelopeCorrupt = errors.New("gcp: envelope is corrupt")
+
+// KeyEncrypter encrypts and decrypts the data keys of the envelopes with
+// the key encryption key (e.g. Cloud KMS key, or local key in development).
+type KeyEncrypter interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// KMS encrypts and decrypts the data with a Cloud KMS symmetric key over the
+// REST API. The plaintext must be at most 64 KiB, so large data is sealed
+// in envelopes with data keys (see 'Seal').
+type KMS struct {
+	endpoint string
+	// name is "projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>".
+	name   string
+	client *http.Client
+}
+
+// NewKMS returns the Cloud KMS client of the crypto key, authenticated with
+// the service account JSON key, or the service account of the instance if
+// the key is empty.
+func NewKMS(ctx context.Context, name string, key []byte) (*KMS, error) {
+	_, ts, err := credentials(ctx, key, CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	return &KMS{endpoint: kmsEndpoint, name: name, client: oauth2.NewClient(ctx, ts)}, nil
+}
+
+// String returns the resource name of the crypto key.
+func (k *KMS) String() string { return k.name }
+
+// Encrypt encrypts the plaintext with the primary version of the key,
+// verifying the checksums in transit.
+func (k *KMS) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	req := map[string]interface{}{
+		"plaintext":       plaintext,
+		"plaintextCrc32c": strconv.FormatUint(uint64(crc32.Checksum(plaintext, castagnoli)), 10),
+	}
+	var resp struct {
+		Ciphertext              []byte `json:"ciphertext"`
+		CiphertextCrc32c        string `json:"ciphertextCrc32c"`
+		VerifiedPlaintextCrc32c bool   `json:"verifiedPlaintextCrc32c"`
+	}
+	if err := k.call(ctx, "encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.VerifiedPlaintextCrc32c {
+		return nil, fmt.Errorf("%q did not verify plaintext checksum", k.name)
+	}
+	if err := checkCRC32C(resp.Ciphertext, resp.CiphertextCrc32c); err != nil {
+		return nil, fmt.Errorf("%q ciphertext %v", k.name, err)
+	}
+	return resp.Ciphertext, nil
+}
+
+// Decrypt decrypts the ciphertext encrypted by any version of the key,
+// verifying the checksums in transit.
+func (k *KMS) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	req := map[string]interface{}{
+		"ciphertext":       ciphertext,
+		"ciphertextCrc32c": strconv.FormatUint(uint64(crc32.Checksum(ciphertext, castagnoli)), 10),
+	}
+	var resp struct {
+		Plaintext       []byte `json:"plaintext"`
+		PlaintextCrc32c string `json:"plaintextCrc32c"`
+	}
+	if err := k.call(ctx, "decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkCRC32C(resp.Plaintext, resp.PlaintextCrc32c); err != nil {
+		return nil, fmt.Errorf("%q plaintext %v", k.name, err)
+	}
+	return resp.Plaintext, nil
+}
+
+func (k *KMS) call(ctx context.Context, method string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, transferAttempts, transferBackoff, method+" with "+k.name, func() error {
+		req, err := http.NewRequest(http.MethodPost, k.endpoint+"/v1/"+k.name+":"+method, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := k.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &googleapi.Error{Code: resp.StatusCode, Message: fmt.Sprintf("%q returned %q (%s)", k.name, resp.Status, string(b))}
+		}
+		return json.Unmarshal(b, out)
+	})
+}
+
+// checkCRC32C verifies the CRC32C checksum of the data,
+// encoded as int64 string.
+func checkCRC32C(data []byte, sum string) error {
+	v, err := strconv.ParseInt(sum, 10, 64)
+	if err != nil {
+		return fmt.Errorf("has invalid checksum %q (%v)", sum, err)
+	}
+	if crc32.Checksum(data, castagnoli) != uint32(v) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// LocalKey encrypts and decrypts the data keys with a local AES-256 key,
+// in place of Cloud KMS in development. The key must be kept as secret as
+// the data it protects.
+type LocalKey struct {
+	aead cipher.AEAD
+}
+
+// NewLocalKey returns the local key encrypter of the 32-byte key.
+func NewLocalKey(key []byte) (*LocalKey, error) {
+	if len(key) != DataKeySize {
+		return nil, fmt.Errorf("local key must be %d bytes, got %d", DataKeySize, len(key))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKey{aead: aead}, nil
+}
+
+// Encrypt encrypts the plaintext with AES-GCM, prefixed with the nonce.
+func (l *LocalKey) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return sealGCM(l.aead, plaintext)
+}
+
+// Decrypt decrypts the ciphertext from 'Encrypt'.
+func (l *LocalKey) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return openGCM(l.aead, ciphertext)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealGCM(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openGCM(aead cipher.AEAD, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrEnvelopeCorrupt
+	}
+	n := aead.NonceSize()
+	plaintext, err := aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+	if err != nil {
+		return nil, ErrEnvelopeCorrupt
+	}
+	return plaintext, nil
+}
+
+// Seal encrypts the data with a new random data key, and returns the
+// envelope of the data key encrypted by 'kek' and the encrypted data,
+// so that the key encryption key never leaves Cloud KMS and large data
+// is encrypted locally.
+func Seal(ctx context.Context, kek KeyEncrypter, data []byte) ([]byte, error) {
+	dek := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	wrapped, err := kek.Encrypt(ctx, dek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := sealGCM(aead, data)
+	if err != nil {
+		return nil, err
+	}
+	// version, wrapped key length, wrapped key, nonce and ciphertext
+	env := make([]byte, 3, 3+len(wrapped)+len(ct))
+	env[0] = envelopeVersion
+	binary.BigEndian.PutUint16(env[1:3], uint16(len(wrapped)))
+	env = append(env, wrapped...)
+	return append(env, ct...), nil
+}
+
+// Open decrypts the data key of the envelope from 'Seal' with 'kek',
+// and returns the decrypted data. Returns 'ErrEnvelopeCorrupt' if the
+// envelope is malformed or tampered with.
+func Open(ctx context.Context, kek KeyEncrypter, env []byte) ([]byte, error) {
+	if len(env) < 3 || env[0] != envelopeVersion {
+		return nil, ErrEnvelopeCorrupt
+	}
+	n := int(binary.BigEndian.Uint16(env[1:3]))
+	if len(env) < 3+n {
+		return nil, ErrEnvelopeCorrupt
+	}
+	dek, err := kek.Decrypt(ctx, env[3:3+n])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, ErrEnvelopeCorrupt
+	}
+	return openGCM(aead, env[3+n:])
+}
+
+// NewKeyEncrypter returns the key encrypter of the spec: the resource name of
+// the Cloud KMS crypto key (authenticated as in 'NewKMS'), or "local:<path>"
+// of the file of the 32-byte key in base64 for development
+// (e.g. "head -c 32 /dev/urandom | base64 > local.key").
+func NewKeyEncrypter(ctx context.Context, spec string, key []byte) (KeyEncrypter, error) {
+	if strings.HasPrefix(spec, "local:") {
+		b, err := ioutil.ReadFile(strings.TrimPrefix(spec, "local:"))
+		if err != nil {
+			return nil, err
+		}
+		lk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, fmt.Errorf("local key is not base64 (%v)", err)
+		}
+		return NewLocalKey(lk)
+	}
+	if !strings.HasPrefix(spec, "projects/") || !strings.Contains(spec, "/cryptoKeys/") {
+		return nil, fmt.Errorf("invalid key %q (must be 'projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>' or 'local:<path>')", spec)
+	}
+	return NewKMS(ctx, spec, key)
+}
@@ -0,0 +1,122 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKMS(t *testing.T) {
+	// fake KMS "encrypts" by reversing the bytes
+	reverse := func(b []byte) []byte {
+		r := make([]byte, len(b))
+		for i := range b {
+			r[len(b)-1-i] = b[i]
+		}
+		return r
+	}
+	sum := func(b []byte) uint32 { return crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)) }
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var r struct {
+			Plaintext  []byte `json:"plaintext"`
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/k:encrypt":
+			ct := reverse(r.Plaintext)
+			data, _ := json.Marshal(ct)
+			fmt.Fprintf(w, `{"ciphertext": %s, "ciphertextCrc32c": "%d", "verifiedPlaintextCrc32c": true}`, data, sum(ct))
+		case "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/k:decrypt":
+			pt := reverse(r.Ciphertext)
+			data, _ := json.Marshal(pt)
+			fmt.Fprintf(w, `{"plaintext": %s, "plaintextCrc32c": "%d"}`, data, sum(pt))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	k := &KMS{endpoint: ts.URL, name: "projects/p/locations/global/keyRings/r/cryptoKeys/k", client: http.DefaultClient}
+	ctx := context.Background()
+	ct, err := k.Encrypt(ctx, []byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ct) != "cba" {
+		t.Fatalf("unexpected ciphertext %q", ct)
+	}
+	testEnvelope(t, k)
+}
+
+func TestLocalKey(t *testing.T) {
+	if _, err := NewLocalKey([]byte("short")); err == nil {
+		t.Fatal("expected error on short key")
+	}
+	k, err := NewLocalKey(bytes.Repeat([]byte("k"), DataKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnvelope(t, k)
+}
+
+func TestNewKeyEncrypter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "gcp-kms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "local.key")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), DataKeySize))
+	if err = ioutil.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kek, err := NewKeyEncrypter(context.Background(), "local:"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnvelope(t, kek)
+
+	if _, err = NewKeyEncrypter(context.Background(), "my-key", nil); err == nil {
+		t.Fatal("expected error on invalid key name")
+	}
+}
+
+func testEnvelope(t *testing.T, kek KeyEncrypter) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("secret data "), 1000)
+	env, err := Seal(ctx, kek, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(env, []byte("secret data")) {
+		t.Fatal("envelope contains plaintext")
+	}
+	v, err := Open(ctx, kek, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, data) {
+		t.Fatal("opened data mismatch")
+	}
+
+	env[len(env)-1] ^= 1
+	if _, err = Open(ctx, kek, env); err != ErrEnvelopeCorrupt {
+		t.Fatalf("expected %v, got %v", ErrEnvelopeCorrupt, err)
+	}
+	if _, err = Open(ctx, kek, env[:2]); err != ErrEnvelopeCorrupt {
+		t.Fatalf("expected %v, got %v", ErrEnvelopeCorrupt, err)
+	}
+}
@@ -1,50 +1,396 @@
 package gcp
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 )
 
-// GetComputeMetadata fetches the metadata from instance or project.
-// e.g. curl -L http://metadata.google.internal/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip -H 'Metadata-Flavor:Google'
-func GetComputeMetadata(key string, try int, interval time.Duration) ([]byte, error) {
-	const endpoint = "http://metadata.google.internal/computeMetadata/v1/"
-	if strings.HasPrefix(key, "/") {
-		key = key[1:]
+// DefaultMetadataEndpoint is the metadata server endpoint in Compute Engine.
+// "GCE_METADATA_HOST" environment variable overrides the host (e.g. emulator).
+const DefaultMetadataEndpoint = "http://metadata.google.internal/computeMetadata/v1/"
+
+// ErrMetadataNotFound is returned when the metadata key does not exist
+// (e.g. custom attribute not set, or no external IP).
+var ErrMetadataNotFound = errors.New("gcp: metadata not found")
+
+// NetworkInterface is the network interface of the instance.
+type NetworkInterface struct {
+	IP      string `json:"ip"`
+	Network string `json:"network"`
+	// ExternalIPs are the external IPs of the access configs.
+	ExternalIPs []string `json:"-"`
+
+	AccessConfigs []struct {
+		ExternalIP string `json:"externalIp"`
+		Type       string `json:"type"`
+	} `json:"accessConfigs"`
+}
+
+// ServiceAccount is the service account available to the instance.
+type ServiceAccount struct {
+	// Alias is "default" for the default service account.
+	Alias  string   `json:"-"`
+	Email  string   `json:"email"`
+	Scopes []string `json:"scopes"`
+}
+
+// MetadataOp configures the retries and timeouts of the metadata fetches.
+type MetadataOp struct {
+	// attempts is the number of attempts on connection and server errors.
+	attempts int
+	// backoff is the wait before the first retry, doubled on each
+	// retry up to 'maxBackoff'.
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// jitter is the fraction of the backoff to randomize, so that
+	// instances booted together do not retry in lockstep.
+	jitter float64
+	// timeout is the timeout of each attempt, 0 for no timeout.
+	timeout time.Duration
+}
+
+// MetadataOpOption configures the metadata fetches.
+type MetadataOpOption func(*MetadataOp)
+
+// WithMetadataRetry configures the number of attempts on connection and
+// server errors, and the exponential backoff between attempts.
+func WithMetadataRetry(attempts int, backoff, maxBackoff time.Duration) MetadataOpOption {
+	return func(op *MetadataOp) {
+		op.attempts, op.backoff, op.maxBackoff = attempts, backoff, maxBackoff
 	}
-	ep := endpoint + key
+}
 
-	req, err := http.NewRequest("GET", ep, nil)
-	if err != nil {
-		return nil, err
+// WithMetadataJitter configures the fraction of the backoff to randomize
+// (e.g. 0.2 waits between 80% and 120% of the backoff).
+func WithMetadataJitter(jitter float64) MetadataOpOption {
+	return func(op *MetadataOp) { op.jitter = jitter }
+}
+
+// WithMetadataTimeout configures the timeout of each attempt.
+// Zero timeout waits until the context is canceled.
+func WithMetadataTimeout(timeout time.Duration) MetadataOpOption {
+	return func(op *MetadataOp) { op.timeout = timeout }
+}
+
+func (op *MetadataOp) applyOpts(opts []MetadataOpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+	if op.attempts < 1 {
+		op.attempts = 1
+	}
+}
+
+// wait returns the backoff before the retry (0 for the first retry).
+func (op MetadataOp) wait(retry int) time.Duration {
+	d := op.backoff
+	for i := 0; i < retry && (op.maxBackoff == 0 || d < op.maxBackoff); i++ {
+		d *= 2
+	}
+	if op.maxBackoff > 0 && d > op.maxBackoff {
+		d = op.maxBackoff
+	}
+	if op.jitter > 0 {
+		d += time.Duration((2*rand.Float64() - 1) * op.jitter * float64(d))
+	}
+	return d
+}
+
+// defaultMetadataOp retries for about 2 seconds; the metadata server is
+// local, and never slow unless not on GCE.
+var defaultMetadataOp = MetadataOp{
+	attempts:   3,
+	backoff:    300 * time.Millisecond,
+	maxBackoff: 5 * time.Second,
+	jitter:     0.2,
+	timeout:    5 * time.Second,
+}
+
+// MetadataClient fetches the instance and project metadata from the metadata
+// server. Instance properties are cached, since they do not change while the
+// instance runs, while custom attributes are fetched on every call.
+type MetadataClient struct {
+	endpoint string
+	client   *http.Client
+	op       MetadataOp
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewMetadataClient returns the metadata client of the endpoint.
+// Empty 'endpoint' defaults to 'DefaultMetadataEndpoint'.
+func NewMetadataClient(endpoint string, opts ...MetadataOpOption) *MetadataClient {
+	op := defaultMetadataOp
+	op.applyOpts(opts)
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+		if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+			endpoint = "http://" + host + "/computeMetadata/v1/"
+		}
 	}
-	req.Header = map[string][]string{"Metadata-Flavor": {"Google"}}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return &MetadataClient{
+		endpoint: endpoint,
+		// attempts time out with the context of 'op.timeout'
+		client: &http.Client{},
+		op:     op,
+		cache:  make(map[string]string),
+	}
+}
 
-	for i := 0; i < try; i++ {
-		var resp *http.Response
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			glog.Warning(err)
-			time.Sleep(interval)
-			continue
+// Get fetches the metadata of the key (e.g. "instance/hostname"), retrying
+// connection and server errors. 'opts' override the options of the client
+// for the call. Returns 'ErrMetadataNotFound' if the key does not exist.
+func (c *MetadataClient) Get(ctx context.Context, key string, opts ...MetadataOpOption) (string, error) {
+	op := c.op
+	op.applyOpts(opts)
+
+	var (
+		v   string
+		err error
+	)
+	for i := 0; i < op.attempts; i++ {
+		if i > 0 {
+			wait := op.wait(i - 1)
+			glog.Warningf("failed to fetch metadata %q (%v); retrying in %v", key, err, wait)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(wait):
+			}
 		}
-		var data []byte
-		data, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			glog.Warning(err)
-			time.Sleep(interval)
-			continue
+		v, err = c.fetchOnce(ctx, key, op.timeout)
+		if err == nil || !retryableMetadata(err) || ctx.Err() != nil {
+			return v, err
 		}
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-		return data, nil
 	}
+	return "", fmt.Errorf("could not fetch %q after %d attempt(s) (%v)", key, op.attempts, err)
+}
+
+func (c *MetadataClient) fetchOnce(ctx context.Context, key string, timeout time.Duration) (string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	v, _, err := c.fetch(ctx, c.client, key)
+	return v, err
+}
+
+// metadataServerError is the error status from the metadata server.
+type metadataServerError struct {
+	key    string
+	status string
+}
+
+func (e metadataServerError) Error() string { return fmt.Sprintf("%q returned %q", e.key, e.status) }
+
+// retryableMetadata returns true on connection and server errors.
+func retryableMetadata(err error) bool {
+	switch err.(type) {
+	case metadataServerError, net.Error:
+		return true
+	}
+	return false
+}
+
+// fetch fetches the metadata of the key once, and returns the value and its ETag.
+func (c *MetadataClient) fetch(ctx context.Context, hc *http.Client, key string) (string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+strings.TrimPrefix(key, "/"), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Metadata-Flavor", "Google")
+	req.Header.Set("User-Agent", "dplearn")
 
-	return nil, fmt.Errorf("could not fetch %q (%v)", key, err)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", "", ErrMetadataNotFound
+	case resp.StatusCode >= 500:
+		return "", "", metadataServerError{key: key, status: resp.Status}
+	case resp.StatusCode != http.StatusOK:
+		return "", "", fmt.Errorf("%q returned %q (%s)", key, resp.Status, strings.TrimSpace(string(data)))
+	}
+	// responses without the header are not from the metadata server
+	// (e.g. proxy, or captive portal outside of GCE)
+	if resp.Header.Get("Metadata-Flavor") != "Google" {
+		return "", "", fmt.Errorf("%q returned response without 'Metadata-Flavor' header (not on GCE?)", key)
+	}
+	return string(data), resp.Header.Get("ETag"), nil
+}
+
+// getCached fetches the metadata of the key once.
+func (c *MetadataClient) getCached(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	v, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.cache[key] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+func (c *MetadataClient) getTrimmed(ctx context.Context, key string) (string, error) {
+	v, err := c.getCached(ctx, key)
+	return strings.TrimSpace(v), err
+}
+
+// ProjectID returns the project ID (e.g. "dplearn").
+func (c *MetadataClient) ProjectID(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "project/project-id")
+}
+
+// InstanceID returns the numeric instance ID.
+func (c *MetadataClient) InstanceID(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "instance/id")
+}
+
+// InstanceName returns the instance name.
+func (c *MetadataClient) InstanceName(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "instance/name")
+}
+
+// Hostname returns the instance hostname.
+func (c *MetadataClient) Hostname(ctx context.Context) (string, error) {
+	return c.getTrimmed(ctx, "instance/hostname")
+}
+
+// Zone returns the instance zone (e.g. "us-west1-b").
+func (c *MetadataClient) Zone(ctx context.Context) (string, error) {
+	// e.g. "projects/123456789/zones/us-west1-b"
+	v, err := c.getTrimmed(ctx, "instance/zone")
+	return path.Base(v), err
+}
+
+// MachineType returns the instance machine type (e.g. "n1-standard-4").
+func (c *MetadataClient) MachineType(ctx context.Context) (string, error) {
+	// e.g. "projects/123456789/machineTypes/n1-standard-4"
+	v, err := c.getTrimmed(ctx, "instance/machine-type")
+	return path.Base(v), err
+}
+
+// NetworkInterfaces returns the network interfaces of the instance.
+func (c *MetadataClient) NetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	v, err := c.getCached(ctx, "instance/network-interfaces/?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+	var ifaces []NetworkInterface
+	if err = json.Unmarshal([]byte(v), &ifaces); err != nil {
+		return nil, err
+	}
+	for i := range ifaces {
+		for _, ac := range ifaces[i].AccessConfigs {
+			if ac.ExternalIP != "" {
+				ifaces[i].ExternalIPs = append(ifaces[i].ExternalIPs, ac.ExternalIP)
+			}
+		}
+	}
+	return ifaces, nil
+}
+
+// InternalIP returns the internal IP of the first network interface.
+func (c *MetadataClient) InternalIP(ctx context.Context) (string, error) {
+	ifaces, err := c.NetworkInterfaces(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ifaces) == 0 || ifaces[0].IP == "" {
+		return "", ErrMetadataNotFound
+	}
+	return ifaces[0].IP, nil
+}
+
+// ExternalIP returns the external IP of the first network interface.
+// Returns 'ErrMetadataNotFound' if the instance has no external IP.
+func (c *MetadataClient) ExternalIP(ctx context.Context) (string, error) {
+	ifaces, err := c.NetworkInterfaces(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ifaces) == 0 || len(ifaces[0].ExternalIPs) == 0 {
+		return "", ErrMetadataNotFound
+	}
+	return ifaces[0].ExternalIPs[0], nil
+}
+
+// ServiceAccounts returns the service accounts of the instance,
+// sorted by alias.
+func (c *MetadataClient) ServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	v, err := c.getCached(ctx, "instance/service-accounts/?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+	// e.g. {"default": {"email": "...", "scopes": [...]}, "123-compute@developer.gserviceaccount.com": {...}}
+	accounts := make(map[string]ServiceAccount)
+	if err = json.Unmarshal([]byte(v), &accounts); err != nil {
+		return nil, err
+	}
+	sas := make([]ServiceAccount, 0, len(accounts))
+	for alias, sa := range accounts {
+		sa.Alias = alias
+		sas = append(sas, sa)
+	}
+	sort.Slice(sas, func(i, j int) bool { return sas[i].Alias < sas[j].Alias })
+	return sas, nil
+}
+
+// Attributes returns the custom attributes of the instance.
+func (c *MetadataClient) Attributes(ctx context.Context) (map[string]string, error) {
+	v, err := c.Get(ctx, "instance/attributes/?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]string)
+	if err = json.Unmarshal([]byte(v), &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// Attribute returns the custom attribute of the instance, or of the project
+// if the instance does not have it (e.g. "startup-script").
+// Returns 'ErrMetadataNotFound' if neither has it.
+func (c *MetadataClient) Attribute(ctx context.Context, name string) (string, error) {
+	v, err := c.Get(ctx, "instance/attributes/"+name)
+	if err != ErrMetadataNotFound {
+		return v, err
+	}
+	return c.Get(ctx, "project/attributes/"+name)
 }
@@ -0,0 +1,152 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetadataClient(t *testing.T) {
+	var requests, failures int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch req.URL.Path {
+		case "/computeMetadata/v1/instance/zone":
+			// transient server error
+			if atomic.AddInt32(&failures, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("projects/123/zones/us-west1-b"))
+		case "/computeMetadata/v1/instance/machine-type":
+			w.Write([]byte("projects/123/machineTypes/n1-standard-4"))
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("4567\n"))
+		case "/computeMetadata/v1/instance/network-interfaces/":
+			w.Write([]byte(`[{"ip": "10.138.0.2", "network": "projects/123/networks/default", "accessConfigs": [{"externalIp": "35.1.2.3", "type": "ONE_TO_ONE_NAT"}]}]`))
+		case "/computeMetadata/v1/instance/service-accounts/":
+			w.Write([]byte(`{"default": {"email": "123-compute@developer.gserviceaccount.com", "scopes": ["https://www.googleapis.com/auth/cloud-platform"]}, "123-compute@developer.gserviceaccount.com": {"email": "123-compute@developer.gserviceaccount.com"}}`))
+		case "/computeMetadata/v1/instance/attributes/":
+			w.Write([]byte(`{"worker-bucket": "/cats-request"}`))
+		case "/computeMetadata/v1/instance/attributes/worker-bucket":
+			w.Write([]byte("/cats-request"))
+		case "/computeMetadata/v1/project/attributes/ssh-keys":
+			w.Write([]byte("keys"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL+"/computeMetadata/v1", WithMetadataRetry(3, time.Millisecond, time.Millisecond))
+	ctx := context.Background()
+
+	zone, err := c.Zone(ctx)
+	if err != nil || zone != "us-west1-b" {
+		t.Fatalf("expected zone %q, got %q (%v)", "us-west1-b", zone, err)
+	}
+	if mt, err := c.MachineType(ctx); err != nil || mt != "n1-standard-4" {
+		t.Fatalf("expected machine type %q, got %q (%v)", "n1-standard-4", mt, err)
+	}
+	if id, err := c.InstanceID(ctx); err != nil || id != "4567" {
+		t.Fatalf("expected instance ID %q, got %q (%v)", "4567", id, err)
+	}
+	if ip, err := c.ExternalIP(ctx); err != nil || ip != "35.1.2.3" {
+		t.Fatalf("expected external IP %q, got %q (%v)", "35.1.2.3", ip, err)
+	}
+	if ip, err := c.InternalIP(ctx); err != nil || ip != "10.138.0.2" {
+		t.Fatalf("expected internal IP %q, got %q (%v)", "10.138.0.2", ip, err)
+	}
+	sas, err := c.ServiceAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sas) != 2 || sas[1].Alias != "default" || !reflect.DeepEqual(sas[1].Scopes, []string{"https://www.googleapis.com/auth/cloud-platform"}) {
+		t.Fatalf("unexpected service accounts %+v", sas)
+	}
+
+	// instance properties are cached
+	n := atomic.LoadInt32(&requests)
+	if zone, err = c.Zone(ctx); err != nil || zone != "us-west1-b" {
+		t.Fatalf("expected zone %q, got %q (%v)", "us-west1-b", zone, err)
+	}
+	if atomic.LoadInt32(&requests) != n {
+		t.Fatal("expected cached zone")
+	}
+
+	attrs, err := c.Attributes(ctx)
+	if err != nil || attrs["worker-bucket"] != "/cats-request" {
+		t.Fatalf("unexpected attributes %v (%v)", attrs, err)
+	}
+	if v, err := c.Attribute(ctx, "ssh-keys"); err != nil || v != "keys" {
+		t.Fatalf("expected project attribute %q, got %q (%v)", "keys", v, err)
+	}
+	if _, err = c.Attribute(ctx, "missing"); err != ErrMetadataNotFound {
+		t.Fatalf("expected %v, got %v", ErrMetadataNotFound, err)
+	}
+}
+
+func TestMetadataClientNotGCE(t *testing.T) {
+	// responds without 'Metadata-Flavor' header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+	defer ts.Close()
+
+	if _, err := NewMetadataClient(ts.URL).Zone(context.Background()); err == nil {
+		t.Fatal("expected error without 'Metadata-Flavor' header")
+	}
+}
+
+func TestMetadataOp(t *testing.T) {
+	op := MetadataOp{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	var waits []time.Duration
+	for i := 0; i < 5; i++ {
+		waits = append(waits, op.wait(i))
+	}
+	exp := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(waits, exp) {
+		t.Fatalf("expected %v, got %v", exp, waits)
+	}
+	op.jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := op.wait(0); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered backoff %v out of range", d)
+		}
+	}
+
+	// hangs until the client gives up
+	donec := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-donec:
+		}
+	}))
+	defer ts.Close()
+	defer close(donec)
+
+	c := NewMetadataClient(ts.URL, WithMetadataRetry(2, time.Millisecond, time.Millisecond))
+	start := time.Now()
+	if _, err := c.Get(context.Background(), "instance/id", WithMetadataTimeout(50*time.Millisecond)); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Fatalf("per-call timeout not applied (took %v)", took)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "instance/id"); err == nil {
+		t.Fatal("expected error on canceled context")
+	}
+}
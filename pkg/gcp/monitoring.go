@@ -0,0 +1,183 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// MonitoringScope is the OAuth2 scope to write Cloud Monitoring metrics.
+	MonitoringScope = "https://www.googleapis.com/auth/monitoring.write"
+
+	// CustomMetricPrefix is the prefix of the custom metric types
+	// (e.g. "custom.googleapis.com/dplearn/queue_depth").
+	CustomMetricPrefix = "custom.googleapis.com/dplearn/"
+
+	monitoringEndpoint = "https://monitoring.googleapis.com"
+
+	// maxTimeSeries is the maximum number of time series per write request.
+	maxTimeSeries = 200
+)
+
+// MetricPoint is the gauge value of a custom metric at a point in time.
+// Metric descriptors are created on the first write, with the value type
+// of the point (INT64 or DOUBLE).
+type MetricPoint struct {
+	// Name is the metric name under 'CustomMetricPrefix' (e.g. "queue_depth").
+	Name string
+	// Labels distinguish the time series of the metric (e.g. {"bucket": "/cats-request"}).
+	Labels map[string]string
+
+	// Int64 is the value if 'Double' is nil.
+	Int64  int64
+	Double *float64
+}
+
+// Monitoring writes custom metrics to Cloud Monitoring over the REST API.
+type Monitoring struct {
+	endpoint string
+	project  string
+	client   *http.Client
+
+	// resource is the monitored resource of the time series.
+	resource monitoredResource
+}
+
+type monitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// NewMonitoring returns the Cloud Monitoring client, authenticated with the
+// service account JSON key, or the service account of the instance if the
+// key is empty (see 'NewTokenSource'). Empty project defaults to the project
+// of the credentials. Metrics are written for the instance when running in
+// Compute Engine, or as global metrics otherwise.
+func NewMonitoring(ctx context.Context, project string, key []byte) (*Monitoring, error) {
+	p, ts, err := credentials(ctx, key, MonitoringScope)
+	if err != nil {
+		return nil, err
+	}
+	if project == "" {
+		project = p
+	}
+	m := &Monitoring{
+		endpoint: monitoringEndpoint,
+		project:  project,
+		client:   oauth2.NewClient(ctx, ts),
+		resource: monitoredResource{Type: "global", Labels: map[string]string{"project_id": project}},
+	}
+	if len(key) == 0 {
+		// no key, so on GCE (credentials are from the metadata server)
+		mc := NewMetadataClient("")
+		id, err := mc.InstanceID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		zone, err := mc.Zone(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m.resource = monitoredResource{
+			Type:   "gce_instance",
+			Labels: map[string]string{"project_id": project, "instance_id": id, "zone": zone},
+		}
+	}
+	return m, nil
+}
+
+type monitoringPoint struct {
+	Interval struct {
+		EndTime string `json:"endTime"`
+	} `json:"interval"`
+	Value struct {
+		Int64Value  *string  `json:"int64Value,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	} `json:"value"`
+}
+
+type timeSeries struct {
+	Metric struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"metric"`
+	Resource monitoredResource `json:"resource"`
+	Points   []monitoringPoint `json:"points"`
+}
+
+// Write writes the points at the time, in batches of 200 time series,
+// retrying transient errors. Each time series (metric name and labels)
+// must not be written more often than every 5 seconds.
+func (m *Monitoring) Write(ctx context.Context, now time.Time, points ...MetricPoint) error {
+	series := make([]timeSeries, len(points))
+	end := now.UTC().Format(time.RFC3339Nano)
+	for i, pt := range points {
+		ts := &series[i]
+		ts.Metric.Type = CustomMetricPrefix + pt.Name
+		ts.Metric.Labels = pt.Labels
+		ts.Resource = m.resource
+
+		var mp monitoringPoint
+		mp.Interval.EndTime = end
+		if pt.Double != nil {
+			mp.Value.DoubleValue = pt.Double
+		} else {
+			// int64 is encoded as string in JSON
+			v := strconv.FormatInt(pt.Int64, 10)
+			mp.Value.Int64Value = &v
+		}
+		ts.Points = []monitoringPoint{mp}
+	}
+
+	for len(series) > 0 {
+		batch := series
+		if len(batch) > maxTimeSeries {
+			batch = batch[:maxTimeSeries]
+		}
+		series = series[len(batch):]
+
+		err := retry(ctx, transferAttempts, transferBackoff, "write metrics to "+m.project, func() error {
+			return m.write(ctx, batch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Monitoring) write(ctx context.Context, series []timeSeries) error {
+	data, err := json.Marshal(struct {
+		TimeSeries []timeSeries `json:"timeSeries"`
+	}{series})
+	if err != nil {
+		return err
+	}
+	ep := fmt.Sprintf("%s/v3/projects/%s/timeSeries", m.endpoint, m.project)
+	req, err := http.NewRequest(http.MethodPost, ep, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &googleapi.Error{Code: resp.StatusCode, Message: fmt.Sprintf("%q returned %q (%s)", m.project, resp.Status, string(b))}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMonitoringWrite(t *testing.T) {
+	var (
+		batches  []int
+		failures int
+		first    map[string]interface{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v3/projects/test/timeSeries" {
+			t.Errorf("unexpected request %s %q", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if failures++; failures == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var wreq struct {
+			TimeSeries []map[string]interface{} `json:"timeSeries"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&wreq); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = wreq.TimeSeries[0]
+		}
+		batches = append(batches, len(wreq.TimeSeries))
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	m := &Monitoring{
+		endpoint: ts.URL,
+		project:  "test",
+		client:   http.DefaultClient,
+		resource: monitoredResource{Type: "global", Labels: map[string]string{"project_id": "test"}},
+	}
+	rate := 0.5
+	points := []MetricPoint{{Name: "http_error_rate", Double: &rate}}
+	for i := 0; i < maxTimeSeries; i++ {
+		points = append(points, MetricPoint{Name: "queue_depth", Labels: map[string]string{"bucket": fmt.Sprint(i)}, Int64: int64(i)})
+	}
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := m.Write(context.Background(), now, points...); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || batches[0] != maxTimeSeries || batches[1] != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+
+	data, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"metric":{"type":"custom.googleapis.com/dplearn/http_error_rate"},"points":[{"interval":{"endTime":"2018-01-01T00:00:00Z"},"value":{"doubleValue":0.5}}],"resource":{"labels":{"project_id":"test"},"type":"global"}}`
+	if string(data) != exp {
+		t.Fatalf("expected %s, got %s", exp, data)
+	}
+}
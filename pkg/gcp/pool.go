@@ -0,0 +1,116 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// PoolLabel is the label of the instances in an instance pool,
+// whose value is the pool name.
+const PoolLabel = "dplearn-pool"
+
+// InstancePool boots and deletes ephemeral instances from the template,
+// to scale the number of workers on queue pressure (e.g. as the scaler of
+// the autoscaler). Unlike managed instance groups, each instance can have
+// its own accelerators and startup script.
+type InstancePool struct {
+	c        *Compute
+	name     string
+	template InstanceConfig
+}
+
+// NewInstancePool returns the pool of the instances labeled with the name,
+// created from the template in the template zone.
+func NewInstancePool(c *Compute, name string, template InstanceConfig) *InstancePool {
+	return &InstancePool{c: c, name: name, template: template}
+}
+
+// Instances returns the names of the instances in the pool,
+// from the oldest to the newest.
+func (p *InstancePool) Instances(ctx context.Context) ([]string, error) {
+	insts, err := p.c.ListMachines(ctx, p.template.Zone)
+	if err != nil {
+		return nil, err
+	}
+	var pool []*compute.Instance
+	for _, inst := range insts {
+		if inst.Labels[PoolLabel] == p.name {
+			pool = append(pool, inst)
+		}
+	}
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].CreationTimestamp < pool[j].CreationTimestamp })
+	names := make([]string, len(pool))
+	for i, inst := range pool {
+		names[i] = inst.Name
+	}
+	return names, nil
+}
+
+// Scale boots or deletes the instances in the pool, to the number of workers.
+// The newest instances are deleted first.
+func (p *InstancePool) Scale(ctx context.Context, workers int) error {
+	names, err := p.Instances(ctx)
+	if err != nil {
+		return err
+	}
+	create, del := poolDiff(names, workers)
+	if create == 0 && len(del) == 0 {
+		return nil
+	}
+	glog.Infof("scaling instance pool %q from %d to %d", p.name, len(names), workers)
+
+	var (
+		wg   sync.WaitGroup
+		errc = make(chan error, create+len(del))
+	)
+	for i := 0; i < create; i++ {
+		cfg := p.template
+		cfg.Name = fmt.Sprintf("%s-%s", p.name, strings.ToLower(randTxt(8)))
+		cfg.Labels = make(map[string]string, len(p.template.Labels)+1)
+		for k, v := range p.template.Labels {
+			cfg.Labels[k] = v
+		}
+		cfg.Labels[PoolLabel] = p.name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.c.CreateMacine(ctx, cfg); err != nil {
+				errc <- fmt.Errorf("failed to create %q (%v)", cfg.Name, err)
+			}
+		}()
+	}
+	for _, name := range del {
+		cfg := InstanceConfig{Zone: p.template.Zone, Name: name}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.c.DeleteMachine(ctx, cfg); err != nil {
+				errc <- fmt.Errorf("failed to delete %q (%v)", cfg.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	return <-errc
+}
+
+// poolDiff returns the number of instances to create, and the names
+// of the instances to delete (newest first), to scale to 'n' instances.
+func poolDiff(names []string, n int) (create int, del []string) {
+	if n < 0 {
+		n = 0
+	}
+	if len(names) <= n {
+		return n - len(names), nil
+	}
+	for i := len(names) - 1; i >= n; i-- {
+		del = append(del, names[i])
+	}
+	return 0, del
+}
@@ -0,0 +1,28 @@
+package gcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPoolDiff(t *testing.T) {
+	tests := []struct {
+		names  []string
+		n      int
+		create int
+		del    []string
+	}{
+		{nil, 0, 0, nil},
+		{nil, 2, 2, nil},
+		{[]string{"a"}, 3, 2, nil},
+		{[]string{"a", "b"}, 2, 0, nil},
+		{[]string{"a", "b", "c"}, 1, 0, []string{"c", "b"}},
+		{[]string{"a"}, -1, 0, []string{"a"}},
+	}
+	for i, tt := range tests {
+		create, del := poolDiff(tt.names, tt.n)
+		if create != tt.create || !reflect.DeepEqual(del, tt.del) {
+			t.Fatalf("#%d: expected (%d, %q), got (%d, %q)", i, tt.create, tt.del, create, del)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gcp
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Reasons of the instance termination, returned by 'WaitTermination'.
+const (
+	// TerminationPreempted is returned when the preemptible instance
+	// is preempted (about 30 seconds before it stops).
+	TerminationPreempted = "preempted"
+	// TerminationMaintenance is returned when the instance terminates
+	// on host maintenance (about 60 seconds before the maintenance).
+	TerminationMaintenance = "maintenance"
+)
+
+// WaitTermination blocks until the instance is about to be reclaimed, on
+// preemption or on terminating host maintenance, and returns the reason,
+// so that workers drain and requeue their jobs beforehand. Returns an
+// error if canceled first, or if neither event can be watched.
+func (c *MetadataClient) WaitTermination(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reason string
+		err    error
+	}
+	rc := make(chan result, 2)
+	go func() {
+		err := c.waitFor(ctx, "instance/preempted", "TRUE")
+		rc <- result{TerminationPreempted, err}
+	}()
+	go func() {
+		err := c.waitFor(ctx, "instance/maintenance-event", "TERMINATE_ON_HOST_MAINTENANCE")
+		rc <- result{TerminationMaintenance, err}
+	}()
+	var err error
+	for i := 0; i < 2; i++ {
+		r := <-rc
+		if r.err == nil {
+			glog.Warningf("instance is terminating (%s)", r.reason)
+			return r.reason, nil
+		}
+		if ctx.Err() == nil {
+			glog.Warningf("stopped watching %s (%v)", r.reason, r.err)
+		}
+		err = r.err
+	}
+	return "", err
+}
+
+// waitFor watches the metadata of the key until it has the value,
+// retrying connection and server errors with the backoff of the client
+// until the context is canceled.
+func (c *MetadataClient) waitFor(ctx context.Context, key, value string) error {
+	etag := ""
+	retries := 0
+	for {
+		k := key
+		if etag != "" {
+			k += "?" + url.Values{"wait_for_change": {"true"}, "last_etag": {etag}}.Encode()
+		}
+		// hanging GET returns on change, without timeout
+		v, tag, err := c.fetch(ctx, c.client, k)
+		switch {
+		case err == nil:
+			retries = 0
+			if strings.TrimSpace(v) == value {
+				return nil
+			}
+			etag = tag
+			if etag == "" {
+				// cannot wait for change without ETag; poll instead
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(c.op.wait(0)):
+				}
+			}
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case retryableMetadata(err):
+			wait := c.op.wait(retries)
+			retries++
+			glog.Warningf("failed to watch metadata %q (%v); retrying in %v", key, err, wait)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		default:
+			return err
+		}
+	}
+}
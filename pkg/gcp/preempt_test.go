@@ -0,0 +1,71 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitTermination(t *testing.T) {
+	preemptc := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch req.URL.Path {
+		case "/computeMetadata/v1/instance/preempted":
+			if req.URL.Query().Get("wait_for_change") != "true" {
+				w.Header().Set("ETag", "1")
+				w.Write([]byte("FALSE"))
+				return
+			}
+			if req.URL.Query().Get("last_etag") != "1" {
+				t.Errorf("unexpected query %q", req.URL.RawQuery)
+			}
+			select {
+			case <-preemptc:
+			case <-req.Context().Done():
+				return
+			}
+			w.Header().Set("ETag", "2")
+			w.Write([]byte("TRUE"))
+		default:
+			// e.g. emulator without maintenance events
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewMetadataClient(ts.URL+"/computeMetadata/v1", WithMetadataRetry(3, time.Millisecond, time.Millisecond))
+
+	type result struct {
+		reason string
+		err    error
+	}
+	rc := make(chan result, 1)
+	go func() {
+		reason, err := c.WaitTermination(context.Background())
+		rc <- result{reason, err}
+	}()
+	select {
+	case r := <-rc:
+		t.Fatalf("unexpected termination %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(preemptc)
+	select {
+	case r := <-rc:
+		if r.err != nil || r.reason != TerminationPreempted {
+			t.Fatalf("expected %q, got %+v", TerminationPreempted, r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to notice preemption")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.WaitTermination(ctx); err == nil {
+		t.Fatal("expected error on canceled context")
+	}
+}
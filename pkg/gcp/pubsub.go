@@ -0,0 +1,128 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// PubSubScope is the OAuth2 scope to publish to Pub/Sub topics.
+	PubSubScope = "https://www.googleapis.com/auth/pubsub"
+
+	pubsubEndpoint = "https://pubsub.googleapis.com"
+
+	// MaxPubSubMessages is the maximum number of messages in a publish request.
+	MaxPubSubMessages = 1000
+)
+
+// PubSubMessage is the message to publish to a Pub/Sub topic.
+type PubSubMessage struct {
+	// Data is the message payload (e.g. event in JSON).
+	Data []byte `json:"data"`
+	// Attributes are used by subscribers to filter the messages
+	// without decoding the payload (e.g. {"type": "job_completed"}).
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Topic publishes messages to a Pub/Sub topic over the REST API.
+type Topic struct {
+	endpoint string
+	// name is "projects/<project>/topics/<topic>".
+	name   string
+	client *http.Client
+}
+
+// NewTopic returns the Pub/Sub topic in the project, authenticated with the
+// service account JSON key, or the service account of the instance if the
+// key is empty (see 'NewTokenSource'). Empty project defaults to the project
+// of the credentials. "PUBSUB_EMULATOR_HOST" environment variable publishes
+// to the emulator without credentials.
+func NewTopic(ctx context.Context, project, topic string, key []byte) (*Topic, error) {
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		if project == "" {
+			return nil, fmt.Errorf("empty project for Pub/Sub emulator %q", host)
+		}
+		return &Topic{endpoint: "http://" + host, name: topicName(project, topic), client: http.DefaultClient}, nil
+	}
+	p, ts, err := credentials(ctx, key, PubSubScope)
+	if err != nil {
+		return nil, err
+	}
+	if project == "" {
+		project = p
+	}
+	return &Topic{endpoint: pubsubEndpoint, name: topicName(project, topic), client: oauth2.NewClient(ctx, ts)}, nil
+}
+
+func topicName(project, topic string) string {
+	return fmt.Sprintf("projects/%s/topics/%s", project, topic)
+}
+
+// String returns the topic name (e.g. "projects/dplearn/topics/jobs").
+func (t *Topic) String() string { return t.name }
+
+// Publish publishes the messages in batches of 'MaxPubSubMessages', retrying
+// transient errors, and returns the message IDs assigned by the server.
+func (t *Topic) Publish(ctx context.Context, msgs ...PubSubMessage) ([]string, error) {
+	var ids []string
+	for len(msgs) > 0 {
+		batch := msgs
+		if len(batch) > MaxPubSubMessages {
+			batch = batch[:MaxPubSubMessages]
+		}
+		msgs = msgs[len(batch):]
+
+		var bids []string
+		err := retry(ctx, transferAttempts, transferBackoff, "publish to "+t.name, func() error {
+			var err error
+			bids, err = t.publish(ctx, batch)
+			return err
+		})
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, bids...)
+	}
+	return ids, nil
+}
+
+func (t *Topic) publish(ctx context.Context, msgs []PubSubMessage) ([]string, error) {
+	// 'Data' is encoded in base64, as required by the REST API
+	data, err := json.Marshal(struct {
+		Messages []PubSubMessage `json:"messages"`
+	}{msgs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint+"/v1/"+t.name+":publish", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, &googleapi.Error{Code: resp.StatusCode, Message: fmt.Sprintf("%q returned %q (%s)", t.name, resp.Status, string(b))}
+	}
+	var presp struct {
+		MessageIDs []string `json:"messageIds"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&presp); err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return presp.MessageIDs, nil
+}
@@ -0,0 +1,81 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTopic(t *testing.T) {
+	var (
+		batches  []int
+		failures int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v1/projects/test/topics/jobs:publish" {
+			t.Errorf("unexpected request %s %q", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// transient server error
+		if failures++; failures == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var preq struct {
+			Messages []struct {
+				Data       string            `json:"data"`
+				Attributes map[string]string `json:"attributes"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&preq); err != nil {
+			t.Fatal(err)
+		}
+		// base64 of "hello"
+		if preq.Messages[0].Data != "aGVsbG8=" || preq.Messages[0].Attributes["type"] != "job_completed" {
+			t.Errorf("unexpected message %+v", preq.Messages[0])
+		}
+		batches = append(batches, len(preq.Messages))
+		ids := make([]string, len(preq.Messages))
+		for i := range ids {
+			ids[i] = fmt.Sprint(i)
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"messageIds": ids})
+	}))
+	defer ts.Close()
+
+	old := os.Getenv("PUBSUB_EMULATOR_HOST")
+	os.Setenv("PUBSUB_EMULATOR_HOST", strings.TrimPrefix(ts.URL, "http://"))
+	defer os.Setenv("PUBSUB_EMULATOR_HOST", old)
+
+	if _, err := NewTopic(context.Background(), "", "jobs", nil); err == nil {
+		t.Fatal("expected error on empty project for emulator")
+	}
+	topic, err := NewTopic(context.Background(), "test", "jobs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic.String() != "projects/test/topics/jobs" {
+		t.Fatalf("unexpected topic %q", topic)
+	}
+
+	msgs := make([]PubSubMessage, MaxPubSubMessages+1)
+	for i := range msgs {
+		msgs[i] = PubSubMessage{Data: []byte("hello"), Attributes: map[string]string{"type": "job_completed"}}
+	}
+	ids, err := topic.Publish(context.Background(), msgs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(msgs) {
+		t.Fatalf("expected %d message IDs, got %d", len(msgs), len(ids))
+	}
+	if len(batches) != 2 || batches[0] != MaxPubSubMessages || batches[1] != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+}
@@ -0,0 +1,116 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// CloudPlatformScope is the OAuth2 scope of all Google Cloud APIs,
+	// required by Secret Manager.
+	CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	secretManagerEndpoint = "https://secretmanager.googleapis.com"
+)
+
+// SecretManager accesses the secrets in Secret Manager over the REST API.
+type SecretManager struct {
+	endpoint string
+	project  string
+	client   *http.Client
+}
+
+// NewSecretManager returns the Secret Manager client, authenticated with the
+// service account JSON key, or the service account of the instance if the
+// key is empty. Empty project defaults to the project of the credentials.
+func NewSecretManager(ctx context.Context, project string, key []byte) (*SecretManager, error) {
+	p, ts, err := credentials(ctx, key, CloudPlatformScope)
+	if err != nil {
+		return nil, err
+	}
+	if project == "" {
+		project = p
+	}
+	return &SecretManager{endpoint: secretManagerEndpoint, project: project, client: oauth2.NewClient(ctx, ts)}, nil
+}
+
+// secretVersionName returns the resource name of the secret version.
+// 'name' is the secret ID with optional version (e.g. "smtp-password",
+// "smtp-password/3"), or the full resource name. Defaults to the latest
+// version.
+func (s *SecretManager) secretVersionName(name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		if !strings.Contains(name, "/versions/") {
+			name += "/versions/latest"
+		}
+		return name
+	}
+	version := "latest"
+	if i := strings.LastIndex(name, "/"); i > 0 {
+		name, version = name[:i], name[i+1:]
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", s.project, name, version)
+}
+
+// Secret returns the payload of the secret version (e.g. "smtp-password",
+// "smtp-password/3"), verifying its checksum. Implements 'secrets.Provider'.
+func (s *SecretManager) Secret(ctx context.Context, name string) ([]byte, error) {
+	var data []byte
+	rn := s.secretVersionName(name)
+	err := retry(ctx, transferAttempts, transferBackoff, "access "+rn, func() error {
+		var err error
+		data, err = s.access(ctx, rn)
+		return err
+	})
+	return data, err
+}
+
+func (s *SecretManager) access(ctx context.Context, rn string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.endpoint+"/v1/"+rn+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// error body may not contain the secret
+		return nil, &googleapi.Error{Code: resp.StatusCode, Message: fmt.Sprintf("%q returned %q (%s)", rn, resp.Status, string(b))}
+	}
+	var aresp struct {
+		Payload struct {
+			// Data is encoded in base64.
+			Data []byte `json:"data"`
+			// DataCrc32c is int64 encoded as string, if set by the writer.
+			DataCrc32c string `json:"dataCrc32c"`
+		} `json:"payload"`
+	}
+	if err = json.Unmarshal(b, &aresp); err != nil {
+		return nil, err
+	}
+	if aresp.Payload.DataCrc32c != "" {
+		sum, err := strconv.ParseInt(aresp.Payload.DataCrc32c, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if crc32.Checksum(aresp.Payload.Data, crc32.MakeTable(crc32.Castagnoli)) != uint32(sum) {
+			return nil, fmt.Errorf("%q payload checksum mismatch", rn)
+		}
+	}
+	return aresp.Payload.Data, nil
+}
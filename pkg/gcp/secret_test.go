@@ -0,0 +1,50 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecretManager(t *testing.T) {
+	sum := crc32.Checksum([]byte("hunter2"), crc32.MakeTable(crc32.Castagnoli))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/projects/test/secrets/smtp-password/versions/latest:access",
+			"/v1/projects/other/secrets/smtp-password/versions/2:access":
+			// base64 of "hunter2"
+			fmt.Fprintf(w, `{"payload": {"data": "aHVudGVyMg==", "dataCrc32c": "%d"}}`, sum)
+		case "/v1/projects/test/secrets/corrupt/versions/latest:access":
+			fmt.Fprintf(w, `{"payload": {"data": "aHVudGVyMw==", "dataCrc32c": "%d"}}`, sum)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	s := &SecretManager{endpoint: ts.URL, project: "test", client: http.DefaultClient}
+	tests := []struct {
+		name string
+		err  bool
+	}{
+		{"smtp-password", false},
+		{"projects/other/secrets/smtp-password/versions/2", false},
+		{"corrupt", true},
+		{"missing", true},
+	}
+	for i, tt := range tests {
+		v, err := s.Secret(context.Background(), tt.name)
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+		if !tt.err && string(v) != "hunter2" {
+			t.Fatalf("#%d: unexpected secret %q", i, v)
+		}
+	}
+	if rn := s.secretVersionName("smtp-password/3"); rn != "projects/test/secrets/smtp-password/versions/3" {
+		t.Fatalf("unexpected resource name %q", rn)
+	}
+}
@@ -2,9 +2,9 @@ package gcp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 	"strings"
 	"time"
@@ -29,27 +29,26 @@ type Storage struct {
 
 	ctx    context.Context
 	client *storage.Client
+	signer *Signer
 }
 
 // NewStorage returns a new Google Cloud Storage client, creating bucket if not exists.
 // 'key' is a Google Developers service account JSON key.
 // Create/Download the key file from https://console.cloud.google.com/apis/credentials.
+// Empty 'key' authenticates as the default service account of the instance,
+// without signed URLs.
 func NewStorage(ctx context.Context, bucket, scope string, key []byte, prefix string) (*Storage, error) {
-	// key must be JSON-format as {"project_id":...}
-	credMap := make(map[string]string)
-	if err := json.Unmarshal(key, &credMap); err != nil {
-		return nil, err
-	}
-	project, ok := credMap["project_id"]
-	if !ok {
-		return nil, fmt.Errorf("key has no project_id")
-	}
-
-	jwt, err := google.JWTConfigFromJSON(key, scope)
+	project, ts, err := credentials(ctx, key, scope)
 	if err != nil {
 		return nil, err
 	}
-	cli, err := storage.NewClient(ctx, option.WithTokenSource(jwt.TokenSource(ctx)))
+	var signer *Signer
+	if len(key) > 0 {
+		if signer, err = NewSigner(key); err != nil {
+			return nil, err
+		}
+	}
+	cli, err := storage.NewClient(ctx, option.WithTokenSource(ts))
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +73,7 @@ func NewStorage(ctx context.Context, bucket, scope string, key []byte, prefix st
 		glog.Infof("created bucket %q", bucket)
 	}
 
-	return &Storage{projectID: project, bucket: bucket, prefix: prefix, ctx: ctx, client: cli}, nil
+	return &Storage{projectID: project, bucket: bucket, prefix: prefix, ctx: ctx, client: cli, signer: signer}, nil
 }
 
 // Close closes the Client.
@@ -101,6 +100,122 @@ func (s *Storage) Put(key string, data []byte) error {
 	return wr.Close()
 }
 
+// Upload streams 'r' with 'key' as a file name in the storage, and returns
+// the object URI (e.g. "gs://bucket/v1/prefix/key"). Data is sent in
+// resumable chunks of 'UploadChunkSize'. Empty 'contentType' is detected
+// from the data.
+func (s *Storage) Upload(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	objectName := path.Join(v1, s.prefix, key)
+	glog.Infof("uploading key %q", key)
+	wr := s.client.Bucket(s.bucket).Object(objectName).NewWriter(ctx)
+	wr.ContentType = contentType
+	wr.ChunkSize = UploadChunkSize
+	n, err := io.Copy(wr, r)
+	if err != nil {
+		wr.CloseWithError(err)
+		return "", err
+	}
+	if err = wr.Close(); err != nil {
+		return "", err
+	}
+	glog.Infof("uploaded key %q (size: %s)", key, humanize.Bytes(uint64(n)))
+	return ObjectURI(s.bucket, objectName), nil
+}
+
+// SignedURL returns the URL to GET the object of 'key' without
+// credentials, which expires after 'ttl'.
+func (s *Storage) SignedURL(key string, ttl time.Duration) (string, error) {
+	if s.signer == nil {
+		return "", fmt.Errorf("storage has no service account key to sign URLs")
+	}
+	return s.signer.SignedURL(ObjectURI(s.bucket, path.Join(v1, s.prefix, key)), ttl)
+}
+
+// ObjectURI returns the URI of the object in the bucket.
+func ObjectURI(bucket, object string) string {
+	return "gs://" + bucket + "/" + object
+}
+
+// ParseObjectURI returns the bucket and object name of the URI
+// (e.g. "gs://bucket/v1/prefix/key").
+func ParseObjectURI(uri string) (bucket, object string, err error) {
+	if !strings.HasPrefix(uri, "gs://") {
+		return "", "", fmt.Errorf("%q is not a Cloud Storage URI", uri)
+	}
+	ss := strings.SplitN(strings.TrimPrefix(uri, "gs://"), "/", 2)
+	if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+		return "", "", fmt.Errorf("%q has no bucket or object name", uri)
+	}
+	return ss[0], ss[1], nil
+}
+
+// Signer generates signed URLs to Cloud Storage objects,
+// with the service account key.
+type Signer struct {
+	accessID   string
+	privateKey []byte
+}
+
+// NewSigner returns the signer with the service account JSON key.
+func NewSigner(key []byte) (*Signer, error) {
+	jwt, err := google.JWTConfigFromJSON(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{accessID: jwt.Email, privateKey: jwt.PrivateKey}, nil
+}
+
+// SignedURL returns the URL to GET the object of the URI
+// (e.g. "gs://bucket/v1/prefix/key") without credentials, which expires after 'ttl'.
+func (s *Signer) SignedURL(uri string, ttl time.Duration) (string, error) {
+	bucket, object, err := ParseObjectURI(uri)
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(bucket, object, http.MethodGet, time.Now().Add(ttl))
+}
+
+// Sign returns the URL to access the object with the HTTP method
+// (e.g. "GET" to download, "PUT" to upload) without credentials,
+// until 'expiry'.
+func (s *Signer) Sign(bucket, object, method string, expiry time.Time) (string, error) {
+	if bucket == "" || object == "" {
+		return "", fmt.Errorf("empty bucket %q or object %q", bucket, object)
+	}
+	return storage.SignedURL(bucket, object, &storage.SignedURLOptions{
+		GoogleAccessID: s.accessID,
+		PrivateKey:     s.privateKey,
+		Method:         method,
+		Expires:        expiry,
+	})
+}
+
+// SignedURL returns the URL to access the object with the HTTP method
+// without credentials, until 'expiry'. It is signed with the service
+// account key of the application default credentials (e.g. the key file
+// in "GOOGLE_APPLICATION_CREDENTIALS"), so that clients access the object
+// directly instead of through the server.
+func SignedURL(bucket, object, method string, expiry time.Time) (string, error) {
+	s, err := NewDefaultSigner()
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(bucket, object, method, expiry)
+}
+
+// NewDefaultSigner returns the signer with the service account key
+// of the application default credentials.
+func NewDefaultSigner() (*Signer, error) {
+	creds, err := google.FindDefaultCredentials(context.Background(), storage.ScopeReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds.JSON) == 0 {
+		return nil, fmt.Errorf("default credentials have no service account key to sign URLs")
+	}
+	return NewSigner(creds.JSON)
+}
+
 // Get returns data reader for the specified 'key'.
 func (s *Storage) Get(key string) (io.ReadCloser, error) {
 	glog.Infof("fetching key %q", key)
@@ -3,6 +3,11 @@ package gcp
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"io"
 	"io/ioutil"
 	"os"
@@ -10,6 +15,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/golang/glog"
@@ -132,3 +138,65 @@ func TestStorage(t *testing.T) {
 		t.Fatalf("expected %v, got %v", context.Canceled, err)
 	}
 }
+
+func TestSigner(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "test",
+		"client_email": "test@test.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := s.SignedURL("gs://test-bucket/v1/cats/req-1/output.png", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, "https://storage.googleapis.com/test-bucket/v1/cats/req-1/output.png?") ||
+		!strings.Contains(u, "GoogleAccessId=test%40test.iam.gserviceaccount.com") ||
+		!strings.Contains(u, "Signature=") {
+		t.Fatalf("unexpected signed URL %q", u)
+	}
+
+	if _, err = s.SignedURL("https://storage.googleapis.com/test-bucket/output.png", time.Hour); err == nil {
+		t.Fatal("expected error on non-gs URI")
+	}
+	if _, _, err = ParseObjectURI("gs://test-bucket"); err == nil {
+		t.Fatal("expected error on URI without object name")
+	}
+
+	// upload URL from the default credentials
+	f, err := ioutil.TempFile(os.TempDir(), "gcp-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(key); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	old := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", f.Name())
+	defer os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", old)
+
+	u, err = SignedURL("test-bucket", "v1/cats/req-1/input.png", "PUT", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, "https://storage.googleapis.com/test-bucket/v1/cats/req-1/input.png?") || !strings.Contains(u, "Signature=") {
+		t.Fatalf("unexpected signed URL %q", u)
+	}
+	if _, err = SignedURL("test-bucket", "", "GET", time.Now().Add(time.Minute)); err == nil {
+		t.Fatal("expected error on empty object name")
+	}
+}
@@ -0,0 +1,141 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/golang/glog"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// UploadChunkSize is the size of each request in resumable uploads,
+	// so that a failed request is resumed from the last chunk.
+	UploadChunkSize = 8 * 1024 * 1024
+
+	// transferAttempts is the number of attempts of uploads and downloads
+	// on transient errors, with exponential backoff from 'transferBackoff'.
+	transferAttempts = 5
+	transferBackoff  = time.Second
+)
+
+// UploadFile uploads the file with 'key' as a file name in the storage,
+// and returns the object URI. The file is streamed in resumable chunks, and
+// the upload is retried from the start on transient errors. Empty
+// 'contentType' is detected from the data.
+func (s *Storage) UploadFile(ctx context.Context, key, fpath, contentType string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var uri string
+	err = retry(ctx, transferAttempts, transferBackoff, "upload "+key, func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		var err error
+		uri, err = s.Upload(ctx, key, f, contentType)
+		return err
+	})
+	return uri, err
+}
+
+// Download streams the object of 'key' to 'w', and returns the number of
+// bytes written. Transient errors are retried, resuming from the last byte
+// written. Returns 'storage.ErrObjectNotExist' if the object does not exist.
+func (s *Storage) Download(ctx context.Context, key string, w io.Writer) (int64, error) {
+	glog.Infof("downloading key %q", key)
+	obj := s.client.Bucket(s.bucket).Object(path.Join(v1, s.prefix, key))
+	n, err := download(ctx, w, transferAttempts, transferBackoff, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		return obj.NewRangeReader(ctx, offset, -1)
+	})
+	if err != nil {
+		return n, err
+	}
+	glog.Infof("downloaded key %q (size: %s)", key, humanize.Bytes(uint64(n)))
+	return n, nil
+}
+
+// DownloadFile downloads the object of 'key' to the file, which is
+// replaced only when the download completes.
+func (s *Storage) DownloadFile(ctx context.Context, key, fpath string) error {
+	f, err := ioutil.TempFile(filepath.Dir(fpath), filepath.Base(fpath)+".download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = s.Download(ctx, key, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fpath)
+}
+
+// download copies the reader from 'open' to 'w', reopening it from
+// the last byte written on transient errors.
+func download(ctx context.Context, w io.Writer, attempts int, backoff time.Duration, open func(ctx context.Context, offset int64) (io.ReadCloser, error)) (int64, error) {
+	var written int64
+	err := retry(ctx, attempts, backoff, "download", func() error {
+		rc, err := open(ctx, written)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		n, err := io.Copy(w, rc)
+		written += n
+		return err
+	})
+	return written, err
+}
+
+// retry calls 'f' until it succeeds, fails with a permanent error,
+// or fails 'attempts' times, doubling 'backoff' between attempts.
+func retry(ctx context.Context, attempts int, backoff time.Duration, desc string, f func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil || !retryable(err) {
+			return err
+		}
+		glog.Warningf("failed to %s (%v); retrying in %v", desc, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("failed to %s after %d attempts (%v)", desc, attempts, err)
+}
+
+// retryable returns true if the error is transient
+// (e.g. connection reset, rate limited, server errors).
+func retryable(err error) bool {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded, storage.ErrObjectNotExist, storage.ErrBucketNotExist:
+		return false
+	case io.ErrUnexpectedEOF:
+		return true
+	}
+	switch v := err.(type) {
+	case *googleapi.Error:
+		return v.Code == 429 || v.Code >= 500
+	case net.Error:
+		return true
+	}
+	return false
+}
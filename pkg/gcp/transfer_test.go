@@ -0,0 +1,98 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// flakyReader fails with 'io.ErrUnexpectedEOF' after 'n' bytes.
+type flakyReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+func TestDownload(t *testing.T) {
+	data := "hello world"
+	var offsets []int64
+	open := func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) == 2 {
+			return nil, &googleapi.Error{Code: 503}
+		}
+		return ioutil.NopCloser(&flakyReader{r: strings.NewReader(data[offset:]), n: 4}), nil
+	}
+
+	var buf bytes.Buffer
+	n, err := download(context.Background(), &buf, 10, time.Millisecond, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || buf.String() != data {
+		t.Fatalf("expected %q, got %q (%d bytes)", data, buf.String(), n)
+	}
+	// resumes from the last byte written
+	expected := []int64{0, 4, 4, 8}
+	if len(offsets) != len(expected) {
+		t.Fatalf("expected offsets %v, got %v", expected, offsets)
+	}
+	for i := range expected {
+		if offsets[i] != expected[i] {
+			t.Fatalf("expected offsets %v, got %v", expected, offsets)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		err      error
+		attempts int
+	}{
+		{nil, 1},
+		{storage.ErrObjectNotExist, 1},
+		{&googleapi.Error{Code: 403}, 1},
+		{errors.New("permanent"), 1},
+		{&googleapi.Error{Code: 429}, 3},
+		{&googleapi.Error{Code: 500}, 3},
+		{io.ErrUnexpectedEOF, 3},
+	}
+	for i, tt := range tests {
+		attempts := 0
+		err := retry(context.Background(), 3, time.Millisecond, "test", func() error {
+			attempts++
+			return tt.err
+		})
+		if attempts != tt.attempts {
+			t.Fatalf("#%d: expected %d attempts, got %d", i, tt.attempts, attempts)
+		}
+		if (err == nil) != (tt.err == nil) {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := retry(ctx, 3, time.Hour, "test", func() error { return io.ErrUnexpectedEOF }); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
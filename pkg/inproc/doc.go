@@ -0,0 +1,10 @@
+// Package inproc implements the registry of job handlers that run inside
+// the backend process, for cheap jobs that do not need external workers.
+//
+//	func init() {
+//		inproc.Register("/text-request", func(ctx context.Context, item *etcdqueue.Item) error {
+//			item.Value = strings.ToLower(item.Value)
+//			return nil
+//		})
+//	}
+package inproc
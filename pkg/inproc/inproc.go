@@ -0,0 +1,71 @@
+package inproc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// Handler processes the item, setting the result in 'item.Value'.
+// Returning an error completes the item with the error message.
+type Handler func(ctx context.Context, item *queue.Item) error
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Handler)
+)
+
+// Register registers the handler for the bucket (e.g. "/text-request").
+// It panics if the handler is nil or the bucket is already registered,
+// as is expected to be called in package init.
+func Register(bucket string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if h == nil {
+		panic("inproc: Register handler is nil")
+	}
+	if _, dup := handlers[bucket]; dup {
+		panic(fmt.Sprintf("inproc: Register called twice for bucket %q", bucket))
+	}
+	handlers[bucket] = h
+}
+
+// Unregister removes the handler for the bucket.
+func Unregister(bucket string) {
+	mu.Lock()
+	delete(handlers, bucket)
+	mu.Unlock()
+}
+
+// Lookup returns the handler registered for the bucket.
+func Lookup(bucket string) (Handler, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	h, ok := handlers[bucket]
+	return h, ok
+}
+
+// Buckets returns the sorted list of registered buckets.
+func Buckets() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	bs := make([]string, 0, len(handlers))
+	for b := range handlers {
+		bs = append(bs, b)
+	}
+	sort.Strings(bs)
+	return bs
+}
+
+// Run runs the handler on the item, recovering from panics.
+func Run(ctx context.Context, h Handler, item *queue.Item) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return h(ctx, item)
+}
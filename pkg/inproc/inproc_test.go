@@ -0,0 +1,50 @@
+package inproc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestRegistry(t *testing.T) {
+	Register("/text-request", func(ctx context.Context, item *queue.Item) error {
+		item.Value = strings.ToLower(item.Value)
+		return nil
+	})
+	Register("/panic-request", func(ctx context.Context, item *queue.Item) error {
+		panic("oops")
+	})
+	defer Unregister("/text-request")
+	defer Unregister("/panic-request")
+
+	if bs := Buckets(); !reflect.DeepEqual(bs, []string{"/panic-request", "/text-request"}) {
+		t.Fatalf("unexpected buckets %q", bs)
+	}
+
+	h, ok := Lookup("/text-request")
+	if !ok {
+		t.Fatal("expected handler for /text-request")
+	}
+	item := queue.CreateItem("/text-request", 100, "HELLO")
+	if err := Run(context.Background(), h, item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Value != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", item.Value)
+	}
+
+	h, _ = Lookup("/panic-request")
+	if err := Run(context.Background(), h, item); err == nil || err.Error() != "handler panic: oops" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate Register")
+		}
+	}()
+	Register("/text-request", h)
+}
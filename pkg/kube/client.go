@@ -0,0 +1,137 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	serviceAccountTokenPath     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAPath        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	serviceAccountNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// Client is the Kubernetes API client.
+type Client struct {
+	server string
+	token  string
+	cli    *http.Client
+}
+
+// NewClient creates a client with the API server URL and bearer token.
+func NewClient(server, token string, cli *http.Client) *Client {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return &Client{server: strings.TrimSuffix(server, "/"), token: token, cli: cli}
+}
+
+// InClusterClient creates a client with the in-cluster service account credentials.
+func InClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in Kubernetes cluster (KUBERNETES_SERVICE_HOST, KUBERNETES_SERVICE_PORT not set)")
+	}
+	token, err := ioutil.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountCAPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %q", serviceAccountCAPath)
+	}
+	cli := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	return NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)), cli), nil
+}
+
+// InClusterNamespace returns the namespace of the pod, or "default".
+func InClusterNamespace() string {
+	b, err := ioutil.ReadFile(serviceAccountNamespacePath)
+	if err != nil || len(bytes.TrimSpace(b)) == 0 {
+		return "default"
+	}
+	return string(bytes.TrimSpace(b))
+}
+
+// Error is the error response from the API server.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kubernetes: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound returns true if the error is 404.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Do sends the request to the API path (e.g. "/apis/batch/v1/namespaces/default/jobs"),
+// with 'in' encoded in JSON with the content type, and decodes the response into 'out'.
+func (c *Client) Do(ctx context.Context, method, path, contentType string, in, out interface{}) error {
+	rc, err := c.Stream(ctx, method, path, contentType, in)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, rc)
+		return nil
+	}
+	return json.NewDecoder(rc).Decode(out)
+}
+
+// Stream is like Do, but returns the response body (e.g. pod logs).
+func (c *Client) Stream(ctx context.Context, method, path, contentType string, in interface{}) (io.ReadCloser, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var st struct {
+			Message string `json:"message"`
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &st) != nil || st.Message == "" {
+			st.Message = string(b)
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s %q returned %q", method, path, st.Message)}
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,3 @@
+// Package kube implements a minimal Kubernetes API client, with the
+// in-cluster service account credentials.
+package kube
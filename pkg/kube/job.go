@@ -0,0 +1,212 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+// JobSpec defines the Kubernetes Job to run a task (e.g. model training).
+type JobSpec struct {
+	Image   string
+	Command []string
+	Args    []string
+	Env     map[string]string
+	Labels  map[string]string
+
+	// CPU and Memory are the resource requests and limits
+	// (e.g. "2", "8Gi"). Empty for no limit.
+	CPU    string
+	Memory string
+	// GPUs is the number of "nvidia.com/gpu" to request.
+	GPUs int
+
+	// BackoffLimit is the number of retries before marking the job failed.
+	BackoffLimit int
+	// ActiveDeadlineSeconds is the maximum duration of the job. 0 for no limit.
+	ActiveDeadlineSeconds int64
+}
+
+// JobManifest returns the "batch/v1" Job manifest of the name.
+func JobManifest(name string, spec JobSpec) map[string]interface{} {
+	labels := map[string]string{"app": "dplearn"}
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+
+	var env []map[string]string
+	for k, v := range spec.Env {
+		env = append(env, map[string]string{"name": k, "value": v})
+	}
+	// deterministic manifest
+	sort.Slice(env, func(i, j int) bool { return env[i]["name"] < env[j]["name"] })
+
+	resources := make(map[string]string)
+	if spec.CPU != "" {
+		resources["cpu"] = spec.CPU
+	}
+	if spec.Memory != "" {
+		resources["memory"] = spec.Memory
+	}
+	limits := make(map[string]string)
+	for k, v := range resources {
+		limits[k] = v
+	}
+	if spec.GPUs > 0 {
+		limits["nvidia.com/gpu"] = strconv.Itoa(spec.GPUs)
+	}
+
+	container := map[string]interface{}{
+		"name":  "job",
+		"image": spec.Image,
+		"resources": map[string]interface{}{
+			"requests": resources,
+			"limits":   limits,
+		},
+	}
+	if len(spec.Command) > 0 {
+		container["command"] = spec.Command
+	}
+	if len(spec.Args) > 0 {
+		container["args"] = spec.Args
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+
+	jobSpec := map[string]interface{}{
+		"backoffLimit": spec.BackoffLimit,
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": labels},
+			"spec": map[string]interface{}{
+				"restartPolicy": "Never",
+				"containers":    []interface{}{container},
+			},
+		},
+	}
+	if spec.ActiveDeadlineSeconds > 0 {
+		jobSpec["activeDeadlineSeconds"] = spec.ActiveDeadlineSeconds
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"name": name, "labels": labels},
+		"spec":       jobSpec,
+	}
+}
+
+// IsAlreadyExists returns true if the error is 409.
+func IsAlreadyExists(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusConflict
+}
+
+// CreateJob creates the Job in the namespace.
+func (c *Client) CreateJob(ctx context.Context, namespace, name string, spec JobSpec) error {
+	return c.Do(ctx, http.MethodPost, fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs", namespace), "application/json", JobManifest(name, spec), nil)
+}
+
+// JobCondition is the condition of the Job (e.g. "Complete", "Failed").
+type JobCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// JobStatus is the status of the Job.
+type JobStatus struct {
+	Active     int            `json:"active"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Conditions []JobCondition `json:"conditions"`
+}
+
+// FailedCondition returns the failure condition, if the job has failed.
+func (st JobStatus) FailedCondition() (JobCondition, bool) {
+	for _, c := range st.Conditions {
+		if c.Type == "Failed" && c.Status == "True" {
+			return c, true
+		}
+	}
+	return JobCondition{}, false
+}
+
+// GetJob returns the status of the Job.
+func (c *Client) GetJob(ctx context.Context, namespace, name string) (JobStatus, error) {
+	var job struct {
+		Status JobStatus `json:"status"`
+	}
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs/%s", namespace, name), "", nil, &job)
+	return job.Status, err
+}
+
+// DeleteJob deletes the Job with its pods.
+func (c *Client) DeleteJob(ctx context.Context, namespace, name string) error {
+	opts := map[string]interface{}{"kind": "DeleteOptions", "apiVersion": "v1", "propagationPolicy": "Background"}
+	err := c.Do(ctx, http.MethodDelete, fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs/%s", namespace, name), "application/json", opts, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Pod is the pod of the Job.
+type Pod struct {
+	Name string
+	// Phase is "Pending", "Running", "Succeeded", "Failed", or "Unknown".
+	Phase string
+}
+
+// JobPods returns the pods of the Job, created by the Job controller
+// with "job-name" label.
+func (c *Client) JobPods(ctx context.Context, namespace, name string) ([]Pod, error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	p := fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s", namespace, url.QueryEscape("job-name="+name))
+	if err := c.Do(ctx, http.MethodGet, p, "", nil, &list); err != nil {
+		return nil, err
+	}
+	pods := make([]Pod, 0, len(list.Items))
+	for _, it := range list.Items {
+		pods = append(pods, Pod{Name: it.Metadata.Name, Phase: it.Status.Phase})
+	}
+	return pods, nil
+}
+
+// maxPodLogsSize is the maximum size of the pod logs to read,
+// since the logs are written by the job code.
+const maxPodLogsSize = 1 << 20 // 1 MiB
+
+// PodLogs returns the last lines of the pod logs. 0 to return all lines.
+// It returns an error if the lines exceed 1 MiB.
+func (c *Client) PodLogs(ctx context.Context, namespace, pod string, tailLines int) (string, error) {
+	p := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", namespace, pod)
+	if tailLines > 0 {
+		p += "?tailLines=" + strconv.Itoa(tailLines)
+	}
+	rc, err := c.Stream(ctx, http.MethodGet, p, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(fileutil.LimitReader(rc, maxPodLogsSize))
+	if err == fileutil.ErrTooLarge {
+		return "", fmt.Errorf("logs of pod %q exceed %d bytes", pod, maxPodLogsSize)
+	}
+	return string(b), err
+}
@@ -0,0 +1,4 @@
+// Package notify implements notification sinks for operational events
+// (e.g. no healthy worker for a bucket, failed jobs, lost workers), and
+// the router to send the events to the sinks by type from the config.
+package notify
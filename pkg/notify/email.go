@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendMail sends the message over SMTP, replaced in tests.
+var sendMail = smtp.SendMail
+
+// EmailSink sends the events as plain text emails over SMTP.
+type EmailSink struct {
+	// Addr is the SMTP server address (e.g. "smtp.example.com:587").
+	Addr string
+	From string
+	To   []string
+	// Username and Password authenticate with PLAIN auth, if not empty.
+	Username string
+	Password string
+}
+
+// Notify sends the event. The context is not used, since net/smtp
+// does not support cancellation.
+func (s *EmailSink) Notify(ctx context.Context, ev Event) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return sendMail(s.Addr, auth, s.From, s.To, emailMessage(s.From, s.To, ev))
+}
+
+func emailMessage(from string, to []string, ev Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: [dplearn] %s: %s\r\n", ev.Type, firstLine(ev.Message))
+	fmt.Fprintf(&buf, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&buf, "%s\r\n\r\n", ev.Message)
+	for _, f := range []struct{ name, value string }{
+		{"Type", ev.Type},
+		{"Bucket", ev.Bucket},
+		{"Worker", ev.Worker},
+		{"Request ID", ev.RequestID},
+		{"Time", ev.Time.UTC().Format(time.RFC3339)},
+	} {
+		if f.value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", f.name, f.value)
+		}
+	}
+	return buf.Bytes()
+}
+
+// firstLine returns the first line of the message, for the subject.
+func firstLine(s string) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
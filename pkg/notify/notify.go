@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Event types.
+const (
+	// EventNoHealthyWorkers is emitted when the healthy worker count
+	// for the bucket drops to zero.
+	EventNoHealthyWorkers = "no_healthy_workers"
+	// EventWorkersRecovered is emitted when the bucket has healthy workers again.
+	EventWorkersRecovered = "workers_recovered"
+
+	// EventJobFailed is emitted when the job completes with an error.
+	EventJobFailed = "job_failed"
+	// EventJobDeadLettered is emitted when the job is moved to the dead
+	// letter bucket after the maximum number of attempts.
+	EventJobDeadLettered = "job_dead_lettered"
+
+	// EventWorkerRegistered is emitted on the first report of the worker.
+	EventWorkerRegistered = "worker_registered"
+	// EventWorkerRefused is emitted when the worker speaks the protocol
+	// not supported by the backend.
+	EventWorkerRefused = "worker_refused"
+	// EventWorkerExited is emitted when the worker process exits.
+	EventWorkerExited = "worker_exited"
+	// EventWorkerLost is emitted when the worker is removed from the
+	// registry, without reports for a while.
+	EventWorkerLost = "worker_lost"
+
+	// EventMaintenance is emitted when the maintenance mode is enabled,
+	// or disabled.
+	EventMaintenance = "maintenance"
+)
+
+// Events lists all event types, to validate the routes.
+var Events = []string{
+	EventNoHealthyWorkers,
+	EventWorkersRecovered,
+	EventJobFailed,
+	EventJobDeadLettered,
+	EventWorkerRegistered,
+	EventWorkerRefused,
+	EventWorkerExited,
+	EventWorkerLost,
+	EventMaintenance,
+}
+
+// Event is the notification event.
+type Event struct {
+	Type    string    `json:"type"`
+	Bucket  string    `json:"bucket,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+
+	// RequestID is the request ID of the job events.
+	RequestID string `json:"request_id,omitempty"`
+	// Worker is the worker ID of the worker events.
+	Worker string `json:"worker,omitempty"`
+}
+
+// Sink receives notification events.
+type Sink interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// SinkFunc is the function that implements Sink.
+type SinkFunc func(ctx context.Context, ev Event) error
+
+// Notify calls f(ctx, ev).
+func (f SinkFunc) Notify(ctx context.Context, ev Event) error { return f(ctx, ev) }
+
+// LogSink logs the events.
+type LogSink struct{}
+
+// Notify logs the event as warning.
+func (LogSink) Notify(ctx context.Context, ev Event) error {
+	glog.Warningf("[notify %s] %s (bucket %q)", ev.Type, ev.Message, ev.Bucket)
+	return nil
+}
+
+// WebhookSink posts the events in JSON to the URL (e.g. Slack incoming webhook
+// compatible endpoint, with "text" field).
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the event.
+func (s *WebhookSink) Notify(ctx context.Context, ev Event) error {
+	data, err := json.Marshal(struct {
+		Event
+		Text string `json:"text"`
+	}{ev, fmt.Sprintf("[%s] %s", ev.Type, ev.Message)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	cli := s.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%q returned %q (%s)", s.URL, resp.Status, string(b))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// Multi sends the events to all sinks, returning the first error.
+type Multi []Sink
+
+// Notify sends the event to all sinks.
+func (m Multi) Notify(ctx context.Context, ev Event) error {
+	var first error
+	for _, s := range m {
+		if err := s.Notify(ctx, ev); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var got map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer ts.Close()
+
+	s := Multi{LogSink{}, &WebhookSink{URL: ts.URL}}
+	ev := Event{Type: EventNoHealthyWorkers, Bucket: "/cats-request", Message: "no healthy worker", Time: time.Now()}
+	if err := s.Notify(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if got["type"] != EventNoHealthyWorkers || got["bucket"] != "/cats-request" || got["text"] != "[no_healthy_workers] no healthy worker" {
+		t.Fatalf("unexpected webhook body %+v", got)
+	}
+}
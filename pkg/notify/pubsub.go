@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gyuho/dplearn/pkg/gcp"
+)
+
+// PubSubSink publishes the events in JSON to the Pub/Sub topic, with the
+// type and bucket attributes to filter subscriptions.
+type PubSubSink struct {
+	Topic *gcp.Topic
+}
+
+// Notify publishes the event.
+func (s *PubSubSink) Notify(ctx context.Context, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = s.Topic.Publish(ctx, gcp.PubSubMessage{
+		Data:       data,
+		Attributes: map[string]string{"type": ev.Type, "bucket": ev.Bucket},
+	})
+	return err
+}
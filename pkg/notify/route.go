@@ -0,0 +1,243 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/gyuho/dplearn/pkg/gcp"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Sink types of the configuration.
+const (
+	SinkLog     = "log"
+	SinkWebhook = "webhook"
+	SinkSlack   = "slack"
+	SinkEmail   = "email"
+	SinkPubSub  = "pubsub"
+)
+
+// SinkConfig configures the sink by type. The URL and password may be
+// the secret references (e.g. "env:SLACK_WEBHOOK"), resolved on build.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+
+	// URL is the webhook URL of "webhook" and "slack" sinks.
+	URL string `yaml:"url"`
+	// Channel and Username override the Slack webhook defaults.
+	Channel  string `yaml:"channel"`
+	Username string `yaml:"username"`
+
+	// SMTP settings of "email" sinks.
+	SMTPAddr string   `yaml:"smtp-addr"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Password string   `yaml:"password"`
+
+	// Topic is the Pub/Sub topic of "pubsub" sinks,
+	// as 'topic' or 'project/topic'.
+	Topic string `yaml:"topic"`
+}
+
+// Route sends the events of the types to the sinks by name.
+// "*" matches all event types.
+type Route struct {
+	Events []string `yaml:"events"`
+	Sinks  []string `yaml:"sinks"`
+}
+
+// Config is the routing table of the events to the named sinks.
+//
+//	sinks:
+//	  ops:
+//	    type: slack
+//	    url: env:SLACK_WEBHOOK
+//	  all:
+//	    type: log
+//	routes:
+//	- events: [no_healthy_workers, job_dead_lettered]
+//	  sinks: [ops]
+//	- events: ["*"]
+//	  sinks: [all]
+type Config struct {
+	Sinks  map[string]SinkConfig `yaml:"sinks"`
+	Routes []Route               `yaml:"routes"`
+}
+
+// ReadConfig reads the routing table from the YAML file, and validates it.
+func ReadConfig(p string) (Config, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err = yaml.UnmarshalStrict(bts, &cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid notifications %q (%v)", p, err)
+	}
+	if err = cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid notifications %q (%v)", p, err)
+	}
+	return cfg, nil
+}
+
+// Validate returns an error if the sinks are missing the settings of their
+// types, or the routes refer to unknown event types or sinks.
+func (cfg Config) Validate() error {
+	for name, sc := range cfg.Sinks {
+		var missing string
+		switch sc.Type {
+		case SinkLog:
+		case SinkWebhook, SinkSlack:
+			if sc.URL == "" {
+				missing = "url"
+			}
+		case SinkEmail:
+			switch {
+			case sc.SMTPAddr == "":
+				missing = "smtp-addr"
+			case sc.From == "":
+				missing = "from"
+			case len(sc.To) == 0:
+				missing = "to"
+			}
+		case SinkPubSub:
+			if sc.Topic == "" {
+				missing = "topic"
+			}
+		default:
+			return fmt.Errorf("sink %q has unknown type %q", name, sc.Type)
+		}
+		if missing != "" {
+			return fmt.Errorf("%s sink %q has no %q", sc.Type, name, missing)
+		}
+	}
+	known := make(map[string]bool, len(Events))
+	for _, typ := range Events {
+		known[typ] = true
+	}
+	for i, r := range cfg.Routes {
+		if len(r.Events) == 0 || len(r.Sinks) == 0 {
+			return fmt.Errorf("route #%d has no events or sinks", i)
+		}
+		for _, typ := range r.Events {
+			if typ != "*" && !known[typ] {
+				return fmt.Errorf("route #%d has unknown event type %q (expected one of %s)", i, typ, strings.Join(Events, ", "))
+			}
+		}
+		for _, name := range r.Sinks {
+			if _, ok := cfg.Sinks[name]; !ok {
+				return fmt.Errorf("route #%d has unknown sink %q", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+// SecretResolver resolves the secret references (e.g. "env:SLACK_WEBHOOK").
+type SecretResolver interface {
+	Value(ctx context.Context, v string) (string, error)
+}
+
+// BuildOptions are the dependencies to build the sinks with.
+type BuildOptions struct {
+	// Secrets resolves the URLs and passwords, nil to use them as is.
+	Secrets SecretResolver
+	// GCPKey is the service account JSON key of "pubsub" sinks,
+	// empty to use the service account of the instance.
+	GCPKey []byte
+}
+
+// Build creates the router of the routing table.
+func (cfg Config) Build(ctx context.Context, opts BuildOptions) (*Router, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	resolve := func(v string) (string, error) {
+		if opts.Secrets == nil || v == "" {
+			return v, nil
+		}
+		return opts.Secrets.Value(ctx, v)
+	}
+
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+	for name, sc := range cfg.Sinks {
+		var err error
+		switch sc.Type {
+		case SinkLog:
+			sinks[name] = LogSink{}
+		case SinkWebhook:
+			s := &WebhookSink{}
+			s.URL, err = resolve(sc.URL)
+			sinks[name] = s
+		case SinkSlack:
+			s := &SlackSink{Channel: sc.Channel, Username: sc.Username}
+			s.URL, err = resolve(sc.URL)
+			sinks[name] = s
+		case SinkEmail:
+			s := &EmailSink{Addr: sc.SMTPAddr, From: sc.From, To: sc.To}
+			if sc.Password != "" {
+				s.Username = sc.From
+				s.Password, err = resolve(sc.Password)
+			}
+			sinks[name] = s
+		case SinkPubSub:
+			project, topic := "", sc.Topic
+			if ss := strings.SplitN(topic, "/", 2); len(ss) == 2 {
+				project, topic = ss[0], ss[1]
+			}
+			var t *gcp.Topic
+			t, err = gcp.NewTopic(ctx, project, topic, opts.GCPKey)
+			sinks[name] = &PubSubSink{Topic: t}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %v", name, err)
+		}
+	}
+
+	rt := &Router{routes: make(map[string][]string), sinks: sinks}
+	for _, r := range cfg.Routes {
+		for _, typ := range r.Events {
+			rt.routes[typ] = append(rt.routes[typ], r.Sinks...)
+		}
+	}
+	return rt, nil
+}
+
+// Router sends the events to the sinks of their routes.
+// The events without routes are dropped.
+type Router struct {
+	// routes maps the event types to the sink names, "*" for all types.
+	routes map[string][]string
+	sinks  map[string]Sink
+}
+
+// Sinks returns the names of the sinks that receive the event type,
+// sorted and without duplicates.
+func (rt *Router) Sinks(typ string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(append([]string{}, rt.routes[typ]...), rt.routes["*"]...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Notify sends the event to the sinks of its routes, once per sink,
+// returning the first error.
+func (rt *Router) Notify(ctx context.Context, ev Event) error {
+	var first error
+	for _, name := range rt.Sinks(ev.Type) {
+		if err := rt.sinks[name].Notify(ctx, ev); err != nil && first == nil {
+			first = fmt.Errorf("sink %q: %v", name, err)
+		}
+	}
+	return first
+}
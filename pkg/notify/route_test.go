@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tt := range []struct {
+		yaml string
+		err  string
+	}{
+		{"sinks:\n  ops: {type: slack, url: 'http://hook'}\nroutes:\n- events: [job_failed]\n  sinks: [ops]\n", ""},
+		{"sinks:\n  ops: {type: sms}\n", `unknown type "sms"`},
+		{"sinks:\n  ops: {type: email, smtp-addr: 'localhost:25', from: a@b.c}\n", `has no "to"`},
+		{"sinks:\n  ops: {type: log}\nroutes:\n- events: [job_done]\n  sinks: [ops]\n", `unknown event type "job_done"`},
+		{"sinks:\n  ops: {type: log}\nroutes:\n- events: ['*']\n  sinks: [oncall]\n", `unknown sink "oncall"`},
+		{"sinks:\n  ops: {type: log, urls: x}\n", "not found"},
+	} {
+		p := filepath.Join(dir, fmt.Sprintf("%d.yaml", i))
+		if err = ioutil.WriteFile(p, []byte(tt.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadConfig(p)
+		if (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("#%d: expected error %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+type secretsFunc func(ctx context.Context, v string) (string, error)
+
+func (f secretsFunc) Value(ctx context.Context, v string) (string, error) { return f(ctx, v) }
+
+func TestRouter(t *testing.T) {
+	var posts []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var got map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, got)
+	}))
+	defer ts.Close()
+
+	var mails []string
+	old := sendMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mails = append(mails, string(msg))
+		return nil
+	}
+	defer func() { sendMail = old }()
+
+	cfg := Config{
+		Sinks: map[string]SinkConfig{
+			"ops":    {Type: SinkSlack, URL: "env:SLACK_WEBHOOK", Channel: "#ops"},
+			"oncall": {Type: SinkEmail, SMTPAddr: "localhost:25", From: "dplearn@example.com", To: []string{"oncall@example.com"}},
+			"all":    {Type: SinkLog},
+		},
+		Routes: []Route{
+			{Events: []string{EventNoHealthyWorkers, EventJobDeadLettered}, Sinks: []string{"ops", "oncall"}},
+			{Events: []string{EventJobDeadLettered}, Sinks: []string{"ops"}},
+			{Events: []string{"*"}, Sinks: []string{"all"}},
+		},
+	}
+	rt, err := cfg.Build(context.Background(), BuildOptions{Secrets: secretsFunc(func(ctx context.Context, v string) (string, error) {
+		if v == "env:SLACK_WEBHOOK" {
+			return ts.URL, nil
+		}
+		return v, nil
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss := rt.Sinks(EventJobDeadLettered); !reflect.DeepEqual(ss, []string{"all", "oncall", "ops"}) {
+		t.Fatalf("unexpected sinks %q", ss)
+	}
+	if ss := rt.Sinks(EventWorkerRegistered); !reflect.DeepEqual(ss, []string{"all"}) {
+		t.Fatalf("unexpected sinks %q", ss)
+	}
+
+	ev := Event{Type: EventJobDeadLettered, Bucket: "/cats-request", RequestID: "req-1", Message: "moved after 3 attempts", Time: time.Now()}
+	if err = rt.Notify(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if err = rt.Notify(context.Background(), Event{Type: EventWorkerRegistered, Worker: "w1", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// sent once per sink, even if routed twice
+	if len(posts) != 1 || posts[0]["channel"] != "#ops" {
+		t.Fatalf("unexpected slack posts %+v", posts)
+	}
+	att := posts[0]["attachments"].([]interface{})[0].(map[string]interface{})
+	if att["color"] != "danger" || att["title"] != EventJobDeadLettered || len(att["fields"].([]interface{})) != 2 {
+		t.Fatalf("unexpected attachment %+v", att)
+	}
+	if len(mails) != 1 || !strings.Contains(mails[0], "Subject: [dplearn] job_dead_lettered: moved after 3 attempts\r\n") || !strings.Contains(mails[0], "Request ID: req-1\r\n") {
+		t.Fatalf("unexpected mails %q", mails)
+	}
+}
+
+func TestPubSubSink(t *testing.T) {
+	var attrs map[string]string
+	var data []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var preq struct {
+			Messages []struct {
+				Data       string            `json:"data"`
+				Attributes map[string]string `json:"attributes"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&preq); err != nil {
+			t.Fatal(err)
+		}
+		attrs = preq.Messages[0].Attributes
+		data, _ = base64.StdEncoding.DecodeString(preq.Messages[0].Data)
+		json.NewEncoder(w).Encode(map[string][]string{"messageIds": {"1"}})
+	}))
+	defer ts.Close()
+
+	old := os.Getenv("PUBSUB_EMULATOR_HOST")
+	os.Setenv("PUBSUB_EMULATOR_HOST", strings.TrimPrefix(ts.URL, "http://"))
+	defer os.Setenv("PUBSUB_EMULATOR_HOST", old)
+
+	rt, err := Config{
+		Sinks:  map[string]SinkConfig{"events": {Type: SinkPubSub, Topic: "test/alerts"}},
+		Routes: []Route{{Events: []string{"*"}, Sinks: []string{"events"}}},
+	}.Build(context.Background(), BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rt.Notify(context.Background(), Event{Type: EventWorkerLost, Worker: "w1", Message: "no report", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	var ev Event
+	if err = json.Unmarshal(data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if attrs["type"] != EventWorkerLost || ev.Worker != "w1" {
+		t.Fatalf("unexpected message %+v %+v", attrs, ev)
+	}
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// slackColors are the attachment colors of the events,
+// "warning" for the events not listed.
+var slackColors = map[string]string{
+	EventNoHealthyWorkers: "danger",
+	EventJobDeadLettered:  "danger",
+	EventWorkerLost:       "danger",
+	EventWorkersRecovered: "good",
+	EventWorkerRegistered: "good",
+}
+
+// SlackSink posts the events to the Slack incoming webhook,
+// as the attachments colored by the event type.
+type SlackSink struct {
+	URL string
+	// Channel overrides the channel of the webhook, if not empty.
+	Channel string
+	// Username overrides the name of the webhook, if not empty.
+	Username string
+	Client   *http.Client
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Ts       int64        `json:"ts"`
+}
+
+// Notify posts the event.
+func (s *SlackSink) Notify(ctx context.Context, ev Event) error {
+	color, ok := slackColors[ev.Type]
+	if !ok {
+		color = "warning"
+	}
+	att := slackAttachment{
+		Fallback: fmt.Sprintf("[%s] %s", ev.Type, ev.Message),
+		Color:    color,
+		Title:    ev.Type,
+		Text:     ev.Message,
+		Ts:       ev.Time.Unix(),
+	}
+	for _, f := range []slackField{
+		{Title: "Bucket", Value: ev.Bucket, Short: true},
+		{Title: "Worker", Value: ev.Worker, Short: true},
+		{Title: "Request ID", Value: ev.RequestID},
+	} {
+		if f.Value != "" {
+			att.Fields = append(att.Fields, f)
+		}
+	}
+	data, err := json.Marshal(struct {
+		Channel     string            `json:"channel,omitempty"`
+		Username    string            `json:"username,omitempty"`
+		Attachments []slackAttachment `json:"attachments"`
+	}{s.Channel, s.Username, []slackAttachment{att}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	cli := s.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		// do not log the webhook URL, which is the credential
+		return fmt.Errorf("slack webhook returned %q (%s)", resp.Status, string(b))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"text/template"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RetryPolicy defines the attempts of the failed step.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of the step, before the
+	// step fails the pipeline. Defaults to 1 (no retry).
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max-attempts"`
+	// Backoff is the delay before each retry (e.g. "30s").
+	Backoff string `json:"backoff,omitempty" yaml:"backoff"`
+}
+
+// Step defines the job of the pipeline.
+type Step struct {
+	Name string `json:"name" yaml:"name"`
+	// Bucket is the queue bucket of the job (e.g. "/cats-request").
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// JobType is the job type for the worker capabilities (e.g. "cats-vs-dogs").
+	JobType string `json:"job_type,omitempty" yaml:"job-type"`
+	// DependsOn lists the steps to complete before the step.
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends-on"`
+	// Value is the Go text/template of the job value, with '.Input' of the
+	// pipeline run and '.Outputs' of the dependencies by step name
+	// (e.g. '{{.Outputs.resize}}'). Defaults to the pipeline input.
+	Value string `json:"value,omitempty" yaml:"value"`
+	// Retry is the retry policy of the failed job.
+	Retry RetryPolicy `json:"retry,omitempty" yaml:"retry"`
+}
+
+// Definition is the declarative pipeline definition.
+type Definition struct {
+	Name  string `json:"name" yaml:"name"`
+	Steps []Step `json:"steps" yaml:"steps"`
+}
+
+// Validate returns the error if the definition is invalid: empty or
+// duplicate step names, unknown or cyclic dependencies, invalid value
+// templates, or retry policies.
+func (d Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("pipeline: empty pipeline name")
+	}
+	if len(d.Steps) == 0 {
+		return fmt.Errorf("pipeline %q: no steps", d.Name)
+	}
+	steps := make(map[string]Step, len(d.Steps))
+	for _, s := range d.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("pipeline %q: empty step name", d.Name)
+		}
+		if _, ok := steps[s.Name]; ok {
+			return fmt.Errorf("pipeline %q: duplicate step %q", d.Name, s.Name)
+		}
+		if s.Bucket == "" {
+			return fmt.Errorf("pipeline %q: step %q has no bucket", d.Name, s.Name)
+		}
+		if _, err := template.New(s.Name).Option("missingkey=error").Parse(s.Value); err != nil {
+			return fmt.Errorf("pipeline %q: step %q has invalid value (%v)", d.Name, s.Name, err)
+		}
+		if s.Retry.MaxAttempts < 0 {
+			return fmt.Errorf("pipeline %q: step %q has negative max-attempts %d", d.Name, s.Name, s.Retry.MaxAttempts)
+		}
+		if s.Retry.Backoff != "" {
+			if b, err := time.ParseDuration(s.Retry.Backoff); err != nil || b < 0 {
+				return fmt.Errorf("pipeline %q: step %q has invalid backoff %q", d.Name, s.Name, s.Retry.Backoff)
+			}
+		}
+		steps[s.Name] = s
+	}
+	for _, s := range d.Steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("pipeline %q: step %q depends on unknown step %q", d.Name, s.Name, dep)
+			}
+		}
+	}
+
+	// depth-first search for the cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(steps))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("pipeline %q: cyclic dependency %q", d.Name, append(path, name))
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, dep := range steps[name].DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, s := range d.Steps {
+		if err := visit(s.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d Definition) step(name string) (Step, bool) {
+	for _, s := range d.Steps {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
+
+// ReadDefinitions reads the pipeline definitions from the YAML file:
+//
+//	pipelines:
+//	- name: cats
+//	  steps:
+//	  - name: resize
+//	    bucket: /resize-request
+//	  - name: classify
+//	    bucket: /cats-request
+//	    job-type: cats-vs-dogs
+//	    depends-on: [resize]
+//	    value: '{{.Outputs.resize}}'
+//	    retry:
+//	      max-attempts: 3
+//	      backoff: 10s
+func ReadDefinitions(p string) ([]Definition, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Pipelines []Definition `yaml:"pipelines"`
+	}
+	if err = yaml.UnmarshalStrict(bts, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid pipelines %q (%v)", p, err)
+	}
+	names := make(map[string]bool, len(cfg.Pipelines))
+	for _, d := range cfg.Pipelines {
+		if err = d.Validate(); err != nil {
+			return nil, err
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("duplicate pipeline %q in %q", d.Name, p)
+		}
+		names[d.Name] = true
+	}
+	return cfg.Pipelines, nil
+}
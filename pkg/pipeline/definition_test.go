@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		def Definition
+		err string
+	}{
+		{Definition{Name: "p", Steps: []Step{{Name: "a", Bucket: "/a"}, {Name: "b", Bucket: "/b", DependsOn: []string{"a"}}}}, ""},
+		{Definition{Steps: []Step{{Name: "a", Bucket: "/a"}}}, "empty pipeline name"},
+		{Definition{Name: "p"}, "no steps"},
+		{Definition{Name: "p", Steps: []Step{{Name: "a", Bucket: "/a"}, {Name: "a", Bucket: "/a"}}}, `duplicate step "a"`},
+		{Definition{Name: "p", Steps: []Step{{Name: "a"}}}, "has no bucket"},
+		{Definition{Name: "p", Steps: []Step{{Name: "a", Bucket: "/a", Value: "{{.Input"}}}, "invalid value"},
+		{Definition{Name: "p", Steps: []Step{{Name: "a", Bucket: "/a", Retry: RetryPolicy{Backoff: "soon"}}}}, "invalid backoff"},
+		{Definition{Name: "p", Steps: []Step{{Name: "a", Bucket: "/a", DependsOn: []string{"x"}}}}, `unknown step "x"`},
+		{Definition{Name: "p", Steps: []Step{
+			{Name: "a", Bucket: "/a", DependsOn: []string{"c"}},
+			{Name: "b", Bucket: "/b", DependsOn: []string{"a"}},
+			{Name: "c", Bucket: "/c", DependsOn: []string{"b"}},
+		}}, "cyclic dependency"},
+	}
+	for i, tt := range tests {
+		err := tt.def.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("#%d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("#%d: expected error %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestReadDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "pipelines.yaml")
+	if err = ioutil.WriteFile(p, []byte(`pipelines:
+- name: cats
+  steps:
+  - name: resize
+    bucket: /resize-request
+  - name: classify
+    bucket: /cats-request
+    job-type: cats-vs-dogs
+    depends-on: [resize]
+    value: '{{.Outputs.resize}}'
+    retry:
+      max-attempts: 3
+      backoff: 10s
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defs, err := ReadDefinitions(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || len(defs[0].Steps) != 2 {
+		t.Fatalf("unexpected definitions %+v", defs)
+	}
+	s := defs[0].Steps[1]
+	if s.JobType != "cats-vs-dogs" || s.DependsOn[0] != "resize" || s.Retry.MaxAttempts != 3 || s.Retry.Backoff != "10s" {
+		t.Fatalf("unexpected step %+v", s)
+	}
+
+	if err = ioutil.WriteFile(p, []byte("pipelines:\n- name: cats\n  stepz: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadDefinitions(p); err == nil {
+		t.Fatal("expected error on unknown field")
+	}
+}
@@ -0,0 +1,5 @@
+// Package pipeline defines multi-step pipelines over the queue: the steps
+// with their dependencies, buckets, job types, and retry policies, and the
+// state of each pipeline run, from which the steps are enqueued as their
+// dependencies complete.
+package pipeline
@@ -0,0 +1,233 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"text/template"
+	"time"
+)
+
+// Status of the pipeline runs, and of the steps.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+	// StatusSkipped is the step status when its dependency failed.
+	StatusSkipped = "skipped"
+)
+
+// StepState is the state of the step in the pipeline run.
+type StepState struct {
+	Status string `json:"status"`
+	// RequestID is the request ID of the current job of the step.
+	RequestID string `json:"request_id,omitempty"`
+	Attempts  int    `json:"attempts"`
+	// Output is the job value of the completed step.
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// RetryAt is the time to retry the failed step after the backoff.
+	RetryAt    time.Time `json:"retry_at,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// Run is the state of the pipeline run. Run is not safe for concurrent use.
+type Run struct {
+	ID         string                `json:"id"`
+	Definition Definition            `json:"definition"`
+	Input      string                `json:"input"`
+	User       string                `json:"user,omitempty"`
+	Status     string                `json:"status"`
+	Steps      map[string]*StepState `json:"steps"`
+	CreatedAt  time.Time             `json:"created_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+// NewRun returns the new run of the pipeline definition with the input,
+// with all steps pending, generating the ID if empty.
+func NewRun(id string, d Definition, input string) (*Run, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)[:8]
+	}
+	r := &Run{
+		ID:         id,
+		Definition: d,
+		Input:      input,
+		Status:     StatusRunning,
+		Steps:      make(map[string]*StepState, len(d.Steps)),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	for _, s := range d.Steps {
+		r.Steps[s.Name] = &StepState{Status: StatusPending}
+	}
+	return r, nil
+}
+
+// Done returns true if the run is completed, failed, or canceled.
+func (r *Run) Done() bool { return r.Status != StatusRunning }
+
+// Ready returns the pending steps whose dependencies are completed,
+// and whose retry backoff has passed, in the definition order.
+func (r *Run) Ready(now time.Time) []Step {
+	if r.Done() {
+		return nil
+	}
+	var ready []Step
+	for _, s := range r.Definition.Steps {
+		st := r.Steps[s.Name]
+		if st.Status != StatusPending || now.Before(st.RetryAt) {
+			continue
+		}
+		completed := true
+		for _, dep := range s.DependsOn {
+			if r.Steps[dep].Status != StatusCompleted {
+				completed = false
+				break
+			}
+		}
+		if completed {
+			ready = append(ready, s)
+		}
+	}
+	return ready
+}
+
+// Value returns the job value of the step, rendered with the input
+// of the run and the outputs of the dependencies.
+func (r *Run) Value(s Step) (string, error) {
+	if s.Value == "" {
+		return r.Input, nil
+	}
+	tmpl, err := template.New(s.Name).Option("missingkey=error").Parse(s.Value)
+	if err != nil {
+		return "", err
+	}
+	outputs := make(map[string]string, len(s.DependsOn))
+	for _, dep := range s.DependsOn {
+		outputs[dep] = r.Steps[dep].Output
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Input   string
+		Outputs map[string]string
+	}{r.Input, outputs})
+	return buf.String(), err
+}
+
+// Started marks the step running with the request ID of its job.
+func (r *Run) Started(name, requestID string, now time.Time) {
+	st := r.Steps[name]
+	st.Status, st.RequestID, st.Error = StatusRunning, requestID, ""
+	st.Attempts++
+	st.RetryAt = time.Time{}
+	if st.StartedAt.IsZero() {
+		st.StartedAt = now
+	}
+	r.UpdatedAt = now
+}
+
+// Finished records the result of the step: the output, or the error.
+// The failed step is retried after the backoff if it has attempts left,
+// or fails with its dependents skipped. Returns true if it is retried.
+func (r *Run) Finished(name, output, errMsg string, now time.Time) bool {
+	st, ok := r.Steps[name]
+	if !ok || r.Done() || (st.Status != StatusRunning && st.Status != StatusPending) {
+		return false
+	}
+	r.UpdatedAt = now
+	if errMsg == "" {
+		st.Status, st.Output, st.Error, st.FinishedAt = StatusCompleted, output, "", now
+		r.update(now)
+		return false
+	}
+
+	s, _ := r.Definition.step(name)
+	if st.Attempts < s.Retry.MaxAttempts {
+		backoff, _ := time.ParseDuration(s.Retry.Backoff)
+		st.Status, st.Error, st.RetryAt = StatusPending, errMsg, now.Add(backoff)
+		return true
+	}
+	st.Status, st.Error, st.FinishedAt = StatusFailed, errMsg, now
+	r.skipDependents(name, now)
+	r.update(now)
+	return false
+}
+
+// skipDependents skips the steps depending on the failed step,
+// transitively.
+func (r *Run) skipDependents(name string, now time.Time) {
+	for _, s := range r.Definition.Steps {
+		st := r.Steps[s.Name]
+		if st.Status != StatusPending {
+			continue
+		}
+		for _, dep := range s.DependsOn {
+			if dep == name {
+				st.Status, st.FinishedAt = StatusSkipped, now
+				r.skipDependents(s.Name, now)
+				break
+			}
+		}
+	}
+}
+
+// update completes the run once no steps are pending or running:
+// failed if any step failed, completed otherwise.
+func (r *Run) update(now time.Time) {
+	failed := false
+	for _, st := range r.Steps {
+		switch st.Status {
+		case StatusPending, StatusRunning:
+			return
+		case StatusFailed:
+			failed = true
+		}
+	}
+	r.Status = StatusCompleted
+	if failed {
+		r.Status = StatusFailed
+	}
+	r.UpdatedAt = now
+}
+
+// Cancel cancels the run, skipping the pending steps, and returns the
+// request IDs of the running steps to cancel.
+func (r *Run) Cancel(now time.Time) []string {
+	if r.Done() {
+		return nil
+	}
+	var running []string
+	for _, s := range r.Definition.Steps {
+		st := r.Steps[s.Name]
+		switch st.Status {
+		case StatusPending:
+			st.Status, st.FinishedAt = StatusSkipped, now
+		case StatusRunning:
+			st.Status, st.Error, st.FinishedAt = StatusCanceled, "pipeline canceled", now
+			running = append(running, st.RequestID)
+		}
+	}
+	r.Status, r.UpdatedAt = StatusCanceled, now
+	return running
+}
+
+// Clone returns the deep copy of the run, to read outside the lock.
+func (r *Run) Clone() Run {
+	c := *r
+	c.Steps = make(map[string]*StepState, len(r.Steps))
+	for name, st := range r.Steps {
+		copied := *st
+		c.Steps[name] = &copied
+	}
+	return c
+}
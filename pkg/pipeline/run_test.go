@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stepNames(steps []Step) []string {
+	var names []string
+	for _, s := range steps {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestRun(t *testing.T) {
+	def := Definition{Name: "cats", Steps: []Step{
+		{Name: "resize", Bucket: "/resize-request"},
+		{Name: "classify", Bucket: "/cats-request", DependsOn: []string{"resize"}, Value: "{{.Outputs.resize}}",
+			Retry: RetryPolicy{MaxAttempts: 2, Backoff: "10s"}},
+		{Name: "thumbnail", Bucket: "/thumbnail-request", DependsOn: []string{"resize"}},
+		{Name: "report", Bucket: "/report-request", DependsOn: []string{"classify", "thumbnail"}, Value: "{{.Input}}:{{.Outputs.classify}}"},
+	}}
+	r, err := NewRun("run-1", def, "cat.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	if names := stepNames(r.Ready(now)); !reflect.DeepEqual(names, []string{"resize"}) {
+		t.Fatalf("unexpected ready steps %q", names)
+	}
+	if v, err := r.Value(def.Steps[0]); err != nil || v != "cat.png" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+	r.Started("resize", "req-1", now)
+	if len(r.Ready(now)) != 0 {
+		t.Fatalf("unexpected ready steps while running")
+	}
+	r.Finished("resize", "small.png", "", now)
+	if names := stepNames(r.Ready(now)); !reflect.DeepEqual(names, []string{"classify", "thumbnail"}) {
+		t.Fatalf("unexpected ready steps %q", names)
+	}
+	if v, err := r.Value(def.Steps[1]); err != nil || v != "small.png" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+	r.Started("classify", "req-2", now)
+	r.Started("thumbnail", "req-3", now)
+	r.Finished("thumbnail", "thumb.png", "", now)
+
+	// failed step is retried after the backoff
+	if !r.Finished("classify", "", "out of memory", now) {
+		t.Fatal("expected retry")
+	}
+	if len(r.Ready(now)) != 0 {
+		t.Fatalf("unexpected ready steps before backoff")
+	}
+	now = now.Add(10 * time.Second)
+	if names := stepNames(r.Ready(now)); !reflect.DeepEqual(names, []string{"classify"}) {
+		t.Fatalf("unexpected ready steps %q", names)
+	}
+	r.Started("classify", "req-4", now)
+	r.Finished("classify", "cat", "", now)
+	if v, err := r.Value(def.Steps[3]); err != nil || v != "cat.png:cat" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+	r.Started("report", "req-5", now)
+	r.Finished("report", "ok", "", now)
+	if r.Status != StatusCompleted || r.Steps["classify"].Attempts != 2 {
+		t.Fatalf("unexpected run %+v", r)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	def := Definition{Name: "p", Steps: []Step{
+		{Name: "a", Bucket: "/a"},
+		{Name: "b", Bucket: "/b", DependsOn: []string{"a"}},
+		{Name: "c", Bucket: "/c", DependsOn: []string{"b"}},
+		{Name: "d", Bucket: "/d"},
+	}}
+	r, err := NewRun("run-1", def, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.Started("a", "req-a", now)
+	r.Started("d", "req-d", now)
+	if r.Finished("a", "", "failed", now) {
+		t.Fatal("unexpected retry")
+	}
+	if r.Steps["b"].Status != StatusSkipped || r.Steps["c"].Status != StatusSkipped {
+		t.Fatalf("expected dependents skipped, got %+v %+v", r.Steps["b"], r.Steps["c"])
+	}
+
+	// independent steps continue
+	if r.Status != StatusRunning {
+		t.Fatalf("expected %q, got %q", StatusRunning, r.Status)
+	}
+	r.Finished("d", "ok", "", now)
+	if r.Status != StatusFailed {
+		t.Fatalf("expected %q, got %q", StatusFailed, r.Status)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	def := Definition{Name: "p", Steps: []Step{
+		{Name: "a", Bucket: "/a"},
+		{Name: "b", Bucket: "/b", DependsOn: []string{"a"}},
+	}}
+	r, err := NewRun("run-1", def, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.Started("a", "req-a", now)
+	if ids := r.Cancel(now); !reflect.DeepEqual(ids, []string{"req-a"}) {
+		t.Fatalf("unexpected canceled requests %q", ids)
+	}
+	if r.Status != StatusCanceled || r.Steps["b"].Status != StatusSkipped {
+		t.Fatalf("unexpected run %+v", r)
+	}
+	// late results of the canceled steps are ignored
+	r.Finished("a", "ok", "", now)
+	if r.Steps["a"].Status != StatusCanceled || len(r.Ready(now)) != 0 {
+		t.Fatalf("unexpected step %+v", r.Steps["a"])
+	}
+}
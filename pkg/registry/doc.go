@@ -0,0 +1,5 @@
+// Package registry implements the model registry, with the model metadata
+// in etcd and the model artifacts in blob storage. Promoting a version to
+// "serving" is watched by the backend servers, from which workers reload
+// the model without swapping the files on the worker hosts.
+package registry
@@ -0,0 +1,320 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+)
+
+// ArtifactScheme is the URI scheme of the artifacts in the registry
+// blob store (e.g. "registry://cats/v2").
+const ArtifactScheme = "registry://"
+
+var (
+	// ErrNotFound is returned when the model version is not registered.
+	ErrNotFound = errors.New("registry: model not found")
+
+	// ErrExists is returned when the model version is already registered.
+	ErrExists = errors.New("registry: model version already exists")
+
+	// ErrInvalidModel is returned when the model name or version is not valid.
+	ErrInvalidModel = errors.New("registry: invalid model name or version")
+)
+
+// Model is the metadata of the model version.
+type Model struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Framework is the inference runtime of the model
+	// (e.g. "tensorflow", "onnx").
+	Framework string `json:"framework"`
+	// Metrics are the evaluation metrics (e.g. "accuracy").
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// ArtifactURI is the location of the model artifact, in the registry
+	// blob store ("registry://"), Cloud Storage ("gs://"), or on the
+	// worker hosts (local path).
+	ArtifactURI string    `json:"artifact_uri"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Config defines model registry configuration.
+type Config struct {
+	// Prefix is the etcd key prefix of the models, and serving versions.
+	// Defaults to "_registry".
+	Prefix string
+}
+
+// Registry stores the model versions, and keeps the serving versions
+// up to date on every server.
+type Registry struct {
+	cli   *clientv3.Client
+	store blobstore.Store
+	cfg   Config
+
+	mu      sync.RWMutex
+	serving map[string]Model
+	// changed is closed and replaced on every serving change.
+	changed chan struct{}
+}
+
+// New creates a new model registry, storing the artifacts in the blob store.
+func New(cli *clientv3.Client, store blobstore.Store, cfg Config) *Registry {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_registry"
+	}
+	return &Registry{
+		cli:     cli,
+		store:   store,
+		cfg:     cfg,
+		serving: make(map[string]Model),
+		changed: make(chan struct{}),
+	}
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validate(name, version string) error {
+	if len(name) > 256 || len(version) > 256 || !validName.MatchString(name) || !validName.MatchString(version) {
+		return ErrInvalidModel
+	}
+	return nil
+}
+
+func (r *Registry) modelsPrefix() string  { return path.Join(r.cfg.Prefix, "models") + "/" }
+func (r *Registry) servingPrefix() string { return path.Join(r.cfg.Prefix, "serving") + "/" }
+func (r *Registry) modelKey(name, version string) string {
+	return r.modelsPrefix() + name + "/" + version
+}
+func (r *Registry) servingKey(name string) string { return r.servingPrefix() + name }
+
+// artifactKey returns the blob key of the artifact, which cannot have '/'.
+func artifactKey(name, version string) string { return "model-" + name + "@" + version }
+
+// PutArtifact stores the artifact of the model version to be registered,
+// and returns its URI. It fails with 'ErrExists' if the version is already
+// registered, since registered versions are immutable.
+func (r *Registry) PutArtifact(ctx context.Context, name, version string, rd io.Reader) (string, error) {
+	if err := validate(name, version); err != nil {
+		return "", err
+	}
+	if _, err := r.Get(ctx, name, version); err == nil {
+		return "", ErrExists
+	} else if err != ErrNotFound {
+		return "", err
+	}
+	key := artifactKey(name, version)
+	if err := r.store.Delete(key); err != nil {
+		return "", err
+	}
+	n, err := r.store.Append(key, rd)
+	if err != nil {
+		return "", err
+	}
+	uri := ArtifactScheme + name + "/" + version
+	glog.Infof("stored model artifact %q (%d bytes)", uri, n)
+	return uri, nil
+}
+
+// OpenArtifact returns the reader of the artifact in the registry blob
+// store, or 'ErrNotFound'.
+func (r *Registry) OpenArtifact(uri string) (io.ReadCloser, error) {
+	ss := strings.Split(strings.TrimPrefix(uri, ArtifactScheme), "/")
+	if !strings.HasPrefix(uri, ArtifactScheme) || len(ss) != 2 || validate(ss[0], ss[1]) != nil {
+		return nil, fmt.Errorf("registry: invalid artifact URI %q", uri)
+	}
+	rc, err := r.store.Open(artifactKey(ss[0], ss[1]))
+	if err == blobstore.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return rc, err
+}
+
+// Register registers the model version. It fails with 'ErrExists'
+// if the version is already registered.
+func (r *Registry) Register(ctx context.Context, m Model) (Model, error) {
+	if err := validate(m.Name, m.Version); err != nil {
+		return m, err
+	}
+	if m.Framework == "" || m.ArtifactURI == "" {
+		return m, fmt.Errorf("registry: model %s/%s requires framework and artifact URI", m.Name, m.Version)
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return m, err
+	}
+	key := r.modelKey(m.Name, m.Version)
+	resp, err := r.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return m, err
+	}
+	if !resp.Succeeded {
+		return m, ErrExists
+	}
+	glog.Infof("registered model %s/%s (%s, %q)", m.Name, m.Version, m.Framework, m.ArtifactURI)
+	return m, nil
+}
+
+// Get returns the model version, or 'ErrNotFound'.
+func (r *Registry) Get(ctx context.Context, name, version string) (Model, error) {
+	if err := validate(name, version); err != nil {
+		return Model{}, err
+	}
+	resp, err := r.cli.Get(ctx, r.modelKey(name, version))
+	if err != nil {
+		return Model{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return Model{}, ErrNotFound
+	}
+	var m Model
+	err = json.Unmarshal(resp.Kvs[0].Value, &m)
+	return m, err
+}
+
+// List returns the versions of the model sorted by creation time,
+// or of all models if the name is empty.
+func (r *Registry) List(ctx context.Context, name string) ([]Model, error) {
+	prefix := r.modelsPrefix()
+	if name != "" {
+		prefix += name + "/"
+	}
+	resp, err := r.cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]Model, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var m Model
+		if err = json.Unmarshal(kv.Value, &m); err != nil {
+			glog.Warningf("model %q is invalid (%v)", string(kv.Key), err)
+			continue
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Name != ms[j].Name {
+			return ms[i].Name < ms[j].Name
+		}
+		return ms[i].CreatedAt.Before(ms[j].CreatedAt)
+	})
+	return ms, nil
+}
+
+// Promote promotes the model version to serving, which is reloaded
+// by the workers watching the model.
+func (r *Registry) Promote(ctx context.Context, name, version string) (Model, error) {
+	m, err := r.Get(ctx, name, version)
+	if err != nil {
+		return m, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return m, err
+	}
+	// the version could have been deleted by hand since
+	key := r.modelKey(name, version)
+	resp, err := r.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(r.servingKey(name), string(data))).
+		Commit()
+	if err != nil {
+		return m, err
+	}
+	if !resp.Succeeded {
+		return m, ErrNotFound
+	}
+	r.apply(r.servingKey(name), data)
+	glog.Infof("promoted model %s/%s to serving", name, version)
+	return m, nil
+}
+
+// Serving returns the serving versions of the models.
+func (r *Registry) Serving() map[string]Model {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ms := make(map[string]Model, len(r.serving))
+	for name, m := range r.serving {
+		ms[name] = m
+	}
+	return ms
+}
+
+// Wait returns the serving version of the model, once it is not 'version'
+// (empty to return any serving version), until the context is canceled.
+func (r *Registry) Wait(ctx context.Context, name, version string) (Model, error) {
+	for {
+		r.mu.RLock()
+		m, ok := r.serving[name]
+		changed := r.changed
+		r.mu.RUnlock()
+		if ok && m.Version != version {
+			return m, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Model{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Run keeps the serving versions up to date, until the context is canceled.
+func (r *Registry) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		resp, err := r.cli.Get(ctx, r.servingPrefix(), clientv3.WithPrefix())
+		if err != nil {
+			if ctx.Err() == nil {
+				glog.Warningf("registry failed to get serving models (%v)", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, kv := range resp.Kvs {
+			r.apply(string(kv.Key), kv.Value)
+		}
+		wch := r.cli.Watch(ctx, r.servingPrefix(), clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+		for wresp := range wch {
+			for _, ev := range wresp.Events {
+				if ev.Type == clientv3.EventTypePut {
+					r.apply(string(ev.Kv.Key), ev.Kv.Value)
+				}
+			}
+		}
+	}
+}
+
+func (r *Registry) apply(key string, val []byte) {
+	var m Model
+	if err := json.Unmarshal(val, &m); err != nil {
+		glog.Warningf("registry serving model %q is invalid (%v)", key, err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur, ok := r.serving[m.Name]; ok && cur.Version == m.Version {
+		return
+	}
+	r.serving[m.Name] = m
+	close(r.changed)
+	r.changed = make(chan struct{})
+	glog.Infof("serving model %s/%s", m.Name, m.Version)
+}
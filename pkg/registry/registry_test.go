@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/blobstore"
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestRegistry(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 25379, 25380, filepath.Join(dataDir, "etcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+	store, err := blobstore.NewLocal(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r1, r2 := New(qu.Client(), store, Config{}), New(qu.Client(), store, Config{})
+	go r2.Run(ctx)
+
+	uri, err := r1.PutArtifact(ctx, "cats", "v1", strings.NewReader("weights-v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "registry://cats/v1" {
+		t.Fatalf("artifact URI expected 'registry://cats/v1', got %q", uri)
+	}
+	m1 := Model{Name: "cats", Version: "v1", Framework: "onnx", Metrics: map[string]float64{"accuracy": 0.91}, ArtifactURI: uri}
+	if _, err = r1.Register(ctx, m1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r1.Register(ctx, m1); err != ErrExists {
+		t.Fatalf("expected %v, got %v", ErrExists, err)
+	}
+	if _, err = r1.PutArtifact(ctx, "cats", "v1", strings.NewReader("overwrite")); err != ErrExists {
+		t.Fatalf("expected %v, got %v", ErrExists, err)
+	}
+	if _, err = r1.Register(ctx, Model{Name: "cats/dogs", Version: "v1", Framework: "onnx", ArtifactURI: uri}); err != ErrInvalidModel {
+		t.Fatalf("expected %v, got %v", ErrInvalidModel, err)
+	}
+	if _, err = r1.Promote(ctx, "cats", "v2"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	rc, err := r1.OpenArtifact(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "weights-v1" {
+		t.Fatalf("artifact expected 'weights-v1', got %q", string(d))
+	}
+
+	if _, err = r1.Promote(ctx, "cats", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	wctx, wcancel := context.WithTimeout(ctx, 10*time.Second)
+	m, err := r2.Wait(wctx, "cats", "")
+	wcancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "v1" || m.Metrics["accuracy"] != 0.91 {
+		t.Fatalf("unexpected serving model %+v", m)
+	}
+
+	// workers waiting on the serving version get the next promotion
+	m2 := Model{Name: "cats", Version: "v2", Framework: "onnx", ArtifactURI: "gs://models/cats-v2.onnx"}
+	if _, err = r1.Register(ctx, m2); err != nil {
+		t.Fatal(err)
+	}
+	donec := make(chan Model)
+	go func() {
+		wctx, wcancel := context.WithTimeout(ctx, 10*time.Second)
+		defer wcancel()
+		m, _ := r2.Wait(wctx, "cats", "v1")
+		donec <- m
+	}()
+	if _, err = r1.Promote(ctx, "cats", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if m = <-donec; m.Version != "v2" {
+		t.Fatalf("serving version expected 'v2', got %+v", m)
+	}
+	if v := r2.Serving()["cats"].Version; v != "v2" {
+		t.Fatalf("serving version expected 'v2', got %q", v)
+	}
+
+	ms, err := r1.List(ctx, "cats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Version != "v1" || ms[1].Version != "v2" {
+		t.Fatalf("unexpected models %+v", ms)
+	}
+
+	wctx, wcancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	defer wcancel()
+	if _, err = r2.Wait(wctx, "cats", "v2"); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is the parsed cron expression of 5 fields: minute, hour, day of
+// month, month, and day of week. Fields are '*', values, ranges ('1-5'),
+// steps ('*/15', '0-30/10'), lists ('1,15'), and the names of months and
+// days ('jan', 'mon'). "@yearly", "@monthly", "@weekly", "@daily", and
+// "@hourly" are the shorthands. As in cron, if both the days of month and
+// the days of week are restricted, either matches.
+type Cron struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+	// domAll and dowAll are true if the field is '*'.
+	domAll, dowAll bool
+}
+
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCron parses the cron expression.
+func ParseCron(expr string) (Cron, error) {
+	c := Cron{expr: expr}
+	s := strings.TrimSpace(expr)
+	if sh, ok := cronShorthands[strings.ToLower(s)]; ok {
+		s = sh
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return c, fmt.Errorf("cron %q: minute %v", expr, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return c, fmt.Errorf("cron %q: hour %v", expr, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return c, fmt.Errorf("cron %q: day of month %v", expr, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return c, fmt.Errorf("cron %q: month %v", expr, err)
+	}
+	// 7 is Sunday as well
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return c, fmt.Errorf("cron %q: day of week %v", expr, err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAll, c.dowAll = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// parseCronField returns the bits of the values in the field.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			rng = part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			ss := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = value(ss[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(ss[1]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			}
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+	return bits, nil
+}
+
+// String returns the cron expression.
+func (c Cron) String() string { return c.expr }
+
+func (c Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAll || c.dowAll {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// cronHorizon is the limit of the search for the next time, after which
+// the expression never matches (e.g. "0 0 30 2 *").
+const cronHorizon = 5 * 366 * 24 * time.Hour
+
+// Next returns the first time after t (exclusive) that matches the
+// expression, in the location of t, or zero if none matches.
+func (c Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronHorizon)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// not truncated, for the locations offset by half hours
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	from := time.Date(2018, 1, 31, 10, 30, 15, 0, time.UTC) // Wednesday
+	for i, tt := range []struct {
+		expr string
+		next []string
+	}{
+		{"*/15 * * * *", []string{"2018-01-31T10:45:00Z", "2018-01-31T11:00:00Z"}},
+		{"0 2 * * *", []string{"2018-02-01T02:00:00Z", "2018-02-02T02:00:00Z"}},
+		{"@hourly", []string{"2018-01-31T11:00:00Z", "2018-01-31T12:00:00Z"}},
+		{"0 9 * * mon-fri", []string{"2018-02-01T09:00:00Z", "2018-02-02T09:00:00Z", "2018-02-05T09:00:00Z"}},
+		{"30 8 1 */3 *", []string{"2018-04-01T08:30:00Z", "2018-07-01T08:30:00Z"}},
+		{"0 0 29 feb *", []string{"2020-02-29T00:00:00Z"}},
+		// either day of month or day of week
+		{"0 12 15 * 7", []string{"2018-02-04T12:00:00Z", "2018-02-11T12:00:00Z", "2018-02-15T12:00:00Z"}},
+		{"0 0 30 2 *", []string{"0001-01-01T00:00:00Z"}},
+	} {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		next := from
+		for j, exp := range tt.next {
+			next = c.Next(next)
+			if got := next.Format(time.RFC3339); got != exp {
+				t.Fatalf("#%d-%d: %q expected %s, got %s", i, j, tt.expr, exp, got)
+			}
+		}
+	}
+
+	for i, tt := range []struct {
+		expr string
+		err  string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"60 * * * *", "out of range"},
+		{"* * * * 8", "out of range"},
+		{"*/0 * * * *", "invalid step"},
+		{"5-1 * * * *", "invalid range"},
+		{"* * * foo *", "out of range"},
+	} {
+		if _, err := ParseCron(tt.expr); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("#%d: %q expected error %q, got %v", i, tt.expr, tt.err, err)
+		}
+	}
+}
+
+func TestCronLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	c, err := ParseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := c.Next(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC).In(loc))
+	if next.Hour() != 9 || next.Minute() != 0 || next.Location() != loc {
+		t.Fatalf("unexpected next %s", next)
+	}
+}
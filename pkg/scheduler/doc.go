@@ -0,0 +1,5 @@
+// Package scheduler enqueues the jobs of the schedules when due: cron
+// expressions, one-shot times, and blackout windows to hold the jobs
+// (e.g. no training during demo hours). The schedules are persisted in
+// etcd, and a leader elected among the backend servers enqueues them.
+package scheduler
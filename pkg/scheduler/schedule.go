@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Window is the blackout window, in which the jobs are not enqueued.
+// It recurs on the cron expression for the duration, or is one-off
+// between the start and end.
+type Window struct {
+	Name string `json:"name,omitempty"`
+	// Cron starts the recurring window (e.g. "0 9 * * mon-fri"),
+	// in the timezone of the schedule.
+	Cron string `json:"cron,omitempty"`
+	// Duration is the length of the recurring window (e.g. "2h").
+	Duration string `json:"duration,omitempty"`
+	// Start and End bound the one-off window (end exclusive).
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+func (w Window) validate() error {
+	if w.Cron == "" {
+		if w.Start.IsZero() || !w.End.After(w.Start) {
+			return fmt.Errorf("window %q needs the cron and duration, or the start before the end", w.Name)
+		}
+		return nil
+	}
+	if _, err := ParseCron(w.Cron); err != nil {
+		return fmt.Errorf("window %q: %v", w.Name, err)
+	}
+	if d, err := time.ParseDuration(w.Duration); err != nil || d <= 0 {
+		return fmt.Errorf("window %q has invalid duration %q", w.Name, w.Duration)
+	}
+	return nil
+}
+
+// end returns the end of the window if t is in the window,
+// or false otherwise. The window must be valid.
+func (w Window) end(t time.Time) (time.Time, bool) {
+	if w.Cron == "" {
+		return w.End, !t.Before(w.Start) && t.Before(w.End)
+	}
+	c, _ := ParseCron(w.Cron)
+	d, _ := time.ParseDuration(w.Duration)
+	// the first start after 't-d' is the start of the window if not after t
+	start := c.Next(t.Add(-d))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	end := start.Add(d)
+	// the next windows may start before the end
+	for i := 0; i < 100; i++ {
+		next := c.Next(start)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		start, end = next, next.Add(d)
+	}
+	return end, true
+}
+
+// Schedule enqueues the job of the templated value on the cron
+// expression, and at the one-shot times, outside of the blackout windows.
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is the cron expression of the runs (see 'ParseCron').
+	Cron string `json:"cron,omitempty"`
+	// At are the one-shot times of the runs.
+	At []time.Time `json:"at,omitempty"`
+	// Timezone is the IANA timezone of the cron expressions
+	// (e.g. "America/Los_Angeles"). Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Blackouts are the windows to hold the runs in.
+	Blackouts []Window `json:"blackouts,omitempty"`
+	// DeferBlackout enqueues the run held by a blackout window at the end
+	// of the window, instead of skipping it.
+	DeferBlackout bool `json:"defer_blackout,omitempty"`
+
+	// Bucket is the queue bucket of the job (e.g. "/cats-request").
+	Bucket string `json:"bucket"`
+	// JobType is the job type for the worker capabilities.
+	JobType string `json:"job_type,omitempty"`
+	// Value is the Go text/template of the job value, with '.Name' of the
+	// schedule, '.Time' of the run, and '.Run' number from 1
+	// (e.g. 'gs://dplearn/train-{{.Time.Format "2006-01-02"}}').
+	Value string `json:"value"`
+	// User is the user to account the jobs of the runs to,
+	// empty if anonymous.
+	User string `json:"user,omitempty"`
+
+	// Paused holds the runs until resumed.
+	Paused bool `json:"paused,omitempty"`
+
+	// Next is the time of the next run, zero if none.
+	Next time.Time `json:"next,omitempty"`
+	// LastRun is the time of the last run, with the request ID of its job.
+	LastRun       time.Time `json:"last_run,omitempty"`
+	LastRequestID string    `json:"last_request_id,omitempty"`
+	// LastError is the error of the last run, empty if enqueued.
+	LastError string `json:"last_error,omitempty"`
+	// Runs and Skipped are the number of the runs enqueued,
+	// and skipped in the blackout windows.
+	Runs    int `json:"runs"`
+	Skipped int `json:"skipped"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate returns the error if the schedule has no name, bucket, or runs,
+// or has the invalid cron expressions, timezone, windows, or value.
+func (s Schedule) Validate() error {
+	if s.Name == "" || strings.Contains(s.Name, "/") {
+		return fmt.Errorf("scheduler: invalid schedule name %q", s.Name)
+	}
+	if s.Cron == "" && len(s.At) == 0 {
+		return fmt.Errorf("scheduler: schedule %q has no cron or at-times", s.Name)
+	}
+	if s.Cron != "" {
+		if _, err := ParseCron(s.Cron); err != nil {
+			return fmt.Errorf("scheduler: schedule %q: %v", s.Name, err)
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("scheduler: schedule %q has invalid timezone %q (%v)", s.Name, s.Timezone, err)
+	}
+	for _, w := range s.Blackouts {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("scheduler: schedule %q: %v", s.Name, err)
+		}
+	}
+	if s.Bucket == "" {
+		return fmt.Errorf("scheduler: schedule %q has no bucket", s.Name)
+	}
+	if _, err := template.New(s.Name).Option("missingkey=error").Parse(s.Value); err != nil {
+		return fmt.Errorf("scheduler: schedule %q has invalid value (%v)", s.Name, err)
+	}
+	return nil
+}
+
+func (s Schedule) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NextAfter returns the time of the first run after t (exclusive),
+// or zero if none.
+func (s Schedule) NextAfter(t time.Time) time.Time {
+	var next time.Time
+	if s.Cron != "" {
+		c, _ := ParseCron(s.Cron)
+		next = c.Next(t.In(s.location()))
+	}
+	for _, at := range s.At {
+		if at.After(t) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// Blackout returns the end of the blackout windows if t is in any.
+func (s Schedule) Blackout(t time.Time) (time.Time, bool) {
+	t = t.In(s.location())
+	var end time.Time
+	// the windows may overlap, so extend to the last end
+	// (bounded for the windows that never end)
+	for i := 0; i < 100; i++ {
+		extended := false
+		for _, w := range s.Blackouts {
+			at := t
+			if !end.IsZero() {
+				at = end
+			}
+			if e, ok := w.end(at); ok && e.After(end) {
+				end, extended = e, true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// Due returns true if the next run is due at now.
+func (s Schedule) Due(now time.Time) bool {
+	return !s.Paused && !s.Next.IsZero() && !s.Next.After(now)
+}
+
+// advance moves the due schedule to the next run, and returns the time
+// of the run to enqueue, or zero if held by a blackout window. The runs
+// missed while no server was leading are enqueued once.
+func (s *Schedule) advance(now time.Time) time.Time {
+	due := s.Next
+	if end, ok := s.Blackout(now); ok {
+		if s.DeferBlackout {
+			s.Next = end
+		} else {
+			s.Skipped++
+			s.Next = s.NextAfter(end.Add(-time.Nanosecond))
+		}
+		return time.Time{}
+	}
+	s.Next = s.NextAfter(now)
+	return due
+}
+
+// render returns the job value of the run.
+func (s Schedule) render(run time.Time) (string, error) {
+	tmpl, err := template.New(s.Name).Option("missingkey=error").Parse(s.Value)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Name string
+		Time time.Time
+		Run  int
+	}{s.Name, run.In(s.location()), s.Runs + 1})
+	return buf.String(), err
+}
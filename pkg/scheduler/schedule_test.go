@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	for i, tt := range []struct {
+		s   Schedule
+		err string
+	}{
+		{Schedule{Name: "nightly", Cron: "0 2 * * *", Bucket: "/train", Value: "{{.Time}}"}, ""},
+		{Schedule{Name: "a/b", Cron: "0 2 * * *", Bucket: "/train"}, "invalid schedule name"},
+		{Schedule{Name: "nightly", Bucket: "/train"}, "no cron or at-times"},
+		{Schedule{Name: "nightly", Cron: "0 2 * *", Bucket: "/train"}, "expected 5 fields"},
+		{Schedule{Name: "nightly", Cron: "0 2 * * *", Timezone: "Mars/Olympus", Bucket: "/train"}, "invalid timezone"},
+		{Schedule{Name: "nightly", Cron: "0 2 * * *", Bucket: "/train", Blackouts: []Window{{Name: "demo", Cron: "0 9 * * *"}}}, "invalid duration"},
+		{Schedule{Name: "nightly", Cron: "0 2 * * *", Bucket: "/train", Blackouts: []Window{{Name: "launch"}}}, "start before the end"},
+		{Schedule{Name: "nightly", Cron: "0 2 * * *"}, "no bucket"},
+		{Schedule{Name: "nightly", Cron: "0 2 * * *", Bucket: "/train", Value: "{{.Time"}, "invalid value"},
+	} {
+		err := tt.s.Validate()
+		if (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Fatalf("#%d: expected error %q, got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestScheduleAdvance(t *testing.T) {
+	at := time.Date(2018, 1, 1, 15, 30, 0, 0, time.UTC)
+	s := Schedule{
+		Name: "train",
+		Cron: "0 * * * *",
+		At:   []time.Time{at},
+		// demo hours, and the launch day afternoon
+		Blackouts: []Window{
+			{Name: "demo", Cron: "0 9 * * *", Duration: "2h"},
+			{Name: "launch", Start: time.Date(2018, 1, 1, 16, 0, 0, 0, time.UTC), End: time.Date(2018, 1, 1, 18, 0, 0, 0, time.UTC)},
+		},
+		Bucket: "/train",
+		Value:  `{{.Name}}-{{.Run}}-{{.Time.Format "15:04"}}`,
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, 1, 1, 8, 10, 0, 0, time.UTC)
+	s.Next = s.NextAfter(now)
+	if !s.Next.Equal(time.Date(2018, 1, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next %s", s.Next)
+	}
+
+	// runs in the demo hours are skipped
+	if run := s.advance(s.Next); !run.IsZero() || s.Skipped != 1 || !s.Next.Equal(time.Date(2018, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected skip to 11:00, got run %s next %s (skipped %d)", run, s.Next, s.Skipped)
+	}
+	if run := s.advance(s.Next); !run.Equal(time.Date(2018, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected run %s", run)
+	}
+	v, err := s.render(time.Date(2018, 1, 1, 11, 0, 0, 0, time.UTC))
+	if err != nil || v != "train-1-11:00" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+
+	// missed runs are enqueued once
+	now = time.Date(2018, 1, 1, 15, 10, 0, 0, time.UTC)
+	if run := s.advance(now); !run.Equal(time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)) || !s.Next.Equal(at) {
+		t.Fatalf("unexpected run %s next %s", run, s.Next)
+	}
+	// one-shot time
+	if run := s.advance(at); !run.Equal(at) || !s.Next.Equal(time.Date(2018, 1, 1, 16, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected run %s next %s", run, s.Next)
+	}
+
+	// deferred to the end of the launch window
+	s.DeferBlackout = true
+	if run := s.advance(s.Next); !run.IsZero() || !s.Next.Equal(time.Date(2018, 1, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected defer to 18:00, got run %s next %s", run, s.Next)
+	}
+	if run := s.advance(s.Next); !run.Equal(time.Date(2018, 1, 1, 18, 0, 0, 0, time.UTC)) || !s.Next.Equal(time.Date(2018, 1, 1, 19, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected run %s next %s", run, s.Next)
+	}
+}
+
+func TestScheduleTimezone(t *testing.T) {
+	s := Schedule{Name: "train", Cron: "0 2 * * *", Timezone: "America/New_York", Bucket: "/train"}
+	if err := s.Validate(); err != nil {
+		t.Skip(err)
+	}
+	next := s.NextAfter(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2018, 1, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next %s", next.UTC())
+	}
+}
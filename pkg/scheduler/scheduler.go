@@ -0,0 +1,357 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/golang/glog"
+)
+
+// ErrNotFound is returned when the schedule is not found.
+var ErrNotFound = errors.New("scheduler: schedule not found")
+
+var errNotLeader = errors.New("scheduler: not the leader")
+
+// Config defines scheduler configuration.
+type Config struct {
+	// Name identifies the server in the election (e.g. "backend-1:2200").
+	Name string
+	// Prefix is the etcd key prefix of the election and schedules.
+	// Defaults to "_scheduler".
+	Prefix string
+	// Interval is the interval to check the due schedules.
+	// Defaults to 10 seconds.
+	Interval time.Duration
+	// TTL is the leader lease TTL, after which other servers take over
+	// when the leader is gone. Defaults to 10 seconds.
+	TTL time.Duration
+
+	// Enqueue adds the job of the run to the queue.
+	Enqueue func(ctx context.Context, item *queue.Item) error
+}
+
+// Scheduler stores the schedules, and enqueues the due runs while
+// leading. The runs are recorded before enqueued, so that a new leader
+// does not enqueue them again.
+type Scheduler struct {
+	cli *clientv3.Client
+	cfg Config
+
+	mu      sync.RWMutex
+	leading bool
+}
+
+// New creates a new scheduler.
+func New(cli *clientv3.Client, cfg Config) *Scheduler {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_scheduler"
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 10 * time.Second
+	}
+	return &Scheduler{cli: cli, cfg: cfg}
+}
+
+func (s *Scheduler) electionKey() string         { return path.Join(s.cfg.Prefix, "election") }
+func (s *Scheduler) schedulesPrefix() string     { return path.Join(s.cfg.Prefix, "schedules") + "/" }
+func (s *Scheduler) scheduleKey(n string) string { return s.schedulesPrefix() + n }
+
+// Leading returns true if the server is the leader.
+func (s *Scheduler) Leading() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leading
+}
+
+func (s *Scheduler) setLeading(leading bool) {
+	s.mu.Lock()
+	s.leading = leading
+	s.mu.Unlock()
+}
+
+// Put creates or replaces the schedule, keeping the run history of the
+// existing schedule, and computes the next run after now.
+func (s *Scheduler) Put(ctx context.Context, sc Schedule, now time.Time) (Schedule, error) {
+	if err := sc.Validate(); err != nil {
+		return sc, err
+	}
+	for {
+		cur, rev, err := s.get(ctx, sc.Name)
+		if err != nil && err != ErrNotFound {
+			return sc, err
+		}
+		if err == ErrNotFound {
+			sc.CreatedAt = now
+			sc.LastRun, sc.LastRequestID, sc.LastError, sc.Runs, sc.Skipped = time.Time{}, "", "", 0, 0
+		} else {
+			sc.CreatedAt = cur.CreatedAt
+			sc.LastRun, sc.LastRequestID, sc.LastError, sc.Runs, sc.Skipped = cur.LastRun, cur.LastRequestID, cur.LastError, cur.Runs, cur.Skipped
+		}
+		sc.Next, sc.UpdatedAt = sc.NextAfter(now), now
+		ok, err := s.commit(ctx, sc, rev, nil)
+		if err != nil {
+			return sc, err
+		}
+		if ok {
+			glog.Infof("put schedule %q (next %s)", sc.Name, sc.Next)
+			return sc, nil
+		}
+	}
+}
+
+// SetPaused pauses or resumes the schedule. Resumed schedules skip
+// the runs missed while paused.
+func (s *Scheduler) SetPaused(ctx context.Context, name string, paused bool, now time.Time) (Schedule, error) {
+	for {
+		sc, rev, err := s.get(ctx, name)
+		if err != nil {
+			return sc, err
+		}
+		if sc.Paused == paused {
+			return sc, nil
+		}
+		sc.Paused, sc.UpdatedAt = paused, now
+		if !paused {
+			sc.Next = sc.NextAfter(now)
+		}
+		ok, err := s.commit(ctx, sc, rev, nil)
+		if err != nil {
+			return sc, err
+		}
+		if ok {
+			glog.Infof("schedule %q paused %v", name, paused)
+			return sc, nil
+		}
+	}
+}
+
+// Get returns the schedule.
+func (s *Scheduler) Get(ctx context.Context, name string) (Schedule, error) {
+	sc, _, err := s.get(ctx, name)
+	return sc, err
+}
+
+func (s *Scheduler) get(ctx context.Context, name string) (Schedule, int64, error) {
+	resp, err := s.cli.Get(ctx, s.scheduleKey(name))
+	if err != nil {
+		return Schedule{}, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return Schedule{}, 0, ErrNotFound
+	}
+	var sc Schedule
+	if err = json.Unmarshal(resp.Kvs[0].Value, &sc); err != nil {
+		return Schedule{}, 0, err
+	}
+	return sc, resp.Kvs[0].ModRevision, nil
+}
+
+// List returns the schedules, sorted by name.
+func (s *Scheduler) List(ctx context.Context) ([]Schedule, error) {
+	scs, _, err := s.list(ctx)
+	return scs, err
+}
+
+func (s *Scheduler) list(ctx context.Context) ([]Schedule, []int64, error) {
+	resp, err := s.cli.Get(ctx, s.schedulesPrefix(), clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, nil, err
+	}
+	scs, revs := make([]Schedule, 0, len(resp.Kvs)), make([]int64, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var sc Schedule
+		if err = json.Unmarshal(kv.Value, &sc); err != nil {
+			glog.Warningf("invalid schedule %q (%v)", string(kv.Key), err)
+			continue
+		}
+		scs, revs = append(scs, sc), append(revs, kv.ModRevision)
+	}
+	return scs, revs, nil
+}
+
+// Delete deletes the schedule.
+func (s *Scheduler) Delete(ctx context.Context, name string) error {
+	resp, err := s.cli.Delete(ctx, s.scheduleKey(name))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return ErrNotFound
+	}
+	glog.Infof("deleted schedule %q", name)
+	return nil
+}
+
+// commit stores the schedule if not modified since the revision (zero
+// to create), and if the election is not nil, only while leading.
+func (s *Scheduler) commit(ctx context.Context, sc Schedule, rev int64, e *concurrency.Election) (bool, error) {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return false, err
+	}
+	key := s.scheduleKey(sc.Name)
+	cmps := []clientv3.Cmp{clientv3.Compare(clientv3.ModRevision(key), "=", rev)}
+	if e != nil {
+		cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(e.Key()), "=", e.Rev()))
+	}
+	resp, err := s.cli.Txn(ctx).If(cmps...).Then(clientv3.OpPut(key, string(data))).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// Run campaigns for the leadership, and enqueues the due runs while
+// leading, until the context is canceled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		err := s.lead(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		glog.Warningf("scheduler %q lost leadership (%v); campaigning again in %v", s.cfg.Name, err, s.cfg.Interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.cfg.Interval):
+		}
+	}
+}
+
+// lead campaigns for the leadership, and enqueues the due runs
+// every interval until the leadership is lost.
+func (s *Scheduler) lead(ctx context.Context) error {
+	sess, err := concurrency.NewSession(s.cli, concurrency.WithTTL(int(s.cfg.TTL.Seconds())), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	e := concurrency.NewElection(sess, s.electionKey())
+	if err = e.Campaign(ctx, s.cfg.Name); err != nil {
+		return err
+	}
+	glog.Infof("scheduler %q elected as leader", s.cfg.Name)
+	s.setLeading(true)
+	defer s.setLeading(false)
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err = s.fire(ctx, e, time.Now()); err == errNotLeader {
+			return err
+		} else if err != nil && ctx.Err() == nil {
+			glog.Warningf("scheduler failed to check schedules (%v)", err)
+		}
+		select {
+		case <-ctx.Done():
+			// let other servers take over without waiting for the lease
+			rctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			e.Resign(rctx)
+			cancel()
+			return ctx.Err()
+		case <-sess.Done():
+			return errors.New("session expired")
+		case <-ticker.C:
+		}
+	}
+}
+
+// fire advances the due schedules, and enqueues their runs.
+func (s *Scheduler) fire(ctx context.Context, e *concurrency.Election, now time.Time) error {
+	scs, revs, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	for i, sc := range scs {
+		if !sc.Due(now) {
+			continue
+		}
+		run := sc.advance(now)
+		var item *queue.Item
+		if !run.IsZero() {
+			item, err = sc.item(run)
+			sc.LastRun, sc.LastError = run, ""
+			if err != nil {
+				sc.LastError = err.Error()
+			} else {
+				sc.Runs++
+				sc.LastRequestID = item.RequestID
+			}
+		} else {
+			glog.Infof("held schedule %q in blackout (next %s)", sc.Name, sc.Next)
+		}
+		sc.UpdatedAt = now
+
+		ok, err := s.commit(ctx, sc, revs[i], e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if !s.stillLeading(ctx, e) {
+				return errNotLeader
+			}
+			// updated concurrently, checked again on the next interval
+			continue
+		}
+		if item == nil {
+			if sc.LastError != "" {
+				glog.Warningf("failed to run schedule %q (%s)", sc.Name, sc.LastError)
+			}
+			continue
+		}
+		if err = s.cfg.Enqueue(ctx, item); err != nil {
+			glog.Warningf("failed to enqueue %q of schedule %q (%v)", item.RequestID, sc.Name, err)
+			s.recordError(ctx, sc.Name, item.RequestID, err)
+			continue
+		}
+		glog.Infof("enqueued %q of schedule %q (next %s)", item.RequestID, sc.Name, sc.Next)
+	}
+	return nil
+}
+
+// stillLeading returns true if the election key of the server exists.
+func (s *Scheduler) stillLeading(ctx context.Context, e *concurrency.Election) bool {
+	resp, err := s.cli.Get(ctx, e.Key())
+	return err == nil && len(resp.Kvs) > 0 && resp.Kvs[0].CreateRevision == e.Rev()
+}
+
+// recordError records the enqueue failure of the run, if the schedule
+// has not run since.
+func (s *Scheduler) recordError(ctx context.Context, name, requestID string, enqErr error) {
+	for {
+		sc, rev, err := s.get(ctx, name)
+		if err != nil || sc.LastRequestID != requestID {
+			return
+		}
+		sc.LastError = enqErr.Error()
+		if ok, err := s.commit(ctx, sc, rev, nil); ok || err != nil {
+			return
+		}
+	}
+}
+
+// item returns the job of the run.
+func (sc Schedule) item(run time.Time) (*queue.Item, error) {
+	value, err := sc.render(run)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value (%v)", err)
+	}
+	item := queue.CreateItem(sc.Bucket, 100, value)
+	item.RequestID = fmt.Sprintf("schedule-%s-%d", sc.Name, run.Unix())
+	item.JobType = sc.JobType
+	item.User = sc.User
+	return item, nil
+}
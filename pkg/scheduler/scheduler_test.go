@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestScheduler(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 35379, 35380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	var (
+		mu    sync.Mutex
+		items []*queue.Item
+	)
+	enqueue := func(ctx context.Context, item *queue.Item) error {
+		mu.Lock()
+		items = append(items, item)
+		mu.Unlock()
+		return nil
+	}
+	newScheduler := func(name string) *Scheduler {
+		return New(qu.Client(), Config{Name: name, Interval: 50 * time.Millisecond, TTL: time.Second, Enqueue: enqueue})
+	}
+
+	ctx := context.Background()
+	s1 := newScheduler("backend-1")
+	now := time.Now()
+	at := now.Add(500 * time.Millisecond)
+	sc, err := s1.Put(ctx, Schedule{
+		Name:   "warmup",
+		At:     []time.Time{at},
+		Bucket: "/cats-request",
+		Value:  "{{.Name}}-{{.Run}}",
+		User:   "alice",
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Next.Equal(at) || sc.CreatedAt.IsZero() {
+		t.Fatalf("unexpected schedule %+v", sc)
+	}
+	if _, err = s1.Put(ctx, Schedule{Name: "nightly", Cron: "0 2 * * *", Bucket: "/train", Paused: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s1.Put(ctx, Schedule{Name: "invalid", Bucket: "/train"}, now); err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	// only the leader enqueues the run
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s2 := newScheduler("backend-2")
+	go s1.Run(rctx)
+	go s2.Run(rctx)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := len(items)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the run")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	if len(items) != 1 || items[0].Value != "warmup-1" || items[0].Bucket != "/cats-request" || items[0].User != "alice" || items[0].RequestID != fmt.Sprintf("schedule-warmup-%d", at.Unix()) {
+		t.Fatalf("unexpected items %+v", items)
+	}
+	mu.Unlock()
+	if s1.Leading() == s2.Leading() {
+		t.Fatalf("expected one leader, got %v and %v", s1.Leading(), s2.Leading())
+	}
+
+	scs, err := s2.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scs) != 2 || scs[0].Name != "nightly" || scs[1].Name != "warmup" {
+		t.Fatalf("unexpected schedules %+v", scs)
+	}
+	// the one-shot schedule has no more runs
+	if w := scs[1]; w.Runs != 1 || !w.Next.IsZero() || w.LastRequestID != items[0].RequestID {
+		t.Fatalf("unexpected schedule %+v", w)
+	}
+
+	if sc, err = s2.SetPaused(ctx, "nightly", false, now); err != nil || sc.Paused || sc.Next.IsZero() {
+		t.Fatalf("unexpected resumed schedule %+v (%v)", sc, err)
+	}
+	if err = s2.Delete(ctx, "nightly"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s2.Get(ctx, "nightly"); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,4 @@
+// Package secrets resolves secret references (e.g. "env:SMTP_PASSWORD",
+// "file:/etc/dplearn/key.json", "gcp-secret:etcd-password") to their values,
+// so that secrets are not passed in flags or startup scripts.
+package secrets
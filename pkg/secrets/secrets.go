@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Provider returns the value of the secret of the name
+// (e.g. environment variable name, or file path).
+type Provider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context, name string) ([]byte, error)
+
+// Secret calls f(ctx, name).
+func (f ProviderFunc) Secret(ctx context.Context, name string) ([]byte, error) { return f(ctx, name) }
+
+// Env reads secrets from the environment variables.
+var Env = ProviderFunc(func(ctx context.Context, name string) ([]byte, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %q is not set", name)
+	}
+	return []byte(v), nil
+})
+
+// File reads secrets from the files (e.g. mounted Kubernetes secrets).
+var File = ProviderFunc(func(ctx context.Context, name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+})
+
+// Resolver resolves the secret references of the form "<scheme>:<name>"
+// with the provider registered for the scheme.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// New returns the resolver with the "env" and "file" providers.
+func New() *Resolver {
+	return &Resolver{providers: map[string]Provider{"env": Env, "file": File}}
+}
+
+// Register registers the provider of the scheme (e.g. "gcp-secret"),
+// replacing the existing one.
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Schemes returns the registered schemes, sorted.
+func (r *Resolver) Schemes() []string {
+	ss := make([]string, 0, len(r.providers))
+	for s := range r.providers {
+		ss = append(ss, s)
+	}
+	sort.Strings(ss)
+	return ss
+}
+
+// IsRef returns true if the value is a reference to a registered scheme.
+func (r *Resolver) IsRef(v string) bool {
+	ss := strings.SplitN(v, ":", 2)
+	_, ok := r.providers[ss[0]]
+	return len(ss) == 2 && ok
+}
+
+// Resolve returns the value of the secret reference
+// (e.g. "env:SMTP_PASSWORD").
+func (r *Resolver) Resolve(ctx context.Context, ref string) ([]byte, error) {
+	ss := strings.SplitN(ref, ":", 2)
+	if len(ss) != 2 || ss[1] == "" {
+		return nil, fmt.Errorf("invalid secret reference %q (must be '<scheme>:<name>' with scheme in %q)", ref, r.Schemes())
+	}
+	p, ok := r.providers[ss[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown secret scheme %q (must be one of %q)", ss[0], r.Schemes())
+	}
+	v, err := p.Secret(ctx, ss[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret %q (%v)", ref, err)
+	}
+	return v, nil
+}
+
+// Value returns the value of the secret reference, or the value as-is if
+// it is not a reference, so that flags accept either (e.g. webhook URL, or
+// "env:NOTIFY_WEBHOOK"). Trailing newlines of the secret are trimmed.
+func (r *Resolver) Value(ctx context.Context, v string) (string, error) {
+	if !r.IsRef(v) {
+		return v, nil
+	}
+	data, err := r.Resolve(ctx, v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
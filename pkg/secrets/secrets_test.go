@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file-secret\n")
+	f.Close()
+
+	os.Setenv("DPLEARN_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("DPLEARN_TEST_SECRET")
+
+	r := New()
+	r.Register("mem", ProviderFunc(func(ctx context.Context, name string) ([]byte, error) {
+		if name != "smtp" {
+			return nil, fmt.Errorf("%q not found", name)
+		}
+		return []byte("mem-secret"), nil
+	}))
+
+	tests := []struct {
+		v     string
+		value string
+		err   bool
+	}{
+		{"env:DPLEARN_TEST_SECRET", "env-secret", false},
+		{"file:" + f.Name(), "file-secret", false},
+		{"mem:smtp", "mem-secret", false},
+		{"https://hooks.slack.com/services/T0/B0/x", "https://hooks.slack.com/services/T0/B0/x", false},
+		{"plain", "plain", false},
+		{"env:DPLEARN_TEST_MISSING", "", true},
+		{"mem:etcd", "", true},
+	}
+	for i, tt := range tests {
+		v, err := r.Value(context.Background(), tt.v)
+		if (err != nil) != tt.err {
+			t.Fatalf("#%d: expected error %v, got %v", i, tt.err, err)
+		}
+		if v != tt.value {
+			t.Fatalf("#%d: expected %q, got %q", i, tt.value, v)
+		}
+	}
+
+	if _, err = r.Resolve(context.Background(), "unknown:x"); err == nil {
+		t.Fatal("expected error on unknown scheme")
+	}
+}
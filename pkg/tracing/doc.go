@@ -0,0 +1,3 @@
+// Package tracing implements minimal OpenTelemetry-compatible tracing and metrics,
+// exported to an OTLP/HTTP collector (e.g. Jaeger, Tempo) in JSON encoding.
+package tracing
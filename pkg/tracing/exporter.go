@@ -0,0 +1,354 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// maxBatchSize is the maximum number of spans to buffer before flush.
+const maxBatchSize = 512
+
+// exporter batches spans and periodically posts them,
+// with metrics, to the OTLP/HTTP collector.
+type exporter struct {
+	p   *Provider
+	cli *http.Client
+
+	mu    sync.Mutex
+	spans []*Span
+
+	flushc chan struct{}
+	stopc  chan struct{}
+	donec  chan struct{}
+}
+
+func newExporter(p *Provider) *exporter {
+	e := &exporter{
+		p:      p,
+		cli:    &http.Client{Timeout: 10 * time.Second},
+		flushc: make(chan struct{}, 1),
+		stopc:  make(chan struct{}),
+		donec:  make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) addSpan(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	full := len(e.spans) >= maxBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.donec)
+
+	ticker := time.NewTicker(e.p.cfg.ExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopc:
+			e.flush()
+			return
+		case <-e.flushc:
+		case <-ticker.C:
+		}
+		e.flush()
+	}
+}
+
+func (e *exporter) stop(ctx context.Context) error {
+	close(e.stopc)
+	select {
+	case <-e.donec:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *exporter) flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if e.p.cfg.Endpoint == "" {
+		return
+	}
+	if len(spans) > 0 {
+		if err := e.post("/v1/traces", e.tracesRequest(spans)); err != nil {
+			glog.Warningf("failed to export %d spans (%v)", len(spans), err)
+		}
+	}
+	if req := e.metricsRequest(); req != nil {
+		if err := e.post("/v1/metrics", req); err != nil {
+			glog.Warningf("failed to export metrics (%v)", err)
+		}
+	}
+}
+
+func (e *exporter) post(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ep := strings.TrimSuffix(e.p.cfg.Endpoint, "/") + path
+	resp, err := e.cli.Post(ep, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%q returned %q", ep, resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/docs/specification.md#json-protobuf-encoding
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func toKeyValue(k string, v interface{}) otlpKeyValue {
+	kv := otlpKeyValue{Key: k}
+	switch tv := v.(type) {
+	case string:
+		kv.Value.StringValue = &tv
+	case bool:
+		kv.Value.BoolValue = &tv
+	case int:
+		s := strconv.Itoa(tv)
+		kv.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(tv, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &tv
+	default:
+		s := fmt.Sprint(tv)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+const scopeName = "github.com/gyuho/dplearn"
+
+func (e *exporter) resource() otlpResource {
+	return otlpResource{Attributes: []otlpKeyValue{toKeyValue("service.name", e.p.cfg.ServiceName)}}
+}
+
+func (e *exporter) tracesRequest(spans []*Span) otlpTracesRequest {
+	ss := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		os := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              int(s.kind),
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1}, // STATUS_CODE_OK
+		}
+		if s.parentID != (SpanID{}) {
+			os.ParentSpanID = s.parentID.String()
+		}
+		for k, v := range s.attrs {
+			os.Attributes = append(os.Attributes, toKeyValue(k, v))
+		}
+		if s.err != nil {
+			os.Status = otlpStatus{Code: 2, Message: s.err.Error()} // STATUS_CODE_ERROR
+		}
+		s.mu.Unlock()
+		ss = append(ss, os)
+	}
+	return otlpTracesRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   e.resource(),
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: ss}},
+		}},
+	}
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsInt             string         `json:"asInt"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func (e *exporter) metricsRequest() *otlpMetricsRequest {
+	e.p.mu.Lock()
+	counters := make([]*Counter, 0, len(e.p.counters))
+	for _, c := range e.p.counters {
+		counters = append(counters, c)
+	}
+	gauges := make([]*Gauge, 0, len(e.p.gauges))
+	for _, g := range e.p.gauges {
+		gauges = append(gauges, g)
+	}
+	e.p.mu.Unlock()
+	if len(counters) == 0 && len(gauges) == 0 {
+		return nil
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	ms := make([]otlpMetric, 0, len(counters)+len(gauges))
+	for _, c := range counters {
+		m := otlpMetric{
+			Name:        c.name,
+			Description: c.description,
+			Unit:        c.unit,
+			Sum: &otlpSum{
+				AggregationTemporality: 2, // AGGREGATION_TEMPORALITY_CUMULATIVE
+				IsMonotonic:            true,
+			},
+		}
+		start := strconv.FormatInt(c.start.UnixNano(), 10)
+		c.mu.Lock()
+		for _, pt := range c.points {
+			dp := otlpNumberDataPoint{
+				StartTimeUnixNano: start,
+				TimeUnixNano:      now,
+				AsInt:             strconv.FormatInt(atomic.LoadInt64(&pt.value), 10),
+			}
+			for i := 0; i+1 < len(pt.attrs); i += 2 {
+				dp.Attributes = append(dp.Attributes, toKeyValue(pt.attrs[i], pt.attrs[i+1]))
+			}
+			m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+		}
+		c.mu.Unlock()
+		ms = append(ms, m)
+	}
+	for _, g := range gauges {
+		m := otlpMetric{
+			Name:        g.name,
+			Description: g.description,
+			Unit:        g.unit,
+			Gauge:       &otlpGauge{},
+		}
+		g.mu.Lock()
+		for _, pt := range g.points {
+			dp := otlpNumberDataPoint{
+				TimeUnixNano: now,
+				AsInt:        strconv.FormatInt(atomic.LoadInt64(&pt.value), 10),
+			}
+			for i := 0; i+1 < len(pt.attrs); i += 2 {
+				dp.Attributes = append(dp.Attributes, toKeyValue(pt.attrs[i], pt.attrs[i+1]))
+			}
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+		}
+		g.mu.Unlock()
+		ms = append(ms, m)
+	}
+	return &otlpMetricsRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource:     e.resource(),
+			ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: scopeName}, Metrics: ms}},
+		}},
+	}
+}
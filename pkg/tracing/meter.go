@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonic, cumulative int64 sum.
+type Counter struct {
+	name        string
+	description string
+	unit        string
+	start       time.Time
+
+	mu     sync.Mutex
+	points map[string]*counterPoint
+}
+
+type counterPoint struct {
+	attrs []string
+	value int64
+}
+
+// Counter returns the counter registered with the name, creating one if not exists.
+func (p *Provider) Counter(name, description, unit string) *Counter {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.counters[name]
+	if !ok {
+		c = &Counter{
+			name:        name,
+			description: description,
+			unit:        unit,
+			start:       time.Now(),
+			points:      make(map[string]*counterPoint),
+		}
+		p.counters[name] = c
+	}
+	return c
+}
+
+// Add adds the delta to the counter. 'kvs' are attribute key-value pairs
+// (e.g. "route", "/cats-request", "code", "200").
+func (c *Counter) Add(delta int64, kvs ...string) {
+	if c == nil {
+		return
+	}
+	k := strings.Join(kvs, "\x00")
+
+	c.mu.Lock()
+	pt, ok := c.points[k]
+	if !ok {
+		pt = &counterPoint{attrs: kvs}
+		c.points[k] = pt
+	}
+	c.mu.Unlock()
+
+	atomic.AddInt64(&pt.value, delta)
+}
+
+// GetCounter returns the counter registered with the global provider.
+// If no provider is registered, it returns a nil counter, whose methods are no-op.
+func GetCounter(name, description, unit string) *Counter {
+	return GetProvider().Counter(name, description, unit)
+}
+
+// Gauge is a non-additive int64 value, reporting the last recorded value.
+type Gauge struct {
+	name        string
+	description string
+	unit        string
+
+	mu     sync.Mutex
+	points map[string]*counterPoint
+}
+
+// Gauge returns the gauge registered with the name, creating one if not exists.
+func (p *Provider) Gauge(name, description, unit string) *Gauge {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.gauges[name]
+	if !ok {
+		g = &Gauge{
+			name:        name,
+			description: description,
+			unit:        unit,
+			points:      make(map[string]*counterPoint),
+		}
+		p.gauges[name] = g
+	}
+	return g
+}
+
+// Set records the value. 'kvs' are attribute key-value pairs.
+func (g *Gauge) Set(value int64, kvs ...string) {
+	if g == nil {
+		return
+	}
+	k := strings.Join(kvs, "\x00")
+
+	g.mu.Lock()
+	pt, ok := g.points[k]
+	if !ok {
+		pt = &counterPoint{attrs: kvs}
+		g.points[k] = pt
+	}
+	g.mu.Unlock()
+
+	atomic.StoreInt64(&pt.value, value)
+}
+
+// GetGauge returns the gauge registered with the global provider.
+// If no provider is registered, it returns a nil gauge, whose methods are no-op.
+func GetGauge(name, description, unit string) *Gauge {
+	return GetProvider().Gauge(name, description, unit)
+}
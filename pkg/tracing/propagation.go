@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header.
+// https://www.w3.org/TR/trace-context/#traceparent-header
+const TraceparentHeader = "traceparent"
+
+// FormatTraceparent encodes the span context as a traceparent header value.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent decodes the traceparent header value.
+func ParseTraceparent(v string) (SpanContext, error) {
+	ss := strings.Split(strings.TrimSpace(v), "-")
+	if len(ss) < 4 || len(ss[0]) != 2 || len(ss[1]) != 32 || len(ss[2]) != 16 || len(ss[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", v)
+	}
+	if ss[0] == "ff" {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version %q", v)
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(ss[1])); err != nil {
+		return SpanContext{}, err
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(ss[2])); err != nil {
+		return SpanContext{}, err
+	}
+	flags, err := hex.DecodeString(ss[3])
+	if err != nil {
+		return SpanContext{}, err
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q (zero ID)", v)
+	}
+	return sc, nil
+}
+
+// Inject sets the traceparent header from the current span in the context.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if sc.IsValid() {
+		h.Set(TraceparentHeader, FormatTraceparent(sc))
+	}
+}
+
+// Extract returns a context with the remote span context from the traceparent header, if any.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	v := h.Get(TraceparentHeader)
+	if v == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// StartServerSpan starts a server span for the incoming request,
+// continuing the trace propagated by the caller.
+func StartServerSpan(ctx context.Context, req *http.Request, name string) (context.Context, *Span) {
+	ctx, span := Start(Extract(ctx, req.Header), name, SpanKindServer)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.Path)
+	return ctx, span
+}
+
+// Transport wraps http.RoundTripper to start client spans
+// and propagate trace context on outbound requests.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := Start(req.Context(), "HTTP "+req.Method, SpanKindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+
+	// RoundTrip must not modify the request
+	req = req.WithContext(ctx)
+	req.Header = cloneHeader(req.Header)
+	Inject(ctx, req.Header)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return resp, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	return resp, nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, vv := range h {
+		h2[k] = append([]string(nil), vv...)
+	}
+	return h2
+}
@@ -0,0 +1,263 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Config defines tracer and meter provider configuration.
+type Config struct {
+	// ServiceName is exported as 'service.name' resource attribute.
+	ServiceName string
+
+	// Endpoint is the OTLP/HTTP collector endpoint (e.g. "http://localhost:4318").
+	// Traces are posted to "/v1/traces" and metrics to "/v1/metrics".
+	// Empty endpoint disables the exporter.
+	Endpoint string
+
+	// SampleRatio is the ratio of root traces to sample (range from 0.0 to 1.0).
+	// Child spans follow the sampling decision of their parent.
+	SampleRatio float64
+
+	// ExportInterval is the interval to flush batched spans and metrics.
+	ExportInterval time.Duration
+}
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the propagated part of a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if both trace ID and span ID are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// SpanKind defines the span kind, as in OTLP.
+type SpanKind int
+
+const (
+	// SpanKindInternal is the default span kind.
+	SpanKindInternal SpanKind = 1
+	// SpanKindServer is for incoming requests.
+	SpanKindServer SpanKind = 2
+	// SpanKindClient is for outgoing requests.
+	SpanKindClient SpanKind = 3
+)
+
+// Span represents a single operation in a trace.
+type Span struct {
+	mu sync.Mutex
+
+	provider *Provider
+	sc       SpanContext
+	parentID SpanID
+	name     string
+	kind     SpanKind
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+	ended    bool
+}
+
+// SpanContext returns the span context.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute sets an attribute on the span.
+// Supported value types are string, bool, int, int64, and float64.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End ends the span and queues it for export, if sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled && s.provider != nil {
+		s.provider.exp.addSpan(s)
+	}
+}
+
+// Provider creates spans and metric instruments, and exports them.
+type Provider struct {
+	cfg       Config
+	threshold uint64
+
+	exp *exporter
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+}
+
+// NewProvider creates a new provider and starts the exporter.
+func NewProvider(cfg Config) (*Provider, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %f (must be in [0, 1])", cfg.SampleRatio)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "dplearn"
+	}
+	if cfg.ExportInterval == 0 {
+		cfg.ExportInterval = 5 * time.Second
+	}
+	p := &Provider{
+		cfg:       cfg,
+		threshold: uint64(cfg.SampleRatio * (1 << 63)),
+		counters:  make(map[string]*Counter),
+		gauges:    make(map[string]*Gauge),
+	}
+	p.exp = newExporter(p)
+	glog.Infof("started tracing provider (endpoint %q, sample ratio %.3f)", cfg.Endpoint, cfg.SampleRatio)
+	return p, nil
+}
+
+// Shutdown flushes remaining spans and metrics, and stops the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.exp.stop(ctx)
+}
+
+// shouldSample implements parent-based, trace ID ratio-based sampling.
+func (p *Provider) shouldSample(parent SpanContext, traceID TraceID) bool {
+	if parent.IsValid() {
+		return parent.Sampled
+	}
+	if p.cfg.Endpoint == "" {
+		return false
+	}
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < p.threshold
+}
+
+// Start starts a new span, as a child of the span in the context if any.
+func (p *Provider) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{TraceID: parent.TraceID}
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	sc.Sampled = p.shouldSample(parent, sc.TraceID)
+
+	s := &Span{
+		provider: p,
+		sc:       sc,
+		parentID: parent.SpanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		attrs:    make(map[string]interface{}),
+	}
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+type key int
+
+const (
+	spanKey key = iota
+	remoteKey
+)
+
+// SpanFromContext returns the current span in the context, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the current span context, local or remote.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext returns a context with a span context
+// propagated from the remote caller.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+var (
+	globalMu       sync.RWMutex
+	globalProvider *Provider
+)
+
+// SetProvider registers the global provider.
+func SetProvider(p *Provider) {
+	globalMu.Lock()
+	globalProvider = p
+	globalMu.Unlock()
+}
+
+// GetProvider returns the global provider, or nil if not registered.
+func GetProvider() *Provider {
+	globalMu.RLock()
+	p := globalProvider
+	globalMu.RUnlock()
+	return p
+}
+
+// Start starts a new span with the global provider.
+// If no provider is registered, it returns the context as is
+// and a nil span, whose methods are all no-op.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	p := GetProvider()
+	if p == nil {
+		return ctx, nil
+	}
+	return p.Start(ctx, name, kind)
+}
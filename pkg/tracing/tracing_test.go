@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	v := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if s := FormatTraceparent(sc); s != v {
+		t.Fatalf("expected %q, got %q", v, s)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		if _, err = ParseTraceparent(bad); err == nil {
+			t.Fatalf("%q expected error", bad)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	spanc := make(chan otlpTracesRequest, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rb, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if req.URL.Path != "/v1/traces" {
+			return
+		}
+		var tr otlpTracesRequest
+		if err = json.Unmarshal(rb, &tr); err != nil {
+			t.Error(err)
+			return
+		}
+		spanc <- tr
+	}))
+	defer ts.Close()
+
+	p, err := NewProvider(Config{Endpoint: ts.URL, SampleRatio: 1, ExportInterval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Shutdown(context.Background())
+
+	ctx, parent := p.Start(context.Background(), "parent", SpanKindServer)
+	_, child := p.Start(ctx, "child", SpanKindInternal)
+	child.SetAttribute("key", "value")
+	child.End()
+	parent.End()
+
+	select {
+	case tr := <-spanc:
+		spans := tr.ResourceSpans[0].ScopeSpans[0].Spans
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %+v", spans)
+		}
+		if spans[0].Name != "child" || spans[0].ParentSpanID != spans[1].SpanID || spans[0].TraceID != spans[1].TraceID {
+			t.Fatalf("unexpected spans %+v", spans)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("took too long to export spans")
+	}
+
+	// ratio 0 never samples root spans
+	p0, err := NewProvider(Config{Endpoint: ts.URL, SampleRatio: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p0.Shutdown(context.Background())
+	if _, s := p0.Start(context.Background(), "root", SpanKindServer); s.SpanContext().Sampled {
+		t.Fatal("expected unsampled span")
+	}
+}
@@ -2,12 +2,15 @@
 package urlutil
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/gyuho/dplearn/pkg/tracing"
+
 	humanize "github.com/dustin/go-humanize"
 )
 
@@ -24,9 +27,21 @@ func TrimQuery(ep string) string {
 	return raw
 }
 
+// client propagates trace context on outbound requests.
+var client = &http.Client{Transport: &tracing.Transport{}}
+
 // GetContentLength fetches the file size of the content.
 func GetContentLength(ep string) (uint64, string, error) {
-	resp, err := http.Head(ep)
+	return GetContentLengthContext(context.Background(), ep)
+}
+
+// GetContentLengthContext fetches the file size of the content with context.
+func GetContentLengthContext(ctx context.Context, ep string) (uint64, string, error) {
+	req, err := http.NewRequest(http.MethodHead, ep, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return 0, "", err
 	}
@@ -37,7 +52,16 @@ func GetContentLength(ep string) (uint64, string, error) {
 
 // Get downloads the URL contents.
 func Get(ep string) ([]byte, error) {
-	resp, err := http.Get(ep)
+	return GetContext(context.Background(), ep)
+}
+
+// GetContext downloads the URL contents with context.
+func GetContext(ctx context.Context, ep string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, ep, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,5 @@
+// Package usage accounts the per-user usage in etcd: the submitted jobs,
+// the compute seconds of the jobs, and the bytes of the uploads, and
+// checks them against the configured quotas, so that a shared deployment
+// can keep one user from consuming the whole worker fleet.
+package usage
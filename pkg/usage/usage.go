@@ -0,0 +1,247 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Anonymous is the user of the anonymous requests, which share the usage.
+const Anonymous = "_anonymous"
+
+// dayFormat is the format of the UTC day of the daily usage.
+const dayFormat = "2006-01-02"
+
+// Quota is the limits of the user usage. Zero values are unlimited.
+type Quota struct {
+	// MaxActiveJobs is the number of the jobs queued or running at once.
+	MaxActiveJobs int `json:"max_active_jobs,omitempty" yaml:"max-active-jobs"`
+	// MaxJobsPerDay is the number of the jobs submitted per UTC day.
+	MaxJobsPerDay int64 `json:"max_jobs_per_day,omitempty" yaml:"max-jobs-per-day"`
+	// MaxComputeSecondsPerDay is the seconds of the jobs running per UTC day.
+	MaxComputeSecondsPerDay float64 `json:"max_compute_seconds_per_day,omitempty" yaml:"max-compute-seconds-per-day"`
+	// MaxStorageBytes is the bytes of the uploads kept at once.
+	MaxStorageBytes int64 `json:"max_storage_bytes,omitempty" yaml:"max-storage-bytes"`
+}
+
+// Usage is the usage of the user.
+type Usage struct {
+	User string `json:"user"`
+	// Day is the UTC day of 'Jobs' and 'ComputeSeconds' (e.g. "2018-01-02").
+	Day            string  `json:"day"`
+	Jobs           int64   `json:"jobs"`
+	ComputeSeconds float64 `json:"compute_seconds"`
+
+	TotalJobs           int64   `json:"total_jobs"`
+	TotalComputeSeconds float64 `json:"total_compute_seconds"`
+	StorageBytes        int64   `json:"storage_bytes"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// rollover resets the daily usage, if recorded on another day.
+func (u *Usage) rollover(now time.Time) {
+	if day := now.UTC().Format(dayFormat); u.Day != day {
+		u.Day, u.Jobs, u.ComputeSeconds = day, 0, 0
+	}
+}
+
+// ExceededError is returned when the usage exceeds the quota.
+type ExceededError struct {
+	User     string
+	Resource string
+	Used     float64
+	Limit    float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("usage: %s quota of %q exceeded (%g of %g)", e.Resource, e.User, e.Used, e.Limit)
+}
+
+// Config defines usage accountant configuration.
+type Config struct {
+	// Prefix is the etcd key prefix of the usage. Defaults to "_usage".
+	Prefix string `yaml:"prefix"`
+	// Default is the quota of the users without their own quota,
+	// and of the anonymous requests.
+	Default Quota `yaml:"default"`
+	// Users are the quotas by user name.
+	Users map[string]Quota `yaml:"users"`
+}
+
+// Quota returns the quota of the user.
+func (c Config) Quota(user string) Quota {
+	if q, ok := c.Users[user]; ok {
+		return q
+	}
+	return c.Default
+}
+
+// ReadConfig reads the quotas from the YAML file:
+//
+//	default:
+//	  max-active-jobs: 5
+//	  max-jobs-per-day: 1000
+//	users:
+//	  alice:
+//	    max-active-jobs: 20
+//	    max-compute-seconds-per-day: 36000
+//	    max-storage-bytes: 1073741824
+func ReadConfig(p string) (Config, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err = yaml.UnmarshalStrict(bts, &cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid quotas %q (%v)", p, err)
+	}
+	return cfg, nil
+}
+
+// Accountant records the usage of the users.
+type Accountant struct {
+	cli *clientv3.Client
+	cfg Config
+}
+
+// New creates a new usage accountant.
+func New(cli *clientv3.Client, cfg Config) *Accountant {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_usage"
+	}
+	return &Accountant{cli: cli, cfg: cfg}
+}
+
+// Quota returns the quota of the user.
+func (a *Accountant) Quota(user string) Quota { return a.cfg.Quota(user) }
+
+func (a *Accountant) userKey(user string) string {
+	return path.Join(a.cfg.Prefix, "users", user)
+}
+
+// StartJob counts the job of the user, or returns '*ExceededError'
+// if the user has used up the daily jobs or compute seconds.
+func (a *Accountant) StartJob(ctx context.Context, user string, now time.Time) (Usage, error) {
+	q := a.Quota(user)
+	return a.update(ctx, user, now, func(u *Usage) error {
+		if q.MaxJobsPerDay > 0 && u.Jobs >= q.MaxJobsPerDay {
+			return &ExceededError{User: user, Resource: "daily jobs", Used: float64(u.Jobs), Limit: float64(q.MaxJobsPerDay)}
+		}
+		if q.MaxComputeSecondsPerDay > 0 && u.ComputeSeconds >= q.MaxComputeSecondsPerDay {
+			return &ExceededError{User: user, Resource: "daily compute seconds", Used: u.ComputeSeconds, Limit: q.MaxComputeSecondsPerDay}
+		}
+		u.Jobs++
+		u.TotalJobs++
+		return nil
+	})
+}
+
+// FinishJob records the compute time of the finished job of the user.
+func (a *Accountant) FinishJob(ctx context.Context, user string, compute time.Duration, now time.Time) (Usage, error) {
+	return a.update(ctx, user, now, func(u *Usage) error {
+		u.ComputeSeconds += compute.Seconds()
+		u.TotalComputeSeconds += compute.Seconds()
+		return nil
+	})
+}
+
+// AddStorage adds the bytes to the storage of the user (negative to
+// release), or returns '*ExceededError' if the bytes exceed the quota.
+func (a *Accountant) AddStorage(ctx context.Context, user string, bytes int64, now time.Time) (Usage, error) {
+	q := a.Quota(user)
+	return a.update(ctx, user, now, func(u *Usage) error {
+		if bytes > 0 && q.MaxStorageBytes > 0 && u.StorageBytes+bytes > q.MaxStorageBytes {
+			return &ExceededError{User: user, Resource: "storage bytes", Used: float64(u.StorageBytes + bytes), Limit: float64(q.MaxStorageBytes)}
+		}
+		if u.StorageBytes += bytes; u.StorageBytes < 0 {
+			u.StorageBytes = 0
+		}
+		return nil
+	})
+}
+
+// Get returns the usage of the user, empty if not recorded.
+func (a *Accountant) Get(ctx context.Context, user string, now time.Time) (Usage, error) {
+	u, _, err := a.get(ctx, user)
+	if err != nil {
+		return u, err
+	}
+	u.rollover(now)
+	return u, nil
+}
+
+// List returns the usage of all users, sorted by user name.
+func (a *Accountant) List(ctx context.Context, now time.Time) ([]Usage, error) {
+	resp, err := a.cli.Get(ctx, a.userKey("")+"/", clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	us := make([]Usage, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var u Usage
+		if err = json.Unmarshal(kv.Value, &u); err != nil {
+			glog.Warningf("usage %q is invalid (%v)", string(kv.Key), err)
+			continue
+		}
+		u.rollover(now)
+		us = append(us, u)
+	}
+	return us, nil
+}
+
+// get returns the usage, and its revision (0 if not recorded).
+func (a *Accountant) get(ctx context.Context, user string) (Usage, int64, error) {
+	u := Usage{User: user}
+	resp, err := a.cli.Get(ctx, a.userKey(user))
+	if err != nil {
+		return u, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return u, 0, nil
+	}
+	if err = json.Unmarshal(resp.Kvs[0].Value, &u); err != nil {
+		return u, 0, err
+	}
+	return u, resp.Kvs[0].ModRevision, nil
+}
+
+// update applies fn to the usage of the user, retrying on concurrent
+// updates (e.g. by other backends).
+func (a *Accountant) update(ctx context.Context, user string, now time.Time, fn func(*Usage) error) (Usage, error) {
+	key := a.userKey(user)
+	for {
+		u, rev, err := a.get(ctx, user)
+		if err != nil {
+			return u, err
+		}
+		u.rollover(now)
+		if err = fn(&u); err != nil {
+			return u, err
+		}
+		u.UpdatedAt = now
+		data, err := json.Marshal(u)
+		if err != nil {
+			return u, err
+		}
+
+		cmp := clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+		if rev == 0 {
+			cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		}
+		resp, err := a.cli.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, string(data))).Commit()
+		if err != nil {
+			return u, err
+		}
+		if resp.Succeeded {
+			return u, nil
+		}
+	}
+}
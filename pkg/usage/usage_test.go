@@ -0,0 +1,114 @@
+package usage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestAccountant(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 31379, 31380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	ctx := context.Background()
+	a := New(qu.Client(), Config{
+		Default: Quota{MaxJobsPerDay: 2, MaxStorageBytes: 100},
+		Users:   map[string]Quota{"alice": {MaxComputeSecondsPerDay: 60}},
+	})
+	now := time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if _, err = a.StartJob(ctx, Anonymous, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = a.StartJob(ctx, Anonymous, now)
+	if e, ok := err.(*ExceededError); !ok || e.Resource != "daily jobs" || e.Limit != 2 {
+		t.Fatalf("expected daily jobs exceeded, got %v", err)
+	}
+
+	// daily usage resets on the next day, keeping the totals
+	u, err := a.StartJob(ctx, Anonymous, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Day != "2018-01-03" || u.Jobs != 1 || u.TotalJobs != 3 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	if _, err = a.StartJob(ctx, "alice", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.FinishJob(ctx, "alice", 90*time.Second, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.StartJob(ctx, "alice", now); err == nil {
+		t.Fatal("expected daily compute seconds exceeded")
+	}
+
+	if _, err = a.AddStorage(ctx, Anonymous, 80, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.AddStorage(ctx, Anonymous, 30, now); err == nil {
+		t.Fatal("expected storage bytes exceeded")
+	}
+	if u, err = a.AddStorage(ctx, Anonymous, -80, now); err != nil || u.StorageBytes != 0 {
+		t.Fatalf("unexpected usage %+v (%v)", u, err)
+	}
+
+	us, err := a.List(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[0].User != Anonymous || us[1].User != "alice" || us[1].ComputeSeconds != 90 {
+		t.Fatalf("unexpected usage %+v", us)
+	}
+	if u, err = a.Get(ctx, "bob", now); err != nil || u.User != "bob" || u.Jobs != 0 {
+		t.Fatalf("unexpected usage %+v (%v)", u, err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "quotas.yaml")
+	if err = ioutil.WriteFile(p, []byte(`default:
+  max-active-jobs: 5
+users:
+  alice:
+    max-active-jobs: 20
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfig(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Quota("bob").MaxActiveJobs != 5 || cfg.Quota("alice").MaxActiveJobs != 20 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if err = ioutil.WriteFile(p, []byte("default:\n  max-jobs: 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadConfig(p); err == nil {
+		t.Fatal("expected error on unknown field")
+	}
+}
@@ -0,0 +1,4 @@
+// Package user stores the user accounts in etcd: the bcrypt password
+// hashes, profiles, and per-user settings, keyed by user name, and issues
+// the signed session tokens (JWT) of the authenticated users.
+package user
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"errors"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// DefaultTokenTTL is the default lifetime of the session tokens.
+const DefaultTokenTTL = 24 * time.Hour
+
+const tokenIssuer = "dplearn"
+
+// ErrInvalidToken is returned when the session token is malformed,
+// not signed by the issuer, or expired.
+var ErrInvalidToken = errors.New("user: invalid or expired session token")
+
+// Tokens issues and verifies the session tokens, signed with HMAC-SHA256.
+type Tokens struct {
+	Secret []byte
+	// TTL is the lifetime of the tokens. Defaults to 'DefaultTokenTTL'.
+	TTL time.Duration
+}
+
+// Issue returns the session token of the user, and its expiration time.
+func (t Tokens) Issue(name string, now time.Time) (string, time.Time, error) {
+	ttl := t.TTL
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+	expiresAt := now.Add(ttl)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   name,
+		Issuer:    tokenIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}).SignedString(t.Secret)
+	return token, expiresAt, err
+}
+
+// Verify returns the user name of the session token, or 'ErrInvalidToken'.
+func (t Tokens) Verify(token string) (string, error) {
+	var claims jwt.StandardClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(tk *jwt.Token) (interface{}, error) {
+		if tk.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidToken
+		}
+		return t.Secret, nil
+	})
+	if err != nil || !parsed.Valid || claims.Issuer != tokenIssuer || !valid(claims.Subject) {
+		return "", ErrInvalidToken
+	}
+	return claims.Subject, nil
+}
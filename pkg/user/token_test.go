@@ -0,0 +1,36 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens{Secret: []byte("secret"), TTL: time.Hour}
+	now := time.Now()
+	token, expiresAt, err := tokens.Issue("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt.Sub(now) != time.Hour {
+		t.Fatalf("unexpected expiration %v", expiresAt)
+	}
+	if name, err := tokens.Verify(token); err != nil || name != "alice" {
+		t.Fatalf("expected %q, got %q (%v)", "alice", name, err)
+	}
+
+	// tokens of other secrets, expired tokens, and garbage are rejected
+	if _, err = (Tokens{Secret: []byte("other")}).Verify(token); err != ErrInvalidToken {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+	expired, _, err := tokens.Issue("alice", now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tokens.Verify(expired); err != ErrInvalidToken {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+	if _, err = tokens.Verify("not-a-token"); err != ErrInvalidToken {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+}
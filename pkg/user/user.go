@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLen is the minimum length of the passwords.
+const MinPasswordLen = 8
+
+var (
+	// ErrNotFound is returned when the user is not found.
+	ErrNotFound = errors.New("user: user not found")
+
+	// ErrExists is returned when the user name is already registered.
+	ErrExists = errors.New("user: user already exists")
+
+	// ErrInvalidUser is returned when the user name is not valid.
+	ErrInvalidUser = errors.New("user: invalid user name")
+
+	// ErrWeakPassword is returned when the password is shorter than 'MinPasswordLen'.
+	ErrWeakPassword = errors.New("user: password is too short")
+
+	// ErrUnauthorized is returned when the name or password is wrong.
+	ErrUnauthorized = errors.New("user: wrong user name or password")
+)
+
+// Profile is the user profile.
+type Profile struct {
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// User is the user account, without the password hash.
+type User struct {
+	Name string `json:"name"`
+	Profile
+	// Settings are the per-user settings (e.g. "theme": "dark").
+	Settings  map[string]string `json:"settings,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// record is the user account stored in etcd.
+type record struct {
+	User
+	PasswordHash []byte `json:"password_hash"`
+}
+
+// Config defines user store configuration.
+type Config struct {
+	// Prefix is the etcd key prefix of the users. Defaults to "_user".
+	Prefix string
+	// BcryptCost is the cost of the password hashes.
+	// Defaults to 'bcrypt.DefaultCost'.
+	BcryptCost int
+}
+
+// Store stores the user accounts.
+type Store struct {
+	cli *clientv3.Client
+	cfg Config
+}
+
+// New creates a new user store.
+func New(cli *clientv3.Client, cfg Config) *Store {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "_user"
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	return &Store{cli: cli, cfg: cfg}
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+func valid(name string) bool { return len(name) <= 64 && validName.MatchString(name) }
+
+func (s *Store) userKey(name string) string { return path.Join(s.cfg.Prefix, "users", name) }
+
+// Register creates the user with the password.
+func (s *Store) Register(ctx context.Context, name, password string, p Profile) (User, error) {
+	if !valid(name) {
+		return User{}, ErrInvalidUser
+	}
+	if len(password) < MinPasswordLen {
+		return User{}, ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
+	if err != nil {
+		return User{}, err
+	}
+	now := time.Now()
+	r := record{User: User{Name: name, Profile: p, CreatedAt: now, UpdatedAt: now}, PasswordHash: hash}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return User{}, err
+	}
+
+	key := s.userKey(name)
+	resp, err := s.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return User{}, err
+	}
+	if !resp.Succeeded {
+		return User{}, ErrExists
+	}
+	glog.Infof("registered user %q", name)
+	return r.User, nil
+}
+
+// Authenticate returns the user of the name and password,
+// or 'ErrUnauthorized'.
+func (s *Store) Authenticate(ctx context.Context, name, password string) (User, error) {
+	if !valid(name) {
+		return User{}, ErrUnauthorized
+	}
+	r, _, err := s.get(ctx, name)
+	if err == ErrNotFound {
+		return User{}, ErrUnauthorized
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if bcrypt.CompareHashAndPassword(r.PasswordHash, []byte(password)) != nil {
+		return User{}, ErrUnauthorized
+	}
+	return r.User, nil
+}
+
+// Get returns the user, or 'ErrNotFound'.
+func (s *Store) Get(ctx context.Context, name string) (User, error) {
+	if !valid(name) {
+		return User{}, ErrNotFound
+	}
+	r, _, err := s.get(ctx, name)
+	return r.User, err
+}
+
+func (s *Store) get(ctx context.Context, name string) (record, int64, error) {
+	var r record
+	resp, err := s.cli.Get(ctx, s.userKey(name))
+	if err != nil {
+		return r, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return r, 0, ErrNotFound
+	}
+	if err = json.Unmarshal(resp.Kvs[0].Value, &r); err != nil {
+		return r, 0, err
+	}
+	return r, resp.Kvs[0].ModRevision, nil
+}
+
+// List returns the users, sorted by name.
+func (s *Store) List(ctx context.Context) ([]User, error) {
+	resp, err := s.cli.Get(ctx, s.userKey("")+"/", clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	us := make([]User, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var r record
+		if err = json.Unmarshal(kv.Value, &r); err != nil {
+			glog.Warningf("user %q is invalid (%v)", string(kv.Key), err)
+			continue
+		}
+		us = append(us, r.User)
+	}
+	return us, nil
+}
+
+// UpdateProfile replaces the profile of the user.
+func (s *Store) UpdateProfile(ctx context.Context, name string, p Profile) (User, error) {
+	return s.update(ctx, name, func(r *record) error {
+		r.Profile = p
+		return nil
+	})
+}
+
+// UpdateSettings merges the settings into the settings of the user.
+// Settings with empty values are deleted.
+func (s *Store) UpdateSettings(ctx context.Context, name string, settings map[string]string) (User, error) {
+	return s.update(ctx, name, func(r *record) error {
+		if r.Settings == nil {
+			r.Settings = make(map[string]string, len(settings))
+		}
+		for k, v := range settings {
+			if v == "" {
+				delete(r.Settings, k)
+			} else {
+				r.Settings[k] = v
+			}
+		}
+		return nil
+	})
+}
+
+// ChangePassword changes the password of the user,
+// after checking the current password.
+func (s *Store) ChangePassword(ctx context.Context, name, current, password string) error {
+	if len(password) < MinPasswordLen {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	_, err = s.update(ctx, name, func(r *record) error {
+		if bcrypt.CompareHashAndPassword(r.PasswordHash, []byte(current)) != nil {
+			return ErrUnauthorized
+		}
+		r.PasswordHash = hash
+		return nil
+	})
+	if err == nil {
+		glog.Infof("changed password of user %q", name)
+	}
+	return err
+}
+
+// update applies fn to the user, retrying on concurrent updates.
+func (s *Store) update(ctx context.Context, name string, fn func(*record) error) (User, error) {
+	if !valid(name) {
+		return User{}, ErrNotFound
+	}
+	for {
+		r, rev, err := s.get(ctx, name)
+		if err != nil {
+			return User{}, err
+		}
+		if err = fn(&r); err != nil {
+			return User{}, err
+		}
+		r.UpdatedAt = time.Now()
+		data, err := json.Marshal(r)
+		if err != nil {
+			return User{}, err
+		}
+
+		key := s.userKey(name)
+		resp, err := s.cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+			Then(clientv3.OpPut(key, string(data))).
+			Commit()
+		if err != nil {
+			return User{}, err
+		}
+		if resp.Succeeded {
+			return r.User, nil
+		}
+	}
+}
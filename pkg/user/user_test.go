@@ -0,0 +1,96 @@
+package user
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestStore(t *testing.T) {
+	dataDir, err := ioutil.TempDir(os.TempDir(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	qu, err := queue.NewEmbeddedQueue(context.Background(), 29379, 29380, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qu.Stop()
+
+	ctx := context.Background()
+	s := New(qu.Client(), Config{BcryptCost: bcrypt.MinCost})
+
+	u, err := s.Register(ctx, "alice", "correct horse", Profile{Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "alice" || u.Email != "alice@example.com" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if _, err = s.Register(ctx, "alice", "correct horse", Profile{}); err != ErrExists {
+		t.Fatalf("expected %v, got %v", ErrExists, err)
+	}
+	if _, err = s.Register(ctx, "Alice/1", "correct horse", Profile{}); err != ErrInvalidUser {
+		t.Fatalf("expected %v, got %v", ErrInvalidUser, err)
+	}
+	if _, err = s.Register(ctx, "bob", "short", Profile{}); err != ErrWeakPassword {
+		t.Fatalf("expected %v, got %v", ErrWeakPassword, err)
+	}
+	if _, err = s.Register(ctx, "bob", "battery staple", Profile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Authenticate(ctx, "alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range [][2]string{{"alice", "wrong password"}, {"carol", "correct horse"}} {
+		if _, err = s.Authenticate(ctx, tt[0], tt[1]); err != ErrUnauthorized {
+			t.Fatalf("%q: expected %v, got %v", tt[0], ErrUnauthorized, err)
+		}
+	}
+
+	if _, err = s.UpdateSettings(ctx, "alice", map[string]string{"theme": "dark", "lang": "en"}); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = s.UpdateSettings(ctx, "alice", map[string]string{"lang": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(u.Settings, map[string]string{"theme": "dark"}) {
+		t.Fatalf("unexpected settings %v", u.Settings)
+	}
+	if u, err = s.UpdateProfile(ctx, "alice", Profile{DisplayName: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "Alice" || u.Email != "" || u.Settings["theme"] != "dark" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if _, err = s.UpdateProfile(ctx, "carol", Profile{}); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+
+	if err = s.ChangePassword(ctx, "alice", "wrong password", "new password"); err != ErrUnauthorized {
+		t.Fatalf("expected %v, got %v", ErrUnauthorized, err)
+	}
+	if err = s.ChangePassword(ctx, "alice", "correct horse", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Authenticate(ctx, "alice", "new password"); err != nil {
+		t.Fatal(err)
+	}
+
+	us, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[0].Name != "alice" || us[1].Name != "bob" {
+		t.Fatalf("unexpected users %+v", us)
+	}
+}
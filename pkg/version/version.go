@@ -0,0 +1,52 @@
+// Package version defines build and version information.
+package version
+
+import (
+	"fmt"
+	"runtime"
+
+	etcdversion "github.com/coreos/etcd/version"
+)
+
+var (
+	// GitSHA is the git commit SHA, set at build time with
+	// '-ldflags "-X github.com/gyuho/dplearn/pkg/version.GitSHA=..."'.
+	GitSHA = "Not provided (use ./scripts/build.sh instead of go build)"
+
+	// BuildTime is the build timestamp, set at build time with
+	// '-ldflags "-X github.com/gyuho/dplearn/pkg/version.BuildTime=..."'.
+	BuildTime = "Not provided (use ./scripts/build.sh instead of go build)"
+)
+
+// Info represents build and version information.
+type Info struct {
+	GitSHA    string `json:"git_sha"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	GoOS      string `json:"go_os"`
+	GoArch    string `json:"go_arch"`
+
+	// EtcdServerVersion is the version reported by the etcd server.
+	// Empty if the server has not been queried.
+	EtcdServerVersion string `json:"etcd_server_version"`
+
+	// EtcdClientVersion is the version of vendored etcd client.
+	EtcdClientVersion string `json:"etcd_client_version"`
+}
+
+// Get returns the build and version information of the current binary.
+func Get() Info {
+	return Info{
+		GitSHA:            GitSHA,
+		BuildTime:         BuildTime,
+		GoVersion:         runtime.Version(),
+		GoOS:              runtime.GOOS,
+		GoArch:            runtime.GOARCH,
+		EtcdClientVersion: etcdversion.Version,
+	}
+}
+
+func (v Info) String() string {
+	return fmt.Sprintf("git SHA %s, build time %s, %s %s/%s, etcd server %q, etcd client %q",
+		v.GitSHA, v.BuildTime, v.GoVersion, v.GoOS, v.GoArch, v.EtcdServerVersion, v.EtcdClientVersion)
+}
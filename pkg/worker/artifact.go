@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArtifactStore stores large job outputs (e.g. generated images,
+// model checkpoints). 'blobstore.Backend' stores them in the local file
+// system, Cloud Storage, or S3.
+type ArtifactStore interface {
+	// Put stores the data with the key, and returns the object URI
+	// (e.g. "gs://bucket/prefix/key").
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+}
+
+// UploadArtifact uploads the output of the job with the name
+// (e.g. "output.png"), under the bucket and request ID of the item,
+// and records only the object URI in 'item.Value'. The frontend fetches
+// the artifact with the signed URL from the backend.
+func UploadArtifact(ctx context.Context, store ArtifactStore, item *Item, name string, r io.Reader, contentType string) error {
+	key := path.Join(strings.Trim(item.Bucket, "/"), item.RequestID, name)
+	uri, err := store.Put(ctx, key, r, contentType)
+	if err != nil {
+		return err
+	}
+	item.Value = uri
+	return nil
+}
+
+// UploadArtifactFile uploads the file as the output of the job,
+// with the content type from the file extension.
+func UploadArtifactFile(ctx context.Context, store ArtifactStore, item *Item, fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return UploadArtifact(ctx, store, item, filepath.Base(fpath), f, mime.TypeByExtension(filepath.Ext(fpath)))
+}
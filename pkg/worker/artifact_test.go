@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testStore struct {
+	key, contentType string
+	data             []byte
+}
+
+func (s *testStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.key, s.contentType, s.data = key, contentType, data
+	return "gs://test-bucket/v1/" + key, nil
+}
+
+func TestUploadArtifactFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "output.png")
+	if err = ioutil.WriteFile(fpath, []byte("png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testStore{}
+	item := &Item{Bucket: "/cats-request", RequestID: "req-1", Value: "/tmp/cat.jpg"}
+	if err = UploadArtifactFile(context.Background(), s, item, fpath); err != nil {
+		t.Fatal(err)
+	}
+	if s.key != "cats-request/req-1/output.png" || s.contentType != "image/png" || string(s.data) != "png" {
+		t.Fatalf("unexpected upload %+v", s)
+	}
+	if item.Value != "gs://test-bucket/v1/cats-request/req-1/output.png" {
+		t.Fatalf("unexpected value %q", item.Value)
+	}
+
+	if err = UploadArtifactFile(context.Background(), s, item, filepath.Join(dir, "missing.png")); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
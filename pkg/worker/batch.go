@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/glog"
+)
+
+// BatchHandlerFunc processes the items claimed at a time (e.g. batched
+// inference). It sets the result of each item in 'item.Value', or its error
+// in 'item.Error'. Returning an error completes all items with the error.
+// 'Progress' and 'Log' are not available for batches of more than one item.
+type BatchHandlerFunc func(ctx context.Context, items []*Item) error
+
+// HandleBatch registers the batch handler for the bucket, claiming up to
+// 'Config.BatchSize' items at a time. Items are claimed as soon as the
+// first one is available, without waiting for the batch to fill.
+func (w *Worker) HandleBatch(bucket string, fn BatchHandlerFunc) {
+	w.mu.Lock()
+	w.handlers[bucket] = handler{fn: fn, batch: w.cfg.BatchSize}
+	w.mu.Unlock()
+}
+
+// prioritize returns the buckets sorted by 'Config.Priorities',
+// the highest first.
+func (w *Worker) prioritize(buckets []string) []string {
+	ss := make([]string, len(buckets))
+	copy(ss, buckets)
+	sort.SliceStable(ss, func(i, j int) bool {
+		return w.cfg.Priorities[ss[i]] > w.cfg.Priorities[ss[j]]
+	})
+	return ss
+}
+
+// priorityLoop claims jobs from the prioritized buckets until 'claimCtx'
+// is canceled, and processes them until 'ctx' is canceled.
+func (w *Worker) priorityLoop(ctx, claimCtx context.Context, buckets []string, handlers map[string]handler) {
+	glog.Infof("worker started on %q by priority", buckets)
+	for {
+		bucket, items, err := w.claimPriority(claimCtx, buckets, handlers)
+		if err != nil {
+			if claimCtx.Err() != nil {
+				glog.Infof("worker stopped on %q", buckets)
+				return
+			}
+			glog.Warningf("failed to claim from %q (%v)", bucket, err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		w.process(ctx, bucket, items, handlers[bucket].fn)
+	}
+}
+
+// claimPriority claims from the bucket with the highest priority that has
+// pending jobs. If all buckets are empty, it waits on the highest-priority
+// bucket for 'Config.PollInterval', and returns no item if none is available.
+func (w *Worker) claimPriority(ctx context.Context, buckets []string, handlers map[string]handler) (string, []*Item, error) {
+	for _, bucket := range buckets {
+		items, err := w.claim(ctx, bucket, handlers[bucket].batch, 0)
+		if err != nil || len(items) > 0 {
+			return bucket, items, err
+		}
+	}
+	items, err := w.claim(ctx, buckets[0], handlers[buckets[0]].batch, w.cfg.PollInterval)
+	return buckets[0], items, err
+}
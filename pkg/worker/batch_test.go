@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// batchServer serves the items of each bucket in batch claims,
+// and records the completed items.
+type batchServer struct {
+	mu        sync.Mutex
+	items     map[string][]*Item
+	claims    []string
+	completed []Item
+	donec     chan struct{}
+	want      int
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := strings.TrimSuffix(req.URL.Path, "/queue")
+	switch req.Method {
+	case http.MethodGet:
+		q := req.URL.Query()
+		s.claims = append(s.claims, bucket+"?wait="+q.Get("wait"))
+		max, _ := strconv.Atoi(q.Get("max_items"))
+		n := len(s.items[bucket])
+		if n > max {
+			n = max
+		}
+		items := s.items[bucket][:n]
+		s.items[bucket] = s.items[bucket][n:]
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		var item Item
+		json.NewDecoder(req.Body).Decode(&item)
+		if item.Progress == queue.MaxProgress {
+			s.completed = append(s.completed, item)
+			if len(s.completed) == s.want {
+				close(s.donec)
+			}
+		}
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+func TestWorkerBatch(t *testing.T) {
+	s := &batchServer{items: make(map[string][]*Item), donec: make(chan struct{}), want: 3}
+	for _, v := range []string{"a", "b", "c"} {
+		s.items["/cats-request"] = append(s.items["/cats-request"], queue.CreateItem("/cats-request", 100, v))
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	// priorities poll the empty bucket, instead of blocking claims
+	w := New(Config{
+		Endpoint:            ts.URL,
+		BatchSize:           2,
+		Priorities:          map[string]int{"/cats-request": 1},
+		PollInterval:        10 * time.Millisecond,
+		DisableGPUDetection: true,
+	})
+	w.HandleBatch("/cats-request", func(ctx context.Context, items []*Item) error {
+		var vs []string
+		for _, item := range items {
+			vs = append(vs, item.Value)
+			item.Value += "!"
+		}
+		mu.Lock()
+		batches = append(batches, vs)
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	select {
+	case <-s.donec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to complete the jobs")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1, got %q", batches)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.completed {
+		if !strings.HasSuffix(item.Value, "!") || item.Error != "" {
+			t.Fatalf("unexpected completion %+v", item)
+		}
+	}
+}
+
+func TestWorkerPriorities(t *testing.T) {
+	s := &batchServer{items: make(map[string][]*Item), donec: make(chan struct{}), want: 3}
+	s.items["/low"] = []*Item{queue.CreateItem("/low", 100, "l1")}
+	s.items["/high"] = []*Item{queue.CreateItem("/high", 100, "h1"), queue.CreateItem("/high", 100, "h2")}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	w := New(Config{
+		Endpoint:            ts.URL,
+		Priorities:          map[string]int{"/high": 10},
+		PollInterval:        10 * time.Millisecond,
+		DisableGPUDetection: true,
+	})
+	handle := func(ctx context.Context, item *Item) error { return nil }
+	w.Handle("/low", handle)
+	w.Handle("/high", handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	select {
+	case <-s.donec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to complete the jobs")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var got []string
+	for _, item := range s.completed {
+		got = append(got, item.Value)
+	}
+	if strings.Join(got, ",") != "h1,h2,l1" {
+		t.Fatalf("expected higher priority first, got %q", got)
+	}
+	if s.claims[0] != "/high?wait=0s" {
+		t.Fatalf("expected the first claim on the higher priority, got %q", s.claims)
+	}
+}
@@ -0,0 +1,11 @@
+// Package worker implements the worker SDK that claims jobs from the queue service,
+// reports heartbeats and progress, and completes jobs with results.
+//
+//	w := worker.New(worker.Config{Endpoint: "http://localhost:2200"})
+//	w.Handle("/cats-request", func(ctx context.Context, item *worker.Item) error {
+//		worker.Progress(ctx, 50)
+//		item.Value = "it's a cat!"
+//		return nil
+//	})
+//	err := w.Run(ctx)
+package worker
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gyuho/dplearn/pkg/docker"
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	"github.com/golang/glog"
+)
+
+// JobScratchPrefix is the prefix of the job scratch directories, left by
+// the crashed workers to be removed with 'fileutil.CleanTempOrphans'.
+const JobScratchPrefix = "dplearn-job-"
+
+// DockerHandler returns the handler that runs each job in a new container
+// from the config, for isolation. The job is passed as JSON in "DPLEARN_JOB"
+// environment variable, and the container stdout becomes the job result.
+// If 'scratchDir' is not empty, a new temporary directory in it with
+// 'JobScratchPrefix' is mounted at "/scratch", and removed after the job.
+func DockerHandler(cli *docker.Client, cfg docker.ContainerConfig, scratchDir string) HandlerFunc {
+	return func(ctx context.Context, item *Item) error {
+		job, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		jc := cfg
+		jc.Env = append(append([]string{}, cfg.Env...), "DPLEARN_JOB="+string(job))
+		if scratchDir != "" {
+			dir, cleanup, err := fileutil.TempScopeIn(scratchDir, JobScratchPrefix)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			// writable by the container user
+			if err = os.Chmod(dir, 0777); err != nil {
+				return err
+			}
+			jc.Mounts = append(append([]docker.Mount{}, cfg.Mounts...), docker.Mount{Source: dir, Target: "/scratch"})
+			jc.Env = append(jc.Env, "DPLEARN_SCRATCH_DIR=/scratch")
+		}
+
+		var stdout, stderr bytes.Buffer
+		st, err := cli.Run(ctx, jc, &stdout, &stderr)
+		if stderr.Len() > 0 {
+			glog.Infof("[%s stderr] %s", item.RequestID, strings.TrimSpace(stderr.String()))
+		}
+		if err != nil {
+			return err
+		}
+		if st.OOMKilled {
+			return fmt.Errorf("job container OOM-killed on memory limit %d bytes", cfg.Memory)
+		}
+		if st.ExitCode != 0 {
+			return fmt.Errorf("job container exit status %d (%s)", st.ExitCode, lastLine(stderr.String()))
+		}
+		item.Value = strings.TrimSpace(stdout.String())
+		return nil
+	}
+}
+
+// lastLine returns the last non-empty line, usually the error message.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
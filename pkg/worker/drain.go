@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Drain stops claiming new jobs, and reports "draining" to the registry.
+// The jobs in process are completed before 'Run' returns, or canceled after
+// 'Config.DrainTimeout' (see 'Config.Checkpoint'), so that deploys do not
+// orphan in-flight jobs. It is safe to call Drain more than once.
+func (w *Worker) Drain() {
+	w.drainOnce.Do(func() {
+		glog.Infof("draining worker %q", w.id)
+		close(w.drainc)
+	})
+}
+
+// Preempt drains the worker before its machine is reclaimed (e.g. on the
+// preemption notice of the VM). Unlike 'Drain', the jobs canceled after
+// 'Config.DrainTimeout' are requeued to other workers, instead of failed.
+// Keep the drain timeout shorter than the notice (e.g. 30 seconds on GCE).
+func (w *Worker) Preempt() {
+	atomic.StoreInt32(&w.preempted, 1)
+	w.Drain()
+}
+
+// Draining returns the channel that is closed when the worker of the job
+// in the context starts draining, so that long-running handlers can save
+// their progress and return early. Returns nil outside handlers.
+func Draining(ctx context.Context) <-chan struct{} {
+	drainc, _ := ctx.Value(drainKey{}).(chan struct{})
+	return drainc
+}
+
+type drainKey struct{}
+
+// cancelOnDrain cancels the handler, if it does not return within the drain
+// timeout after the worker starts draining. The returned channel is closed
+// when the handler is canceled on drain.
+func (w *Worker) cancelOnDrain(ctx context.Context, cancel context.CancelFunc, label string) <-chan struct{} {
+	drainedc := make(chan struct{})
+	go func() {
+		select {
+		case <-w.drainc:
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(w.cfg.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			glog.Warningf("canceling %q (not completed in drain timeout %v)", label, w.cfg.DrainTimeout)
+			close(drainedc)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return drainedc
+}
@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+)
+
+func TestDrain(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		timeout    time.Duration
+		checkpoint bool
+		preempt    bool
+	}{
+		{"finish", time.Minute, false, false},
+		{"checkpoint", 10 * time.Millisecond, true, false},
+		{"preempt", 10 * time.Millisecond, true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				claims   int
+				draining bool
+				done     *Item
+			)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case req.URL.Path == "/workers":
+					var l workerproc.Liveness
+					if err := json.NewDecoder(req.Body).Decode(&l); err != nil {
+						t.Fatal(err)
+					}
+					draining = draining || l.Draining
+				case req.Method == http.MethodGet:
+					claims++
+					if claims == 1 {
+						json.NewEncoder(w).Encode(queue.CreateItem("/cats-request", 100, "hello"))
+						return
+					}
+					mu.Unlock()
+					<-req.Context().Done()
+					mu.Lock()
+				case req.Method == http.MethodPost:
+					var item Item
+					if err := json.NewDecoder(req.Body).Decode(&item); err != nil {
+						t.Fatal(err)
+					}
+					if item.Progress == queue.MaxProgress {
+						done = &item
+					}
+					json.NewEncoder(w).Encode(item)
+				}
+			}))
+			defer ts.Close()
+
+			var checkpointed string
+			w := New(Config{
+				Endpoint:            ts.URL,
+				RegistryEndpoint:    ts.URL + "/workers",
+				HeartbeatInterval:   time.Hour,
+				DisableGPUDetection: true,
+				DrainTimeout:        tt.timeout,
+				Checkpoint: func(ctx context.Context, item *Item) error {
+					checkpointed = item.Value
+					return nil
+				},
+			})
+			startc := make(chan struct{})
+			w.Handle("/cats-request", func(ctx context.Context, item *Item) error {
+				close(startc)
+				<-Draining(ctx)
+				// wait for the report, before the worker exits
+				for {
+					mu.Lock()
+					reported := draining
+					mu.Unlock()
+					if reported {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+				item.Value = "partial"
+				if tt.checkpoint {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				item.Value = "world"
+				return nil
+			})
+
+			errc := make(chan error, 1)
+			go func() { errc <- w.Run(context.Background()) }()
+			select {
+			case <-startc:
+			case <-time.After(5 * time.Second):
+				t.Fatal("took too long to claim the job")
+			}
+			if tt.preempt {
+				w.Preempt()
+			}
+			w.Drain()
+			w.Drain()
+			select {
+			case err := <-errc:
+				if err != nil {
+					t.Fatalf("expected nil on drain, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("took too long to drain")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !draining {
+				t.Fatal("expected draining report to the registry")
+			}
+			if claims != 1 {
+				t.Fatalf("expected no claims after drain, got %d claims", claims)
+			}
+			if done == nil {
+				t.Fatal("expected the job in process to be completed")
+			}
+			if !tt.checkpoint {
+				if done.Value != "world" || done.Error != "" || checkpointed != "" {
+					t.Fatalf("unexpected completion %+v (checkpointed %q)", done, checkpointed)
+				}
+				return
+			}
+			if tt.preempt {
+				// requeued to other workers
+				if checkpointed != "partial" || !done.Requeue || !strings.HasPrefix(done.Error, "worker preempted before completing the job") {
+					t.Fatalf("unexpected completion %+v (checkpointed %q)", done, checkpointed)
+				}
+				return
+			}
+			if checkpointed != "partial" || done.Requeue || !strings.HasPrefix(done.Error, "worker shut down before completing the job") {
+				t.Fatalf("unexpected completion %+v (checkpointed %q)", done, checkpointed)
+			}
+		})
+	}
+}
+
+func TestDrainRequested(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/workers" {
+			<-req.Context().Done()
+			return
+		}
+		var l workerproc.Liveness
+		if err := json.NewDecoder(req.Body).Decode(&l); err != nil {
+			t.Fatal(err)
+		}
+		// the coordinator decided to drain the worker
+		l.Drain = true
+		json.NewEncoder(w).Encode(l)
+	}))
+	defer ts.Close()
+
+	w := New(Config{
+		Endpoint:            ts.URL,
+		RegistryEndpoint:    ts.URL + "/workers",
+		HeartbeatInterval:   time.Hour,
+		DisableGPUDetection: true,
+	})
+	w.Handle("/cats-request", func(ctx context.Context, item *Item) error { return nil })
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("expected nil on drain, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to drain")
+	}
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GPU describes the NVIDIA GPU on the host.
+type GPU struct {
+	Index    int
+	Name     string
+	MemoryMB int
+}
+
+// cudaVersionPath is the CUDA toolkit version file.
+var cudaVersionPath = "/usr/local/cuda/version.txt"
+
+// DetectGPUs returns the NVIDIA GPUs on the host, using "nvidia-smi".
+// It returns no GPU if "nvidia-smi" is not installed.
+func DetectGPUs(ctx context.Context) ([]GPU, error) {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu=index,name,memory.total",
+		"--format=csv,noheader,nounits",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi failed (%v)", err)
+	}
+	return parseNvidiaSMI(out)
+}
+
+// parseNvidiaSMI parses "nvidia-smi --query-gpu=index,name,memory.total --format=csv,noheader,nounits".
+func parseNvidiaSMI(out []byte) ([]GPU, error) {
+	var gpus []GPU
+	for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		idx, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected GPU index %q (%v)", fields[0], err)
+		}
+		mem, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected GPU memory %q (%v)", fields[2], err)
+		}
+		gpus = append(gpus, GPU{Index: idx, Name: strings.TrimSpace(fields[1]), MemoryMB: mem})
+	}
+	return gpus, nil
+}
+
+// CUDAVersion returns the installed CUDA toolkit version (e.g. "9.0.176"),
+// or empty string if CUDA is not installed.
+func CUDAVersion() string {
+	b, err := ioutil.ReadFile(cudaVersionPath)
+	if err != nil {
+		return ""
+	}
+	// "CUDA Version 9.0.176"
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(b)), "CUDA Version"))
+}
+
+// GPULabels returns the worker registry labels for the GPUs.
+func GPULabels(gpus []GPU, cudaVersion string) map[string]string {
+	labels := map[string]string{"gpu": strconv.FormatBool(len(gpus) > 0)}
+	if len(gpus) > 0 {
+		labels["gpu.count"] = strconv.Itoa(len(gpus))
+		labels["gpu.model"] = gpus[0].Name
+		labels["gpu.memory_mb"] = strconv.Itoa(gpus[0].MemoryMB)
+	}
+	if cudaVersion != "" {
+		labels["cuda.version"] = cudaVersion
+	}
+	return labels
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNvidiaSMI(t *testing.T) {
+	out := []byte("0, Tesla K80, 11441\n1, Tesla K80, 11441\n")
+	gpus, err := parseNvidiaSMI(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []GPU{
+		{Index: 0, Name: "Tesla K80", MemoryMB: 11441},
+		{Index: 1, Name: "Tesla K80", MemoryMB: 11441},
+	}
+	if !reflect.DeepEqual(gpus, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, gpus)
+	}
+
+	if _, err = parseNvidiaSMI([]byte("No devices were found")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestGPULabels(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "worker-cuda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := cudaVersionPath
+	defer func() { cudaVersionPath = old }()
+	cudaVersionPath = filepath.Join(dir, "version.txt")
+	if v := CUDAVersion(); v != "" {
+		t.Fatalf("expected no CUDA, got %q", v)
+	}
+	if err = ioutil.WriteFile(cudaVersionPath, []byte("CUDA Version 9.0.176\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := GPULabels([]GPU{{Index: 0, Name: "Tesla K80", MemoryMB: 11441}}, CUDAVersion())
+	exp := map[string]string{
+		"gpu":           "true",
+		"gpu.count":     "1",
+		"gpu.model":     "Tesla K80",
+		"gpu.memory_mb": "11441",
+		"cuda.version":  "9.0.176",
+	}
+	if !reflect.DeepEqual(labels, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, labels)
+	}
+
+	labels = GPULabels(nil, "")
+	if !reflect.DeepEqual(labels, map[string]string{"gpu": "false"}) {
+		t.Fatalf("unexpected labels %+v", labels)
+	}
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/kube"
+
+	"github.com/golang/glog"
+)
+
+// progressLine matches progress lines in the job logs (e.g. "progress: 30").
+var progressLine = regexp.MustCompile(`(?im)^progress[:=]\s*(\d+)\s*$`)
+
+// KubernetesJobHandler returns the handler that runs each job as a Kubernetes Job
+// from the spec (e.g. heavy training tasks), instead of always-on workers.
+// The job is passed as JSON in "DPLEARN_JOB" environment variable. Pod status
+// and "progress: N" lines in the pod logs are reported as the job progress,
+// and the last line of the logs becomes the job result. The Kubernetes Job
+// is deleted when the handler returns, or when the job is canceled.
+func KubernetesJobHandler(cli *kube.Client, namespace string, spec kube.JobSpec, pollInterval time.Duration) HandlerFunc {
+	if pollInterval == 0 {
+		pollInterval = 5 * time.Second
+	}
+	return func(ctx context.Context, item *Item) error {
+		job, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		js := spec
+		js.Env = map[string]string{"DPLEARN_JOB": string(job)}
+		for k, v := range spec.Env {
+			js.Env[k] = v
+		}
+
+		name := JobName(item)
+		err = cli.CreateJob(ctx, namespace, name, js)
+		switch {
+		case kube.IsAlreadyExists(err):
+			// resumed after worker restart
+			glog.Infof("resuming Kubernetes job %q", name)
+		case err != nil:
+			return err
+		default:
+			glog.Infof("created Kubernetes job %q", name)
+		}
+		defer func() {
+			// delete with a fresh context, since the job context may be canceled
+			dctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := cli.DeleteJob(dctx, namespace, name); err != nil {
+				glog.Warningf("failed to delete Kubernetes job %q (%v)", name, err)
+			}
+			cancel()
+		}()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		progress := -1
+		for {
+			st, err := cli.GetJob(ctx, namespace, name)
+			if err != nil {
+				return err
+			}
+			pods, err := cli.JobPods(ctx, namespace, name)
+			if err != nil {
+				return err
+			}
+			var logs string
+			if len(pods) > 0 {
+				// the latest pod on retries
+				pod := pods[len(pods)-1]
+				if pod.Phase != "Pending" {
+					if logs, err = cli.PodLogs(ctx, namespace, pod.Name, 100); err != nil {
+						glog.Warningf("failed to get logs of %q (%v)", pod.Name, err)
+					}
+				}
+				if p := jobProgress(pod.Phase, logs); p != progress {
+					progress = p
+					Progress(ctx, p)
+				}
+			}
+
+			if st.Succeeded > 0 {
+				item.Value = lastLine(progressLine.ReplaceAllString(logs, ""))
+				return nil
+			}
+			if c, failed := st.FailedCondition(); failed {
+				return fmt.Errorf("job %q failed on Kubernetes (%s: %s)", name, c.Reason, c.Message)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// jobProgress returns the progress from the pod phase and logs.
+func jobProgress(phase, logs string) int {
+	if phase == "Pending" {
+		return 0
+	}
+	p := 1
+	if ms := progressLine.FindAllStringSubmatch(logs, -1); len(ms) > 0 {
+		p, _ = strconv.Atoi(ms[len(ms)-1][1])
+	}
+	return p
+}
+
+// JobName returns the Kubernetes resource name for the job,
+// as lower case alphanumeric characters or '-' up to 63 characters.
+func JobName(item *Item) string {
+	id := item.RequestID
+	if id == "" {
+		id = item.Key
+	}
+	name := "dplearn-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(id))
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimRight(name, "-")
+}
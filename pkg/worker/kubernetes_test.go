@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gyuho/dplearn/pkg/kube"
+)
+
+func TestKubernetesJobHandler(t *testing.T) {
+	var mu sync.Mutex
+	var created map[string]interface{}
+	polls, deleted := 0, false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/apis/batch/v1/namespaces/default/jobs":
+			if err := json.NewDecoder(req.Body).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case req.Method == http.MethodGet && req.URL.Path == "/apis/batch/v1/namespaces/default/jobs/dplearn-req-1":
+			polls++
+			if polls < 2 {
+				w.Write([]byte(`{"status":{"active":1}}`))
+			} else {
+				w.Write([]byte(`{"status":{"succeeded":1}}`))
+			}
+		case req.URL.Path == "/api/v1/namespaces/default/pods":
+			if req.URL.Query().Get("labelSelector") != "job-name=dplearn-req-1" {
+				t.Fatalf("unexpected selector %q", req.URL.RawQuery)
+			}
+			w.Write([]byte(`{"items":[{"metadata":{"name":"dplearn-req-1-abcde"},"status":{"phase":"Running"}}]}`))
+		case req.URL.Path == "/api/v1/namespaces/default/pods/dplearn-req-1-abcde/log":
+			if polls < 2 {
+				w.Write([]byte("epoch 1\nprogress: 40\n"))
+			} else {
+				w.Write([]byte("epoch 1\nprogress: 40\nprogress: 90\naccuracy 0.95\n"))
+			}
+		case req.Method == http.MethodDelete:
+			deleted = true
+			w.Write([]byte(`{}`))
+		default:
+			t.Fatalf("unexpected request %s %q", req.Method, req.URL)
+		}
+	}))
+	defer ts.Close()
+
+	var progress []int
+	r := &reporter{item: &Item{}}
+	r.w = New(Config{Endpoint: "http://localhost:0"})
+	ctx := context.WithValue(context.Background(), reporterKey{}, r)
+	// record progress without reporting to the backend
+	r.w.cfg.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var it Item
+		json.NewDecoder(req.Body).Decode(&it)
+		progress = append(progress, it.Progress)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+	r.ctx = ctx
+
+	h := KubernetesJobHandler(kube.NewClient(ts.URL, "", nil), "default", kube.JobSpec{Image: "train", GPUs: 1}, 1)
+	item := &Item{Key: "/train-request/1", RequestID: "req-1", Value: "data"}
+	if err := h(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Value != "accuracy 0.95" {
+		t.Fatalf("unexpected value %q", item.Value)
+	}
+	if len(progress) != 2 || progress[0] != 40 || progress[1] != 90 {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !deleted {
+		t.Fatal("expected job deleted")
+	}
+	b, _ := json.Marshal(created)
+	for _, s := range []string{`"nvidia.com/gpu":"1"`, `"name":"DPLEARN_JOB"`, `"restartPolicy":"Never"`} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("expected %s in manifest %s", s, b)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestJobName(t *testing.T) {
+	if n := JobName(&Item{RequestID: "A1_b2.C3"}); n != "dplearn-a1-b2-c3" {
+		t.Fatalf("unexpected name %q", n)
+	}
+	if n := JobName(&Item{RequestID: strings.Repeat("a", 100)}); len(n) != 63 {
+		t.Fatalf("unexpected name length %d", len(n))
+	}
+}
@@ -0,0 +1,213 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SidecarSocketEnv is the environment variable with the unix socket path
+// that the sidecar model server listens on.
+const SidecarSocketEnv = "DPLEARN_SIDECAR_SOCKET"
+
+// SidecarConfig configures the model server run as a sidecar process
+// (e.g. "python3 backend/worker/model_server.py"). The model server only
+// serves predictions over HTTP on the unix socket, while the worker claims
+// jobs from the queue and reports progress:
+//
+//	GET  /healthz  returns 200 once the model is loaded
+//	POST /predict  {"request_id", "job_type", "value"}
+//	               returns {"value", "error", "logs"}
+type SidecarConfig struct {
+	// Command and Args run the sidecar. Empty Command connects to the
+	// model server already serving on the Socket (e.g. in another container).
+	Command string
+	Args    []string
+
+	// Socket is the unix socket path, passed to the sidecar in
+	// "DPLEARN_SIDECAR_SOCKET". Defaults to a file in the temporary directory.
+	Socket string
+
+	// StartTimeout is the duration to wait for the sidecar to be ready
+	// (e.g. loading model parameters). Defaults to 2 minutes.
+	StartTimeout time.Duration
+}
+
+// Sidecar is the model server process, serving on the unix socket.
+type Sidecar struct {
+	cfg    SidecarConfig
+	cmd    *exec.Cmd
+	client *http.Client
+
+	donec chan struct{}
+	err   error
+}
+
+// StartSidecar starts the sidecar process, and waits until it is ready.
+func StartSidecar(ctx context.Context, cfg SidecarConfig) (*Sidecar, error) {
+	if cfg.Socket == "" {
+		cfg.Socket = filepath.Join(os.TempDir(), fmt.Sprintf("dplearn-sidecar-%d.sock", os.Getpid()))
+	}
+	if cfg.StartTimeout == 0 {
+		cfg.StartTimeout = 2 * time.Minute
+	}
+
+	s := &Sidecar{
+		cfg: cfg,
+		client: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", cfg.Socket)
+			},
+		}},
+		donec: make(chan struct{}),
+	}
+	if cfg.Command != "" {
+		s.cmd = exec.Command(cfg.Command, cfg.Args...)
+		s.cmd.Env = append(os.Environ(), SidecarSocketEnv+"="+cfg.Socket)
+		s.cmd.Stdout, s.cmd.Stderr = os.Stdout, os.Stderr
+		glog.Infof("starting sidecar %q on %q", cfg.Command, cfg.Socket)
+		if err := s.cmd.Start(); err != nil {
+			return nil, err
+		}
+		go func() {
+			s.err = s.cmd.Wait()
+			close(s.donec)
+		}()
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, cfg.StartTimeout)
+	defer cancel()
+	for {
+		err := s.healthy(tctx)
+		if err == nil {
+			glog.Infof("sidecar is ready on %q", cfg.Socket)
+			return s, nil
+		}
+		select {
+		case <-s.donec:
+			return nil, fmt.Errorf("sidecar exited before ready (%v)", s.err)
+		case <-tctx.Done():
+			s.Stop()
+			return nil, fmt.Errorf("sidecar is not ready in %v (%v)", cfg.StartTimeout, err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func (s *Sidecar) healthy(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, "http://sidecar/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sidecar returned %q", resp.Status)
+	}
+	return nil
+}
+
+// Done returns the channel closed when the sidecar process exits.
+func (s *Sidecar) Done() <-chan struct{} { return s.donec }
+
+// Err returns the exit error of the sidecar process, after Done is closed.
+func (s *Sidecar) Err() error { return s.err }
+
+// Stop terminates the sidecar process, and removes the socket.
+func (s *Sidecar) Stop() error {
+	defer os.Remove(s.cfg.Socket)
+	if s.cmd == nil || s.cmd.Process == nil {
+		return nil
+	}
+	select {
+	case <-s.donec:
+		return nil
+	default:
+	}
+	s.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-s.donec:
+	case <-time.After(10 * time.Second):
+		s.cmd.Process.Kill()
+		<-s.donec
+	}
+	return nil
+}
+
+// sidecarRequest is the prediction request to the sidecar.
+type sidecarRequest struct {
+	RequestID string `json:"request_id"`
+	JobType   string `json:"job_type"`
+	Value     string `json:"value"`
+}
+
+// sidecarResponse is the prediction response from the sidecar.
+type sidecarResponse struct {
+	Value string   `json:"value"`
+	Error string   `json:"error"`
+	Logs  []string `json:"logs"`
+}
+
+// Handler returns the handler that translates the job into the prediction
+// request to the sidecar, and sets the prediction in 'item.Value'.
+func (s *Sidecar) Handler() HandlerFunc {
+	return func(ctx context.Context, item *Item) error {
+		data, err := json.Marshal(sidecarRequest{RequestID: item.RequestID, JobType: item.JobType, Value: item.Value})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, "http://sidecar/predict", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.client.Do(req.WithContext(ctx))
+		if err != nil {
+			select {
+			case <-s.donec:
+				return fmt.Errorf("sidecar exited (%v)", s.err)
+			default:
+			}
+			return err
+		}
+		rb, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("sidecar returned %q (%s)", resp.Status, string(rb))
+		}
+
+		var sresp sidecarResponse
+		if err = json.Unmarshal(rb, &sresp); err != nil {
+			return fmt.Errorf("sidecar returned invalid JSON %q (%v)", string(rb), err)
+		}
+		for _, line := range sresp.Logs {
+			Log(ctx, "%s", line)
+		}
+		if sresp.Error != "" {
+			return fmt.Errorf("%s", sresp.Error)
+		}
+		item.Value = sresp.Value
+		return nil
+	}
+}
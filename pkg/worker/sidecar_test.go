@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecar(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "sidecar.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {})
+	mux.HandleFunc("/predict", func(w http.ResponseWriter, req *http.Request) {
+		var sreq sidecarRequest
+		if err := json.NewDecoder(req.Body).Decode(&sreq); err != nil {
+			t.Fatal(err)
+		}
+		resp := sidecarResponse{Value: "it's a cat!", Logs: []string{"classified"}}
+		if sreq.JobType != "cats-vs-dogs" {
+			resp = sidecarResponse{Error: "job type " + sreq.JobType + " is not supported"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	hs := &http.Server{Handler: mux}
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	s, err := StartSidecar(context.Background(), SidecarConfig{Socket: sock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.Handler()
+
+	item := &Item{RequestID: "req-1", JobType: "cats-vs-dogs", Value: "/tmp/cat.jpg"}
+	if err = h(context.Background(), item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Value != "it's a cat!" {
+		t.Fatalf("unexpected value %q", item.Value)
+	}
+
+	item = &Item{RequestID: "req-2", JobType: "unknown", Value: "/tmp/cat.jpg"}
+	if err = h(context.Background(), item); err == nil || err.Error() != "job type unknown is not supported" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSidecarExit(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = StartSidecar(context.Background(), SidecarConfig{
+		Command: "sh",
+		Args:    []string{"-c", "exit 1"},
+		Socket:  filepath.Join(dir, "sidecar.sock"),
+	})
+	if err == nil {
+		t.Fatal("expected error on sidecar exit")
+	}
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+// Stage is the named stage of the job, weighted relative to other stages.
+type Stage = queue.Stage
+
+// DeclareStages declares the stages of the job being handled in the context,
+// in order, starting the first stage. The stages must be declared once per job,
+// before reporting with ReportStage:
+//
+//	worker.DeclareStages(ctx, worker.Stage{Name: "download", Weight: 1}, worker.Stage{Name: "inference", Weight: 3})
+//	worker.ReportStage(ctx, "download", 100)
+//	worker.ReportStage(ctx, "inference", 50)
+func DeclareStages(ctx context.Context, stages ...Stage) error {
+	if len(stages) == 0 {
+		return fmt.Errorf("no stages")
+	}
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return fmt.Errorf("no job in context")
+	}
+	return r.reportStage(&queue.StageProgress{Stages: stages, Current: stages[0].Name}, true)
+}
+
+// ReportStage reports the progress of the stage, from 0 to 100, of the job
+// being handled in the context. The overall progress is derived from the
+// stage weights.
+func ReportStage(ctx context.Context, name string, percent int) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return fmt.Errorf("no job in context")
+	}
+	r.mu.Lock()
+	var stages []Stage
+	if r.item.StageProgress != nil {
+		stages = r.item.StageProgress.Stages
+	}
+	r.mu.Unlock()
+	if len(stages) == 0 {
+		return fmt.Errorf("no stages declared")
+	}
+	return r.reportStage(&queue.StageProgress{Stages: stages, Current: name, Percent: percent}, false)
+}
+
+// reportStage reports the stage progress, if it follows the previous report.
+// If 'declare' is true, no stages must have been declared.
+func (r *reporter) reportStage(sp *queue.StageProgress, declare bool) error {
+	p, err := sp.Progress()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	switch {
+	case declare && r.item.StageProgress != nil:
+		err = fmt.Errorf("stages already declared")
+	default:
+		err = sp.Follows(r.item.StageProgress)
+	}
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.item.StageProgress, r.item.Progress = sp, p
+	copied := *r.item
+	r.mu.Unlock()
+	return r.w.report(r.ctx, r.bucket, copied)
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStages(t *testing.T) {
+	var updates []Item
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var item Item
+		if err := json.NewDecoder(req.Body).Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+		updates = append(updates, item)
+		json.NewEncoder(w).Encode(item)
+	}))
+	defer ts.Close()
+
+	w := New(Config{Endpoint: ts.URL})
+	ctx := context.Background()
+	r := &reporter{w: w, ctx: ctx, bucket: "/cats-request", item: &Item{RequestID: "req-1"}}
+	ctx = context.WithValue(ctx, reporterKey{}, r)
+
+	if err := ReportStage(ctx, "download", 100); err == nil {
+		t.Fatal("expected error before declaring stages")
+	}
+	if err := DeclareStages(ctx, Stage{Name: "download", Weight: 1}, Stage{Name: "inference", Weight: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeclareStages(ctx, Stage{Name: "download", Weight: 1}); err == nil {
+		t.Fatal("expected error on declaring stages twice")
+	}
+	if err := ReportStage(ctx, "download", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReportStage(ctx, "inference", 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReportStage(ctx, "download", 100); err == nil {
+		t.Fatal("expected error on going back to previous stage")
+	}
+	if err := ReportStage(ctx, "unknown", 0); err == nil {
+		t.Fatal("expected error on unknown stage")
+	}
+
+	var progress []int
+	for _, item := range updates {
+		progress = append(progress, item.Progress)
+	}
+	if len(progress) != 3 || progress[0] != 0 || progress[1] != 25 || progress[2] != 62 {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+	if sp := updates[2].StageProgress; sp == nil || sp.Current != "inference" || sp.Percent != 50 {
+		t.Fatalf("unexpected stage progress %+v", sp)
+	}
+}
@@ -0,0 +1,686 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+	"github.com/gyuho/dplearn/pkg/workerproc"
+
+	"github.com/golang/glog"
+)
+
+// Item is the job item in the queue.
+type Item = queue.Item
+
+// HandlerFunc processes the claimed item. It sets the result in 'item.Value'.
+// Returning an error completes the job with the error message.
+type HandlerFunc func(ctx context.Context, item *Item) error
+
+// Config defines worker configuration.
+type Config struct {
+	// Endpoint is the backend web server endpoint (e.g. "http://localhost:2200").
+	// Jobs in bucket "/cats-request" are claimed from "/cats-request/queue".
+	Endpoint string
+
+	// HeartbeatInterval is the interval to report the current progress
+	// while the handler is running. Defaults to 10 seconds.
+	HeartbeatInterval time.Duration
+
+	// RetryInterval is the initial backoff on connection errors,
+	// doubled on each failure up to 'MaxRetryInterval'. Defaults to 1 second.
+	RetryInterval time.Duration
+	// MaxRetryInterval defaults to 30 seconds.
+	MaxRetryInterval time.Duration
+
+	// Capabilities are the job types the worker can process
+	// (e.g. "cats-vs-dogs", "gpu"). Empty to process any job.
+	Capabilities []string
+
+	// Concurrency is the number of jobs to process concurrently per bucket
+	// (in total with 'Priorities'). Defaults to 1.
+	Concurrency int
+
+	// BatchSize is the maximum number of items to claim at a time for the
+	// handlers registered with 'HandleBatch' (e.g. batched inference).
+	// Defaults to 1, and at most 'etcdqueue.MaxBatchSize'.
+	BatchSize int
+	// Priorities are the priorities of the buckets (zero by default).
+	// If not empty, jobs are claimed from the bucket with the highest
+	// priority that has pending jobs, instead of from each bucket in turn.
+	Priorities map[string]int
+	// PollInterval is the duration to wait on the highest-priority bucket
+	// with 'Priorities', before checking other buckets again when all
+	// buckets are empty. Defaults to 1 second.
+	PollInterval time.Duration
+
+	// Client is the HTTP client. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Name is the worker name in the worker registry. Defaults to "worker".
+	Name string
+	// RegistryEndpoint is the worker registry endpoint
+	// (e.g. "http://localhost:2200/workers"). If not empty, the worker
+	// reports its liveness with host labels every HeartbeatInterval.
+	RegistryEndpoint string
+	// RegistryToken is sent with the liveness reports, when the
+	// registry requires a worker token.
+	RegistryToken string
+	// Labels are reported in addition to the detected GPU labels.
+	Labels map[string]string
+	// DisableGPUDetection disables GPU detection with "nvidia-smi".
+	// Otherwise, the worker with GPUs adds "gpu" to its capabilities,
+	// so that GPU jobs are delivered to it first.
+	DisableGPUDetection bool
+
+	// DrainTimeout is the duration that jobs in process may take to finish
+	// after 'Drain', before their handler contexts are canceled.
+	// Keep it shorter than the shutdown grace period of the deployment
+	// (e.g. "terminationGracePeriodSeconds"). Defaults to 25 seconds.
+	DrainTimeout time.Duration
+	// JobTimeout is the maximum duration of each job (of each batch with
+	// 'HandleBatch'). The handler context is canceled at the deadline, and
+	// the job is reported as timed out, so that the queue retries the job
+	// or moves it to the dead letter bucket. Zero for no timeout.
+	JobTimeout time.Duration
+
+	// Checkpoint is called with the job whose handler is canceled on drain
+	// or timeout, to save its partial results (e.g. to storage) before the
+	// job is completed with the error. Optional.
+	Checkpoint HandlerFunc
+}
+
+// Worker claims jobs from the queue and runs registered handlers.
+type Worker struct {
+	cfg Config
+	// id identifies the worker in the registry and the queue.
+	id string
+
+	mu       sync.Mutex
+	handlers map[string]handler
+
+	drainOnce sync.Once
+	drainc    chan struct{}
+	// preempted is 1 if the worker drains on preemption.
+	preempted int32
+}
+
+// New creates a new worker.
+func New(cfg Config) *Worker {
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = 10 * time.Second
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = time.Second
+	}
+	if cfg.MaxRetryInterval == 0 {
+		cfg.MaxRetryInterval = 30 * time.Second
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Name == "" {
+		cfg.Name = "worker"
+	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = 25 * time.Second
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.BatchSize > queue.MaxBatchSize {
+		cfg.BatchSize = queue.MaxBatchSize
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Second
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	host, _ := os.Hostname()
+	return &Worker{
+		cfg:      cfg,
+		id:       fmt.Sprintf("%s-%s-%d", host, cfg.Name, os.Getpid()),
+		handlers: make(map[string]handler),
+		drainc:   make(chan struct{}),
+	}
+}
+
+// single returns the batch handler of one item.
+func single(fn HandlerFunc) BatchHandlerFunc {
+	return func(ctx context.Context, items []*Item) error {
+		return fn(ctx, items[0])
+	}
+}
+
+// handler processes the items claimed at a time, up to 'batch'.
+type handler struct {
+	fn    BatchHandlerFunc
+	batch int
+}
+
+// Handle registers the handler for the bucket (e.g. "/cats-request").
+func (w *Worker) Handle(bucket string, fn HandlerFunc) {
+	w.mu.Lock()
+	w.handlers[bucket] = handler{fn: single(fn), batch: 1}
+	w.mu.Unlock()
+}
+
+// Run claims and processes jobs until the context is canceled,
+// or returns nil once the worker is drained (see 'Drain').
+func (w *Worker) Run(ctx context.Context) error {
+	w.mu.Lock()
+	if len(w.handlers) == 0 {
+		w.mu.Unlock()
+		return fmt.Errorf("no handler registered")
+	}
+	handlers := make(map[string]handler, len(w.handlers))
+	for k, v := range w.handlers {
+		handlers[k] = v
+	}
+	w.mu.Unlock()
+
+	labels := w.introspect(ctx)
+	buckets := make([]string, 0, len(handlers))
+	for bucket := range handlers {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	// keep reporting liveness until the jobs in process are completed
+	regCtx, regCancel := context.WithCancel(ctx)
+	regDonec := make(chan struct{})
+	go func() {
+		defer close(regDonec)
+		if w.cfg.RegistryEndpoint != "" {
+			w.register(regCtx, labels, buckets)
+		}
+	}()
+
+	// claims stop on drain, while the jobs in process continue
+	claimCtx, claimCancel := context.WithCancel(ctx)
+	defer claimCancel()
+	go func() {
+		select {
+		case <-w.drainc:
+			claimCancel()
+		case <-claimCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	if len(w.cfg.Priorities) > 0 {
+		prioritized := w.prioritize(buckets)
+		for i := 0; i < w.cfg.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.priorityLoop(ctx, claimCtx, prioritized, handlers)
+			}()
+		}
+	} else {
+		for bucket, h := range handlers {
+			for i := 0; i < w.cfg.Concurrency; i++ {
+				wg.Add(1)
+				go func(bucket string, h handler) {
+					defer wg.Done()
+					w.loop(ctx, claimCtx, bucket, h)
+				}(bucket, h)
+			}
+		}
+	}
+	wg.Wait()
+	regCancel()
+	<-regDonec
+	if ctx.Err() == nil {
+		glog.Infof("worker %q is drained", w.id)
+	}
+	return ctx.Err()
+}
+
+// introspect detects GPUs on the host, and returns the host labels.
+func (w *Worker) introspect(ctx context.Context) map[string]string {
+	labels := make(map[string]string)
+	if !w.cfg.DisableGPUDetection {
+		gpus, err := DetectGPUs(ctx)
+		if err != nil {
+			glog.Warningf("failed to detect GPUs (%v)", err)
+		}
+		for k, v := range GPULabels(gpus, CUDAVersion()) {
+			labels[k] = v
+		}
+		if len(gpus) > 0 {
+			glog.Infof("detected %d GPU(s) %q", len(gpus), gpus[0].Name)
+			// empty capabilities already process any job
+			if len(w.cfg.Capabilities) > 0 && !hasCapability(w.cfg.Capabilities, queue.GPUJobType) {
+				w.cfg.Capabilities = append(w.cfg.Capabilities, queue.GPUJobType)
+			}
+		}
+	}
+	for k, v := range w.cfg.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func hasCapability(caps []string, c string) bool {
+	for _, v := range caps {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// register reports the worker liveness to the registry until the context is canceled.
+func (w *Worker) register(ctx context.Context, labels map[string]string, buckets []string) {
+	host, _ := os.Hostname()
+	r := &workerproc.HTTPReporter{Endpoint: w.cfg.RegistryEndpoint, Token: w.cfg.RegistryToken, Client: w.cfg.Client}
+	r.OnReply = func(reply workerproc.Liveness) {
+		if reply.Drain {
+			glog.Infof("registry requested worker %q to drain", w.id)
+			w.Drain()
+		}
+	}
+	l := workerproc.Liveness{
+		ID:       w.id,
+		Name:     w.cfg.Name,
+		Host:     host,
+		PID:      os.Getpid(),
+		Alive:    true,
+		Labels:   labels,
+		Buckets:  buckets,
+		Protocol: queue.ProtocolVersion,
+	}
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	drainc := w.drainc
+	for {
+		l.UpdatedAt = time.Now()
+		if err := r.Report(ctx, l); err != nil && ctx.Err() == nil {
+			glog.Warningf("failed to report to %q (%v)", w.cfg.RegistryEndpoint, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-drainc:
+			// report without waiting for the next heartbeat
+			l.Draining, drainc = true, nil
+		}
+	}
+}
+
+func (w *Worker) queueEndpoint(bucket string) string {
+	return w.cfg.Endpoint + bucket + "/queue"
+}
+
+// loop claims jobs until 'claimCtx' is canceled, and processes them
+// until 'ctx' is canceled. It backs off on the errors that 'claim' does
+// not retry (e.g. wrong endpoint), which may be fixed by redeploying.
+func (w *Worker) loop(ctx, claimCtx context.Context, bucket string, h handler) {
+	glog.Infof("worker started on %q", w.queueEndpoint(bucket))
+	interval := w.cfg.RetryInterval
+	for {
+		items, err := w.claim(claimCtx, bucket, h.batch, -1)
+		if err != nil {
+			if claimCtx.Err() == nil {
+				glog.Warningf("failed to claim from %q, retrying in %v (%v)", bucket, interval, err)
+				select {
+				case <-claimCtx.Done():
+				case <-time.After(interval):
+				}
+			}
+			if claimCtx.Err() != nil {
+				glog.Infof("worker stopped on %q", w.queueEndpoint(bucket))
+				return
+			}
+			if interval *= 2; interval > w.cfg.MaxRetryInterval {
+				interval = w.cfg.MaxRetryInterval
+			}
+			continue
+		}
+		interval = w.cfg.RetryInterval
+		w.process(ctx, bucket, items, h.fn)
+	}
+}
+
+// claim claims up to 'max' items, waiting for the first item up to 'wait'
+// (until available if negative), retrying on errors. It returns no item
+// if none is available in 'wait'.
+func (w *Worker) claim(ctx context.Context, bucket string, max int, wait time.Duration) ([]*Item, error) {
+	q := url.Values{}
+	if max > 1 || wait >= 0 {
+		q.Set("max_items", strconv.Itoa(max))
+		if wait >= 0 {
+			q.Set("wait", wait.String())
+		}
+	}
+	var items []*Item
+	err := w.retry(ctx, func() error {
+		items = nil
+		if q.Get("max_items") != "" {
+			return w.do(ctx, http.MethodGet, bucket, q, nil, &items)
+		}
+		// single-item claims are supported by backends without batches
+		var item Item
+		if err := w.do(ctx, http.MethodGet, bucket, q, nil, &item); err != nil {
+			return err
+		}
+		if item.Error != "" {
+			return &retryableError{fmt.Errorf("queue error %q", item.Error)}
+		}
+		items = []*Item{&item}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		glog.Infof("claimed %q (request ID %q)", item.Key, item.RequestID)
+	}
+	return items, nil
+}
+
+// report posts the item status, retrying on errors.
+func (w *Worker) report(ctx context.Context, bucket string, item Item) error {
+	return w.retry(ctx, func() error {
+		var ret Item
+		return w.do(ctx, http.MethodPost, bucket, nil, &item, &ret)
+	})
+}
+
+type reporterKey struct{}
+
+type reporter struct {
+	mu     sync.Mutex
+	w      *Worker
+	ctx    context.Context
+	bucket string
+	item   *Item
+}
+
+func (r *reporter) report(progress int) error {
+	r.mu.Lock()
+	if progress >= 0 {
+		if progress >= queue.MaxProgress {
+			// only completion reports the max progress
+			progress = queue.MaxProgress - 1
+		}
+		r.item.Progress = progress
+	}
+	copied := *r.item
+	r.mu.Unlock()
+	return r.w.report(r.ctx, r.bucket, copied)
+}
+
+// Progress reports the progress of the job being handled in the context.
+// The progress must be less than 'etcdqueue.MaxProgress',
+// which is reported when the handler returns.
+func Progress(ctx context.Context, progress int) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return fmt.Errorf("no job in context")
+	}
+	return r.report(progress)
+}
+
+// Log appends the log line of the job being handled in the context,
+// streamed live to users waiting for the job (e.g. model loading).
+// Logs are best-effort, and not retried on errors.
+func Log(ctx context.Context, format string, args ...interface{}) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return fmt.Errorf("no job in context")
+	}
+	line := fmt.Sprintf(format, args...)
+	glog.Infof("[%s] %s", r.item.RequestID, line)
+
+	data, err := json.Marshal(struct {
+		RequestID string   `json:"request_id"`
+		Lines     []string `json:"lines"`
+	}{r.item.RequestID, []string{line}})
+	if err != nil {
+		return err
+	}
+	ep := r.w.cfg.Endpoint + r.bucket + "/logs"
+	req, err := http.NewRequest(http.MethodPost, ep, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.w.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%q returned %q (%s)", ep, resp.Status, string(b))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// process runs the handler with the claimed items, and completes them.
+func (w *Worker) process(ctx context.Context, bucket string, items []*Item, fn BatchHandlerFunc) {
+	var (
+		hctx   context.Context
+		cancel context.CancelFunc
+	)
+	if w.cfg.JobTimeout > 0 {
+		hctx, cancel = context.WithTimeout(ctx, w.cfg.JobTimeout)
+	} else {
+		hctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// handler works on its own copies, to avoid races with heartbeats
+	jobs := make([]*Item, len(items))
+	rs := make([]*reporter, len(items))
+	ids := make([]string, len(items))
+	for i, item := range items {
+		job := *item
+		jobs[i] = &job
+		rs[i] = &reporter{w: w, ctx: hctx, bucket: bucket, item: item}
+		ids[i] = item.RequestID
+	}
+	label := strings.Join(ids, ",")
+	if len(rs) == 1 {
+		// 'Progress' and 'Log' report on the single job
+		hctx = context.WithValue(hctx, reporterKey{}, rs[0])
+	}
+	hctx = context.WithValue(hctx, drainKey{}, w.drainc)
+
+	donec := make(chan struct{})
+	go func() {
+		defer close(donec)
+		ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, r := range rs {
+				if err := r.report(-1); err != nil && hctx.Err() == nil {
+					glog.Warningf("heartbeat failed on %q (%v)", r.item.RequestID, err)
+				}
+			}
+		}
+	}()
+
+	drainedc := w.cancelOnDrain(hctx, cancel, label)
+
+	err := runHandler(hctx, fn, jobs)
+	timedOut := err != nil && hctx.Err() == context.DeadlineExceeded
+	cancel()
+	<-donec
+
+	drained := false
+	select {
+	case <-drainedc:
+		drained = true
+	default:
+	}
+	if err != nil {
+		glog.Warningf("handler failed on %q (%v)", label, err)
+	}
+	for _, job := range jobs {
+		jerr := err
+		switch {
+		case jerr == nil:
+			// completed just in time
+		case drained && atomic.LoadInt32(&w.preempted) == 1:
+			w.checkpoint(ctx, job)
+			job.Requeue = true
+			jerr = fmt.Errorf("worker preempted before completing the job (%v)", jerr)
+		case drained:
+			w.checkpoint(ctx, job)
+			jerr = fmt.Errorf("worker shut down before completing the job (%v); please retry", jerr)
+		case timedOut:
+			w.checkpoint(ctx, job)
+			job.TimedOut = true
+			jerr = fmt.Errorf("job timed out after %v (%v)", w.cfg.JobTimeout, jerr)
+		}
+		job.Progress = queue.MaxProgress
+		if jerr != nil {
+			job.Error = jerr.Error()
+		}
+		if rerr := w.report(ctx, bucket, *job); rerr != nil {
+			glog.Warningf("failed to complete %q (%v)", job.RequestID, rerr)
+			continue
+		}
+		glog.Infof("completed %q (request ID %q)", job.Key, job.RequestID)
+	}
+}
+
+// checkpoint calls 'Config.Checkpoint' with the job canceled on drain or timeout.
+func (w *Worker) checkpoint(ctx context.Context, job *Item) {
+	if w.cfg.Checkpoint == nil {
+		return
+	}
+	if err := runHandler(ctx, single(w.cfg.Checkpoint), []*Item{job}); err != nil {
+		glog.Warningf("failed to checkpoint %q (%v)", job.RequestID, err)
+	}
+}
+
+// runHandler recovers from panics in the handler.
+func runHandler(ctx context.Context, fn BatchHandlerFunc, items []*Item) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+	return fn(ctx, items)
+}
+
+// retryableError is returned on connection errors, and retryable responses.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+func (w *Worker) retry(ctx context.Context, fn func() error) error {
+	interval := w.cfg.RetryInterval
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*retryableError); !ok {
+			return err
+		}
+		glog.Warningf("retrying in %v (%v)", interval, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > w.cfg.MaxRetryInterval {
+			interval = w.cfg.MaxRetryInterval
+		}
+	}
+}
+
+// apiError is the structured error response from the backend.
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+// do sends the request to the queue endpoint with the item, and decodes
+// the response in 'out'.
+func (w *Worker) do(ctx context.Context, method, bucket string, q url.Values, item *Item, out interface{}) error {
+	var body io.Reader
+	if item != nil {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	ep := w.queueEndpoint(bucket)
+	if method == http.MethodGet {
+		qv := url.Values{}
+		for k, v := range q {
+			qv[k] = v
+		}
+		// the backend does not route jobs to unhealthy workers
+		qv.Set("worker_id", w.id)
+		if len(w.cfg.Capabilities) > 0 {
+			qv.Set("capabilities", strings.Join(w.cfg.Capabilities, ","))
+		}
+		ep += "?" + qv.Encode()
+	}
+	req, err := http.NewRequest(method, ep, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(queue.ProtocolHeader, strconv.Itoa(queue.ProtocolVersion))
+
+	resp, err := w.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &retryableError{err}
+	}
+	rb, err := ioutil.ReadAll(resp.Body)
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return &retryableError{err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var aerr apiError
+		if json.Unmarshal(rb, &aerr) != nil {
+			aerr = apiError{Message: string(rb), Retryable: resp.StatusCode >= 500}
+		}
+		err = fmt.Errorf("%q returned %q (%s: %s)", w.queueEndpoint(bucket), resp.Status, aerr.Code, aerr.Message)
+		if aerr.Retryable {
+			return &retryableError{err}
+		}
+		return err
+	}
+	return json.Unmarshal(rb, out)
+}
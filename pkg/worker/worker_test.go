@@ -0,0 +1,252 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	queue "github.com/gyuho/dplearn/pkg/etcd-queue"
+)
+
+func TestWorker(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		claims  int
+		updates []Item
+		logs    []string
+	)
+	donec := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/cats-request/logs" {
+			var lr struct {
+				Lines []string `json:"lines"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&lr); err != nil {
+				t.Fatal(err)
+			}
+			logs = append(logs, lr.Lines...)
+			return
+		}
+		if req.URL.Path != "/cats-request/queue" {
+			t.Fatalf("unexpected path %q", req.URL.Path)
+		}
+		switch req.Method {
+		case http.MethodGet:
+			if caps := req.URL.Query().Get("capabilities"); caps != "cats-vs-dogs,gpu" {
+				t.Fatalf("unexpected capabilities %q", caps)
+			}
+			claims++
+			switch claims {
+			case 1:
+				// first claim fails to test retries
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"code": "queue_unavailable", "message": "unavailable", "retryable": true}`)
+				return
+			case 2:
+				json.NewEncoder(w).Encode(queue.CreateItem("/cats-request", 100, "hello"))
+				return
+			}
+			// block until the worker stops
+			mu.Unlock()
+			<-req.Context().Done()
+			mu.Lock()
+
+		case http.MethodPost:
+			var item Item
+			if err := json.NewDecoder(req.Body).Decode(&item); err != nil {
+				t.Fatal(err)
+			}
+			updates = append(updates, item)
+			if item.Progress == queue.MaxProgress {
+				close(donec)
+			}
+			json.NewEncoder(w).Encode(item)
+		}
+	}))
+	defer ts.Close()
+
+	w := New(Config{
+		Endpoint:          ts.URL,
+		Capabilities:      []string{"cats-vs-dogs", "gpu"},
+		HeartbeatInterval: 10 * time.Millisecond,
+		RetryInterval:     10 * time.Millisecond,
+	})
+	w.Handle("/cats-request", func(ctx context.Context, item *Item) error {
+		if err := Progress(ctx, 50); err != nil {
+			t.Fatal(err)
+		}
+		if err := Log(ctx, "loading %s", "model"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		item.Value = "world"
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	select {
+	case <-donec:
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to complete the job")
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) < 3 {
+		t.Fatalf("expected progress, heartbeats, and completion, got %+v", updates)
+	}
+	for _, item := range updates[:len(updates)-1] {
+		if item.Progress != 50 && item.Progress != 0 {
+			t.Fatalf("expected progress 0 or 50, got %d", item.Progress)
+		}
+	}
+	last := updates[len(updates)-1]
+	if last.Progress != queue.MaxProgress || last.Value != "world" || last.Error != "" {
+		t.Fatalf("unexpected completion %+v", last)
+	}
+	if len(logs) != 1 || logs[0] != "loading model" {
+		t.Fatalf("unexpected logs %q", logs)
+	}
+}
+
+func TestWorkerHandlerError(t *testing.T) {
+	donec := make(chan Item, 1)
+	var once sync.Once
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			var served bool
+			once.Do(func() {
+				json.NewEncoder(w).Encode(queue.CreateItem("/cats-request", 100, "hello"))
+				served = true
+			})
+			if !served {
+				<-req.Context().Done()
+			}
+		case http.MethodPost:
+			var item Item
+			json.NewDecoder(req.Body).Decode(&item)
+			if item.Progress == queue.MaxProgress {
+				donec <- item
+			}
+			json.NewEncoder(w).Encode(item)
+		}
+	}))
+	defer ts.Close()
+
+	w := New(Config{Endpoint: ts.URL})
+	w.Handle("/cats-request", func(ctx context.Context, item *Item) error {
+		panic("oops")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case item := <-donec:
+		if item.Error != "handler panic: oops" {
+			t.Fatalf("unexpected error %q", item.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to complete the job")
+	}
+}
+
+func TestWorkerClaimBackoff(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		claims int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		claims++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code": "not_found", "message": "not found", "retryable": false}`)
+	}))
+	defer ts.Close()
+
+	w := New(Config{Endpoint: ts.URL, RetryInterval: 10 * time.Millisecond, MaxRetryInterval: 40 * time.Millisecond})
+	w.Handle("/cats-request", func(ctx context.Context, item *Item) error {
+		t.Fatalf("unexpected item %+v", item)
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	w.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 10ms, 20ms, then every 40ms
+	if claims < 2 || claims > 15 {
+		t.Fatalf("expected claims with backoff, got %d", claims)
+	}
+}
+
+func TestWorkerJobTimeout(t *testing.T) {
+	donec := make(chan Item, 1)
+	var once sync.Once
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			var served bool
+			once.Do(func() {
+				json.NewEncoder(w).Encode(queue.CreateItem("/cats-request", 100, "hello"))
+				served = true
+			})
+			if !served {
+				<-req.Context().Done()
+			}
+		case http.MethodPost:
+			var item Item
+			json.NewDecoder(req.Body).Decode(&item)
+			if item.Progress == queue.MaxProgress {
+				donec <- item
+			}
+			json.NewEncoder(w).Encode(item)
+		}
+	}))
+	defer ts.Close()
+
+	var checkpointed string
+	w := New(Config{
+		Endpoint:   ts.URL,
+		JobTimeout: 10 * time.Millisecond,
+		Checkpoint: func(ctx context.Context, item *Item) error {
+			checkpointed = item.Value
+			return nil
+		},
+	})
+	w.Handle("/cats-request", func(ctx context.Context, item *Item) error {
+		item.Value = "partial"
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case item := <-donec:
+		if !item.TimedOut || !strings.HasPrefix(item.Error, "job timed out after 10ms") || checkpointed != "partial" {
+			t.Fatalf("unexpected completion %+v (checkpointed %q)", item, checkpointed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("took too long to complete the job")
+	}
+}
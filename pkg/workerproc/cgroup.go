@@ -0,0 +1,34 @@
+package workerproc
+
+// Limits defines the resource limits of the worker process.
+type Limits struct {
+	// CPUs is the CPU quota in cores (e.g. 1.5). 0 for no limit.
+	CPUs float64
+	// MemoryBytes is the memory limit. The process is OOM-killed
+	// (and restarted) when it exceeds the limit. 0 for no limit.
+	MemoryBytes int64
+}
+
+func (l Limits) enabled() bool { return l.CPUs > 0 || l.MemoryBytes > 0 }
+
+// Usage is the resource usage of the worker process.
+type Usage struct {
+	CPUSeconds       float64 `json:"cpu_seconds"`
+	MemoryBytes      int64   `json:"memory_bytes"`
+	MemoryLimitBytes int64   `json:"memory_limit_bytes"`
+	// OOMKills is the number of processes killed on the memory limit.
+	OOMKills int64 `json:"oom_kills"`
+}
+
+// cgroupParent is the parent cgroup of all worker cgroups.
+const cgroupParent = "dplearn"
+
+// cpuPeriod is the CFS period in microseconds.
+const cpuPeriod = 100000
+
+// cgroup limits and accounts the resources of the worker process.
+type cgroup interface {
+	add(pid int) error
+	usage() (Usage, error)
+	remove() error
+}
@@ -0,0 +1,201 @@
+package workerproc
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// newCgroup creates the cgroup of the name under the cgroup file system root
+// (e.g. "/sys/fs/cgroup"), and applies the limits. It uses cgroup v2 if the
+// root is the unified hierarchy, and v1 otherwise.
+func newCgroup(root, name string, lim Limits) (cgroup, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return newCgroupV2(root, name, lim)
+	}
+	return newCgroupV1(root, name, lim)
+}
+
+// cgroupV1 has a directory per controller hierarchy.
+type cgroupV1 struct {
+	cpu     string
+	cpuacct string
+	memory  string
+}
+
+func newCgroupV1(root, name string, lim Limits) (*cgroupV1, error) {
+	cg := &cgroupV1{
+		cpu:     filepath.Join(root, "cpu", cgroupParent, name),
+		cpuacct: filepath.Join(root, "cpuacct", cgroupParent, name),
+		memory:  filepath.Join(root, "memory", cgroupParent, name),
+	}
+	for _, dir := range cg.dirs() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if lim.CPUs > 0 {
+		if err := writeFile(filepath.Join(cg.cpu, "cpu.cfs_period_us"), strconv.Itoa(cpuPeriod)); err != nil {
+			return nil, err
+		}
+		if err := writeFile(filepath.Join(cg.cpu, "cpu.cfs_quota_us"), strconv.Itoa(int(lim.CPUs*cpuPeriod))); err != nil {
+			return nil, err
+		}
+	}
+	if lim.MemoryBytes > 0 {
+		if err := writeFile(filepath.Join(cg.memory, "memory.limit_in_bytes"), strconv.FormatInt(lim.MemoryBytes, 10)); err != nil {
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// dirs returns the unique directories, since "cpu" and "cpuacct"
+// are often mounted together.
+func (cg *cgroupV1) dirs() []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, dir := range []string{cg.cpu, cg.cpuacct, cg.memory} {
+		if real, err := filepath.EvalSymlinks(filepath.Dir(filepath.Dir(dir))); err == nil {
+			if seen[real] {
+				continue
+			}
+			seen[real] = true
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (cg *cgroupV1) add(pid int) error {
+	for _, dir := range cg.dirs() {
+		if err := writeFile(filepath.Join(dir, "cgroup.procs"), strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cg *cgroupV1) usage() (u Usage, err error) {
+	var ns int64
+	if ns, err = readInt(filepath.Join(cg.cpuacct, "cpuacct.usage")); err != nil {
+		return u, err
+	}
+	u.CPUSeconds = float64(ns) / 1e9
+	if u.MemoryBytes, err = readInt(filepath.Join(cg.memory, "memory.usage_in_bytes")); err != nil {
+		return u, err
+	}
+	if u.MemoryLimitBytes, err = readInt(filepath.Join(cg.memory, "memory.limit_in_bytes")); err != nil {
+		return u, err
+	}
+	// "oom_kill" is only available in Linux 4.13+
+	u.OOMKills, err = readKey(filepath.Join(cg.memory, "memory.oom_control"), "oom_kill")
+	return u, err
+}
+
+func (cg *cgroupV1) remove() error {
+	for _, dir := range cg.dirs() {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cgroupV2 is the cgroup in the unified hierarchy.
+type cgroupV2 struct {
+	dir string
+}
+
+func newCgroupV2(root, name string, lim Limits) (*cgroupV2, error) {
+	parent := filepath.Join(root, cgroupParent)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	// enable controllers for the children
+	for _, dir := range []string{root, parent} {
+		if err := writeFile(filepath.Join(dir, "cgroup.subtree_control"), "+cpu +memory"); err != nil {
+			return nil, err
+		}
+	}
+	cg := &cgroupV2{dir: filepath.Join(parent, name)}
+	if err := os.MkdirAll(cg.dir, 0755); err != nil {
+		return nil, err
+	}
+	if lim.CPUs > 0 {
+		if err := writeFile(filepath.Join(cg.dir, "cpu.max"), fmt.Sprintf("%d %d", int(lim.CPUs*cpuPeriod), cpuPeriod)); err != nil {
+			return nil, err
+		}
+	}
+	if lim.MemoryBytes > 0 {
+		if err := writeFile(filepath.Join(cg.dir, "memory.max"), strconv.FormatInt(lim.MemoryBytes, 10)); err != nil {
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+func (cg *cgroupV2) add(pid int) error {
+	return writeFile(filepath.Join(cg.dir, "cgroup.procs"), strconv.Itoa(pid))
+}
+
+func (cg *cgroupV2) usage() (u Usage, err error) {
+	var us int64
+	if us, err = readKey(filepath.Join(cg.dir, "cpu.stat"), "usage_usec"); err != nil {
+		return u, err
+	}
+	u.CPUSeconds = float64(us) / 1e6
+	if u.MemoryBytes, err = readInt(filepath.Join(cg.dir, "memory.current")); err != nil {
+		return u, err
+	}
+	// "max" for no limit
+	if u.MemoryLimitBytes, err = readInt(filepath.Join(cg.dir, "memory.max")); err != nil {
+		u.MemoryLimitBytes = 0
+	}
+	u.OOMKills, err = readKey(filepath.Join(cg.dir, "memory.events"), "oom_kill")
+	return u, err
+}
+
+func (cg *cgroupV2) remove() error {
+	if err := os.Remove(cg.dir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func writeFile(p, v string) error {
+	if err := ioutil.WriteFile(p, []byte(v), 0644); err != nil {
+		return fmt.Errorf("failed to write %q to %q (%v)", v, p, err)
+	}
+	return nil
+}
+
+func readInt(p string) (int64, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// readKey reads the value of the key from the flat keyed file
+// (e.g. "oom_kill 1"). It returns 0 if the key does not exist.
+func readKey(p, key string) (int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
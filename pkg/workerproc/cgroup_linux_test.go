@@ -0,0 +1,98 @@
+package workerproc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCgroupV1(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "cgroup-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, ctl := range []string{"cpu", "cpuacct", "memory"} {
+		if err = os.MkdirAll(filepath.Join(root, ctl), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cg, err := newCgroup(root, "test", Limits{CPUs: 1.5, MemoryBytes: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(cgroupParent, "test")
+	for p, exp := range map[string]string{
+		filepath.Join(root, "cpu", dir, "cpu.cfs_period_us"):        "100000",
+		filepath.Join(root, "cpu", dir, "cpu.cfs_quota_us"):         "150000",
+		filepath.Join(root, "memory", dir, "memory.limit_in_bytes"): "1073741824",
+	} {
+		testFile(t, p, exp)
+	}
+
+	if err = cg.add(10); err != nil {
+		t.Fatal(err)
+	}
+	testFile(t, filepath.Join(root, "memory", dir, "cgroup.procs"), "10")
+
+	writeTestFile(t, filepath.Join(root, "cpuacct", dir, "cpuacct.usage"), "2500000000\n")
+	writeTestFile(t, filepath.Join(root, "memory", dir, "memory.usage_in_bytes"), "1048576\n")
+	writeTestFile(t, filepath.Join(root, "memory", dir, "memory.oom_control"), "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n")
+	u, err := cg.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := Usage{CPUSeconds: 2.5, MemoryBytes: 1 << 20, MemoryLimitBytes: 1 << 30, OOMKills: 2}
+	if !reflect.DeepEqual(u, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, u)
+	}
+}
+
+func TestCgroupV2(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "cgroup-v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFile(t, filepath.Join(root, "cgroup.controllers"), "cpu memory\n")
+	cg, err := newCgroup(root, "test", Limits{CPUs: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, cgroupParent, "test")
+	testFile(t, filepath.Join(root, cgroupParent, "cgroup.subtree_control"), "+cpu +memory")
+	testFile(t, filepath.Join(dir, "cpu.max"), "50000 100000")
+
+	writeTestFile(t, filepath.Join(dir, "cpu.stat"), "usage_usec 1500000\nuser_usec 1000000\n")
+	writeTestFile(t, filepath.Join(dir, "memory.current"), "4096\n")
+	writeTestFile(t, filepath.Join(dir, "memory.max"), "max\n")
+	writeTestFile(t, filepath.Join(dir, "memory.events"), "low 0\noom 1\noom_kill 1\n")
+	u, err := cg.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := Usage{CPUSeconds: 1.5, MemoryBytes: 4096, OOMKills: 1}
+	if !reflect.DeepEqual(u, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, u)
+	}
+}
+
+func writeTestFile(t *testing.T, p, v string) {
+	if err := ioutil.WriteFile(p, []byte(v), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testFile(t *testing.T, p, exp string) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != exp {
+		t.Fatalf("%q expected %q, got %q", p, exp, string(b))
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package workerproc
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func newCgroup(root, name string, lim Limits) (cgroup, error) {
+	return nil, fmt.Errorf("cgroups are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,3 @@
+// Package workerproc supervises worker processes (e.g. Python workers),
+// restarting them on crash and reporting their liveness.
+package workerproc
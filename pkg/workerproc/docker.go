@@ -0,0 +1,95 @@
+package workerproc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gyuho/dplearn/pkg/docker"
+)
+
+// DockerConfig runs the worker process in a Docker container,
+// instead of a host process. 'Config.Command' and 'Config.Args'
+// override the image command, if not empty.
+type DockerConfig struct {
+	Client *docker.Client
+	Image  string
+
+	// NetworkMode is the container network (e.g. "host").
+	NetworkMode string
+
+	// ScratchDir is the host directory, whose sub-directory of the worker name
+	// is mounted at "/scratch" in the container. Empty to disable.
+	ScratchDir string
+
+	// QueueEndpoint and RegistryEndpoint are passed to the container as
+	// "DPLEARN_QUEUE_ENDPOINT" and "DPLEARN_REGISTRY_ENDPOINT".
+	QueueEndpoint    string
+	RegistryEndpoint string
+}
+
+// containerScratchDir is the scratch volume path in the container.
+const containerScratchDir = "/scratch"
+
+func (s *Supervisor) containerConfig() (docker.ContainerConfig, error) {
+	dc := s.cfg.Docker
+	cfg := docker.ContainerConfig{
+		Image:       dc.Image,
+		NetworkMode: dc.NetworkMode,
+		NanoCPUs:    int64(s.cfg.Limits.CPUs * 1e9),
+		Memory:      s.cfg.Limits.MemoryBytes,
+		Env: append([]string{
+			"DPLEARN_WORKER_NAME=" + s.cfg.Name,
+			"DPLEARN_QUEUE_ENDPOINT=" + dc.QueueEndpoint,
+			"DPLEARN_REGISTRY_ENDPOINT=" + dc.RegistryEndpoint,
+		}, s.cfg.Env...),
+	}
+	if s.cfg.Command != "" {
+		cfg.Cmd = append([]string{s.cfg.Command}, s.cfg.Args...)
+	}
+	if dc.ScratchDir != "" {
+		dir := filepath.Join(dc.ScratchDir, s.cfg.Name)
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return cfg, err
+		}
+		cfg.Mounts = []docker.Mount{{Source: dir, Target: containerScratchDir}}
+		cfg.Env = append(cfg.Env, "DPLEARN_SCRATCH_DIR="+containerScratchDir)
+	}
+	return cfg, nil
+}
+
+// runContainer runs the worker container until it stops.
+func (s *Supervisor) runContainer(ctx context.Context) error {
+	cfg, err := s.containerConfig()
+	if err != nil {
+		return err
+	}
+
+	outr, outw := io.Pipe()
+	errr, errw := io.Pipe()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go s.pipe(&wg, "stdout", outr)
+	go s.pipe(&wg, "stderr", errr)
+
+	s.update(func(l *Liveness) { l.Alive = true })
+	s.report(ctx)
+	st, err := s.cfg.Docker.Client.Run(ctx, cfg, outw, errw)
+	outw.Close()
+	errw.Close()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	if st.OOMKilled {
+		return fmt.Errorf("OOM-killed on memory limit %d bytes (exit code %d)", s.cfg.Limits.MemoryBytes, st.ExitCode)
+	}
+	if st.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", st.ExitCode)
+	}
+	return nil
+}
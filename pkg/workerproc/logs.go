@@ -0,0 +1,122 @@
+package workerproc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+
+	"github.com/golang/glog"
+)
+
+// LogFileEnv is the environment variable of the job log file, that
+// worker processes append the job log lines to (see 'Config.LogFile').
+const LogFileEnv = "DPLEARN_LOG_FILE"
+
+const (
+	// logFlushInterval is the interval to post the buffered job log lines.
+	logFlushInterval = 500 * time.Millisecond
+	// maxLogBatch is the number of lines to post at once.
+	maxLogBatch = 100
+)
+
+// LogLine is the line of the job log file, in JSON.
+type LogLine struct {
+	RequestID string `json:"request_id"`
+	Line      string `json:"line"`
+}
+
+// forwardLogs tails the job log file, and posts the lines to the
+// backend log endpoint batched by request ID, until the context is canceled.
+// Logs are best-effort, and failed posts are not retried.
+func (s *Supervisor) forwardLogs(ctx context.Context) {
+	linec, err := fileutil.Tail(ctx, s.cfg.LogFile)
+	if err != nil {
+		glog.Warningf("failed to tail %q of %q (%v)", s.cfg.LogFile, s.cfg.Name, err)
+		return
+	}
+	glog.Infof("forwarding job logs of %q from %q to %q", s.cfg.Name, s.cfg.LogFile, s.cfg.LogEndpoint)
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	// pending is the buffered lines per request ID, in order of the first line
+	var ids []string
+	pending := make(map[string][]string)
+	n := 0
+	flush := func() {
+		for _, id := range ids {
+			if err := s.postLogs(ctx, id, pending[id]); err != nil {
+				glog.Warningf("failed to post logs of %q (%v)", id, err)
+			}
+		}
+		ids, pending, n = nil, make(map[string][]string), 0
+	}
+	for {
+		select {
+		case line, ok := <-linec:
+			if !ok {
+				return
+			}
+			var l LogLine
+			if err := json.Unmarshal([]byte(line), &l); err != nil || l.RequestID == "" {
+				glog.Warningf("invalid job log line of %q (%q)", s.cfg.Name, line)
+				continue
+			}
+			if _, ok := pending[l.RequestID]; !ok {
+				ids = append(ids, l.RequestID)
+			}
+			pending[l.RequestID] = append(pending[l.RequestID], l.Line)
+			if n++; n >= maxLogBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// postLogs posts the lines to the backend log endpoint
+// (e.g. "http://localhost:2200/cats-request/logs"), gzip-compressed.
+func (s *Supervisor) postLogs(ctx context.Context, requestID string, lines []string) error {
+	data, err := json.Marshal(struct {
+		RequestID string   `json:"request_id"`
+		Lines     []string `json:"lines"`
+	}{requestID, lines})
+	if err != nil {
+		return err
+	}
+	// log lines are highly compressible
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err = gw.Write(data); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.cfg.LogEndpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%q returned %q (%s)", s.cfg.LogEndpoint, resp.Status, string(b))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
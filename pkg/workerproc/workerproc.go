@@ -0,0 +1,395 @@
+package workerproc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// VersionLabel is the label of the worker version (e.g. "version": "v2"),
+// to route canary jobs to the workers of a new version.
+const VersionLabel = "version"
+
+// Liveness is the liveness report of the supervised worker process.
+type Liveness struct {
+	// ID uniquely identifies the worker process across hosts.
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	PID      int    `json:"pid"`
+	Alive    bool   `json:"alive"`
+	Restarts int    `json:"restarts"`
+	// LastExit is the exit status of the previous run.
+	LastExit string `json:"last_exit"`
+	// Labels describe the worker host (e.g. "gpu": "true").
+	Labels map[string]string `json:"labels,omitempty"`
+	// Buckets are the buckets that the worker processes (e.g. "/cats-request").
+	Buckets []string `json:"buckets,omitempty"`
+	// HealthURL is the health endpoint to probe (e.g. "http://host:2210/healthz").
+	// Empty to check the freshness of liveness reports only.
+	HealthURL string `json:"health_url,omitempty"`
+
+	// Protocol is the worker protocol version (see 'etcdqueue.ProtocolVersion').
+	// Zero for workers that predate version negotiation.
+	Protocol int `json:"protocol,omitempty"`
+	// Draining is true once the worker stops claiming new jobs on shutdown,
+	// while it completes the jobs in process.
+	Draining bool `json:"draining,omitempty"`
+	// Drain is set by the registry when the coordinator decides to drain
+	// the worker (e.g. before host maintenance).
+	Drain bool `json:"drain,omitempty"`
+
+	// Healthy and HealthError are set by the worker registry.
+	Healthy     bool   `json:"healthy"`
+	HealthError string `json:"health_error,omitempty"`
+	// Usage is the resource usage, nil if the process is not in a cgroup.
+	Usage     *Usage    `json:"usage,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Reporter reports the liveness to the worker registry.
+type Reporter interface {
+	Report(ctx context.Context, l Liveness) error
+}
+
+// Config defines the supervisor configuration.
+type Config struct {
+	// Name is the worker name (e.g. "cats").
+	Name string
+
+	// Command is the path to the executable (e.g. "python3").
+	Command string
+	Args    []string
+	// Env is added to the current environment.
+	Env []string
+	Dir string
+
+	// MinBackoff is the initial restart delay, doubled on each crash
+	// up to MaxBackoff. Defaults to 1 second and 1 minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ResetAfter resets the backoff, once the process runs longer.
+	// Defaults to 1 minute.
+	ResetAfter time.Duration
+
+	// Labels and Buckets are reported with the liveness.
+	Labels  map[string]string
+	Buckets []string
+	// HealthURL is the health endpoint of the worker process, probed by
+	// the worker registry. Empty to check the liveness reports only.
+	HealthURL string
+
+	// Limits are applied with cgroups (Linux only). If limits or 'Cgroup'
+	// is set, the process runs in its own cgroup under 'CgroupRoot',
+	// and its resource usage is reported with the liveness.
+	Limits Limits
+	Cgroup bool
+	// CgroupRoot defaults to "/sys/fs/cgroup".
+	CgroupRoot string
+
+	// Docker runs the worker in a Docker container, if not nil.
+	// Limits are applied by Docker, instead of cgroups.
+	Docker *DockerConfig
+
+	// LogFile is the job log file of the worker process, passed in
+	// "DPLEARN_LOG_FILE" environment variable. The process appends the job
+	// log lines in JSON (see 'LogLine'), and the supervisor streams them to
+	// 'LogEndpoint' (e.g. "http://localhost:2200/cats-request/logs").
+	// Ignored for the workers in Docker containers.
+	LogFile     string
+	LogEndpoint string
+
+	// Reporter is called on every state change and every ReportInterval,
+	// if not nil. ReportInterval defaults to 10 seconds.
+	Reporter       Reporter
+	ReportInterval time.Duration
+}
+
+// Supervisor runs the worker process, restarting it on exit.
+type Supervisor struct {
+	cfg Config
+	cg  cgroup
+
+	mu       sync.RWMutex
+	liveness Liveness
+}
+
+// New creates a new supervisor.
+func New(cfg Config) *Supervisor {
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.ResetAfter == 0 {
+		cfg.ResetAfter = time.Minute
+	}
+	if cfg.ReportInterval == 0 {
+		cfg.ReportInterval = 10 * time.Second
+	}
+	if cfg.CgroupRoot == "" {
+		cfg.CgroupRoot = "/sys/fs/cgroup"
+	}
+	host, _ := os.Hostname()
+	return &Supervisor{
+		cfg: cfg,
+		liveness: Liveness{
+			ID:        fmt.Sprintf("%s-%s-%d", host, cfg.Name, os.Getpid()),
+			Name:      cfg.Name,
+			Host:      host,
+			Labels:    cfg.Labels,
+			Buckets:   cfg.Buckets,
+			HealthURL: cfg.HealthURL,
+		},
+	}
+}
+
+// Liveness returns the current liveness of the worker process.
+func (s *Supervisor) Liveness() Liveness {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.liveness
+}
+
+func (s *Supervisor) update(fn func(l *Liveness)) {
+	s.mu.Lock()
+	fn(&s.liveness)
+	s.liveness.UpdatedAt = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) report(ctx context.Context) {
+	if s.cg != nil {
+		u, err := s.cg.usage()
+		if err != nil {
+			glog.Warningf("failed to read resource usage of %q (%v)", s.cfg.Name, err)
+		} else {
+			s.update(func(l *Liveness) { l.Usage = &u })
+		}
+	}
+	if s.cfg.Reporter == nil {
+		return
+	}
+	if err := s.cfg.Reporter.Report(ctx, s.Liveness()); err != nil {
+		glog.Warningf("failed to report liveness of %q (%v)", s.cfg.Name, err)
+	}
+}
+
+// Run runs the worker process until the context is canceled,
+// restarting on exit with backoff. The process is killed on cancel.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if s.cfg.Docker == nil && (s.cfg.Cgroup || s.cfg.Limits.enabled()) {
+		cg, err := newCgroup(s.cfg.CgroupRoot, s.cfg.Name, s.cfg.Limits)
+		if err != nil {
+			return fmt.Errorf("failed to create cgroup for %q (%v)", s.cfg.Name, err)
+		}
+		glog.Infof("created cgroup for %q (limits %+v)", s.cfg.Name, s.cfg.Limits)
+		s.cg = cg
+		defer func() {
+			if err := cg.remove(); err != nil {
+				glog.Warningf("failed to remove cgroup of %q (%v)", s.cfg.Name, err)
+			}
+		}()
+	}
+
+	donec := make(chan struct{})
+	defer close(donec)
+	if s.cfg.Docker == nil && s.cfg.LogFile != "" && s.cfg.LogEndpoint != "" {
+		go s.forwardLogs(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(s.cfg.ReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-donec:
+				return
+			case <-ticker.C:
+				s.report(ctx)
+			}
+		}
+	}()
+
+	backoff := s.cfg.MinBackoff
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			s.update(func(l *Liveness) { l.Alive, l.PID = false, 0 })
+			// report with a fresh context, since the run context is canceled
+			rctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			s.report(rctx)
+			cancel()
+			return ctx.Err()
+		}
+
+		exit := "exited"
+		if err != nil {
+			exit = err.Error()
+		}
+		if s.oomKilled() {
+			exit = fmt.Sprintf("OOM-killed on memory limit %d bytes (%s)", s.cfg.Limits.MemoryBytes, exit)
+		}
+		s.update(func(l *Liveness) {
+			l.Alive, l.PID, l.LastExit = false, 0, exit
+			l.Restarts++
+		})
+		s.report(ctx)
+
+		if time.Since(started) > s.cfg.ResetAfter {
+			backoff = s.cfg.MinBackoff
+		}
+		glog.Warningf("worker %q %s; restarting in %v", s.cfg.Name, exit, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+// oomKilled returns true if the number of OOM kills increased since the last report.
+func (s *Supervisor) oomKilled() bool {
+	if s.cg == nil {
+		return false
+	}
+	u, err := s.cg.usage()
+	if err != nil {
+		return false
+	}
+	var prev int64
+	if l := s.Liveness(); l.Usage != nil {
+		prev = l.Usage.OOMKills
+	}
+	s.update(func(l *Liveness) { l.Usage = &u })
+	return u.OOMKills > prev
+}
+
+func (s *Supervisor) runOnce(ctx context.Context) error {
+	if s.cfg.Docker != nil {
+		return s.runContainer(ctx)
+	}
+	cmd := exec.CommandContext(ctx, s.cfg.Command, s.cfg.Args...)
+	cmd.Env = append(os.Environ(), s.cfg.Env...)
+	if s.cfg.LogFile != "" {
+		cmd.Env = append(cmd.Env, LogFileEnv+"="+s.cfg.LogFile)
+	}
+	cmd.Dir = s.cfg.Dir
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	if s.cg != nil {
+		if err = s.cg.add(cmd.Process.Pid); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+	glog.Infof("started worker %q (PID %d)", s.cfg.Name, cmd.Process.Pid)
+	s.update(func(l *Liveness) { l.Alive, l.PID = true, cmd.Process.Pid })
+	s.report(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go s.pipe(&wg, "stdout", stdout)
+	go s.pipe(&wg, "stderr", stderr)
+	// must read all outputs before Wait closes the pipes
+	wg.Wait()
+	return cmd.Wait()
+}
+
+// pipe writes the process outputs to the log stream, line by line.
+func (s *Supervisor) pipe(wg *sync.WaitGroup, stream string, r io.Reader) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		glog.Infof("[%s %s] %s", s.cfg.Name, stream, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		glog.Warningf("failed to read %s of %q (%v)", stream, s.cfg.Name, err)
+		io.Copy(ioutil.Discard, r)
+	}
+}
+
+// TokenHeader is the header for the worker registry token.
+const TokenHeader = "X-Worker-Token"
+
+// HTTPReporter reports the liveness to the backend worker registry
+// (e.g. "http://localhost:2200/workers").
+type HTTPReporter struct {
+	Endpoint string
+	// Token is sent in the TokenHeader, if not empty.
+	Token  string
+	Client *http.Client
+	// OnReply is called with the liveness returned by the registry
+	// (e.g. to drain on 'Liveness.Drain'), if not nil.
+	OnReply func(Liveness)
+}
+
+// Report posts the liveness in JSON.
+func (r *HTTPReporter) Report(ctx context.Context, l Liveness) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Token != "" {
+		req.Header.Set(TokenHeader, r.Token)
+	}
+
+	cli := r.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%q returned %q (%s)", r.Endpoint, resp.Status, string(b))
+	}
+	if r.OnReply != nil {
+		var reply Liveness
+		switch err = json.NewDecoder(resp.Body).Decode(&reply); err {
+		case nil:
+			r.OnReply(reply)
+		case io.EOF:
+			// registry without reply body
+		default:
+			return err
+		}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,141 @@
+package workerproc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gyuho/dplearn/pkg/fileutil"
+)
+
+type testReporter struct {
+	mu      sync.Mutex
+	reports []Liveness
+}
+
+func (r *testReporter) Report(ctx context.Context, l Liveness) error {
+	r.mu.Lock()
+	r.reports = append(r.reports, l)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestSupervisor(t *testing.T) {
+	rp := &testReporter{}
+	s := New(Config{
+		Name:       "test",
+		Command:    "sh",
+		Args:       []string{"-c", "echo hello; echo world 1>&2; exit 3"},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Reporter:   rp,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Liveness().Restarts < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected restarts, got %+v", s.Liveness())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	l := s.Liveness()
+	if l.Alive || l.LastExit != "exit status 3" {
+		t.Fatalf("unexpected liveness %+v", l)
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	var alive int
+	for _, r := range rp.reports {
+		if r.Alive {
+			alive++
+		}
+	}
+	if alive < 3 {
+		t.Fatalf("expected at least 3 alive reports, got %+v", rp.reports)
+	}
+	if last := rp.reports[len(rp.reports)-1]; last.Alive {
+		t.Fatalf("expected last report not alive, got %+v", last)
+	}
+}
+
+func TestSupervisorLogs(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "workerproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	type logsRequest struct {
+		RequestID string   `json:"request_id"`
+		Lines     []string `json:"lines"`
+	}
+	reqc := make(chan logsRequest, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "expected gzip", http.StatusBadRequest)
+			return
+		}
+		body, err := fileutil.NewGzipReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var lr logsRequest
+		if err := json.NewDecoder(body).Decode(&lr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqc <- lr
+	}))
+	defer ts.Close()
+
+	s := New(Config{
+		Name:    "test",
+		Command: "sh",
+		Args: []string{"-c", `sleep 0.5
+echo '{"request_id":"/cats-request-a","line":"classifying"}' >> "$DPLEARN_LOG_FILE"
+echo 'not json' >> "$DPLEARN_LOG_FILE"
+echo '{"request_id":"/cats-request-a","line":"classified"}' >> "$DPLEARN_LOG_FILE"
+sleep 10`},
+		LogFile:     filepath.Join(dir, "test.log"),
+		LogEndpoint: ts.URL + "/cats-request/logs",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	var lines []string
+	for len(lines) < 2 {
+		select {
+		case lr := <-reqc:
+			if lr.RequestID != "/cats-request-a" {
+				t.Fatalf("unexpected request ID %q", lr.RequestID)
+			}
+			lines = append(lines, lr.Lines...)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out, got %q", lines)
+		}
+	}
+	if want := []string{"classifying", "classified"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines expected %q, got %q", want, lines)
+	}
+}
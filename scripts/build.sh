@@ -0,0 +1,20 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/build.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+if [[ -z "${GIT_SHA}" ]]; then
+  GIT_SHA=$(git rev-parse --short HEAD || echo "GitNotFound")
+fi
+BUILD_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+echo GIT_SHA: ${GIT_SHA}
+echo BUILD_TIME: ${BUILD_TIME}
+
+VERSION_PKG=github.com/gyuho/dplearn/pkg/version
+GO_LDFLAGS="-X ${VERSION_PKG}.GitSHA=${GIT_SHA} -X ${VERSION_PKG}.BuildTime=${BUILD_TIME}"
+
+go install -v -ldflags "${GO_LDFLAGS}" ./cmd/backend-web-server
+go install -v ./cmd/gen-frontend-dep
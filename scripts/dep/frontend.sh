@@ -15,8 +15,10 @@ nvm install v9.3.0
 
 go install -v ./cmd/gen-frontend-dep
 gen-frontend-dep \
+  -config frontend.yaml \
   -output-package-json package.json \
   -output-angular-cli-json angular-cli.json \
+  -output-proxy-config-json proxy.config.json \
   -logtostderr
 
 echo "Updating frontend dependencies with 'yarn' and 'npm'..."
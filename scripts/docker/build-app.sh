@@ -9,4 +9,5 @@ fi
 docker build \
   --tag gcr.io/gcp-dplearn/dplearn:latest-app \
   --file ./dockerfiles/Dockerfile-app \
+  --build-arg GIT_SHA=$(git rev-parse --short HEAD) \
   .
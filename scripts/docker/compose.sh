@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/docker/compose.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+# runs the separate frontend and backend images,
+# with the etcd data in the docker volume
+GIT_SHA=$(git rev-parse --short HEAD) docker-compose \
+  --file ./dockerfiles/docker-compose.yml \
+  up --build
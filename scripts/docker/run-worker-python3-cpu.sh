@@ -42,7 +42,7 @@ curl -L http://localhost:2200/healthz
 "
 
 rm -rf /tmp/etcd
-go install -v ./cmd/backend-web-server
+./scripts/build.sh
 backend-web-server -web-port 2200 -queue-port-client 22000 -queue-port-peer 22001 -data-dir /tmp/etcd -logtostderr=true
 
 ETCDCTL_API=3 /etcdctl --endpoints=localhost:22000 get "" --from-key
@@ -66,5 +66,5 @@ sleep 5s
 ETCDCTL_API=3 /etcdctl --endpoints=localhost:22000 get "" --from-key
 
 CATS_PARAM_PATH=./datasets/parameters-cats.npy \
-  python3 ./backend/worker/worker.py http://localhost:2200/cats-request/queue
+  python3 ./backend/worker/worker.py localhost:2201
 COMMENT
@@ -14,8 +14,10 @@ backend-web-server \
   -logtostderr=true  &
 
 gen-frontend-dep \
+  -config frontend.yaml \
   -output-package-json package.json \
   -output-angular-cli-json angular-cli.json \
+  -output-proxy-config-json proxy.config.json \
   -logtostderr \
   && cat package.json \
   && yarn start-prod &
@@ -24,7 +26,7 @@ wait
 
 <<COMMENT
 rm -rf /tmp/etcd
-go install -v ./cmd/backend-web-server
+./scripts/build.sh
 backend-web-server \
   -web-host 0.0.0.0:2200 \
   -queue-port-client 22000 \
@@ -35,7 +37,7 @@ backend-web-server \
 yarn start-prod
 
 CATS_PARAM_PATH=./datasets/parameters-cats.npy \
-  python3 ./backend/worker/worker.py http://localhost:2200/cats-request/queue
+  python3 ./backend/worker/worker.py localhost:2201
 
 
 
@@ -61,5 +63,5 @@ sleep 5s
 
 ETCDCTL_API=3 /opt/bin/etcdctl --endpoints=localhost:22000 get "" --from-key
 
-python ./backend/worker/worker.py http://localhost:2200/cats-request/queue
+python ./backend/worker/worker.py localhost:2201
 COMMENT
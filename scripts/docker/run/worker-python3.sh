@@ -6,6 +6,6 @@ if ! [[ "$0" =~ "./scripts/docker/run/worker-python3.sh" ]]; then
   exit 255
 fi
 
-python3 ./backend/worker/worker.py http://localhost:2200/cats-request/queue &
+python3 ./backend/worker/worker.py localhost:2201 &
 
 wait
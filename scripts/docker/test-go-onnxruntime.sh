@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/docker/test-go-onnxruntime.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+docker run \
+  --rm \
+  -it \
+  --volume=`pwd`:/go/src/github.com/gyuho/dplearn \
+  --workdir=/go/src/github.com/gyuho/dplearn \
+  golang:1.19 \
+  /bin/sh -c "./scripts/tests/go-onnxruntime.sh"
@@ -1,6 +1,8 @@
 #!/usr/bin/env bash
 set -e
 
+# generated by cmd/gen-startup-script; DO NOT EDIT
+
 echo "root ALL=(ALL) NOPASSWD: ALL" >> /etc/sudoers
 
 #######################
@@ -74,7 +76,7 @@ cat > /etc/ansible-install.yml <<EOF
 
   - name: Download GCP key
     get_url:
-      url=http://metadata.google.internal/computeMetadata/v1/instance/attributes/gcp-key
+      url=http://metadata.google.internal/computeMetadata/v1/instance/attributes/gcp-key-dplearn
       dest=/etc/gcp-key-dplearn.json
       headers='Metadata-Flavor:Google'
 
@@ -214,18 +216,3 @@ systemctl start worker.service
 systemctl enable reverse-proxy.service
 systemctl start reverse-proxy.service
 #######################
-
-<<COMMENT
-if grep -q GOPATH "$(echo $HOME)/.bashrc"; then
-  echo "bashrc already has GOPATH";
-else
-  echo "adding GOPATH to bashrc";
-  echo "export GOPATH=$(echo $HOME)/go" >> $HOME/.bashrc;
-  PATH_VAR=$PATH":/opt/bin:/usr/local/go/bin:$(echo $HOME)/go/bin";
-  echo "export PATH=$(echo $PATH_VAR)" >> $HOME/.bashrc;
-  source $HOME/.bashrc;
-fi
-
-mkdir -p $GOPATH/bin/
-source $HOME/.bashrc
-COMMENT
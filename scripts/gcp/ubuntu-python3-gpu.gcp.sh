@@ -1,6 +1,8 @@
 #!/usr/bin/env bash
 set -e
 
+# generated by cmd/gen-startup-script; DO NOT EDIT
+
 if ! [[ "$0" =~ "./scripts/gcp/ubuntu-python3-gpu.gcp.sh" ]]; then
   echo "must be from repository root"
   exit 255
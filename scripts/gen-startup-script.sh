@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/gen-startup-script.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+go install -v ./cmd/gen-startup-script
+gen-startup-script -config=./startup.yaml -logtostderr=true
@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/gen-worker-client.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+go install -v ./cmd/gen-worker-client
+gen-worker-client --output backend/worker/queue_client.py --logtostderr
@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/gen-workerpb.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+# requires 'protoc', 'protoc-gen-go', and 'pip3 install grpcio-tools'
+protoc \
+  --go_out=plugins=grpc:./backend/workerpb \
+  --proto_path=./backend/workerpb \
+  ./backend/workerpb/worker.proto
+
+python3 -m grpc_tools.protoc \
+  --python_out=./backend/worker/workerpb \
+  --grpc_python_out=./backend/worker/workerpb \
+  --proto_path=./backend/workerpb \
+  ./backend/workerpb/worker.proto
+
+# generated Python imports 'worker_pb2' as top-level module
+sed -i 's/^import worker_pb2 as worker__pb2$/from . import worker_pb2 as worker__pb2/' ./backend/worker/workerpb/worker_pb2_grpc.py
@@ -0,0 +1,17 @@
+#!/usr/bin/env bash
+set -e
+
+if ! [[ "$0" =~ "./scripts/tests/go-onnxruntime.sh" ]]; then
+  echo "must be run from repository root"
+  exit 255
+fi
+
+# vendor/github.com/yalue/onnxruntime_go needs Go 1.19+,
+# while the rest of the tree is built with Go 1.9
+export GO111MODULE=off
+
+echo "Checking govet with '-tags onnxruntime'..."
+go vet -tags onnxruntime ./cmd/worker-go
+
+echo "Running tests with '-tags onnxruntime'..."
+go test -v -tags onnxruntime ./cmd/worker-go
@@ -26,6 +26,8 @@ python3 -m unittest backend.worker.cats.initialize_test
 python3 -m unittest backend.worker.cats.propagate_test
 DATASETS_DIR=${DATASETS_DIR} CATS_PARAM_PATH=${CATS_PARAM_PATH} python3 -m unittest backend.worker.cats.model_test
 DATASETS_DIR=${DATASETS_DIR} CATS_PARAM_PATH=${CATS_PARAM_PATH} python3 -m unittest backend.worker.cats_test
+python3 -m unittest backend.worker.progress_test
+python3 -m unittest backend.worker.queue_client_test
 
 if [[ "${SERVER_EXEC}" ]]; then
   echo SERVER_EXEC is defined: \""${SERVER_EXEC}"\"
@@ -0,0 +1,145 @@
+package startupscript
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config defines the startup scripts of the development instances,
+// and the scripts to create the instances.
+type Config struct {
+	Project string `yaml:"project"`
+	Zone    string `yaml:"zone"`
+
+	// ScriptsDir is the directory of the generated scripts
+	// (e.g. "./scripts/gcp"), relative to the repository root.
+	ScriptsDir string `yaml:"scripts-dir"`
+
+	// Registry is the container image repository (e.g. "gcr.io/gcp-dplearn/dplearn"),
+	// tagged with "<tag>-app", "<tag>-python3-cpu", and so on.
+	Registry string `yaml:"registry"`
+	Tag      string `yaml:"tag"`
+
+	// ReleaseURL is the release archive (tar.gz) of the dplearn binaries
+	// to extract to /opt/bin, or empty to only run the container images.
+	ReleaseURL string `yaml:"release-url"`
+	// ReleaseSHA256 is the SHA-256 checksum of the release archive to verify.
+	ReleaseSHA256 string `yaml:"release-sha256"`
+
+	// KeyMetadata is the instance metadata key of the GCP service account
+	// key, downloaded to /etc/gcp-key-dplearn.json.
+	KeyMetadata string `yaml:"key-metadata"`
+
+	// WebPort is the port of the frontend (served by the app container).
+	WebPort int `yaml:"web-port"`
+	// DataDir is the etcd data directory of the queue service.
+	DataDir string `yaml:"data-dir"`
+
+	CPU Instance `yaml:"cpu"`
+	GPU Instance `yaml:"gpu"`
+
+	// ScriptCPU and ScriptGPU are the startup scripts.
+	ScriptCPU string `yaml:"-"`
+	ScriptGPU string `yaml:"-"`
+	// CreateCPU and CreateGPU are the scripts to create the instances
+	// with the startup scripts.
+	CreateCPU string `yaml:"-"`
+	CreateGPU string `yaml:"-"`
+}
+
+// Instance defines the development instance.
+type Instance struct {
+	Name     string `yaml:"name"`
+	CPUs     int    `yaml:"cpus"`
+	MemoryGB int    `yaml:"memory-gb"`
+	DiskGB   int    `yaml:"disk-gb"`
+	// GPUType and GPUCount are the accelerators (e.g. "nvidia-tesla-k80").
+	GPUType  string `yaml:"gpu-type"`
+	GPUCount int    `yaml:"gpu-count"`
+}
+
+// tmplData is the template data of the variant (CPU or GPU).
+type tmplData struct {
+	Config
+	Instance
+
+	// Variant is "cpu" or "gpu".
+	Variant string
+	GPU     bool
+	// Docker is the docker command to run the containers.
+	Docker string
+	// ScriptPath and CreatePath are the paths of the generated scripts.
+	ScriptPath string
+	CreatePath string
+}
+
+// ScriptPath returns the path of the startup script of the variant ("cpu" or "gpu").
+func (cfg Config) ScriptPath(variant string) string {
+	return fmt.Sprintf("%s/ubuntu-python3-%s.ansible.sh", cfg.ScriptsDir, variant)
+}
+
+// CreatePath returns the path of the script to create the instance of the variant.
+func (cfg Config) CreatePath(variant string) string {
+	return fmt.Sprintf("%s/ubuntu-python3-%s.gcp.sh", cfg.ScriptsDir, variant)
+}
+
+// Read reads the startup script configuration, and renders the scripts.
+func Read(p string) (Config, error) {
+	bts, err := ioutil.ReadFile(p)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err = yaml.Unmarshal(bts, &cfg); err != nil {
+		return Config{}, err
+	}
+	if cfg.KeyMetadata == "" || cfg.Registry == "" || cfg.Tag == "" {
+		return Config{}, fmt.Errorf("%q must specify key-metadata, registry, and tag", p)
+	}
+	if cfg.GPU.GPUType == "" || cfg.GPU.GPUCount == 0 {
+		return Config{}, fmt.Errorf("%q must specify the GPUs of the GPU instance", p)
+	}
+
+	for _, v := range []struct {
+		variant string
+		inst    Instance
+		script  *string
+		create  *string
+	}{
+		{"cpu", cfg.CPU, &cfg.ScriptCPU, &cfg.CreateCPU},
+		{"gpu", cfg.GPU, &cfg.ScriptGPU, &cfg.CreateGPU},
+	} {
+		d := tmplData{
+			Config:     cfg,
+			Instance:   v.inst,
+			Variant:    v.variant,
+			GPU:        v.variant == "gpu",
+			Docker:     "docker",
+			ScriptPath: cfg.ScriptPath(v.variant),
+			CreatePath: cfg.CreatePath(v.variant),
+		}
+		if d.GPU {
+			d.Docker = "nvidia-docker"
+		}
+		if *v.script, err = execute(startupScript, d); err != nil {
+			return Config{}, err
+		}
+		if *v.create, err = execute(createScript, d); err != nil {
+			return Config{}, err
+		}
+	}
+	return cfg, nil
+}
+
+func execute(tmpl string, d tmplData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := template.Must(template.New("tmpl").Parse(tmpl)).Execute(buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,41 @@
+package startupscript
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRead ensures that the scripts in the repository are generated
+// from the repository configuration.
+func TestRead(t *testing.T) {
+	cfg, err := Read("../startup.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []struct {
+		path string
+		data string
+	}{
+		{cfg.ScriptPath("cpu"), cfg.ScriptCPU},
+		{cfg.ScriptPath("gpu"), cfg.ScriptGPU},
+		{cfg.CreatePath("cpu"), cfg.CreateCPU},
+		{cfg.CreatePath("gpu"), cfg.CreateGPU},
+	} {
+		bts, err := ioutil.ReadFile(filepath.Join("..", s.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bts) != s.data {
+			t.Errorf("%q is out of date (run ./scripts/gen-startup-script.sh)", s.path)
+		}
+	}
+
+	if strings.Contains(cfg.ScriptCPU, "nvidia") {
+		t.Fatalf("CPU startup script must not install GPU drivers:\n%s", cfg.ScriptCPU)
+	}
+	if !strings.Contains(cfg.CreateGPU, "--accelerator type=nvidia-tesla-k80,count=1") {
+		t.Fatalf("unexpected GPU create script:\n%s", cfg.CreateGPU)
+	}
+}
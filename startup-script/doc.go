@@ -0,0 +1,2 @@
+// Package startupscript defines the GCE startup script templates.
+package startupscript
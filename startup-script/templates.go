@@ -0,0 +1,357 @@
+package startupscript
+
+// startupScript installs the dependencies, and runs the services with systemd.
+// Ansible expressions are escaped (e.g. {{"{{item}}"}}).
+const startupScript = `#!/usr/bin/env bash
+set -e
+
+# generated by cmd/gen-startup-script; DO NOT EDIT
+
+echo "root ALL=(ALL) NOPASSWD: ALL" >> /etc/sudoers
+
+#######################
+apt-get -y --allow-unauthenticated install ansible
+
+cat > /etc/ansible-install.yml <<EOF
+---
+- name: a play that runs entirely on the ansible host
+  hosts: localhost
+  connection: local
+
+  environment:
+    PATH: /usr/local/go/bin:/opt/bin:/home/gyuho/go/bin:{{"{{ ansible_env.PATH }}"}}
+    GOPATH: /home/gyuho/go
+
+  tasks:
+  - file:
+      path: /opt/bin
+      state: directory
+      mode: 0777
+
+  - file:
+      path: {{.DataDir}}
+      state: directory
+      mode: 0777
+
+  - file:
+      path: /var/lib/keras/datasets
+      state: directory
+      mode: 0777
+
+  - file:
+      path: /var/lib/keras/models
+      state: directory
+      mode: 0777
+
+  - file:
+      path: /home/gyuho/go
+      state: directory
+      mode: 0777
+
+  - name: Install Linux utils
+    become: yes
+    apt:
+      name={{"{{item}}"}}
+      state=latest
+      update_cache=yes
+      force=yes
+    with_items:
+    - build-essential
+    - gcc
+    - apt-utils
+    - pkg-config
+    - software-properties-common
+    - apt-transport-https
+    - libssl-dev
+    - sudo
+    - bash
+    - bash-completion
+    - tar
+    - unzip
+    - curl
+    - wget
+    - git
+    - libcupti-dev
+    - rsync
+    - python
+    - python-pip
+    - python-dev
+    - python3-pip
+
+  - name: Download GCP key
+    get_url:
+      url=http://metadata.google.internal/computeMetadata/v1/instance/attributes/{{.KeyMetadata}}
+      dest=/etc/gcp-key-dplearn.json
+      headers='Metadata-Flavor:Google'
+{{if .ReleaseURL}}
+  - name: Download release archive
+    get_url:
+      url={{.ReleaseURL}}
+      dest=/tmp/dplearn-release.tar.gz
+{{- if .ReleaseSHA256}}
+      checksum=sha256:{{.ReleaseSHA256}}
+{{- end}}
+
+  - name: Extract release archive
+    unarchive:
+      src=/tmp/dplearn-release.tar.gz
+      dest=/opt/bin
+      remote_src=yes
+{{end}}
+  - name: Download Docker installer
+    get_url:
+      url=https://get.docker.com
+      dest=/tmp/docker.sh
+
+  - name: Execute the docker.sh
+    script: /tmp/docker.sh
+{{if .GPU}}
+  - name: Download GPU driver
+    get_url:
+      url=https://github.com/NVIDIA/nvidia-docker/releases/download/v1.0.1/nvidia-docker_1.0.1-1_amd64.deb
+      dest=/tmp/nvidia-docker_1.0.1-1_amd64.deb
+
+  - name: Install GPU driver
+    sudo: True
+    command: dpkg -i /tmp/nvidia-docker_1.0.1-1_amd64.deb
+
+  - name: Download CUDA driver
+    get_url:
+      url=http://developer.download.nvidia.com/compute/cuda/repos/ubuntu1604/x86_64/cuda-repo-ubuntu1604_8.0.61-1_amd64.deb
+      dest=/tmp/cuda-repo-ubuntu1604_8.0.61-1_amd64.deb
+
+  - name: Install CUDA driver
+    sudo: True
+    command: dpkg -i /tmp/cuda-repo-ubuntu1604_8.0.61-1_amd64.deb
+
+  - name: Install CUDA in Linux
+    become: yes
+    apt:
+      name={{"{{item}}"}}
+      state=latest
+      update_cache=yes
+      force=yes
+    with_items:
+    - cuda
+
+  - modprobe: name=nvidia state=absent
+
+  - name: Check nvidia-smi
+    command: nvidia-smi
+    register: result
+  - debug:
+      var: result.stderr
+{{end}}EOF
+
+ansible-playbook /etc/ansible-install.yml > /etc/ansible-install.log 2>&1
+#######################
+
+#######################
+systemctl daemon-reload
+{{- if .GPU}}
+systemctl stop nvidia-docker.service
+systemctl disable nvidia-docker.service
+systemctl enable nvidia-docker.service
+systemctl start nvidia-docker.service
+{{- end}}
+#######################
+
+#######################
+cat > /tmp/app.service <<EOF
+[Unit]
+Description=dplearn {{if .GPU}}GPU{{else}}CPU{{end}} development service
+Documentation=https://github.com/gyuho/dplearn
+
+[Service]
+Restart=always
+RestartSec=5s
+TimeoutStartSec=0
+LimitNOFILE=40000
+
+ExecStartPre=/usr/bin/docker login -u oauth2accesstoken -p "$(/usr/bin/gcloud auth application-default print-access-token)" https://gcr.io
+ExecStartPre=/usr/bin/docker pull {{.Registry}}:{{.Tag}}-app
+
+ExecStart=/usr/bin/{{.Docker}} run \
+  --rm \
+  --name app \
+  --volume=/tmp:/tmp \
+  --volume={{.DataDir}}:{{.DataDir}} \
+  -p {{.WebPort}}:{{.WebPort}} \
+  --ulimit nofile=262144:262144 \
+  {{.Registry}}:{{.Tag}}-app \
+  /bin/sh -c "./scripts/docker/run/app.sh"
+
+ExecStop=/usr/bin/docker rm --force app
+
+[Install]
+WantedBy=multi-user.target
+EOF
+cat /tmp/app.service
+mv -f /tmp/app.service /etc/systemd/system/app.service
+#######################
+
+#######################
+cat > /tmp/worker.service <<EOF
+[Unit]
+Description=dplearn {{if .GPU}}GPU{{else}}CPU{{end}} development service
+Documentation=https://github.com/gyuho/dplearn
+
+After=app.service
+
+[Service]
+Restart=always
+RestartSec=5s
+TimeoutStartSec=0
+LimitNOFILE=40000
+
+ExecStartPre=/usr/bin/docker login -u oauth2accesstoken -p "$(/usr/bin/gcloud auth application-default print-access-token)" https://gcr.io
+ExecStartPre=/usr/bin/docker pull {{.Registry}}:{{.Tag}}-python3-{{.Variant}}
+
+ExecStart=/usr/bin/{{.Docker}} run \
+  --rm \
+  --name worker \
+  --env CATS_PARAM_PATH=/root/datasets/parameters-cats.npy \
+  --volume=/tmp:/tmp \
+  --volume={{.DataDir}}:{{.DataDir}} \
+  --volume=/var/lib/keras/datasets:/root/.keras/datasets \
+  --volume=/var/lib/keras/models:/root/.keras/models \
+  -p {{.WebPort}}:{{.WebPort}} \
+  --ulimit nofile=262144:262144 \
+  {{.Registry}}:{{.Tag}}-python3-{{.Variant}} \
+  /bin/sh -c "./scripts/docker/run/worker-python3.sh"
+
+ExecStop=/usr/bin/docker rm --force worker
+
+[Install]
+WantedBy=multi-user.target
+EOF
+cat /tmp/worker.service
+mv -f /tmp/worker.service /etc/systemd/system/worker.service
+#######################
+
+#######################
+cat > /tmp/reverse-proxy.service <<EOF
+[Unit]
+Description=dplearn reverse proxy
+Documentation=https://github.com/gyuho/dplearn
+
+After=app.service
+
+[Service]
+Restart=always
+RestartSec=5s
+TimeoutStartSec=0
+LimitNOFILE=40000
+
+ExecStartPre=/usr/bin/docker login -u oauth2accesstoken -p "$(/usr/bin/gcloud auth application-default print-access-token)" https://gcr.io
+ExecStartPre=/usr/bin/docker pull {{.Registry}}:{{.Tag}}-reverse-proxy
+
+ExecStart=/usr/bin/docker \
+  run \
+  --rm \
+  --name reverse-proxy \
+  --net=host \
+  --ulimit nofile=262144:262144 \
+  {{.Registry}}:{{.Tag}}-reverse-proxy \
+  /bin/sh -c "./scripts/docker/run/reverse-proxy.sh"
+
+ExecStop=/usr/bin/docker rm --force reverse-proxy
+
+[Install]
+WantedBy=multi-user.target
+EOF
+cat /tmp/reverse-proxy.service
+mv -f /tmp/reverse-proxy.service /etc/systemd/system/reverse-proxy.service
+#######################
+{{if .GPU}}
+#######################
+cat > /tmp/python3-ipython-gpu.service <<EOF
+[Unit]
+Description=dplearn GPU development service
+Documentation=https://github.com/gyuho/dplearn
+
+[Service]
+Restart=always
+RestartSec=5s
+TimeoutStartSec=0
+LimitNOFILE=40000
+
+ExecStartPre=/usr/bin/docker login -u oauth2accesstoken -p "$(/usr/bin/gcloud auth application-default print-access-token)" https://gcr.io
+ExecStartPre=/usr/bin/docker pull {{.Registry}}:{{.Tag}}-python3-gpu
+
+ExecStart=/usr/bin/nvidia-docker run \
+  --rm \
+  --name python3-ipython-gpu \
+  --publish 8888:8888 \
+  --volume=` + "`pwd`" + `/notebooks:/notebooks \
+  --volume=/var/lib/keras/datasets:/root/.keras/datasets \
+  --volume=/var/lib/keras/models:/root/.keras/models \
+  --ulimit nofile=262144:262144 \
+  {{.Registry}}:{{.Tag}}-python3-gpu \
+  /bin/sh -c "PASSWORD='' ./run_jupyter.sh -y --allow-root --notebook-dir=./notebooks"
+
+ExecStop=/usr/bin/docker rm --force python3-ipython-gpu
+
+[Install]
+WantedBy=multi-user.target
+EOF
+cat /tmp/python3-ipython-gpu.service
+mv -f /tmp/python3-ipython-gpu.service /etc/systemd/system/python3-ipython-gpu.service
+#######################
+{{end}}
+#######################
+systemctl daemon-reload
+{{if .GPU}}
+<<COMMENT
+systemctl enable python3-ipython-gpu.service
+systemctl start python3-ipython-gpu.service
+COMMENT
+{{end}}
+systemctl enable app.service
+systemctl start app.service
+
+systemctl enable worker.service
+systemctl start worker.service
+
+systemctl enable reverse-proxy.service
+systemctl start reverse-proxy.service
+#######################
+`
+
+// createScript creates the instance with the startup script.
+const createScript = `#!/usr/bin/env bash
+set -e
+
+# generated by cmd/gen-startup-script; DO NOT EDIT
+
+if ! [[ "$0" =~ "{{.CreatePath}}" ]]; then
+  echo "must be from repository root"
+  exit 255
+fi
+
+if [[ "${GCP_KEY_PATH}" ]]; then
+  echo GCP_KEY_PATH is defined: \""${GCP_KEY_PATH}"\"
+else
+  echo GCP_KEY_PATH is not defined!
+  exit 255
+fi
+
+gcloud config set project {{.Project}}
+
+gcloud {{if .GPU}}beta {{end}}compute instances create {{.Name}} \
+  --custom-cpu={{.CPUs}} \
+  --custom-memory={{.MemoryGB}} \
+  --zone {{.Zone}} \
+  --image-family=ubuntu-1604-lts \
+  --image-project=ubuntu-os-cloud \
+  --boot-disk-size={{.DiskGB}} \
+  --boot-disk-type="pd-ssd" \
+  --network default \
+  --tags=dplearn,http-server,https-server \
+  --maintenance-policy=MIGRATE \
+  --restart-on-failure \
+{{- if .GPU}}
+  --accelerator type={{.GPUType}},count={{.GPUCount}} \
+{{- end}}
+  --metadata-from-file {{.KeyMetadata}}=${GCP_KEY_PATH},startup-script={{.ScriptPath}}
+`